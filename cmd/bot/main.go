@@ -5,23 +5,35 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/bot"
 	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/config"
 	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
 	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/events"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/health"
 	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/logger"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/metrics"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/middleware"
 	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/repository"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/selftest"
 	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/service"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/session"
 	"go.uber.org/fx"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
@@ -89,7 +101,12 @@ func NewLogrusLogger(appLogger logger.Logger) *logrus.Logger {
 // NewDatabase creates a new database connection
 func NewDatabase(cfg *config.Config, appLogger logger.Logger) (*gorm.DB, error) {
 	logrusLogger := NewLogrusLogger(appLogger)
-	db, err := gorm.Open(postgres.Open(cfg.DatabaseURL), &gorm.Config{})
+	dialector, err := repository.NewDialector(cfg.DatabaseDriver, cfg.DatabaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
@@ -106,6 +123,7 @@ func NewDatabase(cfg *config.Config, appLogger logger.Logger) (*gorm.DB, error)
 	sqlDB.SetConnMaxLifetime(cfg.DatabaseConnMaxLifetime)
 
 	logrusLogger.WithFields(logrus.Fields{
+		"driver":         cfg.DatabaseDriver,
 		"max_open_conns": cfg.DatabaseMaxConns,
 		"max_idle_conns": cfg.DatabaseMaxIdleConns,
 		"conn_max_lifetime": cfg.DatabaseConnMaxLifetime,
@@ -114,46 +132,526 @@ func NewDatabase(cfg *config.Config, appLogger logger.Logger) (*gorm.DB, error)
 	return db, nil
 }
 
-// NewUserRepository creates a new UserRepository instance
-func NewUserRepository(db *gorm.DB) domain.UserRepository {
-	return repository.NewUserRepository(db)
+const (
+	// migrationAttempts is the number of times migrations are tried on startup
+	migrationAttempts = 3
+	// migrationBackoff is the initial delay between migration attempts, doubled after each failure
+	migrationBackoff = 2 * time.Second
+)
+
+// runMigrations applies the database schema, retrying with exponential backoff
+// so a database that is still starting up does not fail the bot immediately
+func runMigrations(ctx context.Context, db *gorm.DB, logger *logrus.Logger, attempts int, backoff time.Duration) error {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = repository.AutoMigrate(ctx, db)
+		if err == nil {
+			logger.WithField("attempt", attempt).Info("Database migrations applied")
+			return nil
+		}
+
+		logger.WithError(err).WithFields(logrus.Fields{
+			"attempt":      attempt,
+			"max_attempts": attempts,
+		}).Warn("Database migration attempt failed")
+
+		if attempt == attempts {
+			break
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return fmt.Errorf("database migrations cancelled: %w", ctx.Err())
+		}
+	}
+
+	return fmt.Errorf("failed to run database migrations after %d attempts: %w", attempts, err)
+}
+
+// NewUserRepository creates a new UserRepository instance whose queries time out after DB_QUERY_TIMEOUT
+func NewUserRepository(db *gorm.DB, cfg *config.Config) domain.UserRepository {
+	return repository.NewTimeoutUserRepository(repository.NewUserRepository(db), cfg.DatabaseQueryTimeout)
+}
+
+// NewTransactionManager creates a new TransactionManager instance whose user queries time out after DB_QUERY_TIMEOUT
+func NewTransactionManager(db *gorm.DB, cfg *config.Config) domain.TransactionManager {
+	return repository.NewTransactionManagerWithTimeout(db, cfg.DatabaseQueryTimeout)
+}
+
+// NewActivityRepository creates a new in-memory user activity repository
+func NewActivityRepository() domain.UserActivityRepository {
+	return repository.NewMemoryActivityRepository(repository.DefaultCommandHistorySize, repository.DefaultCommandHistoryUsers)
+}
+
+// NewSettingsRepository creates a new SettingsRepository instance
+func NewSettingsRepository(db *gorm.DB) domain.SettingsRepository {
+	return repository.NewSettingsRepository(db)
+}
+
+// NewBugReportRepository creates a new bug report repository
+func NewBugReportRepository(db *gorm.DB) domain.BugReportRepository {
+	return repository.NewBugReportRepository(db)
+}
+
+// NewAuditLogRepository creates a new audit log repository
+func NewAuditLogRepository(db *gorm.DB) domain.AuditLogRepository {
+	return repository.NewAuditLogRepository(db)
+}
+
+// NewUserSightingRepository creates a new first-seen repository
+func NewUserSightingRepository(db *gorm.DB) domain.UserSightingRepository {
+	return repository.NewUserSightingRepository(db)
+}
+
+// NewLastActiveRecorder creates the recorder for the last update seen from each registered user
+func NewLastActiveRecorder(userRepo domain.UserRepository, appLogger logger.Logger) *bot.LastActiveRecorder {
+	return bot.NewLastActiveRecorder(userRepo, NewLogrusLogger(appLogger))
+}
+
+// NewFirstSeenRecorder creates the recorder for the first update seen from each user
+func NewFirstSeenRecorder(sightingRepo domain.UserSightingRepository, appLogger logger.Logger) *bot.FirstSeenRecorder {
+	return bot.NewFirstSeenRecorder(sightingRepo, NewLogrusLogger(appLogger))
+}
+
+// NewDynamicConfig creates the runtime settings overlay on top of the environment configuration
+func NewDynamicConfig(cfg *config.Config, settingsRepo domain.SettingsRepository, appLogger logger.Logger) *config.DynamicConfig {
+	dynamicConfig := config.NewDynamicConfig(cfg, settingsRepo, cfg.SettingsRefreshInterval)
+	logrusLogger := NewLogrusLogger(appLogger)
+	dynamicConfig.SetChangeListener(func(changes []domain.SettingChange) {
+		for _, change := range changes {
+			if change.Key == config.SettingLogLevel {
+				applyLogLevel(logrusLogger, dynamicConfig.LogLevel())
+			}
+		}
+	})
+	return dynamicConfig
+}
+
+// applyLogLevel switches the logger to level, which was validated when it was configured
+func applyLogLevel(logrusLogger *logrus.Logger, level string) {
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		logrusLogger.WithError(err).Warn("Ignoring invalid log level")
+		return
+	}
+	if logrusLogger.GetLevel() != parsed {
+		logrusLogger.SetLevel(parsed)
+		logrusLogger.WithField("log_level", level).Info("Log level changed")
+	}
 }
 
-// NewTransactionManager creates a new TransactionManager instance
-func NewTransactionManager(db *gorm.DB) domain.TransactionManager {
-	return repository.NewTransactionManager(db)
+// StartConfigReloader reloads the runtime configuration on SIGHUP, the same reload
+// /reloadconfig triggers
+func StartConfigReloader(lifecycle fx.Lifecycle, dynamicConfig *config.DynamicConfig, appLogger logger.Logger) {
+	logrusLogger := NewLogrusLogger(appLogger)
+	signals := make(chan os.Signal, 1)
+
+	lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			signal.Notify(signals, syscall.SIGHUP)
+			go func() {
+				for range signals {
+					changes, err := dynamicConfig.Reload(context.Background())
+					if err != nil {
+						logrusLogger.WithError(err).Error("Failed to reload config")
+						continue
+					}
+					for _, change := range changes {
+						logrusLogger.WithFields(logrus.Fields{
+							"key": change.Key,
+							"old": change.Old,
+							"new": change.New,
+						}).Info("Setting changed on reload")
+					}
+					logrusLogger.WithField("changes", len(changes)).Info("Config reloaded on SIGHUP")
+				}
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			signal.Stop(signals)
+			close(signals)
+			return nil
+		},
+	})
 }
 
 // NewUserService creates a new UserService instance
-func NewUserService(userRepo domain.UserRepository, txManager domain.TransactionManager, eventService *events.Service) domain.UserService {
-	return service.NewUserServiceWithEvents(userRepo, txManager, eventService)
+func NewUserService(userRepo domain.UserRepository, txManager domain.TransactionManager, eventService *events.Service, notificationDispatcher *bot.NotificationDispatcher, dynamicConfig *config.DynamicConfig, vpnService domain.VPNService, cfg *config.Config) domain.UserService {
+	userService := service.NewUserServiceWithEvents(userRepo, txManager, eventService)
+	userService.SetTrialQuotaLimit(cfg.TrialQuotaLimit)
+	userService.SetTrialQuotaSource(dynamicConfig.TrialQuotaLimit)
+	userService.SetTrialDuration(cfg.TrialDuration)
+	userService.SetReferralBonus(cfg.ReferralBonus)
+	userService.SetTrialQuotas(cfg.TrialQuotaRegions)
+	userService.SetQuotaPolicy(newQuotaPolicy(dynamicConfig, cfg))
+	userService.SetQuotaAlertNotifier(bot.NewQuotaAlertNotifier(notificationDispatcher))
+	if vpnService != nil {
+		userService.SetConfigRevoker(vpnService)
+	}
+	return userService
+}
+
+// newQuotaPolicy creates the quota rules shared by the services. Lapsed plans fall back
+// to the quota the plan expiry sweeper downgrades them to
+func newQuotaPolicy(dynamicConfig *config.DynamicConfig, cfg *config.Config) domain.QuotaPolicy {
+	return domain.DefaultQuotaPolicy{
+		GracePeriod: cfg.PaidGracePeriod,
+		LapsedLimit: dynamicConfig.TrialQuotaLimit,
+	}
+}
+
+// NewVPNService creates the service issuing VPN configs, or nil when no VPN server is configured
+func NewVPNService(userRepo domain.UserRepository, eventService *events.Service, dynamicConfig *config.DynamicConfig, appLogger logger.Logger, cfg *config.Config) (domain.VPNService, error) {
+	if !cfg.IsVPNEnabled() {
+		return nil, nil
+	}
+
+	subnet, err := netip.ParsePrefix(cfg.VPNClientSubnet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse VPN client subnet: %w", err)
+	}
+
+	vpnService := service.NewVPNService(userRepo, service.VPNServer{
+		Endpoint:     cfg.VPNServerEndpoint,
+		PublicKey:    cfg.VPNServerPublicKey,
+		DNS:          cfg.VPNDNS,
+		ClientSubnet: subnet,
+	})
+	vpnService.SetQuotaPolicy(newQuotaPolicy(dynamicConfig, cfg))
+	vpnService.SetEventService(eventService)
+	vpnService.SetLogger(NewLogrusLogger(appLogger))
+	return vpnService, nil
+}
+
+// NewGateway creates the VPN gateway /test queries, or nil when no WireGuard interface is configured
+func NewGateway(userRepo domain.UserRepository, cfg *config.Config) domain.Gateway {
+	if cfg.VPNWGInterface == "" {
+		return nil
+	}
+	return service.NewWireGuardGateway(userRepo, cfg.VPNWGInterface)
 }
 
 // NewBotHandler creates a new bot handler instance
-func NewBotHandler(botAPI *tgbotapi.BotAPI, userService domain.UserService, appLogger logger.Logger, eventService *events.Service) *bot.Handler {
+func NewBotHandler(botAPI bot.BotAPI, userService domain.UserService, appLogger logger.Logger, eventService *events.Service, activityRepo domain.UserActivityRepository, bugReportRepo domain.BugReportRepository, floodController *bot.FloodController, helpRenderer *bot.HelpRenderer, dynamicConfig *config.DynamicConfig, planCatalog *domain.PlanCatalog, paymentService domain.PaymentService, retentionEnforcer *service.RetentionEnforcer, vpnService domain.VPNService, gateway domain.Gateway, auditLogRepo domain.AuditLogRepository, notificationDispatcher *bot.NotificationDispatcher, botMetrics *metrics.Metrics, cfg *config.Config) *bot.Handler {
 	logrusLogger := NewLogrusLogger(appLogger)
-	return bot.NewHandlerWithEvents(botAPI, userService, logrusLogger, eventService)
+	handler := bot.NewHandlerWithEvents(bot.NewFloodAwareBotAPI(botAPI, floodController), userService, logrusLogger, eventService)
+	handler.SetAdminIDs(cfg.AdminTelegramIDs)
+	handler.SetActivityRepository(activityRepo)
+	handler.SetHelpRenderer(helpRenderer)
+	handler.SetSettingsStore(dynamicConfig)
+	handler.SetBugReportRepository(bugReportRepo)
+	handler.SetAdminChatID(cfg.AdminChatID)
+	handler.SetAnonymizeUsernames(cfg.AnonymizeUsernames)
+	handler.SetVersion(cfg.Version)
+	handler.SetPlanCatalog(planCatalog)
+	handler.SetPaymentService(paymentService)
+	handler.SetPaymentProviderToken(cfg.PaymentProviderToken)
+	handler.SetDataRetention(retentionEnforcer)
+	handler.SetVPNService(vpnService)
+	handler.SetGateway(gateway)
+	handler.SetAuditLogRepository(auditLogRepo)
+	handler.SetConfigReloader(dynamicConfig)
+	handler.SetConfigSummary(cfg.SummaryRedacted())
+	handler.SetNotificationDispatcher(notificationDispatcher)
+	handler.SetCommandRecorder(botMetrics)
+	return handler
+}
+
+// NewPaymentService creates the service applying successful payments
+func NewPaymentService(txManager domain.TransactionManager, planCatalog *domain.PlanCatalog, eventService *events.Service) domain.PaymentService {
+	paymentService := service.NewPaymentService(txManager, planCatalog)
+	paymentService.SetEventService(eventService)
+	return paymentService
 }
 
-// NewRateLimiter creates a new rate limiter instance
-func NewRateLimiter() *bot.RateLimiter {
-	return bot.NewRateLimiter()
+// NewPlanExpirySweeper creates the job downgrading users whose paid plan lapsed
+func NewPlanExpirySweeper(userRepo domain.UserRepository, eventService *events.Service, notificationDispatcher *bot.NotificationDispatcher, dynamicConfig *config.DynamicConfig, cfg *config.Config) *service.PlanExpirySweeper {
+	sweeper := service.NewPlanExpirySweeper(userRepo, dynamicConfig.TrialQuotaLimit, cfg.PlanExpiryCheckInterval)
+	sweeper.SetGracePeriod(cfg.PaidGracePeriod)
+	sweeper.SetEventService(eventService)
+	sweeper.SetNotifier(bot.NewPlanExpiryNotifier(notificationDispatcher))
+	return sweeper
 }
 
-// NewAuditLogger creates a new audit logger instance  
-func NewAuditLogger(appLogger logger.Logger) *bot.AuditLogger {
+// StartPlanExpirySweeper runs the plan expiry sweeper while the application runs
+func StartPlanExpirySweeper(lifecycle fx.Lifecycle, sweeper *service.PlanExpirySweeper, appLogger logger.Logger) {
 	logrusLogger := NewLogrusLogger(appLogger)
-	return bot.NewAuditLogger(logrusLogger)
+
+	lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			sweeper.Start(func(err error) {
+				logrusLogger.WithError(err).Error("Failed to downgrade expired plans")
+			})
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			sweeper.Stop()
+			return nil
+		},
+	})
+}
+
+// NewNotificationDispatcher creates the dispatcher features queue notifications to
+// users with. Users whose private chat is gone are recorded as unreachable
+func NewNotificationDispatcher(botAPI bot.BotAPI, floodController *bot.FloodController, userRepo domain.UserRepository, appLogger logger.Logger, cfg *config.Config) *bot.NotificationDispatcher {
+	logrusLogger := NewLogrusLogger(appLogger)
+	dispatcher := bot.NewNotificationDispatcher(bot.NewFloodAwareBotAPI(botAPI, floodController), logrusLogger,
+		cfg.NotificationRate, bot.DefaultNotificationQueueSize)
+	if start, end, loc, err := cfg.GetQuietHours(); err == nil {
+		dispatcher.SetQuietHours(bot.QuietHours{Start: start, End: end, Location: loc})
+	}
+	dispatcher.SetOutcomeHandler(func(outcome bot.NotificationOutcome) {
+		switch outcome.Status {
+		case bot.NotificationUnreachable:
+			if err := userRepo.UpdateUnreachableAt(context.Background(), outcome.UserID, &outcome.At); err != nil {
+				logrusLogger.WithError(err).WithField("user_id", outcome.UserID).Error("Failed to mark user unreachable")
+			}
+		case bot.NotificationBlocked:
+			if err := userRepo.UpdateBlocked(context.Background(), outcome.UserID, true); err != nil {
+				logrusLogger.WithError(err).WithField("user_id", outcome.UserID).Error("Failed to mark user blocked")
+			}
+		}
+	})
+	return dispatcher
+}
+
+// StartNotificationDispatcher sends queued notifications while the application runs
+func StartNotificationDispatcher(lifecycle fx.Lifecycle, dispatcher *bot.NotificationDispatcher) {
+	lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			dispatcher.Start()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			dispatcher.Stop()
+			return nil
+		},
+	})
+}
+
+// NewRetentionEnforcer creates the job anonymizing users inactive for longer than DATA_RETENTION_DAYS
+func NewRetentionEnforcer(userRepo domain.UserRepository, eventService *events.Service, cfg *config.Config) *service.RetentionEnforcer {
+	retention := time.Duration(cfg.DataRetentionDays) * 24 * time.Hour
+	enforcer := service.NewRetentionEnforcer(userRepo, retention, service.DefaultRetentionInterval)
+	enforcer.SetEventService(eventService)
+	return enforcer
+}
+
+// StartRetentionEnforcer runs the retention policy while the application runs, if one is configured
+func StartRetentionEnforcer(lifecycle fx.Lifecycle, enforcer *service.RetentionEnforcer, appLogger logger.Logger) {
+	if !enforcer.Enabled() {
+		return
+	}
+	logrusLogger := NewLogrusLogger(appLogger)
+
+	lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			enforcer.Start(func(err error) {
+				logrusLogger.WithError(err).Error("Failed to anonymize inactive users")
+			})
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			enforcer.Stop()
+			return nil
+		},
+	})
+}
+
+// NewPlanCatalog creates the plan catalog shared by every plan-aware feature
+func NewPlanCatalog(cfg *config.Config) (*domain.PlanCatalog, error) {
+	catalog, err := domain.NewPlanCatalog(cfg.Plans)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create plan catalog: %w", err)
+	}
+	return catalog, nil
+}
+
+// NewHelpRenderer creates the help renderer shared by all bot handlers
+func NewHelpRenderer(cfg *config.Config) (*bot.HelpRenderer, error) {
+	return bot.NewHelpRenderer(cfg.HelpTemplatePath, cfg.SupportContact, cfg.TrialQuotaLimit)
+}
+
+// NewUnsupportedUpdateHandler creates the handler for updates the bot does not process
+func NewUnsupportedUpdateHandler(botAPI bot.BotAPI, floodController *bot.FloodController, appLogger logger.Logger, botMetrics *metrics.Metrics, cfg *config.Config) *bot.UnsupportedUpdateHandler {
+	handler := bot.NewUnsupportedUpdateHandler(bot.NewFloodAwareBotAPI(botAPI, floodController), NewLogrusLogger(appLogger), cfg.EditedMessageHint)
+	handler.SetRecorder(botMetrics)
+	return handler
+}
+
+// NewProcessLock creates the lock that keeps a second bot instance from starting
+func NewProcessLock(cfg *config.Config) *bot.ProcessLock {
+	return bot.NewProcessLock(cfg.ProcessLockPath)
+}
+
+// NewEditedMessageTracker creates the tracker that lets users fix commands by editing them
+func NewEditedMessageTracker() *bot.EditedMessageTracker {
+	return bot.NewEditedMessageTracker(0)
+}
+
+// NewFloodController creates a flood controller shared by all bot handlers and exports its
+// state as metrics
+func NewFloodController(botMetrics *metrics.Metrics) *bot.FloodController {
+	floodController := bot.NewFloodController()
+	botMetrics.ObserveFloodControl(func() metrics.FloodControlState {
+		state := floodController.State()
+		return metrics.FloodControlState{
+			InCooldown: state.InCooldown,
+			RecentHits: state.RecentHits,
+			Queued:     state.Queued,
+			Dropped:    state.Dropped,
+		}
+	})
+	return floodController
+}
+
+// StartFloodController sends messages deferred during a flood-wait cool down once it ends
+func StartFloodController(lifecycle fx.Lifecycle, floodController *bot.FloodController, botAPI bot.BotAPI) {
+	lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			floodController.Start(botAPI)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			floodController.Stop()
+			return nil
+		},
+	})
+}
+
+// NewAbuseGuard creates the abuse guard that auto-bans users who keep hitting the rate limit.
+// Admins are exempt
+func NewAbuseGuard(cfg *config.Config) *bot.AbuseGuard {
+	return bot.NewAbuseGuard(cfg.AbuseBanThreshold, cfg.AbuseBanWindow, cfg.AdminTelegramIDs)
+}
+
+// redisConnectTimeout bounds the startup check that Redis is reachable
+const redisConnectTimeout = 5 * time.Second
+
+// stoppableRateLimiter is a rate limiter with background work to stop on shutdown
+type stoppableRateLimiter interface {
+	middleware.RateLimiter
+	Stop()
+}
+
+// NewRateLimiter creates the rate limiter. With REDIS_URL set the limits are shared
+// by all instances through Redis; if Redis is unreachable at startup the limits are
+// kept in memory instead
+func NewRateLimiter(lifecycle fx.Lifecycle, appLogger logger.Logger, cfg *config.Config) (middleware.RateLimiter, error) {
+	rateLimiter, err := newRateLimiter(appLogger, cfg)
+	if err != nil {
+		return nil, err
+	}
+	lifecycle.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			rateLimiter.Stop()
+			return nil
+		},
+	})
+	return rateLimiter, nil
+}
+
+// newRateLimiter creates the Redis rate limiter when configured and reachable, and
+// the in-memory one otherwise
+func newRateLimiter(appLogger logger.Logger, cfg *config.Config) (stoppableRateLimiter, error) {
+	limiterConfig := bot.RateLimiterConfig{
+		MaxRequests:   cfg.RateLimitMaxRequests,
+		Window:        cfg.RateLimitWindow,
+		BlockDuration: cfg.RateLimitBlockDuration,
+		ActionLimits:  make(map[string]int, len(cfg.RateLimitActions)),
+	}
+	for action, limit := range cfg.RateLimitActions {
+		limiterConfig.ActionLimits[action] = int(limit)
+	}
+	if cfg.RedisURL == "" {
+		return bot.NewRateLimiter(limiterConfig), nil
+	}
+
+	options, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse REDIS_URL: %w", err)
+	}
+	rateLimiter := bot.NewRedisRateLimiter(redis.NewClient(options), limiterConfig, NewLogrusLogger(appLogger))
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisConnectTimeout)
+	defer cancel()
+	if err := rateLimiter.Ping(ctx); err != nil {
+		appLogger.WithError(err).Warn("Redis is unreachable, rate limits are kept in memory and not shared between instances")
+		rateLimiter.Stop()
+		return bot.NewRateLimiter(limiterConfig), nil
+	}
+	return rateLimiter, nil
+}
+
+// NewSessionStore creates the store of the users' conversational state. With REDIS_URL
+// set sessions are kept in Redis, so a flow can continue on any instance; if Redis is
+// unreachable at startup they are kept in memory instead
+func NewSessionStore(lifecycle fx.Lifecycle, appLogger logger.Logger, cfg *config.Config) (session.SessionStore, error) {
+	if cfg.RedisURL == "" {
+		return session.NewMemoryStore(cfg.SessionTTL), nil
+	}
+
+	options, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse REDIS_URL: %w", err)
+	}
+	store := session.NewRedisStore(redis.NewClient(options), cfg.SessionTTL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisConnectTimeout)
+	defer cancel()
+	if err := store.Ping(ctx); err != nil {
+		appLogger.WithError(err).Warn("Redis is unreachable, sessions are kept in memory and not shared between instances")
+		_ = store.Close()
+		return session.NewMemoryStore(cfg.SessionTTL), nil
+	}
+
+	lifecycle.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			return store.Close()
+		},
+	})
+	return store, nil
+}
+
+// NewAuditLogger creates a new audit logger instance that also stores events in the database
+func NewAuditLogger(appLogger logger.Logger, auditLogRepo domain.AuditLogRepository) *bot.AuditLogger {
+	logrusLogger := NewLogrusLogger(appLogger)
+	auditLogger := bot.NewAuditLogger(logrusLogger)
+	auditLogger.AddSink(auditLogRepo)
+	return auditLogger
 }
 
 // NewEventPublisher creates a new event publisher based on configuration
-func NewEventPublisher(cfg *config.Config, appLogger logger.Logger) (events.Publisher, error) {
+func NewEventPublisher(cfg *config.Config, appLogger logger.Logger, botMetrics *metrics.Metrics) (events.Publisher, error) {
 	logrusLogger := NewLogrusLogger(appLogger)
+	if !cfg.EventsEnabled {
+		return events.NewMockPublisher(logrusLogger), nil
+	}
+
+	switch cfg.EventBackend {
+	case "nats":
+		return events.NewNatsPublisher(events.NatsConfig{URL: cfg.NatsURL, Subject: cfg.NatsSubject}, logrusLogger)
+	case "mock":
+		return events.NewMockPublisher(logrusLogger), nil
+	}
 	if !cfg.KafkaEnabled {
 		return events.NewMockPublisher(logrusLogger), nil
 	}
-	
-	kafkaConfig := events.KafkaConfig{
+
+	publisher, err := events.NewKafkaPublisher(newKafkaConfig(cfg), logrusLogger)
+	if err != nil {
+		return nil, err
+	}
+	publisher.SetLatencyRecorder(botMetrics.RecordKafkaDelivery)
+	return publisher, nil
+}
+
+// newKafkaConfig returns the Kafka settings shared by the event publisher and consumer
+func newKafkaConfig(cfg *config.Config) events.KafkaConfig {
+	return events.KafkaConfig{
 		Brokers:           cfg.KafkaBrokers,
 		Topic:             cfg.KafkaTopic,
 		SecurityProtocol:  cfg.KafkaSecurityProtocol,
@@ -164,69 +662,400 @@ func NewEventPublisher(cfg *config.Config, appLogger logger.Logger) (events.Publ
 		Acks:              cfg.KafkaAcks,
 		RetryBackoffMs:    cfg.KafkaRetryBackoffMs,
 		RequestTimeoutMs:  cfg.KafkaRequestTimeoutMs,
+		DLQTopic:          cfg.KafkaDLQTopic,
+		DLQFile:           cfg.KafkaDLQFile,
+		SyncDelivery:      cfg.KafkaSyncDelivery,
 	}
-	
-	return events.NewKafkaPublisher(kafkaConfig, logrusLogger)
+}
+
+// NewEventConsumer creates the consumer applying events from external systems, or nil
+// unless both Kafka and KAFKA_CONSUMER_ENABLED are on. Events that keep failing are
+// dead-lettered like failed publishes, if KAFKA_DLQ_TOPIC or KAFKA_DLQ_FILE is set
+func NewEventConsumer(userService domain.UserService, publisher events.Publisher, appLogger logger.Logger, cfg *config.Config) (*events.KafkaConsumer, error) {
+	if !cfg.KafkaEnabled || !cfg.KafkaConsumerEnabled {
+		return nil, nil
+	}
+
+	consumer, err := events.NewKafkaConsumer(newKafkaConfig(cfg), cfg.KafkaConsumerGroup, NewLogrusLogger(appLogger))
+	if err != nil {
+		return nil, err
+	}
+	if writer, ok := publisher.(events.DeadLetterWriter); ok && (cfg.KafkaDLQTopic != "" || cfg.KafkaDLQFile != "") {
+		consumer.SetDeadLetterWriter(writer)
+	}
+	consumer.Handle(events.EventUserQuotaUpdated, service.NewQuotaUpdatedHandler(userService))
+	return consumer, nil
+}
+
+// StartEventConsumer consumes events while the application runs, if the consumer is enabled
+func StartEventConsumer(lifecycle fx.Lifecycle, consumer *events.KafkaConsumer) {
+	if consumer == nil {
+		return
+	}
+
+	lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			return consumer.Start()
+		},
+		OnStop: func(context.Context) error {
+			return consumer.Stop()
+		},
+	})
 }
 
 // NewEventService creates a new event service instance
-func NewEventService(publisher events.Publisher, appLogger logger.Logger) *events.Service {
+func NewEventService(publisher events.Publisher, appLogger logger.Logger, botMetrics *metrics.Metrics, cfg *config.Config) (*events.Service, error) {
+	if !cfg.EventsEnabled {
+		return events.NewDisabledEventService(), nil
+	}
+
 	logrusLogger := NewLogrusLogger(appLogger)
-	return events.NewEventService(publisher, logrusLogger)
+	keyCasing, err := events.ParseKeyCasing(cfg.EventKeyCasing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure event service: %w", err)
+	}
+
+	eventService := events.NewEventService(publisher, logrusLogger)
+	eventService.SetKeyCasing(keyCasing)
+	eventService.SetLatencyRecorder(botMetrics.RecordEventPublish)
+	eventService.SetBatching(cfg.EventBatchSize, cfg.EventBatchInterval)
+	return eventService, nil
 }
 
-// NewBotHandlerWithMiddleware creates a new middleware-aware bot handler
+// NewBotHandlerWithMiddleware runs the bot handler behind the production middleware
+// chain, so both serve the same commands
 func NewBotHandlerWithMiddleware(
-	botAPI *tgbotapi.BotAPI, 
-	userService domain.UserService, 
-	appLogger logger.Logger,
-	rateLimiter *bot.RateLimiter,
+	handler *bot.Handler,
+	rateLimiter middleware.RateLimiter,
+	sessionStore session.SessionStore,
 	auditLogger *bot.AuditLogger,
+	abuseGuard *bot.AbuseGuard,
+	botMetrics *metrics.Metrics,
+	cfg *config.Config,
 ) *bot.HandlerWithMiddleware {
+	middlewareHandler := bot.WrapHandler(handler, rateLimiter, auditLogger)
+	middlewareHandler.SetAdminIDs(cfg.AdminTelegramIDs)
+	middlewareHandler.SetAbuseGuard(abuseGuard)
+	middlewareHandler.SetMetricsRecorder(botMetrics)
+	middlewareHandler.SetSessionStore(sessionStore)
+	return middlewareHandler
+}
+
+// NewMetrics creates the Prometheus metrics
+func NewMetrics() *metrics.Metrics {
+	return metrics.New()
+}
+
+// activeUsersRefreshInterval is how often the user count gauges are updated
+const activeUsersRefreshInterval = time.Minute
+
+// NewHealthChecker creates the readiness checks for the database and, when enabled, the
+// event backend
+func NewHealthChecker(db *gorm.DB, publisher events.Publisher, cfg *config.Config) *health.Checker {
+	checker := health.NewChecker(health.DefaultCheckTimeout)
+	checker.AddCheck("database", func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return fmt.Errorf("failed to get database connection: %w", err)
+		}
+		return sqlDB.PingContext(ctx)
+	})
+	switch publisher := publisher.(type) {
+	case *events.KafkaPublisher:
+		checker.AddCheck("kafka", publisher.Ping)
+	case *events.NatsPublisher:
+		checker.AddCheck("nats", publisher.Ping)
+	}
+	return checker
+}
+
+// NewSelfTest creates the startup self-test, or nil when STARTUP_SELFTEST is off. The
+// bot cannot work without the database or Telegram; events are only reported
+func NewSelfTest(db *gorm.DB, publisher events.Publisher, botAPI bot.BotAPI, appLogger logger.Logger, cfg *config.Config) *selftest.Runner {
+	if !cfg.StartupSelfTest {
+		return nil
+	}
+	runner := selftest.NewRunner(NewLogrusLogger(appLogger), selftest.DefaultCheckTimeout)
+	runner.AddCheck("database", true, selftest.DatabaseCheck(db))
+	runner.AddCheck("events", false, selftest.EventsCheck(publisher, cfg.SelfTestTopic))
+	runner.AddCheck("telegram", true, selftest.TelegramCheck(botAPI))
+	return runner
+}
+
+// NewWebhookReceiver creates the receiver for updates delivered by webhook. It only
+// accepts requests carrying WEBHOOK_SECRET as their secret token
+func NewWebhookReceiver(cfg *config.Config) *bot.WebhookReceiver {
+	return bot.NewWebhookReceiver(cfg.WebhookSecret)
+}
+
+// webhookPath returns the path of the webhook endpoint served by the HTTP server. A
+// validated webhook configuration always has a secret, so the path ends with it
+func webhookPath(cfg *config.Config) string {
+	endpoint, err := url.Parse(cfg.GetWebhookEndpoint())
+	if err != nil {
+		return "/" + cfg.WebhookSecret
+	}
+	return endpoint.Path
+}
+
+// StartHTTPServer serves Prometheus metrics on /metrics and the /healthz and /readyz
+// probes, and keeps the active users gauge up to date while the application runs.
+// In webhook mode it also receives updates from Telegram
+func StartHTTPServer(lifecycle fx.Lifecycle, botMetrics *metrics.Metrics, healthChecker *health.Checker, userService domain.UserService, webhookReceiver *bot.WebhookReceiver, appLogger logger.Logger, cfg *config.Config) {
 	logrusLogger := NewLogrusLogger(appLogger)
-	return bot.NewHandlerWithMiddleware(botAPI, userService, logrusLogger, rateLimiter, auditLogger)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", botMetrics.Handler())
+	mux.Handle("/healthz", healthChecker.LivenessHandler())
+	mux.Handle("/readyz", healthChecker.ReadinessHandler())
+	if cfg.IsWebhookMode() {
+		mux.Handle(webhookPath(cfg), webhookReceiver)
+	}
+	server := &http.Server{
+		Addr:              cfg.GetServerAddr(),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	refreshCtx, cancelRefresh := context.WithCancel(context.Background())
+	lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			listener, err := net.Listen("tcp", server.Addr)
+			if err != nil {
+				return fmt.Errorf("failed to listen for HTTP server: %w", err)
+			}
+			go func() {
+				if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					logrusLogger.WithError(err).Error("HTTP server failed")
+				}
+			}()
+			go refreshActiveUsers(refreshCtx, botMetrics, userService, logrusLogger)
+
+			logrusLogger.WithField("addr", server.Addr).Info("HTTP server started")
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			cancelRefresh()
+			if err := server.Shutdown(ctx); err != nil {
+				return fmt.Errorf("failed to stop HTTP server: %w", err)
+			}
+			logrusLogger.Info("HTTP server stopped")
+			return nil
+		},
+	})
+}
+
+// refreshActiveUsers periodically sets the active users and per-status user gauges
+// from the user counts
+func refreshActiveUsers(ctx context.Context, botMetrics *metrics.Metrics, userService domain.UserService, logger *logrus.Logger) {
+	ticker := time.NewTicker(activeUsersRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		counts, err := userService.CountByStatus(ctx)
+		if err != nil {
+			logger.WithError(err).Warn("Failed to refresh active users metric")
+		} else {
+			// Known statuses are exported even when no user has them
+			for _, status := range []string{domain.UserStatusInactive, domain.UserStatusTrial, domain.UserStatusActive, domain.UserStatusBanned} {
+				botMetrics.UsersByStatus.WithLabelValue(status).Set(float64(counts[status]))
+			}
+			for status, count := range counts {
+				botMetrics.UsersByStatus.WithLabelValue(status).Set(float64(count))
+			}
+			botMetrics.ActiveUsers.Set(float64(counts[domain.UserStatusActive] + counts[domain.UserStatusTrial]))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
 
-// NewTelegramBot creates a new Telegram bot instance
-func NewTelegramBot(cfg *config.Config, appLogger logger.Logger) (*tgbotapi.BotAPI, error) {
+// NewTelegramBot creates a new Telegram bot client whose sends are retried on transient
+// errors. It is provided as bot.BotAPI so the bot can run against a fake client in tests
+func NewTelegramBot(cfg *config.Config, appLogger logger.Logger) (bot.BotAPI, error) {
 	logrusLogger := NewLogrusLogger(appLogger)
-	bot, err := tgbotapi.NewBotAPI(cfg.TelegramToken)
+	botAPI, err := tgbotapi.NewBotAPI(cfg.TelegramToken)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create telegram bot: %w", err)
 	}
 	
 	// Enable debug mode if in development
-	bot.Debug = cfg.IsDevelopment() && cfg.Debug
+	botAPI.Debug = cfg.IsDevelopment() && cfg.Debug
 	
 	logrusLogger.WithFields(logrus.Fields{
-		"debug_mode": bot.Debug,
+		"debug_mode": botAPI.Debug,
 		"environment": cfg.Environment,
 	}).Info("Telegram bot initialized")
 	
-	return bot, nil
+	return bot.NewRetryingBotAPI(botAPI, cfg.TelegramSendMaxAttempts, cfg.TelegramSendRetryDelay), nil
+}
+
+// Reasons reported in the system shutdown event
+const (
+	shutdownReasonSignal    = "signal"
+	shutdownReasonCancelled = "context cancelled"
+	shutdownReasonStopped   = "application stopped"
+)
+
+// shutdownReasonKey is the context key main stores the reason for stopping under
+type shutdownReasonKey struct{}
+
+// withShutdownReason returns a context telling the OnStop hooks why the application stops
+func withShutdownReason(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, shutdownReasonKey{}, reason)
+}
+
+// shutdownReasonFrom returns the reason stored by withShutdownReason, defaulting to
+// the application being stopped
+func shutdownReasonFrom(ctx context.Context) string {
+	if reason, ok := ctx.Value(shutdownReasonKey{}).(string); ok {
+		return reason
+	}
+	return shutdownReasonStopped
+}
+
+// updateStopper stops the Telegram long-polling loop
+type updateStopper interface {
+	StopReceivingUpdates()
+}
+
+// botShutdown makes stopping the bot idempotent. The update loop (on context
+// cancellation) and the fx OnStop hook may both trigger it, and neither
+// tgbotapi nor the Kafka producer tolerate being stopped twice
+type botShutdown struct {
+	botAPI       updateStopper
+	eventService *events.Service
+	db           *gorm.DB
+	logger       *logrus.Logger
+
+	mu        sync.Mutex
+	reason    string
+	stopOnce  sync.Once
+	closeOnce sync.Once
+}
+
+// newBotShutdown creates the shutdown coordinator for the bot
+func newBotShutdown(botAPI updateStopper, eventService *events.Service, db *gorm.DB, logger *logrus.Logger) *botShutdown {
+	return &botShutdown{
+		botAPI:       botAPI,
+		eventService: eventService,
+		db:           db,
+		logger:       logger,
+	}
+}
+
+// StopUpdates stops receiving updates and records why. Only the first call has an effect
+func (s *botShutdown) StopUpdates(reason string) {
+	s.stopOnce.Do(func() {
+		s.mu.Lock()
+		s.reason = reason
+		s.mu.Unlock()
+
+		s.logger.WithField("reason", reason).Info("Stopping bot updates")
+		s.botAPI.StopReceivingUpdates()
+	})
+}
+
+// Reason returns why the bot is shutting down
+func (s *botShutdown) Reason() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reason
+}
+
+// Close stops receiving updates, publishes the shutdown event, flushes the event
+// publisher and closes the database. Only the first call has an effect
+func (s *botShutdown) Close(ctx context.Context) {
+	s.StopUpdates(shutdownReasonFrom(ctx))
+
+	s.closeOnce.Do(func() {
+		if s.eventService != nil {
+			if err := s.eventService.PublishSystemShutdown(ctx, s.Reason(), nil); err != nil {
+				s.logger.WithError(err).Error("Failed to publish shutdown event")
+			}
+			if err := s.eventService.Close(); err != nil {
+				s.logger.WithError(err).Error("Failed to flush event publisher")
+			}
+		}
+
+		sqlDB, err := s.db.DB()
+		if err != nil {
+			s.logger.WithError(err).Error("Failed to get database connection for shutdown")
+			return
+		}
+		if err := sqlDB.Close(); err != nil {
+			s.logger.WithError(err).Error("Failed to close database connection")
+		}
+	})
 }
 
 // StartBot starts the bot application
 func StartBot(
 	lifecycle fx.Lifecycle, 
-	botAPI *tgbotapi.BotAPI, 
+	botAPI bot.BotAPI, 
 	handler *bot.Handler,
 	middlewareHandler *bot.HandlerWithMiddleware, 
+	unsupportedHandler *bot.UnsupportedUpdateHandler,
+	editedTracker *bot.EditedMessageTracker,
+	firstSeen *bot.FirstSeenRecorder,
+	lastActive *bot.LastActiveRecorder,
+	webhookReceiver *bot.WebhookReceiver,
+	processLock *bot.ProcessLock,
 	db *gorm.DB, 
+	dynamicConfig *config.DynamicConfig,
+	eventService *events.Service,
+	selfTest *selftest.Runner,
 	appLogger logger.Logger,
 	cfg *config.Config,
 ) {
 	logrusLogger := NewLogrusLogger(appLogger)
+	shutdown := newBotShutdown(botAPI, eventService, db, logrusLogger)
+	stopLoop := make(chan struct{})
+	loopDone := make(chan struct{})
 	lifecycle.Append(fx.Hook{
-		OnStart: func(ctx context.Context) error {
+		OnStart: func(ctx context.Context) (err error) {
 			logrusLogger.Info("Starting Arcanus VPN Telegram Bot")
 
+			// Refuse to start while another instance is running
+			if err := processLock.Acquire(); err != nil {
+				return fmt.Errorf("failed to acquire process lock: %w", err)
+			}
+			defer func() {
+				// OnStop is not called when OnStart fails
+				if err != nil {
+					if releaseErr := processLock.Release(); releaseErr != nil {
+						logrusLogger.WithError(releaseErr).Error("Failed to release process lock")
+					}
+				}
+			}()
+
 			// Run database migrations
-			// Temporarily disabled due to GORM issue
-			// if err := db.WithContext(ctx).AutoMigrate(&domain.User{}); err != nil {
-			// 	return fmt.Errorf("failed to run database migrations: %w", err)
-			// }
-			logrusLogger.Info("Database migrations skipped (temporarily disabled)")
+			if cfg.MigrateOnStart {
+				if err := runMigrations(ctx, db, logrusLogger, migrationAttempts, migrationBackoff); err != nil {
+					return err
+				}
+			} else {
+				logrusLogger.Info("Database migrations skipped (MIGRATE_ON_START=false)")
+			}
+
+			// Check the dependencies before serving any update
+			if selfTest != nil {
+				if _, err := selfTest.Run(ctx); err != nil {
+					return err
+				}
+			}
+
+			// Load runtime settings; the bot keeps running on environment configuration if they are unavailable
+			onSettingsError := func(err error) {
+				logrusLogger.WithError(err).Warn("Failed to refresh runtime settings")
+			}
+			if err := dynamicConfig.Start(ctx, onSettingsError); err != nil {
+				onSettingsError(err)
+			}
 
 			// Get bot info
 			botInfo, err := botAPI.GetMe()
@@ -240,42 +1069,65 @@ func StartBot(
 				"can_join_groups": botInfo.CanJoinGroups,
 			}).Info("Bot info retrieved")
 
-			// Setup update configuration
-			updateConfig := tgbotapi.NewUpdate(0)
-			updateConfig.Timeout = 60
+			startupMetadata := map[string]string{
+				"bot_username": botInfo.UserName,
+				"environment":  cfg.Environment,
+			}
+			if err := eventService.PublishSystemStartup(ctx, cfg.Version, startupMetadata); err != nil {
+				logrusLogger.WithError(err).Warn("Failed to publish system startup event")
+			}
 
 			// Get updates channel
-			updates := botAPI.GetUpdatesChan(updateConfig)
+			var updates tgbotapi.UpdatesChannel
+			if cfg.IsWebhookMode() {
+				if err := bot.RegisterWebhook(botAPI, cfg.GetWebhookEndpoint(), cfg.WebhookSecret); err != nil {
+					return err
+				}
+				logrusLogger.WithField("path", webhookPath(cfg)).Info("Webhook registered")
+				updates = webhookReceiver.Updates()
+			} else {
+				// Telegram refuses getUpdates while a webhook is set, e.g. after running in webhook mode
+				if err := bot.DeleteWebhook(botAPI); err != nil {
+					return err
+				}
 
-			// Setup signal handling for graceful shutdown
-			sigChan := make(chan os.Signal, 1)
-			signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+				updateConfig := tgbotapi.NewUpdate(0)
+				updateConfig.Timeout = 60
+				updates = botAPI.GetUpdatesChan(updateConfig)
+			}
 
 			logrusLogger.Info("Bot is ready to handle messages")
 			logrusLogger.Info("Press Ctrl+C to stop the bot")
 
-			// Start message processing loop
+			// Start message processing loop. Signals are handled by fx, which stops the
+			// application and so the loop through OnStop
 			go func() {
+				defer close(loopDone)
 				for {
 					select {
-					case update := <-updates:
+					case update, ok := <-updates:
+						// The channel is closed once updates stop being received
+						if !ok {
+							return
+						}
+						firstSeen.Observe(ctx, update)
+						lastActive.Observe(ctx, update)
+
 						// Use middleware handler in production, fallback to basic handler
 						var err error
 						if cfg.IsProduction() {
-							err = processUpdateWithMiddleware(ctx, middlewareHandler, update)
+							err = processUpdateWithMiddleware(ctx, middlewareHandler, unsupportedHandler, editedTracker, update)
 						} else {
-							err = processUpdate(ctx, handler, update)
+							err = processUpdate(ctx, handler, unsupportedHandler, editedTracker, update)
 						}
 						if err != nil {
 							logrusLogger.WithError(err).Error("Failed to process update")
 						}
-					case <-sigChan:
-						logrusLogger.Info("Received shutdown signal, stopping bot...")
-						botAPI.StopReceivingUpdates()
+					case <-stopLoop:
 						return
 					case <-ctx.Done():
 						logrusLogger.Info("Context cancelled, stopping bot...")
-						botAPI.StopReceivingUpdates()
+						shutdown.StopUpdates(shutdownReasonCancelled)
 						return
 					}
 				}
@@ -283,7 +1135,30 @@ func StartBot(
 
 			return nil
 		},
-		OnStop: func(context.Context) error {
+		OnStop: func(ctx context.Context) error {
+			dynamicConfig.Stop()
+			shutdown.StopUpdates(shutdownReasonFrom(ctx))
+
+			// Let the update being handled finish before the database is closed
+			close(stopLoop)
+			select {
+			case <-loopDone:
+			case <-ctx.Done():
+				logrusLogger.Warn("Timed out waiting for the update loop to stop")
+			}
+
+			if cfg.IsWebhookMode() {
+				if err := bot.DeleteWebhook(botAPI); err != nil {
+					logrusLogger.WithError(err).Error("Failed to delete webhook")
+				} else {
+					logrusLogger.Info("Webhook deleted")
+				}
+				webhookReceiver.Close()
+			}
+			shutdown.Close(ctx)
+			if err := processLock.Release(); err != nil {
+				logrusLogger.WithError(err).Error("Failed to release process lock")
+			}
 			logrusLogger.Info("Bot stopped successfully")
 			return nil
 		},
@@ -291,59 +1166,138 @@ func StartBot(
 }
 
 // processUpdate processes a single Telegram update
-func processUpdate(ctx context.Context, handler *bot.Handler, update tgbotapi.Update) error {
+func processUpdate(ctx context.Context, handler *bot.Handler, unsupportedHandler *bot.UnsupportedUpdateHandler, editedTracker *bot.EditedMessageTracker, update tgbotapi.Update) error {
+	ctx = events.WithUpdateID(ctx, update.UpdateID)
+
 	// Handle callback queries
 	if update.CallbackQuery != nil {
-		return handler.HandleCallback(ctx, update.CallbackQuery)
+		return handler.HandleCallback(handler.WithSender(ctx, update.CallbackQuery.From), update.CallbackQuery)
+	}
+
+	// Answer checkouts of plan invoices
+	if update.PreCheckoutQuery != nil {
+		return handler.HandlePreCheckoutQuery(ctx, update.PreCheckoutQuery)
 	}
 
 	// Handle messages
 	if update.Message != nil {
-		return handler.HandleUpdate(ctx, update)
+		editedTracker.Remember(update.Message)
+		return handler.HandleUpdate(handler.WithSender(ctx, update.Message.From), update)
 	}
 
-	return nil
+	// Handle edited commands like new messages
+	if edited, ok := editedTracker.Resolve(update); ok {
+		return handler.HandleUpdate(handler.WithSender(ctx, edited.Message.From), edited)
+	}
+
+	return unsupportedHandler.Handle(update)
 }
 
 // processUpdateWithMiddleware processes a single Telegram update using middleware
-func processUpdateWithMiddleware(ctx context.Context, handler *bot.HandlerWithMiddleware, update tgbotapi.Update) error {
+func processUpdateWithMiddleware(ctx context.Context, handler *bot.HandlerWithMiddleware, unsupportedHandler *bot.UnsupportedUpdateHandler, editedTracker *bot.EditedMessageTracker, update tgbotapi.Update) error {
+	ctx = events.WithUpdateID(ctx, update.UpdateID)
+
 	// Handle callback queries
 	if update.CallbackQuery != nil {
 		return handler.HandleCallback(ctx, update.CallbackQuery)
 	}
 
-	// Handle messages  
+	// Answer checkouts of plan invoices
+	if update.PreCheckoutQuery != nil {
+		return handler.HandlePreCheckoutQuery(ctx, update.PreCheckoutQuery)
+	}
+
+	// Handle messages
 	if update.Message != nil {
+		editedTracker.Remember(update.Message)
 		return handler.HandleUpdate(ctx, update)
 	}
 
-	return nil
+	// Handle edited commands like new messages
+	if edited, ok := editedTracker.Resolve(update); ok {
+		return handler.HandleUpdate(ctx, edited)
+	}
+
+	return unsupportedHandler.Handle(update)
 }
 
 
-func main() {
-	app := fx.New(
+// buildApp assembles the application graph for cfg. Options are applied last, so
+// tests can swap dependencies with fx.Replace or fx.Decorate
+func buildApp(cfg *config.Config, opts ...fx.Option) *fx.App {
+	options := []fx.Option{
+		fx.Supply(cfg),
 		fx.Provide(
-			NewConfig,
 			NewLogger,
 			NewDatabase,
 			NewUserRepository,
 			NewTransactionManager,
+			NewActivityRepository,
+			NewSettingsRepository,
+			NewBugReportRepository,
+			NewAuditLogRepository,
+			NewUserSightingRepository,
+			NewFirstSeenRecorder,
+			NewLastActiveRecorder,
+			NewDynamicConfig,
 			NewEventPublisher,
 			NewEventService,
+			NewEventConsumer,
 			NewUserService,
+			NewFloodController,
+			NewHelpRenderer,
 			NewRateLimiter,
+			NewSessionStore,
+			NewAbuseGuard,
+			NewUnsupportedUpdateHandler,
+			NewMetrics,
+			NewHealthChecker,
+			NewSelfTest,
+			NewPlanCatalog,
+			NewPaymentService,
+			NewPlanExpirySweeper,
+			NewNotificationDispatcher,
+			NewRetentionEnforcer,
+			NewVPNService,
+			NewGateway,
+			NewEditedMessageTracker,
+			NewProcessLock,
+			NewWebhookReceiver,
 			NewAuditLogger,
 			NewBotHandler,
 			NewBotHandlerWithMiddleware,
 			NewTelegramBot,
 		),
 		fx.Invoke(StartBot),
-	)
+		fx.Invoke(StartHTTPServer),
+		fx.Invoke(StartPlanExpirySweeper),
+		fx.Invoke(StartNotificationDispatcher),
+		fx.Invoke(StartFloodController),
+		fx.Invoke(StartRetentionEnforcer),
+		fx.Invoke(StartEventConsumer),
+		fx.Invoke(StartConfigReloader),
+	}
+	return fx.New(append(options, opts...)...)
+}
+
+func main() {
+	cfg, err := NewConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	app := buildApp(cfg)
 
 	if err := app.Start(context.Background()); err != nil {
 		log.Fatalf("Failed to start application: %v", err)
 	}
 
-	<-app.Done()
+	sig := <-app.Done()
+	log.Printf("Received %v, stopping the application", sig)
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), app.StopTimeout())
+	defer cancel()
+	if err := app.Stop(withShutdownReason(stopCtx, shutdownReasonSignal)); err != nil {
+		log.Printf("Failed to stop application cleanly: %v", err)
+	}
 }
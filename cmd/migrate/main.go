@@ -1,30 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
-	"time"
 
 	"github.com/joho/godotenv"
-	"gorm.io/driver/postgres"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/repository"
 	"gorm.io/gorm"
 )
 
-// TestUser is the User model without DeletedAt field for testing
-type TestUser struct {
-	ID         int64     `json:"id" gorm:"primaryKey;autoIncrement"`
-	TelegramID int64     `json:"telegram_id" gorm:"uniqueIndex;not null"`
-	Username   string    `json:"username" gorm:"size:255"`
-	FirstName  string    `json:"first_name" gorm:"size:255"`
-	LastName   string    `json:"last_name" gorm:"size:255"`
-	Status     string    `json:"status" gorm:"size:50;default:inactive"`
-	QuotaLimit int64     `json:"quota_limit" gorm:"default:52428800"` // 50MB
-	QuotaUsed  int64     `json:"quota_used" gorm:"default:0"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
-}
-
 func main() {
 	// Load environment variables
 	_ = godotenv.Load()
@@ -34,17 +21,21 @@ func main() {
 		log.Fatal("DATABASE_URL is required")
 	}
 
-	// Connect to database
-	db, err := gorm.Open(postgres.Open(databaseURL), &gorm.Config{})
+	// Connect to the database selected by DATABASE_DRIVER, postgres by default
+	dialector, err := repository.NewDialector(os.Getenv("DATABASE_DRIVER"), databaseURL)
+	if err != nil {
+		log.Fatalf("Failed to configure database: %v", err)
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{})
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
 	fmt.Println("Connected to database successfully")
 
-	// Test AutoMigrate with TestUser model
-	fmt.Println("Running AutoMigrate with TestUser model...")
-	if err := db.AutoMigrate(&TestUser{}); err != nil {
+	// Run AutoMigrate with the application models
+	fmt.Println("Running AutoMigrate with application models...")
+	if err := repository.AutoMigrate(context.Background(), db); err != nil {
 		log.Fatalf("Failed to run AutoMigrate: %v", err)
 	}
 
@@ -59,7 +50,7 @@ func main() {
 
 	// Test a simple query
 	var count int64
-	if err := db.Model(&TestUser{}).Count(&count).Error; err != nil {
+	if err := db.Model(&domain.User{}).Count(&count).Error; err != nil {
 		log.Fatalf("Failed to count users: %v", err)
 	}
 
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/config"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/events"
+)
+
+// replayGroupID is the consumer group replaying dead letters, so events already
+// replayed are skipped by the next run
+const replayGroupID = "arcanus-vpn-bot-dlq-replay"
+
+func main() {
+	cfg, err := config.NewEnvLoader().Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if cfg.KafkaDLQTopic == "" && cfg.KafkaDLQFile == "" {
+		log.Fatal("KAFKA_DLQ_TOPIC or KAFKA_DLQ_FILE is required")
+	}
+
+	logger := logrus.New()
+	kafkaConfig := events.KafkaConfig{
+		Brokers:           cfg.KafkaBrokers,
+		Topic:             cfg.KafkaTopic,
+		SecurityProtocol:  cfg.KafkaSecurityProtocol,
+		SaslMechanism:     cfg.KafkaSaslMechanism,
+		SaslUsername:      cfg.KafkaSaslUsername,
+		SaslPassword:      cfg.KafkaSaslPassword,
+		EnableIdempotence: cfg.KafkaEnableIdempotence,
+		Acks:              cfg.KafkaAcks,
+		RetryBackoffMs:    cfg.KafkaRetryBackoffMs,
+		RequestTimeoutMs:  cfg.KafkaRequestTimeoutMs,
+		DLQTopic:          cfg.KafkaDLQTopic,
+		// Replaying must know whether an event made it before moving past it
+		SyncDelivery: true,
+	}
+
+	publisher, err := events.NewKafkaPublisher(kafkaConfig, logger)
+	if err != nil {
+		log.Fatalf("Failed to create Kafka publisher: %v", err)
+	}
+	defer publisher.Close()
+
+	// Dead letters only end up in the file when the topic could not be written, so
+	// they are the older ones
+	if cfg.KafkaDLQFile != "" {
+		replayed, err := events.ReplayDLQFile(context.Background(), cfg.KafkaDLQFile, publisher, logger)
+		if err != nil {
+			log.Printf("Replay stopped after %d events: %v", replayed, err)
+			return
+		}
+		fmt.Printf("Replayed %d events from %s to %s\n", replayed, cfg.KafkaDLQFile, cfg.KafkaTopic)
+	}
+	if cfg.KafkaDLQTopic == "" {
+		return
+	}
+
+	replayed, err := events.ReplayDLQ(context.Background(), kafkaConfig, replayGroupID, publisher, logger)
+	if err != nil {
+		log.Printf("Replay stopped after %d events: %v", replayed, err)
+		return
+	}
+
+	fmt.Printf("Replayed %d events from %s to %s\n", replayed, cfg.KafkaDLQTopic, cfg.KafkaTopic)
+}
@@ -0,0 +1,130 @@
+package bot
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAbuseBanThreshold is the number of rate-limit blocks within the window that triggers a ban
+	DefaultAbuseBanThreshold = 30
+	// DefaultAbuseBanWindow is the window in which rate-limit blocks are counted
+	DefaultAbuseBanWindow = time.Hour
+	// abusePruneThreshold is the number of tracked users above which stale entries are pruned
+	abusePruneThreshold = 10000
+)
+
+// AbuseGuard counts rate-limit violations per user and decides when a
+// persistent abuser should be banned. Exempt users (admins) are never banned.
+type AbuseGuard struct {
+	mu         sync.Mutex
+	threshold  int
+	window     time.Duration
+	exempt     map[int64]bool
+	violations map[int64][]time.Time
+	banned     map[int64]bool
+	now        func() time.Time
+}
+
+// NewAbuseGuard creates an abuse guard. A non-positive threshold disables auto-bans
+func NewAbuseGuard(threshold int, window time.Duration, exemptIDs []int64) *AbuseGuard {
+	exempt := make(map[int64]bool, len(exemptIDs))
+	for _, id := range exemptIDs {
+		exempt[id] = true
+	}
+	return &AbuseGuard{
+		threshold:  threshold,
+		window:     window,
+		exempt:     exempt,
+		violations: make(map[int64][]time.Time),
+		banned:     make(map[int64]bool),
+		now:        time.Now,
+	}
+}
+
+// RecordViolation records a rate-limit block for the user and reports whether
+// the user has just crossed the ban threshold. It reports true at most once per user
+func (g *AbuseGuard) RecordViolation(userID int64) bool {
+	if g.threshold <= 0 || g.exempt[userID] {
+		return false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.banned[userID] {
+		return false
+	}
+
+	now := g.now()
+	if len(g.violations) > abusePruneThreshold {
+		g.prune(now)
+	}
+
+	hits := append(g.recentViolations(userID, now), now)
+	if len(hits) < g.threshold {
+		g.violations[userID] = hits
+		return false
+	}
+
+	delete(g.violations, userID)
+	g.banned[userID] = true
+	return true
+}
+
+// IsBanned reports whether the guard has banned the user during this process lifetime
+func (g *AbuseGuard) IsBanned(userID int64) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.banned[userID]
+}
+
+// Unban forgets the user's ban and violations, so the user is only banned again after
+// crossing the threshold anew
+func (g *AbuseGuard) Unban(userID int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.banned, userID)
+	delete(g.violations, userID)
+}
+
+// Violations returns the number of recent violations recorded for the user
+func (g *AbuseGuard) Violations(userID int64) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.recentViolations(userID, g.now()))
+}
+
+// Threshold returns the number of violations that triggers a ban
+func (g *AbuseGuard) Threshold() int {
+	return g.threshold
+}
+
+// Window returns the window in which violations are counted
+func (g *AbuseGuard) Window() time.Duration {
+	return g.window
+}
+
+// recentViolations returns the user's violations that fall inside the window
+func (g *AbuseGuard) recentViolations(userID int64, now time.Time) []time.Time {
+	cutoff := now.Add(-g.window)
+	hits := g.violations[userID]
+	kept := hits[:0]
+	for _, hit := range hits {
+		if hit.After(cutoff) {
+			kept = append(kept, hit)
+		}
+	}
+	return kept
+}
+
+// prune drops users whose violations have all fallen outside the window
+func (g *AbuseGuard) prune(now time.Time) {
+	for userID := range g.violations {
+		if hits := g.recentViolations(userID, now); len(hits) > 0 {
+			g.violations[userID] = hits
+		} else {
+			delete(g.violations, userID)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAbuseGuard(threshold int, exemptIDs ...int64) (*AbuseGuard, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	guard := NewAbuseGuard(threshold, time.Hour, exemptIDs)
+	guard.now = clock.Now
+	return guard, clock
+}
+
+func TestAbuseGuard_RepeatedViolationsTriggerBan(t *testing.T) {
+	guard, _ := newTestAbuseGuard(3)
+
+	assert.False(t, guard.RecordViolation(42))
+	assert.False(t, guard.RecordViolation(42))
+	assert.True(t, guard.RecordViolation(42))
+	assert.True(t, guard.IsBanned(42))
+
+	// The ban is only reported once
+	assert.False(t, guard.RecordViolation(42))
+}
+
+func TestAbuseGuard_UnderThresholdDoesNotBan(t *testing.T) {
+	guard, clock := newTestAbuseGuard(3)
+
+	assert.False(t, guard.RecordViolation(42))
+	assert.False(t, guard.RecordViolation(42))
+
+	// Violations outside the window are forgotten
+	clock.now = clock.now.Add(time.Hour + time.Second)
+	assert.False(t, guard.RecordViolation(42))
+	assert.False(t, guard.RecordViolation(42))
+
+	assert.False(t, guard.IsBanned(42))
+	assert.Equal(t, 2, guard.Violations(42))
+
+	// Other users are tracked separately
+	assert.False(t, guard.RecordViolation(7))
+	assert.Equal(t, 1, guard.Violations(7))
+}
+
+func TestAbuseGuard_ExemptAndDisabled(t *testing.T) {
+	guard, _ := newTestAbuseGuard(1, 1)
+	assert.False(t, guard.RecordViolation(1), "admins are never banned")
+	assert.True(t, guard.RecordViolation(2))
+
+	disabled, _ := newTestAbuseGuard(0)
+	for i := 0; i < 10; i++ {
+		assert.False(t, disabled.RecordViolation(2))
+	}
+	assert.False(t, disabled.IsBanned(2))
+}
+
+// setupAbuseTestHandler creates a middleware handler with a fresh rate limiter and abuse guard
+func setupAbuseTestHandler(t *testing.T, threshold int) (*MockBotAPI, *MockUserService, *HandlerWithMiddleware) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	mockBotAPI := new(MockBotAPI)
+	mockService := new(MockUserService)
+
+	rateLimiter := NewRateLimiter(DefaultRateLimiterConfig())
+	t.Cleanup(rateLimiter.Stop)
+
+	handler := NewHandlerWithMiddleware(mockBotAPI, mockService, logger, rateLimiter, NewAuditLogger(logger))
+	handler.SetAdminIDs([]int64{1})
+	handler.SetAbuseGuard(NewAbuseGuard(threshold, time.Hour, []int64{1}))
+	// Users who never registered have no stored ban
+	mockService.On("GetUser", mock.Anything, mock.Anything).Return(nil, domain.ErrUserNotFound).Maybe()
+	return mockBotAPI, mockService, handler
+}
+
+// sendHelp sends /help from the given user through the middleware handler
+func sendHelp(handler *HandlerWithMiddleware, userID int64) error {
+	return handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+		Text: "/help",
+		From: &tgbotapi.User{ID: userID, FirstName: "Test"},
+		Chat: &tgbotapi.Chat{ID: userID},
+	}})
+}
+
+func TestHandlerWithMiddleware_RepeatedRateLimitBlocksBanUser(t *testing.T) {
+	mockBotAPI, mockService, handler := setupAbuseTestHandler(t, 3)
+
+	var adminNotices []string
+	mockBotAPI.On("Send", mock.MatchedBy(func(msg tgbotapi.MessageConfig) bool { return msg.ChatID == 1 })).
+		Run(func(args mock.Arguments) {
+			adminNotices = append(adminNotices, args.Get(0).(tgbotapi.MessageConfig).Text)
+		}).
+		Return(tgbotapi.Message{}, nil)
+	mockBotAPI.On("Send", mock.MatchedBy(func(msg tgbotapi.MessageConfig) bool { return msg.ChatID == 42 })).
+		Return(tgbotapi.Message{}, nil)
+	mockService.On("BanUser", mock.Anything, int64(42)).Return(nil).Once()
+
+	// The rate limiter allows 20 requests per minute
+	for i := 0; i < 20; i++ {
+		require.NoError(t, sendHelp(handler, 42))
+	}
+
+	// Three blocked requests cross the threshold
+	for i := 0; i < 3; i++ {
+		assert.Error(t, sendHelp(handler, 42))
+	}
+
+	mockService.AssertExpectations(t)
+	require.Len(t, adminNotices, 1)
+	assert.Contains(t, adminNotices[0], "User 42 was auto-banned after 3 rate limit violations")
+
+	// Updates from the banned user are dropped without replies
+	mockBotAPI.AssertNumberOfCalls(t, "Send", 21)
+	assert.NoError(t, sendHelp(handler, 42))
+	mockBotAPI.AssertNumberOfCalls(t, "Send", 21)
+}
+
+func TestHandlerWithMiddleware_RateLimitBlocksUnderThresholdDoNotBan(t *testing.T) {
+	mockBotAPI, mockService, handler := setupAbuseTestHandler(t, 3)
+
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Return(tgbotapi.Message{}, nil)
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, sendHelp(handler, 42))
+	}
+	for i := 0; i < 2; i++ {
+		assert.Error(t, sendHelp(handler, 42))
+	}
+
+	mockService.AssertNotCalled(t, "BanUser", mock.Anything, mock.Anything)
+	mockBotAPI.AssertNumberOfCalls(t, "Send", 20)
+}
+
+func TestHandlerWithMiddleware_StoredBanDropsUpdates(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	mockBotAPI := new(MockBotAPI)
+	mockService := new(MockUserService)
+	rateLimiter := NewRateLimiter(DefaultRateLimiterConfig())
+	t.Cleanup(rateLimiter.Stop)
+	handler := NewHandlerWithMiddleware(mockBotAPI, mockService, logger, rateLimiter, NewAuditLogger(logger))
+
+	user := domain.NewUser(42, "banned", "Test", "User")
+	user.Ban()
+	mockService.On("GetUser", mock.Anything, int64(42)).Return(user, nil)
+
+	// The ban was stored before this process started, so the abuse guard does not know it
+	assert.NoError(t, sendHelp(handler, 42))
+	assert.NoError(t, handler.HandleCallback(context.Background(), &tgbotapi.CallbackQuery{
+		ID:      "callback",
+		From:    &tgbotapi.User{ID: 42, FirstName: "Test"},
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 42}, MessageID: 1},
+		Data:    "help",
+	}))
+	mockBotAPI.AssertNotCalled(t, "Send", mock.Anything)
+	mockBotAPI.AssertNotCalled(t, "Request", mock.Anything)
+}
+
+func TestHandlerWithMiddleware_UnbanCommand(t *testing.T) {
+	mockBotAPI, mockService, handler := setupAbuseTestHandler(t, 1)
+	require.True(t, handler.abuseGuard.RecordViolation(42))
+
+	var replies []string
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			replies = append(replies, args.Get(0).(tgbotapi.MessageConfig).Text)
+		}).
+		Return(tgbotapi.Message{}, nil)
+	mockService.On("UnbanUser", mock.Anything, int64(42)).Return(nil).Once()
+
+	// Only admins can unban
+	require.NoError(t, handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+		Text: "/unban 42",
+		From: &tgbotapi.User{ID: 1, FirstName: "Admin"},
+		Chat: &tgbotapi.Chat{ID: 1},
+	}}))
+	mockService.AssertExpectations(t)
+	require.Len(t, replies, 1)
+	assert.Contains(t, replies[0], "User 42 was unbanned")
+
+	// Updates from the user are handled again
+	assert.False(t, handler.abuseGuard.IsBanned(42))
+	require.NoError(t, sendHelp(handler, 42))
+	assert.Len(t, replies, 2)
+}
@@ -1,30 +1,23 @@
 package bot
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
 )
 
-// AuditLog represents a security audit event
-type AuditLog struct {
-	UserID    int64     `json:"user_id"`
-	Username  string    `json:"username"`
-	Action    string    `json:"action"`
-	Timestamp time.Time `json:"timestamp"`
-	IP        string    `json:"ip,omitempty"`
-	Success   bool      `json:"success"`
-	Error     string    `json:"error,omitempty"`
-	Details   string    `json:"details,omitempty"`
-	SessionID string    `json:"session_id,omitempty"`
-	UserAgent string    `json:"user_agent,omitempty"`
-}
+// auditSinkTimeout bounds how long writing an audit event to a sink may take
+const auditSinkTimeout = 5 * time.Second
 
 // AuditLogger handles security audit logging
 type AuditLogger struct {
 	logger *logrus.Logger
+	// sinks receive every audit event in addition to the log output
+	sinks []domain.AuditSink
 }
 
 // NewAuditLogger creates a new audit logger instance
@@ -32,15 +25,35 @@ func NewAuditLogger(logger *logrus.Logger) *AuditLogger {
 	return &AuditLogger{logger: logger}
 }
 
-// LogEvent logs an audit event
+// AddSink configures an additional destination for audit events, such as the database
+func (al *AuditLogger) AddSink(sink domain.AuditSink) {
+	al.sinks = append(al.sinks, sink)
+}
+
+// LogEvent logs an audit event and writes it to all configured sinks
 func (al *AuditLogger) LogEvent(userID int64, username, action string, success bool, err error, details map[string]interface{}) {
-	audit := AuditLog{
+	al.logAudit(domain.AuditLog{
+		UserID:   userID,
+		Username: username,
+		Action:   action,
+		Success:  success,
+	}, err, details)
+}
+
+// LogSessionEvent logs an audit event that happened within the user's session
+func (al *AuditLogger) LogSessionEvent(userID int64, username, sessionID, action string, success bool, err error, details map[string]interface{}) {
+	al.logAudit(domain.AuditLog{
 		UserID:    userID,
 		Username:  username,
 		Action:    action,
-		Timestamp: time.Now(),
 		Success:   success,
-	}
+		SessionID: sessionID,
+	}, err, details)
+}
+
+// logAudit completes the audit event, logs it and writes it to all configured sinks
+func (al *AuditLogger) logAudit(audit domain.AuditLog, err error, details map[string]interface{}) {
+	audit.Timestamp = time.Now()
 
 	if err != nil {
 		audit.Error = err.Error()
@@ -70,12 +83,35 @@ func (al *AuditLogger) LogEvent(userID int64, username, action string, success b
 		fields["details"] = audit.Details
 	}
 
+	if audit.SessionID != "" {
+		fields["session_id"] = audit.SessionID
+	}
+
 	level := logrus.InfoLevel
-	if !success {
+	if !audit.Success {
 		level = logrus.WarnLevel
 	}
 
 	al.logger.WithFields(fields).Log(level, "Audit event")
+
+	al.writeSinks(&audit)
+}
+
+// writeSinks writes the audit event to every sink. A failing sink is logged and does
+// not keep the event from the others
+func (al *AuditLogger) writeSinks(audit *domain.AuditLog) {
+	for _, sink := range al.sinks {
+		ctx, cancel := context.WithTimeout(context.Background(), auditSinkTimeout)
+		// Every sink gets its own copy so IDs assigned on write do not leak between them
+		entry := *audit
+		if err := sink.WriteAudit(ctx, &entry); err != nil {
+			al.logger.WithError(err).WithFields(logrus.Fields{
+				"user_id": audit.UserID,
+				"action":  audit.Action,
+			}).Error("Failed to write audit event")
+		}
+		cancel()
+	}
 }
 
 // LogUserRegistration logs user registration events
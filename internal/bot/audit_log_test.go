@@ -0,0 +1,76 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingAuditSink keeps written audit events in memory
+type recordingAuditSink struct {
+	entries []domain.AuditLog
+	err     error
+}
+
+func (s *recordingAuditSink) WriteAudit(ctx context.Context, audit *domain.AuditLog) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.entries = append(s.entries, *audit)
+	return nil
+}
+
+func TestAuditLogger_LogEventWritesAllSinks(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	auditLogger := NewAuditLogger(logger)
+
+	failing := &recordingAuditSink{err: fmt.Errorf("database is locked")}
+	first := &recordingAuditSink{}
+	second := &recordingAuditSink{}
+	auditLogger.AddSink(failing)
+	auditLogger.AddSink(first)
+	auditLogger.AddSink(second)
+
+	auditLogger.LogCommand(123, "testuser", "getconfig", false, fmt.Errorf("quota exceeded"))
+
+	// A failing sink does not keep the event from the others
+	for _, sink := range []*recordingAuditSink{first, second} {
+		require.Len(t, sink.entries, 1)
+		entry := sink.entries[0]
+		assert.Equal(t, int64(123), entry.UserID)
+		assert.Equal(t, "testuser", entry.Username)
+		assert.Equal(t, "command_execution", entry.Action)
+		assert.False(t, entry.Success)
+		assert.Equal(t, "quota exceeded", entry.Error)
+		assert.JSONEq(t, `{"command":"getconfig","event_type":"command"}`, entry.Details)
+		assert.False(t, entry.Timestamp.IsZero())
+	}
+}
+
+func TestAuditLoggerAdapter_LogActionRecordsSession(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	auditLogger := NewAuditLogger(logger)
+	sink := &recordingAuditSink{}
+	auditLogger.AddSink(sink)
+
+	NewAuditLoggerAdapter(auditLogger).LogAction(123, "testuser", "0123456789abcdef", "message:/start", time.Now())
+
+	require.Len(t, sink.entries, 1)
+	entry := sink.entries[0]
+	assert.Equal(t, int64(123), entry.UserID)
+	assert.Equal(t, "testuser", entry.Username)
+	assert.Equal(t, "security_user_action", entry.Action)
+	assert.Equal(t, "0123456789abcdef", entry.SessionID)
+	assert.True(t, entry.Success)
+	// Telegram does not expose client IPs or user agents
+	assert.Empty(t, entry.IP)
+	assert.Empty(t, entry.UserAgent)
+}
@@ -0,0 +1,181 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+)
+
+const (
+	// broadcastPageSize is the number of users loaded per page when collecting recipients
+	broadcastPageSize = 100
+	// broadcastProgressEvery is the number of finished sends between progress reports
+	broadcastProgressEvery = 500
+)
+
+// SetNotificationDispatcher configures the dispatcher /broadcast queues messages with
+func (h *Handler) SetNotificationDispatcher(dispatcher *NotificationDispatcher) {
+	h.notifications = dispatcher
+}
+
+// handleBroadcast handles the admin-only /broadcast <text> command, queueing the text
+// to every user who is not banned, has not blocked the bot and whose chat is reachable. The dispatcher paces
+// the sends, and the admin is sent progress reports and the final counts
+func (h *Handler) handleBroadcast(ctx context.Context, message *tgbotapi.Message, args string) error {
+	if !h.isAdmin(message.From.ID) {
+		return h.handleUnknownCommand(ctx, message)
+	}
+
+	text := strings.TrimSpace(args)
+	if text == "" {
+		return h.sendErrorMessage(message.Chat.ID, "Usage: /broadcast <text>")
+	}
+	if h.notifications == nil {
+		return h.sendErrorMessage(message.Chat.ID, "Broadcasting is not available.")
+	}
+
+	h.logger.WithField("admin_id", message.From.ID).Info("Broadcast started")
+	h.reportBroadcast(message.Chat.ID, "📣 Broadcast started.")
+
+	// Recipients are queued in the background as the queue makes room for them, which
+	// outlasts the update
+	go h.queueBroadcast(context.WithoutCancel(ctx), message.Chat.ID, text)
+	return nil
+}
+
+// queueBroadcast pages through all users, queueing the text to those that can be
+// messaged and skipping those that are banned, blocked or unreachable. Each page is
+// queued before the next is loaded, waiting for room when the queue is full
+func (h *Handler) queueBroadcast(ctx context.Context, chatID int64, text string) {
+	progress := &broadcastProgress{handler: h, chatID: chatID}
+	queued, skipped := 0, 0
+	var err error
+
+pages:
+	for offset := 0; ; offset += broadcastPageSize {
+		var users []*domain.UserSnapshot
+		users, err = h.userService.ListUsers(ctx, offset, broadcastPageSize)
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to list broadcast recipients")
+			break
+		}
+		for _, user := range users {
+			if user.Status == domain.UserStatusBanned || user.Blocked || user.Unreachable {
+				skipped++
+				continue
+			}
+			err = h.notifications.EnqueueWait(ctx, Notification{
+				UserID:   user.TelegramID,
+				Kind:     "broadcast",
+				Message:  tgbotapi.NewMessage(user.TelegramID, text),
+				Location: domain.LoadTimezone(user.Timezone),
+				Done:     progress.record,
+			})
+			if err != nil {
+				h.logger.WithError(err).Error("Failed to queue broadcast")
+				break pages
+			}
+			queued++
+		}
+		if len(users) < broadcastPageSize {
+			break
+		}
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"recipients": queued,
+		"skipped":    skipped,
+	}).Info("Broadcast queued")
+	switch {
+	case err != nil:
+		h.reportBroadcast(chatID, fmt.Sprintf("⚠️ Broadcast stopped after queueing %d users, skipping %d banned, blocked or unreachable.", queued, skipped))
+	case queued == 0:
+		h.reportBroadcast(chatID, "There are no users to broadcast to.")
+		return
+	default:
+		h.reportBroadcast(chatID, fmt.Sprintf("📣 Broadcasting to %d users, skipping %d banned, blocked or unreachable.", queued, skipped))
+	}
+	progress.setTotal(queued)
+}
+
+// reportBroadcast sends a plain-text broadcast report to the admin's chat
+func (h *Handler) reportBroadcast(chatID int64, text string) {
+	if _, err := h.botAPI.Send(tgbotapi.NewMessage(chatID, text)); err != nil {
+		h.logger.WithError(err).WithField("chat_id", chatID).Error("Failed to send broadcast report")
+	}
+}
+
+// broadcastProgress counts the outcomes of a broadcast's sends and reports them to
+// the admin who started it. The total is only known once every recipient was queued
+type broadcastProgress struct {
+	handler *Handler
+	chatID  int64
+
+	mu          sync.Mutex
+	total       int
+	totalKnown  bool
+	sent        int
+	failed      int
+	unreachable int
+	blocked     int
+}
+
+// setTotal records how many sends the broadcast queued, reporting the totals if they
+// all finished already
+func (p *broadcastProgress) setTotal(total int) {
+	p.mu.Lock()
+	p.total = total
+	p.totalKnown = true
+	sent, failed, unreachable, blocked := p.sent, p.failed, p.unreachable, p.blocked
+	p.mu.Unlock()
+
+	if sent+failed+unreachable+blocked == total && total > 0 {
+		p.finish(sent, failed, unreachable, blocked)
+	}
+}
+
+// record counts a send's outcome, reporting progress periodically and the totals
+// once every send has finished
+func (p *broadcastProgress) record(outcome NotificationOutcome) {
+	p.mu.Lock()
+	switch outcome.Status {
+	case NotificationSent:
+		p.sent++
+	case NotificationUnreachable:
+		p.unreachable++
+	case NotificationBlocked:
+		p.blocked++
+	default:
+		p.failed++
+	}
+	sent, failed, unreachable, blocked := p.sent, p.failed, p.unreachable, p.blocked
+	total, totalKnown := p.total, p.totalKnown
+	p.mu.Unlock()
+
+	switch done := sent + failed + unreachable + blocked; {
+	case totalKnown && done == total:
+		p.finish(sent, failed, unreachable, blocked)
+	case done%broadcastProgressEvery == 0:
+		if totalKnown {
+			p.handler.reportBroadcast(p.chatID, fmt.Sprintf("📣 Broadcast progress: %d of %d done, %d delivered.", done, total, sent))
+		} else {
+			p.handler.reportBroadcast(p.chatID, fmt.Sprintf("📣 Broadcast progress: %d done, %d delivered.", done, sent))
+		}
+	}
+}
+
+// finish logs and reports the final counts of the broadcast
+func (p *broadcastProgress) finish(sent, failed, unreachable, blocked int) {
+	p.handler.logger.WithFields(logrus.Fields{
+		"sent":        sent,
+		"failed":      failed,
+		"unreachable": unreachable,
+		"blocked":     blocked,
+	}).Info("Broadcast finished")
+	p.handler.reportBroadcast(p.chatID, fmt.Sprintf("✅ Broadcast finished: %d delivered, %d failed, %d unreachable, %d blocked.", sent, failed, unreachable, blocked))
+}
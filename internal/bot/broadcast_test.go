@@ -0,0 +1,176 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_HandleUpdate_BroadcastCommand(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+	handler.SetAdminIDs([]int64{1})
+	dispatcher := NewNotificationDispatcher(mockBotAPI, handler.logger, 1000, 0)
+	dispatcher.sleep = func(context.Context, time.Duration) error { return nil }
+	handler.SetNotificationDispatcher(dispatcher)
+
+	// A full first page, with an unreachable, a banned and a blocked user, is followed by a short one
+	unreachableAt := time.Now()
+	firstPage := make([]*domain.User, broadcastPageSize)
+	for i := range firstPage {
+		firstPage[i] = domain.NewUser(int64(1000+i), "", "User", "")
+	}
+	firstPage[0].UnreachableAt = &unreachableAt
+	firstPage[1].Status = domain.UserStatusBanned
+	firstPage[2].Blocked = true
+	mockService.On("ListUsers", mock.Anything, 0, broadcastPageSize).Return(snapshots(firstPage...), nil)
+	mockService.On("ListUsers", mock.Anything, broadcastPageSize, broadcastPageSize).
+		Return(snapshots(domain.NewUser(2000, "", "Last", "")), nil)
+
+	reports := &broadcastReports{}
+	delivered := map[int64]string{}
+	mockBotAPI.On("Send", toChat(456)).
+		Run(func(args mock.Arguments) {
+			reports.add(args.Get(0).(tgbotapi.MessageConfig).Text)
+		}).
+		Return(tgbotapi.Message{}, nil)
+	mockBotAPI.On("Send", toChat(1003)).
+		Return(tgbotapi.Message{}, &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"})
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			msg := args.Get(0).(tgbotapi.MessageConfig)
+			delivered[msg.ChatID] = msg.Text
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+		Text: "/broadcast Maintenance at 02:00 *UTC*",
+		From: &tgbotapi.User{ID: 1, FirstName: "Admin"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(reports.get()) == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, 98, dispatcher.Stats().Queued, "sends are queued, not made by the handler")
+
+	require.NoError(t, dispatcher.Drain(context.Background()))
+
+	assert.Len(t, delivered, 97)
+	assert.Equal(t, "Maintenance at 02:00 *UTC*", delivered[2000], "the text is sent as written")
+	assert.NotContains(t, delivered, int64(1000), "unreachable users are skipped")
+	assert.NotContains(t, delivered, int64(1001), "banned users are skipped")
+	assert.NotContains(t, delivered, int64(1002), "users who blocked the bot are skipped")
+	assert.Equal(t, []string{
+		"📣 Broadcast started.",
+		"📣 Broadcasting to 98 users, skipping 3 banned, blocked or unreachable.",
+		"✅ Broadcast finished: 97 delivered, 0 failed, 0 unreachable, 1 blocked.",
+	}, reports.get())
+}
+
+func TestHandler_HandleUpdate_BroadcastCommand_LargerThanQueue(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+	handler.SetAdminIDs([]int64{1})
+	dispatcher := NewNotificationDispatcher(mockBotAPI, handler.logger, 1000, 10)
+	dispatcher.sleep = func(context.Context, time.Duration) error { return nil }
+	handler.SetNotificationDispatcher(dispatcher)
+
+	// Three pages of recipients, far more than the queue holds
+	for page := 0; page < 3; page++ {
+		users := make([]*domain.User, broadcastPageSize)
+		for i := range users {
+			users[i] = domain.NewUser(int64(1000+page*broadcastPageSize+i), "", "User", "")
+		}
+		if page == 2 {
+			users = users[:50]
+		}
+		mockService.On("ListUsers", mock.Anything, page*broadcastPageSize, broadcastPageSize).Return(snapshots(users...), nil)
+	}
+
+	reports := &broadcastReports{}
+	mockBotAPI.On("Send", toChat(456)).
+		Run(func(args mock.Arguments) {
+			reports.add(args.Get(0).(tgbotapi.MessageConfig).Text)
+		}).
+		Return(tgbotapi.Message{}, nil)
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).Return(tgbotapi.Message{}, nil)
+
+	dispatcher.Start()
+	defer dispatcher.Stop()
+
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+		Text: "/broadcast hello",
+		From: &tgbotapi.User{ID: 1, FirstName: "Admin"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return len(reports.get()) == 3 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, "📣 Broadcasting to 250 users, skipping 0 banned, blocked or unreachable.", reports.get()[1])
+	assert.Equal(t, "✅ Broadcast finished: 250 delivered, 0 failed, 0 unreachable, 0 blocked.", reports.get()[2])
+	assert.Equal(t, int64(250), dispatcher.Stats().Sent, "no recipient was dropped for a full queue")
+}
+
+// broadcastReports collects the reports sent to the admin, which come from the
+// goroutine queueing the broadcast and from the dispatcher
+type broadcastReports struct {
+	mu      sync.Mutex
+	reports []string
+}
+
+func (r *broadcastReports) add(text string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reports = append(r.reports, text)
+}
+
+func (r *broadcastReports) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.reports...)
+}
+
+func TestHandler_HandleUpdate_BroadcastCommand_Rejected(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		fromID        int64
+		notifications bool
+		expected      string
+	}{
+		{name: "non-admin", text: "/broadcast hello", fromID: 123, notifications: true, expected: "Unknown command"},
+		{name: "missing text", text: "/broadcast", fromID: 1, notifications: true, expected: "Usage: /broadcast <text\\>"},
+		{name: "no dispatcher", text: "/broadcast hello", fromID: 1, expected: "Broadcasting is not available"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBotAPI, _, handler := setupTestHandler()
+			handler.SetAdminIDs([]int64{1})
+			if tt.notifications {
+				handler.SetNotificationDispatcher(NewNotificationDispatcher(mockBotAPI, handler.logger, 0, 0))
+			}
+
+			var sent tgbotapi.MessageConfig
+			mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+				Run(func(args mock.Arguments) {
+					sent = args.Get(0).(tgbotapi.MessageConfig)
+				}).
+				Return(tgbotapi.Message{}, nil)
+
+			err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+				Text: tt.text,
+				From: &tgbotapi.User{ID: tt.fromID, FirstName: "Test"},
+				Chat: &tgbotapi.Chat{ID: 456},
+			}})
+
+			require.NoError(t, err)
+			assert.Contains(t, sent.Text, tt.expected)
+			mockBotAPI.AssertNumberOfCalls(t, "Send", 1)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// CommandFunc handles a command. args holds everything after the command name
+type CommandFunc func(ctx context.Context, message *tgbotapi.Message, args string) error
+
+// CommandObserver is told the outcome and latency of every command dispatched to a
+// registered handler, labeled with the name the command was registered under
+type CommandObserver func(ctx context.Context, message *tgbotapi.Message, command string, duration time.Duration, err error)
+
+// CommandRouter dispatches messages to the handler registered for their command, so
+// commands can be added without editing a switch statement
+type CommandRouter struct {
+	commands map[string]CommandFunc
+	fallback CommandFunc
+	observer CommandObserver
+}
+
+// NewCommandRouter creates a router that passes unregistered commands and plain
+// text to fallback. A nil fallback ignores them
+func NewCommandRouter(fallback CommandFunc) *CommandRouter {
+	return &CommandRouter{
+		commands: make(map[string]CommandFunc),
+		fallback: fallback,
+	}
+}
+
+// Register adds the handler for a command name without the leading slash. Like
+// http.ServeMux it panics when the name is already registered, since that is a
+// programming error
+func (r *CommandRouter) Register(name string, fn CommandFunc) {
+	if name == "" || fn == nil {
+		panic("bot: command name and handler must be set")
+	}
+	if _, exists := r.commands[name]; exists {
+		panic(fmt.Sprintf("bot: command %q registered twice", name))
+	}
+	r.commands[name] = fn
+}
+
+// SetObserver configures the observer told about dispatched commands. Messages passed
+// to the fallback are not observed, so arbitrary text cannot grow metric labels
+func (r *CommandRouter) SetObserver(observer CommandObserver) {
+	r.observer = observer
+}
+
+// Commands returns the registered command names in alphabetical order
+func (r *CommandRouter) Commands() []string {
+	names := make([]string, 0, len(r.commands))
+	for name := range r.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Dispatch runs the handler registered for the message's command, matched with
+// message.Command() so "/start payload" and "/start@bot" both reach "start"
+func (r *CommandRouter) Dispatch(ctx context.Context, message *tgbotapi.Message) error {
+	name, args := parseCommand(message)
+	if fn, ok := r.commands[name]; ok {
+		if r.observer == nil {
+			return fn(ctx, message, args)
+		}
+		start := time.Now()
+		err := fn(ctx, message, args)
+		r.observer(ctx, message, name, time.Since(start), err)
+		return err
+	}
+	if r.fallback == nil {
+		return nil
+	}
+	return r.fallback(ctx, message, args)
+}
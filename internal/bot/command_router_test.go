@@ -0,0 +1,154 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandRouter_Dispatch(t *testing.T) {
+	var called, gotArgs string
+	record := func(name string) CommandFunc {
+		return func(ctx context.Context, message *tgbotapi.Message, args string) error {
+			called, gotArgs = name, args
+			return nil
+		}
+	}
+
+	router := NewCommandRouter(record("fallback"))
+	router.Register("start", record("start"))
+	router.Register("help", record("help"))
+
+	tests := []struct {
+		name         string
+		message      *tgbotapi.Message
+		expectedCall string
+		expectedArgs string
+	}{
+		{
+			name:         "registered command",
+			message:      &tgbotapi.Message{Text: "/help", Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Length: 5}}},
+			expectedCall: "help",
+		},
+		{
+			name:         "command with arguments",
+			message:      &tgbotapi.Message{Text: "/start ref_xyz", Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Length: 6}}},
+			expectedCall: "start",
+			expectedArgs: "ref_xyz",
+		},
+		{
+			name:         "command addressed to the bot",
+			message:      &tgbotapi.Message{Text: "/start@arcanus_bot", Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Length: 18}}},
+			expectedCall: "start",
+		},
+		{
+			name:         "unregistered command",
+			message:      &tgbotapi.Message{Text: "/unknown", Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Length: 8}}},
+			expectedCall: "fallback",
+		},
+		{
+			name:         "plain text",
+			message:      &tgbotapi.Message{Text: "hello"},
+			expectedCall: "fallback",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called, gotArgs = "", ""
+			require.NoError(t, router.Dispatch(context.Background(), tt.message))
+			assert.Equal(t, tt.expectedCall, called)
+			assert.Equal(t, tt.expectedArgs, gotArgs)
+		})
+	}
+}
+
+func TestCommandRouter_ReturnsHandlerError(t *testing.T) {
+	errBoom := errors.New("boom")
+	router := NewCommandRouter(nil)
+	router.Register("start", func(ctx context.Context, message *tgbotapi.Message, args string) error {
+		return errBoom
+	})
+
+	err := router.Dispatch(context.Background(), &tgbotapi.Message{Text: "/start"})
+
+	assert.ErrorIs(t, err, errBoom)
+}
+
+func TestCommandRouter_NilFallbackIgnoresUnknownCommands(t *testing.T) {
+	router := NewCommandRouter(nil)
+
+	assert.NoError(t, router.Dispatch(context.Background(), &tgbotapi.Message{Text: "/unknown"}))
+}
+
+func TestCommandRouter_Register(t *testing.T) {
+	noop := func(ctx context.Context, message *tgbotapi.Message, args string) error { return nil }
+
+	router := NewCommandRouter(nil)
+	router.Register("start", noop)
+	router.Register("account", noop)
+
+	assert.Equal(t, []string{"account", "start"}, router.Commands())
+	assert.Panics(t, func() { router.Register("start", noop) })
+	assert.Panics(t, func() { router.Register("", noop) })
+	assert.Panics(t, func() { router.Register("help", nil) })
+}
+
+func TestHandler_RegistersRoutedCommands(t *testing.T) {
+	_, _, handler := setupTestHandler()
+
+	assert.Equal(t, []string{
+		"account", "alertat", "anonymize", "audit", "broadcast", "config", "deleteaccount",
+		"exportstats", "getconfig", "help", "history", "language", "plans", "reloadconfig",
+		"reportbug", "resetquota", "setting", "start", "stats", "test", "timezone", "top", "unban", "upgrade", "users",
+	}, handler.router.Commands())
+}
+
+func TestCommandRouter_Observer(t *testing.T) {
+	errBoom := errors.New("boom")
+	router := NewCommandRouter(func(ctx context.Context, message *tgbotapi.Message, args string) error { return nil })
+	router.Register("start", func(ctx context.Context, message *tgbotapi.Message, args string) error {
+		return errBoom
+	})
+
+	var observed []string
+	var observedErr error
+	router.SetObserver(func(ctx context.Context, message *tgbotapi.Message, command string, duration time.Duration, err error) {
+		observed = append(observed, command)
+		observedErr = err
+	})
+
+	assert.ErrorIs(t, router.Dispatch(context.Background(), &tgbotapi.Message{Text: "/start@arcanus_bot ref"}), errBoom)
+	require.NoError(t, router.Dispatch(context.Background(), &tgbotapi.Message{Text: "/unknown"}))
+
+	assert.Equal(t, []string{"start"}, observed, "fallback dispatches are not observed")
+	assert.ErrorIs(t, observedErr, errBoom)
+}
+
+func TestHandler_RecordsCommandMetrics(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+	botMetrics := metrics.New()
+	handler.SetCommandRecorder(botMetrics)
+
+	mockService.On("GetUserSnapshot", mock.Anything, int64(123)).Return(nil, errors.New("database unavailable"))
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).Return(tgbotapi.Message{}, errors.New("bad gateway")).Once()
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).Return(tgbotapi.Message{}, nil)
+
+	from := &tgbotapi.User{ID: 123, UserName: "testuser"}
+	chat := &tgbotapi.Chat{ID: 456}
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{Text: "/account", From: from, Chat: chat}})
+	require.Error(t, err)
+	require.NoError(t, handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{Text: "/help", From: from, Chat: chat}}))
+
+	assert.Equal(t, float64(1), botMetrics.CommandsExecuted.WithLabelValue("account").Value())
+	assert.Equal(t, float64(1), botMetrics.CommandErrors.WithLabelValue("account").Value())
+	assert.Equal(t, float64(1), botMetrics.CommandsExecuted.WithLabelValue("help").Value())
+	assert.Equal(t, float64(0), botMetrics.CommandErrors.WithLabelValue("help").Value())
+}
@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// defaultEditedMessageCapacity bounds the number of messages remembered for deduplication
+const defaultEditedMessageCapacity = 1000
+
+// messageKey identifies a message across its edits
+type messageKey struct {
+	chatID    int64
+	messageID int
+}
+
+// EditedMessageTracker turns edited commands into regular message updates so a
+// mistyped command can be fixed by editing it. It remembers the text processed for
+// recent messages and skips edits that would run the same text again
+type EditedMessageTracker struct {
+	mu       sync.Mutex
+	capacity int
+	texts    map[messageKey]string
+	order    []messageKey
+}
+
+// NewEditedMessageTracker creates a tracker remembering up to capacity messages
+func NewEditedMessageTracker(capacity int) *EditedMessageTracker {
+	if capacity <= 0 {
+		capacity = defaultEditedMessageCapacity
+	}
+	return &EditedMessageTracker{
+		capacity: capacity,
+		texts:    make(map[messageKey]string, capacity),
+	}
+}
+
+// Remember records the text of a message that is being processed
+func (t *EditedMessageTracker) Remember(message *tgbotapi.Message) {
+	if message == nil || message.Chat == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.remember(messageKey{chatID: message.Chat.ID, messageID: message.MessageID}, strings.TrimSpace(message.Text))
+}
+
+// Resolve returns the edited message as a regular message update when it is a
+// command that has not been processed with the same text before
+func (t *EditedMessageTracker) Resolve(update tgbotapi.Update) (tgbotapi.Update, bool) {
+	edited := update.EditedMessage
+	if edited == nil || edited.Chat == nil || edited.From == nil {
+		return update, false
+	}
+
+	text := strings.TrimSpace(edited.Text)
+	if !strings.HasPrefix(text, "/") {
+		return update, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := messageKey{chatID: edited.Chat.ID, messageID: edited.MessageID}
+	if processed, ok := t.texts[key]; ok && processed == text {
+		return update, false
+	}
+	t.remember(key, text)
+
+	return tgbotapi.Update{UpdateID: update.UpdateID, Message: edited}, true
+}
+
+// remember stores the text for a message, evicting the oldest message when full
+func (t *EditedMessageTracker) remember(key messageKey, text string) {
+	if _, ok := t.texts[key]; !ok {
+		if len(t.order) >= t.capacity {
+			delete(t.texts, t.order[0])
+			t.order = t.order[1:]
+		}
+		t.order = append(t.order, key)
+	}
+	t.texts[key] = text
+}
@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"context"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newEditedMessage(messageID int, text string) *tgbotapi.Message {
+	return &tgbotapi.Message{
+		MessageID: messageID,
+		Text:      text,
+		From:      &tgbotapi.User{ID: 123, UserName: "testuser", FirstName: "Test", LastName: "User"},
+		Chat:      &tgbotapi.Chat{ID: 456},
+	}
+}
+
+func TestEditedMessageTracker_EditedStartCommandIsHandled(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+	tracker := NewEditedMessageTracker(10)
+
+	mockService.On("RegisterUser", mock.Anything, int64(123), "testuser", "Test", "User", "").
+		Return(domain.NewUser(123, "testuser", "Test", "User"), nil)
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Return(tgbotapi.Message{}, nil)
+
+	// The mistyped command is processed as an unknown command first
+	original := tgbotapi.Update{UpdateID: 1, Message: newEditedMessage(42, "/starr")}
+	tracker.Remember(original.Message)
+	require.NoError(t, handler.HandleUpdate(context.Background(), original))
+	mockService.AssertNotCalled(t, "RegisterUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	update, ok := tracker.Resolve(tgbotapi.Update{UpdateID: 2, EditedMessage: newEditedMessage(42, "/start")})
+	require.True(t, ok)
+	assert.Equal(t, 2, update.UpdateID)
+	require.NotNil(t, update.Message)
+	require.NoError(t, handler.HandleUpdate(context.Background(), update))
+
+	mockService.AssertNumberOfCalls(t, "RegisterUser", 1)
+}
+
+func TestEditedMessageTracker_SkipsAlreadyProcessedText(t *testing.T) {
+	tracker := NewEditedMessageTracker(10)
+	tracker.Remember(newEditedMessage(42, "/start"))
+
+	_, ok := tracker.Resolve(tgbotapi.Update{EditedMessage: newEditedMessage(42, "/start ")})
+	assert.False(t, ok, "an edit that does not change the command must not run it again")
+
+	_, ok = tracker.Resolve(tgbotapi.Update{EditedMessage: newEditedMessage(42, "/account")})
+	assert.True(t, ok)
+
+	_, ok = tracker.Resolve(tgbotapi.Update{EditedMessage: newEditedMessage(42, "/account")})
+	assert.False(t, ok, "a redelivered edit must not run twice")
+}
+
+func TestEditedMessageTracker_IgnoresNonCommands(t *testing.T) {
+	tracker := NewEditedMessageTracker(10)
+
+	_, ok := tracker.Resolve(tgbotapi.Update{EditedMessage: newEditedMessage(42, "hello there")})
+	assert.False(t, ok)
+
+	_, ok = tracker.Resolve(tgbotapi.Update{Message: newEditedMessage(43, "/start")})
+	assert.False(t, ok, "regular messages are not edits")
+}
+
+func TestEditedMessageTracker_EvictsOldestMessage(t *testing.T) {
+	tracker := NewEditedMessageTracker(2)
+	tracker.Remember(newEditedMessage(1, "/start"))
+	tracker.Remember(newEditedMessage(2, "/help"))
+	tracker.Remember(newEditedMessage(3, "/account"))
+
+	_, ok := tracker.Resolve(tgbotapi.Update{EditedMessage: newEditedMessage(1, "/start")})
+	assert.True(t, ok, "evicted messages are no longer deduplicated")
+
+	_, ok = tracker.Resolve(tgbotapi.Update{EditedMessage: newEditedMessage(3, "/account")})
+	assert.False(t, ok, "recent messages are still deduplicated")
+}
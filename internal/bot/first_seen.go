@@ -0,0 +1,37 @@
+package bot
+
+import (
+	"context"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+)
+
+// FirstSeenRecorder records the first update seen from every user. Users already
+// recorded are cached so repeated updates do not hit the database
+type FirstSeenRecorder struct {
+	senderRecorder
+	repo domain.UserSightingRepository
+}
+
+// NewFirstSeenRecorder creates a new first-seen recorder
+func NewFirstSeenRecorder(repo domain.UserSightingRepository, logger *logrus.Logger) *FirstSeenRecorder {
+	return &FirstSeenRecorder{
+		senderRecorder: newSenderRecorder(logger, 0),
+		repo:           repo,
+	}
+}
+
+// Observe records the sender of the update if they have not been seen before.
+// Failures are logged and never block update processing
+func (r *FirstSeenRecorder) Observe(ctx context.Context, update tgbotapi.Update) {
+	r.observe(ctx, update, func(ctx context.Context, telegramID int64, now time.Time) error {
+		err := r.repo.RecordFirstSeen(ctx, telegramID, now)
+		if err != nil {
+			r.logger.WithError(err).WithField("user_id", telegramID).Warn("Failed to record first seen")
+		}
+		return err
+	})
+}
@@ -0,0 +1,67 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupFirstSeenRecorder(t *testing.T) (*FirstSeenRecorder, *countingRecorderRepository, *fakeClock) {
+	repo, logger, clock := setupSenderRecorderTest(t)
+	recorder := NewFirstSeenRecorder(repo, logger)
+	recorder.now = clock.Now
+	return recorder, repo, clock
+}
+
+func TestFirstSeenRecorder_SetOnFirstInteraction(t *testing.T) {
+	recorder, repo, clock := setupFirstSeenRecorder(t)
+	ctx := context.Background()
+	first := clock.Now()
+
+	// A group message from a user who never used /start
+	recorder.Observe(ctx, tgbotapi.Update{Message: &tgbotapi.Message{
+		Text: "hello",
+		From: &tgbotapi.User{ID: 123},
+		Chat: &tgbotapi.Chat{ID: -100, Type: "group"},
+	}})
+
+	seenAt, err := repo.GetFirstSeen(ctx, 123)
+	require.NoError(t, err)
+	assert.True(t, first.Equal(seenAt))
+}
+
+func TestFirstSeenRecorder_NotOverwrittenOnLaterInteractions(t *testing.T) {
+	recorder, repo, clock := setupFirstSeenRecorder(t)
+	ctx := context.Background()
+	first := clock.Now()
+
+	recorder.Observe(ctx, tgbotapi.Update{Message: &tgbotapi.Message{Text: "/start", From: &tgbotapi.User{ID: 123}, Chat: &tgbotapi.Chat{ID: 123}}})
+	clock.now = clock.now.Add(time.Hour)
+	recorder.Observe(ctx, tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{Data: "trial", From: &tgbotapi.User{ID: 123}}})
+
+	seenAt, err := repo.GetFirstSeen(ctx, 123)
+	require.NoError(t, err)
+	assert.True(t, first.Equal(seenAt))
+	assert.Equal(t, 1, repo.writes, "known users are not written again")
+
+	// Even without the cache the stored value is not overwritten
+	recorder.written = make(map[int64]time.Time)
+	clock.now = clock.now.Add(time.Hour)
+	recorder.Observe(ctx, tgbotapi.Update{Message: &tgbotapi.Message{Text: "/account", From: &tgbotapi.User{ID: 123}, Chat: &tgbotapi.Chat{ID: 123}}})
+
+	seenAt, err = repo.GetFirstSeen(ctx, 123)
+	require.NoError(t, err)
+	assert.True(t, first.Equal(seenAt))
+}
+
+func TestFirstSeenRecorder_IgnoresUpdatesWithoutSender(t *testing.T) {
+	recorder, repo, _ := setupFirstSeenRecorder(t)
+
+	recorder.Observe(context.Background(), tgbotapi.Update{ChannelPost: &tgbotapi.Message{Text: "news", Chat: &tgbotapi.Chat{ID: -100}}})
+
+	assert.Equal(t, 0, repo.writes)
+}
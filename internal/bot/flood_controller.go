@@ -0,0 +1,300 @@
+package bot
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// defaultFloodThreshold is the number of 429 responses within the window that triggers a cool down
+	defaultFloodThreshold = 3
+	// defaultFloodWindow is the window in which 429 responses are counted
+	defaultFloodWindow = 30 * time.Second
+	// defaultFloodQueueSize bounds the number of sends deferred during a cool down
+	defaultFloodQueueSize = 1000
+)
+
+// FloodState is a snapshot of the flood controller state
+type FloodState struct {
+	InCooldown    bool
+	CooldownUntil time.Time
+	RecentHits    int
+	Queued        int
+	Dropped       int64
+}
+
+// FloodController tracks Telegram flood-wait responses across all sends.
+// When 429 responses repeat within a short window it enters a global cool
+// down during which non-critical sends are queued instead of being sent.
+// Once started, it sends the queued messages in the background when the cool
+// down ends
+type FloodController struct {
+	mu            sync.Mutex
+	threshold     int
+	window        time.Duration
+	maxQueue      int
+	hits          []time.Time
+	cooldownUntil time.Time
+	queue         []tgbotapi.Chattable
+	dropped       int64
+	now           func() time.Time
+
+	// wake tells the drain loop the queue or the cool down changed
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewFloodController creates a new flood controller with default settings
+func NewFloodController() *FloodController {
+	return &FloodController{
+		threshold: defaultFloodThreshold,
+		window:    defaultFloodWindow,
+		maxQueue:  defaultFloodQueueSize,
+		now:       time.Now,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Start sends the deferred messages through botAPI whenever a cool down ends, until
+// Stop is called
+func (fc *FloodController) Start(botAPI BotAPI) {
+	fc.stop = make(chan struct{})
+	fc.done = make(chan struct{})
+	go fc.drainLoop(botAPI)
+}
+
+// Stop stops sending deferred messages. Messages still queued are not sent
+func (fc *FloodController) Stop() {
+	if fc.stop == nil {
+		return
+	}
+	close(fc.stop)
+	<-fc.done
+	fc.stop = nil
+}
+
+// drainLoop waits for the cool down to end while messages are queued and sends them
+func (fc *FloodController) drainLoop(botAPI BotAPI) {
+	defer close(fc.done)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		fc.flush(botAPI)
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		var release <-chan time.Time
+		if wait, ok := fc.untilDrain(); ok {
+			timer.Reset(wait)
+			release = timer.C
+		}
+
+		select {
+		case <-fc.stop:
+			return
+		case <-fc.wake:
+		case <-release:
+		}
+	}
+}
+
+// untilDrain returns how long until the queued messages can be sent, and false when
+// nothing is queued
+func (fc *FloodController) untilDrain() (time.Duration, bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	if len(fc.queue) == 0 {
+		return 0, false
+	}
+	return fc.cooldownUntil.Sub(fc.now()), true
+}
+
+// flush sends messages queued during a cool down that has since ended. If Telegram
+// pushes back again, the rest stay queued, ahead of anything queued meanwhile
+func (fc *FloodController) flush(botAPI BotAPI) {
+	queued := fc.Drain()
+	for i, c := range queued {
+		_, err := botAPI.Send(c)
+		fc.Observe(err)
+
+		if fc.InCooldown() {
+			fc.requeue(queued[i+1:])
+			return
+		}
+	}
+}
+
+// requeue puts messages back at the front of the queue
+func (fc *FloodController) requeue(messages []tgbotapi.Chattable) {
+	if len(messages) == 0 {
+		return
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.queue = append(append([]tgbotapi.Chattable(nil), messages...), fc.queue...)
+}
+
+// notify wakes the drain loop, if it is not already due to wake
+func (fc *FloodController) notify() {
+	select {
+	case fc.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Observe inspects the result of a send and records flood-wait responses
+func (fc *FloodController) Observe(err error) {
+	retryAfter, ok := floodWaitDuration(err)
+	if !ok {
+		return
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	now := fc.now()
+	fc.hits = append(fc.pruneHits(now), now)
+
+	if len(fc.hits) >= fc.threshold {
+		until := now.Add(retryAfter)
+		if until.After(fc.cooldownUntil) {
+			fc.cooldownUntil = until
+			fc.notify()
+		}
+	}
+}
+
+// InCooldown reports whether sends are currently paused
+func (fc *FloodController) InCooldown() bool {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now().Before(fc.cooldownUntil)
+}
+
+// Enqueue defers a send until the cool down ends. It returns false if the queue is full
+func (fc *FloodController) Enqueue(c tgbotapi.Chattable) bool {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	if len(fc.queue) >= fc.maxQueue {
+		fc.dropped++
+		return false
+	}
+	fc.queue = append(fc.queue, c)
+	if len(fc.queue) == 1 {
+		fc.notify()
+	}
+	return true
+}
+
+// Drain returns and clears the deferred sends once the cool down is over
+func (fc *FloodController) Drain() []tgbotapi.Chattable {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	if fc.now().Before(fc.cooldownUntil) || len(fc.queue) == 0 {
+		return nil
+	}
+	queued := fc.queue
+	fc.queue = nil
+	return queued
+}
+
+// State returns a snapshot of the controller state for metrics and health checks
+func (fc *FloodController) State() FloodState {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	now := fc.now()
+	fc.hits = fc.pruneHits(now)
+	return FloodState{
+		InCooldown:    now.Before(fc.cooldownUntil),
+		CooldownUntil: fc.cooldownUntil,
+		RecentHits:    len(fc.hits),
+		Queued:        len(fc.queue),
+		Dropped:       fc.dropped,
+	}
+}
+
+// pruneHits drops flood-wait hits that fall outside the window
+func (fc *FloodController) pruneHits(now time.Time) []time.Time {
+	cutoff := now.Add(-fc.window)
+	kept := fc.hits[:0]
+	for _, hit := range fc.hits {
+		if hit.After(cutoff) {
+			kept = append(kept, hit)
+		}
+	}
+	return kept
+}
+
+// floodWaitDuration extracts the retry_after duration from a Telegram 429 error
+func floodWaitDuration(err error) (time.Duration, bool) {
+	if err == nil {
+		return 0, false
+	}
+
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	retryAfter := time.Duration(apiErr.RetryAfter) * time.Second
+	if retryAfter <= 0 {
+		retryAfter = time.Second
+	}
+	return retryAfter, true
+}
+
+// FloodAwareBotAPI wraps a BotAPI and reports every send to a FloodController
+type FloodAwareBotAPI struct {
+	BotAPI
+	flood *FloodController
+}
+
+// NewFloodAwareBotAPI creates a BotAPI that observes flood-wait responses
+func NewFloodAwareBotAPI(botAPI BotAPI, flood *FloodController) *FloodAwareBotAPI {
+	return &FloodAwareBotAPI{
+		BotAPI: botAPI,
+		flood:  flood,
+	}
+}
+
+// Send sends a message immediately and records any flood-wait response.
+// Replies to user interactions are critical and are never deferred.
+func (b *FloodAwareBotAPI) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	msg, err := b.BotAPI.Send(c)
+	b.flood.Observe(err)
+	return msg, err
+}
+
+// Request performs a request and records any flood-wait response
+func (b *FloodAwareBotAPI) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	resp, err := b.BotAPI.Request(c)
+	b.flood.Observe(err)
+	return resp, err
+}
+
+// SendNonCritical sends a message unless the bot is cooling down, in which
+// case the message is queued and sent once the cool down is over
+func (b *FloodAwareBotAPI) SendNonCritical(c tgbotapi.Chattable) error {
+	if b.flood.InCooldown() {
+		if !b.flood.Enqueue(c) {
+			return errors.New("flood control queue is full")
+		}
+		return nil
+	}
+	_, err := b.Send(c)
+	return err
+}
@@ -0,0 +1,135 @@
+package bot
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a controllable time source for flood controller tests
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestFloodController() (*FloodController, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	fc := NewFloodController()
+	fc.now = clock.Now
+	return fc, clock
+}
+
+func floodWaitError(retryAfter int) error {
+	return &tgbotapi.Error{
+		Code:               429,
+		Message:            "Too Many Requests: retry after",
+		ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: retryAfter},
+	}
+}
+
+func TestFloodController_RepeatedFloodWaitTriggersCooldown(t *testing.T) {
+	fc, clock := newTestFloodController()
+
+	fc.Observe(floodWaitError(5))
+	fc.Observe(floodWaitError(5))
+	assert.False(t, fc.InCooldown(), "a couple of 429s should not pause sends")
+
+	fc.Observe(floodWaitError(10))
+	assert.True(t, fc.InCooldown())
+
+	state := fc.State()
+	assert.True(t, state.InCooldown)
+	assert.Equal(t, 3, state.RecentHits)
+	assert.Equal(t, clock.now.Add(10*time.Second), state.CooldownUntil)
+
+	clock.now = clock.now.Add(11 * time.Second)
+	assert.False(t, fc.InCooldown())
+}
+
+func TestFloodController_HitsOutsideWindowAreForgotten(t *testing.T) {
+	fc, clock := newTestFloodController()
+
+	fc.Observe(floodWaitError(5))
+	fc.Observe(floodWaitError(5))
+	clock.now = clock.now.Add(defaultFloodWindow + time.Second)
+	fc.Observe(floodWaitError(5))
+
+	assert.False(t, fc.InCooldown())
+	assert.Equal(t, 1, fc.State().RecentHits)
+}
+
+func TestFloodController_IgnoresOtherErrors(t *testing.T) {
+	fc, _ := newTestFloodController()
+
+	for i := 0; i < 5; i++ {
+		fc.Observe(nil)
+		fc.Observe(errors.New("network error"))
+		fc.Observe(&tgbotapi.Error{Code: 400, Message: "Bad Request"})
+	}
+
+	assert.False(t, fc.InCooldown())
+	assert.Equal(t, 0, fc.State().RecentHits)
+}
+
+func TestFloodAwareBotAPI_QueuesNonCriticalSendsDuringCooldown(t *testing.T) {
+	fc, clock := newTestFloodController()
+	mockBotAPI := new(MockBotAPI)
+	botAPI := NewFloodAwareBotAPI(mockBotAPI, fc)
+
+	// Telegram keeps answering with 429 until the controller backs off
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Return(tgbotapi.Message{}, floodWaitError(5)).Times(3)
+	for i := 0; i < 3; i++ {
+		_, err := botAPI.Send(tgbotapi.NewMessage(1, "reply"))
+		assert.Error(t, err)
+	}
+	require.True(t, fc.InCooldown())
+
+	// Non-critical sends are held back instead of hammering the API
+	require.NoError(t, botAPI.SendNonCritical(tgbotapi.NewMessage(2, "notification")))
+	require.NoError(t, botAPI.SendNonCritical(tgbotapi.NewMessage(3, "notification")))
+	assert.Equal(t, 2, fc.State().Queued)
+	mockBotAPI.AssertNumberOfCalls(t, "Send", 3)
+
+	// Sends do not flush the queue themselves
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Return(tgbotapi.Message{}, nil)
+	clock.now = clock.now.Add(6 * time.Second)
+	_, err := botAPI.Send(tgbotapi.NewMessage(1, "reply"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, fc.State().Queued)
+
+	// Once the cool down is over the queue is drained in the background
+	fc.Start(mockBotAPI)
+	defer fc.Stop()
+	require.Eventually(t, func() bool { return fc.State().Queued == 0 }, time.Second, 10*time.Millisecond)
+	mockBotAPI.AssertNumberOfCalls(t, "Send", 6)
+}
+
+func TestFloodController_DrainKeepsQueueWhenFloodWaitReturns(t *testing.T) {
+	fc, _ := newTestFloodController()
+	fc.threshold = 1
+	mockBotAPI := new(MockBotAPI)
+
+	require.True(t, fc.Enqueue(tgbotapi.NewMessage(1, "first")))
+	require.True(t, fc.Enqueue(tgbotapi.NewMessage(2, "second")))
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Return(tgbotapi.Message{}, floodWaitError(30)).Once()
+
+	fc.Start(mockBotAPI)
+	require.Eventually(t, func() bool { return fc.State().InCooldown }, time.Second, 10*time.Millisecond)
+	fc.Stop()
+
+	// The first message was attempted, the second waits for the next cool down to end
+	mockBotAPI.AssertNumberOfCalls(t, "Send", 1)
+	require.Equal(t, 1, fc.State().Queued)
+	assert.Equal(t, int64(2), fc.queue[0].(tgbotapi.MessageConfig).ChatID)
+}
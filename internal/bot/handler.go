@@ -1,14 +1,28 @@
 package bot
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sirupsen/logrus"
 	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
 	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/events"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/i18n"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/middleware"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/utils"
 )
 
 // BotAPI interface for Telegram bot operations
@@ -18,6 +32,8 @@ type BotAPI interface {
 	GetUpdatesChan(config tgbotapi.UpdateConfig) tgbotapi.UpdatesChannel
 	StopReceivingUpdates()
 	GetMe() (tgbotapi.User, error)
+	GetWebhookInfo() (tgbotapi.WebhookInfo, error)
+	MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error)
 }
 
 // Handler handles Telegram bot interactions
@@ -27,261 +43,1854 @@ type Handler struct {
 	logger       *logrus.Logger
 	rateLimiter  *RateLimiter
 	auditLogger  *AuditLogger
-	processLock  *ProcessLock
 	eventService *events.Service
+	adminIDs     map[int64]bool
+	activityRepo domain.UserActivityRepository
+	auditLogs    domain.AuditLogRepository
+	helpRenderer *HelpRenderer
+	settings     SettingsStore
+	bugReports   domain.BugReportRepository
+	adminChatID  int64
+	version      string
+	plans        *domain.PlanCatalog
+	payments     domain.PaymentService
+	gateway      domain.Gateway
+	vpn          domain.VPNService
+	reloader     ConfigReloader
+	anonymize    bool // hide usernames in admin listings
+	retention    DataRetention
+	abuseGuard   *AbuseGuard // forgets auto-bans lifted by /unban
+	router       *CommandRouter
+	tr           *i18n.Translator
+
+	commandRecorder CommandRecorder
+	providerToken   string // payment provider token sent with plan invoices
+
+	notifications *NotificationDispatcher
+	configSummary string // redacted effective configuration shown by /config
+	ids           utils.IDGenerator
+
+	errorsMu   sync.Mutex
+	lastErrors map[int64]string // last error message shown in each chat
+
+}
+
+// SettingsStore exposes runtime settings to the bot
+type SettingsStore interface {
+	Set(ctx context.Context, key, value string) error
+	Values() map[string]string
+	Keys() []string
+	MaintenanceMode() bool
+}
+
+// DataRetention anonymizes inactive users on demand for /anonymize
+type DataRetention interface {
+	Enabled() bool
+	// Preview returns how many users Enforce would anonymize without changing them
+	Preview(ctx context.Context) (int, error)
+	Enforce(ctx context.Context) (int, error)
+}
+
+// ConfigReloader reloads the runtime configuration on demand for /reloadconfig
+type ConfigReloader interface {
+	Reload(ctx context.Context) ([]domain.SettingChange, error)
+}
+
+// CommandRecorder records the outcome and latency of handled commands by name
+type CommandRecorder interface {
+	RecordCommand(command string, duration time.Duration, err error)
+}
+
+// historyLimit is the number of commands shown by /history
+const historyLimit = 20
+
+// maxBugReportLength limits the description accepted by /reportbug
+const maxBugReportLength = 2048
+
+// planCallbackPrefix prefixes the callback data of the plan "Choose" buttons
+const planCallbackPrefix = "plan:"
+
+// maintenanceMessage is the reply to users while the bot is in maintenance mode
+const maintenanceMessage = "🛠 The bot is under maintenance. Please try again later."
+
+// languageCallbackPrefix prefixes the callback data of the /language buttons
+const languageCallbackPrefix = "lang:"
+
+// NewHandler creates a new bot handler
+func NewHandler(botAPI BotAPI, userService domain.UserService, logger *logrus.Logger) *Handler {
+	h := &Handler{
+		botAPI:       botAPI,
+		userService:  userService,
+		logger:       logger,
+		rateLimiter:  NewRateLimiter(DefaultRateLimiterConfig()),
+		auditLogger:  NewAuditLogger(logger),
+		helpRenderer: DefaultHelpRenderer(),
+		tr:           i18n.Default(),
+	}
+	h.router = h.newCommandRouter()
+	return h
+}
+
+// NewHandlerWithEvents creates a new bot handler with event publishing
+func NewHandlerWithEvents(botAPI BotAPI, userService domain.UserService, logger *logrus.Logger, eventService *events.Service) *Handler {
+	h := &Handler{
+		botAPI:       botAPI,
+		userService:  userService,
+		logger:       logger,
+		rateLimiter:  NewRateLimiter(DefaultRateLimiterConfig()),
+		auditLogger:  NewAuditLogger(logger),
+		eventService: eventService,
+		helpRenderer: DefaultHelpRenderer(),
+		tr:           i18n.Default(),
+	}
+	h.router = h.newCommandRouter()
+	return h
+}
+
+// newCommandRouter registers the commands handled by the bot. Anything else goes to
+// handleUnknownCommand
+func (h *Handler) newCommandRouter() *CommandRouter {
+	router := NewCommandRouter(func(ctx context.Context, message *tgbotapi.Message, _ string) error {
+		return h.handleUnknownCommand(ctx, message)
+	})
+	router.SetObserver(h.observeCommand)
+	router.Register("start", h.handleStart)
+	router.Register("account", func(ctx context.Context, message *tgbotapi.Message, _ string) error {
+		return h.handleAccount(ctx, message)
+	})
+	router.Register("help", func(ctx context.Context, message *tgbotapi.Message, _ string) error {
+		return h.handleHelp(ctx, message)
+	})
+	router.Register("language", func(ctx context.Context, message *tgbotapi.Message, _ string) error {
+		return h.handleLanguage(ctx, message)
+	})
+	router.Register("alertat", h.handleAlertAt)
+	router.Register("timezone", h.handleTimezone)
+	router.Register("getconfig", func(ctx context.Context, message *tgbotapi.Message, _ string) error {
+		return h.handleGetConfig(ctx, message)
+	})
+	router.Register("plans", func(ctx context.Context, message *tgbotapi.Message, _ string) error {
+		return h.handlePlans(ctx, message)
+	})
+	router.Register("test", func(ctx context.Context, message *tgbotapi.Message, _ string) error {
+		return h.handleConnectionTest(ctx, message)
+	})
+	router.Register("deleteaccount", func(ctx context.Context, message *tgbotapi.Message, _ string) error {
+		return h.handleDeleteAccount(ctx, message)
+	})
+	router.Register("reportbug", h.handleReportBug)
+
+	// Admin commands check the sender themselves
+	router.Register("stats", func(ctx context.Context, message *tgbotapi.Message, _ string) error {
+		return h.handleStats(ctx, message)
+	})
+	router.Register("exportstats", h.handleExportStats)
+	router.Register("users", h.handleUsers)
+	router.Register("top", h.handleTop)
+	router.Register("history", h.handleHistory)
+	router.Register("audit", h.handleAudit)
+	router.Register("setting", h.handleSetting)
+	router.Register("reloadconfig", func(ctx context.Context, message *tgbotapi.Message, _ string) error {
+		return h.handleReloadConfig(ctx, message)
+	})
+	router.Register("config", func(ctx context.Context, message *tgbotapi.Message, _ string) error {
+		return h.handleConfig(ctx, message)
+	})
+	router.Register("resetquota", h.handleResetQuota)
+	router.Register("upgrade", h.handleUpgrade)
+	router.Register("anonymize", h.handleAnonymize)
+	router.Register("unban", h.handleUnban)
+	router.Register("broadcast", h.handleBroadcast)
+	return router
+}
+
+// observeCommand records the outcome and latency of a handled command and publishes
+// a command executed event for it
+func (h *Handler) observeCommand(ctx context.Context, message *tgbotapi.Message, command string, duration time.Duration, err error) {
+	if h.commandRecorder != nil {
+		h.commandRecorder.RecordCommand(command, duration, err)
+	}
+	if h.eventService != nil {
+		if pubErr := h.eventService.PublishBotCommandExecuted(ctx, message.From.ID, message.Chat.ID, command, duration, err); pubErr != nil {
+			h.logger.WithError(pubErr).Error("Failed to publish bot command executed event")
+		}
+	}
+}
+
+// SetCommandRecorder configures where per-command metrics are recorded
+func (h *Handler) SetCommandRecorder(recorder CommandRecorder) {
+	h.commandRecorder = recorder
+}
+
+// SetAdminIDs configures the Telegram IDs allowed to run admin commands
+func (h *Handler) SetAdminIDs(ids []int64) {
+	h.adminIDs = make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		h.adminIDs[id] = true
+	}
+}
+
+// SetHelpRenderer configures the renderer used for help text
+func (h *Handler) SetHelpRenderer(renderer *HelpRenderer) {
+	h.helpRenderer = renderer
+}
+
+// SetActivityRepository configures where recent user commands are recorded
+func (h *Handler) SetActivityRepository(repo domain.UserActivityRepository) {
+	h.activityRepo = repo
+}
+
+// SetAuditLogRepository configures where /audit reads the audit history of users
+func (h *Handler) SetAuditLogRepository(repo domain.AuditLogRepository) {
+	h.auditLogs = repo
+}
+
+// SetSettingsStore configures the runtime settings used for maintenance mode and /setting
+func (h *Handler) SetSettingsStore(settings SettingsStore) {
+	h.settings = settings
+}
+
+// SetBugReportRepository configures where /reportbug reports are stored
+func (h *Handler) SetBugReportRepository(repo domain.BugReportRepository) {
+	h.bugReports = repo
+}
+
+// SetPlanCatalog configures the plans listed by /plans
+func (h *Handler) SetPlanCatalog(catalog *domain.PlanCatalog) {
+	h.plans = catalog
+}
+
+// SetPaymentService configures how successful payments are applied
+func (h *Handler) SetPaymentService(payments domain.PaymentService) {
+	h.payments = payments
+}
+
+// SetPaymentProviderToken configures the payment provider token sent with plan
+// invoices. Plans priced in Telegram Stars need none
+func (h *Handler) SetPaymentProviderToken(token string) {
+	h.providerToken = token
+}
+
+// SetGateway configures the VPN gateway queried by /test
+func (h *Handler) SetGateway(gateway domain.Gateway) {
+	h.gateway = gateway
+}
+
+// SetVPNService configures the service issuing VPN configs for /getconfig
+func (h *Handler) SetVPNService(vpn domain.VPNService) {
+	h.vpn = vpn
+}
+
+// SetConfigReloader configures how /reloadconfig reloads the runtime configuration
+func (h *Handler) SetConfigReloader(reloader ConfigReloader) {
+	h.reloader = reloader
+}
+
+// SetConfigSummary configures the redacted effective configuration shown by /config
+func (h *Handler) SetConfigSummary(summary string) {
+	h.configSummary = summary
+}
+
+// SetIDGenerator configures how correlation IDs are minted for updates that arrive
+// without one
+func (h *Handler) SetIDGenerator(ids utils.IDGenerator) {
+	h.ids = ids
+}
+
+// SetTranslator configures the message catalogs used for user-facing replies
+func (h *Handler) SetTranslator(tr *i18n.Translator) {
+	h.tr = tr
+}
+
+// SetAnonymizeUsernames hides usernames in admin listings such as /top
+func (h *Handler) SetAnonymizeUsernames(anonymize bool) {
+	h.anonymize = anonymize
+}
+
+// SetDataRetention configures the retention policy run by /anonymize
+func (h *Handler) SetDataRetention(retention DataRetention) {
+	h.retention = retention
+}
+
+// SetAdminChatID configures the chat that receives bug reports. When unset they are sent to each admin
+func (h *Handler) SetAdminChatID(chatID int64) {
+	h.adminChatID = chatID
+}
+
+// SetVersion configures the application version attached to bug reports
+func (h *Handler) SetVersion(version string) {
+	h.version = version
+}
+
+// isAdmin checks whether the given Telegram ID belongs to an admin
+func (h *Handler) isAdmin(telegramID int64) bool {
+	return h.adminIDs[telegramID]
+}
+
+// HandleUpdate processes incoming Telegram updates
+func (h *Handler) HandleUpdate(ctx context.Context, update tgbotapi.Update) error {
+	if update.Message == nil {
+		return nil
+	}
+
+	message := update.Message
+	// Messages sent on behalf of a channel or group have no sender to attribute them to
+	if message.From == nil || message.Chat == nil {
+		h.logger.WithFields(logrus.Fields{
+			"update_id":  update.UpdateID,
+			"message_id": message.MessageID,
+		}).Warn("Skipping message without a sender or chat")
+		return nil
+	}
+	ctx, correlationID := h.withCorrelationID(ctx)
+	ctx = events.WithUpdateID(ctx, update.UpdateID)
+	h.logger.WithFields(logrus.Fields{
+		"update_id":      update.UpdateID,
+		"chat_id":        message.Chat.ID,
+		"user_id":        message.From.ID,
+		"username":       message.From.UserName,
+		"text":           message.Text,
+		"message_id":     message.MessageID,
+		"correlation_id": correlationID,
+	}).Info("Received message")
+
+	// Publish bot message received event
+	if h.eventService != nil {
+		command := message.Command()
+		if err := h.eventService.PublishBotMessageReceived(ctx, message.From.ID, message.From.UserName, message.Chat.ID, message.MessageID, message.Text, command); err != nil {
+			h.logger.WithError(err).Error("Failed to publish bot message received event")
+		}
+	}
+
+	if message.SuccessfulPayment != nil {
+		return h.handleSuccessfulPayment(ctx, message)
+	}
+
+	command, _ := parseCommand(message)
+	if command != "" {
+		h.recordCommand(ctx, message)
+	}
+
+	if h.settings != nil && h.settings.MaintenanceMode() && !h.isAdmin(message.From.ID) {
+		return h.sendErrorMessage(message.Chat.ID, maintenanceMessage)
+	}
+
+	return h.router.Dispatch(ctx, message)
+}
+
+// withCorrelationID returns the context's correlation ID, attaching a new one when
+// the update does not carry one yet
+func (h *Handler) withCorrelationID(ctx context.Context) (context.Context, string) {
+	if correlationID, ok := events.CorrelationIDFromContext(ctx); ok {
+		return ctx, correlationID
+	}
+	var correlationID string
+	if h.ids != nil {
+		correlationID = h.ids.NewID()
+	} else {
+		correlationID = middleware.NewCorrelationID()
+	}
+	return events.WithCorrelationID(ctx, correlationID), correlationID
+}
+
+// parseCommand splits a message into its command name and arguments. It relies on
+// command entities when present and falls back to parsing the text otherwise
+func parseCommand(message *tgbotapi.Message) (string, string) {
+	if message.IsCommand() {
+		return message.Command(), message.CommandArguments()
+	}
+	if !strings.HasPrefix(message.Text, "/") {
+		return "", ""
+	}
+
+	name, args, _ := strings.Cut(message.Text[1:], " ")
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	return name, strings.TrimSpace(args)
+}
+
+// recordCommand stores the command in the user's recent activity
+func (h *Handler) recordCommand(ctx context.Context, message *tgbotapi.Message) {
+	if h.activityRepo == nil {
+		return
+	}
+	if err := h.activityRepo.AppendCommand(ctx, message.From.ID, utils.TruncateString(message.Text, 256)); err != nil {
+		h.logger.WithError(err).Warn("Failed to record command history")
+	}
+}
+
+// HandleCallback handles inline keyboard callbacks
+func (h *Handler) HandleCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) error {
+	ctx, correlationID := h.withCorrelationID(ctx)
+	updateID, _ := events.UpdateIDFromContext(ctx)
+	h.logger.WithFields(logrus.Fields{
+		"update_id":      updateID,
+		"chat_id":        callback.Message.Chat.ID,
+		"user_id":        callback.From.ID,
+		"username":       callback.From.UserName,
+		"data":           callback.Data,
+		"message_id":     callback.Message.MessageID,
+		"correlation_id": correlationID,
+	}).Info("Received callback")
+
+	// Publish bot callback received event
+	if h.eventService != nil {
+		if err := h.eventService.PublishBotCallbackReceived(ctx, callback.From.ID, callback.From.UserName, callback.Message.Chat.ID, callback.Message.MessageID, callback.Data); err != nil {
+			h.logger.WithError(err).Error("Failed to publish bot callback received event")
+		}
+	}
+
+	if name, ok := strings.CutPrefix(callback.Data, planCallbackPrefix); ok {
+		return h.handleChoosePlan(ctx, callback, name)
+	}
+	if offset, ok := strings.CutPrefix(callback.Data, usersCallbackPrefix); ok {
+		return h.handleUsersPage(ctx, callback, offset)
+	}
+	if page, ok := strings.CutPrefix(callback.Data, auditCallbackPrefix); ok {
+		return h.handleAuditPage(ctx, callback, page)
+	}
+	if code, ok := strings.CutPrefix(callback.Data, languageCallbackPrefix); ok {
+		return h.handleChooseLanguage(ctx, callback, code)
+	}
+
+	switch callback.Data {
+	case "trial":
+		return h.handleTrialActivation(ctx, callback)
+	case "account":
+		return h.handleAccountCallback(ctx, callback)
+	case "help":
+		return h.handleHelpCallback(ctx, callback)
+	case "confirm_deleteaccount":
+		return h.handleDeleteAccountConfirm(ctx, callback)
+	case "cancel_deleteaccount":
+		return h.handleDeleteAccountCancel(ctx, callback)
+	default:
+		return h.handleUnknownCallback(ctx, callback)
+	}
+}
+
+// handleStart handles the /start command. A deep-link payload is treated as a referral code
+func (h *Handler) handleStart(ctx context.Context, message *tgbotapi.Message, payload string) error {
+	var user *domain.User
+	var err error
+	if payload != "" {
+		logStartPayload(h.logger, message.From.ID, payload)
+		user, err = h.userService.RegisterWithReferral(ctx, message.From.ID, message.From.UserName, message.From.FirstName, message.From.LastName, message.From.LanguageCode, payload)
+	} else {
+		user, err = h.userService.RegisterUser(ctx, message.From.ID, message.From.UserName, message.From.FirstName, message.From.LastName, message.From.LanguageCode)
+	}
+	lang := h.languageOf(ctx, message.From)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to register user")
+		return h.sendErrorMessage(message.Chat.ID, h.tr.Get(lang, "register_failed"))
+	}
+	if user != nil {
+		ctx = withStoredLanguage(ctx, user.TelegramID, user.LanguageCode)
+	}
+	lang = h.languageOf(ctx, message.From)
+
+	text := utils.EscapeMarkdown(h.tr.Get(lang, "welcome", user.FirstName, formatBytes(user.QuotaLimit)))
+
+	keyboard := h.createMainKeyboard(h.languageOf(ctx, message.From))
+	return h.sendMessage(message.Chat.ID, text, keyboard)
+}
+
+// logStartPayload records the deep-link payload a user started the bot with, for
+// referral and campaign tracking
+func logStartPayload(logger *logrus.Logger, userID int64, payload string) {
+	logger.WithFields(logrus.Fields{
+		"user_id":       userID,
+		"start_payload": payload,
+	}).Info("Bot started from a deep link")
+}
+
+// handleAccount handles the /account command
+func (h *Handler) handleAccount(ctx context.Context, message *tgbotapi.Message) error {
+	user, err := h.userService.GetUserSnapshot(ctx, message.From.ID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get user")
+		return h.sendErrorMessage(message.Chat.ID, h.tr.Get(h.languageOf(ctx, message.From), "account.failed"))
+	}
+	ctx = withStoredLanguage(ctx, user.TelegramID, user.LanguageCode)
+
+	text, entities := h.formatAccountInfo(user, h.languageOf(ctx, message.From))
+	keyboard := h.createMainKeyboard(h.languageOf(ctx, message.From))
+	return h.sendEntityMessage(message.Chat.ID, text, entities, keyboard)
+}
+
+// handleHelp handles the /help command
+func (h *Handler) handleHelp(ctx context.Context, message *tgbotapi.Message) error {
+	lang := h.languageOf(ctx, message.From)
+	text := h.helpRenderer.Render(h.tr, lang)
+
+	keyboard := h.createMainKeyboard(lang)
+	return h.sendMessage(message.Chat.ID, text, keyboard)
+}
+
+// handleStats handles the admin-only /stats command
+func (h *Handler) handleStats(ctx context.Context, message *tgbotapi.Message) error {
+	if !h.isAdmin(message.From.ID) {
+		return h.handleUnknownCommand(ctx, message)
+	}
+
+	stats, err := h.userService.GetAggregateStats(ctx)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get aggregate stats")
+		return h.sendErrorMessage(message.Chat.ID, "Failed to get statistics. Please try again.")
+	}
+
+	text := fmt.Sprintf("📈 *Bot Statistics*\n\n"+
+		"👥 *Total Users:* %d\n"+
+		"• Inactive: %d\n"+
+		"• Trial: %d\n"+
+		"• Active: %d\n"+
+		"• Banned: %d\n\n"+
+		"💾 *Total Data Used:* %s",
+		stats.TotalUsers,
+		stats.UsersByStatus[domain.UserStatusInactive],
+		stats.UsersByStatus[domain.UserStatusTrial],
+		stats.UsersByStatus[domain.UserStatusActive],
+		stats.UsersByStatus[domain.UserStatusBanned],
+		utils.EscapeMarkdown(formatBytes(stats.TotalQuotaUsed)))
+
+	keyboard := h.createMainKeyboard(h.languageOf(ctx, message.From))
+	return h.sendMessage(message.Chat.ID, text, keyboard)
+}
+
+const (
+	// defaultExportDays is the number of days of signups /exportstats covers without an argument
+	defaultExportDays = 30
+	// maxExportDays caps the number of days of signups /exportstats covers
+	maxExportDays = 366
+)
+
+// handleExportStats handles the admin-only /exportstats [days] command, sending the
+// aggregate statistics and the daily signups of the last days as a CSV document
+func (h *Handler) handleExportStats(ctx context.Context, message *tgbotapi.Message, args string) error {
+	if !h.isAdmin(message.From.ID) {
+		return h.handleUnknownCommand(ctx, message)
+	}
+
+	days := defaultExportDays
+	if args != "" {
+		parsed, err := strconv.Atoi(args)
+		if err != nil || parsed < 1 || parsed > maxExportDays {
+			return h.sendErrorMessage(message.Chat.ID, fmt.Sprintf("Usage: /exportstats [1-%d]", maxExportDays))
+		}
+		days = parsed
+	}
+
+	stats, err := h.userService.GetAggregateStats(ctx)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get aggregate stats")
+		return h.sendErrorMessage(message.Chat.ID, "Failed to export statistics. Please try again.")
+	}
+	now := time.Now().UTC()
+	signups, err := h.userService.DailySignups(ctx, now.AddDate(0, 0, 1-days), now)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to count daily signups")
+		return h.sendErrorMessage(message.Chat.ID, "Failed to export statistics. Please try again.")
+	}
+
+	data, err := statsCSV(stats, signups)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to render statistics CSV")
+		return h.sendErrorMessage(message.Chat.ID, "Failed to export statistics. Please try again.")
+	}
+	name := fmt.Sprintf("arcanus-stats-%s.csv", now.Format("2006-01-02"))
+	return h.sendDocument(message.Chat.ID, name, data,
+		fmt.Sprintf("📊 User statistics with signups of the last %d days", days))
+}
+
+// statsCSV renders aggregate statistics as "section,name,value" rows: user counts per
+// status, totals and the signups per day
+func statsCSV(stats *domain.UserStats, signups []domain.DailyCount) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	rows := [][]string{{"section", "name", "value"}}
+
+	statuses := []string{domain.UserStatusInactive, domain.UserStatusTrial, domain.UserStatusActive, domain.UserStatusBanned}
+	// Statuses unknown to this version are exported too, after the known ones
+	var others []string
+	for status := range stats.UsersByStatus {
+		if !slices.Contains(statuses, status) {
+			others = append(others, status)
+		}
+	}
+	sort.Strings(others)
+	for _, status := range append(statuses, others...) {
+		rows = append(rows, []string{"status", status, strconv.FormatInt(stats.UsersByStatus[status], 10)})
+	}
+
+	rows = append(rows,
+		[]string{"total", "users", strconv.FormatInt(stats.TotalUsers, 10)},
+		[]string{"total", "quota_used_bytes", strconv.FormatInt(stats.TotalQuotaUsed, 10)})
+	for _, day := range signups {
+		rows = append(rows, []string{"signups", day.Day.Format("2006-01-02"), strconv.FormatInt(day.Count, 10)})
+	}
+
+	if err := w.WriteAll(rows); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+const (
+	// usersPageSize is the number of users shown per /users page
+	usersPageSize = 10
+	// usersCallbackPrefix prefixes the offset carried by /users pagination buttons
+	usersCallbackPrefix = "users:"
+)
+
+// handleUsers handles the admin-only /users [page] command
+func (h *Handler) handleUsers(ctx context.Context, message *tgbotapi.Message, args string) error {
+	if !h.isAdmin(message.From.ID) {
+		return h.handleUnknownCommand(ctx, message)
+	}
+
+	page := 1
+	if args != "" {
+		parsed, err := strconv.Atoi(args)
+		if err != nil || parsed < 1 {
+			return h.sendErrorMessage(message.Chat.ID, "Usage: /users [page]")
+		}
+		page = parsed
+	}
+
+	text, entities, keyboard, err := h.usersPage(ctx, (page-1)*usersPageSize)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list users")
+		return h.sendErrorMessage(message.Chat.ID, "Failed to list users. Please try again.")
+	}
+	return h.sendEntityMessage(message.Chat.ID, text, entities, keyboard)
+}
+
+// handleUsersPage handles the pagination buttons of /users by editing the list in place
+func (h *Handler) handleUsersPage(ctx context.Context, callback *tgbotapi.CallbackQuery, offsetArg string) error {
+	offset, err := strconv.Atoi(offsetArg)
+	if !h.isAdmin(callback.From.ID) || err != nil || offset < 0 {
+		return h.handleUnknownCallback(ctx, callback)
+	}
+
+	text, entities, keyboard, err := h.usersPage(ctx, offset)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list users")
+		return h.answerCallback(callback.ID, "Failed to list users. Please try again.")
+	}
+
+	edit := tgbotapi.NewEditMessageTextAndMarkup(callback.Message.Chat.ID, callback.Message.MessageID, text, keyboard)
+	edit.Entities = entities
+	if _, err := h.botAPI.Send(edit); err != nil {
+		// Telegram rejects edits that change nothing, e.g. refreshing an unchanged page
+		h.logger.WithError(err).Warn("Failed to update users page")
+	}
+	return h.answerCallback(callback.ID, "")
+}
+
+// usersPage renders the page of users starting at offset with navigation buttons
+func (h *Handler) usersPage(ctx context.Context, offset int) (string, []tgbotapi.MessageEntity, tgbotapi.InlineKeyboardMarkup, error) {
+	total, err := h.userService.CountUsers(ctx)
+	if err != nil {
+		return "", nil, tgbotapi.InlineKeyboardMarkup{}, err
+	}
+	users, err := h.userService.ListUsers(ctx, offset, usersPageSize)
+	if err != nil {
+		return "", nil, tgbotapi.InlineKeyboardMarkup{}, err
+	}
+
+	pages := max((int(total)+usersPageSize-1)/usersPageSize, 1)
+	eb := utils.NewEntityBuilder().Text("👥 ").Bold("Users").
+		Text(fmt.Sprintf(" (page %d of %d, %d total)\n", offset/usersPageSize+1, pages, total))
+	if len(users) == 0 {
+		eb.Text("\nNo users on this page.")
+	}
+	for _, user := range users {
+		name := user.Username
+		if name != "" {
+			name = "@" + name
+		} else {
+			name = strings.TrimSpace(user.FirstName + " " + user.LastName)
+		}
+		eb.Text("\n").Code(strconv.FormatInt(user.TelegramID, 10)).
+			Text(fmt.Sprintf(" %s · %s · %s / %s", name, user.Status, formatBytes(user.QuotaUsed), formatBytes(user.QuotaLimit)))
+		if user.Unreachable {
+			eb.Text(" · unreachable")
+		}
+		if user.Blocked {
+			eb.Text(" · blocked")
+		}
+	}
+
+	keyboard := utils.NewKeyboardBuilder()
+	if offset > 0 {
+		keyboard.AddButton(tgbotapi.NewInlineKeyboardButtonData("⬅️ Prev", usersCallbackPrefix+strconv.Itoa(max(offset-usersPageSize, 0))))
+	}
+	keyboard.AddButton(tgbotapi.NewInlineKeyboardButtonData("🔄 Refresh", usersCallbackPrefix+strconv.Itoa(offset)))
+	if int64(offset+len(users)) < total {
+		keyboard.AddButton(tgbotapi.NewInlineKeyboardButtonData("Next ➡️", usersCallbackPrefix+strconv.Itoa(offset+usersPageSize)))
+	}
+
+	return eb.String(), eb.Entities(), keyboard.Build(), nil
+}
+
+const (
+	// defaultTopUsers is the number of users listed by /top without an argument
+	defaultTopUsers = 10
+	// maxTopUsers caps the number of users /top lists, keeping the reply within one message
+	maxTopUsers = 50
+)
+
+// handleTop handles the admin-only /top [n] command listing the heaviest users
+func (h *Handler) handleTop(ctx context.Context, message *tgbotapi.Message, args string) error {
+	if !h.isAdmin(message.From.ID) {
+		return h.handleUnknownCommand(ctx, message)
+	}
+
+	n := defaultTopUsers
+	if args != "" {
+		parsed, err := strconv.Atoi(args)
+		if err != nil || parsed < 1 || parsed > maxTopUsers {
+			return h.sendErrorMessage(message.Chat.ID, fmt.Sprintf("Usage: /top [1-%d]", maxTopUsers))
+		}
+		n = parsed
+	}
+
+	users, err := h.userService.TopByUsage(ctx, n)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list top users")
+		return h.sendErrorMessage(message.Chat.ID, "Failed to list top users. Please try again.")
+	}
+
+	eb := utils.NewEntityBuilder().Text("🏆 ").Bold(fmt.Sprintf("Top %d users by usage", n)).Text("\n")
+	if len(users) == 0 {
+		eb.Text("\nNo users yet.")
+	}
+	for i, user := range users {
+		eb.Text(fmt.Sprintf("\n%d. ", i+1)).Bold(h.displayName(user)).
+			Text(fmt.Sprintf("\n%s %.0f%% · %s / %s\n", progressBar(user.QuotaUsedPct),
+				user.QuotaUsedPct, formatBytes(user.QuotaUsed), formatBytes(user.QuotaLimit)))
+	}
+
+	return h.sendEntityMessage(message.Chat.ID, eb.String(), eb.Entities(), h.createMainKeyboard(h.languageOf(ctx, message.From)))
+}
+
+// displayName names a user in admin listings, replacing the username with a stable
+// pseudonym when usernames are anonymized
+func (h *Handler) displayName(user *domain.UserSnapshot) string {
+	if h.anonymize {
+		sum := sha256.Sum256([]byte(strconv.FormatInt(user.TelegramID, 10)))
+		return "user-" + hex.EncodeToString(sum[:4])
+	}
+	if user.Username != "" {
+		return "@" + user.Username
+	}
+	return strconv.FormatInt(user.TelegramID, 10)
+}
+
+// progressBarWidth is the number of cells in a usage progress bar
+const progressBarWidth = 10
+
+// progressBar renders a usage percentage as a bar of filled and empty cells
+func progressBar(percent float64) string {
+	filled := int(math.Round(percent / 100 * progressBarWidth))
+	filled = min(max(filled, 0), progressBarWidth)
+	return strings.Repeat("▓", filled) + strings.Repeat("░", progressBarWidth-filled)
+}
+
+// handleHistory handles the admin-only /history <telegram_id> command
+func (h *Handler) handleHistory(ctx context.Context, message *tgbotapi.Message, args string) error {
+	if !h.isAdmin(message.From.ID) {
+		return h.handleUnknownCommand(ctx, message)
+	}
+	if h.activityRepo == nil {
+		return h.sendErrorMessage(message.Chat.ID, "Command history is not available.")
+	}
+
+	telegramID, err := strconv.ParseInt(strings.TrimSpace(args), 10, 64)
+	if err != nil || telegramID <= 0 {
+		return h.sendErrorMessage(message.Chat.ID, "Usage: /history <telegram_id>")
+	}
+
+	records, err := h.activityRepo.ListRecent(ctx, telegramID, historyLimit)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get command history")
+		return h.sendErrorMessage(message.Chat.ID, "Failed to get command history. Please try again.")
+	}
+
+	eb := utils.NewEntityBuilder().
+		Text("🕘 ").Bold(fmt.Sprintf("Recent commands for %d", telegramID)).Text("\n\n")
+	if len(records) == 0 {
+		eb.Text("No commands recorded.")
+	}
+	for _, record := range records {
+		eb.Text("• " + record.IssuedAt.UTC().Format("2006-01-02 15:04:05") + " ").Code(record.Command).Text("\n")
+	}
+
+	keyboard := h.createMainKeyboard(h.languageOf(ctx, message.From))
+	return h.sendEntityMessage(message.Chat.ID, eb.String(), eb.Entities(), keyboard)
+}
+
+const (
+	// auditPageSize is the number of audit entries shown per /audit page
+	auditPageSize = 10
+	// maxAuditEntries caps how far back /audit pages through a user's history
+	maxAuditEntries = 100
+	// maxAuditDetailsLength truncates the details shown for each audit entry
+	maxAuditDetailsLength = 120
+	// auditCallbackPrefix prefixes the "<telegram_id>:<offset>" carried by /audit pagination buttons
+	auditCallbackPrefix = "audit:"
+)
+
+// handleAudit handles the admin-only /audit <telegram_id> command listing the user's
+// most recent audit entries
+func (h *Handler) handleAudit(ctx context.Context, message *tgbotapi.Message, args string) error {
+	if !h.isAdmin(message.From.ID) {
+		return h.handleUnknownCommand(ctx, message)
+	}
+	if h.auditLogs == nil {
+		return h.sendErrorMessage(message.Chat.ID, "Audit history is not available.")
+	}
+
+	telegramID, err := strconv.ParseInt(strings.TrimSpace(args), 10, 64)
+	if err != nil || telegramID <= 0 {
+		return h.sendErrorMessage(message.Chat.ID, "Usage: /audit <telegram_id>")
+	}
+
+	text, entities, keyboard, err := h.auditPage(ctx, telegramID, 0)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get audit history")
+		return h.sendErrorMessage(message.Chat.ID, "Failed to get audit history. Please try again.")
+	}
+	return h.sendEntityMessage(message.Chat.ID, text, entities, keyboard)
+}
+
+// handleAuditPage handles the pagination buttons of /audit by editing the list in place
+func (h *Handler) handleAuditPage(ctx context.Context, callback *tgbotapi.CallbackQuery, data string) error {
+	idArg, offsetArg, _ := strings.Cut(data, ":")
+	telegramID, idErr := strconv.ParseInt(idArg, 10, 64)
+	offset, offsetErr := strconv.Atoi(offsetArg)
+	if !h.isAdmin(callback.From.ID) || h.auditLogs == nil || idErr != nil || offsetErr != nil || offset < 0 || offset >= maxAuditEntries {
+		return h.handleUnknownCallback(ctx, callback)
+	}
+
+	text, entities, keyboard, err := h.auditPage(ctx, telegramID, offset)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get audit history")
+		return h.answerCallback(callback.ID, "Failed to get audit history. Please try again.")
+	}
+
+	edit := tgbotapi.NewEditMessageTextAndMarkup(callback.Message.Chat.ID, callback.Message.MessageID, text, keyboard)
+	edit.Entities = entities
+	if _, err := h.botAPI.Send(edit); err != nil {
+		h.logger.WithError(err).Warn("Failed to update audit page")
+	}
+	return h.answerCallback(callback.ID, "")
+}
+
+// auditPage renders the user's audit entries starting at offset, newest first, with
+// navigation buttons. One entry past the page is fetched to know whether a next page exists
+func (h *Handler) auditPage(ctx context.Context, telegramID int64, offset int) (string, []tgbotapi.MessageEntity, tgbotapi.InlineKeyboardMarkup, error) {
+	limit := min(offset+auditPageSize+1, maxAuditEntries)
+	audits, err := h.auditLogs.ListAuditByUser(ctx, telegramID, limit)
+	if err != nil {
+		return "", nil, tgbotapi.InlineKeyboardMarkup{}, err
+	}
+
+	page := audits[min(offset, len(audits)):min(offset+auditPageSize, len(audits))]
+	eb := utils.NewEntityBuilder().
+		Text("🛡 ").Bold(fmt.Sprintf("Audit history for %d", telegramID)).
+		Text(fmt.Sprintf(" (page %d)\n\n", offset/auditPageSize+1))
+	if len(page) == 0 {
+		eb.Text("No audit entries recorded.")
+	}
+	for _, audit := range page {
+		result := "✅"
+		if !audit.Success {
+			result = "❌"
+		}
+		eb.Text("• " + audit.Timestamp.UTC().Format("2006-01-02 15:04:05") + " " + result + " ").Code(audit.Action).Text("\n")
+		if audit.Error != "" {
+			eb.Text("  Error: " + utils.TruncateString(audit.Error, maxAuditDetailsLength) + "\n")
+		}
+		if audit.Details != "" {
+			eb.Text("  " + utils.TruncateString(audit.Details, maxAuditDetailsLength) + "\n")
+		}
+	}
+
+	keyboard := utils.NewKeyboardBuilder()
+	callbackData := func(offset int) string {
+		return fmt.Sprintf("%s%d:%d", auditCallbackPrefix, telegramID, offset)
+	}
+	if offset > 0 {
+		keyboard.AddButton(tgbotapi.NewInlineKeyboardButtonData("⬅️ Prev", callbackData(max(offset-auditPageSize, 0))))
+	}
+	keyboard.AddButton(tgbotapi.NewInlineKeyboardButtonData("🔄 Refresh", callbackData(offset)))
+	if len(audits) > offset+auditPageSize {
+		keyboard.AddButton(tgbotapi.NewInlineKeyboardButtonData("Next ➡️", callbackData(offset+auditPageSize)))
+	}
+
+	return eb.String(), eb.Entities(), keyboard.Build(), nil
+}
+
+// handleReloadConfig handles the admin-only /reloadconfig command, reloading the runtime
+// configuration like SIGHUP does and reporting the values that changed
+func (h *Handler) handleReloadConfig(ctx context.Context, message *tgbotapi.Message) error {
+	if !h.isAdmin(message.From.ID) {
+		return h.handleUnknownCommand(ctx, message)
+	}
+	if h.reloader == nil {
+		return h.sendErrorMessage(message.Chat.ID, "Config reload is not available.")
+	}
+
+	changes, err := h.reloader.Reload(ctx)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to reload config")
+		return h.sendErrorMessage(message.Chat.ID, "Failed to reload config. Please try again.")
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"admin_id": message.From.ID,
+		"changes":  len(changes),
+	}).Info("Config reloaded")
+
+	eb := utils.NewEntityBuilder().Text("🔄 ").Bold("Config reloaded").Text("\n\n")
+	if len(changes) == 0 {
+		eb.Text("No values changed.")
+	}
+	for _, change := range changes {
+		eb.Text("• ").Code(change.Key).Text(": " + settingValue(change.Old) + " → " + settingValue(change.New) + "\n")
+	}
+	return h.sendEntityMessage(message.Chat.ID, eb.String(), eb.Entities(), h.createMainKeyboard(h.languageOf(ctx, message.From)))
+}
+
+// handleConfig handles the admin-only /config command, showing the effective
+// configuration with secrets redacted
+func (h *Handler) handleConfig(ctx context.Context, message *tgbotapi.Message) error {
+	if !h.isAdmin(message.From.ID) {
+		return h.handleUnknownCommand(ctx, message)
+	}
+	if h.configSummary == "" {
+		return h.sendErrorMessage(message.Chat.ID, "Config is not available.")
+	}
+
+	h.logger.WithField("admin_id", message.From.ID).Info("Config viewed")
+
+	eb := utils.NewEntityBuilder().Text("⚙️ ").Bold("Effective config").Text("\n\n").Pre(h.configSummary)
+	return h.sendEntityMessage(message.Chat.ID, eb.String(), eb.Entities(), h.createMainKeyboard(h.languageOf(ctx, message.From)))
+}
+
+// settingValue renders a setting value for /reloadconfig, where empty means unset
+func settingValue(value string) string {
+	if value == "" {
+		return "(unset)"
+	}
+	return value
+}
+
+// handleResetQuota handles the admin-only /resetquota <telegram_id> command
+func (h *Handler) handleResetQuota(ctx context.Context, message *tgbotapi.Message, args string) error {
+	if !h.isAdmin(message.From.ID) {
+		return h.handleUnknownCommand(ctx, message)
+	}
+
+	const usage = "Usage: /resetquota <telegram_id> [--dry-run]"
+	positional, flags := utils.ParseArgs(args)
+	if len(positional) != 1 {
+		return h.sendErrorMessage(message.Chat.ID, usage)
+	}
+	telegramID, err := strconv.ParseInt(positional[0], 10, 64)
+	if err != nil || telegramID <= 0 {
+		return h.sendErrorMessage(message.Chat.ID, usage)
+	}
+	dryRun, err := isDryRun(flags)
+	if err != nil {
+		return h.sendErrorMessage(message.Chat.ID, usage)
+	}
+
+	if dryRun {
+		user, err := h.userService.GetUser(ctx, telegramID)
+		if err != nil {
+			if errors.Is(err, domain.ErrUserNotFound) {
+				return h.sendErrorMessage(message.Chat.ID, fmt.Sprintf("User %d not found.", telegramID))
+			}
+			h.logger.WithError(err).Error("Failed to get user for quota reset dry run")
+			return h.sendErrorMessage(message.Chat.ID, "Failed to reset quota. Please try again.")
+		}
+		keyboard := h.createMainKeyboard(h.languageOf(ctx, message.From))
+		return h.sendMessage(message.Chat.ID, utils.EscapeMarkdown(fmt.Sprintf("🧪 Dry run: would reset %s of quota used by user %d. Nothing was changed.", formatBytes(user.QuotaUsed), telegramID)), keyboard)
+	}
+
+	if err := h.userService.ResetQuota(ctx, telegramID); err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			return h.sendErrorMessage(message.Chat.ID, fmt.Sprintf("User %d not found.", telegramID))
+		}
+		h.logger.WithError(err).Error("Failed to reset quota")
+		return h.sendErrorMessage(message.Chat.ID, "Failed to reset quota. Please try again.")
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"admin_id":    message.From.ID,
+		"telegram_id": telegramID,
+	}).Info("Quota reset")
+
+	keyboard := h.createMainKeyboard(h.languageOf(ctx, message.From))
+	return h.sendMessage(message.Chat.ID, utils.EscapeMarkdown(fmt.Sprintf("✅ Quota reset for user %d.", telegramID)), keyboard)
+}
+
+// handleUnban handles the admin-only /unban <telegram_id> command, lifting a ban
+// whether it was persisted or only recorded by the abuse guard
+func (h *Handler) handleUnban(ctx context.Context, message *tgbotapi.Message, args string) error {
+	if !h.isAdmin(message.From.ID) {
+		return h.handleUnknownCommand(ctx, message)
+	}
+
+	const usage = "Usage: /unban <telegram_id>"
+	positional, _ := utils.ParseArgs(args)
+	if len(positional) != 1 {
+		return h.sendErrorMessage(message.Chat.ID, usage)
+	}
+	telegramID, err := strconv.ParseInt(positional[0], 10, 64)
+	if err != nil || telegramID <= 0 {
+		return h.sendErrorMessage(message.Chat.ID, usage)
+	}
+
+	// Users who never registered were only banned in memory
+	if err := h.userService.UnbanUser(ctx, telegramID); err != nil && !errors.Is(err, domain.ErrUserNotFound) {
+		h.logger.WithError(err).Error("Failed to unban user")
+		return h.sendErrorMessage(message.Chat.ID, "Failed to unban user. Please try again.")
+	}
+	if h.abuseGuard != nil {
+		h.abuseGuard.Unban(telegramID)
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"admin_id":    message.From.ID,
+		"telegram_id": telegramID,
+	}).Info("User unbanned")
+
+	keyboard := h.createMainKeyboard(h.languageOf(ctx, message.From))
+	return h.sendMessage(message.Chat.ID, utils.EscapeMarkdown(fmt.Sprintf("✅ User %d was unbanned.", telegramID)), keyboard)
+}
+
+// handleAnonymize handles the admin-only /anonymize [--dry-run] command, running the
+// data retention policy immediately instead of waiting for the daily job
+func (h *Handler) handleAnonymize(ctx context.Context, message *tgbotapi.Message, args string) error {
+	if !h.isAdmin(message.From.ID) {
+		return h.handleUnknownCommand(ctx, message)
+	}
+
+	positional, flags := utils.ParseArgs(args)
+	dryRun, err := isDryRun(flags)
+	if err != nil || len(positional) != 0 {
+		return h.sendErrorMessage(message.Chat.ID, "Usage: /anonymize [--dry-run]")
+	}
+	if h.retention == nil || !h.retention.Enabled() {
+		return h.sendErrorMessage(message.Chat.ID, "Data retention is disabled. Set DATA_RETENTION_DAYS to enable it.")
+	}
+
+	keyboard := h.createMainKeyboard(h.languageOf(ctx, message.From))
+	if dryRun {
+		count, err := h.retention.Preview(ctx)
+		if err != nil {
+			h.logger.WithError(err).Error("Failed to preview data retention")
+			return h.sendErrorMessage(message.Chat.ID, "Failed to anonymize users. Please try again.")
+		}
+		return h.sendMessage(message.Chat.ID, utils.EscapeMarkdown(fmt.Sprintf("🧪 Dry run: would anonymize %d inactive users. Nothing was changed.", count)), keyboard)
+	}
+
+	count, err := h.retention.Enforce(ctx)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to enforce data retention")
+		return h.sendErrorMessage(message.Chat.ID, "Failed to anonymize users. Please try again.")
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"admin_id":   message.From.ID,
+		"anonymized": count,
+	}).Info("Inactive users anonymized")
+
+	return h.sendMessage(message.Chat.ID, utils.EscapeMarkdown(fmt.Sprintf("✅ Anonymized %d inactive users.", count)), keyboard)
+}
+
+// dryRunFlag makes destructive admin commands report what they would change without changing it
+const dryRunFlag = "dry-run"
+
+// isDryRun reports whether flags parsed by utils.ParseArgs ask for a dry run.
+// --dry-run=false is accepted for scripts that always pass the flag, and values that are
+// not booleans count as a dry run so a typo never changes data. Any other flag, such as
+// a misspelt --dryrun, is an error for the same reason
+func isDryRun(flags map[string]string) (bool, error) {
+	for key := range flags {
+		if key != dryRunFlag {
+			return false, fmt.Errorf("unknown flag --%s", key)
+		}
+	}
+	value, ok := flags[dryRunFlag]
+	if !ok {
+		return false, nil
+	}
+	dryRun, err := strconv.ParseBool(value)
+	return err != nil || dryRun, nil
+}
+
+// handleUpgrade handles the admin-only /upgrade <telegram_id> <quota> command. The
+// quota is in bytes or uses a KB/MB/GB/TB suffix
+func (h *Handler) handleUpgrade(ctx context.Context, message *tgbotapi.Message, args string) error {
+	if !h.isAdmin(message.From.ID) {
+		return h.handleUnknownCommand(ctx, message)
+	}
+
+	const usage = "Usage: /upgrade <telegram_id> <quota>, e.g. /upgrade 123456 10GB"
+	fields, _ := utils.ParseArgs(args)
+	if len(fields) != 2 {
+		return h.sendErrorMessage(message.Chat.ID, usage)
+	}
+	telegramID, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || telegramID <= 0 {
+		return h.sendErrorMessage(message.Chat.ID, usage)
+	}
+	quotaLimit, err := parseByteSize(fields[1])
+	if err != nil || quotaLimit <= 0 {
+		return h.sendErrorMessage(message.Chat.ID, usage)
+	}
+
+	if err := h.userService.UpgradeUser(ctx, telegramID, quotaLimit); err != nil {
+		switch {
+		case errors.Is(err, domain.ErrUserNotFound):
+			return h.sendErrorMessage(message.Chat.ID, fmt.Sprintf("User %d not found.", telegramID))
+		case errors.Is(err, domain.ErrUserAlreadyActive):
+			return h.sendErrorMessage(message.Chat.ID, fmt.Sprintf("User %d is already active.", telegramID))
+		case errors.Is(err, domain.ErrUserBanned):
+			return h.sendErrorMessage(message.Chat.ID, fmt.Sprintf("User %d is banned.", telegramID))
+		case errors.Is(err, domain.ErrInvalidInput):
+			return h.sendErrorMessage(message.Chat.ID, "The new quota must be larger than the user's current quota.")
+		}
+		h.logger.WithError(err).Error("Failed to upgrade user")
+		return h.sendErrorMessage(message.Chat.ID, "Failed to upgrade user. Please try again.")
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"admin_id":    message.From.ID,
+		"telegram_id": telegramID,
+		"quota_limit": quotaLimit,
+	}).Info("User upgraded")
+
+	keyboard := h.createMainKeyboard(h.languageOf(ctx, message.From))
+	return h.sendMessage(message.Chat.ID, utils.EscapeMarkdown(fmt.Sprintf("✅ User %d upgraded to an active account with %s.", telegramID, formatBytes(quotaLimit))), keyboard)
+}
+
+// byteSizeUnits maps the suffixes accepted by parseByteSize to their multipliers
+var byteSizeUnits = map[string]int64{
+	"":   1,
+	"B":  1,
+	"KB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+	"TB": 1 << 40,
+}
+
+// parseByteSize parses sizes such as "52428800", "50MB" or "10 GB" using binary units
+func parseByteSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	number := strings.TrimRight(s, "KMGTB ")
+	multiplier, ok := byteSizeUnits[strings.TrimSpace(s[len(number):])]
+	if !ok {
+		return 0, fmt.Errorf("unknown size unit in %q", s)
+	}
+	value, err := strconv.ParseInt(number, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", s, err)
+	}
+	if value > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return value * multiplier, nil
+}
+
+// handleSetting handles the admin-only /setting command. Without arguments it lists
+// the stored settings, with "<key> <value>" it updates one
+func (h *Handler) handleSetting(ctx context.Context, message *tgbotapi.Message, args string) error {
+	if !h.isAdmin(message.From.ID) {
+		return h.handleUnknownCommand(ctx, message)
+	}
+	if h.settings == nil {
+		return h.sendErrorMessage(message.Chat.ID, "Runtime settings are not available.")
+	}
+
+	fields, _ := utils.ParseArgs(args)
+	if len(fields) == 0 {
+		values := h.settings.Values()
+		eb := utils.NewEntityBuilder().Text("⚙️ ").Bold("Settings").Text("\n\n")
+		if len(values) == 0 {
+			eb.Text("No settings stored.")
+		}
+		for _, key := range h.settings.Keys() {
+			eb.Text("• ").Code(key).Text(" = " + values[key] + "\n")
+		}
+		return h.sendEntityMessage(message.Chat.ID, eb.String(), eb.Entities(), h.createMainKeyboard(h.languageOf(ctx, message.From)))
+	}
+	if len(fields) != 2 {
+		return h.sendErrorMessage(message.Chat.ID, "Usage: /setting <key> <value>")
+	}
+
+	key, value := fields[0], fields[1]
+	if err := h.settings.Set(ctx, key, value); err != nil {
+		if errors.Is(err, domain.ErrInvalidInput) {
+			return h.sendErrorMessage(message.Chat.ID, fmt.Sprintf("Invalid setting: %v", err))
+		}
+		h.logger.WithError(err).Error("Failed to update setting")
+		return h.sendErrorMessage(message.Chat.ID, "Failed to update setting. Please try again.")
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"admin_id": message.From.ID,
+		"key":      key,
+		"value":    value,
+	}).Info("Setting updated")
+
+	eb := utils.NewEntityBuilder().Text("✅ Setting ").Code(key).Text(" set to ").Code(value)
+	return h.sendEntityMessage(message.Chat.ID, eb.String(), eb.Entities(), h.createMainKeyboard(h.languageOf(ctx, message.From)))
 }
 
-// NewHandler creates a new bot handler
-func NewHandler(botAPI BotAPI, userService domain.UserService, logger *logrus.Logger) *Handler {
-	return &Handler{
-		botAPI:      botAPI,
-		userService: userService,
-		logger:      logger,
-		rateLimiter: NewRateLimiter(),
-		auditLogger: NewAuditLogger(logger),
-		processLock: NewProcessLock(""),
+// handleReportBug handles the /reportbug <description> command. The report is stored
+// with the user's last command, the app version and the last error they saw, then
+// forwarded to the admins
+func (h *Handler) handleReportBug(ctx context.Context, message *tgbotapi.Message, args string) error {
+	lang := h.languageOf(ctx, message.From)
+	if h.bugReports == nil {
+		return h.sendErrorMessage(message.Chat.ID, h.tr.Get(lang, "bugreport.unavailable"))
 	}
-}
 
-// NewHandlerWithEvents creates a new bot handler with event publishing
-func NewHandlerWithEvents(botAPI BotAPI, userService domain.UserService, logger *logrus.Logger, eventService *events.Service) *Handler {
-	return &Handler{
-		botAPI:       botAPI,
-		userService:  userService,
-		logger:       logger,
-		rateLimiter:  NewRateLimiter(),
-		auditLogger:  NewAuditLogger(logger),
-		processLock:  NewProcessLock(""),
-		eventService: eventService,
+	description := strings.TrimSpace(args)
+	if description == "" {
+		return h.sendErrorMessage(message.Chat.ID, h.tr.Get(lang, "bugreport.usage"))
 	}
-}
 
-// HandleUpdate processes incoming Telegram updates
-func (h *Handler) HandleUpdate(ctx context.Context, update tgbotapi.Update) error {
-	if update.Message == nil {
-		return nil
+	report := &domain.BugReport{
+		TelegramID:  message.From.ID,
+		Username:    message.From.UserName,
+		Description: utils.TruncateString(description, maxBugReportLength),
+		LastCommand: h.lastCommand(ctx, message.From.ID),
+		AppVersion:  h.version,
+		LastError:   h.lastError(message.Chat.ID),
+	}
+	if err := h.bugReports.Create(ctx, report); err != nil {
+		h.logger.WithError(err).Error("Failed to save bug report")
+		return h.sendErrorMessage(message.Chat.ID, h.tr.Get(lang, "bugreport.failed"))
 	}
 
-	message := update.Message
 	h.logger.WithFields(logrus.Fields{
-		"chat_id":    message.Chat.ID,
-		"user_id":    message.From.ID,
-		"username":   message.From.UserName,
-		"text":       message.Text,
-		"message_id": message.MessageID,
-	}).Info("Received message")
+		"report_id":   report.ID,
+		"telegram_id": report.TelegramID,
+	}).Info("Bug report submitted")
 
-	// Publish bot message received event
-	if h.eventService != nil {
-		command := message.Command()
-		if err := h.eventService.PublishBotMessageReceived(ctx, message.From.ID, message.From.UserName, message.Chat.ID, message.MessageID, message.Text, command); err != nil {
-			h.logger.WithError(err).Error("Failed to publish bot message received event")
-		}
-	}
+	h.forwardBugReport(report)
 
-	switch message.Text {
-	case "/start":
-		return h.handleStart(ctx, message)
-	case "/account":
-		return h.handleAccount(ctx, message)
-	case "/help":
-		return h.handleHelp(ctx, message)
-	default:
-		return h.handleUnknownCommand(ctx, message)
+	keyboard := h.createMainKeyboard(lang)
+	return h.sendMessage(message.Chat.ID, utils.EscapeMarkdown(h.tr.Get(lang, "bugreport.sent", report.ID)), keyboard)
+}
+
+// lastCommand returns the most recent command before /reportbug, if activity is recorded
+func (h *Handler) lastCommand(ctx context.Context, telegramID int64) string {
+	if h.activityRepo == nil {
+		return ""
+	}
+	records, err := h.activityRepo.ListRecent(ctx, telegramID, 2)
+	if err != nil {
+		h.logger.WithError(err).Warn("Failed to get last command for bug report")
+		return ""
+	}
+	for _, record := range records {
+		if name, _, _ := strings.Cut(record.Command, " "); name != "/reportbug" {
+			return record.Command
+		}
 	}
+	return ""
 }
 
-// HandleCallback handles inline keyboard callbacks
-func (h *Handler) HandleCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) error {
-	h.logger.WithFields(logrus.Fields{
-		"chat_id":    callback.Message.Chat.ID,
-		"user_id":    callback.From.ID,
-		"username":   callback.From.UserName,
-		"data":       callback.Data,
-		"message_id": callback.Message.MessageID,
-	}).Info("Received callback")
+// forwardBugReport sends the report to the admin chat, or to each admin when none is configured
+func (h *Handler) forwardBugReport(report *domain.BugReport) {
+	eb := utils.NewEntityBuilder().
+		Text("🐞 ").Bold(fmt.Sprintf("Bug report #%d", report.ID)).Text("\n\n").
+		Bold("User:").Text(fmt.Sprintf(" %d @%s\n", report.TelegramID, report.Username)).
+		Bold("Version:").Text(" " + report.AppVersion + "\n").
+		Bold("Last command:").Text(" ").Code(report.LastCommand).Text("\n")
+	if report.LastError != "" {
+		eb.Bold("Last error:").Text(" " + report.LastError + "\n")
+	}
+	eb.Text("\n" + report.Description)
 
-	// Publish bot callback received event
-	if h.eventService != nil {
-		if err := h.eventService.PublishBotCallbackReceived(ctx, callback.From.ID, callback.From.UserName, callback.Message.Chat.ID, callback.Message.MessageID, callback.Data); err != nil {
-			h.logger.WithError(err).Error("Failed to publish bot callback received event")
+	recipients := []int64{h.adminChatID}
+	if h.adminChatID == 0 {
+		recipients = recipients[:0]
+		for id := range h.adminIDs {
+			recipients = append(recipients, id)
 		}
 	}
-
-	switch callback.Data {
-	case "trial":
-		return h.handleTrialActivation(ctx, callback)
-	case "account":
-		return h.handleAccountCallback(ctx, callback)
-	case "help":
-		return h.handleHelpCallback(ctx, callback)
-	default:
-		return h.handleUnknownCallback(ctx, callback)
+	for _, chatID := range recipients {
+		msg := tgbotapi.NewMessage(chatID, eb.String())
+		msg.Entities = eb.Entities()
+		if _, err := h.botAPI.Send(msg); err != nil {
+			h.logger.WithError(err).WithField("chat_id", chatID).Error("Failed to forward bug report")
+		}
 	}
 }
 
-// handleStart handles the /start command
-func (h *Handler) handleStart(ctx context.Context, message *tgbotapi.Message) error {
-	user, err := h.userService.RegisterUser(ctx, message.From.ID, message.From.UserName, message.From.FirstName, message.From.LastName)
-	if err != nil {
-		h.logger.WithError(err).Error("Failed to register user")
-		return h.sendErrorMessage(message.Chat.ID, "Failed to register user. Please try again.")
+// recordError remembers the last error message shown in a chat for bug reports
+func (h *Handler) recordError(chatID int64, text string) {
+	h.errorsMu.Lock()
+	defer h.errorsMu.Unlock()
+	if h.lastErrors == nil {
+		h.lastErrors = make(map[int64]string)
 	}
+	h.lastErrors[chatID] = text
+}
+
+// lastError returns the last error message shown in a chat
+func (h *Handler) lastError(chatID int64) string {
+	h.errorsMu.Lock()
+	defer h.errorsMu.Unlock()
+	return h.lastErrors[chatID]
+}
 
-	text := fmt.Sprintf("🎉 Welcome to Arcanus VPN, %s!\n\n"+
-		"🔐 Secure, private, and fast VPN service\n"+
-		"📊 You have %s of free trial data\n\n"+
-		"Choose an option below:",
-		user.FirstName,
-		formatBytes(user.QuotaLimit))
+// handleDeleteAccount handles the /deleteaccount command by asking for confirmation
+func (h *Handler) handleDeleteAccount(ctx context.Context, message *tgbotapi.Message) error {
+	lang := h.languageOf(ctx, message.From)
+	text := "⚠️ *" + utils.EscapeMarkdown(h.tr.Get(lang, "deleteaccount.title")) + "*\n\n" +
+		utils.EscapeMarkdown(h.tr.Get(lang, "deleteaccount.confirm"))
 
-	keyboard := h.createMainKeyboard()
+	keyboard := h.createConfirmationKeyboard(lang, "deleteaccount")
 	return h.sendMessage(message.Chat.ID, text, keyboard)
 }
 
-// handleAccount handles the /account command
-func (h *Handler) handleAccount(ctx context.Context, message *tgbotapi.Message) error {
+// gatewayTimeout bounds how long /test waits for the VPN gateway
+const gatewayTimeout = 5 * time.Second
+
+// handleConnectionTest handles the /test command by checking whether the user's peer
+// ever completed a handshake with the gateway and telling them what to do next
+func (h *Handler) handleConnectionTest(ctx context.Context, message *tgbotapi.Message) error {
+	lang := h.languageOf(ctx, message.From)
+	if h.gateway == nil {
+		return h.sendErrorMessage(message.Chat.ID, h.tr.Get(lang, "test.unavailable"))
+	}
+	if ok, err := h.checkQuota(ctx, message); !ok {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, gatewayTimeout)
+	defer cancel()
+
+	status, err := h.gateway.PeerStatus(ctx, message.From.ID)
+	if errors.Is(err, domain.ErrPeerNotFound) {
+		return h.sendMessage(message.Chat.ID, utils.EscapeMarkdown(h.tr.Get(lang, "test.no_config")), h.createMainKeyboard(lang))
+	}
+	if err != nil {
+		h.logger.WithError(err).WithField("user_id", message.From.ID).Warn("Failed to query VPN gateway")
+		return h.sendErrorMessage(message.Chat.ID, h.tr.Get(lang, "test.unreachable"))
+	}
+
+	var text string
+	if status.HasHandshaked() {
+		text = h.tr.Get(lang, "test.works", time.Since(*status.LastHandshake).Round(time.Second))
+	} else {
+		text = h.tr.Get(lang, "test.no_handshake")
+	}
+	return h.sendMessage(message.Chat.ID, utils.EscapeMarkdown(text), h.createMainKeyboard(lang))
+}
+
+// checkQuota is the pre-check for operations that consume quota. It reports whether the
+// sender may go ahead, replying with requireQuota's prompt or a hint to register when not.
+// Lookup failures let the operation proceed, since it checks the user itself
+func (h *Handler) checkQuota(ctx context.Context, message *tgbotapi.Message) (bool, error) {
+	lang := h.languageOf(ctx, message.From)
 	user, err := h.userService.GetUser(ctx, message.From.ID)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return false, h.sendErrorMessage(message.Chat.ID, h.tr.Get(lang, "register_first"))
+	}
 	if err != nil {
-		h.logger.WithError(err).Error("Failed to get user")
-		return h.sendErrorMessage(message.Chat.ID, "Failed to get account information. Please try again.")
+		h.logger.WithError(err).WithField("user_id", message.From.ID).Warn("Failed to get user for quota pre-check")
+		return true, nil
 	}
 
-	text := h.formatAccountInfo(user)
-	keyboard := h.createMainKeyboard()
-	return h.sendMessage(message.Chat.ID, text, keyboard)
+	text, keyboard, ok := h.requireQuota(user, lang)
+	if ok {
+		return true, nil
+	}
+	return false, h.sendMessage(message.Chat.ID, utils.EscapeMarkdown(text), keyboard)
 }
 
-// handleHelp handles the /help command
-func (h *Handler) handleHelp(ctx context.Context, message *tgbotapi.Message) error {
-	text := `🤖 **Arcanus VPN Bot Help**
+// requireQuota guards operations that consume quota. For users with no quota left it
+// returns ok false with a prompt to top up and buttons for each plan and the account
+func (h *Handler) requireQuota(user *domain.User, lang string) (text string, keyboard tgbotapi.InlineKeyboardMarkup, ok bool) {
+	if user.HasQuotaRemaining() {
+		return "", keyboard, true
+	}
+
+	text = h.tr.Get(lang, "quota.exhausted", formatBytes(user.QuotaLimit)) + "\n\n"
+	kb := utils.NewKeyboardBuilder()
+	if h.plans.Len() == 0 {
+		text += h.tr.Get(lang, "quota.top_up_support")
+	} else {
+		text += h.tr.Get(lang, "quota.top_up_plans")
+		for _, plan := range h.plans.Plans() {
+			kb.AddRow(tgbotapi.NewInlineKeyboardButtonData(h.tr.Get(lang, "plans.choose")+" "+plan.Name, planCallbackPrefix+plan.Name))
+		}
+	}
+	kb.AddRow(tgbotapi.NewInlineKeyboardButtonData(h.tr.Get(lang, "button.account"), "account"))
+	return text, kb.Build(), false
+}
+
+// vpnConfigFileName is the name of the config document sent by /getconfig
+const vpnConfigFileName = "arcanus-vpn.conf"
 
-**Commands:**
-• /start - Register and get started
-• /account - View your account details
-• /help - Show this help message
+// handleGetConfig handles the /getconfig command by sending a newly issued VPN config
+// as a document. Issuing a config replaces the user's earlier one
+func (h *Handler) handleGetConfig(ctx context.Context, message *tgbotapi.Message) error {
+	lang := h.languageOf(ctx, message.From)
+	if h.vpn == nil {
+		return h.sendErrorMessage(message.Chat.ID, h.tr.Get(lang, "config.unavailable"))
+	}
+	if ok, err := h.checkQuota(ctx, message); !ok {
+		return err
+	}
 
-**Features:**
-• 🔐 Secure VPN connection
-• 📊 50MB free trial
-• ⚡ Fast and reliable
-• 🛡️ Privacy-focused
+	config, err := h.vpn.GenerateConfig(ctx, message.From.ID)
+	switch {
+	case errors.Is(err, domain.ErrUserNotFound):
+		return h.sendErrorMessage(message.Chat.ID, h.tr.Get(lang, "register_first"))
+	case errors.Is(err, domain.ErrUserNotActive):
+		return h.sendErrorMessage(message.Chat.ID, h.tr.Get(lang, "config.not_active"))
+	case errors.Is(err, domain.ErrQuotaExceeded):
+		return h.sendErrorMessage(message.Chat.ID, h.tr.Get(lang, "config.quota_exceeded"))
+	case err != nil:
+		h.logger.WithError(err).WithField("user_id", message.From.ID).Error("Failed to generate VPN config")
+		return h.sendErrorMessage(message.Chat.ID, h.tr.Get(lang, "config.failed"))
+	}
 
-**Support:**
-For technical support, contact @support`
+	return h.sendDocument(message.Chat.ID, vpnConfigFileName, []byte(config.Render()), h.tr.Get(lang, "config.caption"))
+}
 
-	keyboard := h.createMainKeyboard()
-	return h.sendMessage(message.Chat.ID, text, keyboard)
+// handlePlans handles the /plans command by listing the configured plans with a
+// "Choose" button per plan
+func (h *Handler) handlePlans(ctx context.Context, message *tgbotapi.Message) error {
+	lang := h.languageOf(ctx, message.From)
+	if h.plans.Len() == 0 {
+		return h.sendMessage(message.Chat.ID, utils.EscapeMarkdown(h.tr.Get(lang, "plans.none")), h.createMainKeyboard(lang))
+	}
+
+	eb := utils.NewEntityBuilder().Text("💎 ").Bold(h.tr.Get(lang, "plans.title")).Text("\n")
+	keyboard := utils.NewKeyboardBuilder()
+	for _, plan := range h.plans.Plans() {
+		eb.Text("\n").Bold(plan.Name).Text("\n").
+			Text(fmt.Sprintf("%s: %s\n%s: %s\n", h.tr.Get(lang, "plans.quota"), formatBytes(plan.QuotaLimit), h.tr.Get(lang, "plans.price"), formatPrice(plan)))
+		keyboard.AddRow(tgbotapi.NewInlineKeyboardButtonData(h.tr.Get(lang, "plans.choose")+" "+plan.Name, planCallbackPrefix+plan.Name))
+	}
+
+	return h.sendEntityMessage(message.Chat.ID, eb.String(), eb.Entities(), keyboard.Build())
+}
+
+// handleChoosePlan handles the "Choose" button of a plan listed by /plans by sending
+// an invoice for the plan. Its payload names the plan, which the payment then applies
+func (h *Handler) handleChoosePlan(ctx context.Context, callback *tgbotapi.CallbackQuery, name string) error {
+	plan, ok := h.plans.Get(name)
+	if !ok || callback.Message == nil {
+		return h.handleUnknownCallback(ctx, callback)
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"user_id": callback.From.ID,
+		"plan":    plan.Name,
+	}).Info("User chose a plan")
+
+	lang := h.languageOf(ctx, callback.From)
+	invoice := tgbotapi.NewInvoice(
+		callback.Message.Chat.ID,
+		plan.Name,
+		h.tr.Get(lang, "plans.invoice_description", formatBytes(plan.QuotaLimit)),
+		plan.Name,
+		h.providerToken,
+		"",
+		strings.ToUpper(plan.Currency),
+		[]tgbotapi.LabeledPrice{{Label: plan.Name, Amount: plan.InvoiceAmount()}},
+	)
+	// The library sends a missing tip list as null, which Telegram rejects
+	invoice.SuggestedTipAmounts = []int{}
+	if _, err := h.botAPI.Send(invoice); err != nil {
+		h.logger.WithError(err).WithFields(logrus.Fields{
+			"user_id": callback.From.ID,
+			"plan":    plan.Name,
+		}).Error("Failed to send invoice")
+		return h.answerCallback(callback.ID, h.tr.Get(lang, "plans.invoice_failed"))
+	}
+
+	return h.answerCallback(callback.ID, h.tr.Get(lang, "plans.selected", plan.Name))
+}
+
+// HandlePreCheckoutQuery confirms or rejects a checkout. Telegram only charges the user
+// once the query is answered, so it is confirmed only when the invoice is still for a
+// configured plan at its current price and the user may pay for it
+func (h *Handler) HandlePreCheckoutQuery(ctx context.Context, query *tgbotapi.PreCheckoutQuery) error {
+	if query == nil || query.From == nil {
+		return nil
+	}
+
+	reason := h.checkoutRejection(ctx, query)
+	answer := tgbotapi.PreCheckoutConfig{PreCheckoutQueryID: query.ID, OK: reason == ""}
+	fields := logrus.Fields{
+		"user_id":  query.From.ID,
+		"plan":     query.InvoicePayload,
+		"amount":   query.TotalAmount,
+		"currency": query.Currency,
+	}
+	if reason != "" {
+		answer.ErrorMessage = h.tr.Get(h.languageOf(ctx, query.From), "plans.checkout_rejected")
+		h.logger.WithFields(fields).WithField("reason", reason).Warn("Rejected checkout")
+	}
+
+	if _, err := h.botAPI.Request(answer); err != nil {
+		h.logger.WithError(err).WithFields(fields).Error("Failed to answer pre-checkout query")
+		return fmt.Errorf("failed to answer pre-checkout query: %w", err)
+	}
+	return nil
+}
+
+// checkoutRejection returns why a checkout must be rejected, or "" to confirm it
+func (h *Handler) checkoutRejection(ctx context.Context, query *tgbotapi.PreCheckoutQuery) string {
+	if h.payments == nil {
+		return "payments are not configured"
+	}
+	plan, ok := h.plans.Get(query.InvoicePayload)
+	if !ok {
+		return "unknown plan"
+	}
+	if !strings.EqualFold(query.Currency, plan.Currency) || query.TotalAmount != plan.InvoiceAmount() {
+		return "price changed"
+	}
+	user, err := h.userService.GetUser(ctx, query.From.ID)
+	if err != nil {
+		return "user not found"
+	}
+	if user.IsBanned() || user.IsDeleted() {
+		return "user may not pay"
+	}
+	return ""
+}
+
+// handleSuccessfulPayment applies the plan named by the invoice payload. Telegram may
+// deliver the same payment more than once; repeats are ignored
+func (h *Handler) handleSuccessfulPayment(ctx context.Context, message *tgbotapi.Message) error {
+	if h.payments == nil {
+		h.logger.WithField("user_id", message.From.ID).Error("Received a payment but payments are not configured")
+		return nil
+	}
+
+	lang := h.languageOf(ctx, message.From)
+	paid := message.SuccessfulPayment
+	chargeID := paid.ProviderPaymentChargeID
+	if chargeID == "" {
+		// Payments in Telegram Stars have no provider charge
+		chargeID = paid.TelegramPaymentChargeID
+	}
+	user, err := h.payments.ProcessPayment(ctx, &domain.Payment{
+		TelegramID:       message.From.ID,
+		PlanName:         paid.InvoicePayload,
+		TotalAmount:      paid.TotalAmount,
+		Currency:         paid.Currency,
+		ProviderChargeID: chargeID,
+		TelegramChargeID: paid.TelegramPaymentChargeID,
+	})
+	if errors.Is(err, domain.ErrPaymentAlreadyProcessed) {
+		h.logger.WithFields(logrus.Fields{
+			"user_id":   message.From.ID,
+			"charge_id": chargeID,
+		}).Info("Ignoring already processed payment")
+		return nil
+	}
+	if err != nil {
+		h.logger.WithError(err).WithFields(logrus.Fields{
+			"user_id":   message.From.ID,
+			"charge_id": chargeID,
+		}).Error("Failed to process payment")
+		return h.sendErrorMessage(message.Chat.ID, h.tr.Get(lang, "payment.failed"))
+	}
+
+	text := utils.EscapeMarkdown(h.tr.Get(lang, "payment.received", paid.InvoicePayload, formatBytes(user.QuotaLimit)))
+	return h.sendMessage(message.Chat.ID, text, h.createMainKeyboard(lang))
+}
+
+// formatPrice formats a plan price with its currency
+func formatPrice(plan domain.Plan) string {
+	return strings.TrimSpace(fmt.Sprintf("%.2f %s", plan.Price, plan.Currency))
 }
 
 // handleUnknownCommand handles unknown commands
 func (h *Handler) handleUnknownCommand(ctx context.Context, message *tgbotapi.Message) error {
-	text := "❓ Unknown command. Use /help to see available commands."
-	keyboard := h.createMainKeyboard()
+	lang := h.languageOf(ctx, message.From)
+	text := utils.EscapeMarkdown(h.tr.Get(lang, "unknown_command"))
+	keyboard := h.createMainKeyboard(lang)
 	return h.sendMessage(message.Chat.ID, text, keyboard)
 }
 
 // handleTrialActivation handles trial activation callback
 func (h *Handler) handleTrialActivation(ctx context.Context, callback *tgbotapi.CallbackQuery) error {
+	lang := h.languageOf(ctx, callback.From)
 	err := h.userService.ActivateTrial(ctx, callback.From.ID)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to activate trial")
-		return h.answerCallback(callback.ID, "❌ Failed to activate trial. Please try again.")
+		return h.answerCallback(callback.ID, h.tr.Get(lang, "trial.failed"))
 	}
 
 	user, err := h.userService.GetUser(ctx, callback.From.ID)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to get user after trial activation")
-		return h.answerCallback(callback.ID, "✅ Trial activated! But failed to get account details.")
+		return h.answerCallback(callback.ID, h.tr.Get(lang, "trial.account_failed"))
 	}
 
-	text := fmt.Sprintf("🎉 **Trial Activated!**\n\n"+
-		"Your account is now active with %s of data.\n"+
-		"Enjoy secure browsing!",
-		formatBytes(user.QuotaLimit))
+	text := "🎉 *" + utils.EscapeMarkdown(h.tr.Get(lang, "trial.activated_title")) + "*\n\n" +
+		utils.EscapeMarkdown(h.tr.Get(lang, "trial.activated", formatBytes(user.QuotaLimit)))
 
-	keyboard := h.createMainKeyboard()
+	keyboard := h.createMainKeyboard(lang)
 	return h.editMessage(callback.Message.Chat.ID, callback.Message.MessageID, text, keyboard)
 }
 
 // handleAccountCallback handles account callback
 func (h *Handler) handleAccountCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) error {
-	user, err := h.userService.GetUser(ctx, callback.From.ID)
+	user, err := h.userService.GetUserSnapshot(ctx, callback.From.ID)
 	if err != nil {
 		h.logger.WithError(err).Error("Failed to get user")
-		return h.answerCallback(callback.ID, "❌ Failed to get account information.")
+		return h.answerCallback(callback.ID, "❌ "+h.tr.Get(h.languageOf(ctx, callback.From), "account.failed"))
 	}
+	ctx = withStoredLanguage(ctx, user.TelegramID, user.LanguageCode)
 
-	text := h.formatAccountInfo(user)
-	keyboard := h.createMainKeyboard()
-	return h.editMessage(callback.Message.Chat.ID, callback.Message.MessageID, text, keyboard)
+	text, entities := h.formatAccountInfo(user, h.languageOf(ctx, callback.From))
+	keyboard := h.createMainKeyboard(h.languageOf(ctx, callback.From))
+	return h.editEntityMessage(callback.Message.Chat.ID, callback.Message.MessageID, text, entities, keyboard)
 }
 
 // handleHelpCallback handles help callback
 func (h *Handler) handleHelpCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) error {
-	text := `🤖 **Arcanus VPN Bot Help**
+	lang := h.languageOf(ctx, callback.From)
+	text := h.helpRenderer.Render(h.tr, lang)
 
-**Commands:**
-• /start - Register and get started
-• /account - View your account details
-• /help - Show this help message
+	keyboard := h.createMainKeyboard(lang)
+	return h.editMessage(callback.Message.Chat.ID, callback.Message.MessageID, text, keyboard)
+}
+
+// handleDeleteAccountConfirm deletes the user's account after confirmation
+func (h *Handler) handleDeleteAccountConfirm(ctx context.Context, callback *tgbotapi.CallbackQuery) error {
+	lang := h.languageOf(ctx, callback.From)
+	err := h.userService.DeleteUser(ctx, callback.From.ID)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to delete user")
+		return h.answerCallback(callback.ID, h.tr.Get(lang, "deleteaccount.failed"))
+	}
 
-**Features:**
-• 🔐 Secure VPN connection
-• 📊 50MB free trial
-• ⚡ Fast and reliable
-• 🛡️ Privacy-focused
+	text := "🗑️ *" + utils.EscapeMarkdown(h.tr.Get(lang, "deleteaccount.deleted_title")) + "*\n\n" +
+		utils.EscapeMarkdown(h.tr.Get(lang, "deleteaccount.deleted"))
 
-**Support:**
-For technical support, contact @support`
+	return h.editMessage(callback.Message.Chat.ID, callback.Message.MessageID, text, utils.CreateEmptyKeyboard())
+}
 
-	keyboard := h.createMainKeyboard()
+// handleDeleteAccountCancel handles cancellation of account deletion
+func (h *Handler) handleDeleteAccountCancel(ctx context.Context, callback *tgbotapi.CallbackQuery) error {
+	lang := h.languageOf(ctx, callback.From)
+	text := utils.EscapeMarkdown(h.tr.Get(lang, "deleteaccount.cancelled"))
+	keyboard := h.createMainKeyboard(lang)
 	return h.editMessage(callback.Message.Chat.ID, callback.Message.MessageID, text, keyboard)
 }
 
 // handleUnknownCallback handles unknown callbacks
 func (h *Handler) handleUnknownCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) error {
-	return h.answerCallback(callback.ID, "❓ Unknown action. Please try again.")
+	return h.answerCallback(callback.ID, h.tr.Get(h.languageOf(ctx, callback.From), "unknown_action"))
+}
+
+// telegramLanguage returns the language set in the Telegram app of user
+func telegramLanguage(user *tgbotapi.User) string {
+	if user == nil {
+		return i18n.DefaultLanguage
+	}
+	return user.LanguageCode
+}
+
+// storedLanguageKey is the context key holding the language stored for the sender of
+// the update being handled
+type storedLanguageKey struct{}
+
+// storedLanguage is the language stored for a user, as chosen with /language
+type storedLanguage struct {
+	telegramID int64
+	code       string
+}
+
+// withStoredLanguage returns a context carrying the language stored for the user.
+// An empty code leaves the context unchanged
+func withStoredLanguage(ctx context.Context, telegramID int64, code string) context.Context {
+	if code == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, storedLanguageKey{}, storedLanguage{telegramID: telegramID, code: code})
+}
+
+// WithSender loads the stored account of the user who sent an update and returns a
+// context carrying their stored language, so replies use the language they chose.
+// Unregistered users and failed lookups leave the context unchanged
+func (h *Handler) WithSender(ctx context.Context, from *tgbotapi.User) context.Context {
+	if from == nil {
+		return ctx
+	}
+	user, err := h.userService.GetUser(ctx, from.ID)
+	if err != nil {
+		if !errors.Is(err, domain.ErrUserNotFound) {
+			h.logger.WithError(err).WithField("user_id", from.ID).Warn("Failed to load user language")
+		}
+		return ctx
+	}
+	return withStoredLanguage(ctx, user.TelegramID, user.LanguageCode)
+}
+
+// languageOf returns the language replies to user are written in: the language stored
+// for them, as chosen with /language, when the context carries it, else their Telegram language
+func (h *Handler) languageOf(ctx context.Context, user *tgbotapi.User) string {
+	if user == nil {
+		return i18n.DefaultLanguage
+	}
+	if stored, ok := ctx.Value(storedLanguageKey{}).(storedLanguage); ok && stored.telegramID == user.ID {
+		return stored.code
+	}
+	return telegramLanguage(user)
+}
+
+// handleLanguage handles the /language command by offering the supported languages
+func (h *Handler) handleLanguage(ctx context.Context, message *tgbotapi.Message) error {
+	keyboard := utils.NewKeyboardBuilder()
+	for _, code := range h.tr.Languages() {
+		keyboard.AddRow(tgbotapi.NewInlineKeyboardButtonData(h.tr.Get(code, "language.name"), languageCallbackPrefix+code))
+	}
+	return h.sendMessage(message.Chat.ID, utils.EscapeMarkdown(h.tr.Get(h.languageOf(ctx, message.From), "language.choose")), keyboard.Build())
+}
+
+// handleChooseLanguage stores the language picked from the /language keyboard. Callback
+// data can be forged, so codes without a catalog are rejected
+func (h *Handler) handleChooseLanguage(ctx context.Context, callback *tgbotapi.CallbackQuery, code string) error {
+	lang := h.languageOf(ctx, callback.From)
+	if code != i18n.Normalize(code) || !h.tr.Supports(code) {
+		return h.answerCallback(callback.ID, h.tr.Get(lang, "language.unsupported"))
+	}
+
+	if err := h.userService.SetLanguage(ctx, callback.From.ID, code); err != nil {
+		h.logger.WithError(err).Error("Failed to set user language")
+		return h.answerCallback(callback.ID, h.tr.Get(lang, "language.failed"))
+	}
+
+	return h.editMessage(callback.Message.Chat.ID, callback.Message.MessageID, utils.EscapeMarkdown(h.tr.Get(code, "language.changed")), h.createMainKeyboard(code))
+}
+
+// handleAlertAt handles the /alertat <pct|off> command setting the usage percentage
+// the user is alerted at
+func (h *Handler) handleAlertAt(ctx context.Context, message *tgbotapi.Message, args string) error {
+	lang := h.languageOf(ctx, message.From)
+
+	pct := 0
+	if arg := strings.TrimSpace(args); !strings.EqualFold(arg, "off") {
+		parsed, err := strconv.Atoi(strings.TrimSuffix(arg, "%"))
+		if err != nil || parsed < domain.MinAlertThresholdPct || parsed > domain.MaxAlertThresholdPct {
+			return h.sendErrorMessage(message.Chat.ID, h.tr.Get(lang, "alert.usage", domain.MinAlertThresholdPct, domain.MaxAlertThresholdPct))
+		}
+		pct = parsed
+	}
+
+	if err := h.userService.SetAlertThreshold(ctx, message.From.ID, pct); err != nil {
+		h.logger.WithError(err).Error("Failed to set alert threshold")
+		return h.sendErrorMessage(message.Chat.ID, h.tr.Get(lang, "alert.failed"))
+	}
+
+	text := h.tr.Get(lang, "alert.reset")
+	if pct > 0 {
+		text = h.tr.Get(lang, "alert.set", pct)
+	}
+	return h.sendMessage(message.Chat.ID, utils.EscapeMarkdown(text), h.createMainKeyboard(lang))
+}
+
+// handleTimezone handles the /timezone <name|off> command setting the IANA timezone
+// the user's quiet hours are kept in
+func (h *Handler) handleTimezone(ctx context.Context, message *tgbotapi.Message, args string) error {
+	lang := h.languageOf(ctx, message.From)
+
+	name := strings.TrimSpace(args)
+	if strings.EqualFold(name, "off") {
+		name = ""
+	} else if domain.LoadTimezone(name) == nil {
+		return h.sendErrorMessage(message.Chat.ID, h.tr.Get(lang, "timezone.usage"))
+	}
+
+	if err := h.userService.SetTimezone(ctx, message.From.ID, name); err != nil {
+		h.logger.WithError(err).Error("Failed to set timezone")
+		return h.sendErrorMessage(message.Chat.ID, h.tr.Get(lang, "timezone.failed"))
+	}
+
+	text := h.tr.Get(lang, "timezone.reset")
+	if name != "" {
+		text = h.tr.Get(lang, "timezone.set", name)
+	}
+	return h.sendMessage(message.Chat.ID, utils.EscapeMarkdown(text), h.createMainKeyboard(lang))
 }
 
-// createMainKeyboard creates the main inline keyboard
-func (h *Handler) createMainKeyboard() tgbotapi.InlineKeyboardMarkup {
+// createMainKeyboard creates the main inline keyboard in lang
+func (h *Handler) createMainKeyboard(lang string) tgbotapi.InlineKeyboardMarkup {
 	return tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("🔑 Get Free Trial", "trial"),
-			tgbotapi.NewInlineKeyboardButtonData("⚙️ My Account", "account"),
+			tgbotapi.NewInlineKeyboardButtonData(h.tr.Get(lang, "button.trial"), "trial"),
+			tgbotapi.NewInlineKeyboardButtonData(h.tr.Get(lang, "button.account"), "account"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(h.tr.Get(lang, "button.help"), "help"),
 		),
+	)
+}
+
+// createConfirmationKeyboard creates the keyboard confirming or cancelling action in lang
+func (h *Handler) createConfirmationKeyboard(lang, action string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("❓ Help", "help"),
+			tgbotapi.NewInlineKeyboardButtonData(h.tr.Get(lang, "button.yes"), "confirm_"+action),
+			tgbotapi.NewInlineKeyboardButtonData(h.tr.Get(lang, "button.no"), "cancel_"+action),
 		),
 	)
 }
 
-// formatAccountInfo formats user account information
-func (h *Handler) formatAccountInfo(user *domain.User) string {
-	status := "🔴 Inactive"
-	if user.IsActive() {
-		status = "🟢 Active"
+// formatAccountInfo formats user account information in lang as plain text with
+// entities so that user-provided names are never interpreted as markup
+func (h *Handler) formatAccountInfo(user *domain.UserSnapshot, lang string) (string, []tgbotapi.MessageEntity) {
+	status := h.tr.Get(lang, "status.inactive")
+	if user.Active {
+		status = h.tr.Get(lang, "status.active")
+	} else if user.Expired {
+		status = h.tr.Get(lang, "status.expired")
+	}
+
+	username := h.tr.Get(lang, "account.no_username")
+	if user.Username != "" {
+		username = "@" + user.Username
 	}
 
-	// Escape underscores in username for Markdown
-	escapedUsername := strings.ReplaceAll(user.Username, "_", "\\_")
+	eb := utils.NewEntityBuilder().
+		Text("📊 ").Bold(h.tr.Get(lang, "account.title")).Text("\n\n").
+		Text("👤 ").Bold(h.tr.Get(lang, "account.name")).Text(" " + strings.TrimSpace(user.FirstName+" "+user.LastName) + "\n").
+		Text("🆔 ").Bold(h.tr.Get(lang, "account.username")).Text(" " + username + "\n").
+		Text("📈 ").Bold(h.tr.Get(lang, "account.status")).Text(" " + status + "\n").
+		Text("💾 ").Bold(h.tr.Get(lang, "account.data_limit")).Text(" " + formatBytes(user.QuotaLimit) + "\n").
+		Text("📊 ").Bold(h.tr.Get(lang, "account.data_used")).Text(" " + formatBytes(user.QuotaUsed) + "\n").
+		Text("📋 ").Bold(h.tr.Get(lang, "account.data_remaining")).Text(" " + formatBytes(user.QuotaRemaining) + "\n").
+		Text("📅 ").Bold(h.tr.Get(lang, "account.member_since")).Text(" " + user.CreatedAt.Format("Jan 2, 2006"))
+	if user.ExpiresAt != nil {
+		eb.Text("\n⏳ ").Bold(h.tr.Get(lang, "account.expires")).Text(" " + user.ExpiresAt.Format("Jan 2, 2006 15:04 MST"))
+	}
+	if user.ReferralCode != "" {
+		eb.Text("\n🎁 ").Bold(h.tr.Get(lang, "account.referral_code")).Text(" ").Code(user.ReferralCode)
+	}
 
-	return fmt.Sprintf("📊 **Account Information**\n\n"+
-		"👤 **Name:** %s %s\n"+
-		"🆔 **Username:** @%s\n"+
-		"📈 **Status:** %s\n"+
-		"💾 **Data Limit:** %s\n"+
-		"📊 **Data Used:** %s\n"+
-		"📋 **Data Remaining:** %s\n"+
-		"📅 **Member Since:** %s",
-		user.FirstName, user.LastName,
-		escapedUsername,
-		status,
-		formatBytes(user.QuotaLimit),
-		formatBytes(user.QuotaUsed),
-		formatBytes(user.GetQuotaRemaining()),
-		user.CreatedAt.Format("Jan 2, 2006"))
+	return eb.String(), eb.Entities()
 }
 
 // formatBytes formats bytes into human readable format
@@ -298,10 +1907,41 @@ func formatBytes(bytes int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
 
-// sendMessage sends a message with optional keyboard
+// sendMessage sends MarkdownV2 text with optional keyboard; dynamic values in text
+// must be escaped with utils.EscapeMarkdown. Text longer than Telegram's limit is
+// sent as several messages, with the keyboard on the last one
 func (h *Handler) sendMessage(chatID int64, text string, keyboard tgbotapi.InlineKeyboardMarkup) error {
+	chunks := utils.SplitMessage(text, utils.MaxMessageLength)
+	for i, chunk := range chunks {
+		msg := tgbotapi.NewMessage(chatID, chunk)
+		msg.ParseMode = "MarkdownV2"
+		if i == len(chunks)-1 {
+			msg.ReplyMarkup = keyboard
+		}
+
+		_, err := h.botAPI.Send(msg)
+		if err != nil {
+			h.logger.WithError(err).WithFields(logrus.Fields{
+				"chat_id": chatID,
+				"text":    chunk,
+			}).Error("Failed to send message")
+			h.markBlockedOn(chatID, err)
+			return fmt.Errorf("failed to send message: %w", err)
+		}
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"chat_id": chatID,
+		"text":    text,
+	}).Info("Message sent successfully")
+
+	return nil
+}
+
+// sendEntityMessage sends a message formatted with entities instead of a parse mode
+func (h *Handler) sendEntityMessage(chatID int64, text string, entities []tgbotapi.MessageEntity, keyboard tgbotapi.InlineKeyboardMarkup) error {
 	msg := tgbotapi.NewMessage(chatID, text)
-	msg.ParseMode = "Markdown"
+	msg.Entities = entities
 	msg.ReplyMarkup = keyboard
 
 	_, err := h.botAPI.Send(msg)
@@ -310,6 +1950,7 @@ func (h *Handler) sendMessage(chatID int64, text string, keyboard tgbotapi.Inlin
 			"chat_id": chatID,
 			"text":    text,
 		}).Error("Failed to send message")
+		h.markBlockedOn(chatID, err)
 		return fmt.Errorf("failed to send message: %w", err)
 	}
 
@@ -321,10 +1962,36 @@ func (h *Handler) sendMessage(chatID int64, text string, keyboard tgbotapi.Inlin
 	return nil
 }
 
-// sendErrorMessage sends an error message
+// sendDocument sends data as a file named name
+func (h *Handler) sendDocument(chatID int64, name string, data []byte, caption string) error {
+	document := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: name, Bytes: data})
+	document.Caption = caption
+
+	_, err := h.botAPI.Send(document)
+	if err != nil {
+		h.logger.WithError(err).WithFields(logrus.Fields{
+			"chat_id":  chatID,
+			"document": name,
+		}).Error("Failed to send document")
+		h.markBlockedOn(chatID, err)
+		return fmt.Errorf("failed to send document: %w", err)
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"chat_id":  chatID,
+		"document": name,
+		"size":     len(data),
+	}).Info("Document sent successfully")
+
+	return nil
+}
+
+// sendErrorMessage sends an error message. The text is plain and escaped for MarkdownV2
 func (h *Handler) sendErrorMessage(chatID int64, text string) error {
-	msg := tgbotapi.NewMessage(chatID, text)
-	msg.ParseMode = "Markdown"
+	h.recordError(chatID, text)
+
+	msg := tgbotapi.NewMessage(chatID, utils.EscapeMarkdown(text))
+	msg.ParseMode = "MarkdownV2"
 
 	_, err := h.botAPI.Send(msg)
 	if err != nil {
@@ -332,6 +1999,7 @@ func (h *Handler) sendErrorMessage(chatID int64, text string) error {
 			"chat_id": chatID,
 			"text":    text,
 		}).Error("Failed to send error message")
+		h.markBlockedOn(chatID, err)
 		return fmt.Errorf("failed to send error message: %w", err)
 	}
 
@@ -343,10 +2011,48 @@ func (h *Handler) sendErrorMessage(chatID int64, text string) error {
 	return nil
 }
 
-// editMessage edits an existing message
+// markBlockedOn records that the user blocked the bot when err says so. Only private
+// chats can be blocked, and their ID is the user's Telegram ID
+func (h *Handler) markBlockedOn(chatID int64, err error) {
+	if !isBotBlocked(err) {
+		return
+	}
+	if err := h.userService.MarkBlocked(context.Background(), chatID); err != nil {
+		h.logger.WithError(err).WithField("user_id", chatID).Error("Failed to mark user blocked")
+		return
+	}
+	h.logger.WithField("user_id", chatID).Info("User blocked the bot")
+}
+
+// editMessage edits an existing message to MarkdownV2 text
 func (h *Handler) editMessage(chatID int64, messageID int, text string, keyboard tgbotapi.InlineKeyboardMarkup) error {
 	edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
-	edit.ParseMode = "Markdown"
+	edit.ParseMode = "MarkdownV2"
+	edit.ReplyMarkup = &keyboard
+
+	_, err := h.botAPI.Send(edit)
+	if err != nil {
+		h.logger.WithError(err).WithFields(logrus.Fields{
+			"chat_id":    chatID,
+			"message_id": messageID,
+			"text":       text,
+		}).Error("Failed to edit message")
+		return fmt.Errorf("failed to edit message: %w", err)
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"chat_id":    chatID,
+		"message_id": messageID,
+		"text":       text,
+	}).Info("Message edited successfully")
+
+	return nil
+}
+
+// editEntityMessage edits an existing message using entities instead of a parse mode
+func (h *Handler) editEntityMessage(chatID int64, messageID int, text string, entities []tgbotapi.MessageEntity, keyboard tgbotapi.InlineKeyboardMarkup) error {
+	edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	edit.Entities = entities
 	edit.ReplyMarkup = &keyboard
 
 	_, err := h.botAPI.Send(edit)
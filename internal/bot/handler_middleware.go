@@ -2,23 +2,39 @@ package bot
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sirupsen/logrus"
 	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/events"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/i18n"
 	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/middleware"
-	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/utils"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/session"
 )
 
-// HandlerWithMiddleware is a bot handler that uses middleware
+// HandlerWithMiddleware runs a Handler behind the middleware chain used in
+// production: logging, deduplication, metrics, panic recovery, timeouts, rate
+// limiting, auditing and conversational sessions. Commands and callbacks are
+// handled by the wrapped Handler, so both paths serve the same commands
 type HandlerWithMiddleware struct {
-	botAPI         BotAPI
-	userService    domain.UserService
-	logger         *logrus.Logger
-	messageHandler middleware.HandlerFunc
+	handler         *Handler
+	botAPI          BotAPI
+	userService     domain.UserService
+	logger          *logrus.Logger
+	messageHandler  middleware.HandlerFunc
 	callbackHandler middleware.HandlerFunc
+	abuseGuard      *AbuseGuard
+	adminIDs        []int64
+	metrics         middleware.MetricsRecorder
+	sessionStore    session.SessionStore
+}
+
+// nonCriticalSender is implemented by bot APIs that can defer sends during a flood-wait cool down
+type nonCriticalSender interface {
+	SendNonCritical(c tgbotapi.Chattable) error
 }
 
 // NewHandlerWithMiddleware creates a new middleware-aware handler
@@ -26,312 +42,290 @@ func NewHandlerWithMiddleware(
 	botAPI BotAPI,
 	userService domain.UserService,
 	logger *logrus.Logger,
-	rateLimiter *RateLimiter,
+	rateLimiter middleware.RateLimiter,
+	auditLogger *AuditLogger,
+) *HandlerWithMiddleware {
+	return NewHandlerWithMiddlewareAndEvents(botAPI, userService, logger, rateLimiter, auditLogger, nil)
+}
+
+// updateDedupWindow is how long processed updates are remembered to drop redeliveries
+const updateDedupWindow = 10 * time.Minute
+
+// NewHandlerWithMiddlewareAndEvents creates a new middleware-aware handler that
+// publishes an event whenever a request is rate limited. Any middleware.RateLimiter
+// works, such as RateLimiter, TokenBucketRateLimiter or RedisRateLimiter
+func NewHandlerWithMiddlewareAndEvents(
+	botAPI BotAPI,
+	userService domain.UserService,
+	logger *logrus.Logger,
+	rateLimiter middleware.RateLimiter,
 	auditLogger *AuditLogger,
+	eventService *events.Service,
 ) *HandlerWithMiddleware {
+	return WrapHandler(NewHandlerWithEvents(botAPI, userService, logger, eventService), rateLimiter, auditLogger)
+}
+
+// WrapHandler runs handler behind the middleware chain. The handler keeps its own
+// configuration, such as admins, plans and payments
+func WrapHandler(handler *Handler, rateLimiter middleware.RateLimiter, auditLogger *AuditLogger) *HandlerWithMiddleware {
 	h := &HandlerWithMiddleware{
-		botAPI:      botAPI,
-		userService: userService,
-		logger:      logger,
+		handler:      handler,
+		botAPI:       handler.botAPI,
+		userService:  handler.userService,
+		logger:       handler.logger,
+		sessionStore: session.NewMemoryStore(session.DefaultTTL),
 	}
 
 	// Create middleware
-	rateLimiterAdapter := NewRateLimiterAdapter(rateLimiter)
 	auditLoggerAdapter := NewAuditLoggerAdapter(auditLogger)
+	dedup := middleware.Dedup(updateDedupWindow)
+	rateLimit := middleware.RateLimit(rateLimiter)
+	if handler.eventService != nil {
+		rateLimit = middleware.RateLimitWithEvents(rateLimiter, handler.eventService)
+	}
+	sessionState := middleware.SessionState(&sessionStoreAdapter{handler: h}, h.logger)
+	maintenance := middleware.Maintenance(&maintenanceAdapter{handler: handler}, handler.isAdmin, h.replyUnderMaintenance)
 
 	// Chain middleware for message handling
 	h.messageHandler = middleware.Chain(
 		h.handleMessageWithMiddleware,
-		middleware.Logger(logger),
-		middleware.Recovery(logger),
+		middleware.Logger(h.logger),
+		dedup,
+		middleware.Metrics(h),
+		middleware.Recovery(h.logger),
 		middleware.Timeout(30*time.Second),
-		middleware.RateLimit(rateLimiterAdapter),
+		rateLimit,
+		maintenance,
 		middleware.Audit(auditLoggerAdapter),
+		sessionState,
 	)
 
 	// Chain middleware for callback handling
 	h.callbackHandler = middleware.Chain(
 		h.handleCallbackWithMiddleware,
-		middleware.Logger(logger),
-		middleware.Recovery(logger),
+		middleware.Logger(h.logger),
+		dedup,
+		middleware.Metrics(h),
+		middleware.Recovery(h.logger),
 		middleware.Timeout(30*time.Second),
-		middleware.RateLimit(rateLimiterAdapter),
+		rateLimit,
+		maintenance,
 		middleware.Audit(auditLoggerAdapter),
+		sessionState,
 	)
 
 	return h
 }
 
-// HandleUpdate handles incoming Telegram updates using middleware
-func (h *HandlerWithMiddleware) HandleUpdate(ctx context.Context, update tgbotapi.Update) error {
-	if update.Message != nil {
-		requestData := middleware.NewRequestDataFromUpdate(&update)
-		return h.messageHandler(ctx, requestData)
-	}
-	return nil
+// SetHelpRenderer configures the renderer used for help text
+func (h *HandlerWithMiddleware) SetHelpRenderer(renderer *HelpRenderer) {
+	h.handler.SetHelpRenderer(renderer)
 }
 
-// HandleCallback handles callback queries using middleware
-func (h *HandlerWithMiddleware) HandleCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) error {
-	update := &tgbotapi.Update{CallbackQuery: callback}
-	requestData := middleware.NewRequestDataFromUpdate(update)
-	return h.callbackHandler(ctx, requestData)
+// SetTranslator configures the message catalogs used for user-facing replies
+func (h *HandlerWithMiddleware) SetTranslator(tr *i18n.Translator) {
+	h.handler.SetTranslator(tr)
 }
 
-// handleMessageWithMiddleware is the actual message handler used by middleware
-func (h *HandlerWithMiddleware) handleMessageWithMiddleware(ctx context.Context, data interface{}) error {
-	requestData, ok := data.(*middleware.RequestData)
-	if !ok {
-		return fmt.Errorf("invalid request data type")
-	}
-
-	if requestData.Message == nil {
-		return fmt.Errorf("no message in request data")
-	}
+// SetAdminIDs configures the Telegram IDs allowed to run admin commands, who are also
+// notified about auto-banned users
+func (h *HandlerWithMiddleware) SetAdminIDs(ids []int64) {
+	h.adminIDs = ids
+	h.handler.SetAdminIDs(ids)
+}
 
-	message := requestData.Message
-
-	switch message.Text {
-	case "/start":
-		return h.handleStart(ctx, message)
-	case "/account":
-		return h.handleAccount(ctx, message)
-	case "/help":
-		return h.handleHelp(ctx, message)
-	default:
-		return h.handleUnknownCommand(ctx, message)
-	}
+// SetAbuseGuard enables auto-banning of users who keep hitting the rate limit
+func (h *HandlerWithMiddleware) SetAbuseGuard(guard *AbuseGuard) {
+	h.abuseGuard = guard
+	h.handler.abuseGuard = guard
 }
 
-// handleCallbackWithMiddleware is the actual callback handler used by middleware
-func (h *HandlerWithMiddleware) handleCallbackWithMiddleware(ctx context.Context, data interface{}) error {
-	requestData, ok := data.(*middleware.RequestData)
-	if !ok {
-		return fmt.Errorf("invalid request data type")
-	}
+// SetMetricsRecorder configures where request metrics are recorded
+func (h *HandlerWithMiddleware) SetMetricsRecorder(recorder middleware.MetricsRecorder) {
+	h.metrics = recorder
+}
 
-	if requestData.Callback == nil {
-		return fmt.Errorf("no callback in request data")
-	}
+// SetSessionStore configures where the conversational state of users is kept. The
+// default keeps it in memory
+func (h *HandlerWithMiddleware) SetSessionStore(store session.SessionStore) {
+	h.sessionStore = store
+}
 
-	callback := requestData.Callback
-
-	switch callback.Data {
-	case "trial":
-		return h.handleTrialCallback(ctx, callback)
-	case "account":
-		return h.handleAccountCallback(ctx, callback)
-	case "help":
-		return h.handleHelpCallback(ctx, callback)
-	default:
-		return h.handleUnknownCallback(ctx, callback)
-	}
+// SetCommandRecorder configures where per-command metrics are recorded
+func (h *HandlerWithMiddleware) SetCommandRecorder(recorder CommandRecorder) {
+	h.handler.SetCommandRecorder(recorder)
 }
 
-// Individual handler methods (reuse existing logic from the original handler)
-func (h *HandlerWithMiddleware) handleStart(ctx context.Context, message *tgbotapi.Message) error {
-	user, err := h.userService.RegisterUser(
-		ctx,
-		message.From.ID,
-		message.From.UserName,
-		message.From.FirstName,
-		message.From.LastName,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to register user: %w", err)
+// RecordRequest forwards request metrics to the configured recorder, if any
+func (h *HandlerWithMiddleware) RecordRequest(requestType string, duration time.Duration, err error) {
+	if h.metrics != nil {
+		h.metrics.RecordRequest(requestType, duration, err)
 	}
-
-	welcomeText := fmt.Sprintf(
-		"🎉 Welcome to Arcanus VPN, %s!\n\n"+
-			"🔐 Secure, private, and fast VPN service\n"+
-			"📊 You have %.1f MB of free trial data\n\n"+
-			"Choose an option below:",
-		user.FirstName,
-		float64(user.QuotaLimit)/(1024*1024),
-	)
-
-	keyboard := utils.CreateMainKeyboard()
-	return h.sendMessage(message.Chat.ID, welcomeText, keyboard)
 }
 
-func (h *HandlerWithMiddleware) handleAccount(ctx context.Context, message *tgbotapi.Message) error {
-	user, err := h.userService.GetUser(ctx, message.From.ID)
-	if err != nil {
-		return fmt.Errorf("failed to get user: %w", err)
+// HandleUpdate handles incoming Telegram updates using middleware
+func (h *HandlerWithMiddleware) HandleUpdate(ctx context.Context, update tgbotapi.Update) error {
+	if update.Message != nil {
+		requestData := middleware.NewRequestDataFromUpdate(&update)
+		if requestData == nil {
+			h.logger.WithField("update_id", update.UpdateID).Warn("Skipping message without a sender or chat")
+			return nil
+		}
+		ctx = events.WithCorrelationID(ctx, requestData.CorrelationID)
+		ctx = events.WithUpdateID(ctx, requestData.UpdateID)
+		// The user has already been charged, so a payment must never be rate limited
+		// or dropped; redeliveries are ignored by the payment service
+		if update.Message.SuccessfulPayment != nil {
+			return h.handler.HandleUpdate(ctx, update)
+		}
+		ctx, banned := h.loadSender(ctx, requestData.UserID)
+		if banned {
+			return nil
+		}
+		err := h.messageHandler(ctx, requestData)
+		h.recordRateLimitViolation(ctx, requestData.UserID, err)
+		return err
 	}
-
-	quotaUsedMB := float64(user.QuotaUsed) / (1024 * 1024)
-	quotaLimitMB := float64(user.QuotaLimit) / (1024 * 1024)
-	quotaUsagePercentage := user.GetQuotaUsagePercentage()
-
-	accountText := fmt.Sprintf(
-		"👤 **Your Account**\n\n"+
-			"📊 **Usage Statistics:**\n"+
-			"• Used: %.2f MB / %.1f MB\n"+
-			"• Progress: %.1f%%\n"+
-			"• Status: %s\n\n"+
-			"📅 Member since: %s",
-		quotaUsedMB,
-		quotaLimitMB,
-		quotaUsagePercentage,
-		user.Status,
-		user.CreatedAt.Format("January 2, 2006"),
-	)
-
-	keyboard := utils.CreateAccountKeyboard()
-	return h.sendMessage(message.Chat.ID, accountText, keyboard)
+	return nil
 }
 
-func (h *HandlerWithMiddleware) handleHelp(ctx context.Context, message *tgbotapi.Message) error {
-	helpText := "🤖 **Arcanus VPN Bot Help**\n\n" +
-		"**Commands:**\n" +
-		"• /start - Register and get started\n" +
-		"• /account - View your account details\n" +
-		"• /help - Show this help message\n\n" +
-		"**Features:**\n" +
-		"• 🔐 Secure VPN connection\n" +
-		"• 📊 50MB free trial\n" +
-		"• ⚡ Fast and reliable\n" +
-		"• 🛡️ Privacy-focused\n\n" +
-		"**Support:**\n" +
-		"For technical support, contact @support"
-
-	keyboard := utils.CreateHelpKeyboard()
-	return h.sendMessage(message.Chat.ID, helpText, keyboard)
+// HandleCallback handles callback queries using middleware. The update ID, if any, is
+// taken from the context since callbacks are passed without their update
+func (h *HandlerWithMiddleware) HandleCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) error {
+	update := &tgbotapi.Update{CallbackQuery: callback}
+	update.UpdateID, _ = events.UpdateIDFromContext(ctx)
+	requestData := middleware.NewRequestDataFromUpdate(update)
+	if requestData == nil {
+		h.logger.WithField("callback_id", callback.ID).Warn("Skipping callback without a sender or message")
+		return nil
+	}
+	ctx = events.WithCorrelationID(ctx, requestData.CorrelationID)
+	ctx, banned := h.loadSender(ctx, requestData.UserID)
+	if banned {
+		return nil
+	}
+	err := h.callbackHandler(ctx, requestData)
+	h.recordRateLimitViolation(ctx, requestData.UserID, err)
+	return err
 }
 
-func (h *HandlerWithMiddleware) handleUnknownCommand(ctx context.Context, message *tgbotapi.Message) error {
-	unknownText := "❓ Unknown command. Use /help to see available commands."
-	keyboard := utils.CreateMainKeyboard()
-	return h.sendMessage(message.Chat.ID, unknownText, keyboard)
+// HandlePreCheckoutQuery answers a checkout outside the middleware chain, since
+// Telegram cancels the payment unless it is answered within seconds
+func (h *HandlerWithMiddleware) HandlePreCheckoutQuery(ctx context.Context, query *tgbotapi.PreCheckoutQuery) error {
+	return h.handler.HandlePreCheckoutQuery(ctx, query)
 }
 
-// Callback handlers
-func (h *HandlerWithMiddleware) handleTrialCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) error {
-	if err := h.answerCallback(callback.ID, "🎉 Activating your free trial..."); err != nil {
-		return err
+// loadSender loads the stored account of the user sending an update. It returns a
+// context carrying their stored language for the replies, and reports whether the
+// update should be dropped: the abuse guard banned them during this process lifetime,
+// or their stored account is banned. Admins are never dropped, so they can always lift
+// bans. If the account cannot be loaded the update is let through
+func (h *HandlerWithMiddleware) loadSender(ctx context.Context, userID int64) (context.Context, bool) {
+	admin := h.handler.isAdmin(userID)
+	if !admin && h.abuseGuard != nil && h.abuseGuard.IsBanned(userID) {
+		return ctx, true
 	}
 
-	if err := h.userService.ActivateTrial(ctx, callback.From.ID); err != nil {
-		return fmt.Errorf("failed to activate trial: %w", err)
-	}
-
-	user, err := h.userService.GetUser(ctx, callback.From.ID)
+	user, err := h.userService.GetUser(ctx, userID)
 	if err != nil {
-		return fmt.Errorf("failed to get user: %w", err)
+		if !errors.Is(err, domain.ErrUserNotFound) {
+			h.logger.WithError(err).WithField("user_id", userID).Warn("Failed to load the sender of an update")
+		}
+		return ctx, false
 	}
-
-	successText := fmt.Sprintf(
-		"🎉 **Free Trial Activated!**\n\n"+
-			"✅ You now have %.1f MB of free VPN data\n"+
-			"🔐 Your connection is secure and private\n"+
-			"⚡ Enjoy fast, unlimited browsing!\n\n"+
-			"Use /account to track your usage.",
-		float64(user.QuotaLimit)/(1024*1024),
-	)
-
-	keyboard := utils.CreateTrialKeyboard()
-	return h.editMessage(callback.Message.Chat.ID, callback.Message.MessageID, successText, keyboard)
+	return withStoredLanguage(ctx, user.TelegramID, user.LanguageCode), !admin && user.IsBanned()
 }
 
-func (h *HandlerWithMiddleware) handleAccountCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) error {
-	if err := h.answerCallback(callback.ID, "📊 Loading account details..."); err != nil {
-		return err
+// recordRateLimitViolation bans users who keep hitting the rate limit and notifies the admins
+func (h *HandlerWithMiddleware) recordRateLimitViolation(ctx context.Context, userID int64, err error) {
+	if h.abuseGuard == nil || !errors.Is(err, middleware.ErrRateLimitExceeded) {
+		return
 	}
-
-	user, err := h.userService.GetUser(ctx, callback.From.ID)
-	if err != nil {
-		return fmt.Errorf("failed to get user: %w", err)
+	if !h.abuseGuard.RecordViolation(userID) {
+		return
 	}
 
-	quotaUsedMB := float64(user.QuotaUsed) / (1024 * 1024)
-	quotaLimitMB := float64(user.QuotaLimit) / (1024 * 1024)
-
-	accountText := fmt.Sprintf(
-		"👤 **Account Details**\n\n"+
-			"📊 **Usage:**\n"+
-			"• Used: %.2f MB / %.1f MB\n"+
-			"• Remaining: %.2f MB\n"+
-			"• Status: %s\n\n"+
-			"📅 Joined: %s",
-		quotaUsedMB,
-		quotaLimitMB,
-		quotaLimitMB-quotaUsedMB,
-		user.Status,
-		user.CreatedAt.Format("Jan 2, 2006"),
-	)
+	h.logger.WithFields(logrus.Fields{
+		"user_id":   userID,
+		"threshold": h.abuseGuard.Threshold(),
+		"window":    h.abuseGuard.Window().String(),
+	}).Warn("Auto-banning user after repeated rate limit violations")
+
+	// Users who never registered have nothing to persist; they stay banned in memory
+	if err := h.userService.BanUser(ctx, userID); err != nil && !errors.Is(err, domain.ErrUserNotFound) {
+		h.logger.WithError(err).WithField("user_id", userID).Error("Failed to ban user")
+	}
 
-	keyboard := utils.CreateAccountKeyboard()
-	return h.editMessage(callback.Message.Chat.ID, callback.Message.MessageID, accountText, keyboard)
+	h.notifyAdmins(fmt.Sprintf("🚫 User %d was auto-banned after %d rate limit violations within %s.",
+		userID, h.abuseGuard.Threshold(), h.abuseGuard.Window()))
 }
 
-func (h *HandlerWithMiddleware) handleHelpCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) error {
-	if err := h.answerCallback(callback.ID, "❓ Loading help..."); err != nil {
-		return err
+// notifyAdmins sends a notification to every configured admin
+func (h *HandlerWithMiddleware) notifyAdmins(text string) {
+	for _, adminID := range h.adminIDs {
+		msg := tgbotapi.NewMessage(adminID, text)
+
+		var err error
+		if sender, ok := h.botAPI.(nonCriticalSender); ok {
+			err = sender.SendNonCritical(msg)
+		} else {
+			_, err = h.botAPI.Send(msg)
+		}
+		if err != nil {
+			h.logger.WithError(err).WithField("admin_id", adminID).Error("Failed to notify admin")
+		}
 	}
-
-	helpText := "🤖 **Arcanus VPN Bot Help**\n\n" +
-		"**Commands:**\n" +
-		"• /start - Register and get started\n" +
-		"• /account - View your account details\n" +
-		"• /help - Show this help message\n\n" +
-		"**Features:**\n" +
-		"• 🔐 Secure VPN connection\n" +
-		"• 📊 50MB free trial\n" +
-		"• ⚡ Fast and reliable\n" +
-		"• 🛡️ Privacy-focused\n\n" +
-		"**Support:**\n" +
-		"For technical support, contact @support"
-
-	keyboard := utils.CreateBackKeyboard("main")
-	return h.editMessage(callback.Message.Chat.ID, callback.Message.MessageID, helpText, keyboard)
 }
 
-func (h *HandlerWithMiddleware) handleUnknownCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) error {
-	return h.answerCallback(callback.ID, "❓ Unknown action. Please try again.")
-}
+// replyUnderMaintenance tells a user their message or callback was not handled because
+// the bot is under maintenance
+func (h *HandlerWithMiddleware) replyUnderMaintenance(_ context.Context, data interface{}) error {
+	requestData, ok := data.(*middleware.RequestData)
+	if !ok {
+		return fmt.Errorf("invalid request data type")
+	}
 
-// Helper methods (reuse from original handler)
-func (h *HandlerWithMiddleware) sendMessage(chatID int64, text string, keyboard tgbotapi.InlineKeyboardMarkup) error {
-	msg := tgbotapi.NewMessage(chatID, text)
-	msg.ParseMode = "Markdown"
-	msg.ReplyMarkup = keyboard
+	if requestData.Callback != nil {
+		return h.handler.answerCallback(requestData.Callback.ID, maintenanceMessage)
+	}
+	return h.handler.sendErrorMessage(requestData.ChatID, maintenanceMessage)
+}
 
-	sentMessage, err := h.botAPI.Send(msg)
-	if err != nil {
-		return fmt.Errorf("failed to send message: %w", err)
+// handleMessageWithMiddleware passes a message that made it through the middleware
+// to the wrapped handler
+func (h *HandlerWithMiddleware) handleMessageWithMiddleware(ctx context.Context, data interface{}) error {
+	requestData, ok := data.(*middleware.RequestData)
+	if !ok {
+		return fmt.Errorf("invalid request data type")
 	}
 
-	h.logger.WithFields(logrus.Fields{
-		"chat_id": chatID,
-		"message_id": sentMessage.MessageID,
-		"text": text,
-	}).Info("Message sent successfully")
+	if requestData.Message == nil {
+		return fmt.Errorf("no message in request data")
+	}
 
-	return nil
+	return h.handler.HandleUpdate(withSession(ctx, requestData), *requestData.Update)
 }
 
-func (h *HandlerWithMiddleware) editMessage(chatID int64, messageID int, text string, keyboard tgbotapi.InlineKeyboardMarkup) error {
-	edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
-	edit.ParseMode = "Markdown"
-	edit.ReplyMarkup = &keyboard
-
-	_, err := h.botAPI.Send(edit)
-	if err != nil {
-		return fmt.Errorf("failed to edit message: %w", err)
+// handleCallbackWithMiddleware passes a callback that made it through the middleware
+// to the wrapped handler
+func (h *HandlerWithMiddleware) handleCallbackWithMiddleware(ctx context.Context, data interface{}) error {
+	requestData, ok := data.(*middleware.RequestData)
+	if !ok {
+		return fmt.Errorf("invalid request data type")
 	}
 
-	h.logger.WithFields(logrus.Fields{
-		"chat_id": chatID,
-		"message_id": messageID,
-		"text": text,
-	}).Info("Message edited successfully")
+	if requestData.Callback == nil {
+		return fmt.Errorf("no callback in request data")
+	}
 
-	return nil
+	return h.handler.HandleCallback(withSession(ctx, requestData), requestData.Callback)
 }
 
-func (h *HandlerWithMiddleware) answerCallback(callbackID, text string) error {
-	callback := tgbotapi.NewCallback(callbackID, text)
-	_, err := h.botAPI.Request(callback)
-	return err
-}
\ No newline at end of file
+// withSession passes the session loaded by the session middleware on to the handler,
+// which reads and changes it with session.FromContext
+func withSession(ctx context.Context, requestData *middleware.RequestData) context.Context {
+	if requestData.Session == nil {
+		return ctx
+	}
+	return session.WithContext(ctx, requestData.Session)
+}
@@ -2,13 +2,26 @@ package bot
 
 import (
 	"context"
+	"fmt"
+	"net/netip"
+	"strings"
 	"testing"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/config"
 	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/events"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/repository"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/service"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/session"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 )
 
 // setupTestHandler creates a handler with mocked dependencies for testing
@@ -50,13 +63,31 @@ func (m *MockBotAPI) GetMe() (tgbotapi.User, error) {
 	return args.Get(0).(tgbotapi.User), args.Error(1)
 }
 
+func (m *MockBotAPI) GetWebhookInfo() (tgbotapi.WebhookInfo, error) {
+	args := m.Called()
+	return args.Get(0).(tgbotapi.WebhookInfo), args.Error(1)
+}
+
+func (m *MockBotAPI) MakeRequest(endpoint string, params tgbotapi.Params) (*tgbotapi.APIResponse, error) {
+	args := m.Called(endpoint, params)
+	return args.Get(0).(*tgbotapi.APIResponse), args.Error(1)
+}
+
 // MockUserService is a mock implementation of domain.UserService
 type MockUserService struct {
 	mock.Mock
 }
 
-func (m *MockUserService) RegisterUser(ctx context.Context, telegramID int64, username, firstName, lastName string) (*domain.User, error) {
-	args := m.Called(ctx, telegramID, username, firstName, lastName)
+func (m *MockUserService) RegisterUser(ctx context.Context, telegramID int64, username, firstName, lastName, languageCode string) (*domain.User, error) {
+	args := m.Called(ctx, telegramID, username, firstName, lastName, languageCode)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.User), args.Error(1)
+}
+
+func (m *MockUserService) RegisterWithReferral(ctx context.Context, telegramID int64, username, firstName, lastName, languageCode, referralCode string) (*domain.User, error) {
+	args := m.Called(ctx, telegramID, username, firstName, lastName, languageCode, referralCode)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -71,6 +102,14 @@ func (m *MockUserService) GetUser(ctx context.Context, telegramID int64) (*domai
 	return args.Get(0).(*domain.User), args.Error(1)
 }
 
+func (m *MockUserService) GetUserSnapshot(ctx context.Context, telegramID int64) (*domain.UserSnapshot, error) {
+	args := m.Called(ctx, telegramID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.UserSnapshot), args.Error(1)
+}
+
 func (m *MockUserService) ActivateTrial(ctx context.Context, telegramID int64) error {
 	args := m.Called(ctx, telegramID)
 	return args.Error(0)
@@ -81,6 +120,104 @@ func (m *MockUserService) UpdateQuota(ctx context.Context, telegramID int64, quo
 	return args.Error(0)
 }
 
+func (m *MockUserService) SetLanguage(ctx context.Context, telegramID int64, code string) error {
+	args := m.Called(ctx, telegramID, code)
+	return args.Error(0)
+}
+
+func (m *MockUserService) SetAlertThreshold(ctx context.Context, telegramID int64, pct int) error {
+	args := m.Called(ctx, telegramID, pct)
+	return args.Error(0)
+}
+
+func (m *MockUserService) SetTimezone(ctx context.Context, telegramID int64, name string) error {
+	args := m.Called(ctx, telegramID, name)
+	return args.Error(0)
+}
+
+func (m *MockUserService) ResetQuota(ctx context.Context, telegramID int64) error {
+	args := m.Called(ctx, telegramID)
+	return args.Error(0)
+}
+
+func (m *MockUserService) BanUser(ctx context.Context, telegramID int64) error {
+	args := m.Called(ctx, telegramID)
+	return args.Error(0)
+}
+
+func (m *MockUserService) UnbanUser(ctx context.Context, telegramID int64) error {
+	args := m.Called(ctx, telegramID)
+	return args.Error(0)
+}
+
+func (m *MockUserService) MarkBlocked(ctx context.Context, telegramID int64) error {
+	args := m.Called(ctx, telegramID)
+	return args.Error(0)
+}
+
+func (m *MockUserService) DeleteUser(ctx context.Context, telegramID int64) error {
+	args := m.Called(ctx, telegramID)
+	return args.Error(0)
+}
+
+func (m *MockUserService) CountByStatus(ctx context.Context) (map[string]int64, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]int64), args.Error(1)
+}
+
+func (m *MockUserService) GetAggregateStats(ctx context.Context) (*domain.UserStats, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.UserStats), args.Error(1)
+}
+
+func (m *MockUserService) FindByUsername(ctx context.Context, username string) (*domain.User, error) {
+	args := m.Called(ctx, username)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.User), args.Error(1)
+}
+
+func (m *MockUserService) ListUsers(ctx context.Context, offset, limit int) ([]*domain.UserSnapshot, error) {
+	args := m.Called(ctx, offset, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.UserSnapshot), args.Error(1)
+}
+
+func (m *MockUserService) CountUsers(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserService) UpgradeUser(ctx context.Context, telegramID int64, newQuotaLimit int64) error {
+	args := m.Called(ctx, telegramID, newQuotaLimit)
+	return args.Error(0)
+}
+
+func (m *MockUserService) DailySignups(ctx context.Context, from, to time.Time) ([]domain.DailyCount, error) {
+	args := m.Called(ctx, from, to)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.DailyCount), args.Error(1)
+}
+
+func (m *MockUserService) TopByUsage(ctx context.Context, n int) ([]*domain.UserSnapshot, error) {
+	args := m.Called(ctx, n)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.UserSnapshot), args.Error(1)
+}
+
 func TestHandler_HandleUpdate_StartCommand(t *testing.T) {
 	mockBotAPI, mockService, handler := setupTestHandler()
 
@@ -102,7 +239,7 @@ func TestHandler_HandleUpdate_StartCommand(t *testing.T) {
 
 	// Mock the service response
 	expectedUser := domain.NewUser(123, "testuser", "Test", "User")
-	mockService.On("RegisterUser", mock.Anything, int64(123), "testuser", "Test", "User").
+	mockService.On("RegisterUser", mock.Anything, int64(123), "testuser", "Test", "User", "").
 		Return(expectedUser, nil)
 		
 	// Mock the bot API response
@@ -116,6 +253,214 @@ func TestHandler_HandleUpdate_StartCommand(t *testing.T) {
 	mockBotAPI.AssertExpectations(t)
 }
 
+func TestHandler_HandleUpdate_StartCommandLocalized(t *testing.T) {
+	tests := []struct {
+		languageCode string
+		welcome      string
+		helpButton   string
+	}{
+		{"ru", "Добро пожаловать в Arcanus VPN, Test\\!", "❓ Помощь"},
+		{"es-MX", "¡Bienvenido a Arcanus VPN, Test\\!", "❓ Ayuda"},
+		{"de", "Welcome to Arcanus VPN, Test\\!", "❓ Help"},
+		{"", "Welcome to Arcanus VPN, Test\\!", "❓ Help"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.languageCode, func(t *testing.T) {
+			mockBotAPI, mockService, handler := setupTestHandler()
+			message := &tgbotapi.Message{
+				Text: "/start",
+				From: &tgbotapi.User{ID: 123, FirstName: "Test", LanguageCode: tt.languageCode},
+				Chat: &tgbotapi.Chat{ID: 456},
+			}
+
+			mockService.On("RegisterUser", mock.Anything, int64(123), "", "Test", "", tt.languageCode).
+				Return(domain.NewUser(123, "", "Test", ""), nil)
+			var sent tgbotapi.MessageConfig
+			mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+				Run(func(args mock.Arguments) {
+					sent = args.Get(0).(tgbotapi.MessageConfig)
+				}).
+				Return(tgbotapi.Message{}, nil)
+
+			require.NoError(t, handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message}))
+			assert.Contains(t, sent.Text, tt.welcome)
+			keyboard := sent.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup)
+			assert.Equal(t, tt.helpButton, keyboard.InlineKeyboard[1][0].Text)
+		})
+	}
+}
+
+func TestHandler_HandleUpdate_StartCommandEscapesName(t *testing.T) {
+	tests := []struct {
+		firstName string
+		escaped   string
+	}{
+		{"*bold*", `Arcanus VPN, \*bold\*\!`},
+		{"a_b_c", `Arcanus VPN, a\_b\_c\!`},
+		{"[x](http://evil.example)", `Arcanus VPN, \[x\]\(http://evil\.example\)\!`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.firstName, func(t *testing.T) {
+			mockBotAPI, mockService, handler := setupTestHandler()
+			message := &tgbotapi.Message{
+				Text: "/start",
+				From: &tgbotapi.User{ID: 123, FirstName: tt.firstName},
+				Chat: &tgbotapi.Chat{ID: 456},
+			}
+
+			mockService.On("RegisterUser", mock.Anything, int64(123), "", tt.firstName, "", "").
+				Return(domain.NewUser(123, "", tt.firstName, ""), nil)
+			var sent tgbotapi.MessageConfig
+			mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+				Run(func(args mock.Arguments) {
+					sent = args.Get(0).(tgbotapi.MessageConfig)
+				}).
+				Return(tgbotapi.Message{}, nil)
+
+			require.NoError(t, handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message}))
+			assert.Equal(t, "MarkdownV2", sent.ParseMode)
+			assert.Contains(t, sent.Text, tt.escaped)
+		})
+	}
+}
+
+func TestHandler_HandleUpdate_AccountCommandLocalized(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+	message := &tgbotapi.Message{
+		Text: "/account",
+		From: &tgbotapi.User{ID: 123, FirstName: "Test", LanguageCode: "ru"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.ActivateTrial()
+	mockService.On("GetUserSnapshot", mock.Anything, int64(123)).Return(domain.NewUserSnapshot(user), nil)
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	require.NoError(t, handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message}))
+	assert.Contains(t, sent.Text, "Информация об аккаунте")
+	assert.Contains(t, sent.Text, "Статус: 🟢 Активен")
+	assert.NotContains(t, sent.Text, "Account Information")
+}
+
+func TestHandler_HandleUpdate_StartWithReferralCode(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	mockService.On("RegisterWithReferral", mock.Anything, int64(123), "testuser", "Test", "User", "", "ABCD2345").
+		Return(user, nil)
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Return(tgbotapi.Message{}, nil)
+
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+		Text: "/start ABCD2345",
+		From: &tgbotapi.User{ID: 123, UserName: "testuser", FirstName: "Test", LastName: "User"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}})
+
+	assert.NoError(t, err)
+	mockService.AssertNotCalled(t, "RegisterUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockService.AssertExpectations(t)
+}
+
+func TestHandlers_StartDeepLinks(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	tests := []struct {
+		name            string
+		text            string
+		entities        []tgbotapi.MessageEntity
+		expectedPayload string
+		registers       bool
+	}{
+		{
+			name:      "plain start",
+			text:      "/start",
+			entities:  []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: 6}},
+			registers: true,
+		},
+		{
+			name:            "deep link payload",
+			text:            "/start ref_xyz",
+			entities:        []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: 6}},
+			expectedPayload: "ref_xyz",
+			registers:       true,
+		},
+		{
+			name:            "payload without command entity",
+			text:            "/start ref_xyz",
+			expectedPayload: "ref_xyz",
+			registers:       true,
+		},
+		{
+			name: "bare text",
+			text: "start ref_xyz",
+		},
+	}
+
+	handlers := map[string]func(BotAPI, domain.UserService) func(context.Context, tgbotapi.Update) error{
+		"Handler": func(botAPI BotAPI, userService domain.UserService) func(context.Context, tgbotapi.Update) error {
+			return NewHandler(botAPI, userService, logger).HandleUpdate
+		},
+		"HandlerWithMiddleware": func(botAPI BotAPI, userService domain.UserService) func(context.Context, tgbotapi.Update) error {
+			rateLimiter := NewRateLimiter(DefaultRateLimiterConfig())
+			t.Cleanup(rateLimiter.Stop)
+			return NewHandlerWithMiddleware(botAPI, userService, logger, rateLimiter, NewAuditLogger(logger)).HandleUpdate
+		},
+	}
+
+	for handlerName, newHandler := range handlers {
+		for _, tt := range tests {
+			t.Run(handlerName+"/"+tt.name, func(t *testing.T) {
+				mockBotAPI := new(MockBotAPI)
+				mockService := new(MockUserService)
+				handleUpdate := newHandler(mockBotAPI, mockService)
+
+				user := domain.NewUser(123, "testuser", "Test", "User")
+				// The middleware checks for a stored ban
+				mockService.On("GetUser", mock.Anything, int64(123)).Return(user, nil).Maybe()
+				if tt.registers && tt.expectedPayload == "" {
+					mockService.On("RegisterUser", mock.Anything, int64(123), "testuser", "Test", "User", "").Return(user, nil)
+				}
+				if tt.registers && tt.expectedPayload != "" {
+					mockService.On("RegisterWithReferral", mock.Anything, int64(123), "testuser", "Test", "User", "", tt.expectedPayload).Return(user, nil)
+				}
+
+				var sent []string
+				mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+					Run(func(args mock.Arguments) {
+						sent = append(sent, args.Get(0).(tgbotapi.MessageConfig).Text)
+					}).
+					Return(tgbotapi.Message{}, nil)
+
+				err := handleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+					Text:     tt.text,
+					Entities: tt.entities,
+					From:     &tgbotapi.User{ID: 123, UserName: "testuser", FirstName: "Test", LastName: "User"},
+					Chat:     &tgbotapi.Chat{ID: 456},
+				}})
+
+				require.NoError(t, err)
+				require.NotEmpty(t, sent)
+				if tt.registers {
+					assert.Contains(t, sent[len(sent)-1], "Welcome to Arcanus VPN")
+				} else {
+					assert.NotContains(t, sent[len(sent)-1], "Welcome to Arcanus VPN")
+				}
+				mockService.AssertExpectations(t)
+			})
+		}
+	}
+}
+
 func TestHandler_HandleUpdate_AccountCommand(t *testing.T) {
 	mockBotAPI, mockService, handler := setupTestHandler()
 
@@ -137,8 +482,8 @@ func TestHandler_HandleUpdate_AccountCommand(t *testing.T) {
 
 	// Mock the service response
 	expectedUser := domain.NewUser(123, "testuser", "Test", "User")
-	mockService.On("GetUser", mock.Anything, int64(123)).
-		Return(expectedUser, nil)
+	mockService.On("GetUserSnapshot", mock.Anything, int64(123)).
+		Return(domain.NewUserSnapshot(expectedUser), nil)
 		
 	// Mock the bot API response
 	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
@@ -225,6 +570,28 @@ func TestHandler_HandleUpdate_NilMessage(t *testing.T) {
 	_, _ = mockBotAPI, mockService
 }
 
+func TestHandler_HandleUpdate_MessageWithoutSenderOrChat(t *testing.T) {
+	tests := []struct {
+		name    string
+		message *tgbotapi.Message
+	}{
+		{"nil From", &tgbotapi.Message{Text: "/start", Chat: &tgbotapi.Chat{ID: 456}}},
+		{"nil Chat", &tgbotapi.Message{Text: "/start", From: &tgbotapi.User{ID: 123, FirstName: "Test"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBotAPI, mockService, handler := setupTestHandler()
+
+			err := handler.HandleUpdate(context.Background(), tgbotapi.Update{UpdateID: 1, Message: tt.message})
+
+			assert.NoError(t, err)
+			mockBotAPI.AssertNotCalled(t, "Send", mock.Anything)
+			mockService.AssertNotCalled(t, "RegisterUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
 func TestHandler_HandleCallback_Trial(t *testing.T) {
 	mockBotAPI, mockService, handler := setupTestHandler()
 
@@ -289,7 +656,7 @@ func TestHandler_HandleCallback_Account(t *testing.T) {
 
 	// Mock the service response
 	expectedUser := domain.NewUser(123, "testuser", "Test", "User")
-	mockService.On("GetUser", mock.Anything, int64(123)).Return(expectedUser, nil)
+	mockService.On("GetUserSnapshot", mock.Anything, int64(123)).Return(domain.NewUserSnapshot(expectedUser), nil)
 	
 	// Mock the bot API responses
 	mockBotAPI.On("Request", mock.AnythingOfType("tgbotapi.CallbackConfig")).
@@ -393,3 +760,2500 @@ func TestFormatBytes(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_SendMessage_SplitsLongText(t *testing.T) {
+	mockBotAPI, _, handler := setupTestHandler()
+
+	var sent []tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = append(sent, args.Get(0).(tgbotapi.MessageConfig))
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("OK", "ok")),
+	)
+	text := strings.Repeat(strings.Repeat("x", 99)+"\n", 50)
+
+	err := handler.sendMessage(123, text, keyboard)
+
+	require.NoError(t, err)
+	require.Len(t, sent, 2)
+	assert.Nil(t, sent[0].ReplyMarkup)
+	assert.Equal(t, keyboard, sent[1].ReplyMarkup, "the keyboard goes on the last message")
+	for _, msg := range sent {
+		assert.LessOrEqual(t, len(msg.Text), 4096)
+		assert.Equal(t, "MarkdownV2", msg.ParseMode)
+	}
+}
+
+func TestHandler_SendMessage_MarksBlockedUser(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Return(tgbotapi.Message{}, &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}).Once()
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Return(tgbotapi.Message{}, &tgbotapi.Error{Code: 400, Message: "Bad Request: message is too long"}).Once()
+	mockService.On("MarkBlocked", mock.Anything, int64(123)).Return(nil).Once()
+
+	err := handler.sendMessage(123, "hello", tgbotapi.InlineKeyboardMarkup{})
+	assert.Error(t, err)
+
+	// Other send errors do not mark the user
+	err = handler.sendErrorMessage(123, "oops")
+	assert.Error(t, err)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHandler_AccountView_UsesEntities(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+
+	message := &tgbotapi.Message{
+		Text: "/account",
+		From: &tgbotapi.User{ID: 123, UserName: "test_user", FirstName: "*Bold*"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}
+
+	user := domain.NewUser(123, "test_user", "*Bold*", "🎉")
+	mockService.On("GetUserSnapshot", mock.Anything, int64(123)).Return(domain.NewUserSnapshot(user), nil)
+
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+	assert.NoError(t, err)
+	assert.Empty(t, sent.ParseMode)
+	assert.NotEmpty(t, sent.Entities)
+	assert.Contains(t, sent.Text, "*Bold* 🎉")
+	assert.Contains(t, sent.Text, "@test_user")
+	for _, entity := range sent.Entities {
+		assert.Equal(t, "bold", entity.Type)
+	}
+}
+
+func TestHandler_AccountView_Username(t *testing.T) {
+	tests := []struct {
+		name        string
+		username    string
+		lastName    string
+		lang        string
+		contains    []string
+		notContains []string
+	}{
+		{name: "with username", username: "test_user", lastName: "User", contains: []string{"Username: @test_user\n", "Name: Test User\n"}},
+		{name: "without username", contains: []string{"Username: (no username)\n", "Name: Test\n"}, notContains: []string{"@"}},
+		{name: "without username localized", lang: "es", contains: []string{"Usuario: (sin usuario)\n"}, notContains: []string{"@"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBotAPI, mockService, handler := setupTestHandler()
+			user := domain.NewUser(123, tt.username, "Test", tt.lastName)
+			mockService.On("GetUserSnapshot", mock.Anything, int64(123)).Return(domain.NewUserSnapshot(user), nil)
+
+			var sent tgbotapi.MessageConfig
+			mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+				Run(func(args mock.Arguments) {
+					sent = args.Get(0).(tgbotapi.MessageConfig)
+				}).
+				Return(tgbotapi.Message{}, nil)
+
+			message := &tgbotapi.Message{
+				Text: "/account",
+				From: &tgbotapi.User{ID: 123, UserName: tt.username, FirstName: "Test", LanguageCode: tt.lang},
+				Chat: &tgbotapi.Chat{ID: 456},
+			}
+			require.NoError(t, handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message}))
+
+			for _, expected := range tt.contains {
+				assert.Contains(t, sent.Text, expected)
+			}
+			for _, unexpected := range tt.notContains {
+				assert.NotContains(t, sent.Text, unexpected)
+			}
+			// Entities only mark up the fixed labels, never user-provided text
+			for _, entity := range sent.Entities {
+				assert.Equal(t, "bold", entity.Type)
+			}
+		})
+	}
+}
+
+func TestHandler_HandleUpdate_StatsCommand_Admin(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+	handler.SetAdminIDs([]int64{123})
+
+	message := &tgbotapi.Message{
+		Text: "/stats",
+		From: &tgbotapi.User{ID: 123, FirstName: "Admin"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}
+
+	stats := &domain.UserStats{
+		TotalUsers: 3,
+		UsersByStatus: map[string]int64{
+			domain.UserStatusInactive: 1,
+			domain.UserStatusTrial:    2,
+		},
+		TotalQuotaUsed: 1024 * 1024,
+	}
+	mockService.On("GetAggregateStats", mock.Anything).Return(stats, nil)
+
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+	assert.NoError(t, err)
+	assert.Contains(t, sent.Text, "Total Users:* 3")
+	assert.Contains(t, sent.Text, "Trial: 2")
+	assert.Contains(t, sent.Text, `1\.0 MB`)
+	mockService.AssertExpectations(t)
+}
+
+func TestHandler_HandleUpdate_StatsCommand_NonAdmin(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+	handler.SetAdminIDs([]int64{999})
+
+	message := &tgbotapi.Message{
+		Text: "/stats",
+		From: &tgbotapi.User{ID: 123, FirstName: "User"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}
+
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+	assert.NoError(t, err)
+	assert.Contains(t, sent.Text, "Unknown command")
+	mockService.AssertNotCalled(t, "GetAggregateStats", mock.Anything)
+}
+
+func TestHandler_HandleUpdate_ExportStatsCommand(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+	handler.SetAdminIDs([]int64{123})
+
+	stats := &domain.UserStats{
+		TotalUsers: 7,
+		UsersByStatus: map[string]int64{
+			domain.UserStatusInactive: 3,
+			domain.UserStatusTrial:    2,
+			domain.UserStatusActive:   1,
+			"suspended":               1,
+		},
+		TotalQuotaUsed: 4096,
+	}
+	mockService.On("GetAggregateStats", mock.Anything).Return(stats, nil)
+	var from, to time.Time
+	signups := []domain.DailyCount{
+		{Day: time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC), Count: 2},
+		{Day: time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), Count: 0},
+		{Day: time.Date(2024, 3, 12, 0, 0, 0, 0, time.UTC), Count: 5},
+	}
+	mockService.On("DailySignups", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			from, to = args.Get(1).(time.Time), args.Get(2).(time.Time)
+		}).
+		Return(signups, nil)
+
+	var sent tgbotapi.DocumentConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.DocumentConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.DocumentConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	message := &tgbotapi.Message{
+		Text: "/exportstats 3",
+		From: &tgbotapi.User{ID: 123, FirstName: "Admin"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+	require.NoError(t, err)
+	assert.Equal(t, 2*24*time.Hour, to.Sub(from), "the window covers today and the two days before")
+	assert.Equal(t, int64(456), sent.ChatID)
+	file := sent.File.(tgbotapi.FileBytes)
+	assert.True(t, strings.HasPrefix(file.Name, "arcanus-stats-"))
+	assert.True(t, strings.HasSuffix(file.Name, ".csv"))
+	assert.Equal(t, "section,name,value\n"+
+		"status,inactive,3\n"+
+		"status,trial,2\n"+
+		"status,active,1\n"+
+		"status,banned,0\n"+
+		"status,suspended,1\n"+
+		"total,users,7\n"+
+		"total,quota_used_bytes,4096\n"+
+		"signups,2024-03-10,2\n"+
+		"signups,2024-03-11,0\n"+
+		"signups,2024-03-12,5\n", string(file.Bytes))
+	assert.Contains(t, sent.Caption, "last 3 days")
+}
+
+func TestHandler_HandleUpdate_ExportStatsCommand_Rejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		adminIDs []int64
+		text     string
+		expected string
+	}{
+		{"non-admin", []int64{999}, "/exportstats", "Unknown command"},
+		{"invalid days", []int64{123}, "/exportstats 0", `Usage: /exportstats \[1\-366\]`},
+		{"too many days", []int64{123}, "/exportstats 400", `Usage: /exportstats \[1\-366\]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBotAPI, mockService, handler := setupTestHandler()
+			handler.SetAdminIDs(tt.adminIDs)
+
+			var sent tgbotapi.MessageConfig
+			mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+				Run(func(args mock.Arguments) {
+					sent = args.Get(0).(tgbotapi.MessageConfig)
+				}).
+				Return(tgbotapi.Message{}, nil)
+
+			message := &tgbotapi.Message{
+				Text: tt.text,
+				From: &tgbotapi.User{ID: 123, FirstName: "User"},
+				Chat: &tgbotapi.Chat{ID: 456},
+			}
+			err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+			assert.NoError(t, err)
+			assert.Contains(t, sent.Text, tt.expected)
+			mockService.AssertNotCalled(t, "GetAggregateStats", mock.Anything)
+			mockBotAPI.AssertNotCalled(t, "Send", mock.AnythingOfType("tgbotapi.DocumentConfig"))
+		})
+	}
+}
+
+func TestHandler_HandleUpdate_DeleteAccountCommand(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+
+	message := &tgbotapi.Message{
+		Text: "/deleteaccount",
+		From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}
+
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+	assert.NoError(t, err)
+	assert.Equal(t, handler.createConfirmationKeyboard("en", "deleteaccount"), sent.ReplyMarkup)
+	// Nothing is deleted until the user confirms
+	mockService.AssertNotCalled(t, "DeleteUser", mock.Anything, mock.Anything)
+}
+
+func TestHandler_HandleCallback_DeleteAccountConfirm(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+
+	callback := &tgbotapi.CallbackQuery{
+		ID:      "test_callback_id",
+		From:    &tgbotapi.User{ID: 123, FirstName: "Test"},
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 456}, MessageID: 789},
+		Data:    "confirm_deleteaccount",
+	}
+
+	mockService.On("DeleteUser", mock.Anything, int64(123)).Return(nil)
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.EditMessageTextConfig")).
+		Return(tgbotapi.Message{}, nil)
+
+	err := handler.HandleCallback(context.Background(), callback)
+
+	assert.NoError(t, err)
+	mockService.AssertExpectations(t)
+	mockBotAPI.AssertExpectations(t)
+}
+
+func TestHandler_HandleCallback_DeleteAccountCancel(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+
+	callback := &tgbotapi.CallbackQuery{
+		ID:      "test_callback_id",
+		From:    &tgbotapi.User{ID: 123, FirstName: "Test"},
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 456}, MessageID: 789},
+		Data:    "cancel_deleteaccount",
+	}
+
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.EditMessageTextConfig")).
+		Return(tgbotapi.Message{}, nil)
+
+	err := handler.HandleCallback(context.Background(), callback)
+
+	assert.NoError(t, err)
+	mockService.AssertNotCalled(t, "DeleteUser", mock.Anything, mock.Anything)
+	mockBotAPI.AssertExpectations(t)
+}
+
+func TestHandler_RepliesInUserLanguage(t *testing.T) {
+	ru := &tgbotapi.User{ID: 123, FirstName: "Test", LanguageCode: "ru"}
+
+	t.Run("delete account prompt", func(t *testing.T) {
+		mockBotAPI, _, handler := setupTestHandler()
+		var sent tgbotapi.MessageConfig
+		mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+			Run(func(args mock.Arguments) { sent = args.Get(0).(tgbotapi.MessageConfig) }).
+			Return(tgbotapi.Message{}, nil)
+
+		message := &tgbotapi.Message{Text: "/deleteaccount", From: ru, Chat: &tgbotapi.Chat{ID: 456}}
+		require.NoError(t, handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message}))
+
+		assert.Contains(t, sent.Text, "Удаление аккаунта")
+		assert.Contains(t, sent.Text, "Вы уверены?")
+		assert.Equal(t, handler.createConfirmationKeyboard("ru", "deleteaccount"), sent.ReplyMarkup)
+	})
+
+	t.Run("register first", func(t *testing.T) {
+		mockBotAPI, mockService, handler := setupTestHandler()
+		mockService.On("GetUser", mock.Anything, int64(123)).Return(nil, domain.UserNotFoundError{TelegramID: 123})
+		handler.SetVPNService(new(MockVPNService))
+		var sent tgbotapi.MessageConfig
+		mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+			Run(func(args mock.Arguments) { sent = args.Get(0).(tgbotapi.MessageConfig) }).
+			Return(tgbotapi.Message{}, nil)
+
+		message := &tgbotapi.Message{Text: "/getconfig", From: ru, Chat: &tgbotapi.Chat{ID: 456}}
+		require.NoError(t, handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message}))
+
+		assert.Contains(t, sent.Text, "Сначала зарегистрируйтесь")
+	})
+
+	t.Run("delete account cancelled", func(t *testing.T) {
+		mockBotAPI, _, handler := setupTestHandler()
+		var edited tgbotapi.EditMessageTextConfig
+		mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.EditMessageTextConfig")).
+			Run(func(args mock.Arguments) { edited = args.Get(0).(tgbotapi.EditMessageTextConfig) }).
+			Return(tgbotapi.Message{}, nil)
+
+		callback := &tgbotapi.CallbackQuery{
+			ID:      "callback",
+			From:    ru,
+			Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 456}, MessageID: 789},
+			Data:    "cancel_deleteaccount",
+		}
+		require.NoError(t, handler.HandleCallback(context.Background(), callback))
+
+		assert.Contains(t, edited.Text, "Удаление аккаунта отменено")
+	})
+
+	t.Run("unknown action", func(t *testing.T) {
+		mockBotAPI, _, handler := setupTestHandler()
+		var answered tgbotapi.CallbackConfig
+		mockBotAPI.On("Request", mock.AnythingOfType("tgbotapi.CallbackConfig")).
+			Run(func(args mock.Arguments) { answered = args.Get(0).(tgbotapi.CallbackConfig) }).
+			Return(&tgbotapi.APIResponse{Ok: true}, nil)
+
+		callback := &tgbotapi.CallbackQuery{
+			ID:      "callback",
+			From:    ru,
+			Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 456}, MessageID: 789},
+			Data:    "nonsense",
+		}
+		require.NoError(t, handler.HandleCallback(context.Background(), callback))
+
+		assert.Equal(t, "❓ Неизвестное действие. Попробуйте ещё раз.", answered.Text)
+	})
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name            string
+		text            string
+		expectedCommand string
+		expectedArgs    string
+	}{
+		{"Plain command", "/start", "start", ""},
+		{"Command with args", "/history 12345", "history", "12345"},
+		{"Command addressed to bot", "/help@ArcanusBot", "help", ""},
+		{"Not a command", "hello", "", ""},
+		{"Empty text", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command, args := parseCommand(&tgbotapi.Message{Text: tt.text})
+			assert.Equal(t, tt.expectedCommand, command)
+			assert.Equal(t, tt.expectedArgs, args)
+		})
+	}
+}
+
+func TestHandler_HandleUpdate_HistoryCommand(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+	handler.SetAdminIDs([]int64{1})
+	activityRepo := repository.NewMemoryActivityRepository(5, 10)
+	handler.SetActivityRepository(activityRepo)
+
+	mockService.On("GetUserSnapshot", mock.Anything, int64(123)).
+		Return(domain.NewUserSnapshot(domain.NewUser(123, "testuser", "Test", "User")), nil)
+
+	var sent []tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = append(sent, args.Get(0).(tgbotapi.MessageConfig))
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	// The user issues a couple of commands that get recorded
+	for _, text := range []string{"/help", "/account"} {
+		err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+			Text: text,
+			From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+			Chat: &tgbotapi.Chat{ID: 456},
+		}})
+		assert.NoError(t, err)
+	}
+
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+		Text: "/history 123",
+		From: &tgbotapi.User{ID: 1, FirstName: "Admin"},
+		Chat: &tgbotapi.Chat{ID: 1},
+	}})
+
+	assert.NoError(t, err)
+	history := sent[len(sent)-1].Text
+	assert.Contains(t, history, "Recent commands for 123")
+	assert.Less(t, strings.Index(history, "/account"), strings.Index(history, "/help"), "newest command should be listed first")
+}
+
+func TestHandler_HandleUpdate_HistoryCommand_InvalidArgs(t *testing.T) {
+	mockBotAPI, _, handler := setupTestHandler()
+	handler.SetAdminIDs([]int64{1})
+	handler.SetActivityRepository(repository.NewMemoryActivityRepository(5, 10))
+
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+		Text: "/history abc",
+		From: &tgbotapi.User{ID: 1, FirstName: "Admin"},
+		Chat: &tgbotapi.Chat{ID: 1},
+	}})
+
+	assert.NoError(t, err)
+	assert.Contains(t, sent.Text, "Usage: /history")
+}
+
+// setupTestSettings creates runtime settings backed by an in-memory database
+func setupTestSettings(t *testing.T) *config.DynamicConfig {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&domain.Setting{}))
+	return config.NewDynamicConfig(&config.Config{}, repository.NewSettingsRepository(db), time.Minute)
+}
+
+func TestHandlerWithMiddleware_MaintenanceMode(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+	handler.SetAdminIDs([]int64{1})
+	settings := setupTestSettings(t)
+	require.NoError(t, settings.Set(context.Background(), config.SettingMaintenanceMode, "true"))
+	handler.SetSettingsStore(settings)
+	rateLimiter := NewRateLimiter(DefaultRateLimiterConfig())
+	t.Cleanup(rateLimiter.Stop)
+	middlewareHandler := WrapHandler(handler, rateLimiter, NewAuditLogger(handler.logger))
+	mockService.On("GetUser", mock.Anything, mock.Anything).Return(nil, domain.ErrUserNotFound).Maybe()
+
+	var sent []string
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = append(sent, args.Get(0).(tgbotapi.MessageConfig).Text)
+		}).
+		Return(tgbotapi.Message{}, nil)
+	var answered []string
+	mockBotAPI.On("Request", mock.AnythingOfType("tgbotapi.CallbackConfig")).
+		Run(func(args mock.Arguments) {
+			answered = append(answered, args.Get(0).(tgbotapi.CallbackConfig).Text)
+		}).
+		Return(&tgbotapi.APIResponse{Ok: true}, nil)
+
+	ctx := context.Background()
+	require.NoError(t, middlewareHandler.HandleUpdate(ctx, tgbotapi.Update{Message: &tgbotapi.Message{
+		Text: "/help",
+		From: &tgbotapi.User{ID: 42, FirstName: "Test"},
+		Chat: &tgbotapi.Chat{ID: 42},
+	}}))
+	require.NoError(t, middlewareHandler.HandleCallback(ctx, &tgbotapi.CallbackQuery{
+		ID:      "callback",
+		From:    &tgbotapi.User{ID: 42, FirstName: "Test"},
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 42}, MessageID: 1},
+		Data:    "trial",
+	}))
+
+	// Users are told about the maintenance and nothing is handled
+	require.Len(t, sent, 1)
+	assert.Contains(t, sent[0], "under maintenance")
+	assert.Equal(t, []string{maintenanceMessage}, answered)
+	mockService.AssertNotCalled(t, "ActivateTrial", mock.Anything, mock.Anything)
+
+	// Admins keep using the bot
+	require.NoError(t, middlewareHandler.HandleUpdate(ctx, tgbotapi.Update{Message: &tgbotapi.Message{
+		Text: "/help",
+		From: &tgbotapi.User{ID: 1, FirstName: "Admin"},
+		Chat: &tgbotapi.Chat{ID: 1},
+	}}))
+	require.Len(t, sent, 2)
+	assert.NotContains(t, sent[1], "under maintenance")
+}
+
+func TestHandler_HandleUpdate_SettingCommand(t *testing.T) {
+	mockBotAPI, _, handler := setupTestHandler()
+	handler.SetAdminIDs([]int64{1})
+	settings := setupTestSettings(t)
+	handler.SetSettingsStore(settings)
+
+	var sent []tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = append(sent, args.Get(0).(tgbotapi.MessageConfig))
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	sendAdmin := func(text string) {
+		err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+			Text: text,
+			From: &tgbotapi.User{ID: 1, FirstName: "Admin"},
+			Chat: &tgbotapi.Chat{ID: 1},
+		}})
+		require.NoError(t, err)
+	}
+
+	sendAdmin("/setting trial_quota_bytes 1048576")
+	assert.Contains(t, sent[len(sent)-1].Text, "trial_quota_bytes set to 1048576")
+	assert.Equal(t, int64(1048576), settings.TrialQuotaLimit())
+
+	sendAdmin("/setting maintenance_mode yes")
+	assert.Contains(t, sent[len(sent)-1].Text, "Invalid setting")
+	assert.False(t, settings.MaintenanceMode())
+
+	sendAdmin("/setting maintenance_mode")
+	assert.Contains(t, sent[len(sent)-1].Text, `Usage: /setting <key\> <value\>`)
+
+	sendAdmin("/setting")
+	assert.Contains(t, sent[len(sent)-1].Text, "trial_quota_bytes = 1048576")
+}
+
+func TestHandler_HandleUpdate_MaintenanceMode(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+	handler.SetAdminIDs([]int64{1})
+	settings := setupTestSettings(t)
+	require.NoError(t, settings.Set(context.Background(), config.SettingMaintenanceMode, "true"))
+	handler.SetSettingsStore(settings)
+
+	var sent []tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = append(sent, args.Get(0).(tgbotapi.MessageConfig))
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+		Text: "/account",
+		From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}})
+	require.NoError(t, err)
+	require.Len(t, sent, 1)
+	assert.Contains(t, sent[0].Text, "under maintenance")
+	mockService.AssertNotCalled(t, "GetUser", mock.Anything, mock.Anything)
+
+	// Admins keep access so they can turn maintenance mode off again
+	err = handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+		Text: "/setting maintenance_mode false",
+		From: &tgbotapi.User{ID: 1, FirstName: "Admin"},
+		Chat: &tgbotapi.Chat{ID: 1},
+	}})
+	require.NoError(t, err)
+	assert.False(t, settings.MaintenanceMode())
+}
+
+func TestHandler_HandleUpdate_ResetQuotaCommand(t *testing.T) {
+	tests := []struct {
+		name         string
+		text         string
+		fromID       int64
+		serviceErr   error
+		callsService bool
+		expectedText string
+	}{
+		{
+			name:         "resets quota",
+			text:         "/resetquota 123",
+			fromID:       1,
+			callsService: true,
+			expectedText: "Quota reset for user 123",
+		},
+		{
+			name:         "unknown user",
+			text:         "/resetquota 123",
+			fromID:       1,
+			serviceErr:   fmt.Errorf("failed to get user for quota reset: %w", domain.UserNotFoundError{TelegramID: 123}),
+			callsService: true,
+			expectedText: "User 123 not found",
+		},
+		{
+			name:         "dry run",
+			text:         "/resetquota 123 --dry-run",
+			fromID:       1,
+			expectedText: `Dry run: would reset 1\.0 MB of quota used by user 123`,
+		},
+		{
+			name:         "misspelt dry run flag",
+			text:         "/resetquota 123 --dryrun",
+			fromID:       1,
+			expectedText: `Usage: /resetquota <telegram\_id\>`,
+		},
+		{
+			name:         "invalid telegram id",
+			text:         "/resetquota abc",
+			fromID:       1,
+			expectedText: `Usage: /resetquota <telegram\_id\>`,
+		},
+		{
+			name:         "non-admin",
+			text:         "/resetquota 123",
+			fromID:       2,
+			expectedText: "Unknown command",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBotAPI, mockService, handler := setupTestHandler()
+			handler.SetAdminIDs([]int64{1})
+
+			if tt.callsService {
+				mockService.On("ResetQuota", mock.Anything, int64(123)).Return(tt.serviceErr)
+			}
+			user := domain.NewUser(123, "testuser", "Test", "User")
+			user.QuotaUsed = 1 << 20
+			mockService.On("GetUser", mock.Anything, int64(123)).Return(user, nil).Maybe()
+
+			var sent tgbotapi.MessageConfig
+			mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+				Run(func(args mock.Arguments) {
+					sent = args.Get(0).(tgbotapi.MessageConfig)
+				}).
+				Return(tgbotapi.Message{}, nil)
+
+			err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+				Text: tt.text,
+				From: &tgbotapi.User{ID: tt.fromID, FirstName: "Test"},
+				Chat: &tgbotapi.Chat{ID: 1},
+			}})
+
+			assert.NoError(t, err)
+			assert.Contains(t, sent.Text, tt.expectedText)
+			if !tt.callsService {
+				mockService.AssertNotCalled(t, "ResetQuota", mock.Anything, mock.Anything)
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandler_HandleUpdate_UpgradeCommand(t *testing.T) {
+	tests := []struct {
+		name         string
+		text         string
+		fromID       int64
+		quotaLimit   int64
+		serviceErr   error
+		callsService bool
+		expectedText string
+	}{
+		{
+			name:         "upgrades user",
+			text:         "/upgrade 123 10GB",
+			fromID:       1,
+			quotaLimit:   10 << 30,
+			callsService: true,
+			expectedText: `User 123 upgraded to an active account with 10\.0 GB`,
+		},
+		{
+			name:         "quota in bytes",
+			text:         "/upgrade 123 1048576",
+			fromID:       1,
+			quotaLimit:   1 << 20,
+			callsService: true,
+			expectedText: "User 123 upgraded",
+		},
+		{
+			name:         "unknown user",
+			text:         "/upgrade 123 1GB",
+			fromID:       1,
+			quotaLimit:   1 << 30,
+			serviceErr:   fmt.Errorf("failed to get user for upgrade: %w", domain.UserNotFoundError{TelegramID: 123}),
+			callsService: true,
+			expectedText: "User 123 not found",
+		},
+		{
+			name:         "already active",
+			text:         "/upgrade 123 1GB",
+			fromID:       1,
+			quotaLimit:   1 << 30,
+			serviceErr:   domain.ErrUserAlreadyActive,
+			callsService: true,
+			expectedText: "User 123 is already active",
+		},
+		{
+			name:         "invalid quota",
+			text:         "/upgrade 123 lots",
+			fromID:       1,
+			expectedText: `Usage: /upgrade <telegram\_id\> <quota\>`,
+		},
+		{
+			name:         "missing quota",
+			text:         "/upgrade 123",
+			fromID:       1,
+			expectedText: `Usage: /upgrade <telegram\_id\> <quota\>`,
+		},
+		{
+			name:         "non-admin",
+			text:         "/upgrade 123 1GB",
+			fromID:       2,
+			expectedText: "Unknown command",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBotAPI, mockService, handler := setupTestHandler()
+			handler.SetAdminIDs([]int64{1})
+
+			if tt.callsService {
+				mockService.On("UpgradeUser", mock.Anything, int64(123), tt.quotaLimit).Return(tt.serviceErr)
+			}
+
+			var sent tgbotapi.MessageConfig
+			mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+				Run(func(args mock.Arguments) {
+					sent = args.Get(0).(tgbotapi.MessageConfig)
+				}).
+				Return(tgbotapi.Message{}, nil)
+
+			err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+				Text: tt.text,
+				From: &tgbotapi.User{ID: tt.fromID, FirstName: "Test"},
+				Chat: &tgbotapi.Chat{ID: 1},
+			}})
+
+			assert.NoError(t, err)
+			assert.Contains(t, sent.Text, tt.expectedText)
+			if !tt.callsService {
+				mockService.AssertNotCalled(t, "UpgradeUser", mock.Anything, mock.Anything, mock.Anything)
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+// stubDataRetention counts the users it would anonymize
+type stubDataRetention struct {
+	pending  int
+	enforced bool
+}
+
+func (r *stubDataRetention) Enabled() bool { return true }
+
+func (r *stubDataRetention) Preview(ctx context.Context) (int, error) { return r.pending, nil }
+
+func (r *stubDataRetention) Enforce(ctx context.Context) (int, error) {
+	r.enforced = true
+	count := r.pending
+	r.pending = 0
+	return count, nil
+}
+
+func TestHandler_HandleUpdate_AnonymizeCommand(t *testing.T) {
+	tests := []struct {
+		name         string
+		text         string
+		retention    *stubDataRetention
+		expectedText string
+		enforced     bool
+	}{
+		{
+			name:         "anonymizes users",
+			text:         "/anonymize",
+			retention:    &stubDataRetention{pending: 4},
+			expectedText: "Anonymized 4 inactive users",
+			enforced:     true,
+		},
+		{
+			name:         "dry run",
+			text:         "/anonymize --dry-run",
+			retention:    &stubDataRetention{pending: 4},
+			expectedText: "Dry run: would anonymize 4 inactive users",
+		},
+		{
+			name:         "disabled",
+			text:         "/anonymize",
+			expectedText: "Data retention is disabled",
+		},
+		{
+			name:         "unexpected arguments",
+			text:         "/anonymize now",
+			retention:    &stubDataRetention{pending: 4},
+			expectedText: `Usage: /anonymize \[\-\-dry\-run\]`,
+		},
+		{
+			name:         "misspelt dry run flag",
+			text:         "/anonymize --dryrun",
+			retention:    &stubDataRetention{pending: 4},
+			expectedText: `Usage: /anonymize \[\-\-dry\-run\]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBotAPI, _, handler := setupTestHandler()
+			handler.SetAdminIDs([]int64{1})
+			if tt.retention != nil {
+				handler.SetDataRetention(tt.retention)
+			}
+
+			var sent tgbotapi.MessageConfig
+			mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+				Run(func(args mock.Arguments) {
+					sent = args.Get(0).(tgbotapi.MessageConfig)
+				}).
+				Return(tgbotapi.Message{}, nil)
+
+			err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+				Text: tt.text,
+				From: &tgbotapi.User{ID: 1, FirstName: "Test"},
+				Chat: &tgbotapi.Chat{ID: 1},
+			}})
+
+			assert.NoError(t, err)
+			assert.Contains(t, sent.Text, tt.expectedText)
+			if tt.retention != nil {
+				assert.Equal(t, tt.enforced, tt.retention.enforced)
+				if !tt.enforced {
+					assert.Equal(t, 4, tt.retention.pending, "a dry run must not change anything")
+				}
+			}
+		})
+	}
+}
+
+func TestIsDryRun(t *testing.T) {
+	tests := []struct {
+		args       string
+		wantDryRun bool
+		wantErr    bool
+	}{
+		{args: "123", wantDryRun: false},
+		{args: "123 --dry-run", wantDryRun: true},
+		{args: "--dry-run 123", wantDryRun: true},
+		{args: "123 --dry-run=false", wantDryRun: false},
+		{args: "123 --dry-run=yes", wantDryRun: true},
+		{args: "123 --dry-runs", wantErr: true},
+		{args: "123 --dryrun", wantErr: true},
+		{args: "123 --dry-run --force", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			_, flags := utils.ParseArgs(tt.args)
+			dryRun, err := isDryRun(flags)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantDryRun, dryRun)
+		})
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+		wantErr  bool
+	}{
+		{input: "52428800", expected: 52428800},
+		{input: "50MB", expected: 50 << 20},
+		{input: "10 gb", expected: 10 << 30},
+		{input: "1TB", expected: 1 << 40},
+		{input: "512B", expected: 512},
+		{input: "10XB", wantErr: true},
+		{input: "GB", wantErr: true},
+		{input: "99999999999TB", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			size, err := parseByteSize(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, size)
+		})
+	}
+}
+
+// stubBugReportRepository keeps bug reports in memory
+type stubBugReportRepository struct {
+	reports []*domain.BugReport
+}
+
+func (r *stubBugReportRepository) Create(ctx context.Context, report *domain.BugReport) error {
+	report.ID = uint(len(r.reports) + 1)
+	r.reports = append(r.reports, report)
+	return nil
+}
+
+func TestHandler_HandleUpdate_ReportBugCommand(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+	bugReports := &stubBugReportRepository{}
+	handler.SetBugReportRepository(bugReports)
+	handler.SetActivityRepository(repository.NewMemoryActivityRepository(5, 10))
+	handler.SetAdminChatID(-100)
+	handler.SetVersion("1.4.2")
+
+	mockService.On("GetUserSnapshot", mock.Anything, int64(123)).
+		Return(nil, fmt.Errorf("database unavailable"))
+
+	var sent []tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = append(sent, args.Get(0).(tgbotapi.MessageConfig))
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	for _, text := range []string{"/account", "/reportbug My account page fails to load"} {
+		err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+			Text: text,
+			From: &tgbotapi.User{ID: 123, UserName: "testuser", FirstName: "Test"},
+			Chat: &tgbotapi.Chat{ID: 123},
+		}})
+		require.NoError(t, err)
+	}
+
+	require.Len(t, bugReports.reports, 1)
+	report := bugReports.reports[0]
+	assert.Equal(t, int64(123), report.TelegramID)
+	assert.Equal(t, "1.4.2", report.AppVersion)
+	assert.Equal(t, "/account", report.LastCommand)
+	assert.Contains(t, report.LastError, "Failed to get account information")
+	assert.Equal(t, "My account page fails to load", report.Description)
+
+	require.Len(t, sent, 3)
+	forwarded := sent[1]
+	assert.Equal(t, int64(-100), forwarded.ChatID)
+	assert.Contains(t, forwarded.Text, "123 @testuser")
+	assert.Contains(t, forwarded.Text, "Version: 1.4.2")
+	assert.Contains(t, forwarded.Text, "My account page fails to load")
+	assert.Equal(t, int64(123), sent[2].ChatID)
+	assert.Contains(t, sent[2].Text, `report \#1`)
+}
+
+func TestHandler_HandleUpdate_ReportBugCommand_RequiresDescription(t *testing.T) {
+	mockBotAPI, _, handler := setupTestHandler()
+	bugReports := &stubBugReportRepository{}
+	handler.SetBugReportRepository(bugReports)
+
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+		Text: "/reportbug",
+		From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+		Chat: &tgbotapi.Chat{ID: 123},
+	}})
+
+	assert.NoError(t, err)
+	assert.Empty(t, bugReports.reports)
+	assert.Contains(t, sent.Text, "Usage: /reportbug")
+}
+
+// setTestPlans configures the handler's plan catalog
+func setTestPlans(t *testing.T, handler *Handler, plans ...domain.Plan) {
+	catalog, err := domain.NewPlanCatalog(plans)
+	require.NoError(t, err)
+	handler.SetPlanCatalog(catalog)
+}
+
+func TestHandler_HandleUpdate_PlansCommand(t *testing.T) {
+	mockBotAPI, _, handler := setupTestHandler()
+	setTestPlans(t, handler,
+		domain.Plan{Name: "Basic", QuotaLimit: 10 * 1024 * 1024 * 1024, Price: 4.99, Currency: "USD"},
+		domain.Plan{Name: "Pro", QuotaLimit: 100 * 1024 * 1024 * 1024, Price: 9.99, Currency: "USD"},
+	)
+
+	message := &tgbotapi.Message{
+		Text: "/plans",
+		From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}
+
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+	require.NoError(t, err)
+	assert.Contains(t, sent.Text, "Basic\nQuota: 10.0 GB\nPrice: 4.99 USD")
+	assert.Contains(t, sent.Text, "Pro\nQuota: 100.0 GB\nPrice: 9.99 USD")
+
+	keyboard := sent.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup)
+	require.Len(t, keyboard.InlineKeyboard, 2)
+	assert.Equal(t, "Choose Basic", keyboard.InlineKeyboard[0][0].Text)
+	assert.Equal(t, "plan:Basic", *keyboard.InlineKeyboard[0][0].CallbackData)
+	assert.Equal(t, "plan:Pro", *keyboard.InlineKeyboard[1][0].CallbackData)
+}
+
+func TestHandler_HandleUpdate_PlansCommandLocalized(t *testing.T) {
+	mockBotAPI, _, handler := setupTestHandler()
+	setTestPlans(t, handler, domain.Plan{Name: "Basic", QuotaLimit: 1024, Price: 4.99, Currency: "USD"})
+
+	message := &tgbotapi.Message{
+		Text: "/plans",
+		From: &tgbotapi.User{ID: 123, FirstName: "Test", LanguageCode: "ru"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}
+
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+	require.NoError(t, err)
+	assert.Contains(t, sent.Text, "Доступные тарифы")
+	keyboard := sent.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup)
+	assert.Equal(t, "Выбрать Basic", keyboard.InlineKeyboard[0][0].Text)
+}
+
+func TestHandler_HandleUpdate_PlansCommandWithoutPlans(t *testing.T) {
+	mockBotAPI, _, handler := setupTestHandler()
+
+	message := &tgbotapi.Message{
+		Text: "/plans",
+		From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}
+
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+	require.NoError(t, err)
+	assert.Equal(t, `No plans are available right now\.`, sent.Text)
+}
+
+func TestHandler_HandleUpdate_LanguageCommand(t *testing.T) {
+	mockBotAPI, _, handler := setupTestHandler()
+
+	message := &tgbotapi.Message{
+		Text: "/language",
+		From: &tgbotapi.User{ID: 123, FirstName: "Test", LanguageCode: "es"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}
+
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+	require.NoError(t, err)
+	assert.Contains(t, sent.Text, "Elige el idioma del bot")
+	keyboard := sent.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup)
+	require.Len(t, keyboard.InlineKeyboard, 3)
+	assert.Equal(t, "🇬🇧 English", keyboard.InlineKeyboard[0][0].Text)
+	assert.Equal(t, "lang:en", *keyboard.InlineKeyboard[0][0].CallbackData)
+	assert.Equal(t, "lang:es", *keyboard.InlineKeyboard[1][0].CallbackData)
+	assert.Equal(t, "lang:ru", *keyboard.InlineKeyboard[2][0].CallbackData)
+}
+
+func TestHandler_HandleCallback_ChooseLanguage(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+
+	mockService.On("SetLanguage", mock.Anything, int64(123), "ru").Return(nil)
+	var edited tgbotapi.EditMessageTextConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.EditMessageTextConfig")).
+		Run(func(args mock.Arguments) {
+			edited = args.Get(0).(tgbotapi.EditMessageTextConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	callback := &tgbotapi.CallbackQuery{
+		ID:      "test_callback_id",
+		From:    &tgbotapi.User{ID: 123, FirstName: "Test", LanguageCode: "en"},
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 456}, MessageID: 789},
+		Data:    "lang:ru",
+	}
+	require.NoError(t, handler.HandleCallback(context.Background(), callback))
+	assert.Contains(t, edited.Text, "на русском")
+	mockService.AssertExpectations(t)
+}
+
+func TestHandlerWithMiddleware_StoredLanguageSurvivesRestart(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, repository.AutoMigrate(context.Background(), db))
+	userService := service.NewUserService(repository.NewUserRepository(db))
+	_, err = userService.RegisterUser(context.Background(), 123, "testuser", "Test", "User", "en")
+	require.NoError(t, err)
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	newHandler := func() (*HandlerWithMiddleware, *[]string) {
+		mockBotAPI := new(MockBotAPI)
+		var sent []string
+		mockBotAPI.On("Send", mock.Anything).
+			Run(func(args mock.Arguments) {
+				switch config := args.Get(0).(type) {
+				case tgbotapi.MessageConfig:
+					sent = append(sent, config.Text)
+				case tgbotapi.EditMessageTextConfig:
+					sent = append(sent, config.Text)
+				}
+			}).
+			Return(tgbotapi.Message{}, nil)
+		rateLimiter := NewRateLimiter(DefaultRateLimiterConfig())
+		t.Cleanup(rateLimiter.Stop)
+		return NewHandlerWithMiddleware(mockBotAPI, userService, logger, rateLimiter, NewAuditLogger(logger)), &sent
+	}
+	from := &tgbotapi.User{ID: 123, FirstName: "Test", LanguageCode: "en"}
+
+	handler, sent := newHandler()
+	require.NoError(t, handler.HandleCallback(context.Background(), &tgbotapi.CallbackQuery{
+		ID:      "test_callback_id",
+		From:    from,
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 123}, MessageID: 789},
+		Data:    "lang:ru",
+	}))
+	require.Len(t, *sent, 1)
+	assert.Contains(t, (*sent)[0], "на русском")
+
+	// A restarted bot, or another replica, replies in the chosen language, not the Telegram one
+	handler, sent = newHandler()
+	require.NoError(t, handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+		Text: "/nosuchcommand",
+		From: from,
+		Chat: &tgbotapi.Chat{ID: 123},
+	}}))
+	require.Len(t, *sent, 1)
+	assert.Contains(t, (*sent)[0], "Неизвестная команда")
+}
+
+func TestHandler_HandleCallback_ChooseLanguageRejectsUnsupported(t *testing.T) {
+	for _, data := range []string{"lang:de", "lang:RU", "lang:ru-RU", "lang:"} {
+		t.Run(data, func(t *testing.T) {
+			mockBotAPI, mockService, handler := setupTestHandler()
+
+			var answered tgbotapi.CallbackConfig
+			mockBotAPI.On("Request", mock.AnythingOfType("tgbotapi.CallbackConfig")).
+				Run(func(args mock.Arguments) {
+					answered = args.Get(0).(tgbotapi.CallbackConfig)
+				}).
+				Return(&tgbotapi.APIResponse{Ok: true}, nil)
+
+			callback := &tgbotapi.CallbackQuery{
+				ID:      "test_callback_id",
+				From:    &tgbotapi.User{ID: 123, FirstName: "Test"},
+				Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 456}, MessageID: 789},
+				Data:    data,
+			}
+			require.NoError(t, handler.HandleCallback(context.Background(), callback))
+			assert.Contains(t, answered.Text, "not supported")
+			mockService.AssertNotCalled(t, "SetLanguage", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestHandler_HandleUpdate_StoredLanguageOverridesTelegram(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.LanguageCode = "es"
+	mockService.On("GetUserSnapshot", mock.Anything, int64(123)).Return(domain.NewUserSnapshot(user), nil)
+	mockService.On("GetUser", mock.Anything, int64(123)).Return(user, nil)
+	var sent []string
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = append(sent, args.Get(0).(tgbotapi.MessageConfig).Text)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	from := &tgbotapi.User{ID: 123, FirstName: "Test", LanguageCode: "ru"}
+	// /account loads the user itself; other commands get the language from WithSender
+	message := &tgbotapi.Message{Text: "/account", From: from, Chat: &tgbotapi.Chat{ID: 456}}
+	require.NoError(t, handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message}))
+	message = &tgbotapi.Message{Text: "/nosuchcommand", From: from, Chat: &tgbotapi.Chat{ID: 456}}
+	require.NoError(t, handler.HandleUpdate(handler.WithSender(context.Background(), from), tgbotapi.Update{Message: message}))
+
+	require.Len(t, sent, 2)
+	assert.Contains(t, sent[0], "Información de la cuenta")
+	assert.Contains(t, sent[1], "Comando desconocido")
+}
+
+func TestHandler_HandleCallback_ChoosePlan(t *testing.T) {
+	callback := func(data string) *tgbotapi.CallbackQuery {
+		return &tgbotapi.CallbackQuery{
+			ID:      "test_callback_id",
+			From:    &tgbotapi.User{ID: 123, FirstName: "Test"},
+			Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 456}, MessageID: 789},
+			Data:    data,
+		}
+	}
+
+	t.Run("configured plan sends an invoice", func(t *testing.T) {
+		mockBotAPI, _, handler := setupTestHandler()
+		setTestPlans(t, handler, domain.Plan{Name: "Basic", QuotaLimit: 1024, Price: 4.99, Currency: "usd"})
+		handler.SetPaymentProviderToken("provider-token")
+
+		var invoice tgbotapi.InvoiceConfig
+		mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.InvoiceConfig")).
+			Run(func(args mock.Arguments) { invoice = args.Get(0).(tgbotapi.InvoiceConfig) }).
+			Return(tgbotapi.Message{}, nil).Once()
+		var answered tgbotapi.CallbackConfig
+		mockBotAPI.On("Request", mock.AnythingOfType("tgbotapi.CallbackConfig")).
+			Run(func(args mock.Arguments) { answered = args.Get(0).(tgbotapi.CallbackConfig) }).
+			Return(&tgbotapi.APIResponse{Ok: true}, nil).Once()
+
+		require.NoError(t, handler.HandleCallback(context.Background(), callback("plan:basic")))
+
+		assert.Equal(t, int64(456), invoice.ChatID)
+		assert.Equal(t, "Basic", invoice.Payload)
+		assert.Equal(t, "provider-token", invoice.ProviderToken)
+		assert.Equal(t, "USD", invoice.Currency)
+		assert.Equal(t, []tgbotapi.LabeledPrice{{Label: "Basic", Amount: 499}}, invoice.Prices)
+		assert.Contains(t, answered.Text, "Pay for the Basic plan")
+	})
+
+	t.Run("failed invoice is reported", func(t *testing.T) {
+		mockBotAPI, _, handler := setupTestHandler()
+		setTestPlans(t, handler, domain.Plan{Name: "Basic", QuotaLimit: 1024, Price: 4.99, Currency: "USD"})
+
+		mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.InvoiceConfig")).
+			Return(tgbotapi.Message{}, fmt.Errorf("Bad Request: PAYMENT_PROVIDER_INVALID")).Once()
+		var answered tgbotapi.CallbackConfig
+		mockBotAPI.On("Request", mock.AnythingOfType("tgbotapi.CallbackConfig")).
+			Run(func(args mock.Arguments) { answered = args.Get(0).(tgbotapi.CallbackConfig) }).
+			Return(&tgbotapi.APIResponse{Ok: true}, nil).Once()
+
+		require.NoError(t, handler.HandleCallback(context.Background(), callback("plan:Basic")))
+		assert.Contains(t, answered.Text, "Could not create the invoice")
+	})
+
+	t.Run("unknown plan", func(t *testing.T) {
+		mockBotAPI, _, handler := setupTestHandler()
+		setTestPlans(t, handler, domain.Plan{Name: "Basic", QuotaLimit: 1024, Price: 4.99, Currency: "USD"})
+
+		var answered tgbotapi.CallbackConfig
+		mockBotAPI.On("Request", mock.AnythingOfType("tgbotapi.CallbackConfig")).
+			Run(func(args mock.Arguments) { answered = args.Get(0).(tgbotapi.CallbackConfig) }).
+			Return(&tgbotapi.APIResponse{Ok: true}, nil).Once()
+
+		require.NoError(t, handler.HandleCallback(context.Background(), callback("plan:Gold")))
+		assert.Contains(t, answered.Text, "Unknown action")
+		mockBotAPI.AssertNotCalled(t, "Send", mock.Anything)
+	})
+}
+
+func TestHandler_HandlePreCheckoutQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		amount   int
+		currency string
+		user     *domain.User
+		userErr  error
+		wantOK   bool
+	}{
+		{"matching plan and price", "Basic", 499, "USD", &domain.User{TelegramID: 123, Status: domain.UserStatusTrial}, nil, true},
+		{"unknown plan", "Gold", 499, "USD", &domain.User{TelegramID: 123}, nil, false},
+		{"changed amount", "Basic", 399, "USD", &domain.User{TelegramID: 123}, nil, false},
+		{"changed currency", "Basic", 499, "EUR", &domain.User{TelegramID: 123}, nil, false},
+		{"unregistered user", "Basic", 499, "USD", nil, domain.ErrUserNotFound, false},
+		{"banned user", "Basic", 499, "USD", &domain.User{TelegramID: 123, Status: domain.UserStatusBanned}, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBotAPI, mockService, handler := setupTestHandler()
+			setTestPlans(t, handler, domain.Plan{Name: "Basic", QuotaLimit: 1024, Price: 4.99, Currency: "USD"})
+			handler.SetPaymentService(new(MockPaymentService))
+			mockService.On("GetUser", mock.Anything, int64(123)).Return(tt.user, tt.userErr).Maybe()
+
+			var answer tgbotapi.PreCheckoutConfig
+			mockBotAPI.On("Request", mock.AnythingOfType("tgbotapi.PreCheckoutConfig")).
+				Run(func(args mock.Arguments) { answer = args.Get(0).(tgbotapi.PreCheckoutConfig) }).
+				Return(&tgbotapi.APIResponse{Ok: true}, nil).Once()
+
+			err := handler.HandlePreCheckoutQuery(context.Background(), &tgbotapi.PreCheckoutQuery{
+				ID:             "checkout_1",
+				From:           &tgbotapi.User{ID: 123, FirstName: "Test"},
+				Currency:       tt.currency,
+				TotalAmount:    tt.amount,
+				InvoicePayload: tt.payload,
+			})
+
+			require.NoError(t, err)
+			assert.Equal(t, "checkout_1", answer.PreCheckoutQueryID)
+			assert.Equal(t, tt.wantOK, answer.OK)
+			if !tt.wantOK {
+				assert.Contains(t, answer.ErrorMessage, "no longer available")
+			}
+		})
+	}
+}
+
+func TestHandler_HandleUpdate_TagsEventsWithCorrelationID(t *testing.T) {
+	mockBotAPI := new(MockBotAPI)
+	mockService := new(MockUserService)
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	publisher := events.NewMockPublisher(logger)
+	handler := NewHandlerWithEvents(mockBotAPI, mockService, logger, events.NewEventService(publisher, logger))
+
+	var serviceCtx context.Context
+	mockService.On("RegisterUser", mock.Anything, int64(123), "", "Test", "", "").
+		Run(func(args mock.Arguments) {
+			serviceCtx = args.Get(0).(context.Context)
+		}).
+		Return(&domain.User{TelegramID: 123, FirstName: "Test", QuotaLimit: 1024}, nil)
+	mockBotAPI.On("Send", mock.Anything).Return(tgbotapi.Message{}, nil)
+
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+		Text: "/start",
+		From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}})
+	require.NoError(t, err)
+
+	published := publisher.GetPublishedEvents()
+	require.NotEmpty(t, published)
+	require.NotNil(t, published[0].CorrelationID)
+
+	// Downstream services see the same correlation ID
+	correlationID, ok := events.CorrelationIDFromContext(serviceCtx)
+	require.True(t, ok)
+	assert.Equal(t, *published[0].CorrelationID, correlationID)
+}
+
+func TestHandler_HandleUpdate_DeterministicIDs(t *testing.T) {
+	mockBotAPI := new(MockBotAPI)
+	mockService := new(MockUserService)
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	publisher := events.NewMockPublisher(logger)
+	eventService := events.NewEventService(publisher, logger)
+	eventService.SetIDGenerator(utils.NewSequentialIDGenerator("event"))
+	handler := NewHandlerWithEvents(mockBotAPI, mockService, logger, eventService)
+	handler.SetIDGenerator(utils.NewSequentialIDGenerator("correlation"))
+
+	mockService.On("RegisterUser", mock.Anything, int64(123), "", "Test", "", "").
+		Return(&domain.User{TelegramID: 123, FirstName: "Test", QuotaLimit: 1024}, nil)
+	mockBotAPI.On("Send", mock.Anything).Return(tgbotapi.Message{}, nil)
+
+	for i := 0; i < 2; i++ {
+		err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+			Text: "/start",
+			From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+			Chat: &tgbotapi.Chat{ID: 456},
+		}})
+		require.NoError(t, err)
+	}
+
+	// Each update publishes its message received and command executed events
+	published := publisher.GetPublishedEvents()
+	require.Len(t, published, 4)
+	for i, event := range published {
+		assert.Equal(t, fmt.Sprintf("event-%d", i+1), event.ID)
+		assert.Equal(t, fmt.Sprintf("correlation-%d", i/2+1), *event.CorrelationID)
+	}
+	assert.Equal(t, events.EventBotMessageReceived, published[0].Type)
+	assert.Equal(t, events.EventBotCommandExecuted, published[1].Type)
+}
+
+func TestHandlerWithMiddleware_HandleUpdate_PropagatesCorrelationID(t *testing.T) {
+	mockBotAPI, mockService, handler := setupAbuseTestHandler(t, 100)
+
+	var serviceCtx context.Context
+	mockService.On("RegisterUser", mock.Anything, int64(123), "", "Test", "", "").
+		Run(func(args mock.Arguments) {
+			serviceCtx = args.Get(0).(context.Context)
+		}).
+		Return(&domain.User{TelegramID: 123, FirstName: "Test", QuotaLimit: 1024}, nil)
+	mockBotAPI.On("Send", mock.Anything).Return(tgbotapi.Message{}, nil)
+
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+		Text: "/start",
+		From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}})
+	require.NoError(t, err)
+
+	correlationID, ok := events.CorrelationIDFromContext(serviceCtx)
+	assert.True(t, ok)
+	assert.NotEmpty(t, correlationID)
+}
+
+func TestHandlerWithMiddleware_HandleUpdate_KeepsSession(t *testing.T) {
+	_, _, handler := setupAbuseTestHandler(t, 100)
+
+	// A flow step records the next state, which the user's next update continues from
+	var seen []session.State
+	handler.handler.router.Register("step", func(ctx context.Context, message *tgbotapi.Message, _ string) error {
+		current, ok := session.FromContext(ctx)
+		require.True(t, ok)
+		seen = append(seen, current.State)
+		current.Transition("awaiting_payment_code")
+		return nil
+	})
+	step := func(updateID int) {
+		require.NoError(t, handler.HandleUpdate(context.Background(), tgbotapi.Update{UpdateID: updateID, Message: &tgbotapi.Message{
+			Text: "/step",
+			From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+			Chat: &tgbotapi.Chat{ID: 123},
+		}}))
+	}
+
+	step(1)
+	step(2)
+
+	assert.Equal(t, []session.State{session.StateIdle, "awaiting_payment_code"}, seen)
+	stored, err := handler.sessionStore.Get(context.Background(), 123)
+	require.NoError(t, err)
+	assert.Equal(t, session.State("awaiting_payment_code"), stored.State)
+}
+
+func TestHandlerWithMiddleware_HandleUpdate_MessageWithoutSenderOrChat(t *testing.T) {
+	mockBotAPI, mockService, handler := setupAbuseTestHandler(t, 100)
+
+	for _, message := range []*tgbotapi.Message{
+		{Text: "/start", Chat: &tgbotapi.Chat{ID: 456}},
+		{Text: "/start", From: &tgbotapi.User{ID: 123, FirstName: "Test"}},
+	} {
+		assert.NoError(t, handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message}))
+	}
+	assert.NoError(t, handler.HandleCallback(context.Background(), &tgbotapi.CallbackQuery{
+		ID:   "inline",
+		From: &tgbotapi.User{ID: 123},
+		Data: "account",
+	}))
+
+	mockBotAPI.AssertNotCalled(t, "Send", mock.Anything)
+	mockService.AssertNotCalled(t, "RegisterUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+// MockPaymentService is a mock implementation of domain.PaymentService
+type MockPaymentService struct {
+	mock.Mock
+}
+
+func (m *MockPaymentService) ProcessPayment(ctx context.Context, payment *domain.Payment) (*domain.User, error) {
+	args := m.Called(ctx, payment)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.User), args.Error(1)
+}
+
+func TestHandler_HandleUpdate_SuccessfulPayment(t *testing.T) {
+	mockBotAPI, _, handler := setupTestHandler()
+	payments := new(MockPaymentService)
+	handler.SetPaymentService(payments)
+
+	message := &tgbotapi.Message{
+		From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+		Chat: &tgbotapi.Chat{ID: 456},
+		SuccessfulPayment: &tgbotapi.SuccessfulPayment{
+			Currency:                "USD",
+			TotalAmount:             499,
+			InvoicePayload:          "Basic",
+			TelegramPaymentChargeID: "tg_charge_1",
+			ProviderPaymentChargeID: "charge_1",
+		},
+	}
+	expectedPayment := &domain.Payment{
+		TelegramID:       123,
+		PlanName:         "Basic",
+		TotalAmount:      499,
+		Currency:         "USD",
+		ProviderChargeID: "charge_1",
+		TelegramChargeID: "tg_charge_1",
+	}
+
+	payments.On("ProcessPayment", mock.Anything, expectedPayment).
+		Return(&domain.User{TelegramID: 123, Status: domain.UserStatusActive, QuotaLimit: 1024}, nil).Once()
+	payments.On("ProcessPayment", mock.Anything, expectedPayment).
+		Return(nil, domain.ErrPaymentAlreadyProcessed).Once()
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).Return(tgbotapi.Message{}, nil)
+
+	require.NoError(t, handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message}))
+	// A redelivered payment is ignored without a second confirmation
+	require.NoError(t, handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message}))
+
+	payments.AssertExpectations(t)
+	mockBotAPI.AssertNumberOfCalls(t, "Send", 1)
+}
+
+// MockGateway is a mock implementation of domain.Gateway
+type MockGateway struct {
+	mock.Mock
+}
+
+func (m *MockGateway) PeerStatus(ctx context.Context, telegramID int64) (*domain.PeerStatus, error) {
+	args := m.Called(ctx, telegramID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.PeerStatus), args.Error(1)
+}
+
+func TestHandler_HandleUpdate_ConnectionTest(t *testing.T) {
+	lastHandshake := time.Now().Add(-90 * time.Second)
+
+	tests := []struct {
+		name     string
+		status   *domain.PeerStatus
+		err      error
+		expected string
+	}{
+		{"handshaked", &domain.PeerStatus{LastHandshake: &lastHandshake}, nil, "✅ Your VPN connection works"},
+		{"never connected", &domain.PeerStatus{}, nil, "No handshake yet — import the config"},
+		{"no peer", nil, domain.ErrPeerNotFound, "No VPN config found"},
+		{"gateway unreachable", nil, fmt.Errorf("dial tcp: connection refused"), "Couldn't reach the VPN server"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBotAPI, mockService, handler := setupTestHandler()
+			mockService.On("GetUser", mock.Anything, int64(123)).Return(testUserWithQuota(), nil)
+			gateway := new(MockGateway)
+			gateway.On("PeerStatus", mock.Anything, int64(123)).Return(tt.status, tt.err)
+			handler.SetGateway(gateway)
+
+			var sent tgbotapi.MessageConfig
+			mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+				Run(func(args mock.Arguments) {
+					sent = args.Get(0).(tgbotapi.MessageConfig)
+				}).
+				Return(tgbotapi.Message{}, nil)
+
+			message := &tgbotapi.Message{
+				Text: "/test",
+				From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+				Chat: &tgbotapi.Chat{ID: 456},
+			}
+			err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+			require.NoError(t, err)
+			assert.Contains(t, sent.Text, tt.expected)
+			gateway.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandler_HandleUpdate_ConnectionTestWithoutGateway(t *testing.T) {
+	mockBotAPI, _, handler := setupTestHandler()
+
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	message := &tgbotapi.Message{
+		Text: "/test",
+		From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+	require.NoError(t, err)
+	assert.Contains(t, sent.Text, "Connection test is not available")
+}
+
+// testUserWithQuota returns an active user with data left
+func testUserWithQuota() *domain.User {
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.ActivateTrial()
+	return user
+}
+
+func TestHandler_RequireQuota_AtLimit(t *testing.T) {
+	commands := []string{"/test", "/getconfig"}
+
+	for _, command := range commands {
+		t.Run(command, func(t *testing.T) {
+			mockBotAPI, mockService, handler := setupTestHandler()
+			setTestPlans(t, handler, domain.Plan{Name: "Basic", QuotaLimit: 1024, Price: 4.99, Currency: "USD"})
+			gateway := new(MockGateway)
+			handler.SetGateway(gateway)
+			vpn := new(MockVPNService)
+			handler.SetVPNService(vpn)
+
+			user := testUserWithQuota()
+			user.QuotaUsed = user.QuotaLimit
+			mockService.On("GetUser", mock.Anything, int64(123)).Return(user, nil)
+
+			var sent tgbotapi.MessageConfig
+			mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+				Run(func(args mock.Arguments) {
+					sent = args.Get(0).(tgbotapi.MessageConfig)
+				}).
+				Return(tgbotapi.Message{}, nil)
+
+			message := &tgbotapi.Message{
+				Text: command,
+				From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+				Chat: &tgbotapi.Chat{ID: 456},
+			}
+			require.NoError(t, handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message}))
+
+			assert.Contains(t, sent.Text, "You have used all")
+			assert.Contains(t, sent.Text, "upgrading to one of the plans")
+			keyboard := sent.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup)
+			require.Len(t, keyboard.InlineKeyboard, 2)
+			assert.Equal(t, "plan:Basic", *keyboard.InlineKeyboard[0][0].CallbackData)
+			assert.Equal(t, "account", *keyboard.InlineKeyboard[1][0].CallbackData)
+			gateway.AssertNotCalled(t, "PeerStatus", mock.Anything, mock.Anything)
+			vpn.AssertNotCalled(t, "GenerateConfig", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestHandler_RequireQuota(t *testing.T) {
+	_, _, handler := setupTestHandler()
+
+	user := testUserWithQuota()
+	_, _, ok := handler.requireQuota(user, "en")
+	assert.True(t, ok)
+
+	// Without plans the user is pointed to support
+	user.QuotaUsed = user.QuotaLimit
+	text, keyboard, ok := handler.requireQuota(user, "en")
+	assert.False(t, ok)
+	assert.Contains(t, text, "Contact support")
+	require.Len(t, keyboard.InlineKeyboard, 1)
+	assert.Equal(t, "account", *keyboard.InlineKeyboard[0][0].CallbackData)
+
+	// The prompt is in the user's language
+	text, _, _ = handler.requireQuota(user, "ru")
+	assert.Contains(t, text, "Вы израсходовали все")
+	assert.Contains(t, text, "обратитесь в поддержку")
+}
+
+func testUsers(from, n int) []*domain.User {
+	users := make([]*domain.User, 0, n)
+	for i := from; i < from+n; i++ {
+		users = append(users, domain.NewUser(int64(1000+i), fmt.Sprintf("user%d", i), "Test", "User"))
+	}
+	return users
+}
+
+// snapshots returns the read models the user service lists users as
+func snapshots(users ...*domain.User) []*domain.UserSnapshot {
+	result := make([]*domain.UserSnapshot, len(users))
+	for i, user := range users {
+		result[i] = domain.NewUserSnapshot(user)
+	}
+	return result
+}
+
+func TestHandler_HandleUpdate_UsersCommand(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+	handler.SetAdminIDs([]int64{123})
+
+	users := testUsers(10, 10)
+	unreachableAt := time.Now()
+	users[1].UnreachableAt = &unreachableAt
+	mockService.On("CountUsers", mock.Anything).Return(int64(25), nil)
+	mockService.On("ListUsers", mock.Anything, 10, 10).Return(snapshots(users...), nil)
+
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	message := &tgbotapi.Message{
+		Text: "/users 2",
+		From: &tgbotapi.User{ID: 123, FirstName: "Admin"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+	require.NoError(t, err)
+	assert.Contains(t, sent.Text, "page 2 of 3, 25 total")
+	assert.Contains(t, sent.Text, "1010 @user10 · inactive")
+	assert.NotContains(t, sent.Text, "@user10 · inactive · 0 B / 50.0 MB · unreachable")
+	assert.Contains(t, sent.Text, "@user11 · inactive · 0 B / 50.0 MB · unreachable")
+
+	keyboard := sent.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup)
+	require.Len(t, keyboard.InlineKeyboard, 1)
+	row := keyboard.InlineKeyboard[0]
+	require.Len(t, row, 3)
+	assert.Equal(t, "users:0", *row[0].CallbackData)
+	assert.Equal(t, "users:10", *row[1].CallbackData)
+	assert.Equal(t, "users:20", *row[2].CallbackData)
+	mockService.AssertExpectations(t)
+}
+
+func TestHandler_HandleUpdate_UsersCommand_NonAdmin(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+	handler.SetAdminIDs([]int64{999})
+
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	message := &tgbotapi.Message{
+		Text: "/users",
+		From: &tgbotapi.User{ID: 123, FirstName: "User"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+	require.NoError(t, err)
+	assert.Contains(t, sent.Text, "Unknown command")
+	mockService.AssertNotCalled(t, "ListUsers", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestHandler_HandleCallback_UsersPage(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+	handler.SetAdminIDs([]int64{123})
+
+	mockService.On("CountUsers", mock.Anything).Return(int64(25), nil)
+	mockService.On("ListUsers", mock.Anything, 20, 10).Return(snapshots(testUsers(20, 5)...), nil)
+
+	var edit tgbotapi.EditMessageTextConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.EditMessageTextConfig")).
+		Run(func(args mock.Arguments) {
+			edit = args.Get(0).(tgbotapi.EditMessageTextConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+	mockBotAPI.On("Request", mock.AnythingOfType("tgbotapi.CallbackConfig")).Return(&tgbotapi.APIResponse{Ok: true}, nil)
+
+	callback := &tgbotapi.CallbackQuery{
+		ID:      "callback",
+		From:    &tgbotapi.User{ID: 123, FirstName: "Admin"},
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 456}, MessageID: 789},
+		Data:    "users:20",
+	}
+	err := handler.HandleCallback(context.Background(), callback)
+
+	require.NoError(t, err)
+	assert.Equal(t, 789, edit.MessageID)
+	assert.Contains(t, edit.Text, "page 3 of 3, 25 total")
+	row := edit.ReplyMarkup.InlineKeyboard[0]
+	require.Len(t, row, 2)
+	assert.Equal(t, "users:10", *row[0].CallbackData)
+	assert.Equal(t, "users:20", *row[1].CallbackData)
+	mockBotAPI.AssertExpectations(t)
+}
+
+// fakeAuditLogRepository keeps audit entries in memory, oldest first
+type fakeAuditLogRepository struct {
+	entries []*domain.AuditLog
+}
+
+func (r *fakeAuditLogRepository) WriteAudit(ctx context.Context, audit *domain.AuditLog) error {
+	r.entries = append(r.entries, audit)
+	return nil
+}
+
+func (r *fakeAuditLogRepository) ListAuditByUser(ctx context.Context, userID int64, limit int) ([]*domain.AuditLog, error) {
+	var audits []*domain.AuditLog
+	for i := len(r.entries) - 1; i >= 0 && len(audits) < limit; i-- {
+		if r.entries[i].UserID == userID {
+			audits = append(audits, r.entries[i])
+		}
+	}
+	return audits, nil
+}
+
+// newTestAuditLogs records n command audits for user 123, the last one with long details
+func newTestAuditLogs(n int) *fakeAuditLogRepository {
+	repo := &fakeAuditLogRepository{}
+	start := time.Date(2025, 1, 2, 15, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		repo.entries = append(repo.entries, &domain.AuditLog{
+			UserID:    123,
+			Action:    fmt.Sprintf("action_%d", i),
+			Timestamp: start.Add(time.Duration(i) * time.Minute),
+			Success:   i%2 == 0,
+			Details:   `{"command":"start"}`,
+		})
+	}
+	repo.entries[n-1].Details = strings.Repeat("x", 500)
+	return repo
+}
+
+func TestHandler_HandleUpdate_AuditCommand(t *testing.T) {
+	mockBotAPI, _, handler := setupTestHandler()
+	handler.SetAdminIDs([]int64{1})
+	handler.SetAuditLogRepository(newTestAuditLogs(12))
+
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+		Text: "/audit 123",
+		From: &tgbotapi.User{ID: 1, FirstName: "Admin"},
+		Chat: &tgbotapi.Chat{ID: 1},
+	}})
+
+	require.NoError(t, err)
+	assert.Contains(t, sent.Text, "Audit history for 123 (page 1)")
+	assert.Contains(t, sent.Text, "2025-01-02 15:11:00 ❌ action_11")
+	assert.Contains(t, sent.Text, "2025-01-02 15:10:00 ✅ action_10")
+	assert.Less(t, strings.Index(sent.Text, "action_11"), strings.Index(sent.Text, "action_10"), "newest entry should be listed first")
+	assert.NotContains(t, sent.Text, "action_1\n", "older entries are on the next page")
+	assert.Contains(t, sent.Text, strings.Repeat("x", maxAuditDetailsLength-3)+"...")
+	assert.NotContains(t, sent.Text, strings.Repeat("x", maxAuditDetailsLength))
+
+	row := sent.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup).InlineKeyboard[0]
+	require.Len(t, row, 2)
+	assert.Equal(t, "audit:123:0", *row[0].CallbackData)
+	assert.Equal(t, "audit:123:10", *row[1].CallbackData)
+}
+
+func TestHandler_HandleCallback_AuditPage(t *testing.T) {
+	mockBotAPI, _, handler := setupTestHandler()
+	handler.SetAdminIDs([]int64{1})
+	handler.SetAuditLogRepository(newTestAuditLogs(12))
+
+	var edit tgbotapi.EditMessageTextConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.EditMessageTextConfig")).
+		Run(func(args mock.Arguments) {
+			edit = args.Get(0).(tgbotapi.EditMessageTextConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+	mockBotAPI.On("Request", mock.AnythingOfType("tgbotapi.CallbackConfig")).Return(&tgbotapi.APIResponse{Ok: true}, nil)
+
+	err := handler.HandleCallback(context.Background(), &tgbotapi.CallbackQuery{
+		ID:      "callback",
+		From:    &tgbotapi.User{ID: 1, FirstName: "Admin"},
+		Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1}, MessageID: 789},
+		Data:    "audit:123:10",
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 789, edit.MessageID)
+	assert.Contains(t, edit.Text, "(page 2)")
+	assert.Contains(t, edit.Text, "action_1\n")
+	assert.Contains(t, edit.Text, "action_0\n")
+	assert.NotContains(t, edit.Text, "action_2\n")
+	row := edit.ReplyMarkup.InlineKeyboard[0]
+	require.Len(t, row, 2)
+	assert.Equal(t, "audit:123:0", *row[0].CallbackData)
+	assert.Equal(t, "audit:123:10", *row[1].CallbackData)
+	mockBotAPI.AssertExpectations(t)
+}
+
+func TestHandler_HandleUpdate_AuditCommand_Rejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		fromID   int64
+		expected string
+	}{
+		{name: "non-admin", text: "/audit 123", fromID: 123, expected: "Unknown command"},
+		{name: "missing id", text: "/audit", fromID: 1, expected: `Usage: /audit <telegram\_id\>`},
+		{name: "invalid id", text: "/audit abc", fromID: 1, expected: `Usage: /audit <telegram\_id\>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBotAPI, _, handler := setupTestHandler()
+			handler.SetAdminIDs([]int64{1})
+			handler.SetAuditLogRepository(newTestAuditLogs(1))
+
+			var sent tgbotapi.MessageConfig
+			mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+				Run(func(args mock.Arguments) {
+					sent = args.Get(0).(tgbotapi.MessageConfig)
+				}).
+				Return(tgbotapi.Message{}, nil)
+
+			err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: &tgbotapi.Message{
+				Text: tt.text,
+				From: &tgbotapi.User{ID: tt.fromID, FirstName: "Test"},
+				Chat: &tgbotapi.Chat{ID: 456},
+			}})
+
+			require.NoError(t, err)
+			assert.Contains(t, sent.Text, tt.expected)
+			assert.NotContains(t, sent.Text, "Audit history")
+		})
+	}
+}
+
+func TestHandler_HandleUpdate_TopCommand(t *testing.T) {
+	heavy := domain.NewUser(1001, "heavy", "Heavy", "User")
+	heavy.QuotaLimit = 100 * 1024 * 1024
+	heavy.QuotaUsed = 75 * 1024 * 1024
+	light := domain.NewUser(1002, "", "Light", "User")
+	light.QuotaLimit = 100 * 1024 * 1024
+	light.QuotaUsed = 10 * 1024 * 1024
+
+	tests := []struct {
+		name      string
+		anonymize bool
+		expected  []string
+		hidden    string
+	}{
+		{"with usernames", false, []string{"1. @heavy\n▓▓▓▓▓▓▓▓░░ 75% · 75.0 MB / 100.0 MB", "2. 1002\n▓░░░░░░░░░ 10%"}, ""},
+		{"anonymized", true, []string{"1. user-", "2. user-"}, "heavy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBotAPI, mockService, handler := setupTestHandler()
+			handler.SetAdminIDs([]int64{123})
+			handler.SetAnonymizeUsernames(tt.anonymize)
+			mockService.On("TopByUsage", mock.Anything, 5).Return(snapshots(heavy, light), nil)
+
+			var sent tgbotapi.MessageConfig
+			mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+				Run(func(args mock.Arguments) {
+					sent = args.Get(0).(tgbotapi.MessageConfig)
+				}).
+				Return(tgbotapi.Message{}, nil)
+
+			message := &tgbotapi.Message{
+				Text: "/top 5",
+				From: &tgbotapi.User{ID: 123, FirstName: "Admin"},
+				Chat: &tgbotapi.Chat{ID: 456},
+			}
+			err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+			require.NoError(t, err)
+			assert.Contains(t, sent.Text, "Top 5 users by usage")
+			for _, expected := range tt.expected {
+				assert.Contains(t, sent.Text, expected)
+			}
+			if tt.hidden != "" {
+				assert.NotContains(t, sent.Text, tt.hidden)
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandler_HandleUpdate_TopCommand_InvalidArgs(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+	handler.SetAdminIDs([]int64{123})
+
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	message := &tgbotapi.Message{
+		Text: "/top 500",
+		From: &tgbotapi.User{ID: 123, FirstName: "Admin"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+	require.NoError(t, err)
+	assert.Contains(t, sent.Text, `Usage: /top \[1\-50\]`)
+	mockService.AssertNotCalled(t, "TopByUsage", mock.Anything, mock.Anything)
+}
+
+func TestHandler_HandleUpdate_AlertAtCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		pct      int
+		expected string
+	}{
+		{name: "sets a threshold", text: "/alertat 60", pct: 60, expected: "used 60% of your data"},
+		{name: "accepts a percent sign", text: "/alertat 75%", pct: 75, expected: "used 75% of your data"},
+		{name: "restores the defaults", text: "/alertat off", pct: 0, expected: "default usage levels"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBotAPI, mockService, handler := setupTestHandler()
+			mockService.On("SetAlertThreshold", mock.Anything, int64(123), tt.pct).Return(nil).Once()
+
+			var sent tgbotapi.MessageConfig
+			mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+				Run(func(args mock.Arguments) {
+					sent = args.Get(0).(tgbotapi.MessageConfig)
+				}).
+				Return(tgbotapi.Message{}, nil)
+
+			message := &tgbotapi.Message{
+				Text: tt.text,
+				From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+				Chat: &tgbotapi.Chat{ID: 456},
+			}
+			err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+			require.NoError(t, err)
+			assert.Contains(t, sent.Text, tt.expected)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandler_HandleUpdate_AlertAtCommand_InvalidPercentage(t *testing.T) {
+	for _, text := range []string{"/alertat", "/alertat 0", "/alertat 100", "/alertat lots"} {
+		t.Run(text, func(t *testing.T) {
+			mockBotAPI, mockService, handler := setupTestHandler()
+
+			var sent tgbotapi.MessageConfig
+			mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+				Run(func(args mock.Arguments) {
+					sent = args.Get(0).(tgbotapi.MessageConfig)
+				}).
+				Return(tgbotapi.Message{}, nil)
+
+			message := &tgbotapi.Message{
+				Text: text,
+				From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+				Chat: &tgbotapi.Chat{ID: 456},
+			}
+			err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+			require.NoError(t, err)
+			assert.Contains(t, sent.Text, `Usage: /alertat <1\-99\|off\>`)
+			mockService.AssertNotCalled(t, "SetAlertThreshold", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestHandler_HandleUpdate_TimezoneCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		timezone string
+		expected string
+	}{
+		{name: "sets a timezone", text: "/timezone Europe/Moscow", timezone: "Europe/Moscow", expected: `Your timezone is now Europe/Moscow\.`},
+		{name: "clears the timezone", text: "/timezone off", timezone: "", expected: "Your timezone was cleared"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBotAPI, mockService, handler := setupTestHandler()
+			mockService.On("SetTimezone", mock.Anything, int64(123), tt.timezone).Return(nil).Once()
+
+			var sent tgbotapi.MessageConfig
+			mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+				Run(func(args mock.Arguments) {
+					sent = args.Get(0).(tgbotapi.MessageConfig)
+				}).
+				Return(tgbotapi.Message{}, nil)
+
+			message := &tgbotapi.Message{
+				Text: tt.text,
+				From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+				Chat: &tgbotapi.Chat{ID: 456},
+			}
+			err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+			require.NoError(t, err)
+			assert.Contains(t, sent.Text, tt.expected)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandler_HandleUpdate_TimezoneCommand_Invalid(t *testing.T) {
+	for _, text := range []string{"/timezone", "/timezone Mars/Olympus"} {
+		t.Run(text, func(t *testing.T) {
+			mockBotAPI, mockService, handler := setupTestHandler()
+
+			var sent tgbotapi.MessageConfig
+			mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+				Run(func(args mock.Arguments) {
+					sent = args.Get(0).(tgbotapi.MessageConfig)
+				}).
+				Return(tgbotapi.Message{}, nil)
+
+			message := &tgbotapi.Message{
+				Text: text,
+				From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+				Chat: &tgbotapi.Chat{ID: 456},
+			}
+			err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+			require.NoError(t, err)
+			assert.Contains(t, sent.Text, `Usage: /timezone <name\|off\>`)
+			mockService.AssertNotCalled(t, "SetTimezone", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+// MockVPNService is a mock implementation of domain.VPNService
+type MockVPNService struct {
+	mock.Mock
+}
+
+func (m *MockVPNService) GenerateConfig(ctx context.Context, telegramID int64) (*domain.VPNConfig, error) {
+	args := m.Called(ctx, telegramID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.VPNConfig), args.Error(1)
+}
+
+func (m *MockVPNService) RevokeConfig(ctx context.Context, telegramID int64) error {
+	args := m.Called(ctx, telegramID)
+	return args.Error(0)
+}
+
+func TestHandler_HandleUpdate_GetConfig(t *testing.T) {
+	mockBotAPI, mockService, handler := setupTestHandler()
+	mockService.On("GetUser", mock.Anything, int64(123)).Return(testUserWithQuota(), nil)
+	vpn := new(MockVPNService)
+	config := &domain.VPNConfig{PrivateKey: "client-private", Address: "10.8.0.2/32", Endpoint: "vpn.example.com:51820"}
+	vpn.On("GenerateConfig", mock.Anything, int64(123)).Return(config, nil)
+	handler.SetVPNService(vpn)
+
+	var sent tgbotapi.DocumentConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.DocumentConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.DocumentConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	message := &tgbotapi.Message{
+		Text: "/getconfig",
+		From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(456), sent.ChatID)
+	file := sent.File.(tgbotapi.FileBytes)
+	assert.Equal(t, "arcanus-vpn.conf", file.Name)
+	assert.Equal(t, config.Render(), string(file.Bytes))
+	assert.Contains(t, sent.Caption, "Import it into the WireGuard app")
+	vpn.AssertExpectations(t)
+}
+
+func TestHandler_HandleUpdate_GetConfig_Rejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"not registered", domain.UserNotFoundError{TelegramID: 123}, "Use /start to register first"},
+		{"inactive", domain.ErrUserNotActive, "Your account is not active"},
+		{"over quota", domain.QuotaExceededError{Used: 100, Limit: 100}, "You have used all of your data"},
+		{"failure", fmt.Errorf("failed to store VPN public key: database is locked"), "Failed to generate your VPN config"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBotAPI, mockService, handler := setupTestHandler()
+			mockService.On("GetUser", mock.Anything, int64(123)).Return(testUserWithQuota(), nil)
+			vpn := new(MockVPNService)
+			vpn.On("GenerateConfig", mock.Anything, int64(123)).Return(nil, tt.err)
+			handler.SetVPNService(vpn)
+
+			var sent tgbotapi.MessageConfig
+			mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+				Run(func(args mock.Arguments) {
+					sent = args.Get(0).(tgbotapi.MessageConfig)
+				}).
+				Return(tgbotapi.Message{}, nil)
+
+			message := &tgbotapi.Message{
+				Text: "/getconfig",
+				From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+				Chat: &tgbotapi.Chat{ID: 456},
+			}
+			err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+			require.NoError(t, err)
+			assert.Contains(t, sent.Text, tt.expected)
+			mockBotAPI.AssertNotCalled(t, "Send", mock.AnythingOfType("tgbotapi.DocumentConfig"))
+		})
+	}
+}
+
+func TestHandler_HandleUpdate_GetConfigAfterQuotaExceeded(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, repository.AutoMigrate(context.Background(), db))
+	userRepo := repository.NewUserRepository(db)
+	require.NoError(t, userRepo.Create(context.Background(), testUserWithQuota()))
+
+	vpnService := service.NewVPNService(userRepo, service.VPNServer{
+		Endpoint:     "vpn.example.com:51820",
+		PublicKey:    "c2VydmVyLXB1YmxpYy1rZXktMzItYnl0ZXMtbG9uZyE=",
+		ClientSubnet: netip.MustParsePrefix("10.8.0.0/24"),
+	})
+	userService := service.NewUserServiceWithEvents(userRepo, nil, nil)
+	userService.SetConfigRevoker(vpnService)
+
+	_, err = vpnService.GenerateConfig(context.Background(), 123)
+	require.NoError(t, err)
+
+	user, err := userRepo.GetByTelegramID(context.Background(), 123)
+	require.NoError(t, err)
+	err = userService.UpdateQuota(context.Background(), 123, user.QuotaLimit+1)
+	require.ErrorIs(t, err, domain.ErrQuotaExceeded)
+
+	// The reported usage is stored and the issued config revoked
+	user, err = userRepo.GetByTelegramID(context.Background(), 123)
+	require.NoError(t, err)
+	assert.Equal(t, user.QuotaLimit+1, user.QuotaUsed)
+	assert.Empty(t, user.VPNPublicKey)
+
+	mockBotAPI := new(MockBotAPI)
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	handler := NewHandler(mockBotAPI, userService, logger)
+	handler.SetVPNService(vpnService)
+
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	message := &tgbotapi.Message{
+		Text: "/getconfig",
+		From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}
+	err = handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+	require.NoError(t, err)
+	assert.Contains(t, sent.Text, "You have used all")
+	mockBotAPI.AssertNotCalled(t, "Send", mock.AnythingOfType("tgbotapi.DocumentConfig"))
+
+	user, err = userRepo.GetByTelegramID(context.Background(), 123)
+	require.NoError(t, err)
+	assert.Empty(t, user.VPNPublicKey, "no new config was issued")
+}
+
+func TestHandler_HandleUpdate_GetConfigWithoutVPN(t *testing.T) {
+	mockBotAPI, _, handler := setupTestHandler()
+
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	message := &tgbotapi.Message{
+		Text: "/getconfig",
+		From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+	require.NoError(t, err)
+	assert.Contains(t, sent.Text, "VPN configs are not available")
+}
+
+// fakeConfigReloader records reloads and reports fixed changes
+type fakeConfigReloader struct {
+	changes []domain.SettingChange
+	err     error
+	reloads int
+}
+
+func (r *fakeConfigReloader) Reload(ctx context.Context) ([]domain.SettingChange, error) {
+	r.reloads++
+	return r.changes, r.err
+}
+
+func TestHandler_HandleUpdate_ReloadConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		reloader *fakeConfigReloader
+		expected []string
+	}{
+		{
+			name: "reports changed values",
+			reloader: &fakeConfigReloader{changes: []domain.SettingChange{
+				{Key: "log_level", Old: "info", New: "debug"},
+				{Key: "maintenance_mode", New: "true"},
+			}},
+			expected: []string{"Config reloaded", "log_level: info → debug", "maintenance_mode: (unset) → true"},
+		},
+		{name: "nothing changed", reloader: &fakeConfigReloader{}, expected: []string{"No values changed."}},
+		{name: "reload fails", reloader: &fakeConfigReloader{err: fmt.Errorf("database unavailable")}, expected: []string{"Failed to reload config"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBotAPI, _, handler := setupTestHandler()
+			handler.SetAdminIDs([]int64{123})
+			handler.SetConfigReloader(tt.reloader)
+
+			var sent tgbotapi.MessageConfig
+			mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+				Run(func(args mock.Arguments) {
+					sent = args.Get(0).(tgbotapi.MessageConfig)
+				}).
+				Return(tgbotapi.Message{}, nil)
+
+			message := &tgbotapi.Message{
+				Text: "/reloadconfig",
+				From: &tgbotapi.User{ID: 123, FirstName: "Admin"},
+				Chat: &tgbotapi.Chat{ID: 456},
+			}
+			err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+			require.NoError(t, err)
+			assert.Equal(t, 1, tt.reloader.reloads)
+			for _, expected := range tt.expected {
+				assert.Contains(t, sent.Text, expected)
+			}
+		})
+	}
+}
+
+func TestHandler_HandleUpdate_Config(t *testing.T) {
+	cfg := &config.Config{
+		TelegramToken:     "123456:telegram-token",
+		KafkaSaslPassword: "kafka-password",
+		Environment:       "production",
+		LogLevel:          "info",
+	}
+	tests := []struct {
+		name        string
+		fromID      int64
+		summary     string
+		contains    []string
+		notContains []string
+	}{
+		{
+			name:        "admin sees redacted config",
+			fromID:      123,
+			summary:     cfg.SummaryRedacted(),
+			contains:    []string{"Effective config", "ENVIRONMENT=production", "LOG_LEVEL=info", "TELEGRAM_BOT_TOKEN=[REDACTED]", "KAFKA_SASL_PASSWORD=[REDACTED]"},
+			notContains: []string{"telegram-token", "kafka-password"},
+		},
+		{name: "not configured", fromID: 123, contains: []string{"Config is not available\\."}},
+		{name: "non-admin", fromID: 789, summary: cfg.SummaryRedacted(), contains: []string{"Unknown command"}, notContains: []string{"ENVIRONMENT"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBotAPI, _, handler := setupTestHandler()
+			handler.SetAdminIDs([]int64{123})
+			handler.SetConfigSummary(tt.summary)
+
+			var sent tgbotapi.MessageConfig
+			mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+				Run(func(args mock.Arguments) {
+					sent = args.Get(0).(tgbotapi.MessageConfig)
+				}).
+				Return(tgbotapi.Message{}, nil)
+
+			message := &tgbotapi.Message{
+				Text: "/config",
+				From: &tgbotapi.User{ID: tt.fromID, FirstName: "Admin"},
+				Chat: &tgbotapi.Chat{ID: 456},
+			}
+			err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+			require.NoError(t, err)
+			for _, expected := range tt.contains {
+				assert.Contains(t, sent.Text, expected)
+			}
+			for _, unexpected := range tt.notContains {
+				assert.NotContains(t, sent.Text, unexpected)
+			}
+		})
+	}
+}
+
+func TestHandler_HandleUpdate_ReloadConfig_NonAdmin(t *testing.T) {
+	mockBotAPI, _, handler := setupTestHandler()
+	reloader := &fakeConfigReloader{}
+	handler.SetConfigReloader(reloader)
+
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	message := &tgbotapi.Message{
+		Text: "/reloadconfig",
+		From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+		Chat: &tgbotapi.Chat{ID: 456},
+	}
+	err := handler.HandleUpdate(context.Background(), tgbotapi.Update{Message: message})
+
+	require.NoError(t, err)
+	assert.Contains(t, sent.Text, "Unknown command")
+	assert.Zero(t, reloader.reloads)
+}
@@ -0,0 +1,128 @@
+package bot
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/i18n"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/utils"
+)
+
+//go:embed templates/help.tmpl
+var defaultHelpTemplate string
+
+// DefaultSupportContact is shown in the help text when no contact is configured
+const DefaultSupportContact = "@support"
+
+// HelpCommand describes a command listed in the help text
+type HelpCommand struct {
+	Name        string
+	Description string
+}
+
+// DefaultHelpCommands are the user-facing commands listed in the help text. Their
+// descriptions are the help.command.<name> messages of the catalogs
+var DefaultHelpCommands = []string{
+	"start", "account", "getconfig", "test", "language", "alertat", "timezone", "help", "deleteaccount",
+}
+
+// HelpData is the data available to the help template. The template is MarkdownV2;
+// its data is escaped, so only the template's own text needs escaping. The template
+// can also call t with a message id to get that message in the user's language, escaped
+type HelpData struct {
+	Commands       []HelpCommand
+	SupportContact string
+	TrialQuota     string
+}
+
+// HelpRenderer renders the help text shared by every help entry point, in the
+// language of the user asking for it
+type HelpRenderer struct {
+	tmpl *template.Template
+	data HelpData
+	// fallback is the help text in the default language, used if rendering fails
+	fallback string
+}
+
+// NewHelpRenderer creates a help renderer. An empty templatePath uses the
+// built-in template; otherwise the template is read from the given file
+func NewHelpRenderer(templatePath, supportContact string, trialQuota int64) (*HelpRenderer, error) {
+	source := defaultHelpTemplate
+	if templatePath != "" {
+		content, err := os.ReadFile(templatePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read help template: %w", err)
+		}
+		source = string(content)
+	}
+
+	// t is bound to the user's language when the help is rendered
+	tmpl, err := template.New("help").Funcs(template.FuncMap{"t": func(string) string { return "" }}).Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse help template: %w", err)
+	}
+
+	if supportContact == "" {
+		supportContact = DefaultSupportContact
+	}
+
+	renderer := &HelpRenderer{
+		tmpl: tmpl,
+		data: HelpData{
+			SupportContact: utils.EscapeMarkdown(supportContact),
+			TrialQuota:     utils.EscapeMarkdown(formatBytes(trialQuota)),
+		},
+	}
+	renderer.fallback, err = renderer.render(i18n.Default(), i18n.DefaultLanguage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render help template: %w", err)
+	}
+	return renderer, nil
+}
+
+// render executes the template with messages in lang
+func (r *HelpRenderer) render(tr *i18n.Translator, lang string) (string, error) {
+	translate := func(id string) string {
+		return utils.EscapeMarkdown(tr.Get(lang, id))
+	}
+
+	data := r.data
+	data.Commands = make([]HelpCommand, len(DefaultHelpCommands))
+	for i, name := range DefaultHelpCommands {
+		data.Commands[i] = HelpCommand{Name: utils.EscapeMarkdown(name), Description: translate("help.command." + name)}
+	}
+
+	tmpl, err := r.tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := tmpl.Funcs(template.FuncMap{"t": translate}).Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// DefaultHelpRenderer creates a help renderer using the built-in template and defaults
+func DefaultHelpRenderer() *HelpRenderer {
+	renderer, err := NewHelpRenderer("", DefaultSupportContact, domain.DefaultQuotaLimit)
+	if err != nil {
+		// The embedded template is part of the binary, so this is a programming error
+		panic(err)
+	}
+	return renderer
+}
+
+// Render returns the help text with the messages of tr in lang. Should rendering fail
+// it returns the help text in the default language
+func (r *HelpRenderer) Render(tr *i18n.Translator, lang string) string {
+	text, err := r.render(tr, lang)
+	if err != nil {
+		return r.fallback
+	}
+	return text
+}
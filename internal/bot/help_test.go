@@ -0,0 +1,155 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/i18n"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHelpRenderer_Default(t *testing.T) {
+	text := DefaultHelpRenderer().Render(i18n.Default(), "en")
+
+	assert.Contains(t, text, "Arcanus VPN Bot Help")
+	for _, name := range DefaultHelpCommands {
+		assert.Contains(t, text, "/"+name+` \- `+i18n.Default().Get("en", "help.command."+name))
+	}
+	assert.Contains(t, text, `50\.0 MB free trial`)
+	assert.Contains(t, text, `Privacy\-focused`, "catalog messages are escaped for MarkdownV2")
+	assert.Contains(t, text, "contact @support")
+}
+
+func TestHelpRenderer_Language(t *testing.T) {
+	renderer := DefaultHelpRenderer()
+
+	text := renderer.Render(i18n.Default(), "ru")
+	assert.Contains(t, text, "Справка Arcanus VPN Bot")
+	assert.Contains(t, text, `/deleteaccount \- Удалить аккаунт и данные`)
+	assert.Contains(t, text, `50\.0 MB бесплатного пробного трафика`)
+	assert.Contains(t, text, "По техническим вопросам пишите @support")
+	assert.NotContains(t, text, "Commands:")
+
+	assert.Equal(t, renderer.Render(i18n.Default(), "en"), renderer.Render(i18n.Default(), "xx"), "languages without a catalog get the default")
+}
+
+func TestHelpRenderer_SupportContactAndQuota(t *testing.T) {
+	renderer, err := NewHelpRenderer("", "@arcanus_help", 100*1024*1024)
+	require.NoError(t, err)
+
+	text := renderer.Render(i18n.Default(), "en")
+	assert.Contains(t, text, `contact @arcanus\_help`, "template data is escaped for MarkdownV2")
+	assert.Contains(t, text, `100\.0 MB free trial`)
+}
+
+func TestHelpRenderer_CustomTemplate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "help.tmpl")
+	content := "Need help? Ask {{.SupportContact}}\n{{range .Commands}}/{{.Name}} {{end}}\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	renderer, err := NewHelpRenderer(path, "@ops", 1024)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Need help? Ask @ops\n/start /account /getconfig /test /language /alertat /timezone /help /deleteaccount", renderer.Render(i18n.Default(), "en"))
+}
+
+func TestHelpRenderer_InvalidTemplate(t *testing.T) {
+	_, err := NewHelpRenderer(filepath.Join(t.TempDir(), "missing.tmpl"), "", 1024)
+	assert.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "broken.tmpl")
+	require.NoError(t, os.WriteFile(path, []byte("{{.Unclosed"), 0o600))
+	_, err = NewHelpRenderer(path, "", 1024)
+	assert.Error(t, err)
+}
+
+func TestHelp_AllEntryPointsRenderIdenticalText(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	renderer, err := NewHelpRenderer("", "@arcanus_help", 1024*1024)
+	require.NoError(t, err)
+
+	mockBotAPI := new(MockBotAPI)
+	mockService := new(MockUserService)
+
+	handler := NewHandler(mockBotAPI, mockService, logger)
+	handler.SetHelpRenderer(renderer)
+
+	rateLimiter := NewRateLimiter(DefaultRateLimiterConfig())
+	defer rateLimiter.Stop()
+	middlewareHandler := NewHandlerWithMiddleware(mockBotAPI, mockService, logger, rateLimiter, NewAuditLogger(logger))
+	middlewareHandler.SetHelpRenderer(renderer)
+
+	var texts []string
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			texts = append(texts, args.Get(0).(tgbotapi.MessageConfig).Text)
+		}).
+		Return(tgbotapi.Message{}, nil)
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.EditMessageTextConfig")).
+		Run(func(args mock.Arguments) {
+			texts = append(texts, args.Get(0).(tgbotapi.EditMessageTextConfig).Text)
+		}).
+		Return(tgbotapi.Message{}, nil)
+	mockBotAPI.On("Request", mock.AnythingOfType("tgbotapi.CallbackConfig")).
+		Return(&tgbotapi.APIResponse{Ok: true}, nil)
+	mockService.On("GetUser", mock.Anything, int64(123)).Return(domain.NewUser(123, "", "Test", ""), nil)
+
+	newMessage := func() *tgbotapi.Message {
+		return &tgbotapi.Message{
+			Text: "/help",
+			From: &tgbotapi.User{ID: 123, FirstName: "Test"},
+			Chat: &tgbotapi.Chat{ID: 456},
+		}
+	}
+	newCallback := func() *tgbotapi.CallbackQuery {
+		return &tgbotapi.CallbackQuery{
+			ID:      "callback",
+			From:    &tgbotapi.User{ID: 123, FirstName: "Test"},
+			Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 456}, MessageID: 789},
+			Data:    "help",
+		}
+	}
+
+	ctx := context.Background()
+	require.NoError(t, handler.HandleUpdate(ctx, tgbotapi.Update{Message: newMessage()}))
+	require.NoError(t, handler.HandleCallback(ctx, newCallback()))
+	require.NoError(t, middlewareHandler.HandleUpdate(ctx, tgbotapi.Update{Message: newMessage()}))
+	require.NoError(t, middlewareHandler.HandleCallback(ctx, newCallback()))
+
+	require.Len(t, texts, 4)
+	for _, text := range texts {
+		assert.Equal(t, renderer.Render(i18n.Default(), "en"), text)
+	}
+}
+
+func TestHandler_HandleUpdate_HelpCommandInUserLanguage(t *testing.T) {
+	mockBotAPI, _, handler := setupTestHandler()
+
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	update := tgbotapi.Update{
+		Message: &tgbotapi.Message{
+			Text: "/help",
+			From: &tgbotapi.User{ID: 123, FirstName: "Test", LanguageCode: "ru"},
+			Chat: &tgbotapi.Chat{ID: 456},
+		},
+	}
+
+	require.NoError(t, handler.HandleUpdate(context.Background(), update))
+	assert.Equal(t, DefaultHelpRenderer().Render(i18n.Default(), "ru"), sent.Text)
+	assert.Contains(t, sent.Text, "Справка Arcanus VPN Bot")
+}
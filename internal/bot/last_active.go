@@ -0,0 +1,44 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+)
+
+// lastActiveResolution is how stale a user's stored last activity may get before it
+// is written again, so busy users do not cost a write per update
+const lastActiveResolution = time.Hour
+
+// LastActiveRecorder stores when each registered user last sent the bot an update,
+// which the data retention policy is based on
+type LastActiveRecorder struct {
+	senderRecorder
+	repo domain.UserRepository
+}
+
+// NewLastActiveRecorder creates a new last activity recorder
+func NewLastActiveRecorder(repo domain.UserRepository, logger *logrus.Logger) *LastActiveRecorder {
+	return &LastActiveRecorder{
+		senderRecorder: newSenderRecorder(logger, lastActiveResolution),
+		repo:           repo,
+	}
+}
+
+// Observe records the update as the sender's latest activity, unless it was recorded
+// less than lastActiveResolution ago. Failures are logged and never block update processing
+func (r *LastActiveRecorder) Observe(ctx context.Context, update tgbotapi.Update) {
+	r.observe(ctx, update, func(ctx context.Context, telegramID int64, now time.Time) error {
+		// Users who have not registered yet have no account to record it on. They are not
+		// remembered, so their activity is recorded once they register
+		err := r.repo.UpdateLastActiveAt(ctx, telegramID, now)
+		if err != nil && !errors.Is(err, domain.ErrUserNotFound) {
+			r.logger.WithError(err).WithField("user_id", telegramID).Warn("Failed to record last activity")
+		}
+		return err
+	})
+}
@@ -0,0 +1,64 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupLastActiveRecorder(t *testing.T) (*LastActiveRecorder, *countingRecorderRepository, *fakeClock) {
+	repo, logger, clock := setupSenderRecorderTest(t)
+	recorder := NewLastActiveRecorder(repo, logger)
+	recorder.now = clock.Now
+	return recorder, repo, clock
+}
+
+func TestLastActiveRecorder_RecordsActivity(t *testing.T) {
+	recorder, repo, clock := setupLastActiveRecorder(t)
+	ctx := context.Background()
+	require.NoError(t, repo.Create(ctx, domain.NewUser(123, "user", "Test", "User")))
+	lastActiveAt := func() time.Time {
+		user, err := repo.GetByTelegramID(ctx, 123)
+		require.NoError(t, err)
+		require.NotNil(t, user.LastActiveAt)
+		return *user.LastActiveAt
+	}
+	first := clock.Now()
+
+	recorder.Observe(ctx, tgbotapi.Update{Message: &tgbotapi.Message{Text: "/account", From: &tgbotapi.User{ID: 123}, Chat: &tgbotapi.Chat{ID: 123}}})
+	assert.True(t, first.Equal(lastActiveAt()))
+
+	// Activity within the resolution is not written again
+	clock.now = clock.now.Add(30 * time.Minute)
+	recorder.Observe(ctx, tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{Data: "account", From: &tgbotapi.User{ID: 123}}})
+	assert.True(t, first.Equal(lastActiveAt()))
+	assert.Equal(t, 1, repo.writes)
+
+	clock.now = clock.now.Add(time.Hour)
+	recorder.Observe(ctx, tgbotapi.Update{Message: &tgbotapi.Message{Text: "/help", From: &tgbotapi.User{ID: 123}, Chat: &tgbotapi.Chat{ID: 123}}})
+	assert.True(t, clock.Now().Equal(lastActiveAt()))
+	assert.Equal(t, 2, repo.writes)
+}
+
+func TestLastActiveRecorder_UnregisteredUsers(t *testing.T) {
+	recorder, repo, clock := setupLastActiveRecorder(t)
+	ctx := context.Background()
+	start := tgbotapi.Update{Message: &tgbotapi.Message{Text: "/start", From: &tgbotapi.User{ID: 123}, Chat: &tgbotapi.Chat{ID: 123}}}
+
+	recorder.Observe(ctx, start)
+
+	// Once the user registers, their next update is recorded
+	require.NoError(t, repo.Create(ctx, domain.NewUser(123, "user", "Test", "User")))
+	clock.now = clock.now.Add(time.Minute)
+	recorder.Observe(ctx, start)
+
+	user, err := repo.GetByTelegramID(ctx, 123)
+	require.NoError(t, err)
+	require.NotNil(t, user.LastActiveAt)
+	assert.True(t, clock.Now().Equal(*user.LastActiveAt))
+}
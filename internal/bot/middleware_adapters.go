@@ -1,26 +1,13 @@
 package bot
 
 import (
+	"context"
 	"time"
 
 	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/middleware"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/session"
 )
 
-// RateLimiterAdapter adapts the bot's RateLimiter to the middleware interface
-type RateLimiterAdapter struct {
-	rateLimiter *RateLimiter
-}
-
-// NewRateLimiterAdapter creates a new rate limiter adapter
-func NewRateLimiterAdapter(rateLimiter *RateLimiter) middleware.RateLimiter {
-	return &RateLimiterAdapter{rateLimiter: rateLimiter}
-}
-
-// Allow checks if a user is allowed to make a request
-func (a *RateLimiterAdapter) Allow(userID int64) bool {
-	return a.rateLimiter.Allow(userID)
-}
-
 // AuditLoggerAdapter adapts the bot's AuditLogger to the middleware interface
 type AuditLoggerAdapter struct {
 	auditLogger *AuditLogger
@@ -31,11 +18,44 @@ func NewAuditLoggerAdapter(auditLogger *AuditLogger) middleware.AuditLogger {
 	return &AuditLoggerAdapter{auditLogger: auditLogger}
 }
 
-// LogAction logs an action performed by a user
-func (a *AuditLoggerAdapter) LogAction(userID int64, action string, timestamp time.Time) {
+// LogAction logs an action performed by a user within their session
+func (a *AuditLoggerAdapter) LogAction(userID int64, username, sessionID, action string, timestamp time.Time) {
 	details := map[string]interface{}{
 		"action": action,
 		"timestamp": timestamp,
+		"event_type": "security",
 	}
-	a.auditLogger.LogSecurityEvent(userID, "", "user_action", details)
-}
\ No newline at end of file
+	a.auditLogger.LogSessionEvent(userID, username, sessionID, "security_user_action", true, nil, details)
+}
+
+// sessionStoreAdapter forwards to the handler's current session store, so the store
+// can be replaced after the middleware chain was built
+type sessionStoreAdapter struct {
+	handler *HandlerWithMiddleware
+}
+
+// Get returns the user's session
+func (a *sessionStoreAdapter) Get(ctx context.Context, userID int64) (*session.Session, error) {
+	return a.handler.sessionStore.Get(ctx, userID)
+}
+
+// Set saves the user's session
+func (a *sessionStoreAdapter) Set(ctx context.Context, userID int64, s *session.Session) error {
+	return a.handler.sessionStore.Set(ctx, userID, s)
+}
+
+// Clear removes the user's session
+func (a *sessionStoreAdapter) Clear(ctx context.Context, userID int64) error {
+	return a.handler.sessionStore.Clear(ctx, userID)
+}
+
+// maintenanceAdapter reads maintenance mode from the handler's current settings store,
+// so the store can be configured after the middleware chain is built
+type maintenanceAdapter struct {
+	handler *Handler
+}
+
+// MaintenanceMode reports whether the bot is in maintenance mode
+func (a *maintenanceAdapter) MaintenanceMode() bool {
+	return a.handler.settings != nil && a.handler.settings.MaintenanceMode()
+}
@@ -0,0 +1,428 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultNotificationRate is how many notifications are sent per second, below
+	// Telegram's limit of about 30 messages per second across chats
+	DefaultNotificationRate = 25
+	// DefaultNotificationQueueSize bounds the number of notifications waiting to be sent
+	DefaultNotificationQueueSize = 10000
+	// DefaultNotificationMaxAttempts is the number of times a notification is tried
+	DefaultNotificationMaxAttempts = 3
+	// defaultNotificationRetryDelay is the delay before the first retry, doubled after each one
+	defaultNotificationRetryDelay = 5 * time.Second
+)
+
+// ErrNotificationQueueFull is returned when a notification cannot be queued
+var ErrNotificationQueueFull = errors.New("notification queue is full")
+
+// ErrNotificationDispatcherStopped is returned when the dispatcher stopped while
+// waiting for room in the queue
+var ErrNotificationDispatcherStopped = errors.New("notification dispatcher stopped")
+
+// NotificationStatus is the outcome of sending a notification
+type NotificationStatus string
+
+const (
+	NotificationSent        NotificationStatus = "sent"
+	NotificationFailed      NotificationStatus = "failed"
+	NotificationUnreachable NotificationStatus = "unreachable" // the user's private chat does not exist
+	NotificationBlocked     NotificationStatus = "blocked"     // the user blocked the bot
+)
+
+// Notification is a message to a user queued by a feature
+type Notification struct {
+	UserID int64
+	// Kind names the feature that queued the notification, e.g. "broadcast"
+	Kind    string
+	Message tgbotapi.Chattable
+	// Critical notifications are sent during quiet hours, others are held until they end
+	Critical bool
+	// Location is the recipient's timezone, in which their quiet hours are kept; nil
+	// keeps them in the dispatcher's quiet hours timezone
+	Location *time.Location
+	// Done, if set, is called with the final outcome after the dispatcher's outcome handler
+	Done func(NotificationOutcome)
+}
+
+// NotificationOutcome is the final result of a notification, after any retries
+type NotificationOutcome struct {
+	UserID   int64
+	Kind     string
+	Status   NotificationStatus
+	Attempts int
+	Err      error
+	At       time.Time
+}
+
+// NotificationStats is a snapshot of the dispatcher counters
+type NotificationStats struct {
+	Queued      int
+	Held        int // optional notifications waiting for quiet hours to end
+	Sent        int64
+	Failed      int64
+	Unreachable int64
+	Blocked     int64
+}
+
+// queuedNotification is a notification waiting in the queue
+type queuedNotification struct {
+	Notification
+	attempts  int
+	notBefore time.Time
+	// heldUntil is when the recipient's quiet hours end, for held notifications
+	heldUntil time.Time
+}
+
+// NotificationDispatcher sends the notifications features enqueue in order, paced to
+// a global rate. Transient Telegram errors are retried from the back of the queue,
+// optional notifications are held during quiet hours, and the outcome of each
+// notification is tracked per user
+type NotificationDispatcher struct {
+	botAPI      BotAPI
+	logger      *logrus.Logger
+	interval    time.Duration
+	maxQueue    int
+	maxAttempts int
+	retryDelay  time.Duration
+	onOutcome   func(NotificationOutcome)
+	quietHours  QuietHours
+
+	mu       sync.Mutex
+	queue    []queuedNotification
+	held     []queuedNotification
+	outcomes map[int64]NotificationOutcome
+	stats    NotificationStats
+	lastSend time.Time
+	// roomFreed is closed, and replaced, whenever a notification leaves the queue
+	roomFreed chan struct{}
+
+	wake     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	now      func() time.Time
+	sleep    func(ctx context.Context, d time.Duration) error
+}
+
+// NewNotificationDispatcher creates a dispatcher sending up to ratePerSecond
+// notifications per second and queueing up to queueSize of them
+func NewNotificationDispatcher(botAPI BotAPI, logger *logrus.Logger, ratePerSecond float64, queueSize int) *NotificationDispatcher {
+	if ratePerSecond <= 0 {
+		ratePerSecond = DefaultNotificationRate
+	}
+	if queueSize < 1 {
+		queueSize = DefaultNotificationQueueSize
+	}
+	return &NotificationDispatcher{
+		botAPI:      botAPI,
+		logger:      logger,
+		interval:    time.Duration(float64(time.Second) / ratePerSecond),
+		maxQueue:    queueSize,
+		maxAttempts: DefaultNotificationMaxAttempts,
+		retryDelay:  defaultNotificationRetryDelay,
+		outcomes:    make(map[int64]NotificationOutcome),
+		roomFreed:   make(chan struct{}),
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+		now:         time.Now,
+		sleep:       sleepContext,
+	}
+}
+
+// SetOutcomeHandler configures a function called with the final outcome of every
+// notification, e.g. to record users who cannot be reached
+func (d *NotificationDispatcher) SetOutcomeHandler(onOutcome func(NotificationOutcome)) {
+	d.onOutcome = onOutcome
+}
+
+// SetQuietHours configures the daily window during which notifications that are
+// not critical are held. The window is kept in each recipient's timezone when the
+// notification carries one, and in the window's own Location otherwise
+func (d *NotificationDispatcher) SetQuietHours(quietHours QuietHours) {
+	d.quietHours = quietHours
+}
+
+// Enqueue queues a notification behind those already queued. It returns
+// ErrNotificationQueueFull when the queue is full
+func (d *NotificationDispatcher) Enqueue(n Notification) error {
+	d.mu.Lock()
+	if len(d.queue)+len(d.held) >= d.maxQueue {
+		d.mu.Unlock()
+		return ErrNotificationQueueFull
+	}
+	d.queue = append(d.queue, queuedNotification{Notification: n})
+	d.mu.Unlock()
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// EnqueueWait queues a notification like Enqueue, but waits for room while the
+// queue is full. It fails when ctx is done or the dispatcher stops first
+func (d *NotificationDispatcher) EnqueueWait(ctx context.Context, n Notification) error {
+	for {
+		d.mu.Lock()
+		roomFreed := d.roomFreed
+		d.mu.Unlock()
+
+		err := d.Enqueue(n)
+		if !errors.Is(err, ErrNotificationQueueFull) {
+			return err
+		}
+
+		select {
+		case <-roomFreed:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-d.stop:
+			return ErrNotificationDispatcherStopped
+		}
+	}
+}
+
+// Outcome returns the outcome of the last notification to the user that finished
+func (d *NotificationDispatcher) Outcome(userID int64) (NotificationOutcome, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	outcome, ok := d.outcomes[userID]
+	return outcome, ok
+}
+
+// Stats returns a snapshot of the dispatcher counters
+func (d *NotificationDispatcher) Stats() NotificationStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stats := d.stats
+	stats.Queued = len(d.queue)
+	stats.Held = len(d.held)
+	return stats
+}
+
+// Drain sends queued notifications until the queue is empty or ctx is done. Held
+// notifications are left for a drain after quiet hours
+func (d *NotificationDispatcher) Drain(ctx context.Context) error {
+	for {
+		n, ok := d.next()
+		if !ok {
+			return nil
+		}
+		if err := d.dispatch(ctx, n); err != nil {
+			// Put the notification back so it is sent by the next drain
+			d.mu.Lock()
+			d.queue = append([]queuedNotification{n}, d.queue...)
+			d.mu.Unlock()
+			return err
+		}
+	}
+}
+
+// Start drains the queue in the background whenever notifications are enqueued,
+// until Stop is called
+func (d *NotificationDispatcher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-d.stop
+		cancel()
+	}()
+
+	go func() {
+		defer close(d.done)
+		for {
+			if err := d.Drain(ctx); err != nil {
+				return
+			}
+
+			// Wake up when the first quiet hours end to send the held notifications
+			release := time.NewTimer(time.Hour)
+			release.Stop()
+			d.mu.Lock()
+			if until, ok := d.nextRelease(); ok {
+				release.Reset(until.Sub(d.now()))
+			}
+			d.mu.Unlock()
+
+			select {
+			case <-d.wake:
+			case <-release.C:
+			case <-d.stop:
+				release.Stop()
+				return
+			}
+			release.Stop()
+		}
+	}()
+}
+
+// Stop stops the background sending started by Start and waits for the notification
+// being sent. Notifications still queued are dropped
+func (d *NotificationDispatcher) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.stop)
+	})
+	<-d.done
+
+	if stats := d.Stats(); stats.Queued+stats.Held > 0 {
+		d.logger.WithFields(logrus.Fields{
+			"queued": stats.Queued,
+			"held":   stats.Held,
+		}).Warn("Notification dispatcher stopped with unsent notifications")
+	}
+}
+
+// next takes the notification at the front of the queue. During the recipient's
+// quiet hours notifications that are not critical are moved aside until the hours
+// end, when they go back to the front of the queue
+func (d *NotificationDispatcher) next() (queuedNotification, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	var released, held []queuedNotification
+	for _, n := range d.held {
+		if now.Before(n.heldUntil) {
+			held = append(held, n)
+		} else {
+			released = append(released, n)
+		}
+	}
+	if len(released) > 0 {
+		d.queue = append(released, d.queue...)
+		d.held = held
+	}
+
+	for len(d.queue) > 0 {
+		n := d.queue[0]
+		d.queue = d.queue[1:]
+		if !n.Critical {
+			quietHours := d.quietHours
+			if n.Location != nil {
+				quietHours.Location = n.Location
+			}
+			if until, quiet := quietHours.Until(now); quiet {
+				n.heldUntil = until
+				d.held = append(d.held, n)
+				continue
+			}
+		}
+		close(d.roomFreed)
+		d.roomFreed = make(chan struct{})
+		return n, true
+	}
+	return queuedNotification{}, false
+}
+
+// nextRelease returns when the first held notification is released; the caller
+// holds the lock
+func (d *NotificationDispatcher) nextRelease() (time.Time, bool) {
+	var first time.Time
+	for _, n := range d.held {
+		if first.IsZero() || n.heldUntil.Before(first) {
+			first = n.heldUntil
+		}
+	}
+	return first, !first.IsZero()
+}
+
+// dispatch waits for the notification's turn, sends it and then records the outcome
+// or queues a retry. It only fails when ctx is done before the send
+func (d *NotificationDispatcher) dispatch(ctx context.Context, n queuedNotification) error {
+	d.mu.Lock()
+	wait := d.lastSend.Add(d.interval).Sub(d.now())
+	if retryWait := n.notBefore.Sub(d.now()); retryWait > wait {
+		wait = retryWait
+	}
+	d.mu.Unlock()
+	if wait > 0 {
+		if err := d.sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+
+	_, err := d.botAPI.Send(n.Message)
+	n.attempts++
+
+	d.mu.Lock()
+	d.lastSend = d.now()
+	if err != nil && n.attempts < d.maxAttempts {
+		if delay, ok := retryDelay(err, d.retryDelay<<(n.attempts-1)); ok {
+			n.notBefore = d.lastSend.Add(delay)
+			if retryAfter, flood := floodWaitDuration(err); flood {
+				// A flood wait applies to every chat, so the whole queue waits
+				d.lastSend = d.lastSend.Add(retryAfter - d.interval)
+			}
+			d.queue = append(d.queue, n)
+			d.mu.Unlock()
+			return nil
+		}
+	}
+	outcome := d.record(n, err)
+	d.mu.Unlock()
+
+	if err != nil {
+		d.logger.WithError(err).WithFields(logrus.Fields{
+			"user_id":  n.UserID,
+			"kind":     n.Kind,
+			"attempts": n.attempts,
+		}).Warn("Failed to send notification")
+	}
+	if d.onOutcome != nil {
+		d.onOutcome(outcome)
+	}
+	if n.Done != nil {
+		n.Done(outcome)
+	}
+	return nil
+}
+
+// record stores the final outcome of a notification; the caller holds the lock
+func (d *NotificationDispatcher) record(n queuedNotification, err error) NotificationOutcome {
+	outcome := NotificationOutcome{
+		UserID:   n.UserID,
+		Kind:     n.Kind,
+		Status:   NotificationSent,
+		Attempts: n.attempts,
+		Err:      err,
+		At:       d.lastSend,
+	}
+	switch {
+	case err == nil:
+		d.stats.Sent++
+	case isChatNotFound(err):
+		outcome.Status = NotificationUnreachable
+		d.stats.Unreachable++
+	case isBotBlocked(err):
+		outcome.Status = NotificationBlocked
+		d.stats.Blocked++
+	default:
+		outcome.Status = NotificationFailed
+		d.stats.Failed++
+	}
+	d.outcomes[n.UserID] = outcome
+	return outcome
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
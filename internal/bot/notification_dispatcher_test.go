@@ -0,0 +1,258 @@
+package bot
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestNotificationDispatcher creates a dispatcher sending 10 notifications per
+// second on a fake clock that sleeping advances
+func newTestNotificationDispatcher(botAPI BotAPI) (*NotificationDispatcher, *fakeClock, *[]time.Duration) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	var sleeps []time.Duration
+	d := NewNotificationDispatcher(botAPI, logger, 10, 0)
+	d.now = clock.Now
+	d.sleep = func(ctx context.Context, wait time.Duration) error {
+		sleeps = append(sleeps, wait)
+		clock.now = clock.now.Add(wait)
+		return ctx.Err()
+	}
+	return d, clock, &sleeps
+}
+
+// toChat matches sends to the given chat
+func toChat(chatID int64) interface{} {
+	return mock.MatchedBy(func(c tgbotapi.MessageConfig) bool { return c.ChatID == chatID })
+}
+
+func TestNotificationDispatcher_SendsInOrderAtRate(t *testing.T) {
+	mockBotAPI := new(MockBotAPI)
+	var order []int64
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			order = append(order, args.Get(0).(tgbotapi.MessageConfig).ChatID)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	d, _, sleeps := newTestNotificationDispatcher(mockBotAPI)
+	for _, userID := range []int64{3, 1, 2} {
+		require.NoError(t, d.Enqueue(Notification{UserID: userID, Kind: "broadcast", Message: tgbotapi.NewMessage(userID, "hello")}))
+	}
+
+	require.NoError(t, d.Drain(context.Background()))
+
+	assert.Equal(t, []int64{3, 1, 2}, order)
+	// The first send goes out at once, the others are spaced at 10 per second
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 100 * time.Millisecond}, *sleeps)
+	assert.Equal(t, NotificationStats{Sent: 3}, d.Stats())
+}
+
+func TestNotificationDispatcher_TracksFailures(t *testing.T) {
+	mockBotAPI := new(MockBotAPI)
+	mockBotAPI.On("Send", toChat(1)).
+		Return(tgbotapi.Message{}, &tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"})
+	mockBotAPI.On("Send", toChat(2)).Return(tgbotapi.Message{}, serverError()).Twice()
+	mockBotAPI.On("Send", toChat(2)).Return(tgbotapi.Message{}, nil).Once()
+	mockBotAPI.On("Send", toChat(3)).
+		Return(tgbotapi.Message{}, &tgbotapi.Error{Code: 400, Message: "Bad Request: message is too long"})
+	mockBotAPI.On("Send", toChat(4)).Return(tgbotapi.Message{}, serverError())
+	mockBotAPI.On("Send", toChat(5)).
+		Return(tgbotapi.Message{}, &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"})
+
+	d, clock, _ := newTestNotificationDispatcher(mockBotAPI)
+	start := clock.now
+	var outcomes []NotificationOutcome
+	d.SetOutcomeHandler(func(outcome NotificationOutcome) {
+		outcomes = append(outcomes, outcome)
+	})
+	for userID := int64(1); userID <= 5; userID++ {
+		require.NoError(t, d.Enqueue(Notification{UserID: userID, Kind: "quota_alert", Message: tgbotapi.NewMessage(userID, "hello")}))
+	}
+
+	require.NoError(t, d.Drain(context.Background()))
+
+	assert.Equal(t, NotificationStats{Sent: 1, Failed: 2, Unreachable: 1, Blocked: 1}, d.Stats())
+	require.Len(t, outcomes, 5)
+	statuses := map[int64]NotificationStatus{}
+	for _, outcome := range outcomes {
+		statuses[outcome.UserID] = outcome.Status
+		assert.Equal(t, "quota_alert", outcome.Kind)
+	}
+	assert.Equal(t, map[int64]NotificationStatus{
+		1: NotificationUnreachable,
+		2: NotificationSent,
+		3: NotificationFailed,
+		4: NotificationFailed,
+		5: NotificationBlocked,
+	}, statuses)
+
+	// Transient errors are retried with backoff, other errors are final
+	sent, ok := d.Outcome(2)
+	require.True(t, ok)
+	assert.Equal(t, 3, sent.Attempts)
+	assert.NoError(t, sent.Err)
+	failed, _ := d.Outcome(3)
+	assert.Equal(t, 1, failed.Attempts)
+	exhausted, _ := d.Outcome(4)
+	assert.Equal(t, 3, exhausted.Attempts)
+	assert.Error(t, exhausted.Err)
+	assert.GreaterOrEqual(t, clock.now.Sub(start), 15*time.Second, "retries wait 5s, then 10s")
+	mockBotAPI.AssertExpectations(t)
+}
+
+func TestNotificationDispatcher_FloodWaitPausesQueue(t *testing.T) {
+	mockBotAPI := new(MockBotAPI)
+	mockBotAPI.On("Send", toChat(1)).Return(tgbotapi.Message{}, floodWaitError(3)).Once()
+	mockBotAPI.On("Send", toChat(1)).Return(tgbotapi.Message{}, nil).Once()
+	mockBotAPI.On("Send", toChat(2)).Return(tgbotapi.Message{}, nil).Once()
+
+	d, _, sleeps := newTestNotificationDispatcher(mockBotAPI)
+	require.NoError(t, d.Enqueue(Notification{UserID: 1, Message: tgbotapi.NewMessage(1, "hello")}))
+	require.NoError(t, d.Enqueue(Notification{UserID: 2, Message: tgbotapi.NewMessage(2, "hello")}))
+
+	require.NoError(t, d.Drain(context.Background()))
+
+	// The next send, to another chat, waits out retry_after; the retry goes right after it
+	assert.Equal(t, []time.Duration{3 * time.Second, 100 * time.Millisecond}, *sleeps)
+	assert.Equal(t, NotificationStats{Sent: 2}, d.Stats())
+	mockBotAPI.AssertExpectations(t)
+}
+
+func TestNotificationDispatcher_QuietHours(t *testing.T) {
+	mockBotAPI := new(MockBotAPI)
+	var order []int64
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			order = append(order, args.Get(0).(tgbotapi.MessageConfig).ChatID)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	// The fake clock starts at 12:00, inside quiet hours until 13:00
+	d, clock, _ := newTestNotificationDispatcher(mockBotAPI)
+	d.SetQuietHours(QuietHours{Start: 11 * time.Hour, End: 13 * time.Hour})
+	require.NoError(t, d.Enqueue(Notification{UserID: 1, Kind: "broadcast", Message: tgbotapi.NewMessage(1, "news")}))
+	require.NoError(t, d.Enqueue(Notification{UserID: 2, Kind: "plan_expiry", Message: tgbotapi.NewMessage(2, "expired"), Critical: true}))
+	require.NoError(t, d.Enqueue(Notification{UserID: 3, Kind: "broadcast", Message: tgbotapi.NewMessage(3, "news")}))
+
+	require.NoError(t, d.Drain(context.Background()))
+
+	assert.Equal(t, []int64{2}, order, "only the critical notification is sent during quiet hours")
+	assert.Equal(t, NotificationStats{Held: 2, Sent: 1}, d.Stats())
+
+	clock.now = time.Date(2025, 1, 1, 13, 0, 0, 0, time.UTC)
+	require.NoError(t, d.Drain(context.Background()))
+
+	assert.Equal(t, []int64{2, 1, 3}, order, "held notifications are sent in order once quiet hours end")
+	assert.Equal(t, NotificationStats{Sent: 3}, d.Stats())
+}
+
+func TestNotificationDispatcher_QuietHoursInRecipientTimezone(t *testing.T) {
+	mockBotAPI := new(MockBotAPI)
+	var order []int64
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			order = append(order, args.Get(0).(tgbotapi.MessageConfig).ChatID)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	// At 12:00 UTC it is 23:00 in Sydney and 07:00 in New York, both inside quiet
+	// hours from 22:00 to 08:00, while UTC is outside them
+	sydney, err := time.LoadLocation("Australia/Sydney")
+	require.NoError(t, err)
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	d, clock, _ := newTestNotificationDispatcher(mockBotAPI)
+	d.SetQuietHours(QuietHours{Start: 22 * time.Hour, End: 8 * time.Hour, Location: time.UTC})
+	require.NoError(t, d.Enqueue(Notification{UserID: 1, Kind: "broadcast", Message: tgbotapi.NewMessage(1, "news"), Location: sydney}))
+	require.NoError(t, d.Enqueue(Notification{UserID: 2, Kind: "broadcast", Message: tgbotapi.NewMessage(2, "news")}))
+	require.NoError(t, d.Enqueue(Notification{UserID: 3, Kind: "broadcast", Message: tgbotapi.NewMessage(3, "news"), Location: newYork}))
+
+	require.NoError(t, d.Drain(context.Background()))
+	assert.Equal(t, []int64{2}, order, "only the user outside their quiet hours is messaged")
+	until, ok := d.nextRelease()
+	require.True(t, ok)
+	assert.True(t, until.Equal(time.Date(2025, 1, 1, 13, 0, 0, 0, time.UTC)), "08:00 in New York comes first")
+
+	// Each held notification is released when its recipient's quiet hours end
+	clock.now = time.Date(2025, 1, 1, 13, 0, 0, 0, time.UTC)
+	require.NoError(t, d.Drain(context.Background()))
+	assert.Equal(t, []int64{2, 3}, order)
+
+	clock.now = time.Date(2025, 1, 1, 21, 0, 0, 0, time.UTC)
+	require.NoError(t, d.Drain(context.Background()))
+	assert.Equal(t, []int64{2, 3, 1}, order)
+	assert.Equal(t, NotificationStats{Sent: 3}, d.Stats())
+}
+
+func TestNotificationDispatcher_QueueFull(t *testing.T) {
+	d, _, _ := newTestNotificationDispatcher(new(MockBotAPI))
+	d.maxQueue = 1
+
+	require.NoError(t, d.Enqueue(Notification{UserID: 1, Message: tgbotapi.NewMessage(1, "hello")}))
+	assert.ErrorIs(t, d.Enqueue(Notification{UserID: 2, Message: tgbotapi.NewMessage(2, "hello")}), ErrNotificationQueueFull)
+	assert.Equal(t, 1, d.Stats().Queued)
+}
+
+func TestNotificationDispatcher_EnqueueWait(t *testing.T) {
+	mockBotAPI := new(MockBotAPI)
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).Return(tgbotapi.Message{}, nil)
+	d, _, _ := newTestNotificationDispatcher(mockBotAPI)
+	d.maxQueue = 1
+	require.NoError(t, d.Enqueue(Notification{UserID: 1, Message: tgbotapi.NewMessage(1, "hello")}))
+
+	// Waits for the queued notification to be taken
+	queued := make(chan error, 1)
+	go func() {
+		queued <- d.EnqueueWait(context.Background(), Notification{UserID: 2, Message: tgbotapi.NewMessage(2, "hello")})
+	}()
+	select {
+	case err := <-queued:
+		t.Fatalf("queued into a full queue: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	_, ok := d.next()
+	require.True(t, ok)
+	require.NoError(t, <-queued)
+	assert.Equal(t, 1, d.Stats().Queued)
+
+	t.Run("gives up when ctx is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := d.EnqueueWait(ctx, Notification{UserID: 3, Message: tgbotapi.NewMessage(3, "hello")})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("gives up when the dispatcher stops", func(t *testing.T) {
+		d.stopOnce.Do(func() { close(d.stop) })
+		err := d.EnqueueWait(context.Background(), Notification{UserID: 3, Message: tgbotapi.NewMessage(3, "hello")})
+		assert.ErrorIs(t, err, ErrNotificationDispatcherStopped)
+	})
+}
+
+func TestNotificationDispatcher_StartStop(t *testing.T) {
+	mockBotAPI := new(MockBotAPI)
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).Return(tgbotapi.Message{}, nil)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	d := NewNotificationDispatcher(mockBotAPI, logger, 1000, 0)
+	d.Start()
+
+	require.NoError(t, d.Enqueue(Notification{UserID: 1, Message: tgbotapi.NewMessage(1, "hello")}))
+	require.NoError(t, d.Enqueue(Notification{UserID: 2, Message: tgbotapi.NewMessage(2, "hello")}))
+	assert.Eventually(t, func() bool { return d.Stats().Sent == 2 }, time.Second, time.Millisecond)
+
+	d.Stop()
+	d.Stop()
+}
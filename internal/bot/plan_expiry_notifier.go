@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+)
+
+// PlanExpiryNotifier messages users whose paid plan lapsed and who were downgraded
+type PlanExpiryNotifier struct {
+	notifications *NotificationDispatcher
+}
+
+// NewPlanExpiryNotifier creates a plan expiry notifier queueing messages with the
+// dispatcher. Grace period reminders are held during quiet hours; the notice that
+// the plan expired is not
+func NewPlanExpiryNotifier(notifications *NotificationDispatcher) *PlanExpiryNotifier {
+	return &PlanExpiryNotifier{notifications: notifications}
+}
+
+// NotifyPlanGracePeriod reminds the user to renew before the grace period ends
+func (n *PlanExpiryNotifier) NotifyPlanGracePeriod(ctx context.Context, user *domain.User, planName string, graceEndsAt time.Time) error {
+	text := fmt.Sprintf("⏳ Your %s plan has lapsed. Renew with /plans before %s UTC to keep your %s quota.",
+		planName, graceEndsAt.UTC().Format("2006-01-02 15:04"), formatBytes(user.QuotaLimit))
+
+	err := n.notifications.Enqueue(Notification{
+		UserID:   user.TelegramID,
+		Kind:     "plan_grace_period",
+		Message:  tgbotapi.NewMessage(user.TelegramID, text),
+		Location: user.Location(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to queue plan grace period reminder: %w", err)
+	}
+	return nil
+}
+
+// NotifyPlanExpired tells the user their plan expired and what quota they have now
+func (n *PlanExpiryNotifier) NotifyPlanExpired(ctx context.Context, user *domain.User, planName string) error {
+	text := fmt.Sprintf("⌛ Your %s plan has expired and your account was moved back to %s of data.\n\n"+
+		"Use /plans to renew.", planName, formatBytes(user.QuotaLimit))
+
+	// Private chats share the user's Telegram ID
+	err := n.notifications.Enqueue(Notification{
+		UserID:   user.TelegramID,
+		Kind:     "plan_expired",
+		Message:  tgbotapi.NewMessage(user.TelegramID, text),
+		Critical: true,
+		Location: user.Location(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to queue plan expiry notification: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanExpiryNotifier_NotifyPlanExpired(t *testing.T) {
+	mockBotAPI := new(MockBotAPI)
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil).Once()
+	d, _, _ := newTestNotificationDispatcher(mockBotAPI)
+	notifier := NewPlanExpiryNotifier(d)
+	user := &domain.User{TelegramID: 123, QuotaLimit: 50 * 1024 * 1024}
+
+	require.NoError(t, notifier.NotifyPlanExpired(context.Background(), user, "Basic"))
+	require.Len(t, d.queue, 1)
+	assert.True(t, d.queue[0].Critical, "the expiry notice is sent during quiet hours")
+
+	require.NoError(t, d.Drain(context.Background()))
+	assert.Equal(t, int64(123), sent.ChatID)
+	assert.Contains(t, sent.Text, "Your Basic plan has expired")
+	assert.Contains(t, sent.Text, "50.0 MB")
+
+	d.maxQueue = 0
+	assert.ErrorIs(t, notifier.NotifyPlanExpired(context.Background(), user, "Basic"), ErrNotificationQueueFull)
+}
+
+func TestPlanExpiryNotifier_NotifyPlanGracePeriod(t *testing.T) {
+	mockBotAPI := new(MockBotAPI)
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil).Once()
+	d, _, _ := newTestNotificationDispatcher(mockBotAPI)
+	notifier := NewPlanExpiryNotifier(d)
+	user := &domain.User{TelegramID: 123, QuotaLimit: 10 * 1024 * 1024 * 1024}
+	graceEndsAt := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+
+	require.NoError(t, notifier.NotifyPlanGracePeriod(context.Background(), user, "Basic", graceEndsAt))
+	require.Len(t, d.queue, 1)
+	assert.False(t, d.queue[0].Critical)
+
+	require.NoError(t, d.Drain(context.Background()))
+	assert.Equal(t, int64(123), sent.ChatID)
+	assert.Contains(t, sent.Text, "Your Basic plan has lapsed")
+	assert.Contains(t, sent.Text, "2024-03-04 12:00 UTC")
+}
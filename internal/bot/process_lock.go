@@ -1,12 +1,18 @@
 package bot
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 )
 
-// ProcessLock prevents multiple instances of the bot from running simultaneously
+// errLockHeld is returned by lockFile when another process holds the lock
+var errLockHeld = errors.New("lock is held by another process")
+
+// ProcessLock prevents multiple instances of the bot from running simultaneously. It
+// holds an advisory lock (flock) on the lock file, which the kernel releases when the
+// process exits, so a crashed instance never leaves a stale lock behind
 type ProcessLock struct {
 	lockFile string
 	file     *os.File
@@ -24,20 +30,27 @@ func NewProcessLock(lockFile string) *ProcessLock {
 
 // Acquire attempts to acquire the process lock
 func (pl *ProcessLock) Acquire() error {
-	// Try to create the lock file exclusively
-	file, err := os.OpenFile(pl.lockFile, os.O_CREATE|os.O_EXCL, 0600)
+	file, err := os.OpenFile(pl.lockFile, os.O_CREATE|os.O_RDWR, 0600)
 	if err != nil {
-		if os.IsExist(err) {
+		return fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	if err := lockFile(file); err != nil {
+		_ = file.Close()
+		if errors.Is(err, errLockHeld) {
 			return fmt.Errorf("another instance is already running (lock file: %s)", pl.lockFile)
 		}
-		return fmt.Errorf("failed to create lock file: %w", err)
+		return fmt.Errorf("failed to lock file: %w", err)
 	}
 
-	// Write PID to lock file for debugging
+	// Write PID to lock file for debugging, replacing the PID of a previous holder
 	pid := fmt.Sprintf("%d\n", os.Getpid())
-	if _, err := file.WriteString(pid); err != nil {
+	if err := file.Truncate(0); err == nil {
+		_, err = file.WriteAt([]byte(pid), 0)
+	}
+	if err != nil {
+		_ = unlockFile(file)
 		_ = file.Close()
-		_ = os.Remove(pl.lockFile)
 		return fmt.Errorf("failed to write PID to lock file: %w", err)
 	}
 
@@ -45,25 +58,43 @@ func (pl *ProcessLock) Acquire() error {
 	return nil
 }
 
-// Release releases the process lock
+// Release releases the process lock. The lock file itself is kept: removing it could
+// let another instance lock a new file while a third still waits on the old one
 func (pl *ProcessLock) Release() error {
-	if pl.file != nil {
-		_ = pl.file.Close()
-		if err := os.Remove(pl.lockFile); err != nil && !os.IsNotExist(err) {
-			return fmt.Errorf("failed to remove lock file: %w", err)
-		}
-		pl.file = nil
+	if pl.file == nil {
+		return nil
+	}
+
+	_ = pl.file.Truncate(0)
+	err := unlockFile(pl.file)
+	_ = pl.file.Close()
+	pl.file = nil
+	if err != nil {
+		return fmt.Errorf("failed to unlock lock file: %w", err)
 	}
 	return nil
 }
 
-// IsLocked checks if another instance is running
+// IsLocked checks if an instance, this one included, holds the lock
 func (pl *ProcessLock) IsLocked() bool {
-	_, err := os.Stat(pl.lockFile)
-	return err == nil
+	if pl.file != nil {
+		return true
+	}
+
+	file, err := os.OpenFile(pl.lockFile, os.O_RDWR, 0600)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	if err := lockFile(file); err != nil {
+		return errors.Is(err, errLockHeld)
+	}
+	_ = unlockFile(file)
+	return false
 }
 
-// GetLockInfo returns information about the current lock
+// GetLockInfo returns the PID written by the instance holding the lock
 func (pl *ProcessLock) GetLockInfo() (string, error) {
 	if !pl.IsLocked() {
 		return "", nil
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package bot
+
+import "os"
+
+// lockFile is a no-op where flock is unavailable; the bot is only deployed on Linux,
+// so the process lock is not enforced on other platforms
+func lockFile(*os.File) error {
+	return nil
+}
+
+// unlockFile is a no-op where flock is unavailable
+func unlockFile(*os.File) error {
+	return nil
+}
@@ -0,0 +1,54 @@
+package bot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessLock_SecondAcquireFails(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), "bot.lock")
+
+	first := NewProcessLock(lockPath)
+	require.NoError(t, first.Acquire())
+	assert.True(t, first.IsLocked())
+
+	info, err := first.GetLockInfo()
+	require.NoError(t, err)
+	assert.NotEmpty(t, strings.TrimSpace(info), "the lock file records the PID")
+
+	second := NewProcessLock(lockPath)
+	err = second.Acquire()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "another instance is already running")
+
+	// Releasing a lock that was never acquired leaves the first instance's lock alone
+	require.NoError(t, second.Release())
+	assert.True(t, first.IsLocked())
+
+	require.NoError(t, first.Release())
+	assert.False(t, first.IsLocked())
+
+	require.NoError(t, second.Acquire(), "the lock can be taken once released")
+	require.NoError(t, second.Release())
+}
+
+func TestProcessLock_StaleLockFile(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), "bot.lock")
+	// A crashed instance leaves its lock file behind, but not its lock
+	require.NoError(t, os.WriteFile(lockPath, []byte("99999\n"), 0600))
+
+	lock := NewProcessLock(lockPath)
+	assert.False(t, lock.IsLocked())
+	require.NoError(t, lock.Acquire())
+
+	info, err := lock.GetLockInfo()
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%d\n", os.Getpid()), info, "the stale PID is replaced")
+	require.NoError(t, lock.Release())
+}
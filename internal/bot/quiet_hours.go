@@ -0,0 +1,43 @@
+package bot
+
+import "time"
+
+// QuietHours is a daily window, e.g. 22:00 to 08:00, during which optional
+// notifications are held. Start and End are offsets from midnight in Location; a
+// window whose End is before its Start spans midnight
+type QuietHours struct {
+	Start    time.Duration
+	End      time.Duration
+	Location *time.Location
+}
+
+// Enabled reports whether the window is not empty
+func (q QuietHours) Enabled() bool {
+	return q.Start != q.End
+}
+
+// Until returns when the quiet hours containing t end, or false when t is outside them
+func (q QuietHours) Until(t time.Time) (time.Time, bool) {
+	if !q.Enabled() {
+		return time.Time{}, false
+	}
+	loc := q.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	t = t.In(loc)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	offset := t.Sub(midnight)
+
+	switch {
+	case q.Start < q.End && offset >= q.Start && offset < q.End:
+		return midnight.Add(q.End), true
+	case q.Start > q.End && offset >= q.Start:
+		// Spans midnight and t is before it, so the window ends tomorrow
+		return midnight.AddDate(0, 0, 1).Add(q.End), true
+	case q.Start > q.End && offset < q.End:
+		return midnight.Add(q.End), true
+	}
+	return time.Time{}, false
+}
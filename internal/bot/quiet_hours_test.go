@@ -0,0 +1,44 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuietHours_Until(t *testing.T) {
+	at := func(hour, min int) time.Time {
+		return time.Date(2025, 1, 1, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name      string
+		quiet     QuietHours
+		t         time.Time
+		wantQuiet bool
+		wantUntil time.Time
+	}{
+		{"Disabled", QuietHours{}, at(3, 0), false, time.Time{}},
+		{"Inside a daytime window", QuietHours{Start: 13 * time.Hour, End: 15 * time.Hour}, at(14, 0), true, at(15, 0)},
+		{"At the end of a window", QuietHours{Start: 13 * time.Hour, End: 15 * time.Hour}, at(15, 0), false, time.Time{}},
+		{"Before midnight", QuietHours{Start: 22 * time.Hour, End: 8 * time.Hour}, at(23, 30), true, at(8, 0).AddDate(0, 0, 1)},
+		{"After midnight", QuietHours{Start: 22 * time.Hour, End: 8 * time.Hour}, at(2, 0), true, at(8, 0)},
+		{"Outside an overnight window", QuietHours{Start: 22 * time.Hour, End: 8 * time.Hour}, at(12, 0), false, time.Time{}},
+		{
+			"In another timezone",
+			QuietHours{Start: 22 * time.Hour, End: 8 * time.Hour, Location: time.FixedZone("UTC+3", 3*60*60)},
+			at(20, 0), // 23:00 at UTC+3
+			true,
+			at(5, 0).AddDate(0, 0, 1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			until, quiet := tt.quiet.Until(tt.t)
+			assert.Equal(t, tt.wantQuiet, quiet)
+			assert.True(t, tt.wantUntil.Equal(until), "got %s, want %s", until, tt.wantUntil)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+)
+
+// QuotaAlertNotifier messages users whose data usage crossed an alert threshold
+type QuotaAlertNotifier struct {
+	notifications *NotificationDispatcher
+}
+
+// NewQuotaAlertNotifier creates a quota alert notifier queueing alerts with the
+// dispatcher, which paces them with other notifications and holds them during
+// quiet hours. Only the alert that the data ran out is sent during quiet hours
+func NewQuotaAlertNotifier(notifications *NotificationDispatcher) *QuotaAlertNotifier {
+	return &QuotaAlertNotifier{notifications: notifications}
+}
+
+// NotifyQuotaAlert queues an alert telling the user how much of their data they have
+// used. Users found unreachable or blocked once it is sent are recorded by the
+// dispatcher's outcome handler
+func (n *QuotaAlertNotifier) NotifyQuotaAlert(ctx context.Context, user *domain.User, thresholdPct int) error {
+	text := fmt.Sprintf("⚠️ You have used %d%% of your data: %s of %s.\n\n"+
+		"Use /plans to get more data or /alertat to change when you are alerted.",
+		thresholdPct, formatBytes(user.QuotaUsed), formatBytes(user.QuotaLimit))
+	exhausted := thresholdPct >= domain.QuotaExhaustedThresholdPct
+	if exhausted {
+		text = fmt.Sprintf("🚫 You have used all %s of your data.\n\nUse /plans to get more data.", formatBytes(user.QuotaLimit))
+	}
+
+	// Private chats share the user's Telegram ID
+	err := n.notifications.Enqueue(Notification{
+		UserID:   user.TelegramID,
+		Kind:     "quota_alert",
+		Message:  tgbotapi.NewMessage(user.TelegramID, text),
+		Critical: exhausted,
+		Location: user.Location(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to queue quota alert: %w", err)
+	}
+	return nil
+}
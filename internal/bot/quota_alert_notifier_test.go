@@ -0,0 +1,96 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaAlertNotifier_NotifyQuotaAlert(t *testing.T) {
+	mockBotAPI := new(MockBotAPI)
+	var sent []tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = append(sent, args.Get(0).(tgbotapi.MessageConfig))
+		}).
+		Return(tgbotapi.Message{}, nil)
+	d, _, _ := newTestNotificationDispatcher(mockBotAPI)
+	notifier := NewQuotaAlertNotifier(d)
+	user := &domain.User{TelegramID: 123, QuotaLimit: 100 * 1024 * 1024, QuotaUsed: 60 * 1024 * 1024}
+
+	require.NoError(t, notifier.NotifyQuotaAlert(context.Background(), user, 60))
+	require.NoError(t, notifier.NotifyQuotaAlert(context.Background(), user, 100))
+
+	// Alerts are queued, and only the one that the data ran out is critical
+	mockBotAPI.AssertNotCalled(t, "Send", mock.Anything)
+	require.Len(t, d.queue, 2)
+	assert.Equal(t, "quota_alert", d.queue[0].Kind)
+	assert.False(t, d.queue[0].Critical)
+	assert.True(t, d.queue[1].Critical)
+	assert.Nil(t, d.queue[0].Location, "users without a timezone keep the configured one")
+	d.queue = nil
+
+	// Quiet hours are kept in the user's timezone
+	user.Timezone = "Europe/Moscow"
+	require.NoError(t, notifier.NotifyQuotaAlert(context.Background(), user, 60))
+	require.NoError(t, notifier.NotifyQuotaAlert(context.Background(), user, 100))
+	require.Len(t, d.queue, 2)
+	assert.Equal(t, "Europe/Moscow", d.queue[0].Location.String())
+
+	require.NoError(t, d.Drain(context.Background()))
+	require.Len(t, sent, 2)
+	assert.Equal(t, int64(123), sent[0].ChatID)
+	assert.Contains(t, sent[0].Text, "You have used 60% of your data: 60.0 MB of 100.0 MB")
+	assert.Contains(t, sent[1].Text, "You have used all 100.0 MB of your data")
+
+	d.maxQueue = 0
+	assert.ErrorIs(t, notifier.NotifyQuotaAlert(context.Background(), user, 60), ErrNotificationQueueFull)
+}
+
+func TestIsChatNotFound(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"chat not found", &tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"}, true},
+		{"wrapped", fmt.Errorf("failed to send: %w", &tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"}), true},
+		{"blocked by the user", &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}, false},
+		{"other bad request", &tgbotapi.Error{Code: 400, Message: "Bad Request: message is too long"}, false},
+		{"plain error", errors.New("chat not found"), false},
+		{"no error", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isChatNotFound(tt.err))
+		})
+	}
+}
+
+func TestIsBotBlocked(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"blocked by the user", &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}, true},
+		{"wrapped", fmt.Errorf("failed to send: %w", &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}), true},
+		{"other forbidden", &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was kicked from the group chat"}, false},
+		{"chat not found", &tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"}, false},
+		{"no error", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isBotBlocked(tt.err))
+		})
+	}
+}
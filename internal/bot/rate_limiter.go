@@ -5,15 +5,54 @@ import (
 	"time"
 )
 
-// RateLimiter implements per-user rate limiting
+const (
+	// GlobalRateLimitAction is the bucket used by Allow and by actions without their own limit
+	GlobalRateLimitAction = ""
+	// DefaultRateLimit is the number of requests per window allowed in the global bucket
+	DefaultRateLimit = 20
+	// DefaultRateLimitWindow is the window in which requests are counted
+	DefaultRateLimitWindow = time.Minute
+	// DefaultRateLimitBlockDuration is how long a user stays blocked after exceeding a limit
+	DefaultRateLimitBlockDuration = 10 * time.Minute
+)
+
+// RateLimiterConfig configures a RateLimiter
+type RateLimiterConfig struct {
+	MaxRequests   int           // requests per window in the global bucket
+	Window        time.Duration // window in which requests are counted
+	BlockDuration time.Duration // how long a user stays blocked after exceeding a limit
+	// ActionLimits maps an action to its own requests per window
+	ActionLimits map[string]int
+}
+
+// DefaultRateLimiterConfig returns the default rate limiter configuration
+func DefaultRateLimiterConfig() RateLimiterConfig {
+	return RateLimiterConfig{
+		MaxRequests:   DefaultRateLimit,
+		Window:        DefaultRateLimitWindow,
+		BlockDuration: DefaultRateLimitBlockDuration,
+	}
+}
+
+// RateLimiter implements per-user rate limiting. Actions with a configured limit
+// are counted in their own bucket, all other requests share the global bucket
 type RateLimiter struct {
-	limits map[int64]*UserLimit
-	mu     sync.RWMutex
+	limits        map[rateLimitKey]*UserLimit
+	actionLimits  map[string]int
+	window        time.Duration
+	blockDuration time.Duration
+	mu            sync.RWMutex
 	// Cleanup old entries periodically
 	cleanupTicker *time.Ticker
 	done          chan bool
 }
 
+// rateLimitKey identifies a user's bucket for an action
+type rateLimitKey struct {
+	userID int64
+	action string
+}
+
 // UserLimit tracks rate limiting for a specific user
 type UserLimit struct {
 	LastRequest time.Time
@@ -22,10 +61,32 @@ type UserLimit struct {
 	BlockedAt   time.Time
 }
 
-// NewRateLimiter creates a new rate limiter instance
-func NewRateLimiter() *RateLimiter {
+// NewRateLimiter creates a new rate limiter instance. Unset values fall back to
+// the defaults
+func NewRateLimiter(cfg RateLimiterConfig) *RateLimiter {
+	defaults := DefaultRateLimiterConfig()
+	if cfg.MaxRequests < 1 {
+		cfg.MaxRequests = defaults.MaxRequests
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = defaults.Window
+	}
+	if cfg.BlockDuration <= 0 {
+		cfg.BlockDuration = defaults.BlockDuration
+	}
+
+	actionLimits := map[string]int{GlobalRateLimitAction: cfg.MaxRequests}
+	for action, limit := range cfg.ActionLimits {
+		if limit > 0 {
+			actionLimits[action] = limit
+		}
+	}
+
 	rl := &RateLimiter{
-		limits:        make(map[int64]*UserLimit),
+		limits:        make(map[rateLimitKey]*UserLimit),
+		actionLimits:  actionLimits,
+		window:        cfg.Window,
+		blockDuration: cfg.BlockDuration,
 		cleanupTicker: time.NewTicker(5 * time.Minute), // Cleanup every 5 minutes
 		done:          make(chan bool),
 	}
@@ -36,17 +97,30 @@ func NewRateLimiter() *RateLimiter {
 	return rl
 }
 
-// Allow checks if a user is allowed to make a request
+// Allow checks if a user is allowed to make a request against the global bucket
 func (rl *RateLimiter) Allow(userID int64) bool {
+	return rl.AllowAction(userID, GlobalRateLimitAction)
+}
+
+// AllowAction checks if a user is allowed to perform an action. Actions without a
+// configured limit are counted in the global bucket
+func (rl *RateLimiter) AllowAction(userID int64, action string) bool {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
+	maxRequests, ok := rl.actionLimits[action]
+	if !ok {
+		action = GlobalRateLimitAction
+		maxRequests = rl.actionLimits[GlobalRateLimitAction]
+	}
+
 	now := time.Now()
-	limit, exists := rl.limits[userID]
+	key := rateLimitKey{userID: userID, action: action}
+	limit, exists := rl.limits[key]
 
 	// If user doesn't exist, create new limit
 	if !exists {
-		rl.limits[userID] = &UserLimit{
+		rl.limits[key] = &UserLimit{
 			LastRequest: now,
 			Count:       1,
 			Blocked:     false,
@@ -56,8 +130,8 @@ func (rl *RateLimiter) Allow(userID int64) bool {
 
 	// Check if user is blocked
 	if limit.Blocked {
-		// Unblock after 10 minutes
-		if now.Sub(limit.BlockedAt) > 10*time.Minute {
+		// Unblock after the block duration
+		if now.Sub(limit.BlockedAt) > rl.blockDuration {
 			limit.Blocked = false
 			limit.Count = 0
 		} else {
@@ -65,8 +139,8 @@ func (rl *RateLimiter) Allow(userID int64) bool {
 		}
 	}
 
-	// Reset counter if more than 1 minute has passed
-	if now.Sub(limit.LastRequest) > time.Minute {
+	// Reset counter if the window has passed
+	if now.Sub(limit.LastRequest) > rl.window {
 		limit.Count = 0
 		limit.LastRequest = now
 	}
@@ -76,7 +150,7 @@ func (rl *RateLimiter) Allow(userID int64) bool {
 	limit.LastRequest = now
 
 	// Block if too many requests
-	if limit.Count > 20 { // Max 20 requests per minute
+	if limit.Count > maxRequests {
 		limit.Blocked = true
 		limit.BlockedAt = now
 		return false
@@ -85,12 +159,12 @@ func (rl *RateLimiter) Allow(userID int64) bool {
 	return true
 }
 
-// GetUserLimit returns the current limit for a user
+// GetUserLimit returns the current global limit for a user
 func (rl *RateLimiter) GetUserLimit(userID int64) *UserLimit {
 	rl.mu.RLock()
 	defer rl.mu.RUnlock()
 
-	limit, exists := rl.limits[userID]
+	limit, exists := rl.limits[rateLimitKey{userID: userID, action: GlobalRateLimitAction}]
 	if !exists {
 		return nil
 	}
@@ -121,11 +195,19 @@ func (rl *RateLimiter) cleanup() {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
+	// Keep entries for at least an hour, and never while they may still be counted or blocked
+	retention := time.Hour
+	if rl.window > retention {
+		retention = rl.window
+	}
+	if rl.blockDuration > retention {
+		retention = rl.blockDuration
+	}
+
 	now := time.Now()
-	for userID, limit := range rl.limits {
-		// Remove entries older than 1 hour
-		if now.Sub(limit.LastRequest) > time.Hour {
-			delete(rl.limits, userID)
+	for key, limit := range rl.limits {
+		if now.Sub(limit.LastRequest) > retention {
+			delete(rl.limits, key)
 		}
 	}
 }
@@ -0,0 +1,69 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	rl := NewRateLimiter(DefaultRateLimiterConfig())
+	defer rl.Stop()
+
+	for i := 0; i < DefaultRateLimit; i++ {
+		assert.True(t, rl.Allow(123), "request %d should be allowed", i+1)
+	}
+	assert.False(t, rl.Allow(123))
+	assert.True(t, rl.Allow(456), "other users have their own limit")
+	assert.True(t, rl.GetUserLimit(123).Blocked)
+}
+
+func TestRateLimiter_AllowAction(t *testing.T) {
+	rl := NewRateLimiter(RateLimiterConfig{ActionLimits: map[string]int{
+		"command:/start":   2,
+		"command:/account": 50,
+	}})
+	defer rl.Stop()
+
+	assert.True(t, rl.AllowAction(123, "command:/start"))
+	assert.True(t, rl.AllowAction(123, "command:/start"))
+	assert.False(t, rl.AllowAction(123, "command:/start"))
+
+	// /account has its own, larger bucket
+	for i := 0; i < 50; i++ {
+		assert.True(t, rl.AllowAction(123, "command:/account"), "request %d should be allowed", i+1)
+	}
+	assert.False(t, rl.AllowAction(123, "command:/account"))
+
+	// Neither configured action used the global bucket
+	assert.Nil(t, rl.GetUserLimit(123))
+	assert.True(t, rl.Allow(123))
+}
+
+func TestRateLimiter_AllowAction_UnconfiguredActionsShareGlobalBucket(t *testing.T) {
+	rl := NewRateLimiter(RateLimiterConfig{MaxRequests: 3})
+	defer rl.Stop()
+
+	assert.True(t, rl.AllowAction(123, "command:/help"))
+	assert.True(t, rl.AllowAction(123, "message"))
+	assert.True(t, rl.Allow(123))
+	assert.False(t, rl.AllowAction(123, "callback:help"))
+	assert.Equal(t, 4, rl.GetUserLimit(123).Count)
+}
+
+func TestRateLimiter_BlockDuration(t *testing.T) {
+	rl := NewRateLimiter(RateLimiterConfig{
+		MaxRequests:   1,
+		Window:        time.Hour,
+		BlockDuration: 20 * time.Millisecond,
+	})
+	defer rl.Stop()
+
+	assert.True(t, rl.Allow(123))
+	assert.False(t, rl.Allow(123))
+	assert.False(t, rl.Allow(123), "user stays blocked within the block duration")
+
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, rl.Allow(123), "user is unblocked after the block duration")
+}
@@ -0,0 +1,128 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// redisRateLimitTimeout bounds a single rate limit check against Redis, so a slow
+// Redis delays a request by at most this long before the in-memory limiter decides
+const redisRateLimitTimeout = 100 * time.Millisecond
+
+// redisRateLimitKeyPrefix prefixes the keys the limiter stores in Redis
+const redisRateLimitKeyPrefix = "arcanus:ratelimit:"
+
+// redisAllowScript counts a request in a fixed window. KEYS[1] is the window
+// counter and KEYS[2] the block flag; ARGV holds the limit, the window and the
+// block duration in milliseconds. It returns 1 when the request is allowed.
+// Running it as a script keeps INCR, the expiry and the block atomic when
+// several instances count the same user
+var redisAllowScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return 0
+end
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+if count > tonumber(ARGV[1]) then
+	redis.call('SET', KEYS[2], '1', 'PX', ARGV[3])
+	redis.call('DEL', KEYS[1])
+	return 0
+end
+return 1
+`)
+
+// RedisRateLimiter implements per-user rate limiting with counters stored in
+// Redis, so every instance of the bot shares the same limits. It follows the
+// fixed-window RateLimiter: actions with a configured limit have their own
+// bucket, and a user exceeding a limit stays blocked for the block duration.
+// While Redis is unreachable requests are checked against an in-memory
+// RateLimiter instead
+type RedisRateLimiter struct {
+	client        *redis.Client
+	actionLimits  map[string]int
+	window        time.Duration
+	blockDuration time.Duration
+	fallback      *RateLimiter
+	logger        *logrus.Logger
+	// degraded is set while Redis is unreachable, so the outage is logged once
+	degraded atomic.Bool
+}
+
+// NewRedisRateLimiter creates a rate limiter storing its counters in Redis. Unset
+// values fall back to the defaults
+func NewRedisRateLimiter(client *redis.Client, cfg RateLimiterConfig, logger *logrus.Logger) *RedisRateLimiter {
+	fallback := NewRateLimiter(cfg)
+	return &RedisRateLimiter{
+		client:        client,
+		actionLimits:  fallback.actionLimits,
+		window:        fallback.window,
+		blockDuration: fallback.blockDuration,
+		fallback:      fallback,
+		logger:        logger,
+	}
+}
+
+// Allow checks if a user is allowed to make a request against the global bucket
+func (rl *RedisRateLimiter) Allow(userID int64) bool {
+	return rl.AllowAction(userID, GlobalRateLimitAction)
+}
+
+// AllowAction checks if a user is allowed to perform an action. Actions without a
+// configured limit are counted in the global bucket
+func (rl *RedisRateLimiter) AllowAction(userID int64, action string) bool {
+	maxRequests, ok := rl.actionLimits[action]
+	if !ok {
+		action = GlobalRateLimitAction
+		maxRequests = rl.actionLimits[GlobalRateLimitAction]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisRateLimitTimeout)
+	defer cancel()
+
+	key := rl.key(userID, action)
+	allowed, err := redisAllowScript.Run(ctx, rl.client,
+		[]string{key, key + ":blocked"},
+		maxRequests, rl.window.Milliseconds(), rl.blockDuration.Milliseconds(),
+	).Int()
+	if err != nil {
+		if !rl.degraded.Swap(true) {
+			rl.logger.WithError(err).Warn("Redis is unreachable, rate limiting in memory until it recovers")
+		}
+		return rl.fallback.AllowAction(userID, action)
+	}
+	if rl.degraded.Swap(false) {
+		rl.logger.Info("Redis is reachable again, rate limiting in Redis")
+	}
+	return allowed == 1
+}
+
+// key returns the Redis key counting a user's requests for an action
+func (rl *RedisRateLimiter) key(userID int64, action string) string {
+	key := redisRateLimitKeyPrefix + strconv.FormatInt(userID, 10)
+	if action != GlobalRateLimitAction {
+		key += ":" + action
+	}
+	return key
+}
+
+// Ping checks that Redis is reachable
+func (rl *RedisRateLimiter) Ping(ctx context.Context) error {
+	if err := rl.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("failed to reach Redis: %w", err)
+	}
+	return nil
+}
+
+// Stop stops the in-memory fallback and closes the Redis client
+func (rl *RedisRateLimiter) Stop() {
+	rl.fallback.Stop()
+	_ = rl.client.Close()
+}
@@ -0,0 +1,110 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRedisRateLimiter creates a limiter backed by mr
+func newTestRedisRateLimiter(t *testing.T, mr *miniredis.Miniredis, cfg RateLimiterConfig) (*RedisRateLimiter, *test.Hook) {
+	t.Helper()
+	logger, hook := test.NewNullLogger()
+	rl := NewRedisRateLimiter(redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1}), cfg, logger)
+	t.Cleanup(rl.Stop)
+	return rl, hook
+}
+
+func TestRedisRateLimiter_Allow(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl, _ := newTestRedisRateLimiter(t, mr, DefaultRateLimiterConfig())
+
+	for i := 0; i < DefaultRateLimit; i++ {
+		assert.True(t, rl.Allow(123), "request %d should be allowed", i+1)
+	}
+	assert.False(t, rl.Allow(123))
+	assert.True(t, rl.Allow(456), "other users have their own limit")
+	assert.True(t, mr.Exists("arcanus:ratelimit:123:blocked"))
+}
+
+func TestRedisRateLimiter_SharedAcrossInstances(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cfg := RateLimiterConfig{MaxRequests: 3}
+	first, _ := newTestRedisRateLimiter(t, mr, cfg)
+	second, _ := newTestRedisRateLimiter(t, mr, cfg)
+
+	assert.True(t, first.Allow(123))
+	assert.True(t, second.Allow(123))
+	assert.True(t, first.Allow(123))
+	assert.False(t, second.Allow(123), "requests to both instances count against one limit")
+	assert.False(t, first.Allow(123))
+}
+
+func TestRedisRateLimiter_AllowAction(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl, _ := newTestRedisRateLimiter(t, mr, RateLimiterConfig{
+		MaxRequests:  3,
+		ActionLimits: map[string]int{"command:/start": 2},
+	})
+
+	assert.True(t, rl.AllowAction(123, "command:/start"))
+	assert.True(t, rl.AllowAction(123, "command:/start"))
+	assert.False(t, rl.AllowAction(123, "command:/start"))
+
+	// Unconfigured actions share the global bucket, which /start did not use
+	assert.True(t, rl.AllowAction(123, "command:/help"))
+	assert.True(t, rl.AllowAction(123, "message"))
+	assert.True(t, rl.Allow(123))
+	assert.False(t, rl.AllowAction(123, "callback:help"))
+}
+
+func TestRedisRateLimiter_WindowAndBlockExpire(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl, _ := newTestRedisRateLimiter(t, mr, RateLimiterConfig{
+		MaxRequests:   2,
+		Window:        time.Minute,
+		BlockDuration: 10 * time.Minute,
+	})
+
+	assert.True(t, rl.Allow(123))
+	assert.True(t, rl.Allow(123))
+	mr.FastForward(time.Minute)
+	assert.True(t, rl.Allow(123), "a new window starts a new count")
+	assert.True(t, rl.Allow(123))
+
+	assert.False(t, rl.Allow(123))
+	mr.FastForward(5 * time.Minute)
+	assert.False(t, rl.Allow(123), "the user stays blocked for the block duration")
+	mr.FastForward(5 * time.Minute)
+	assert.True(t, rl.Allow(123))
+}
+
+func TestRedisRateLimiter_FallsBackToMemory(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rl, hook := newTestRedisRateLimiter(t, mr, RateLimiterConfig{MaxRequests: 2})
+	require.NoError(t, rl.Ping(t.Context()))
+
+	mr.Close()
+	assert.Error(t, rl.Ping(t.Context()))
+	assert.True(t, rl.Allow(123))
+	assert.True(t, rl.Allow(123))
+	assert.False(t, rl.Allow(123), "the in-memory limiter still enforces the limit")
+
+	warnings := 0
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.WarnLevel {
+			warnings++
+		}
+	}
+	assert.Equal(t, 1, warnings, "the outage is logged once")
+
+	require.NoError(t, mr.Restart())
+	assert.True(t, rl.Allow(123), "counting continues in Redis once it recovers")
+	assert.Equal(t, logrus.InfoLevel, hook.LastEntry().Level)
+}
@@ -0,0 +1,24 @@
+package bot
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// isChatNotFound reports whether Telegram rejected a send because the chat does not
+// exist, as for users who never started a private chat with the bot or deleted it
+func isChatNotFound(err error) bool {
+	var apiErr *tgbotapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest &&
+		strings.Contains(strings.ToLower(apiErr.Message), "chat not found")
+}
+
+// isBotBlocked reports whether Telegram rejected a send because the user blocked the bot
+func isBotBlocked(err error) bool {
+	var apiErr *tgbotapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden &&
+		strings.Contains(strings.ToLower(apiErr.Message), "bot was blocked by the user")
+}
@@ -0,0 +1,75 @@
+package bot
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// DefaultSendMaxAttempts is the number of times a send is tried before giving up
+	DefaultSendMaxAttempts = 3
+	// DefaultSendRetryDelay is the delay before the first retry, doubled after each attempt
+	DefaultSendRetryDelay = 500 * time.Millisecond
+	// maxSendRetryWait caps how long a single send waits before retrying. Longer
+	// flood waits are returned to the caller and left to the flood controller
+	maxSendRetryWait = 10 * time.Second
+)
+
+// RetryingBotAPI wraps a BotAPI and retries sends that fail with a transient
+// Telegram error, i.e. a 429 flood wait or a 5xx server error
+type RetryingBotAPI struct {
+	BotAPI
+	maxAttempts int
+	baseDelay   time.Duration
+	sleep       func(time.Duration)
+}
+
+// NewRetryingBotAPI creates a BotAPI that tries each send up to maxAttempts times,
+// waiting baseDelay before the first retry and doubling it after each one. Flood
+// waits use Telegram's retry_after instead
+func NewRetryingBotAPI(botAPI BotAPI, maxAttempts int, baseDelay time.Duration) *RetryingBotAPI {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &RetryingBotAPI{
+		BotAPI:      botAPI,
+		maxAttempts: maxAttempts,
+		baseDelay:   baseDelay,
+		sleep:       time.Sleep,
+	}
+}
+
+// Send sends a message, retrying transient failures with exponential backoff
+func (b *RetryingBotAPI) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	delay := b.baseDelay
+	for attempt := 1; ; attempt++ {
+		msg, err := b.BotAPI.Send(c)
+		if err == nil || attempt >= b.maxAttempts {
+			return msg, err
+		}
+
+		wait, ok := retryDelay(err, delay)
+		if !ok || wait > maxSendRetryWait {
+			return msg, err
+		}
+		b.sleep(wait)
+		delay *= 2
+	}
+}
+
+// retryDelay returns how long to wait before retrying a send that failed with err,
+// and false when the error is not transient
+func retryDelay(err error, backoff time.Duration) (time.Duration, bool) {
+	if retryAfter, ok := floodWaitDuration(err); ok {
+		return retryAfter, true
+	}
+
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code >= http.StatusInternalServerError {
+		return backoff, true
+	}
+	return 0, false
+}
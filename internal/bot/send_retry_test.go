@@ -0,0 +1,77 @@
+package bot
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRetryingBotAPI(botAPI BotAPI, maxAttempts int) (*RetryingBotAPI, *[]time.Duration) {
+	var waits []time.Duration
+	retrying := NewRetryingBotAPI(botAPI, maxAttempts, 100*time.Millisecond)
+	retrying.sleep = func(d time.Duration) { waits = append(waits, d) }
+	return retrying, &waits
+}
+
+func serverError() error {
+	return &tgbotapi.Error{Code: 502, Message: "Bad Gateway"}
+}
+
+func TestRetryingBotAPI_RetriesTransientErrors(t *testing.T) {
+	mockBotAPI := new(MockBotAPI)
+	msg := tgbotapi.NewMessage(456, "hello")
+	mockBotAPI.On("Send", msg).Return(tgbotapi.Message{}, serverError()).Once()
+	mockBotAPI.On("Send", msg).Return(tgbotapi.Message{}, floodWaitError(2)).Once()
+	mockBotAPI.On("Send", msg).Return(tgbotapi.Message{MessageID: 789}, nil).Once()
+
+	retrying, waits := newTestRetryingBotAPI(mockBotAPI, 3)
+	sent, err := retrying.Send(msg)
+
+	require.NoError(t, err)
+	assert.Equal(t, 789, sent.MessageID)
+	// A server error backs off, a flood wait honors retry_after
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 2 * time.Second}, *waits)
+	mockBotAPI.AssertNumberOfCalls(t, "Send", 3)
+}
+
+func TestRetryingBotAPI_BackoffDoubles(t *testing.T) {
+	mockBotAPI := new(MockBotAPI)
+	mockBotAPI.On("Send", mock.Anything).Return(tgbotapi.Message{}, serverError())
+
+	retrying, waits := newTestRetryingBotAPI(mockBotAPI, 4)
+	_, err := retrying.Send(tgbotapi.NewMessage(456, "hello"))
+
+	assert.Error(t, err, "the last error is returned once attempts run out")
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}, *waits)
+	mockBotAPI.AssertNumberOfCalls(t, "Send", 4)
+}
+
+func TestRetryingBotAPI_DoesNotRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"client error", &tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"}},
+		{"network error", fmt.Errorf("connection reset by peer")},
+		{"long flood wait", floodWaitError(60)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBotAPI := new(MockBotAPI)
+			mockBotAPI.On("Send", mock.Anything).Return(tgbotapi.Message{}, tt.err)
+
+			retrying, waits := newTestRetryingBotAPI(mockBotAPI, 3)
+			_, err := retrying.Send(tgbotapi.NewMessage(456, "hello"))
+
+			assert.Equal(t, tt.err, err)
+			assert.Empty(t, *waits)
+			mockBotAPI.AssertNumberOfCalls(t, "Send", 1)
+		})
+	}
+}
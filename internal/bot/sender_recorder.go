@@ -0,0 +1,66 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultRecorderCacheSize bounds the number of users a sender recorder remembers
+const defaultRecorderCacheSize = 100000
+
+// senderRecorder is shared by the recorders that write something about the sender of
+// every update. It remembers when each user was last written so repeated updates do not
+// hit the database
+type senderRecorder struct {
+	logger    *logrus.Logger
+	cacheSize int
+	now       func() time.Time
+	// rewriteAfter is how long a write is remembered; zero remembers it for good
+	rewriteAfter time.Duration
+
+	mu      sync.Mutex
+	written map[int64]time.Time
+}
+
+func newSenderRecorder(logger *logrus.Logger, rewriteAfter time.Duration) senderRecorder {
+	return senderRecorder{
+		logger:       logger,
+		cacheSize:    defaultRecorderCacheSize,
+		now:          time.Now,
+		rewriteAfter: rewriteAfter,
+		written:      make(map[int64]time.Time),
+	}
+}
+
+// observe calls write for the sender of update unless they were written recently.
+// A sender whose write fails is not remembered, so the next update tries again
+func (r *senderRecorder) observe(ctx context.Context, update tgbotapi.Update, write func(ctx context.Context, telegramID int64, now time.Time) error) {
+	user := update.SentFrom()
+	if user == nil || user.IsBot {
+		return
+	}
+
+	now := r.now()
+	r.mu.Lock()
+	last, known := r.written[user.ID]
+	r.mu.Unlock()
+	if known && (r.rewriteAfter == 0 || now.Sub(last) < r.rewriteAfter) {
+		return
+	}
+
+	if err := write(ctx, user.ID, now); err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// The cache only saves writes, so it is simply reset when full
+	if len(r.written) >= r.cacheSize {
+		r.written = make(map[int64]time.Time)
+	}
+	r.written[user.ID] = now
+}
@@ -0,0 +1,70 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// countingRecorderRepository counts the writes of the sender recorders on top of the
+// real repositories
+type countingRecorderRepository struct {
+	domain.UserRepository
+	domain.UserSightingRepository
+	writes int
+}
+
+func (r *countingRecorderRepository) RecordFirstSeen(ctx context.Context, telegramID int64, seenAt time.Time) error {
+	r.writes++
+	return r.UserSightingRepository.RecordFirstSeen(ctx, telegramID, seenAt)
+}
+
+func (r *countingRecorderRepository) UpdateLastActiveAt(ctx context.Context, telegramID int64, at time.Time) error {
+	r.writes++
+	return r.UserRepository.UpdateLastActiveAt(ctx, telegramID, at)
+}
+
+// setupSenderRecorderTest creates the repository, a quiet logger and a clock for the sender recorders
+func setupSenderRecorderTest(t *testing.T) (*countingRecorderRepository, *logrus.Logger, *fakeClock) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&domain.User{}, &domain.UserSighting{}))
+
+	repo := &countingRecorderRepository{
+		UserRepository:         repository.NewUserRepository(db),
+		UserSightingRepository: repository.NewUserSightingRepository(db),
+	}
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	return repo, logger, &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func TestSenderRecorder_ResetsFullCache(t *testing.T) {
+	_, logger, _ := setupSenderRecorderTest(t)
+	recorder := newSenderRecorder(logger, 0)
+	recorder.cacheSize = 2
+	var writes []int64
+	write := func(_ context.Context, telegramID int64, _ time.Time) error {
+		writes = append(writes, telegramID)
+		return nil
+	}
+	update := func(id int64) tgbotapi.Update {
+		return tgbotapi.Update{Message: &tgbotapi.Message{Text: "/help", From: &tgbotapi.User{ID: id}, Chat: &tgbotapi.Chat{ID: id}}}
+	}
+
+	for _, id := range []int64{1, 2, 1, 3, 1} {
+		recorder.observe(context.Background(), update(id), write)
+	}
+
+	// Remembering 3 reset the cache, so 1 is written again
+	assert.Equal(t, []int64{1, 2, 3, 1}, writes)
+}
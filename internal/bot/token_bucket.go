@@ -0,0 +1,109 @@
+package bot
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucketPruneInterval is how often idle, full buckets are dropped
+const tokenBucketPruneInterval = 5 * time.Minute
+
+// tokenBucket is a single user's bucket
+type tokenBucket struct {
+	tokens     float64
+	lastRefill time.Time
+}
+
+// TokenBucketRateLimiter implements per-user rate limiting with token buckets.
+// Each user may burst up to the bucket size, after which requests are allowed
+// at the refill rate. Unlike the fixed-window RateLimiter it does not allow a
+// double burst around window boundaries
+type TokenBucketRateLimiter struct {
+	mu         sync.Mutex
+	refillRate float64 // tokens per second
+	bucketSize float64
+	buckets    map[int64]*tokenBucket
+	lastPrune  time.Time
+	now        func() time.Time
+}
+
+// NewTokenBucketRateLimiter creates a token bucket rate limiter that refills
+// refillRate tokens per second up to bucketSize tokens
+func NewTokenBucketRateLimiter(refillRate float64, bucketSize int) *TokenBucketRateLimiter {
+	if refillRate <= 0 {
+		refillRate = float64(DefaultRateLimit) / DefaultRateLimitWindow.Seconds()
+	}
+	if bucketSize < 1 {
+		bucketSize = DefaultRateLimit
+	}
+	return &TokenBucketRateLimiter{
+		refillRate: refillRate,
+		bucketSize: float64(bucketSize),
+		buckets:    make(map[int64]*tokenBucket),
+		lastPrune:  time.Now(),
+		now:        time.Now,
+	}
+}
+
+// Allow checks if a user is allowed to make a request and takes a token if so
+func (tb *TokenBucketRateLimiter) Allow(userID int64) bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := tb.now()
+	tb.prune(now)
+
+	bucket, exists := tb.buckets[userID]
+	if !exists {
+		bucket = &tokenBucket{tokens: tb.bucketSize, lastRefill: now}
+		tb.buckets[userID] = bucket
+	}
+	tb.refill(bucket, now)
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// Tokens returns the tokens currently available to a user
+func (tb *TokenBucketRateLimiter) Tokens(userID int64) float64 {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	bucket, exists := tb.buckets[userID]
+	if !exists {
+		return tb.bucketSize
+	}
+	tb.refill(bucket, tb.now())
+	return bucket.tokens
+}
+
+// refill adds the tokens earned since the last refill
+func (tb *TokenBucketRateLimiter) refill(bucket *tokenBucket, now time.Time) {
+	elapsed := now.Sub(bucket.lastRefill).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	bucket.tokens += elapsed * tb.refillRate
+	if bucket.tokens > tb.bucketSize {
+		bucket.tokens = tb.bucketSize
+	}
+	bucket.lastRefill = now
+}
+
+// prune drops buckets that have refilled completely, they behave like new ones
+func (tb *TokenBucketRateLimiter) prune(now time.Time) {
+	if now.Sub(tb.lastPrune) < tokenBucketPruneInterval {
+		return
+	}
+	tb.lastPrune = now
+
+	for userID, bucket := range tb.buckets {
+		tb.refill(bucket, now)
+		if bucket.tokens >= tb.bucketSize {
+			delete(tb.buckets, userID)
+		}
+	}
+}
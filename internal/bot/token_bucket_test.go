@@ -0,0 +1,70 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTokenBucket(refillRate float64, bucketSize int) (*TokenBucketRateLimiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	tb := NewTokenBucketRateLimiter(refillRate, bucketSize)
+	tb.now = clock.Now
+	tb.lastPrune = clock.now
+	return tb, clock
+}
+
+func TestTokenBucketRateLimiter_ImplementsMiddlewareRateLimiter(t *testing.T) {
+	var _ middleware.RateLimiter = NewTokenBucketRateLimiter(1, 1)
+}
+
+func TestTokenBucketRateLimiter_Burst(t *testing.T) {
+	tb, _ := newTestTokenBucket(1, 5)
+
+	for i := 0; i < 5; i++ {
+		assert.True(t, tb.Allow(123), "request %d within the burst should be allowed", i+1)
+	}
+	assert.False(t, tb.Allow(123), "burst is limited to the bucket size")
+	assert.True(t, tb.Allow(456), "other users have their own bucket")
+}
+
+func TestTokenBucketRateLimiter_SteadyStateRefill(t *testing.T) {
+	tb, clock := newTestTokenBucket(2, 4) // 2 tokens per second
+
+	for i := 0; i < 4; i++ {
+		assert.True(t, tb.Allow(123))
+	}
+	assert.False(t, tb.Allow(123))
+
+	// Half a second earns exactly one token
+	clock.now = clock.now.Add(500 * time.Millisecond)
+	assert.True(t, tb.Allow(123))
+	assert.False(t, tb.Allow(123))
+
+	// At the refill rate every request is allowed
+	for i := 0; i < 10; i++ {
+		clock.now = clock.now.Add(500 * time.Millisecond)
+		assert.True(t, tb.Allow(123), "steady request %d should be allowed", i+1)
+	}
+
+	// No double burst at any boundary: a long pause only refills up to the bucket size
+	clock.now = clock.now.Add(time.Hour)
+	assert.InDelta(t, 4, tb.Tokens(123), 0.001)
+	for i := 0; i < 4; i++ {
+		assert.True(t, tb.Allow(123))
+	}
+	assert.False(t, tb.Allow(123))
+}
+
+func TestTokenBucketRateLimiter_PrunesFullBuckets(t *testing.T) {
+	tb, clock := newTestTokenBucket(1, 2)
+
+	assert.True(t, tb.Allow(123))
+	clock.now = clock.now.Add(tokenBucketPruneInterval)
+	assert.True(t, tb.Allow(456))
+
+	assert.NotContains(t, tb.buckets, int64(123), "refilled buckets are dropped")
+	assert.Contains(t, tb.buckets, int64(456))
+}
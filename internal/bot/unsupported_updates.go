@@ -0,0 +1,94 @@
+package bot
+
+import (
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// UnsupportedUpdateRecorder counts unsupported updates by type
+type UnsupportedUpdateRecorder interface {
+	RecordUnsupportedUpdate(updateType string)
+}
+
+// UnsupportedUpdateHandler handles updates the bot has no handler for. Every such
+// update is logged and counted per type, and edited messages can optionally be
+// answered with a hint so users know their edit was not processed
+type UnsupportedUpdateHandler struct {
+	botAPI            BotAPI
+	logger            *logrus.Logger
+	editedMessageHint string
+	recorder          UnsupportedUpdateRecorder
+}
+
+// NewUnsupportedUpdateHandler creates a new handler for unsupported updates. An empty
+// hint disables replies to edited messages
+func NewUnsupportedUpdateHandler(botAPI BotAPI, logger *logrus.Logger, editedMessageHint string) *UnsupportedUpdateHandler {
+	return &UnsupportedUpdateHandler{
+		botAPI:            botAPI,
+		logger:            logger,
+		editedMessageHint: editedMessageHint,
+	}
+}
+
+// SetRecorder configures where unsupported updates are counted
+func (h *UnsupportedUpdateHandler) SetRecorder(recorder UnsupportedUpdateRecorder) {
+	h.recorder = recorder
+}
+
+// Handle records an unsupported update and replies to edited messages when configured
+func (h *UnsupportedUpdateHandler) Handle(update tgbotapi.Update) error {
+	updateType := unsupportedUpdateType(update)
+
+	if h.recorder != nil {
+		h.recorder.RecordUnsupportedUpdate(updateType)
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"update_id":   update.UpdateID,
+		"update_type": updateType,
+	}).Info("Ignoring unsupported update")
+
+	if update.EditedMessage == nil || h.editedMessageHint == "" {
+		return nil
+	}
+
+	msg := tgbotapi.NewMessage(update.EditedMessage.Chat.ID, h.editedMessageHint)
+	msg.ReplyToMessageID = update.EditedMessage.MessageID
+	if _, err := h.botAPI.Send(msg); err != nil {
+		return fmt.Errorf("failed to send edited message hint: %w", err)
+	}
+	return nil
+}
+
+// unsupportedUpdateType names the kind of update for logs and metrics
+func unsupportedUpdateType(update tgbotapi.Update) string {
+	switch {
+	case update.EditedMessage != nil:
+		return "edited_message"
+	case update.ChannelPost != nil:
+		return "channel_post"
+	case update.EditedChannelPost != nil:
+		return "edited_channel_post"
+	case update.InlineQuery != nil:
+		return "inline_query"
+	case update.ChosenInlineResult != nil:
+		return "chosen_inline_result"
+	case update.ShippingQuery != nil:
+		return "shipping_query"
+	case update.PreCheckoutQuery != nil:
+		return "pre_checkout_query"
+	case update.Poll != nil:
+		return "poll"
+	case update.PollAnswer != nil:
+		return "poll_answer"
+	case update.MyChatMember != nil:
+		return "my_chat_member"
+	case update.ChatMember != nil:
+		return "chat_member"
+	case update.ChatJoinRequest != nil:
+		return "chat_join_request"
+	}
+	return "unknown"
+}
@@ -0,0 +1,74 @@
+package bot
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestUnsupportedUpdateHandler(hint string) (*MockBotAPI, *UnsupportedUpdateHandler, *metrics.Metrics) {
+	mockBotAPI := new(MockBotAPI)
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	botMetrics := metrics.New()
+	handler := NewUnsupportedUpdateHandler(mockBotAPI, logger, hint)
+	handler.SetRecorder(botMetrics)
+	return mockBotAPI, handler, botMetrics
+}
+
+func TestUnsupportedUpdateHandler_EditedMessage(t *testing.T) {
+	mockBotAPI, handler, botMetrics := newTestUnsupportedUpdateHandler("Edits are not processed, please send a new message.")
+
+	var sent tgbotapi.MessageConfig
+	mockBotAPI.On("Send", mock.AnythingOfType("tgbotapi.MessageConfig")).
+		Run(func(args mock.Arguments) {
+			sent = args.Get(0).(tgbotapi.MessageConfig)
+		}).
+		Return(tgbotapi.Message{}, nil)
+
+	err := handler.Handle(tgbotapi.Update{EditedMessage: &tgbotapi.Message{
+		MessageID: 42,
+		Text:      "/account",
+		From:      &tgbotapi.User{ID: 123},
+		Chat:      &tgbotapi.Chat{ID: 456},
+	}})
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(456), sent.ChatID)
+	assert.Equal(t, 42, sent.ReplyToMessageID)
+	assert.Contains(t, sent.Text, "Edits are not processed")
+	assert.Equal(t, float64(1), botMetrics.UnsupportedUpdates.WithLabelValue("edited_message").Value())
+}
+
+func TestUnsupportedUpdateHandler_EditedMessageWithoutHint(t *testing.T) {
+	mockBotAPI, handler, botMetrics := newTestUnsupportedUpdateHandler("")
+
+	err := handler.Handle(tgbotapi.Update{EditedMessage: &tgbotapi.Message{
+		Text: "hello",
+		Chat: &tgbotapi.Chat{ID: 456},
+	}})
+
+	require.NoError(t, err)
+	mockBotAPI.AssertNotCalled(t, "Send", mock.Anything)
+	assert.Equal(t, float64(1), botMetrics.UnsupportedUpdates.WithLabelValue("edited_message").Value())
+}
+
+func TestUnsupportedUpdateHandler_ChannelPost(t *testing.T) {
+	mockBotAPI, handler, botMetrics := newTestUnsupportedUpdateHandler("Edits are not processed.")
+
+	for i := 0; i < 2; i++ {
+		err := handler.Handle(tgbotapi.Update{ChannelPost: &tgbotapi.Message{
+			Text: "announcement",
+			Chat: &tgbotapi.Chat{ID: -100, Type: "channel"},
+		}})
+		require.NoError(t, err)
+	}
+
+	mockBotAPI.AssertNotCalled(t, "Send", mock.Anything)
+	assert.Equal(t, float64(2), botMetrics.UnsupportedUpdates.WithLabelValue("channel_post").Value())
+}
@@ -0,0 +1,134 @@
+package bot
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// webhookBufferSize matches the buffer tgbotapi uses for its long-polling channel
+	webhookBufferSize = 100
+	// SecretTokenHeader carries the secret token Telegram sends with every webhook request
+	SecretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+)
+
+// RegisterWebhook registers endpoint as the bot's webhook with the secret token
+// Telegram must send back, and verifies with getWebhookInfo that Telegram accepted it.
+// tgbotapi's WebhookConfig has no secret token, so setWebhook is sent directly
+func RegisterWebhook(botAPI BotAPI, endpoint, secretToken string) error {
+	params := tgbotapi.Params{"url": endpoint}
+	params.AddNonEmpty("secret_token", secretToken)
+	if _, err := botAPI.MakeRequest("setWebhook", params); err != nil {
+		return fmt.Errorf("failed to set webhook: %w", err)
+	}
+
+	info, err := botAPI.GetWebhookInfo()
+	if err != nil {
+		return fmt.Errorf("failed to get webhook info: %w", err)
+	}
+	if info.URL != endpoint {
+		return fmt.Errorf("webhook was not registered: telegram reports %q", info.URL)
+	}
+	return nil
+}
+
+// DeleteWebhook removes the bot's webhook so updates can be received by long polling.
+// Pending updates are kept and delivered to whichever mode runs next
+func DeleteWebhook(botAPI BotAPI) error {
+	if _, err := botAPI.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	return nil
+}
+
+// WebhookReceiver is an http.Handler turning webhook requests from Telegram into an
+// update channel, the webhook counterpart of GetUpdatesChan. Only requests carrying
+// the secret token are accepted
+type WebhookReceiver struct {
+	secretToken []byte
+	updates     chan tgbotapi.Update
+	done        chan struct{}
+
+	mu        sync.RWMutex
+	closed    bool
+	closeOnce sync.Once
+}
+
+// NewWebhookReceiver creates a webhook receiver accepting requests with secretToken.
+// An empty token rejects every request
+func NewWebhookReceiver(secretToken string) *WebhookReceiver {
+	return &WebhookReceiver{
+		secretToken: []byte(secretToken),
+		updates:     make(chan tgbotapi.Update, webhookBufferSize),
+		done:        make(chan struct{}),
+	}
+}
+
+// Updates returns the channel webhook updates are delivered on. It is closed by Close
+func (r *WebhookReceiver) Updates() tgbotapi.UpdatesChannel {
+	return r.updates
+}
+
+// ServeHTTP decodes the update in the request body and queues it for processing
+func (r *WebhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !r.authorized(req) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var update tgbotapi.Update
+	if err := json.NewDecoder(req.Body).Decode(&update); err != nil {
+		http.Error(w, "invalid update", http.StatusBadRequest)
+		return
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		// Telegram retries failed deliveries, so the update is not lost
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	select {
+	case r.updates <- update:
+		w.WriteHeader(http.StatusOK)
+	case <-r.done:
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+	case <-req.Context().Done():
+		http.Error(w, "request cancelled", http.StatusServiceUnavailable)
+	}
+}
+
+// authorized reports whether the request carries the secret token, compared in
+// constant time so the token cannot be guessed from response times
+func (r *WebhookReceiver) authorized(req *http.Request) bool {
+	if len(r.secretToken) == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(req.Header.Get(SecretTokenHeader)), r.secretToken) == 1
+}
+
+// Close stops accepting updates and closes the update channel. Only the first call
+// has an effect
+func (r *WebhookReceiver) Close() {
+	r.closeOnce.Do(func() {
+		// Release requests blocked on a full channel before waiting for them
+		close(r.done)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.closed = true
+		close(r.updates)
+	})
+}
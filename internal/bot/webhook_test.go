@@ -0,0 +1,127 @@
+package bot
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testWebhookEndpoint = "https://bot.example.com/hook/s3cr3t"
+
+func TestRegisterWebhook(t *testing.T) {
+	t.Run("sets and verifies the webhook", func(t *testing.T) {
+		mockBotAPI := new(MockBotAPI)
+		mockBotAPI.On("MakeRequest", "setWebhook", tgbotapi.Params{"url": testWebhookEndpoint, "secret_token": "s3cr3t"}).
+			Return(&tgbotapi.APIResponse{Ok: true}, nil)
+		mockBotAPI.On("GetWebhookInfo").Return(tgbotapi.WebhookInfo{URL: testWebhookEndpoint}, nil)
+
+		require.NoError(t, RegisterWebhook(mockBotAPI, testWebhookEndpoint, "s3cr3t"))
+		mockBotAPI.AssertExpectations(t)
+	})
+
+	t.Run("fails when telegram rejects the webhook", func(t *testing.T) {
+		mockBotAPI := new(MockBotAPI)
+		mockBotAPI.On("MakeRequest", "setWebhook", mock.Anything).
+			Return((*tgbotapi.APIResponse)(nil), errors.New("bad webhook: HTTPS url must be provided"))
+
+		err := RegisterWebhook(mockBotAPI, testWebhookEndpoint, "s3cr3t")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to set webhook")
+		mockBotAPI.AssertNotCalled(t, "GetWebhookInfo")
+	})
+
+	t.Run("fails when the registered URL does not match", func(t *testing.T) {
+		mockBotAPI := new(MockBotAPI)
+		mockBotAPI.On("MakeRequest", "setWebhook", mock.Anything).
+			Return(&tgbotapi.APIResponse{Ok: true}, nil)
+		mockBotAPI.On("GetWebhookInfo").Return(tgbotapi.WebhookInfo{}, nil)
+
+		err := RegisterWebhook(mockBotAPI, testWebhookEndpoint, "s3cr3t")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "webhook was not registered")
+	})
+}
+
+func TestDeleteWebhook(t *testing.T) {
+	mockBotAPI := new(MockBotAPI)
+	mockBotAPI.On("Request", tgbotapi.DeleteWebhookConfig{}).Return(&tgbotapi.APIResponse{Ok: true}, nil).Once()
+	require.NoError(t, DeleteWebhook(mockBotAPI))
+
+	mockBotAPI.On("Request", tgbotapi.DeleteWebhookConfig{}).Return((*tgbotapi.APIResponse)(nil), errors.New("unauthorized")).Once()
+	assert.Error(t, DeleteWebhook(mockBotAPI))
+	mockBotAPI.AssertExpectations(t)
+}
+
+// newWebhookRequest creates a webhook request carrying the secret token
+func newWebhookRequest(method, body, secretToken string) *http.Request {
+	req := httptest.NewRequest(method, "/hook", strings.NewReader(body))
+	req.Header.Set(SecretTokenHeader, secretToken)
+	return req
+}
+
+func TestWebhookReceiver(t *testing.T) {
+	t.Run("queues posted updates", func(t *testing.T) {
+		receiver := NewWebhookReceiver("s3cr3t")
+		defer receiver.Close()
+
+		req := newWebhookRequest(http.MethodPost, `{"update_id":42,"message":{"message_id":1,"text":"/start"}}`, "s3cr3t")
+		rec := httptest.NewRecorder()
+		receiver.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		update := <-receiver.Updates()
+		assert.Equal(t, 42, update.UpdateID)
+		assert.Equal(t, "/start", update.Message.Text)
+	})
+
+	t.Run("rejects bad requests", func(t *testing.T) {
+		receiver := NewWebhookReceiver("s3cr3t")
+		defer receiver.Close()
+
+		rec := httptest.NewRecorder()
+		receiver.ServeHTTP(rec, newWebhookRequest(http.MethodGet, "", "s3cr3t"))
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+		rec = httptest.NewRecorder()
+		receiver.ServeHTTP(rec, newWebhookRequest(http.MethodPost, "not json", "s3cr3t"))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("rejects requests without the secret token", func(t *testing.T) {
+		receiver := NewWebhookReceiver("s3cr3t")
+		defer receiver.Close()
+
+		for _, token := range []string{"", "wrong", "s3cr3t-but-longer"} {
+			rec := httptest.NewRecorder()
+			receiver.ServeHTTP(rec, newWebhookRequest(http.MethodPost, `{"update_id":1}`, token))
+			assert.Equal(t, http.StatusUnauthorized, rec.Code, token)
+		}
+		assert.Empty(t, receiver.Updates())
+
+		open := NewWebhookReceiver("")
+		defer open.Close()
+		rec := httptest.NewRecorder()
+		open.ServeHTTP(rec, newWebhookRequest(http.MethodPost, `{"update_id":1}`, ""))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, "a receiver without a token accepts nothing")
+	})
+
+	t.Run("close ends the update channel", func(t *testing.T) {
+		receiver := NewWebhookReceiver("s3cr3t")
+		receiver.Close()
+		receiver.Close()
+
+		_, ok := <-receiver.Updates()
+		assert.False(t, ok)
+
+		rec := httptest.NewRecorder()
+		receiver.ServeHTTP(rec, newWebhookRequest(http.MethodPost, `{"update_id":1}`, "s3cr3t"))
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+}
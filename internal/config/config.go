@@ -1,12 +1,21 @@
 package config
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
 )
 
 // Config holds all application configuration
@@ -15,10 +24,13 @@ type Config struct {
 	TelegramToken string
 	
 	// Database configuration
+	DatabaseDriver     string // postgres, mysql or sqlite
 	DatabaseURL        string
 	DatabaseMaxConns   int
 	DatabaseMaxIdleConns int
 	DatabaseConnMaxLifetime time.Duration
+	DatabaseQueryTimeout    time.Duration // deadline for each user query, 0 disables it
+	MigrateOnStart          bool
 	
 	// Kafka configuration
 	KafkaBrokers           string
@@ -32,6 +44,18 @@ type Config struct {
 	KafkaRetryBackoffMs    int
 	KafkaRequestTimeoutMs  int
 	KafkaEnabled           bool
+	KafkaConsumerEnabled   bool   // consume events from the topic, e.g. quota updates from traffic accounting
+	KafkaConsumerGroup     string
+	KafkaDLQTopic          string // dead-letter topic for events that failed delivery, empty drops them
+	KafkaDLQFile           string // local file dead letters are appended to when the dead-letter topic cannot be written
+	KafkaSyncDelivery      bool   // wait for the brokers to acknowledge each event; false only queues it
+	EventKeyCasing         string // casing of event data keys: snake or camel
+	EventBackend           string // where events are published: kafka, nats or mock
+	NatsURL                string
+	NatsSubject            string // prefix of the subjects events are published to
+	EventsEnabled          bool   // when false, event publishing is a no-op
+	EventBatchSize         int    // low-priority events buffered per batch; below 2 publishes each right away
+	EventBatchInterval     time.Duration // longest a low-priority event stays buffered
 	
 	// Logging configuration
 	LogLevel string
@@ -48,10 +72,86 @@ type Config struct {
 	// Server configuration
 	Port    int
 	Timeout time.Duration
+
+	// Webhook configuration; an empty WebhookURL receives updates by long polling
+	WebhookURL    string // public HTTPS URL Telegram delivers updates to
+	WebhookSecret string // required in webhook mode; appended to WebhookURL as a path segment and sent by Telegram in every request
+
+	// Telegram send retries on 429 and 5xx responses
+	TelegramSendMaxAttempts int           // attempts per send, 1 disables retries
+	TelegramSendRetryDelay  time.Duration // delay before the first retry, doubled after each one
+	NotificationRate        float64       // notifications sent per second by the notification dispatcher
+
+	// Quiet hours during which optional notifications are held; empty start and end disable them
+	QuietHoursStart    string // HH:MM the quiet hours begin at
+	QuietHoursEnd      string // HH:MM the quiet hours end at, before QuietHoursStart for a window spanning midnight
+	QuietHoursTimezone string // IANA timezone the quiet hours are in
+
+	// VPN server configuration; an empty VPNServerEndpoint disables issuing VPN configs
+	VPNServerEndpoint  string // host:port of the WireGuard server clients connect to
+	VPNServerPublicKey string // base64 WireGuard public key of the server
+	VPNClientSubnet    string // IPv4 CIDR client addresses are assigned from
+	VPNDNS             string // DNS server written into client configs
+	VPNWGInterface     string // local WireGuard interface /test reads peers from, empty disables /test
 	
 	// Application settings
 	Environment string // development, staging, production
 	Debug       bool
+	Version     string // build version reported in startup events and bug reports
+
+	// Admin settings
+	AdminTelegramIDs   []int64
+	AdminChatID        int64 // chat receiving admin notifications such as bug reports; 0 sends to each admin
+	AnonymizeUsernames bool  // replace usernames with pseudonyms in admin listings
+
+	// Rate limit settings
+	RateLimitMaxRequests   int              // requests allowed per user within the window
+	RateLimitWindow        time.Duration    // window in which requests are counted
+	RateLimitBlockDuration time.Duration    // how long a user stays blocked after exceeding the limit
+	RateLimitActions       map[string]int64 // requests per window for single actions, e.g. "command:/start"
+	RedisURL               string        // optional Redis shared by all instances for rate limits and sessions; empty keeps them in memory
+	SessionTTL             time.Duration // how long a user's conversational session is kept after their last update
+
+	// Abuse settings
+	AbuseBanThreshold int           // rate-limit blocks within the window before an auto-ban; 0 disables
+	AbuseBanWindow    time.Duration // window in which rate-limit blocks are counted
+
+	// Help settings
+	SupportContact   string
+	HelpTemplatePath string // optional text/template file overriding the built-in help
+
+	// Unsupported update settings
+	EditedMessageHint string // reply sent when a user edits a non-command message; empty only logs the update
+
+	// Trial settings
+	TrialQuotaLimit int64 // bytes
+	TrialDuration   time.Duration // 0 means trials never expire
+	// Trial quota overrides keyed by region (Telegram language code), in bytes
+	TrialQuotaRegions map[string]int64
+	// Quota in bytes credited to both the referrer and the referred user
+	ReferralBonus int64
+
+	// Plans offered to users, in display order
+	Plans []domain.Plan
+	// Payment provider token from @BotFather; plans priced in Telegram Stars (XTR) need none
+	PaymentProviderToken string
+	// How often users whose paid plan lapsed are downgraded
+	PlanExpiryCheckInterval time.Duration
+	// How long a lapsed paid user keeps their plan, with reminders, before being downgraded
+	PaidGracePeriod time.Duration
+
+	// Days of inactivity after which a user's personal data is anonymized, 0 disables it
+	DataRetentionDays int
+
+	// Runtime settings
+	SettingsRefreshInterval time.Duration // how often database settings are reloaded
+
+	// Startup self-test settings
+	StartupSelfTest bool   // check the database, event backend and Telegram before serving updates
+	SelfTestTopic   string // Kafka topic the self-test publishes to, kept apart from the events topic
+
+	// Process lock settings
+	ProcessLockPath string // file held while the bot runs so a second instance refuses to start; empty uses the temp directory
 }
 
 // Validator interface for configuration validation
@@ -88,7 +188,27 @@ func (e *EnvLoader) Load() (*Config, error) {
 		Environment:     getEnvOrDefault("ENVIRONMENT", "development"),
 		Port:           getEnvAsIntOrDefault("PORT", 8080),
 		Debug:          getEnvAsBoolOrDefault("DEBUG", false),
+		Version:        getEnvOrDefault("BUILD_VERSION", "dev"),
 		Timeout:        getEnvAsDurationOrDefault("TIMEOUT", 30*time.Second),
+		WebhookURL:     getEnvOrDefault("WEBHOOK_URL", ""),
+		WebhookSecret:  getEnvOrDefault("WEBHOOK_SECRET", ""),
+
+		// Telegram send retries
+		TelegramSendMaxAttempts: getEnvAsIntOrDefault("TELEGRAM_SEND_MAX_ATTEMPTS", 3),
+		TelegramSendRetryDelay:  getEnvAsDurationOrDefault("TELEGRAM_SEND_RETRY_DELAY", 500*time.Millisecond),
+		NotificationRate:        getEnvAsFloatOrDefault("NOTIFICATION_RATE", 25),
+
+		// Quiet hours
+		QuietHoursStart:    getEnvOrDefault("QUIET_HOURS_START", ""),
+		QuietHoursEnd:      getEnvOrDefault("QUIET_HOURS_END", ""),
+		QuietHoursTimezone: getEnvOrDefault("QUIET_HOURS_TIMEZONE", "UTC"),
+		
+		// VPN configuration
+		VPNServerEndpoint:  getEnvOrDefault("VPN_SERVER_ENDPOINT", ""),
+		VPNServerPublicKey: getEnvOrDefault("VPN_SERVER_PUBLIC_KEY", ""),
+		VPNClientSubnet:    getEnvOrDefault("VPN_CLIENT_SUBNET", "10.8.0.0/16"),
+		VPNDNS:             getEnvOrDefault("VPN_DNS", "1.1.1.1"),
+		VPNWGInterface:     getEnvOrDefault("VPN_WG_INTERFACE", ""),
 		
 		// Sentry configuration
 		SentryDSN:              getEnvOrDefault("SENTRY_DSN", ""),
@@ -99,9 +219,12 @@ func (e *EnvLoader) Load() (*Config, error) {
 		SentryTracesSampleRate: getEnvAsFloatOrDefault("SENTRY_TRACES_SAMPLE_RATE", 0.1),
 		
 		// Database connection settings
+		DatabaseDriver:          getEnvOrDefault("DATABASE_DRIVER", "postgres"),
 		DatabaseMaxConns:        getEnvAsIntOrDefault("DB_MAX_CONNS", 25),
 		DatabaseMaxIdleConns:    getEnvAsIntOrDefault("DB_MAX_IDLE_CONNS", 5),
 		DatabaseConnMaxLifetime: getEnvAsDurationOrDefault("DB_CONN_MAX_LIFETIME", 5*time.Minute),
+		DatabaseQueryTimeout:    getEnvAsDurationOrDefault("DB_QUERY_TIMEOUT", 5*time.Second),
+		MigrateOnStart:          getEnvAsBoolOrDefault("MIGRATE_ON_START", true),
 		
 		// Kafka configuration
 		KafkaBrokers:           getEnvOrDefault("KAFKA_BROKERS", "localhost:9092"),
@@ -115,11 +238,99 @@ func (e *EnvLoader) Load() (*Config, error) {
 		KafkaRetryBackoffMs:    getEnvAsIntOrDefault("KAFKA_RETRY_BACKOFF_MS", 100),
 		KafkaRequestTimeoutMs:  getEnvAsIntOrDefault("KAFKA_REQUEST_TIMEOUT_MS", 30000),
 		KafkaEnabled:           getEnvAsBoolOrDefault("KAFKA_ENABLED", true),
+		KafkaConsumerEnabled:   getEnvAsBoolOrDefault("KAFKA_CONSUMER_ENABLED", false),
+		KafkaConsumerGroup:     getEnvOrDefault("KAFKA_CONSUMER_GROUP", "arcanus-vpn-bot"),
+		KafkaDLQTopic:          getEnvOrDefault("KAFKA_DLQ_TOPIC", ""),
+		KafkaDLQFile:           getEnvOrDefault("KAFKA_DLQ_FILE", ""),
+		KafkaSyncDelivery:      getEnvAsBoolOrDefault("KAFKA_SYNC_DELIVERY", true),
+		EventKeyCasing:         getEnvOrDefault("EVENT_KEY_CASING", "snake"),
+		EventBackend:           getEnvOrDefault("EVENT_BACKEND", "kafka"),
+		NatsURL:                getEnvOrDefault("NATS_URL", "nats://localhost:4222"),
+		NatsSubject:            getEnvOrDefault("NATS_SUBJECT", "arcanus.events"),
+		EventsEnabled:          getEnvAsBoolOrDefault("EVENTS_ENABLED", true),
+		EventBatchSize:         getEnvAsIntOrDefault("EVENT_BATCH_SIZE", 100),
+		EventBatchInterval:     getEnvAsDurationOrDefault("EVENT_BATCH_INTERVAL", time.Second),
+
+		// Admin settings
+		AdminChatID:        getEnvAsInt64OrDefault("ADMIN_CHAT_ID", 0),
+		AnonymizeUsernames: getEnvAsBoolOrDefault("ANONYMIZE_USERNAMES", false),
+
+		// Rate limit settings
+		RateLimitMaxRequests:   getEnvAsIntOrDefault("RATE_LIMIT_MAX_REQUESTS", 20),
+		RateLimitWindow:        getEnvAsDurationOrDefault("RATE_LIMIT_WINDOW", time.Minute),
+		RateLimitBlockDuration: getEnvAsDurationOrDefault("RATE_LIMIT_BLOCK_DURATION", 10*time.Minute),
+		RedisURL:               getEnvOrDefault("REDIS_URL", ""),
+		SessionTTL:             getEnvAsDurationOrDefault("SESSION_TTL", 30*time.Minute),
+
+		// Abuse settings
+		AbuseBanThreshold: getEnvAsIntOrDefault("ABUSE_BAN_THRESHOLD", 30),
+		AbuseBanWindow:    getEnvAsDurationOrDefault("ABUSE_BAN_WINDOW", time.Hour),
+
+		// Help settings
+		SupportContact:   getEnvOrDefault("SUPPORT_CONTACT", "@support"),
+		HelpTemplatePath: getEnvOrDefault("HELP_TEMPLATE_PATH", ""),
+
+		// Unsupported update settings
+		EditedMessageHint: getEnvOrDefault("EDITED_MESSAGE_HINT", ""),
+
+		// Trial settings
+		TrialQuotaLimit: getEnvAsInt64OrDefault("TRIAL_QUOTA_BYTES", domain.DefaultQuotaLimit),
+		TrialDuration:   getEnvAsDurationOrDefault("TRIAL_DURATION", domain.DefaultTrialDuration),
+		ReferralBonus:   getEnvAsInt64OrDefault("REFERRAL_BONUS_BYTES", domain.DefaultReferralBonus),
+
+		// Plan settings
+		PaymentProviderToken:    getEnvOrDefault("PAYMENT_PROVIDER_TOKEN", ""),
+		PlanExpiryCheckInterval: getEnvAsDurationOrDefault("PLAN_EXPIRY_CHECK_INTERVAL", 10*time.Minute),
+		PaidGracePeriod:         getEnvAsDurationOrDefault("PAID_GRACE_PERIOD", 72*time.Hour),
+
+		// Privacy settings
+		DataRetentionDays: getEnvAsIntOrDefault("DATA_RETENTION_DAYS", 0),
+
+		// Runtime settings
+		SettingsRefreshInterval: getEnvAsDurationOrDefault("SETTINGS_REFRESH_INTERVAL", DefaultSettingsRefreshInterval),
+
+		// Startup self-test settings
+		StartupSelfTest: getEnvAsBoolOrDefault("STARTUP_SELFTEST", false),
+		SelfTestTopic:   getEnvOrDefault("SELFTEST_TOPIC", "arcanus-selftest"),
+
+		// Process lock settings
+		ProcessLockPath: getEnvOrDefault("PROCESS_LOCK_PATH", ""),
 	}
+
+	// A mistyped admin ID must not silently revoke that admin's access
+	adminTelegramIDs, err := getEnvAsInt64SliceOrDefault("ADMIN_TELEGRAM_IDS", nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ADMIN_TELEGRAM_IDS: %w", err)
+	}
+	config.AdminTelegramIDs = adminTelegramIDs
+
+	trialQuotaRegions, err := getEnvAsInt64MapOrDefault("TRIAL_QUOTA_REGIONS", nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TRIAL_QUOTA_REGIONS: %w", err)
+	}
+	config.TrialQuotaRegions = trialQuotaRegions
+
+	rateLimitActions, err := getEnvAsInt64MapOrDefault("RATE_LIMIT_ACTIONS", nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RATE_LIMIT_ACTIONS: %w", err)
+	}
+	config.RateLimitActions = rateLimitActions
+
+	plans, err := loadPlans(os.Getenv("PLANS"), os.Getenv("PLANS_FILE"))
+	if err != nil {
+		return nil, err
+	}
+	config.Plans = plans
 	
 	return config, nil
 }
 
+// validLogLevels are the accepted values of LOG_LEVEL and the log_level setting
+var validLogLevels = map[string]bool{
+	"panic": true, "fatal": true, "error": true,
+	"warn": true, "info": true, "debug": true, "trace": true,
+}
+
 // Validate validates the configuration
 func (c *Config) Validate() error {
 	if c.TelegramToken == "" {
@@ -131,10 +342,6 @@ func (c *Config) Validate() error {
 	}
 	
 	// Validate log level
-	validLogLevels := map[string]bool{
-		"panic": true, "fatal": true, "error": true,
-		"warn": true, "info": true, "debug": true, "trace": true,
-	}
 	if !validLogLevels[c.LogLevel] {
 		return fmt.Errorf("invalid log level: %s", c.LogLevel)
 	}
@@ -165,6 +372,41 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("database max idle connections must be between 0 and max connections")
 	}
 	
+	// Validate admin IDs
+	for _, id := range c.AdminTelegramIDs {
+		if id <= 0 {
+			return fmt.Errorf("invalid admin telegram ID: %d, must be positive", id)
+		}
+	}
+	
+	// Validate abuse auto-ban settings
+	if c.AbuseBanThreshold < 0 {
+		return fmt.Errorf("invalid abuse ban threshold: %d, must not be negative", c.AbuseBanThreshold)
+	}
+	if c.AbuseBanThreshold > 0 && c.AbuseBanWindow <= 0 {
+		return fmt.Errorf("invalid abuse ban window: %s, must be positive", c.AbuseBanWindow)
+	}
+	
+	// Validate trial quota
+	if c.TrialQuotaLimit <= 0 {
+		return fmt.Errorf("invalid trial quota: %d, must be positive", c.TrialQuotaLimit)
+	}
+	
+	// Validate trial duration
+	if c.TrialDuration < 0 {
+		return fmt.Errorf("invalid trial duration: %s, must not be negative", c.TrialDuration)
+	}
+	
+	// Validate trial quota overrides
+	for region, quota := range c.TrialQuotaRegions {
+		if strings.TrimSpace(region) == "" {
+			return fmt.Errorf("trial quota region must not be empty")
+		}
+		if quota <= 0 {
+			return fmt.Errorf("invalid trial quota for region %s: %d, must be positive", region, quota)
+		}
+	}
+	
 	// Validate Kafka settings if enabled
 	if c.KafkaEnabled {
 		if c.KafkaBrokers == "" {
@@ -176,6 +418,105 @@ func (c *Config) Validate() error {
 		if c.KafkaAcks != "all" && c.KafkaAcks != "1" && c.KafkaAcks != "0" {
 			return fmt.Errorf("invalid KAFKA_ACKS value: %s, must be 'all', '1', or '0'", c.KafkaAcks)
 		}
+		if c.KafkaDLQTopic != "" && c.KafkaDLQTopic == c.KafkaTopic {
+			return fmt.Errorf("KAFKA_DLQ_TOPIC must differ from KAFKA_TOPIC")
+		}
+		if c.KafkaConsumerEnabled && c.KafkaConsumerGroup == "" {
+			return fmt.Errorf("KAFKA_CONSUMER_GROUP is required when the Kafka consumer is enabled")
+		}
+	}
+	
+	// Validate the event backend; empty means the Kafka default
+	switch c.EventBackend {
+	case "", "kafka", "mock":
+	case "nats":
+		if c.NatsURL == "" {
+			return fmt.Errorf("NATS_URL is required when the event backend is nats")
+		}
+		if c.NatsSubject == "" || strings.ContainsAny(c.NatsSubject, "*> \t") {
+			return fmt.Errorf("invalid NATS_SUBJECT value: %q, must be a subject without wildcards", c.NatsSubject)
+		}
+	default:
+		return fmt.Errorf("invalid EVENT_BACKEND value: %s, must be 'kafka', 'nats' or 'mock'", c.EventBackend)
+	}
+
+	// Validate event data key casing; empty means the snake_case default
+	if c.EventKeyCasing != "" && c.EventKeyCasing != "snake" && c.EventKeyCasing != "camel" {
+		return fmt.Errorf("invalid event key casing: %s, must be 'snake' or 'camel'", c.EventKeyCasing)
+	}
+	if c.EventBatchSize < 0 {
+		return fmt.Errorf("invalid event batch size: %d, must not be negative", c.EventBatchSize)
+	}
+	if c.EventBatchSize > 1 && c.EventBatchInterval <= 0 {
+		return fmt.Errorf("invalid event batch interval: %s, must be positive when batching", c.EventBatchInterval)
+	}
+	
+	// Validate rate limit settings
+	if c.RateLimitMaxRequests < 1 {
+		return fmt.Errorf("invalid rate limit max requests: %d, must be at least 1", c.RateLimitMaxRequests)
+	}
+	if c.RateLimitWindow <= 0 {
+		return fmt.Errorf("invalid rate limit window: %s, must be positive", c.RateLimitWindow)
+	}
+	if c.RateLimitBlockDuration <= 0 {
+		return fmt.Errorf("invalid rate limit block duration: %s, must be positive", c.RateLimitBlockDuration)
+	}
+	for action, limit := range c.RateLimitActions {
+		if limit < 1 {
+			return fmt.Errorf("invalid rate limit for action %s: %d, must be at least 1", action, limit)
+		}
+	}
+	if c.SessionTTL < 0 {
+		return fmt.Errorf("invalid session TTL: %s, must not be negative", c.SessionTTL)
+	}
+	if c.RedisURL != "" {
+		if parsed, err := url.Parse(c.RedisURL); err != nil || (parsed.Scheme != "redis" && parsed.Scheme != "rediss") {
+			return fmt.Errorf("invalid REDIS_URL value: must be a redis:// or rediss:// URL")
+		}
+	}
+	
+	switch c.DatabaseDriver {
+	case "", "postgres", "mysql", "sqlite":
+	default:
+		return fmt.Errorf("invalid database driver: %s, must be 'postgres', 'mysql' or 'sqlite'", c.DatabaseDriver)
+	}
+	
+	if c.DatabaseQueryTimeout < 0 {
+		return fmt.Errorf("DB_QUERY_TIMEOUT must not be negative")
+	}
+	
+	if c.PaidGracePeriod < 0 {
+		return fmt.Errorf("PAID_GRACE_PERIOD must not be negative")
+	}
+	
+	if c.ReferralBonus < 0 {
+		return fmt.Errorf("REFERRAL_BONUS_BYTES must not be negative")
+	}
+	
+	if c.DataRetentionDays < 0 {
+		return fmt.Errorf("DATA_RETENTION_DAYS must not be negative")
+	}
+	
+	if err := c.validateWebhook(); err != nil {
+		return err
+	}
+	
+	if err := c.validateVPN(); err != nil {
+		return err
+	}
+	
+	if _, _, _, err := c.GetQuietHours(); err != nil {
+		return err
+	}
+	
+	// Validate plans
+	if _, err := domain.NewPlanCatalog(c.Plans); err != nil {
+		return fmt.Errorf("invalid plans: %w", err)
+	}
+	for _, plan := range c.Plans {
+		if !plan.PaidInStars() && c.PaymentProviderToken == "" {
+			return fmt.Errorf("PAYMENT_PROVIDER_TOKEN is required for plan %s priced in %s", plan.Name, plan.Currency)
+		}
 	}
 	
 	return nil
@@ -196,6 +537,121 @@ func (c *Config) GetServerAddr() string {
 	return fmt.Sprintf(":%d", c.Port)
 }
 
+// IsWebhookMode returns true if updates are delivered by webhook instead of long polling
+func (c *Config) IsWebhookMode() bool {
+	return c.WebhookURL != ""
+}
+
+// GetWebhookEndpoint returns the URL registered with Telegram: WebhookURL with the
+// secret appended as its last path segment
+func (c *Config) GetWebhookEndpoint() string {
+	if c.WebhookSecret == "" {
+		return c.WebhookURL
+	}
+	return strings.TrimRight(c.WebhookURL, "/") + "/" + c.WebhookSecret
+}
+
+// maxWebhookSecretLength is the longest secret token Telegram accepts
+const maxWebhookSecretLength = 256
+
+// validateWebhook checks the webhook URL and secret when webhook mode is enabled
+func (c *Config) validateWebhook() error {
+	if c.WebhookSecret != "" && c.WebhookURL == "" {
+		return fmt.Errorf("WEBHOOK_URL is required when WEBHOOK_SECRET is set")
+	}
+	if c.WebhookURL == "" {
+		return nil
+	}
+	
+	parsed, err := url.Parse(c.WebhookURL)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("invalid WEBHOOK_URL: %s, must be an absolute https URL", c.WebhookURL)
+	}
+	if parsed.RawQuery != "" || parsed.Fragment != "" {
+		return fmt.Errorf("invalid WEBHOOK_URL: %s, must not have a query or fragment", c.WebhookURL)
+	}
+	
+	if c.WebhookSecret == "" {
+		return fmt.Errorf("WEBHOOK_SECRET is required when WEBHOOK_URL is set")
+	}
+	if len(c.WebhookSecret) > maxWebhookSecretLength {
+		return fmt.Errorf("WEBHOOK_SECRET must be at most %d characters", maxWebhookSecretLength)
+	}
+	// Telegram restricts secret tokens to these characters, which are also safe in a path
+	for _, r := range c.WebhookSecret {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return fmt.Errorf("WEBHOOK_SECRET may only contain letters, digits, '_' and '-'")
+		}
+	}
+	return nil
+}
+
+// GetQuietHours returns the quiet hours as offsets from midnight in their timezone.
+// Start and end are equal when quiet hours are disabled
+func (c *Config) GetQuietHours() (start, end time.Duration, loc *time.Location, err error) {
+	if (c.QuietHoursStart == "") != (c.QuietHoursEnd == "") {
+		return 0, 0, nil, fmt.Errorf("QUIET_HOURS_START and QUIET_HOURS_END must be set together")
+	}
+	loc, err = time.LoadLocation(c.QuietHoursTimezone)
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("invalid QUIET_HOURS_TIMEZONE: %s", c.QuietHoursTimezone)
+	}
+	if c.QuietHoursStart == "" {
+		return 0, 0, loc, nil
+	}
+	
+	if start, err = parseClock(c.QuietHoursStart); err != nil {
+		return 0, 0, nil, fmt.Errorf("invalid QUIET_HOURS_START: %s, must be HH:MM", c.QuietHoursStart)
+	}
+	if end, err = parseClock(c.QuietHoursEnd); err != nil {
+		return 0, 0, nil, fmt.Errorf("invalid QUIET_HOURS_END: %s, must be HH:MM", c.QuietHoursEnd)
+	}
+	return start, end, loc, nil
+}
+
+// parseClock parses a HH:MM time of day as an offset from midnight
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// IsVPNEnabled returns true if VPN configs can be issued to users
+func (c *Config) IsVPNEnabled() bool {
+	return c.VPNServerEndpoint != ""
+}
+
+// validateVPN checks the VPN server settings when issuing VPN configs is enabled
+func (c *Config) validateVPN() error {
+	if !c.IsVPNEnabled() {
+		// Peers are matched by the keys of issued configs
+		if c.VPNWGInterface != "" {
+			return fmt.Errorf("VPN_WG_INTERFACE requires VPN_SERVER_ENDPOINT")
+		}
+		return nil
+	}
+	
+	if _, port, err := net.SplitHostPort(c.VPNServerEndpoint); err != nil || port == "" {
+		return fmt.Errorf("invalid VPN_SERVER_ENDPOINT: %s, must be host:port", c.VPNServerEndpoint)
+	}
+	if key, err := base64.StdEncoding.DecodeString(c.VPNServerPublicKey); err != nil || len(key) != 32 {
+		return fmt.Errorf("VPN_SERVER_PUBLIC_KEY must be a base64 WireGuard public key when VPN_SERVER_ENDPOINT is set")
+	}
+	if subnet, err := netip.ParsePrefix(c.VPNClientSubnet); err != nil || !subnet.Addr().Is4() || subnet.Bits() > 30 {
+		return fmt.Errorf("invalid VPN_CLIENT_SUBNET: %s, must be an IPv4 CIDR of /30 or larger", c.VPNClientSubnet)
+	}
+	if _, err := netip.ParseAddr(c.VPNDNS); err != nil {
+		return fmt.Errorf("invalid VPN_DNS: %s, must be an IP address", c.VPNDNS)
+	}
+	// Linux limits interface names to 15 bytes
+	if len(c.VPNWGInterface) > 15 || strings.ContainsAny(c.VPNWGInterface, " \t/") {
+		return fmt.Errorf("invalid VPN_WG_INTERFACE: %s, must be a network interface name", c.VPNWGInterface)
+	}
+	return nil
+}
+
 // Helper functions for environment variable parsing
 func getEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -213,6 +669,15 @@ func getEnvAsIntOrDefault(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsInt64OrDefault(key string, defaultValue int64) int64 {
+	if value := os.Getenv(key); value != "" {
+		if intVal, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return intVal
+		}
+	}
+	return defaultValue
+}
+
 func getEnvAsBoolOrDefault(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolVal, err := strconv.ParseBool(value); err == nil {
@@ -238,4 +703,76 @@ func getEnvAsFloatOrDefault(key string, defaultValue float64) float64 {
 		}
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+func getEnvAsInt64SliceOrDefault(key string, defaultValue []int64) ([]int64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	var result []int64
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		intVal, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, intVal)
+	}
+	return result, nil
+}
+
+func getEnvAsInt64MapOrDefault(key string, defaultValue map[string]int64) (map[string]int64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	var raw map[string]int64
+	if err := json.Unmarshal([]byte(value), &raw); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]int64, len(raw))
+	for k, v := range raw {
+		result[strings.ToLower(strings.TrimSpace(k))] = v
+	}
+	return result, nil
+}
+
+// ParsePlans parses a list of plans from JSON or YAML
+func ParsePlans(data []byte) ([]domain.Plan, error) {
+	var plans []domain.Plan
+	if err := yaml.Unmarshal(data, &plans); err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+// loadPlans reads plans from the inline PLANS value or, when empty, from PLANS_FILE
+func loadPlans(inline, path string) ([]domain.Plan, error) {
+	if inline != "" {
+		plans, err := ParsePlans([]byte(inline))
+		if err != nil {
+			return nil, fmt.Errorf("invalid PLANS: %w", err)
+		}
+		return plans, nil
+	}
+	if path == "" {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PLANS_FILE: %w", err)
+	}
+	plans, err := ParsePlans(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PLANS_FILE: %w", err)
+	}
+	return plans, nil
+}
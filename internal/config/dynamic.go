@@ -0,0 +1,261 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+)
+
+// Keys of settings that can be changed at runtime
+const (
+	SettingMaintenanceMode = "maintenance_mode"
+	SettingTrialQuotaBytes = "trial_quota_bytes"
+	// SettingLogLevel overrides LOG_LEVEL
+	SettingLogLevel = "log_level"
+)
+
+// DefaultSettingsRefreshInterval is how often cached settings are reloaded by default
+const DefaultSettingsRefreshInterval = 30 * time.Second
+
+// DynamicConfig overlays runtime settings stored in the database on top of the
+// environment configuration. Settings are cached and refreshed periodically so
+// reads never hit the database
+type DynamicConfig struct {
+	base     *Config
+	repo     domain.SettingsRepository
+	interval time.Duration
+
+	mu     sync.RWMutex
+	values map[string]string
+	// onChange, when set, is called with the settings changed by a reload or Set
+	onChange func([]domain.SettingChange)
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewDynamicConfig creates a dynamic config backed by the given settings repository
+func NewDynamicConfig(base *Config, repo domain.SettingsRepository, interval time.Duration) *DynamicConfig {
+	if interval <= 0 {
+		interval = DefaultSettingsRefreshInterval
+	}
+	return &DynamicConfig{
+		base:     base,
+		repo:     repo,
+		interval: interval,
+		values:   make(map[string]string),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// ValidateSetting checks that a key is known and its value has the right type
+func ValidateSetting(key, value string) error {
+	switch {
+	case key == SettingMaintenanceMode:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return domain.ValidationError{Field: key, Message: "must be a boolean"}
+		}
+	case key == SettingLogLevel:
+		if !validLogLevels[value] {
+			return domain.ValidationError{Field: key, Message: "must be a log level such as info or debug"}
+		}
+	case key == SettingTrialQuotaBytes:
+		quota, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || quota <= 0 {
+			return domain.ValidationError{Field: key, Message: "must be a positive integer"}
+		}
+	default:
+		return domain.ValidationError{Field: key, Message: "unknown setting"}
+	}
+	return nil
+}
+
+// SetChangeListener configures a function called with the settings changed by a reload
+// or Set, e.g. to apply a new log level
+func (d *DynamicConfig) SetChangeListener(onChange func([]domain.SettingChange)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onChange = onChange
+}
+
+// Refresh reloads all settings from the repository into the cache
+func (d *DynamicConfig) Refresh(ctx context.Context) error {
+	_, err := d.Reload(ctx)
+	return err
+}
+
+// Reload reloads all settings from the repository into the cache and returns the
+// settings that changed, sorted by key
+func (d *DynamicConfig) Reload(ctx context.Context) ([]domain.SettingChange, error) {
+	values, err := d.repo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh settings: %w", err)
+	}
+
+	d.mu.Lock()
+	changes := diffSettings(d.values, values)
+	d.values = values
+	onChange := d.onChange
+	d.mu.Unlock()
+
+	if len(changes) > 0 && onChange != nil {
+		onChange(changes)
+	}
+	return changes, nil
+}
+
+// diffSettings returns the settings whose value differs between before and after, sorted by key
+func diffSettings(before, after map[string]string) []domain.SettingChange {
+	var changes []domain.SettingChange
+	for key, value := range after {
+		if previous, ok := before[key]; !ok || previous != value {
+			changes = append(changes, domain.SettingChange{Key: key, Old: previous, New: value})
+		}
+	}
+	for key, value := range before {
+		if _, ok := after[key]; !ok {
+			changes = append(changes, domain.SettingChange{Key: key, Old: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// Start loads the settings and keeps refreshing them in the background until Stop is called.
+// The background refresh runs even if the initial load fails; failed refreshes keep the
+// previously cached values and are passed to onError
+func (d *DynamicConfig) Start(ctx context.Context, onError func(error)) error {
+	err := d.Refresh(ctx)
+
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := d.Refresh(context.Background()); err != nil && onError != nil {
+					onError(err)
+				}
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+	return err
+}
+
+// Stop stops the background refresh started by Start
+func (d *DynamicConfig) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.stop)
+	})
+}
+
+// Set validates and stores a setting, updating the cache immediately
+func (d *DynamicConfig) Set(ctx context.Context, key, value string) error {
+	key = strings.ToLower(strings.TrimSpace(key))
+	value = strings.TrimSpace(value)
+	if err := ValidateSetting(key, value); err != nil {
+		return err
+	}
+	if err := d.repo.Set(ctx, key, value); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	previous, ok := d.values[key]
+	d.values[key] = value
+	onChange := d.onChange
+	d.mu.Unlock()
+
+	if (!ok || previous != value) && onChange != nil {
+		onChange([]domain.SettingChange{{Key: key, Old: previous, New: value}})
+	}
+	return nil
+}
+
+// Values returns a copy of the cached settings
+func (d *DynamicConfig) Values() map[string]string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	values := make(map[string]string, len(d.values))
+	for key, value := range d.values {
+		values[key] = value
+	}
+	return values
+}
+
+// Keys returns the cached setting names in sorted order
+func (d *DynamicConfig) Keys() []string {
+	values := d.Values()
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MaintenanceMode reports whether the bot is in maintenance mode
+func (d *DynamicConfig) MaintenanceMode() bool {
+	return d.boolValue(SettingMaintenanceMode, false)
+}
+
+// TrialQuotaLimit returns the trial quota, falling back to the environment configuration
+func (d *DynamicConfig) TrialQuotaLimit() int64 {
+	d.mu.RLock()
+	value, ok := d.values[SettingTrialQuotaBytes]
+	d.mu.RUnlock()
+
+	if ok {
+		if quota, err := strconv.ParseInt(value, 10, 64); err == nil && quota > 0 {
+			return quota
+		}
+	}
+	if d.base != nil && d.base.TrialQuotaLimit > 0 {
+		return d.base.TrialQuotaLimit
+	}
+	return domain.DefaultQuotaLimit
+}
+
+// LogLevel returns the log level, falling back to the environment configuration
+func (d *DynamicConfig) LogLevel() string {
+	d.mu.RLock()
+	value, ok := d.values[SettingLogLevel]
+	d.mu.RUnlock()
+
+	if ok && validLogLevels[value] {
+		return value
+	}
+	if d.base != nil && d.base.LogLevel != "" {
+		return d.base.LogLevel
+	}
+	return "info"
+}
+
+// boolValue reads a cached boolean setting, returning defaultValue when unset or invalid
+func (d *DynamicConfig) boolValue(key string, defaultValue bool) bool {
+	d.mu.RLock()
+	value, ok := d.values[key]
+	d.mu.RUnlock()
+
+	if !ok {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return defaultValue
+	}
+	return parsed
+}
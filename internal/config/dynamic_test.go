@@ -0,0 +1,191 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSettingsRepository is an in-memory domain.SettingsRepository for tests
+type fakeSettingsRepository struct {
+	mu     sync.Mutex
+	values map[string]string
+	err    error
+}
+
+func newFakeSettingsRepository() *fakeSettingsRepository {
+	return &fakeSettingsRepository{values: make(map[string]string)}
+}
+
+func (r *fakeSettingsRepository) Get(ctx context.Context, key string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	value, ok := r.values[key]
+	if !ok {
+		return "", domain.SettingNotFoundError{Key: key}
+	}
+	return value, nil
+}
+
+func (r *fakeSettingsRepository) Set(ctx context.Context, key, value string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values[key] = value
+	return nil
+}
+
+func (r *fakeSettingsRepository) GetBool(ctx context.Context, key string) (bool, error) {
+	return false, errors.New("not implemented")
+}
+
+func (r *fakeSettingsRepository) SetBool(ctx context.Context, key string, value bool) error {
+	return errors.New("not implemented")
+}
+
+func (r *fakeSettingsRepository) GetInt64(ctx context.Context, key string) (int64, error) {
+	return 0, errors.New("not implemented")
+}
+
+func (r *fakeSettingsRepository) SetInt64(ctx context.Context, key string, value int64) error {
+	return errors.New("not implemented")
+}
+
+func (r *fakeSettingsRepository) List(ctx context.Context) (map[string]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+	values := make(map[string]string, len(r.values))
+	for key, value := range r.values {
+		values[key] = value
+	}
+	return values, nil
+}
+
+func TestDynamicConfig_OverlaysEnvConfig(t *testing.T) {
+	repo := newFakeSettingsRepository()
+	dc := NewDynamicConfig(&Config{TrialQuotaLimit: 1024}, repo, time.Minute)
+
+	assert.False(t, dc.MaintenanceMode())
+	assert.Equal(t, int64(1024), dc.TrialQuotaLimit())
+
+	ctx := context.Background()
+	require.NoError(t, dc.Set(ctx, SettingMaintenanceMode, "true"))
+	require.NoError(t, dc.Set(ctx, SettingTrialQuotaBytes, "2048"))
+
+	assert.True(t, dc.MaintenanceMode())
+	assert.Equal(t, int64(2048), dc.TrialQuotaLimit())
+	assert.Equal(t, "2048", repo.values[SettingTrialQuotaBytes])
+	assert.Equal(t, []string{SettingMaintenanceMode, SettingTrialQuotaBytes}, dc.Keys())
+}
+
+func TestDynamicConfig_SetRejectsInvalidSettings(t *testing.T) {
+	repo := newFakeSettingsRepository()
+	dc := NewDynamicConfig(&Config{}, repo, time.Minute)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, dc.Set(ctx, "unknown", "1"), domain.ErrInvalidInput)
+	assert.Error(t, dc.Set(ctx, "feature.referrals", "true"))
+	assert.Error(t, dc.Set(ctx, SettingMaintenanceMode, "maybe"))
+	assert.Error(t, dc.Set(ctx, SettingTrialQuotaBytes, "-5"))
+	assert.Error(t, dc.Set(ctx, SettingLogLevel, "loud"))
+	assert.Empty(t, repo.values)
+	assert.Equal(t, int64(domain.DefaultQuotaLimit), dc.TrialQuotaLimit())
+}
+
+func TestDynamicConfig_Refresh(t *testing.T) {
+	repo := newFakeSettingsRepository()
+	dc := NewDynamicConfig(&Config{}, repo, time.Minute)
+	ctx := context.Background()
+
+	// Changes made by another instance are only visible after a refresh
+	repo.values[SettingMaintenanceMode] = "true"
+	assert.False(t, dc.MaintenanceMode())
+	require.NoError(t, dc.Refresh(ctx))
+	assert.True(t, dc.MaintenanceMode())
+
+	// A failed refresh keeps the cached values
+	repo.err = errors.New("database unavailable")
+	assert.Error(t, dc.Refresh(ctx))
+	assert.True(t, dc.MaintenanceMode())
+}
+
+func TestDynamicConfig_Reload(t *testing.T) {
+	repo := newFakeSettingsRepository()
+	repo.values[SettingLogLevel] = "info"
+	repo.values[SettingTrialQuotaBytes] = "2048"
+	dc := NewDynamicConfig(&Config{LogLevel: "warn"}, repo, time.Minute)
+	ctx := context.Background()
+
+	var notified []domain.SettingChange
+	dc.SetChangeListener(func(changes []domain.SettingChange) {
+		notified = append(notified, changes...)
+	})
+	_, err := dc.Reload(ctx)
+	require.NoError(t, err)
+	notified = nil
+
+	repo.values[SettingLogLevel] = "debug"
+	delete(repo.values, SettingTrialQuotaBytes)
+	repo.values[SettingMaintenanceMode] = "true"
+
+	changes, err := dc.Reload(ctx)
+
+	require.NoError(t, err)
+	expected := []domain.SettingChange{
+		{Key: SettingLogLevel, Old: "info", New: "debug"},
+		{Key: SettingMaintenanceMode, New: "true"},
+		{Key: SettingTrialQuotaBytes, Old: "2048"},
+	}
+	assert.Equal(t, expected, changes)
+	assert.Equal(t, expected, notified)
+	assert.Equal(t, "debug", dc.LogLevel())
+
+	// Reloading unchanged settings reports nothing
+	notified = nil
+	changes, err = dc.Reload(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+	assert.Empty(t, notified)
+
+	// Without the setting the environment log level applies
+	delete(repo.values, SettingLogLevel)
+	_, err = dc.Reload(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "warn", dc.LogLevel())
+}
+
+func TestDynamicConfig_SetNotifiesChanges(t *testing.T) {
+	dc := NewDynamicConfig(&Config{}, newFakeSettingsRepository(), time.Minute)
+	ctx := context.Background()
+
+	var notified []domain.SettingChange
+	dc.SetChangeListener(func(changes []domain.SettingChange) {
+		notified = append(notified, changes...)
+	})
+
+	require.NoError(t, dc.Set(ctx, SettingLogLevel, "debug"))
+	require.NoError(t, dc.Set(ctx, SettingLogLevel, "debug"))
+
+	assert.Equal(t, []domain.SettingChange{{Key: SettingLogLevel, New: "debug"}}, notified)
+}
+
+func TestDynamicConfig_StartRefreshesPeriodically(t *testing.T) {
+	repo := newFakeSettingsRepository()
+	repo.values[SettingTrialQuotaBytes] = "4096"
+	dc := NewDynamicConfig(&Config{}, repo, 10*time.Millisecond)
+
+	require.NoError(t, dc.Start(context.Background(), nil))
+	defer dc.Stop()
+	assert.Equal(t, int64(4096), dc.TrialQuotaLimit())
+
+	require.NoError(t, repo.Set(context.Background(), SettingMaintenanceMode, "true"))
+	assert.Eventually(t, dc.MaintenanceMode, time.Second, 5*time.Millisecond)
+}
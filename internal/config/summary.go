@@ -0,0 +1,170 @@
+package config
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+)
+
+// redacted replaces secret values in the config summary
+const redacted = "[REDACTED]"
+
+// dsnPasswordPattern matches the password of a key=value database connection string
+var dsnPasswordPattern = regexp.MustCompile(`(?i)(password=)\S+`)
+
+// SummaryRedacted returns the effective configuration as NAME=value lines, named after
+// the environment variables that set them. Secrets are replaced by [REDACTED] and
+// credentials in URLs are masked, so the summary is safe to show to admins
+func (c *Config) SummaryRedacted() string {
+	entries := []struct {
+		name  string
+		value string
+	}{
+		{"TELEGRAM_BOT_TOKEN", secret(c.TelegramToken)},
+		{"ENVIRONMENT", c.Environment},
+		{"BUILD_VERSION", c.Version},
+		{"DEBUG", strconv.FormatBool(c.Debug)},
+		{"LOG_LEVEL", c.LogLevel},
+		{"LOG_FORMAT", c.LogFormat},
+		{"PORT", strconv.Itoa(c.Port)},
+		{"TIMEOUT", c.Timeout.String()},
+		{"WEBHOOK_URL", c.WebhookURL},
+		{"WEBHOOK_SECRET", secret(c.WebhookSecret)},
+		{"TELEGRAM_SEND_MAX_ATTEMPTS", strconv.Itoa(c.TelegramSendMaxAttempts)},
+		{"TELEGRAM_SEND_RETRY_DELAY", c.TelegramSendRetryDelay.String()},
+		{"NOTIFICATION_RATE", formatFloat(c.NotificationRate)},
+		{"QUIET_HOURS_START", c.QuietHoursStart},
+		{"QUIET_HOURS_END", c.QuietHoursEnd},
+		{"QUIET_HOURS_TIMEZONE", c.QuietHoursTimezone},
+		{"DATABASE_DRIVER", c.DatabaseDriver},
+		{"DATABASE_URL", redactDatabaseURL(c.DatabaseURL)},
+		{"DB_MAX_CONNS", strconv.Itoa(c.DatabaseMaxConns)},
+		{"DB_MAX_IDLE_CONNS", strconv.Itoa(c.DatabaseMaxIdleConns)},
+		{"DB_CONN_MAX_LIFETIME", c.DatabaseConnMaxLifetime.String()},
+		{"DB_QUERY_TIMEOUT", c.DatabaseQueryTimeout.String()},
+		{"MIGRATE_ON_START", strconv.FormatBool(c.MigrateOnStart)},
+		{"KAFKA_ENABLED", strconv.FormatBool(c.KafkaEnabled)},
+		{"KAFKA_BROKERS", c.KafkaBrokers},
+		{"KAFKA_TOPIC", c.KafkaTopic},
+		{"KAFKA_SECURITY_PROTOCOL", c.KafkaSecurityProtocol},
+		{"KAFKA_SASL_MECHANISM", c.KafkaSaslMechanism},
+		{"KAFKA_SASL_USERNAME", c.KafkaSaslUsername},
+		{"KAFKA_SASL_PASSWORD", secret(c.KafkaSaslPassword)},
+		{"KAFKA_ENABLE_IDEMPOTENCE", strconv.FormatBool(c.KafkaEnableIdempotence)},
+		{"KAFKA_ACKS", c.KafkaAcks},
+		{"KAFKA_RETRY_BACKOFF_MS", strconv.Itoa(c.KafkaRetryBackoffMs)},
+		{"KAFKA_REQUEST_TIMEOUT_MS", strconv.Itoa(c.KafkaRequestTimeoutMs)},
+		{"KAFKA_CONSUMER_ENABLED", strconv.FormatBool(c.KafkaConsumerEnabled)},
+		{"KAFKA_CONSUMER_GROUP", c.KafkaConsumerGroup},
+		{"KAFKA_DLQ_TOPIC", c.KafkaDLQTopic},
+		{"KAFKA_DLQ_FILE", c.KafkaDLQFile},
+		{"KAFKA_SYNC_DELIVERY", strconv.FormatBool(c.KafkaSyncDelivery)},
+		{"EVENTS_ENABLED", strconv.FormatBool(c.EventsEnabled)},
+		{"EVENT_BACKEND", c.EventBackend},
+		{"NATS_URL", redactDatabaseURL(c.NatsURL)},
+		{"NATS_SUBJECT", c.NatsSubject},
+		{"EVENT_KEY_CASING", c.EventKeyCasing},
+		{"EVENT_BATCH_SIZE", strconv.Itoa(c.EventBatchSize)},
+		{"EVENT_BATCH_INTERVAL", c.EventBatchInterval.String()},
+		{"SENTRY_DSN", secret(c.SentryDSN)},
+		{"SENTRY_ENVIRONMENT", c.SentryEnvironment},
+		{"SENTRY_RELEASE", c.SentryRelease},
+		{"SENTRY_SAMPLE_RATE", formatFloat(c.SentrySampleRate)},
+		{"SENTRY_ENABLE_TRACING", strconv.FormatBool(c.SentryEnableTracing)},
+		{"SENTRY_TRACES_SAMPLE_RATE", formatFloat(c.SentryTracesSampleRate)},
+		{"VPN_SERVER_ENDPOINT", c.VPNServerEndpoint},
+		{"VPN_SERVER_PUBLIC_KEY", c.VPNServerPublicKey},
+		{"VPN_CLIENT_SUBNET", c.VPNClientSubnet},
+		{"VPN_DNS", c.VPNDNS},
+		{"VPN_WG_INTERFACE", c.VPNWGInterface},
+		{"ADMIN_TELEGRAM_IDS", formatIDs(c.AdminTelegramIDs)},
+		{"ADMIN_CHAT_ID", strconv.FormatInt(c.AdminChatID, 10)},
+		{"ANONYMIZE_USERNAMES", strconv.FormatBool(c.AnonymizeUsernames)},
+		{"RATE_LIMIT_MAX_REQUESTS", strconv.Itoa(c.RateLimitMaxRequests)},
+		{"RATE_LIMIT_WINDOW", c.RateLimitWindow.String()},
+		{"RATE_LIMIT_BLOCK_DURATION", c.RateLimitBlockDuration.String()},
+		{"RATE_LIMIT_ACTIONS", formatQuotas(c.RateLimitActions)},
+		{"REDIS_URL", redactDatabaseURL(c.RedisURL)},
+		{"SESSION_TTL", c.SessionTTL.String()},
+		{"ABUSE_BAN_THRESHOLD", strconv.Itoa(c.AbuseBanThreshold)},
+		{"ABUSE_BAN_WINDOW", c.AbuseBanWindow.String()},
+		{"SUPPORT_CONTACT", c.SupportContact},
+		{"HELP_TEMPLATE_PATH", c.HelpTemplatePath},
+		{"EDITED_MESSAGE_HINT", c.EditedMessageHint},
+		{"TRIAL_QUOTA_BYTES", strconv.FormatInt(c.TrialQuotaLimit, 10)},
+		{"TRIAL_DURATION", c.TrialDuration.String()},
+		{"TRIAL_QUOTA_REGIONS", formatQuotas(c.TrialQuotaRegions)},
+		{"REFERRAL_BONUS_BYTES", strconv.FormatInt(c.ReferralBonus, 10)},
+		{"PLANS", formatPlanNames(c.Plans)},
+		{"PAYMENT_PROVIDER_TOKEN", secret(c.PaymentProviderToken)},
+		{"PLAN_EXPIRY_CHECK_INTERVAL", c.PlanExpiryCheckInterval.String()},
+		{"PAID_GRACE_PERIOD", c.PaidGracePeriod.String()},
+		{"DATA_RETENTION_DAYS", strconv.Itoa(c.DataRetentionDays)},
+		{"SETTINGS_REFRESH_INTERVAL", c.SettingsRefreshInterval.String()},
+		{"STARTUP_SELFTEST", strconv.FormatBool(c.StartupSelfTest)},
+		{"SELFTEST_TOPIC", c.SelfTestTopic},
+		{"PROCESS_LOCK_PATH", c.ProcessLockPath},
+	}
+
+	var b strings.Builder
+	for _, entry := range entries {
+		b.WriteString(entry.name)
+		b.WriteString("=")
+		b.WriteString(entry.value)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// secret returns [REDACTED] for a set secret, keeping unset secrets visibly empty
+func secret(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redacted
+}
+
+// redactDatabaseURL masks the password of a database URL or key=value connection string
+func redactDatabaseURL(databaseURL string) string {
+	if u, err := url.Parse(databaseURL); err == nil && u.Scheme != "" && u.User != nil {
+		return u.Redacted()
+	}
+	return dsnPasswordPattern.ReplaceAllString(databaseURL, "${1}"+redacted)
+}
+
+// formatFloat formats f without trailing zeros
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// formatIDs joins Telegram IDs with commas
+func formatIDs(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+// formatQuotas formats per-region quotas as sorted region=bytes pairs
+func formatQuotas(quotas map[string]int64) string {
+	parts := make([]string, 0, len(quotas))
+	for region, quota := range quotas {
+		parts = append(parts, region+"="+strconv.FormatInt(quota, 10))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// formatPlanNames lists the names of the configured plans
+func formatPlanNames(plans []domain.Plan) string {
+	names := make([]string, len(plans))
+	for i, plan := range plans {
+		names[i] = plan.Name
+	}
+	return strings.Join(names, ",")
+}
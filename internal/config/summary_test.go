@@ -0,0 +1,73 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_SummaryRedacted(t *testing.T) {
+	config := &Config{
+		TelegramToken:        "123456:telegram-token",
+		DatabaseURL:          "postgres://bot:db-password@db:5432/arcanus?sslmode=disable",
+		KafkaSaslUsername:    "events",
+		KafkaSaslPassword:    "kafka-password",
+		SentryDSN:            "https://sentry-key@o0.ingest.sentry.io/1",
+		WebhookURL:           "https://bot.example.com/hook",
+		WebhookSecret:        "webhook-secret",
+		PaymentProviderToken: "provider-token",
+		Environment:          "production",
+		Port:                 8080,
+		RateLimitWindow:      time.Minute,
+		AdminTelegramIDs:     []int64{1, 2},
+		TrialQuotaRegions:    map[string]int64{"ru": 100, "de": 200},
+		Plans:                []domain.Plan{{Name: "Basic"}, {Name: "Pro"}},
+	}
+
+	summary := config.SummaryRedacted()
+
+	for _, line := range []string{
+		"ENVIRONMENT=production\n",
+		"PORT=8080\n",
+		"RATE_LIMIT_WINDOW=1m0s\n",
+		"WEBHOOK_URL=https://bot.example.com/hook\n",
+		"KAFKA_SASL_USERNAME=events\n",
+		"ADMIN_TELEGRAM_IDS=1,2\n",
+		"TRIAL_QUOTA_REGIONS=de=200,ru=100\n",
+		"PLANS=Basic,Pro\n",
+		"TELEGRAM_BOT_TOKEN=[REDACTED]\n",
+		"WEBHOOK_SECRET=[REDACTED]\n",
+		"KAFKA_SASL_PASSWORD=[REDACTED]\n",
+		"SENTRY_DSN=[REDACTED]\n",
+		"PAYMENT_PROVIDER_TOKEN=[REDACTED]\n",
+		"DATABASE_URL=postgres://bot:xxxxx@db:5432/arcanus?sslmode=disable\n",
+		"QUIET_HOURS_START=\n",
+	} {
+		assert.Contains(t, summary, line)
+	}
+	for _, secret := range []string{"telegram-token", "db-password", "kafka-password", "sentry-key", "webhook-secret", "provider-token"} {
+		assert.NotContains(t, summary, secret)
+	}
+}
+
+func TestRedactDatabaseURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{"URL with password", "postgres://bot:secret@db/arcanus", "postgres://bot:xxxxx@db/arcanus"},
+		{"URL without password", "postgres://bot@db/arcanus", "postgres://bot@db/arcanus"},
+		{"key=value string", "host=db user=bot password=secret dbname=arcanus", "host=db user=bot password=[REDACTED] dbname=arcanus"},
+		{"SQLite path", "file:arcanus.db?cache=shared", "file:arcanus.db?cache=shared"},
+		{"unset", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, redactDatabaseURL(tt.url))
+		})
+	}
+}
@@ -0,0 +1,9 @@
+package domain
+
+import "time"
+
+// CommandRecord represents a single command issued by a user
+type CommandRecord struct {
+	Command  string    `json:"command"`
+	IssuedAt time.Time `json:"issued_at"`
+}
@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// AuditLog represents a security audit event. IP and UserAgent stay empty for events
+// from Telegram, since updates are relayed by Telegram's servers and the Bot API
+// exposes neither the client's address nor its app
+type AuditLog struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    int64     `json:"user_id" gorm:"index;not null"`
+	Username  string    `json:"username" gorm:"size:255"`
+	Action    string    `json:"action" gorm:"size:128;index;not null"`
+	Timestamp time.Time `json:"timestamp" gorm:"index"`
+	IP        string    `json:"ip,omitempty" gorm:"size:64"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error,omitempty" gorm:"size:1024"`
+	Details   string    `json:"details,omitempty" gorm:"type:text"`
+	SessionID string    `json:"session_id,omitempty" gorm:"size:64"`
+	UserAgent string    `json:"user_agent,omitempty" gorm:"size:255"`
+}
+
+// AuditSink stores audit events in addition to the audit log output
+type AuditSink interface {
+	WriteAudit(ctx context.Context, audit *AuditLog) error
+}
+
+// AuditLogRepository is an audit sink whose events can be queried back
+type AuditLogRepository interface {
+	AuditSink
+	// ListAuditByUser returns up to limit of the user's most recent audit events, newest first
+	ListAuditByUser(ctx context.Context, userID int64, limit int) ([]*AuditLog, error)
+}
@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// BugReport is a user-submitted bug report with diagnostic context captured by the bot
+type BugReport struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	TelegramID  int64     `json:"telegram_id" gorm:"index;not null"`
+	Username    string    `json:"username" gorm:"size:255"`
+	Description string    `json:"description" gorm:"size:2048;not null"`
+	LastCommand string    `json:"last_command" gorm:"size:256"`
+	AppVersion  string    `json:"app_version" gorm:"size:64"`
+	LastError   string    `json:"last_error" gorm:"size:1024"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -8,11 +8,25 @@ import (
 // Domain errors
 var (
 	ErrUserNotFound      = errors.New("user not found")
+	ErrAmbiguousUsername = errors.New("username matches more than one user")
 	ErrUserAlreadyExists = errors.New("user already exists")
 	ErrUserNotActive     = errors.New("user is not active")
 	ErrUserAlreadyActive = errors.New("user is already active")
+	ErrUserBanned        = errors.New("user is banned")
+	ErrUserUnreachable   = errors.New("user chat not found")
+	ErrUserBlockedBot    = errors.New("user blocked the bot")
 	ErrQuotaExceeded     = errors.New("quota usage exceeds limit")
 	ErrInvalidInput      = errors.New("invalid input")
+	ErrSettingNotFound   = errors.New("setting not found")
+	ErrPlanNotFound      = errors.New("plan not found")
+	ErrPeerNotFound      = errors.New("peer not found")
+
+	ErrPaymentAlreadyProcessed = errors.New("payment already processed")
+	ErrPaymentMismatch         = errors.New("payment does not match the plan price")
+
+	// Database failures worth retrying, wrapped by DatabaseError
+	ErrDeadlock            = errors.New("database deadlock")
+	ErrDatabaseUnavailable = errors.New("database unavailable")
 
 	ErrDatabaseError     = errors.New("database error")
 	ErrRateLimitExceeded = errors.New("rate limit exceeded")
@@ -23,10 +37,18 @@ var (
 
 // UserNotFoundError represents when a user is not found
 type UserNotFoundError struct {
-	TelegramID int64
+	TelegramID   int64
+	Username     string // set instead of TelegramID for lookups by username
+	ReferralCode string // set instead of TelegramID for lookups by referral code
 }
 
 func (e UserNotFoundError) Error() string {
+	if e.Username != "" {
+		return fmt.Sprintf("user not found with username %s", e.Username)
+	}
+	if e.ReferralCode != "" {
+		return fmt.Sprintf("user not found with referral code %s", e.ReferralCode)
+	}
 	return fmt.Sprintf("user not found with telegram_id %d", e.TelegramID)
 }
 
@@ -47,6 +69,19 @@ func (e UserAlreadyExistsError) Is(target error) bool {
 	return target == ErrUserAlreadyExists
 }
 
+// SettingNotFoundError represents when a setting has not been stored
+type SettingNotFoundError struct {
+	Key string
+}
+
+func (e SettingNotFoundError) Error() string {
+	return fmt.Sprintf("setting not found with key %s", e.Key)
+}
+
+func (e SettingNotFoundError) Is(target error) bool {
+	return target == ErrSettingNotFound
+}
+
 // QuotaExceededError represents when quota usage exceeds limit
 type QuotaExceededError struct {
 	Used  int64
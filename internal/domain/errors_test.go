@@ -13,6 +13,10 @@ func TestUserNotFoundError(t *testing.T) {
 
 	assert.Equal(t, "user not found with telegram_id 123", err.Error())
 	assert.True(t, errors.Is(err, ErrUserNotFound))
+
+	err = UserNotFoundError{Username: "alice"}
+	assert.Equal(t, "user not found with username alice", err.Error())
+	assert.True(t, errors.Is(err, ErrUserNotFound))
 }
 
 func TestUserAlreadyExistsError(t *testing.T) {
@@ -23,6 +27,13 @@ func TestUserAlreadyExistsError(t *testing.T) {
 	assert.True(t, errors.Is(err, ErrUserAlreadyExists))
 }
 
+func TestSettingNotFoundError(t *testing.T) {
+	err := SettingNotFoundError{Key: "maintenance_mode"}
+
+	assert.Equal(t, "setting not found with key maintenance_mode", err.Error())
+	assert.True(t, errors.Is(err, ErrSettingNotFound))
+}
+
 func TestQuotaExceededError(t *testing.T) {
 	used := int64(1500)
 	limit := int64(1000)
@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// PeerStatus describes a user's VPN peer as reported by the gateway
+type PeerStatus struct {
+	// LastHandshake is nil when the peer never completed a handshake
+	LastHandshake *time.Time
+	BytesReceived int64
+	BytesSent     int64
+}
+
+// HasHandshaked reports whether the peer ever connected to the gateway
+func (s *PeerStatus) HasHandshaked() bool {
+	return s != nil && s.LastHandshake != nil && !s.LastHandshake.IsZero()
+}
+
+// Gateway exposes the state of the VPN gateway the users connect to
+type Gateway interface {
+	// PeerStatus returns the status of the user's peer, or ErrPeerNotFound when the
+	// user has no peer on the gateway
+	PeerStatus(ctx context.Context, telegramID int64) (*PeerStatus, error)
+}
@@ -0,0 +1,16 @@
+package domain
+
+import "time"
+
+// Payment is a processed Telegram payment. ProviderChargeID is unique so every
+// charge is applied at most once
+type Payment struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	TelegramID       int64     `json:"telegram_id" gorm:"index;not null"`
+	PlanName         string    `json:"plan_name" gorm:"size:255;not null"`
+	TotalAmount      int       `json:"total_amount"` // in the smallest units of the currency
+	Currency         string    `json:"currency" gorm:"size:16"`
+	ProviderChargeID string    `json:"provider_charge_id" gorm:"size:255;uniqueIndex;not null"`
+	TelegramChargeID string    `json:"telegram_charge_id" gorm:"size:255"`
+	CreatedAt        time.Time `json:"created_at"`
+}
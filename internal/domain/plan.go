@@ -0,0 +1,129 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// TelegramStarsCurrency is the currency of plans paid in Telegram Stars, which need
+// no payment provider
+const TelegramStarsCurrency = "XTR"
+
+// zeroDecimalCurrencies are the currencies Telegram prices in whole units
+var zeroDecimalCurrencies = map[string]bool{
+	TelegramStarsCurrency: true,
+	"CLP":                 true,
+	"ISK":                 true,
+	"JPY":                 true,
+	"KRW":                 true,
+	"PYG":                 true,
+	"UGX":                 true,
+	"VND":                 true,
+}
+
+// Plan is a subscription plan users can choose when upgrading
+type Plan struct {
+	Name              string  `json:"name" yaml:"name"`
+	QuotaLimit        int64   `json:"quota_bytes" yaml:"quota_bytes"`
+	Price             float64 `json:"price" yaml:"price"`
+	Currency          string  `json:"currency" yaml:"currency"`
+	BillingPeriodDays int     `json:"billing_period_days" yaml:"billing_period_days"` // 0 means a one-off purchase
+	TrialEligible     bool    `json:"trial_eligible" yaml:"trial_eligible"`
+}
+
+// BillingPeriod returns how long a payment for the plan lasts; 0 means it never expires
+func (p Plan) BillingPeriod() time.Duration {
+	return time.Duration(p.BillingPeriodDays) * 24 * time.Hour
+}
+
+// InvoiceAmount returns the price in the smallest units of the currency, as Telegram
+// expects it in invoices and reports it in payments
+func (p Plan) InvoiceAmount() int {
+	if zeroDecimalCurrencies[strings.ToUpper(p.Currency)] {
+		return int(math.Round(p.Price))
+	}
+	return int(math.Round(p.Price * 100))
+}
+
+// PaidInStars reports whether the plan is priced in Telegram Stars
+func (p Plan) PaidInStars() bool {
+	return strings.EqualFold(p.Currency, TelegramStarsCurrency)
+}
+
+// Validate checks that the plan can be offered to users
+func (p Plan) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("%w: plan name must not be empty", ErrInvalidInput)
+	}
+	if p.QuotaLimit <= 0 {
+		return fmt.Errorf("%w: plan %s quota must be positive", ErrInvalidInput, p.Name)
+	}
+	if p.Price <= 0 {
+		return fmt.Errorf("%w: plan %s price must be positive", ErrInvalidInput, p.Name)
+	}
+	if strings.TrimSpace(p.Currency) == "" {
+		return fmt.Errorf("%w: plan %s currency must not be empty", ErrInvalidInput, p.Name)
+	}
+	if p.BillingPeriodDays < 0 {
+		return fmt.Errorf("%w: plan %s billing period must not be negative", ErrInvalidInput, p.Name)
+	}
+	return nil
+}
+
+// PlanCatalog is the set of configured plans shared by every plan-aware feature
+type PlanCatalog struct {
+	plans  []Plan
+	byName map[string]Plan
+}
+
+// NewPlanCatalog validates the plans and creates a catalog keeping their order.
+// Plan names are unique regardless of case
+func NewPlanCatalog(plans []Plan) (*PlanCatalog, error) {
+	catalog := &PlanCatalog{
+		plans:  make([]Plan, 0, len(plans)),
+		byName: make(map[string]Plan, len(plans)),
+	}
+	for _, plan := range plans {
+		if err := plan.Validate(); err != nil {
+			return nil, err
+		}
+		key := planKey(plan.Name)
+		if _, exists := catalog.byName[key]; exists {
+			return nil, fmt.Errorf("%w: duplicate plan name %s", ErrInvalidInput, plan.Name)
+		}
+		catalog.plans = append(catalog.plans, plan)
+		catalog.byName[key] = plan
+	}
+	return catalog, nil
+}
+
+// Plans returns the plans in display order
+func (c *PlanCatalog) Plans() []Plan {
+	if c == nil {
+		return nil
+	}
+	return append([]Plan(nil), c.plans...)
+}
+
+// Get looks a plan up by name, ignoring case
+func (c *PlanCatalog) Get(name string) (Plan, bool) {
+	if c == nil {
+		return Plan{}, false
+	}
+	plan, ok := c.byName[planKey(name)]
+	return plan, ok
+}
+
+// Len returns the number of plans in the catalog
+func (c *PlanCatalog) Len() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.plans)
+}
+
+func planKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
@@ -0,0 +1,104 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPlanValidate(t *testing.T) {
+	valid := Plan{Name: "Basic", QuotaLimit: 1024, Price: 4.99, Currency: "USD", BillingPeriodDays: 30}
+
+	tests := []struct {
+		name    string
+		modify  func(p *Plan)
+		wantErr bool
+	}{
+		{"valid plan", func(p *Plan) {}, false},
+		{"one-off plan", func(p *Plan) { p.BillingPeriodDays = 0 }, false},
+		{"empty name", func(p *Plan) { p.Name = " " }, true},
+		{"zero quota", func(p *Plan) { p.QuotaLimit = 0 }, true},
+		{"negative price", func(p *Plan) { p.Price = -1 }, true},
+		{"zero price", func(p *Plan) { p.Price = 0 }, true},
+		{"empty currency", func(p *Plan) { p.Currency = "" }, true},
+		{"negative billing period", func(p *Plan) { p.BillingPeriodDays = -1 }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := valid
+			tt.modify(&plan)
+			err := plan.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("Expected ErrInvalidInput, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPlanBillingPeriod(t *testing.T) {
+	plan := Plan{BillingPeriodDays: 30}
+	if plan.BillingPeriod() != 30*24*time.Hour {
+		t.Errorf("Expected 720h billing period, got %s", plan.BillingPeriod())
+	}
+}
+
+func TestPlanInvoiceAmount(t *testing.T) {
+	tests := []struct {
+		plan Plan
+		want int
+	}{
+		{Plan{Price: 4.99, Currency: "USD"}, 499},
+		{Plan{Price: 0.29, Currency: "eur"}, 29},
+		{Plan{Price: 250, Currency: "XTR"}, 250},
+		{Plan{Price: 500, Currency: "JPY"}, 500},
+	}
+
+	for _, tt := range tests {
+		if got := tt.plan.InvoiceAmount(); got != tt.want {
+			t.Errorf("InvoiceAmount() of %v %s = %d, want %d", tt.plan.Price, tt.plan.Currency, got, tt.want)
+		}
+	}
+}
+
+func TestNewPlanCatalog(t *testing.T) {
+	basic := Plan{Name: "Basic", QuotaLimit: 1024, Price: 4.99, Currency: "USD"}
+	pro := Plan{Name: "Pro", QuotaLimit: 4096, Price: 9.99, Currency: "USD"}
+
+	catalog, err := NewPlanCatalog([]Plan{basic, pro})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if catalog.Len() != 2 {
+		t.Errorf("Expected 2 plans, got %d", catalog.Len())
+	}
+	if plans := catalog.Plans(); plans[0].Name != "Basic" || plans[1].Name != "Pro" {
+		t.Errorf("Expected plans in configured order, got %v", plans)
+	}
+
+	plan, ok := catalog.Get("pro")
+	if !ok || plan != pro {
+		t.Errorf("Expected lookup by name to ignore case, got %v, %v", plan, ok)
+	}
+	if _, ok := catalog.Get("Gold"); ok {
+		t.Error("Expected unknown plan lookup to fail")
+	}
+
+	if _, err := NewPlanCatalog([]Plan{basic, {Name: "basic", QuotaLimit: 1, Price: 1, Currency: "USD"}}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Expected duplicate plan names to be rejected, got %v", err)
+	}
+	if _, err := NewPlanCatalog([]Plan{{Name: "Free", QuotaLimit: 1024, Currency: "USD"}}); err == nil {
+		t.Error("Expected invalid plan to be rejected")
+	}
+
+	var empty *PlanCatalog
+	if empty.Len() != 0 || empty.Plans() != nil {
+		t.Error("Expected nil catalog to be empty")
+	}
+	if _, ok := empty.Get("Basic"); ok {
+		t.Error("Expected nil catalog lookup to fail")
+	}
+}
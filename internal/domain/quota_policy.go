@@ -0,0 +1,79 @@
+package domain
+
+import "time"
+
+// QuotaDenialReason explains why a QuotaPolicy refused quota usage
+type QuotaDenialReason string
+
+// Reasons a QuotaPolicy can give for refusing quota usage
+const (
+	QuotaDeniedBanned        QuotaDenialReason = "banned"
+	QuotaDeniedExpired       QuotaDenialReason = "expired"
+	QuotaDeniedInactive      QuotaDenialReason = "inactive"
+	QuotaDeniedInvalidAmount QuotaDenialReason = "invalid_amount"
+	QuotaDeniedExceeded      QuotaDenialReason = "quota_exceeded"
+)
+
+// QuotaPolicy decides how much quota a user may use. Keeping the rules behind one
+// interface lets enforcement change without touching every caller
+type QuotaPolicy interface {
+	// CanUse reports whether the user may use amount bytes and, if not, why
+	CanUse(user *User, amount int64) (bool, QuotaDenialReason)
+	// EffectiveLimit returns the quota limit currently enforced for the user
+	EffectiveLimit(user *User) int64
+}
+
+// DefaultQuotaPolicy lets active and trial users that have not expired use quota up to
+// their limit. A paid plan that lapsed keeps its limit for GracePeriod; after that the
+// user is held to LapsedLimit even before the plan expiry sweeper downgrades them
+type DefaultQuotaPolicy struct {
+	// GracePeriod is how long a lapsed paid plan keeps its limit
+	GracePeriod time.Duration
+	// LapsedLimit provides the limit of users whose plan lapsed past the grace period.
+	// When nil their stored limit keeps applying until they are downgraded
+	LapsedLimit func() int64
+	// Now returns the current time; time.Now when nil
+	Now func() time.Time
+}
+
+// CanUse reports whether the user may use amount bytes and, if not, why
+func (p DefaultQuotaPolicy) CanUse(user *User, amount int64) (bool, QuotaDenialReason) {
+	switch {
+	case user.IsBanned():
+		return false, QuotaDeniedBanned
+	case user.ExpiresAt != nil && !p.now().Before(*user.ExpiresAt):
+		return false, QuotaDeniedExpired
+	case user.Status != UserStatusActive && user.Status != UserStatusTrial:
+		return false, QuotaDeniedInactive
+	case amount <= 0:
+		return false, QuotaDeniedInvalidAmount
+	case p.EffectiveLimit(user)-user.QuotaUsed < amount:
+		return false, QuotaDeniedExceeded
+	}
+	return true, ""
+}
+
+// EffectiveLimit returns the quota limit currently enforced for the user
+func (p DefaultQuotaPolicy) EffectiveLimit(user *User) int64 {
+	if p.LapsedLimit == nil || user.PlanExpiresAt == nil {
+		return user.QuotaLimit
+	}
+
+	// The sweeper starts the grace period when it first sees the lapsed plan, which is
+	// never before the plan expired
+	graceStart := *user.PlanExpiresAt
+	if user.GraceStartedAt != nil {
+		graceStart = *user.GraceStartedAt
+	}
+	if p.now().Before(graceStart.Add(p.GracePeriod)) {
+		return user.QuotaLimit
+	}
+	return min(user.QuotaLimit, p.LapsedLimit())
+}
+
+func (p DefaultQuotaPolicy) now() time.Time {
+	if p.Now == nil {
+		return time.Now()
+	}
+	return p.Now()
+}
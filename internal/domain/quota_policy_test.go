@@ -0,0 +1,150 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultQuotaPolicy_CanUse(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		name           string
+		user           User
+		amount         int64
+		expectedOK     bool
+		expectedReason QuotaDenialReason
+	}{
+		{
+			name:       "active user within quota",
+			user:       User{Status: UserStatusActive, QuotaLimit: 1000, QuotaUsed: 400},
+			amount:     600,
+			expectedOK: true,
+		},
+		{
+			name:       "trial user within quota",
+			user:       User{Status: UserStatusTrial, QuotaLimit: 1000, ExpiresAt: &future},
+			amount:     100,
+			expectedOK: true,
+		},
+		{
+			name:           "over quota",
+			user:           User{Status: UserStatusActive, QuotaLimit: 1000, QuotaUsed: 400},
+			amount:         601,
+			expectedReason: QuotaDeniedExceeded,
+		},
+		{
+			name:           "non-positive amount",
+			user:           User{Status: UserStatusActive, QuotaLimit: 1000},
+			amount:         0,
+			expectedReason: QuotaDeniedInvalidAmount,
+		},
+		{
+			name:           "inactive user",
+			user:           User{Status: UserStatusInactive, QuotaLimit: 1000},
+			amount:         1,
+			expectedReason: QuotaDeniedInactive,
+		},
+		{
+			name:           "banned user",
+			user:           User{Status: UserStatusBanned, QuotaLimit: 1000},
+			amount:         1,
+			expectedReason: QuotaDeniedBanned,
+		},
+		{
+			name:           "expired trial",
+			user:           User{Status: UserStatusTrial, QuotaLimit: 1000, ExpiresAt: &past},
+			amount:         1,
+			expectedReason: QuotaDeniedExpired,
+		},
+	}
+
+	policy := DefaultQuotaPolicy{Now: func() time.Time { return now }}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, reason := policy.CanUse(&tt.user, tt.amount)
+			assert.Equal(t, tt.expectedOK, ok)
+			assert.Equal(t, tt.expectedReason, reason)
+		})
+	}
+}
+
+func TestDefaultQuotaPolicy_EffectiveLimit(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	const planLimit, lapsedLimit = 10 << 30, 50 << 20
+
+	planUser := func(planExpiresAt time.Time, graceStartedAt *time.Time) *User {
+		return &User{
+			Status:         UserStatusActive,
+			QuotaLimit:     planLimit,
+			PlanName:       "Basic",
+			PlanExpiresAt:  &planExpiresAt,
+			GraceStartedAt: graceStartedAt,
+		}
+	}
+	graceStartedAt := now.Add(-48 * time.Hour)
+
+	tests := []struct {
+		name     string
+		user     *User
+		expected int64
+	}{
+		{
+			name:     "no plan",
+			user:     &User{Status: UserStatusTrial, QuotaLimit: lapsedLimit},
+			expected: lapsedLimit,
+		},
+		{
+			name:     "current plan",
+			user:     planUser(now.Add(24*time.Hour), nil),
+			expected: planLimit,
+		},
+		{
+			name:     "lapsed within grace period",
+			user:     planUser(now.Add(-time.Hour), nil),
+			expected: planLimit,
+		},
+		{
+			name:     "grace period started by the sweeper",
+			user:     planUser(now.Add(-96*time.Hour), &graceStartedAt),
+			expected: planLimit,
+		},
+		{
+			name:     "lapsed past grace period",
+			user:     planUser(now.Add(-72*time.Hour), nil),
+			expected: lapsedLimit,
+		},
+	}
+
+	policy := DefaultQuotaPolicy{
+		GracePeriod: 72 * time.Hour,
+		LapsedLimit: func() int64 { return lapsedLimit },
+		Now:         func() time.Time { return now },
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, policy.EffectiveLimit(tt.user))
+		})
+	}
+}
+
+func TestDefaultQuotaPolicy_LapsedPlanPastGraceIsHeldToLapsedLimit(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	planExpiresAt := now.Add(-time.Hour)
+	user := &User{Status: UserStatusActive, QuotaLimit: 10 << 30, QuotaUsed: 40 << 20, PlanExpiresAt: &planExpiresAt}
+
+	policy := DefaultQuotaPolicy{LapsedLimit: func() int64 { return 50 << 20 }, Now: func() time.Time { return now }}
+
+	ok, reason := policy.CanUse(user, 20<<20)
+
+	assert.False(t, ok)
+	assert.Equal(t, QuotaDeniedExceeded, reason)
+
+	// Without a lapsed limit the stored limit applies until the sweeper downgrades the user
+	ok, _ = DefaultQuotaPolicy{Now: policy.Now}.CanUse(user, 20<<20)
+	assert.True(t, ok)
+}
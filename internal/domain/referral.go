@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+)
+
+// DefaultReferralBonus is the quota in bytes credited to both the referrer and the
+// referred user when no bonus is configured (50MB)
+const DefaultReferralBonus = 52428800
+
+// referralCodeLength is the number of characters in a referral code
+const referralCodeLength = 8
+
+// referralCodeAlphabet leaves out characters that are easily confused, such as 0/O and 1/I
+const referralCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// GenerateReferralCode returns a random referral code. With 32^8 possible codes
+// collisions are negligible, so codes are not checked against existing ones; the
+// unique index on referral codes rejects the rare repeat
+func GenerateReferralCode() (string, error) {
+	buf := make([]byte, referralCodeLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate referral code: %w", err)
+	}
+	for i, b := range buf {
+		buf[i] = referralCodeAlphabet[int(b)%len(referralCodeAlphabet)]
+	}
+	return string(buf), nil
+}
+
+// NormalizeReferralCode trims and upper-cases a referral code as typed or passed in a deep link
+func NormalizeReferralCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateReferralCode(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		code, err := GenerateReferralCode()
+		require.NoError(t, err)
+		assert.Len(t, code, referralCodeLength)
+		for _, c := range code {
+			assert.True(t, strings.ContainsRune(referralCodeAlphabet, c), "unexpected character %q in %s", c, code)
+		}
+		assert.False(t, seen[code], "duplicate code %s", code)
+		seen[code] = true
+	}
+}
+
+func TestNormalizeReferralCode(t *testing.T) {
+	assert.Equal(t, "ABCD2345", NormalizeReferralCode(" abcd2345\n"))
+	assert.Empty(t, NormalizeReferralCode("   "))
+}
@@ -1,6 +1,9 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Transaction represents a database transaction
 type Transaction interface {
@@ -8,11 +11,17 @@ type Transaction interface {
 	Commit() error
 	// Rollback rolls back the transaction
 	Rollback() error
+	// Users returns a user repository working inside the transaction
+	Users() UserRepository
+	// Payments returns a payment repository working inside the transaction
+	Payments() PaymentRepository
 }
 
 // TransactionManager manages database transactions
 type TransactionManager interface {
-	// WithTransaction executes a function within a database transaction
+	// WithTransaction executes a function within a database transaction. fn may be run
+	// again after a deadlock, so it must not publish events or have other side effects
+	// outside the transaction; callers do that once WithTransaction returned
 	WithTransaction(ctx context.Context, fn func(ctx context.Context, tx Transaction) error) error
 	// BeginTx starts a new transaction and returns a transactional repository
 	BeginTx(ctx context.Context) (UserRepository, Transaction, error)
@@ -22,6 +31,84 @@ type TransactionManager interface {
 type UserRepository interface {
 	Create(ctx context.Context, user *User) error
 	GetByTelegramID(ctx context.Context, telegramID int64) (*User, error)
+	GetByTelegramIDIncludingDeleted(ctx context.Context, telegramID int64) (*User, error)
+	// GetByUsername finds a user by username, ignoring case. Usernames are not unique in
+	// storage: a user who changed their username may leave a stale copy behind, so more
+	// than one match returns ErrAmbiguousUsername rather than guessing
+	GetByUsername(ctx context.Context, username string) (*User, error)
+	// GetByReferralCode finds the user owning a referral code
+	GetByReferralCode(ctx context.Context, code string) (*User, error)
 	Update(ctx context.Context, user *User) error
 	UpdateQuota(ctx context.Context, telegramID int64, quotaUsed int64) error
+	// AddQuotaLimit raises the user's quota limit by bytes in a single statement, so
+	// concurrent credits are not lost
+	AddQuotaLimit(ctx context.Context, telegramID int64, bytes int64) error
+	// UpdateQuotaAlertedPct records the highest usage alert threshold the user was alerted at
+	UpdateQuotaAlertedPct(ctx context.Context, telegramID int64, pct int) error
+	// UpdateUnreachableAt records when the user's private chat was found missing; nil
+	// marks the user reachable again
+	UpdateUnreachableAt(ctx context.Context, telegramID int64, at *time.Time) error
+	// UpdateBlocked records whether the user blocked the bot
+	UpdateBlocked(ctx context.Context, telegramID int64, blocked bool) error
+	// UpdateLastActiveAt records when the user last sent the bot an update
+	UpdateLastActiveAt(ctx context.Context, telegramID int64, at time.Time) error
+	Delete(ctx context.Context, telegramID int64) error
+	Restore(ctx context.Context, telegramID int64) error
+	CountByStatus(ctx context.Context) (map[string]int64, error)
+	TotalQuotaUsed(ctx context.Context) (int64, error)
+	// ListUsers returns up to limit users ordered by ID, skipping the first offset
+	ListUsers(ctx context.Context, offset, limit int) ([]*User, error)
+	CountUsers(ctx context.Context) (int64, error)
+	// TopByUsage returns up to n users with the highest quota usage, heaviest first
+	TopByUsage(ctx context.Context, n int) ([]*User, error)
+	// ListPlanExpired returns active users whose paid period ended at or before the given time
+	ListPlanExpired(ctx context.Context, before time.Time) ([]*User, error)
+	// AnonymizeInactive clears the username and names of users, whatever their status,
+	// last active before cutoff and returns their Telegram IDs. Rows are kept for aggregates
+	AnonymizeInactive(ctx context.Context, cutoff time.Time) ([]int64, error)
+	// CountAnonymizable returns how many users AnonymizeInactive would anonymize
+	CountAnonymizable(ctx context.Context, cutoff time.Time) (int64, error)
+	// DailySignups returns the number of users who registered on each UTC day from the
+	// day of from through the day of to, including deleted users and days without signups
+	DailySignups(ctx context.Context, from, to time.Time) ([]DailyCount, error)
+}
+
+// UserActivityRepository defines the interface for recording recent user activity
+type UserActivityRepository interface {
+	AppendCommand(ctx context.Context, telegramID int64, command string) error
+	// ListRecent returns up to limit commands, newest first
+	ListRecent(ctx context.Context, telegramID int64, limit int) ([]CommandRecord, error)
+}
+
+// SettingsRepository defines the interface for runtime settings storage
+type SettingsRepository interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key, value string) error
+	GetBool(ctx context.Context, key string) (bool, error)
+	SetBool(ctx context.Context, key string, value bool) error
+	GetInt64(ctx context.Context, key string) (int64, error)
+	SetInt64(ctx context.Context, key string, value int64) error
+	// List returns all stored settings keyed by name
+	List(ctx context.Context) (map[string]string, error)
+}
+
+// BugReportRepository defines the interface for bug report storage
+type BugReportRepository interface {
+	Create(ctx context.Context, report *BugReport) error
+}
+
+// PaymentRepository defines the interface for processed payment storage
+type PaymentRepository interface {
+	// Create stores a payment. A charge that was already stored returns
+	// ErrPaymentAlreadyProcessed
+	Create(ctx context.Context, payment *Payment) error
+	// Exists reports whether a payment with the provider charge ID was already stored
+	Exists(ctx context.Context, providerChargeID string) (bool, error)
+}
+
+// UserSightingRepository defines the interface for first-seen tracking
+type UserSightingRepository interface {
+	// RecordFirstSeen stores seenAt unless the user has already been seen
+	RecordFirstSeen(ctx context.Context, telegramID int64, seenAt time.Time) error
+	GetFirstSeen(ctx context.Context, telegramID int64) (time.Time, error)
 }
@@ -1,11 +1,69 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // UserService defines the interface for user business logic
 type UserService interface {
-	RegisterUser(ctx context.Context, telegramID int64, username, firstName, lastName string) (*User, error)
+	RegisterUser(ctx context.Context, telegramID int64, username, firstName, lastName, languageCode string) (*User, error)
+	// RegisterWithReferral registers a user through a referral code, crediting bonus quota to
+	// both users. Unknown codes and already registered users fall back to RegisterUser
+	RegisterWithReferral(ctx context.Context, telegramID int64, username, firstName, lastName, languageCode, referralCode string) (*User, error)
 	GetUser(ctx context.Context, telegramID int64) (*User, error)
+	// GetUserSnapshot returns a read model of the user for display
+	GetUserSnapshot(ctx context.Context, telegramID int64) (*UserSnapshot, error)
+	// FindByUsername finds a user by username with or without the leading @
+	FindByUsername(ctx context.Context, username string) (*User, error)
 	ActivateTrial(ctx context.Context, telegramID int64) error
+	// UpgradeUser moves a user to an active account with a larger quota
+	UpgradeUser(ctx context.Context, telegramID int64, newQuotaLimit int64) error
 	UpdateQuota(ctx context.Context, telegramID int64, quotaUsed int64) error
+	// ResetQuota sets the user's used quota back to zero, e.g. at the start of a billing cycle
+	ResetQuota(ctx context.Context, telegramID int64) error
+	// SetLanguage stores the language the user chose for bot replies
+	SetLanguage(ctx context.Context, telegramID int64, code string) error
+	// SetAlertThreshold sets the usage percentage the user is alerted at; zero restores
+	// the default thresholds
+	SetAlertThreshold(ctx context.Context, telegramID int64, pct int) error
+	// SetTimezone stores the IANA timezone the user's quiet hours are kept in; empty
+	// restores the configured timezone
+	SetTimezone(ctx context.Context, telegramID int64, name string) error
+	DeleteUser(ctx context.Context, telegramID int64) error
+	// BanUser bans a user; banning an already banned user is a no-op
+	BanUser(ctx context.Context, telegramID int64) error
+	// UnbanUser lifts a ban; unbanning a user who is not banned is a no-op
+	UnbanUser(ctx context.Context, telegramID int64) error
+	// MarkBlocked records that the user blocked the bot so they are no longer messaged;
+	// starting the bot again clears it
+	MarkBlocked(ctx context.Context, telegramID int64) error
+	GetAggregateStats(ctx context.Context) (*UserStats, error)
+	// CountByStatus returns the number of users with each status in a single query
+	CountByStatus(ctx context.Context) (map[string]int64, error)
+	// ListUsers returns a page of users ordered by ID; limit must be between 1 and 100
+	ListUsers(ctx context.Context, offset, limit int) ([]*UserSnapshot, error)
+	CountUsers(ctx context.Context) (int64, error)
+	// TopByUsage returns up to n users with the highest quota usage; n must be between 1 and 100
+	TopByUsage(ctx context.Context, n int) ([]*UserSnapshot, error)
+	// DailySignups returns the number of registrations per UTC day from the day of from
+	// through the day of to; the window may span at most 366 days
+	DailySignups(ctx context.Context, from, to time.Time) ([]DailyCount, error)
+}
+
+// VPNService issues VPN credentials to users
+type VPNService interface {
+	// GenerateConfig issues a new VPN config to an active user with quota left. Users
+	// who are not active return ErrUserNotActive and users out of quota ErrQuotaExceeded
+	GenerateConfig(ctx context.Context, telegramID int64) (*VPNConfig, error)
+	// RevokeConfig revokes the config last issued to the user; revoking when no config
+	// was issued is a no-op
+	RevokeConfig(ctx context.Context, telegramID int64) error
+}
+
+// PaymentService defines the interface for applying successful payments
+type PaymentService interface {
+	// ProcessPayment applies the paid plan to the user. Charges that were already
+	// processed return ErrPaymentAlreadyProcessed and change nothing
+	ProcessPayment(ctx context.Context, payment *Payment) (*User, error)
 }
@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+// Setting is a runtime-configurable key/value setting stored in the database
+type Setting struct {
+	Key       string    `json:"key" gorm:"primaryKey;size:128"`
+	Value     string    `json:"value" gorm:"size:1024;not null"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SettingChange describes a setting whose value changed. Old is empty for a setting
+// that was added and New for one that was removed
+type SettingChange struct {
+	Key string
+	Old string
+	New string
+}
@@ -2,21 +2,68 @@ package domain
 
 import (
 	"fmt"
+	"slices"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // User represents a VPN bot user
 type User struct {
-	ID         int64     `json:"id" gorm:"primaryKey;autoIncrement"`
-	TelegramID int64     `json:"telegram_id" gorm:"uniqueIndex;not null"`
-	Username   string    `json:"username" gorm:"size:255"`
-	FirstName  string    `json:"first_name" gorm:"size:255"`
-	LastName   string    `json:"last_name" gorm:"size:255"`
-	Status     string    `json:"status" gorm:"size:50;default:inactive"`
-	QuotaLimit int64     `json:"quota_limit" gorm:"default:52428800"` // 50MB
-	QuotaUsed  int64     `json:"quota_used" gorm:"default:0"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID           int64     `json:"id" gorm:"primaryKey;autoIncrement"`
+	TelegramID   int64     `json:"telegram_id" gorm:"uniqueIndex;not null"`
+	Username     string    `json:"username" gorm:"size:255"`
+	FirstName    string    `json:"first_name" gorm:"size:255"`
+	LastName     string    `json:"last_name" gorm:"size:255"`
+	LanguageCode string    `json:"language_code" gorm:"size:16"`
+	Status       string    `json:"status" gorm:"size:50;default:inactive"`
+	QuotaLimit   int64     `json:"quota_limit" gorm:"default:52428800"` // 50MB
+	QuotaUsed    int64     `json:"quota_used" gorm:"default:0"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	// ExpiresAt is when the trial or subscription ends; nil means the account never expires
+	ExpiresAt *time.Time `json:"expires_at,omitempty" gorm:"index"`
+
+	// PlanName is the paid plan the user is on, empty when not on a paid plan
+	PlanName string `json:"plan_name,omitempty" gorm:"size:255"`
+	// PlanExpiresAt is when the paid period ends; nil means the plan does not lapse
+	PlanExpiresAt *time.Time `json:"plan_expires_at,omitempty" gorm:"index"`
+	// GraceStartedAt is when the grace period after a lapsed paid period began
+	GraceStartedAt *time.Time `json:"grace_started_at,omitempty"`
+
+	// ReferralCode is the code this user shares to refer others
+	ReferralCode string `json:"referral_code,omitempty" gorm:"size:16;uniqueIndex"`
+	// ReferredBy is the Telegram ID of the user whose referral code this user registered with
+	ReferredBy *int64 `json:"referred_by,omitempty"`
+
+	// AlertThresholdPct is the usage percentage the user wants to be alerted at; zero
+	// means DefaultQuotaAlertThresholds apply
+	AlertThresholdPct int `json:"alert_threshold_pct,omitempty" gorm:"default:0"`
+	// QuotaAlertedPct is the highest threshold the user was alerted at in the current quota
+	// cycle, so each threshold fires once until the quota is reset or replaced
+	QuotaAlertedPct int `json:"quota_alerted_pct,omitempty" gorm:"default:0"`
+	// Timezone is the IANA name of the user's timezone, e.g. Europe/Moscow, in which
+	// their quiet hours are kept; empty uses the configured quiet hours timezone
+	Timezone string `json:"timezone,omitempty" gorm:"size:64"`
+
+	// VPNPublicKey is the WireGuard public key of the VPN config last issued to the user,
+	// kept so the peer can be revoked; the private key is never stored
+	VPNPublicKey string `json:"vpn_public_key,omitempty" gorm:"size:64;index"`
+
+	// LastActiveAt is when the user last sent the bot an update, to within an hour; nil
+	// when they have not since it was first recorded
+	LastActiveAt *time.Time `json:"last_active_at,omitempty" gorm:"index"`
+
+	// UnreachableAt is when Telegram reported the user's private chat as not found, i.e.
+	// the user never started it or deleted it; nil while messages can be delivered
+	UnreachableAt *time.Time `json:"unreachable_at,omitempty"`
+	// Blocked is set when Telegram reported that the user blocked the bot, so they are
+	// not messaged until they start it again
+	Blocked bool `json:"blocked,omitempty" gorm:"default:false"`
+
+	// DeletedAt marks the user as soft-deleted; GORM excludes such rows from queries by default
+	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
 }
 
 // UserStatus constants
@@ -24,13 +71,36 @@ const (
 	UserStatusInactive = "inactive"
 	UserStatusTrial    = "trial"
 	UserStatusActive   = "active"
+	UserStatusBanned   = "banned"
 )
 
-// DefaultQuotaLimit is 50MB in bytes
+// DefaultQuotaLimit is 50MB in bytes, used when no trial quota is configured
 const DefaultQuotaLimit = 52428800
 
+// DefaultTrialDuration is how long a trial lasts when no duration is configured
+const DefaultTrialDuration = 7 * 24 * time.Hour
+
+// DefaultQuotaAlertThresholds are the usage percentages users are alerted at unless
+// they set their own threshold
+var DefaultQuotaAlertThresholds = []int{80, 95}
+
+// QuotaExhaustedThresholdPct is always alerted at, whatever thresholds the user chose
+const QuotaExhaustedThresholdPct = 100
+
+// Bounds of a user-set alert threshold; alerts at 0% would be meaningless and 100% is
+// always alerted at
+const (
+	MinAlertThresholdPct = 1
+	MaxAlertThresholdPct = 99
+)
+
 // NewUser creates a new user with default values
 func NewUser(telegramID int64, username, firstName, lastName string) *User {
+	return NewUserWithQuota(telegramID, username, firstName, lastName, DefaultQuotaLimit)
+}
+
+// NewUserWithQuota creates a new user with the given quota limit in bytes
+func NewUserWithQuota(telegramID int64, username, firstName, lastName string, quotaLimit int64) *User {
 	now := time.Now()
 	return &User{
 		TelegramID: telegramID,
@@ -38,19 +108,132 @@ func NewUser(telegramID int64, username, firstName, lastName string) *User {
 		FirstName:  firstName,
 		LastName:   lastName,
 		Status:     UserStatusInactive,
-		QuotaLimit: DefaultQuotaLimit,
+		QuotaLimit: quotaLimit,
 		QuotaUsed:  0,
 		CreatedAt:  now,
 		UpdatedAt:  now,
 	}
 }
 
-// ActivateTrial activates the user's trial
+// IsUnreachable reports whether messages to the user cannot be delivered because their
+// private chat with the bot does not exist
+func (u *User) IsUnreachable() bool {
+	return u.UnreachableAt != nil
+}
+
+// Location returns the user's timezone, or nil when they have not set a valid one
+func (u *User) Location() *time.Location {
+	return LoadTimezone(u.Timezone)
+}
+
+// LoadTimezone returns the timezone with the IANA name, or nil when the name is empty
+// or unknown
+func LoadTimezone(name string) *time.Location {
+	if name == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil
+	}
+	return loc
+}
+
+// IsDeleted checks if the user has been soft-deleted
+func (u *User) IsDeleted() bool {
+	return u.DeletedAt.Valid
+}
+
+// IsAnonymized reports whether data retention cleared the user's names. Registration
+// requires a first name, so only anonymizing leaves it blank
+func (u *User) IsAnonymized() bool {
+	return u.FirstName == ""
+}
+
+// MarkRestored clears the soft-delete marker so saving the user keeps it visible
+func (u *User) MarkRestored() {
+	u.DeletedAt = gorm.DeletedAt{}
+}
+
+// ActivateTrial activates the user's trial for the default trial duration
 func (u *User) ActivateTrial() {
+	u.ActivateTrialFor(DefaultTrialDuration)
+}
+
+// ActivateTrialFor activates the user's trial for the given duration. A
+// non-positive duration activates a trial that never expires
+func (u *User) ActivateTrialFor(duration time.Duration) {
+	now := time.Now()
 	u.Status = UserStatusTrial
+	u.ExpiresAt = nil
+	if duration > 0 {
+		expiresAt := now.Add(duration)
+		u.ExpiresAt = &expiresAt
+	}
+	u.UpdatedAt = now
+}
+
+// ApplyPlan activates a paid plan. The plan's billing period extends a paid period
+// that is still running and otherwise starts now; plans without one never lapse
+func (u *User) ApplyPlan(plan Plan) {
+	now := time.Now()
+	start := now
+	if u.Status == UserStatusActive && u.PlanExpiresAt != nil && u.PlanExpiresAt.After(now) {
+		start = *u.PlanExpiresAt
+	}
+
+	u.Status = UserStatusActive
+	u.QuotaLimit = plan.QuotaLimit
+	u.ExpiresAt = nil
+	u.PlanName = plan.Name
+	u.PlanExpiresAt = nil
+	u.GraceStartedAt = nil
+	u.QuotaAlertedPct = 0
+	if period := plan.BillingPeriod(); period > 0 {
+		planExpiresAt := start.Add(period)
+		u.PlanExpiresAt = &planExpiresAt
+	}
+	u.UpdatedAt = now
+}
+
+// Upgrade moves the user to a full active account with the given quota. Unlike
+// ApplyPlan it is not tied to a plan and never lapses
+func (u *User) Upgrade(quotaLimit int64) {
+	u.Status = UserStatusActive
+	u.QuotaLimit = quotaLimit
+	u.ExpiresAt = nil
+	u.QuotaAlertedPct = 0
 	u.UpdatedAt = time.Now()
 }
 
+// AddQuota raises the user's quota limit by the given number of bytes
+func (u *User) AddQuota(bytes int64) {
+	u.QuotaLimit += bytes
+	u.UpdatedAt = time.Now()
+}
+
+// IsPlanExpired checks if the user's paid period has lapsed at the given time
+func (u *User) IsPlanExpired(now time.Time) bool {
+	return u.PlanExpiresAt != nil && !now.Before(*u.PlanExpiresAt)
+}
+
+// ExpirePlan downgrades a user whose paid period lapsed back to an inactive
+// account with the given quota
+func (u *User) ExpirePlan(quotaLimit int64) {
+	u.Status = UserStatusInactive
+	u.QuotaLimit = quotaLimit
+	u.PlanName = ""
+	u.PlanExpiresAt = nil
+	u.GraceStartedAt = nil
+	u.UpdatedAt = time.Now()
+}
+
+// IsExpired checks if the user's trial or subscription has ended.
+// Accounts without an expiry date never expire
+func (u *User) IsExpired() bool {
+	return u.ExpiresAt != nil && !time.Now().Before(*u.ExpiresAt)
+}
+
 // GetQuotaRemaining returns the remaining quota in bytes
 func (u *User) GetQuotaRemaining() int64 {
 	return u.QuotaLimit - u.QuotaUsed
@@ -61,11 +244,54 @@ func (u *User) HasQuotaRemaining() bool {
 	return u.GetQuotaRemaining() > 0
 }
 
-// IsActive checks if user is active or on trial
+// Ban marks the user as banned, revoking access to the service
+func (u *User) Ban() {
+	u.Status = UserStatusBanned
+	u.UpdatedAt = time.Now()
+}
+
+// Unban lifts a ban. Users holding a paid plan get it back and users who had a trial
+// keep it, so a ban cannot be used to start a second trial; the others become inactive.
+// Lapsed plans and trials are expired as usual afterwards
+func (u *User) Unban() {
+	switch {
+	case u.PlanName != "":
+		u.Status = UserStatusActive
+	case u.ExpiresAt != nil:
+		u.Status = UserStatusTrial
+	default:
+		u.Status = UserStatusInactive
+	}
+	u.UpdatedAt = time.Now()
+}
+
+// IsBanned checks if the user has been banned
+func (u *User) IsBanned() bool {
+	return u.Status == UserStatusBanned
+}
+
+// IsActive checks if user is active or on trial and has not expired
 func (u *User) IsActive() bool {
+	if u.IsExpired() {
+		return false
+	}
 	return u.Status == UserStatusActive || u.Status == UserStatusTrial
 }
 
+// BeforeCreate gives a user stored without a referral code one of their own, since
+// referral codes are unique
+func (u *User) BeforeCreate(*gorm.DB) error {
+	if u.ReferralCode != "" {
+		return nil
+	}
+	code, err := GenerateReferralCode()
+	if err != nil {
+		return err
+	}
+	u.ReferralCode = code
+	return nil
+}
+
 // Validate validates user data
 func (u *User) Validate() error {
 	if u.TelegramID <= 0 {
@@ -74,7 +300,7 @@ func (u *User) Validate() error {
 	if u.FirstName == "" {
 		return ValidationError{Field: "first_name", Message: "cannot be empty"}
 	}
-	if u.Status != UserStatusInactive && u.Status != UserStatusTrial && u.Status != UserStatusActive {
+	if u.Status != UserStatusInactive && u.Status != UserStatusTrial && u.Status != UserStatusActive && u.Status != UserStatusBanned {
 		return ValidationError{Field: "status", Message: fmt.Sprintf("invalid status: %s", u.Status)}
 	}
 	if u.QuotaLimit < 0 {
@@ -91,15 +317,11 @@ func (u *User) CanActivateTrial() bool {
 	return u.Status == UserStatusInactive
 }
 
-// CanUseQuota checks if the user can use the specified amount of quota
+// CanUseQuota checks if the user can use the specified amount of quota under the
+// DefaultQuotaPolicy
 func (u *User) CanUseQuota(amount int64) bool {
-	if !u.IsActive() {
-		return false
-	}
-	if amount <= 0 {
-		return false
-	}
-	return u.GetQuotaRemaining() >= amount
+	allowed, _ := DefaultQuotaPolicy{}.CanUse(u, amount)
+	return allowed
 }
 
 // AddQuotaUsage adds quota usage if possible
@@ -119,3 +341,45 @@ func (u *User) GetQuotaUsagePercentage() float64 {
 	}
 	return float64(u.QuotaUsed) / float64(u.QuotaLimit) * 100.0
 }
+
+// QuotaAlertThresholds returns the usage percentages the user is alerted at, in
+// ascending order. Exhausting the quota is always among them
+func (u *User) QuotaAlertThresholds() []int {
+	thresholds := DefaultQuotaAlertThresholds
+	if u.AlertThresholdPct > 0 {
+		thresholds = []int{u.AlertThresholdPct}
+	}
+	return append(slices.Clone(thresholds), QuotaExhaustedThresholdPct)
+}
+
+// CrossedQuotaAlertThreshold returns the highest alert threshold crossed when usage
+// grows from previousUsed to used bytes, or zero when no threshold was crossed.
+// Thresholds already alerted at in this quota cycle are not crossed again
+func (u *User) CrossedQuotaAlertThreshold(previousUsed, used int64) int {
+	if u.QuotaLimit <= 0 {
+		return 0
+	}
+
+	crossed := 0
+	for _, pct := range u.QuotaAlertThresholds() {
+		// Compare in bytes to avoid rounding a usage just below the threshold up to it
+		threshold := u.QuotaLimit * int64(pct) / 100
+		if pct > u.QuotaAlertedPct && previousUsed < threshold && used >= threshold {
+			crossed = pct
+		}
+	}
+	return crossed
+}
+
+// UserStats holds aggregate statistics across all users
+type UserStats struct {
+	TotalUsers     int64
+	UsersByStatus  map[string]int64
+	TotalQuotaUsed int64
+}
+
+// DailyCount is a count for a single UTC day
+type DailyCount struct {
+	Day   time.Time
+	Count int64
+}
@@ -0,0 +1,10 @@
+package domain
+
+import "time"
+
+// UserSighting records when the bot first saw a Telegram user, independent of
+// registration. Users who never /start (for example in groups) still get one
+type UserSighting struct {
+	TelegramID  int64     `json:"telegram_id" gorm:"primaryKey;autoIncrement:false"`
+	FirstSeenAt time.Time `json:"first_seen_at" gorm:"not null"`
+}
@@ -0,0 +1,65 @@
+package domain
+
+import "time"
+
+// UserSnapshot is a read model of a user for display and exports. It carries only
+// what is shown to people, with the derived quota and account state computed when the
+// snapshot was taken, and none of the persistence details of User
+type UserSnapshot struct {
+	TelegramID   int64  `json:"telegram_id"`
+	Username     string `json:"username,omitempty"`
+	FirstName    string `json:"first_name,omitempty"`
+	LastName     string `json:"last_name,omitempty"`
+	LanguageCode string `json:"language_code,omitempty"`
+	Status       string `json:"status"`
+	PlanName     string `json:"plan_name,omitempty"`
+	ReferralCode string `json:"referral_code,omitempty"`
+	Timezone     string `json:"timezone,omitempty"`
+
+	QuotaLimit int64 `json:"quota_limit"`
+	QuotaUsed  int64 `json:"quota_used"`
+	// QuotaRemaining is the quota left in bytes, never negative
+	QuotaRemaining int64 `json:"quota_remaining"`
+	// QuotaUsedPct is the percentage of the quota used; it exceeds 100 when the user
+	// went over their quota
+	QuotaUsedPct float64 `json:"quota_used_pct"`
+
+	// Active reports whether the user is active or on trial and has not expired
+	Active bool `json:"active"`
+	// Expired reports whether the trial or subscription has ended
+	Expired bool `json:"expired"`
+	// Blocked reports whether the user blocked the bot
+	Blocked bool `json:"blocked,omitempty"`
+	// Unreachable reports whether the user's private chat with the bot does not exist
+	Unreachable bool `json:"unreachable,omitempty"`
+
+	CreatedAt     time.Time  `json:"created_at"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	PlanExpiresAt *time.Time `json:"plan_expires_at,omitempty"`
+}
+
+// NewUserSnapshot takes a snapshot of user
+func NewUserSnapshot(user *User) *UserSnapshot {
+	return &UserSnapshot{
+		TelegramID:     user.TelegramID,
+		Username:       user.Username,
+		FirstName:      user.FirstName,
+		LastName:       user.LastName,
+		LanguageCode:   user.LanguageCode,
+		Status:         user.Status,
+		PlanName:       user.PlanName,
+		ReferralCode:   user.ReferralCode,
+		Timezone:       user.Timezone,
+		QuotaLimit:     user.QuotaLimit,
+		QuotaUsed:      user.QuotaUsed,
+		QuotaRemaining: max(user.GetQuotaRemaining(), 0),
+		QuotaUsedPct:   user.GetQuotaUsagePercentage(),
+		Active:         user.IsActive(),
+		Expired:        user.IsExpired(),
+		Blocked:        user.Blocked,
+		Unreachable:    user.IsUnreachable(),
+		CreatedAt:      user.CreatedAt,
+		ExpiresAt:      user.ExpiresAt,
+		PlanExpiresAt:  user.PlanExpiresAt,
+	}
+}
@@ -42,6 +42,17 @@ func TestNewUser(t *testing.T) {
 	}
 }
 
+func TestNewUserWithQuota(t *testing.T) {
+	user := NewUserWithQuota(123, "test", "Test", "User", 104857600)
+
+	if user.QuotaLimit != 104857600 {
+		t.Errorf("Expected QuotaLimit %d, got %d", 104857600, user.QuotaLimit)
+	}
+	if user.Status != UserStatusInactive {
+		t.Errorf("Expected Status %s, got %s", UserStatusInactive, user.Status)
+	}
+}
+
 func TestUser_ActivateTrial(t *testing.T) {
 	user := NewUser(123, "test", "Test", "User")
 	originalUpdatedAt := user.UpdatedAt
@@ -57,6 +68,103 @@ func TestUser_ActivateTrial(t *testing.T) {
 	if !user.UpdatedAt.After(originalUpdatedAt) {
 		t.Error("Expected UpdatedAt to be updated")
 	}
+	if user.ExpiresAt == nil || !user.ExpiresAt.Equal(user.UpdatedAt.Add(DefaultTrialDuration)) {
+		t.Errorf("Expected ExpiresAt to be %v after activation, got %v", DefaultTrialDuration, user.ExpiresAt)
+	}
+}
+
+func TestUser_ActivateTrialFor(t *testing.T) {
+	user := NewUser(123, "test", "Test", "User")
+
+	user.ActivateTrialFor(24 * time.Hour)
+	if user.ExpiresAt == nil || !user.ExpiresAt.Equal(user.UpdatedAt.Add(24*time.Hour)) {
+		t.Errorf("Expected ExpiresAt one day after activation, got %v", user.ExpiresAt)
+	}
+
+	// A non-positive duration means the trial never expires
+	user.ActivateTrialFor(0)
+	if user.ExpiresAt != nil {
+		t.Errorf("Expected no expiry, got %v", user.ExpiresAt)
+	}
+	if user.IsExpired() || !user.IsActive() {
+		t.Error("Expected a trial without expiry to stay active")
+	}
+}
+
+func TestUser_Ban(t *testing.T) {
+	user := NewUser(123, "test", "Test", "User")
+	user.ActivateTrial()
+
+	user.Ban()
+
+	if !user.IsBanned() {
+		t.Error("Expected user to be banned")
+	}
+	if user.IsActive() {
+		t.Error("Expected banned user not to be active")
+	}
+	if user.CanActivateTrial() {
+		t.Error("Expected banned user not to be able to activate a trial")
+	}
+	if err := user.Validate(); err != nil {
+		t.Errorf("Expected banned user to be valid, got %v", err)
+	}
+}
+
+func TestUser_Unban(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		setup    func(u *User)
+		expected string
+	}{
+		{name: "paid plan is restored", setup: func(u *User) { u.ApplyPlan(Plan{Name: "monthly", QuotaLimit: 1 << 30}) }, expected: UserStatusActive},
+		{name: "trial is restored", setup: func(u *User) { u.ExpiresAt = &future }, expected: UserStatusTrial},
+		{name: "other users become inactive", setup: func(*User) {}, expected: UserStatusInactive},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := NewUser(123, "test", "Test", "User")
+			tt.setup(user)
+			user.Ban()
+
+			user.Unban()
+
+			if user.Status != tt.expected {
+				t.Errorf("Expected status %s, got %s", tt.expected, user.Status)
+			}
+		})
+	}
+}
+
+func TestUser_IsExpired(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		expected  bool
+	}{
+		{name: "No expiry", expiresAt: nil, expected: false},
+		{name: "Expires in the future", expiresAt: &future, expected: false},
+		{name: "Expired", expiresAt: &past, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &User{Status: UserStatusTrial, ExpiresAt: tt.expiresAt}
+
+			if result := user.IsExpired(); result != tt.expected {
+				t.Errorf("Expected IsExpired %t, got %t", tt.expected, result)
+			}
+			if result := user.IsActive(); result == tt.expected {
+				t.Errorf("Expected IsActive %t, got %t", !tt.expected, result)
+			}
+		})
+	}
 }
 
 func TestUser_GetQuotaRemaining(t *testing.T) {
@@ -355,6 +463,17 @@ func TestUser_CanUseQuota(t *testing.T) {
 			amount:   -10,
 			expected: false,
 		},
+		{
+			name: "Cannot use quota - expired user",
+			user: &User{
+				Status:     UserStatusTrial,
+				QuotaLimit: 100,
+				QuotaUsed:  0,
+				ExpiresAt:  func() *time.Time { t := time.Now().Add(-time.Hour); return &t }(),
+			},
+			amount:   25,
+			expected: false,
+		},
 		{
 			name: "Can use quota - exact remaining quota",
 			user: &User{
@@ -508,3 +627,95 @@ func TestUser_GetQuotaUsagePercentage(t *testing.T) {
 		})
 	}
 }
+
+func TestUser_CrossedQuotaAlertThreshold(t *testing.T) {
+	tests := []struct {
+		name         string
+		user         *User
+		previousUsed int64
+		used         int64
+		expected     int
+	}{
+		{name: "Below every threshold", user: &User{QuotaLimit: 100}, previousUsed: 10, used: 79, expected: 0},
+		{name: "Crosses the first default", user: &User{QuotaLimit: 100}, previousUsed: 79, used: 80, expected: 80},
+		{name: "Crosses both defaults at once", user: &User{QuotaLimit: 100}, previousUsed: 50, used: 96, expected: 95},
+		{name: "Already past the threshold", user: &User{QuotaLimit: 100}, previousUsed: 81, used: 90, expected: 0},
+		{name: "Custom threshold replaces the defaults", user: &User{QuotaLimit: 100, AlertThresholdPct: 50}, previousUsed: 40, used: 50, expected: 50},
+		{name: "Defaults ignored with a custom threshold", user: &User{QuotaLimit: 100, AlertThresholdPct: 50}, previousUsed: 70, used: 90, expected: 0},
+		{name: "Exhausting the quota", user: &User{QuotaLimit: 100, QuotaAlertedPct: 95}, previousUsed: 96, used: 100, expected: 100},
+		{name: "Exhausting the quota with a custom threshold", user: &User{QuotaLimit: 100, AlertThresholdPct: 50}, previousUsed: 40, used: 100, expected: 100},
+		{name: "Already alerted in this cycle", user: &User{QuotaLimit: 100, QuotaAlertedPct: 80}, previousUsed: 10, used: 85, expected: 0},
+		{name: "Zero quota limit", user: &User{QuotaLimit: 0}, previousUsed: 0, used: 50, expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.user.CrossedQuotaAlertThreshold(tt.previousUsed, tt.used)
+			if result != tt.expected {
+				t.Errorf("User.CrossedQuotaAlertThreshold() = %d, expected %d", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUser_ApplyPlan(t *testing.T) {
+	plan := Plan{Name: "Basic", QuotaLimit: 1024, Price: 4.99, Currency: "USD", BillingPeriodDays: 30}
+	period := 30 * 24 * time.Hour
+
+	user := NewUser(123, "test", "Test", "User")
+	user.ActivateTrial()
+	user.ApplyPlan(plan)
+
+	if user.Status != UserStatusActive {
+		t.Errorf("Expected status %s, got %s", UserStatusActive, user.Status)
+	}
+	if user.QuotaLimit != plan.QuotaLimit {
+		t.Errorf("Expected quota limit %d, got %d", plan.QuotaLimit, user.QuotaLimit)
+	}
+	if user.PlanName != "Basic" {
+		t.Errorf("Expected plan Basic, got %s", user.PlanName)
+	}
+	if user.ExpiresAt != nil {
+		t.Errorf("Expected the trial expiry to be cleared, got %v", user.ExpiresAt)
+	}
+	if user.PlanExpiresAt == nil || user.PlanExpiresAt.Sub(time.Now().Add(period)).Abs() > time.Minute {
+		t.Errorf("Expected plan expiry in 30 days, got %v", user.PlanExpiresAt)
+	}
+
+	// Renewing extends the running period instead of restarting it
+	firstExpiry := *user.PlanExpiresAt
+	user.ApplyPlan(plan)
+	if !user.PlanExpiresAt.Equal(firstExpiry.Add(period)) {
+		t.Errorf("Expected renewal to extend plan expiry to %v, got %v", firstExpiry.Add(period), user.PlanExpiresAt)
+	}
+
+	// Plans without a billing period never lapse
+	user.ApplyPlan(Plan{Name: "Lifetime", QuotaLimit: 2048, Price: 99, Currency: "USD"})
+	if user.PlanExpiresAt != nil {
+		t.Errorf("Expected no plan expiry, got %v", user.PlanExpiresAt)
+	}
+}
+
+func TestUser_ExpirePlan(t *testing.T) {
+	user := NewUser(123, "test", "Test", "User")
+	user.ApplyPlan(Plan{Name: "Basic", QuotaLimit: 1024, Price: 4.99, Currency: "USD", BillingPeriodDays: 30})
+
+	if user.IsPlanExpired(time.Now()) {
+		t.Error("Expected a fresh plan not to be expired")
+	}
+	if !user.IsPlanExpired(time.Now().Add(31 * 24 * time.Hour)) {
+		t.Error("Expected the plan to be expired after its billing period")
+	}
+
+	user.ExpirePlan(DefaultQuotaLimit)
+
+	if user.Status != UserStatusInactive {
+		t.Errorf("Expected status %s, got %s", UserStatusInactive, user.Status)
+	}
+	if user.QuotaLimit != DefaultQuotaLimit {
+		t.Errorf("Expected quota limit %d, got %d", int64(DefaultQuotaLimit), user.QuotaLimit)
+	}
+	if user.PlanName != "" || user.PlanExpiresAt != nil {
+		t.Errorf("Expected plan to be cleared, got %s %v", user.PlanName, user.PlanExpiresAt)
+	}
+}
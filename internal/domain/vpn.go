@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultVPNAllowedIPs routes all of the client's traffic through the VPN
+const DefaultVPNAllowedIPs = "0.0.0.0/0, ::/0"
+
+// VPNKeepaliveSeconds keeps the tunnel open behind NAT
+const VPNKeepaliveSeconds = 25
+
+// VPNConfig is a WireGuard client configuration issued to a user
+type VPNConfig struct {
+	PrivateKey string // base64 client private key
+	PublicKey  string // base64 client public key, registered with the server
+	Address    string // client address in CIDR notation
+	DNS        string
+
+	ServerPublicKey string
+	Endpoint        string // host:port of the server
+	AllowedIPs      string
+}
+
+// Render returns the config in the wg-quick format understood by WireGuard clients
+func (c *VPNConfig) Render() string {
+	var sb strings.Builder
+	sb.WriteString("[Interface]\n")
+	fmt.Fprintf(&sb, "PrivateKey = %s\n", c.PrivateKey)
+	fmt.Fprintf(&sb, "Address = %s\n", c.Address)
+	if c.DNS != "" {
+		fmt.Fprintf(&sb, "DNS = %s\n", c.DNS)
+	}
+	sb.WriteString("\n[Peer]\n")
+	fmt.Fprintf(&sb, "PublicKey = %s\n", c.ServerPublicKey)
+	fmt.Fprintf(&sb, "Endpoint = %s\n", c.Endpoint)
+	fmt.Fprintf(&sb, "AllowedIPs = %s\n", c.AllowedIPs)
+	fmt.Fprintf(&sb, "PersistentKeepalive = %d\n", VPNKeepaliveSeconds)
+	return sb.String()
+}
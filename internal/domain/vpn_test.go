@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVPNConfig_Render(t *testing.T) {
+	config := &VPNConfig{
+		PrivateKey:      "client-private",
+		PublicKey:       "client-public",
+		Address:         "10.8.0.2/32",
+		DNS:             "1.1.1.1",
+		ServerPublicKey: "server-public",
+		Endpoint:        "vpn.example.com:51820",
+		AllowedIPs:      DefaultVPNAllowedIPs,
+	}
+
+	expected := `[Interface]
+PrivateKey = client-private
+Address = 10.8.0.2/32
+DNS = 1.1.1.1
+
+[Peer]
+PublicKey = server-public
+Endpoint = vpn.example.com:51820
+AllowedIPs = 0.0.0.0/0, ::/0
+PersistentKeepalive = 25
+`
+	assert.Equal(t, expected, config.Render())
+	assert.NotContains(t, config.Render(), "client-public", "the client public key is only for the server")
+}
@@ -0,0 +1,114 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// batchedEventTypes are the low-priority events that are buffered and published in
+// batches instead of one at a time. They are produced for every update, and losing a
+// few on a crash loses no user state
+var batchedEventTypes = map[EventType]bool{
+	EventBotMessageReceived:  true,
+	EventBotCallbackReceived: true,
+	EventBotCommandExecuted:  true,
+}
+
+// eventBatcher buffers events and publishes them with PublishBatch once size of them
+// are buffered or interval has passed since the last flush
+type eventBatcher struct {
+	publisher Publisher
+	logger    *logrus.Logger
+	size      int
+	interval  time.Duration
+
+	mu      sync.Mutex
+	pending []*Event
+
+	full      chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newEventBatcher creates a batcher and starts flushing it in the background
+func newEventBatcher(publisher Publisher, logger *logrus.Logger, size int, interval time.Duration) *eventBatcher {
+	b := &eventBatcher{
+		publisher: publisher,
+		logger:    logger,
+		size:      size,
+		interval:  interval,
+		pending:   make([]*Event, 0, size),
+		full:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// add buffers an event. A full buffer is flushed in the background, so the caller
+// never waits for Kafka
+func (b *eventBatcher) add(event *Event) {
+	b.mu.Lock()
+	b.pending = append(b.pending, event)
+	full := len(b.pending) >= b.size
+	b.mu.Unlock()
+
+	if full {
+		select {
+		case b.full <- struct{}{}:
+		default:
+			// A flush is already due
+		}
+	}
+}
+
+// run flushes the buffer when it fills up or the interval passes, until closed
+func (b *eventBatcher) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-b.full:
+		case <-ticker.C:
+		}
+		b.flush()
+	}
+}
+
+// flush publishes the buffered events. A failed batch is logged and dropped, since
+// nobody is waiting for its outcome
+func (b *eventBatcher) flush() {
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = make([]*Event, 0, b.size)
+	b.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+	if err := b.publisher.PublishBatch(context.Background(), batch); err != nil {
+		b.logger.WithError(err).WithField("batch_size", len(batch)).Error("Failed to publish event batch")
+		return
+	}
+	b.logger.WithField("batch_size", len(batch)).Debug("Event batch flushed")
+}
+
+// close stops the background flushing and publishes what is still buffered. Only the
+// first call has an effect
+func (b *eventBatcher) close() {
+	b.closeOnce.Do(func() {
+		close(b.stop)
+		<-b.done
+		b.flush()
+	})
+}
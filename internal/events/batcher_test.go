@@ -0,0 +1,134 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingPublisher records single events and batches separately, safe for use from
+// the batcher's goroutine
+type recordingPublisher struct {
+	mu      sync.Mutex
+	single  []*Event
+	batches [][]*Event
+	closed  bool
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, event *Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.single = append(p.single, event)
+	return nil
+}
+
+func (p *recordingPublisher) PublishBatch(_ context.Context, events []*Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.batches = append(p.batches, events)
+	return nil
+}
+
+func (p *recordingPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
+
+func (p *recordingPublisher) batchSizes() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sizes := make([]int, len(p.batches))
+	for i, batch := range p.batches {
+		sizes[i] = len(batch)
+	}
+	return sizes
+}
+
+func (p *recordingPublisher) singleTypes() []EventType {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	types := make([]EventType, len(p.single))
+	for i, event := range p.single {
+		types[i] = event.Type
+	}
+	return types
+}
+
+func TestEventService_Batching(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	ctx := context.Background()
+
+	t.Run("Full batch is flushed", func(t *testing.T) {
+		publisher := &recordingPublisher{}
+		service := NewEventService(publisher, logger)
+		service.SetBatching(3, time.Hour)
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, service.PublishBotMessageReceived(ctx, 12345, "testuser", 67890, i, "hello", ""))
+		}
+
+		assert.Eventually(t, func() bool { return len(publisher.batchSizes()) == 1 }, time.Second, time.Millisecond)
+		assert.Equal(t, []int{3}, publisher.batchSizes())
+		assert.Empty(t, publisher.singleTypes())
+		require.NoError(t, service.Close())
+	})
+
+	t.Run("Partial batch is flushed on the interval", func(t *testing.T) {
+		publisher := &recordingPublisher{}
+		service := NewEventService(publisher, logger)
+		service.SetBatching(100, 10*time.Millisecond)
+
+		require.NoError(t, service.PublishBotCallbackReceived(ctx, 12345, "testuser", 67890, 1, "account"))
+
+		assert.Eventually(t, func() bool { return len(publisher.batchSizes()) == 1 }, time.Second, time.Millisecond)
+		assert.Equal(t, []int{1}, publisher.batchSizes())
+		require.NoError(t, service.Close())
+	})
+
+	t.Run("User state events stay synchronous", func(t *testing.T) {
+		publisher := &recordingPublisher{}
+		service := NewEventService(publisher, logger)
+		service.SetBatching(100, time.Hour)
+
+		require.NoError(t, service.PublishUserRegistered(ctx, 12345, "testuser", "Test", "User", 1024))
+		require.NoError(t, service.PublishUserTrialActivated(ctx, 12345, "inactive", "trial"))
+		require.NoError(t, service.PublishUserQuotaUpdated(ctx, 12345, 0, 1024))
+
+		assert.Equal(t, []EventType{EventUserRegistered, EventUserTrialActivated, EventUserQuotaUpdated}, publisher.singleTypes())
+		assert.Empty(t, publisher.batchSizes())
+		require.NoError(t, service.Close())
+	})
+
+	t.Run("Close flushes buffered events", func(t *testing.T) {
+		publisher := &recordingPublisher{}
+		service := NewEventService(publisher, logger)
+		service.SetBatching(100, time.Hour)
+
+		require.NoError(t, service.PublishBotMessageReceived(ctx, 12345, "testuser", 67890, 1, "/start", "start"))
+		require.NoError(t, service.PublishBotCallbackReceived(ctx, 12345, "testuser", 67890, 2, "account"))
+		assert.Empty(t, publisher.batchSizes())
+
+		require.NoError(t, service.Close())
+		assert.Equal(t, []int{2}, publisher.batchSizes())
+		assert.True(t, publisher.closed)
+	})
+
+	t.Run("Batching can be turned off", func(t *testing.T) {
+		publisher := &recordingPublisher{}
+		service := NewEventService(publisher, logger)
+		service.SetBatching(0, time.Second)
+
+		require.NoError(t, service.PublishBotMessageReceived(ctx, 12345, "testuser", 67890, 1, "hello", ""))
+
+		assert.Equal(t, []EventType{EventBotMessageReceived}, publisher.singleTypes())
+		require.NoError(t, service.Close())
+	})
+}
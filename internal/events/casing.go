@@ -0,0 +1,83 @@
+package events
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// KeyCasing is the naming convention for keys in an event's Data payload.
+// Helpers build payloads in snake_case, which is also the casing of the event
+// envelope. Consumers that expect camelCase payload keys can opt into conversion
+type KeyCasing string
+
+const (
+	// KeyCasingSnake uses snake_case keys such as "telegram_id"
+	KeyCasingSnake KeyCasing = "snake"
+	// KeyCasingCamel uses camelCase keys such as "telegramId"
+	KeyCasingCamel KeyCasing = "camel"
+)
+
+var (
+	snakeKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+	camelKeyPattern = regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`)
+)
+
+// ParseKeyCasing parses a key casing name, defaulting to snake_case when empty
+func ParseKeyCasing(value string) (KeyCasing, error) {
+	switch KeyCasing(strings.ToLower(strings.TrimSpace(value))) {
+	case "", KeyCasingSnake:
+		return KeyCasingSnake, nil
+	case KeyCasingCamel:
+		return KeyCasingCamel, nil
+	}
+	return "", fmt.Errorf("invalid key casing: %s, must be 'snake' or 'camel'", value)
+}
+
+// ValidateDataKeys checks that every key in data, including nested maps, follows the casing
+func ValidateDataKeys(data map[string]interface{}, casing KeyCasing) error {
+	pattern := snakeKeyPattern
+	if casing == KeyCasingCamel {
+		pattern = camelKeyPattern
+	}
+
+	for key, value := range data {
+		if !pattern.MatchString(key) {
+			return fmt.Errorf("event data key %q is not %s case", key, casing)
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			if err := ValidateDataKeys(nested, casing); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ConvertDataKeys returns a copy of snake_case data with keys, including those of
+// nested maps, converted to the casing
+func ConvertDataKeys(data map[string]interface{}, casing KeyCasing) map[string]interface{} {
+	if data == nil || casing != KeyCasingCamel {
+		return data
+	}
+
+	converted := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		if nested, ok := value.(map[string]interface{}); ok {
+			value = ConvertDataKeys(nested, casing)
+		}
+		converted[snakeToCamel(key)] = value
+	}
+	return converted
+}
+
+// snakeToCamel converts a snake_case key to camelCase
+func snakeToCamel(key string) string {
+	parts := strings.Split(key, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
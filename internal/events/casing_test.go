@@ -0,0 +1,125 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// helperEvents builds one event with every helper
+func helperEvents() map[string]*Event {
+	return map[string]*Event{
+		"user registered":   NewUserRegisteredEvent(123, "testuser", "Test", "User", 52428800),
+		"trial activated":   NewUserTrialActivatedEvent(123, "inactive", "trial"),
+		"quota updated":     NewUserQuotaUpdatedEvent(123, 0, 1024),
+		"user deleted":      NewUserDeletedEvent(123, "trial", 1024),
+		"rate limited":      NewRateLimitedEvent(123, "command:/start"),
+		"message received":  NewBotMessageReceivedEvent(123, "testuser", 456, 1, "/start", "start"),
+		"callback received": NewBotCallbackReceivedEvent(123, "testuser", 456, 1, "trial"),
+	}
+}
+
+// serializedDataKeys serializes the event and returns the keys of its data object
+func serializedDataKeys(t *testing.T, event *Event) map[string]interface{} {
+	payload, err := event.ToJSON()
+	require.NoError(t, err)
+
+	var decoded struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(payload, &decoded))
+	return decoded.Data
+}
+
+func TestHelperEventsUseSnakeCaseKeys(t *testing.T) {
+	for name, event := range helperEvents() {
+		data := serializedDataKeys(t, event)
+		require.NotEmpty(t, data, name)
+		assert.NoError(t, ValidateDataKeys(data, KeyCasingSnake), name)
+		assert.Contains(t, data, "telegram_id", name)
+	}
+}
+
+func TestEventServiceKeyCasing(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	publisher := NewMockPublisher(logger)
+	service := NewEventService(publisher, logger)
+	service.SetKeyCasing(KeyCasingCamel)
+	ctx := context.Background()
+
+	require.NoError(t, service.PublishUserRegistered(ctx, 123, "testuser", "Test", "User", 52428800))
+	require.NoError(t, service.PublishUserQuotaUpdated(ctx, 123, 0, 1024))
+	require.NoError(t, service.PublishBotCallbackReceived(ctx, 123, "testuser", 456, 1, "trial"))
+	require.NoError(t, service.PublishSystemError(ctx, "database", "connection refused", nil))
+
+	for _, event := range publisher.GetPublishedEvents() {
+		data := serializedDataKeys(t, event)
+		assert.NoError(t, ValidateDataKeys(data, KeyCasingCamel), event.Type)
+		assert.NotContains(t, data, "telegram_id", event.Type)
+	}
+
+	published := publisher.GetPublishedEvents()
+	assert.Contains(t, published[0].Data, "telegramId")
+	assert.Contains(t, published[1].Data, "quotaDelta")
+	assert.Contains(t, published[2].Data, "callbackData")
+	assert.Contains(t, published[3].Data, "errorMessage")
+}
+
+func TestEventServiceRejectsInvalidDataKeys(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	publisher := NewMockPublisher(logger)
+	service := NewEventService(publisher, logger)
+
+	event := NewEvent(EventSystemError, nil, map[string]interface{}{"errorType": "database"})
+	err := service.publish(context.Background(), event)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "errorType")
+	assert.Empty(t, publisher.GetPublishedEvents())
+}
+
+func TestValidateDataKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string]interface{}
+		casing  KeyCasing
+		wantErr bool
+	}{
+		{"snake keys", map[string]interface{}{"telegram_id": 1, "quota_used": 2}, KeyCasingSnake, false},
+		{"camel key in snake data", map[string]interface{}{"telegramId": 1}, KeyCasingSnake, true},
+		{"nested camel key in snake data", map[string]interface{}{"details": map[string]interface{}{"chatId": 1}}, KeyCasingSnake, true},
+		{"camel keys", map[string]interface{}{"telegramId": 1, "action": "message"}, KeyCasingCamel, false},
+		{"snake key in camel data", map[string]interface{}{"telegram_id": 1}, KeyCasingCamel, true},
+		{"empty data", nil, KeyCasingSnake, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateDataKeys(tt.data, tt.casing)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestParseKeyCasing(t *testing.T) {
+	casing, err := ParseKeyCasing("")
+	require.NoError(t, err)
+	assert.Equal(t, KeyCasingSnake, casing)
+
+	casing, err = ParseKeyCasing("Camel")
+	require.NoError(t, err)
+	assert.Equal(t, KeyCasingCamel, casing)
+
+	_, err = ParseKeyCasing("kebab")
+	assert.Error(t, err)
+}
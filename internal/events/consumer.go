@@ -0,0 +1,275 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/sirupsen/logrus"
+)
+
+// consumerPollTimeout bounds how long the consumer blocks waiting for a message, and
+// so how long stopping it may take
+const consumerPollTimeout = 500 * time.Millisecond
+
+const (
+	// consumerMaxAttempts is how often a failing event is handled before it is
+	// dead-lettered
+	consumerMaxAttempts = 5
+	// consumerRetryBackoff is the wait before the first retry, doubled for each
+	// further one
+	consumerRetryBackoff = 500 * time.Millisecond
+)
+
+// ErrUnprocessableEvent marks handler failures retrying cannot fix, such as an event
+// missing required data. Such events are dead-lettered without retrying
+var ErrUnprocessableEvent = errors.New("unprocessable event")
+
+// EventHandler processes a consumed event
+type EventHandler func(ctx context.Context, event *Event) error
+
+// DeadLetterWriter saves events that could not be processed so they can be replayed
+type DeadLetterWriter interface {
+	DeadLetter(ctx context.Context, event *Event, reason error) error
+}
+
+// messageReader is the part of the Kafka consumer KafkaConsumer relies on
+type messageReader interface {
+	SubscribeTopics(topics []string, rebalanceCb kafka.RebalanceCb) error
+	ReadMessage(timeout time.Duration) (*kafka.Message, error)
+	CommitMessage(message *kafka.Message) ([]kafka.TopicPartition, error)
+	Close() error
+}
+
+// KafkaConsumer consumes events from Kafka and dispatches them to the handlers
+// registered for their type. Events the bot published itself are skipped. An event's
+// offset is committed once it was handled; failures are retried with backoff and then
+// dead-lettered, so an event is neither lost on a crash nor able to block the partition
+type KafkaConsumer struct {
+	reader       messageReader
+	topic        string
+	logger       *logrus.Logger
+	deadLetters  DeadLetterWriter
+	retryBackoff time.Duration
+
+	mu       sync.RWMutex
+	handlers map[EventType]EventHandler
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewKafkaConsumer creates a consumer of the events topic in the given consumer group
+func NewKafkaConsumer(config KafkaConfig, groupID string, logger *logrus.Logger) (*KafkaConsumer, error) {
+	consumer, err := kafka.NewConsumer(newConsumerConfig(config, groupID, "latest"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka consumer: %w", err)
+	}
+	return newKafkaConsumer(consumer, config.Topic, logger), nil
+}
+
+// newConsumerConfig returns the settings of a consumer in the given group starting
+// at offsetReset when the group has no committed offset yet
+func newConsumerConfig(config KafkaConfig, groupID, offsetReset string) *kafka.ConfigMap {
+	kafkaConfig := &kafka.ConfigMap{
+		"bootstrap.servers":  config.Brokers,
+		"client.id":          kafkaClientID,
+		"group.id":           groupID,
+		"auto.offset.reset":  offsetReset,
+		"enable.auto.commit": false,
+	}
+	if config.SecurityProtocol != "" {
+		_ = kafkaConfig.SetKey("security.protocol", config.SecurityProtocol)
+	}
+	if config.SaslMechanism != "" {
+		_ = kafkaConfig.SetKey("sasl.mechanism", config.SaslMechanism)
+		_ = kafkaConfig.SetKey("sasl.username", config.SaslUsername)
+		_ = kafkaConfig.SetKey("sasl.password", config.SaslPassword)
+	}
+	return kafkaConfig
+}
+
+// newKafkaConsumer creates a consumer reading messages of topic from reader
+func newKafkaConsumer(reader messageReader, topic string, logger *logrus.Logger) *KafkaConsumer {
+	return &KafkaConsumer{
+		reader:       reader,
+		topic:        topic,
+		logger:       logger,
+		retryBackoff: consumerRetryBackoff,
+		handlers:     make(map[EventType]EventHandler),
+	}
+}
+
+// SetDeadLetterWriter configures where events that keep failing are saved. Without
+// one they are logged and skipped
+func (c *KafkaConsumer) SetDeadLetterWriter(writer DeadLetterWriter) {
+	c.deadLetters = writer
+}
+
+// Handle registers the handler for events of the given type, replacing any previous one
+func (c *KafkaConsumer) Handle(eventType EventType, handler EventHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[eventType] = handler
+}
+
+// Start subscribes to the topic and consumes events until Stop is called
+func (c *KafkaConsumer) Start() error {
+	if err := c.reader.SubscribeTopics([]string{c.topic}, nil); err != nil {
+		return fmt.Errorf("failed to subscribe to topic %s: %w", c.topic, err)
+	}
+
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+	go c.run()
+	return nil
+}
+
+// Stop stops consuming and closes the consumer. An event being retried is left
+// uncommitted, so it is consumed again after a restart
+func (c *KafkaConsumer) Stop() error {
+	if c.stop != nil {
+		close(c.stop)
+		<-c.done
+		c.stop = nil
+	}
+	if err := c.reader.Close(); err != nil {
+		return fmt.Errorf("failed to close Kafka consumer: %w", err)
+	}
+	return nil
+}
+
+// run reads messages until stopped and commits the offset of each one handled
+func (c *KafkaConsumer) run() {
+	defer close(c.done)
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+
+		message, err := c.reader.ReadMessage(consumerPollTimeout)
+		if err != nil {
+			var kafkaErr kafka.Error
+			if errors.As(err, &kafkaErr) && kafkaErr.IsTimeout() {
+				continue
+			}
+			c.logger.WithError(err).Error("Failed to read event from Kafka")
+			continue
+		}
+
+		if !c.handle(message) {
+			return
+		}
+		if _, err := c.reader.CommitMessage(message); err != nil {
+			// The next commit covers this offset too
+			c.logger.WithError(err).WithFields(logrus.Fields{
+				"partition": message.TopicPartition.Partition,
+				"offset":    message.TopicPartition.Offset,
+			}).Warn("Failed to commit consumed event")
+		}
+	}
+}
+
+// handle dispatches the message, retrying failures with backoff, and dead-letters the
+// event once retrying cannot help. It returns false if the consumer was stopped
+// before the message was done with, so its offset must not be committed
+func (c *KafkaConsumer) handle(message *kafka.Message) bool {
+	fields := logrus.Fields{
+		"partition": message.TopicPartition.Partition,
+		"offset":    message.TopicPartition.Offset,
+	}
+
+	backoff := c.retryBackoff
+	for attempt := 1; ; attempt++ {
+		event, err := c.dispatch(context.Background(), message)
+		if err == nil {
+			return true
+		}
+		if event == nil {
+			// Malformed messages are not events, so there is nothing to replay
+			c.logger.WithError(err).WithFields(fields).Error("Skipping malformed event")
+			return true
+		}
+		if errors.Is(err, ErrUnprocessableEvent) || attempt >= consumerMaxAttempts {
+			c.deadLetter(event, err, fields)
+			return true
+		}
+
+		c.logger.WithError(err).WithFields(fields).WithField("attempt", attempt).Warn("Failed to handle consumed event, retrying")
+		select {
+		case <-c.stop:
+			return false
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// deadLetter saves an event that failed with err, or logs it as lost without a
+// dead-letter writer
+func (c *KafkaConsumer) deadLetter(event *Event, err error, fields logrus.Fields) {
+	entry := c.logger.WithFields(fields).WithFields(logrus.Fields{
+		"event_id":   event.ID,
+		"event_type": event.Type,
+	})
+	if c.deadLetters == nil {
+		entry.WithError(err).Error("Failed to handle consumed event, skipping it")
+		return
+	}
+
+	event.AddMetadata(DeadLetterStageKey, deadLetterStageConsume)
+	if dlqErr := c.deadLetters.DeadLetter(context.Background(), event, err); dlqErr != nil {
+		entry.WithError(dlqErr).Error("Failed to dead-letter consumed event, skipping it")
+		return
+	}
+	entry.WithError(err).Warn("Consumed event dead-lettered")
+}
+
+// dispatch decodes the message and hands the event to the handler registered for its
+// type. Events without a handler and events published by the bot itself are ignored,
+// unless the bot's consumer dead-lettered the event and it is being replayed. The
+// event is returned with the error, or nil if the message could not be decoded
+func (c *KafkaConsumer) dispatch(ctx context.Context, message *kafka.Message) (*Event, error) {
+	event, err := FromJSON(message.Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode event: %w", err)
+	}
+
+	if event.Metadata[DeadLetterStageKey] != deadLetterStageConsume {
+		for _, header := range message.Headers {
+			if header.Key == "source" && string(header.Value) == kafkaClientID {
+				return event, nil
+			}
+		}
+	}
+
+	c.mu.RLock()
+	handler, ok := c.handlers[event.Type]
+	c.mu.RUnlock()
+	if !ok {
+		c.logger.WithFields(logrus.Fields{
+			"event_id":   event.ID,
+			"event_type": event.Type,
+		}).Debug("Ignoring event without a handler")
+		return event, nil
+	}
+
+	if event.CorrelationID != nil {
+		ctx = WithCorrelationID(ctx, *event.CorrelationID)
+	}
+	if err := handler(ctx, event); err != nil {
+		return event, fmt.Errorf("failed to handle %s event %s: %w", event.Type, event.ID, err)
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"event_id":   event.ID,
+		"event_type": event.Type,
+	}).Debug("Event consumed")
+	return event, nil
+}
@@ -0,0 +1,303 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMessageReader serves queued messages and times out once they run out
+type fakeMessageReader struct {
+	messages   chan *kafka.Message
+	subscribed []string
+	closed     bool
+
+	mu        sync.Mutex
+	committed []*kafka.Message
+}
+
+func newFakeMessageReader(messages ...*kafka.Message) *fakeMessageReader {
+	reader := &fakeMessageReader{messages: make(chan *kafka.Message, len(messages))}
+	for _, message := range messages {
+		reader.messages <- message
+	}
+	return reader
+}
+
+func (r *fakeMessageReader) SubscribeTopics(topics []string, _ kafka.RebalanceCb) error {
+	r.subscribed = topics
+	return nil
+}
+
+func (r *fakeMessageReader) ReadMessage(timeout time.Duration) (*kafka.Message, error) {
+	select {
+	case message := <-r.messages:
+		return message, nil
+	case <-time.After(10 * time.Millisecond):
+		return nil, kafka.NewError(kafka.ErrTimedOut, "timed out", false)
+	}
+}
+
+func (r *fakeMessageReader) CommitMessage(message *kafka.Message) ([]kafka.TopicPartition, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.committed = append(r.committed, message)
+	return nil, nil
+}
+
+func (r *fakeMessageReader) committedMessages() []*kafka.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*kafka.Message(nil), r.committed...)
+}
+
+// fakeDeadLetterWriter records the events dead-lettered by the consumer
+type fakeDeadLetterWriter struct {
+	mu     sync.Mutex
+	events []*Event
+}
+
+func (w *fakeDeadLetterWriter) DeadLetter(_ context.Context, event *Event, reason error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	markDeadLettered(event, reason)
+	w.events = append(w.events, event)
+	return nil
+}
+
+func (w *fakeDeadLetterWriter) deadLettered() []*Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]*Event(nil), w.events...)
+}
+
+func (r *fakeMessageReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+func eventMessage(t *testing.T, event *Event, headers ...kafka.Header) *kafka.Message {
+	value, err := event.ToJSON()
+	require.NoError(t, err)
+	return &kafka.Message{Value: value, Headers: headers}
+}
+
+func TestKafkaConsumer_Dispatch(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	consumer := newKafkaConsumer(newFakeMessageReader(), "arcanus-events", logger)
+
+	var handled []*Event
+	consumer.Handle(EventUserQuotaUpdated, func(ctx context.Context, event *Event) error {
+		correlationID, _ := CorrelationIDFromContext(ctx)
+		assert.Equal(t, "request-1", correlationID)
+		handled = append(handled, event)
+		return nil
+	})
+
+	external := NewUserQuotaUpdatedEvent(123, 100, 500)
+	external.SetCorrelationID("request-1")
+
+	t.Run("Dispatches to the handler of the event type", func(t *testing.T) {
+		_, err := consumer.dispatch(context.Background(), eventMessage(t, external))
+		require.NoError(t, err)
+		require.Len(t, handled, 1)
+		assert.Equal(t, external.ID, handled[0].ID)
+	})
+
+	t.Run("Skips events published by the bot itself", func(t *testing.T) {
+		own := eventMessage(t, external, kafka.Header{Key: "source", Value: []byte(kafkaClientID)})
+		_, err := consumer.dispatch(context.Background(), own)
+		require.NoError(t, err)
+		assert.Len(t, handled, 1)
+	})
+
+	t.Run("Ignores events without a handler", func(t *testing.T) {
+		_, err := consumer.dispatch(context.Background(), eventMessage(t, NewEvent(EventUserDeleted, nil, nil)))
+		require.NoError(t, err)
+		assert.Len(t, handled, 1)
+	})
+
+	t.Run("Rejects malformed messages", func(t *testing.T) {
+		event, err := consumer.dispatch(context.Background(), &kafka.Message{Value: []byte("not json")})
+		assert.Error(t, err)
+		assert.Nil(t, event)
+	})
+
+	t.Run("Reports handler failures", func(t *testing.T) {
+		consumer.Handle(EventUserStatusChanged, func(context.Context, *Event) error {
+			return errors.New("database unavailable")
+		})
+		event, err := consumer.dispatch(context.Background(), eventMessage(t, NewEvent(EventUserStatusChanged, nil, nil)))
+		require.Error(t, err)
+		assert.NotNil(t, event)
+		assert.Contains(t, err.Error(), "database unavailable")
+	})
+}
+
+func TestKafkaConsumer_StartStop(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	first := NewUserQuotaUpdatedEvent(123, 0, 100)
+	second := NewUserQuotaUpdatedEvent(456, 0, 200)
+	reader := newFakeMessageReader(eventMessage(t, first), eventMessage(t, second))
+	consumer := newKafkaConsumer(reader, "arcanus-events", logger)
+
+	handled := make(chan string, 2)
+	consumer.Handle(EventUserQuotaUpdated, func(_ context.Context, event *Event) error {
+		handled <- event.ID
+		return nil
+	})
+
+	require.NoError(t, consumer.Start())
+	assert.Equal(t, []string{"arcanus-events"}, reader.subscribed)
+	for _, want := range []string{first.ID, second.ID} {
+		select {
+		case id := <-handled:
+			assert.Equal(t, want, id)
+		case <-time.After(time.Second):
+			t.Fatal("event was not consumed")
+		}
+	}
+
+	require.NoError(t, consumer.Stop())
+	assert.True(t, reader.closed)
+	assert.Len(t, reader.committedMessages(), 2, "handled events are committed")
+}
+
+func TestKafkaConsumer_Failures(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	t.Run("Retries failures and commits once handled", func(t *testing.T) {
+		reader := newFakeMessageReader()
+		consumer := newKafkaConsumer(reader, "arcanus-events", logger)
+		consumer.retryBackoff = time.Millisecond
+		attempts := 0
+		consumer.Handle(EventUserQuotaUpdated, func(context.Context, *Event) error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("database unavailable")
+			}
+			return nil
+		})
+
+		consumer.stop = make(chan struct{})
+		assert.True(t, consumer.handle(eventMessage(t, NewUserQuotaUpdatedEvent(123, 0, 100))))
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("Dead-letters events that keep failing", func(t *testing.T) {
+		consumer := newKafkaConsumer(newFakeMessageReader(), "arcanus-events", logger)
+		consumer.retryBackoff = time.Millisecond
+		writer := &fakeDeadLetterWriter{}
+		consumer.SetDeadLetterWriter(writer)
+		attempts := 0
+		consumer.Handle(EventUserQuotaUpdated, func(context.Context, *Event) error {
+			attempts++
+			return errors.New("database unavailable")
+		})
+
+		event := NewUserQuotaUpdatedEvent(123, 0, 100)
+		consumer.stop = make(chan struct{})
+		assert.True(t, consumer.handle(eventMessage(t, event)))
+		assert.Equal(t, consumerMaxAttempts, attempts)
+
+		deadLetters := writer.deadLettered()
+		require.Len(t, deadLetters, 1)
+		assert.Equal(t, event.ID, deadLetters[0].ID)
+		assert.Contains(t, deadLetters[0].Metadata[DeadLetterReasonKey], "database unavailable")
+		assert.Equal(t, deadLetterStageConsume, deadLetters[0].Metadata[DeadLetterStageKey])
+	})
+
+	t.Run("Dead-letters unprocessable events without retrying", func(t *testing.T) {
+		consumer := newKafkaConsumer(newFakeMessageReader(), "arcanus-events", logger)
+		writer := &fakeDeadLetterWriter{}
+		consumer.SetDeadLetterWriter(writer)
+		attempts := 0
+		consumer.Handle(EventUserQuotaUpdated, func(context.Context, *Event) error {
+			attempts++
+			return ErrUnprocessableEvent
+		})
+
+		consumer.stop = make(chan struct{})
+		assert.True(t, consumer.handle(eventMessage(t, NewUserQuotaUpdatedEvent(123, 0, 100))))
+		assert.Equal(t, 1, attempts)
+		assert.Len(t, writer.deadLettered(), 1)
+	})
+
+	t.Run("Leaves the event uncommitted when stopped while retrying", func(t *testing.T) {
+		reader := newFakeMessageReader(eventMessage(t, NewUserQuotaUpdatedEvent(123, 0, 100)))
+		consumer := newKafkaConsumer(reader, "arcanus-events", logger)
+		consumer.retryBackoff = time.Hour
+		failed := make(chan struct{}, 1)
+		consumer.Handle(EventUserQuotaUpdated, func(context.Context, *Event) error {
+			failed <- struct{}{}
+			return errors.New("database unavailable")
+		})
+
+		require.NoError(t, consumer.Start())
+		select {
+		case <-failed:
+		case <-time.After(time.Second):
+			t.Fatal("event was not consumed")
+		}
+		require.NoError(t, consumer.Stop())
+		assert.Empty(t, reader.committedMessages())
+	})
+
+	t.Run("Consumes replayed events it dead-lettered itself", func(t *testing.T) {
+		consumer := newKafkaConsumer(newFakeMessageReader(), "arcanus-events", logger)
+		handled := 0
+		consumer.Handle(EventUserQuotaUpdated, func(context.Context, *Event) error {
+			handled++
+			return nil
+		})
+
+		event := NewUserQuotaUpdatedEvent(123, 0, 100)
+		event.AddMetadata(DeadLetterStageKey, deadLetterStageConsume)
+		_, err := consumer.dispatch(context.Background(), eventMessage(t, event, kafka.Header{Key: "source", Value: []byte(kafkaClientID)}))
+		require.NoError(t, err)
+		assert.Equal(t, 1, handled)
+	})
+}
+
+func TestParseUserQuotaUpdated(t *testing.T) {
+	userID := int64(123)
+
+	t.Run("Round-trips a published event", func(t *testing.T) {
+		published, err := NewUserQuotaUpdatedEvent(userID, 100, 500).ToJSON()
+		require.NoError(t, err)
+		event, err := FromJSON(published)
+		require.NoError(t, err)
+
+		data, err := ParseUserQuotaUpdated(event)
+		require.NoError(t, err)
+		assert.Equal(t, UserQuotaUpdatedEventData{TelegramID: 123, PreviousQuota: 100, NewQuota: 500, QuotaDelta: 400}, data)
+	})
+
+	t.Run("Falls back to the event's user ID", func(t *testing.T) {
+		data, err := ParseUserQuotaUpdated(NewEvent(EventUserQuotaUpdated, &userID, map[string]interface{}{"newQuota": 500}))
+		require.NoError(t, err)
+		assert.Equal(t, int64(123), data.TelegramID)
+		assert.Equal(t, int64(500), data.NewQuota)
+	})
+
+	t.Run("Rejects other event types", func(t *testing.T) {
+		_, err := ParseUserQuotaUpdated(NewEvent(EventUserDeleted, &userID, nil))
+		assert.Error(t, err)
+	})
+
+	t.Run("Rejects fractional quotas", func(t *testing.T) {
+		_, err := ParseUserQuotaUpdated(NewEvent(EventUserQuotaUpdated, &userID, map[string]interface{}{"new_quota": 1.5}))
+		assert.Error(t, err)
+	})
+}
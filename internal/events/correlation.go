@@ -0,0 +1,33 @@
+package events
+
+import "context"
+
+// correlationIDKey is the context key holding the correlation ID of the current request
+type correlationIDKey struct{}
+
+// WithCorrelationID returns a context carrying the correlation ID. Events published
+// with the context are tagged with it
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, correlationID)
+}
+
+// CorrelationIDFromContext returns the correlation ID carried by the context, if any
+func CorrelationIDFromContext(ctx context.Context) (string, bool) {
+	correlationID, ok := ctx.Value(correlationIDKey{}).(string)
+	return correlationID, ok && correlationID != ""
+}
+
+// updateIDKey is the context key holding the ID of the Telegram update being handled
+type updateIDKey struct{}
+
+// WithUpdateID returns a context carrying the Telegram update ID. Events published
+// with the context get it as update_id metadata
+func WithUpdateID(ctx context.Context, updateID int) context.Context {
+	return context.WithValue(ctx, updateIDKey{}, updateID)
+}
+
+// UpdateIDFromContext returns the Telegram update ID carried by the context, if any
+func UpdateIDFromContext(ctx context.Context) (int, bool) {
+	updateID, ok := ctx.Value(updateIDKey{}).(int)
+	return updateID, ok && updateID != 0
+}
@@ -0,0 +1,221 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/sirupsen/logrus"
+)
+
+// DeadLetterReasonKey is the metadata key holding why a dead-lettered event failed delivery
+const DeadLetterReasonKey = "dead_letter_reason"
+
+// DeadLetterStageKey is the metadata key marking events the bot's own consumer failed
+// to handle, as opposed to events that failed delivery. Replayed, such events carry
+// the bot's source header but must be consumed again rather than skipped
+const DeadLetterStageKey = "dead_letter_stage"
+
+// deadLetterStageConsume is the DeadLetterStageKey of events that failed consuming
+const deadLetterStageConsume = "consume"
+
+// dlqReplayIdleTimeout is how long replaying waits for another dead letter before it
+// considers the topic drained
+const dlqReplayIdleTimeout = 5 * time.Second
+
+// markDeadLettered records on the event why its delivery failed
+func markDeadLettered(event *Event, err error) {
+	event.AddMetadata(DeadLetterReasonKey, err.Error())
+}
+
+// ReplayDLQ republishes the events of the dead-letter topic through publisher, in
+// the given consumer group so replayed events are not replayed again. It returns once
+// the topic is drained, with the number of events replayed
+func ReplayDLQ(ctx context.Context, config KafkaConfig, groupID string, publisher Publisher, logger *logrus.Logger) (int, error) {
+	if config.DLQTopic == "" {
+		return 0, fmt.Errorf("no dead-letter topic configured")
+	}
+
+	consumer, err := kafka.NewConsumer(newConsumerConfig(config, groupID, "earliest"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create Kafka consumer: %w", err)
+	}
+	defer consumer.Close()
+
+	return replayDLQ(ctx, consumer, config.DLQTopic, publisher, dlqReplayIdleTimeout, logger)
+}
+
+// replayDLQ republishes the events read from the dead-letter topic until none arrive
+// for idle, committing each one once it is replayed. Replaying stops at the first
+// event that fails to publish again; a publisher with a dead-letter topic has
+// dead-lettered it once more by then
+func replayDLQ(ctx context.Context, reader messageReader, topic string, publisher Publisher, idle time.Duration, logger *logrus.Logger) (int, error) {
+	if err := reader.SubscribeTopics([]string{topic}, nil); err != nil {
+		return 0, fmt.Errorf("failed to subscribe to topic %s: %w", topic, err)
+	}
+
+	replayed := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return replayed, err
+		}
+
+		message, err := reader.ReadMessage(idle)
+		if err != nil {
+			var kafkaErr kafka.Error
+			if errors.As(err, &kafkaErr) && kafkaErr.IsTimeout() {
+				return replayed, nil
+			}
+			return replayed, fmt.Errorf("failed to read dead letter: %w", err)
+		}
+
+		event, err := FromJSON(message.Value)
+		if err != nil {
+			logger.WithError(err).WithField("offset", message.TopicPartition.Offset).Error("Skipping malformed dead letter")
+			commitReplayed(reader, message, logger)
+			continue
+		}
+		reason := event.Metadata[DeadLetterReasonKey]
+		delete(event.Metadata, DeadLetterReasonKey)
+		if err := publisher.Publish(ctx, event); err != nil {
+			return replayed, fmt.Errorf("failed to replay event %s: %w", event.ID, err)
+		}
+
+		logger.WithFields(logrus.Fields{
+			"event_id":   event.ID,
+			"event_type": event.Type,
+			"reason":     reason,
+		}).Info("Dead-lettered event replayed")
+		commitReplayed(reader, message, logger)
+		replayed++
+	}
+}
+
+// commitReplayed commits the offset of a dead letter done with, so the next replay
+// starts after it
+func commitReplayed(reader messageReader, message *kafka.Message, logger *logrus.Logger) {
+	if _, err := reader.CommitMessage(message); err != nil {
+		logger.WithError(err).WithField("offset", message.TopicPartition.Offset).Warn("Failed to commit replayed dead letter")
+	}
+}
+
+// deadLetterFile appends dead letters to a local file, one JSON event per line, for
+// when the dead-letter topic cannot be written. The file is opened for each event, so
+// replaying can move it aside while the bot keeps appending
+type deadLetterFile struct {
+	path string
+	mu   sync.Mutex
+}
+
+// append writes the event to the end of the file and syncs it to disk
+func (f *deadLetterFile) append(event *Event) error {
+	data, err := event.ToJSON()
+	if err != nil {
+		return fmt.Errorf("failed to serialize dead letter: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open dead-letter file: %w", err)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to write dead-letter file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to sync dead-letter file: %w", err)
+	}
+	return file.Close()
+}
+
+// ReplayDLQFile republishes the events of the dead-letter file through publisher and
+// returns the number of events replayed. The file is moved aside to path.replaying
+// first, so events dead-lettered meanwhile wait for the next run. Replaying stops at
+// the first event that fails to publish again; it and the events after it are
+// appended back to the file
+func ReplayDLQFile(ctx context.Context, path string, publisher Publisher, logger *logrus.Logger) (int, error) {
+	replaying := path + ".replaying"
+	// A replay that crashed left its file behind, which is finished first
+	if _, err := os.Stat(replaying); errors.Is(err, os.ErrNotExist) {
+		if err := os.Rename(path, replaying); errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		} else if err != nil {
+			return 0, fmt.Errorf("failed to move dead-letter file aside: %w", err)
+		}
+	}
+
+	data, err := os.ReadFile(replaying)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read dead-letter file: %w", err)
+	}
+
+	replayed := 0
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return replayed, keepDeadLetters(path, replaying, lines[i:], err)
+		}
+
+		event, err := FromJSON(line)
+		if err != nil {
+			logger.WithError(err).WithField("line", i+1).Error("Skipping malformed dead letter")
+			continue
+		}
+		reason := event.Metadata[DeadLetterReasonKey]
+		delete(event.Metadata, DeadLetterReasonKey)
+		if err := publisher.Publish(ctx, event); err != nil {
+			return replayed, keepDeadLetters(path, replaying, lines[i:], fmt.Errorf("failed to replay event %s: %w", event.ID, err))
+		}
+
+		logger.WithFields(logrus.Fields{
+			"event_id":   event.ID,
+			"event_type": event.Type,
+			"reason":     reason,
+		}).Info("Dead-lettered event replayed")
+		replayed++
+	}
+
+	if err := os.Remove(replaying); err != nil {
+		return replayed, fmt.Errorf("failed to remove replayed dead-letter file: %w", err)
+	}
+	return replayed, nil
+}
+
+// keepDeadLetters appends the lines not replayed back to the dead-letter file, removes
+// the file being replayed and returns cause
+func keepDeadLetters(path, replaying string, lines [][]byte, cause error) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("%w; keeping the rest failed: %v", cause, err)
+	}
+	writer := bufio.NewWriter(file)
+	for _, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		_, _ = writer.Write(line)
+		_ = writer.WriteByte('\n')
+	}
+	if err := writer.Flush(); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("%w; keeping the rest failed: %v", cause, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("%w; keeping the rest failed: %v", cause, err)
+	}
+	_ = os.Remove(replaying)
+	return cause
+}
@@ -0,0 +1,172 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockPublisher_DeadLetterQueue(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	publisher := NewMockPublisher(logger)
+	publisher.SetShouldError(true)
+	ctx := context.Background()
+
+	// Without a dead-letter queue failed events are lost
+	require.Error(t, publisher.Publish(ctx, NewUserDeletedEvent(1, "active", 0)))
+	assert.Empty(t, publisher.GetDeadLetteredEvents())
+
+	publisher.SetDeadLetterQueue(true)
+	event := NewUserQuotaUpdatedEvent(123, 0, 100)
+	require.Error(t, publisher.Publish(ctx, event))
+
+	deadLetters := publisher.GetDeadLetteredEvents()
+	require.Len(t, deadLetters, 1)
+	assert.Equal(t, event.ID, deadLetters[0].ID)
+	assert.Equal(t, "mock error", deadLetters[0].Metadata[DeadLetterReasonKey])
+	assert.Empty(t, publisher.GetPublishedEvents())
+}
+
+func TestReplayDLQ(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	ctx := context.Background()
+
+	// Route two events to the dead letters, as a failing broker would
+	failing := NewMockPublisher(logger)
+	failing.SetShouldError(true)
+	failing.SetDeadLetterQueue(true)
+	first := NewUserQuotaUpdatedEvent(123, 0, 100)
+	second := NewUserDeletedEvent(456, "active", 0)
+	require.Error(t, failing.Publish(ctx, first))
+	require.Error(t, failing.Publish(ctx, second))
+
+	var messages []*kafka.Message
+	for _, event := range failing.GetDeadLetteredEvents() {
+		messages = append(messages, eventMessage(t, event))
+	}
+	messages = append(messages[:1], append([]*kafka.Message{{Value: []byte("not json")}}, messages[1:]...)...)
+
+	t.Run("Republishes dead letters until the topic is drained", func(t *testing.T) {
+		reader := newFakeMessageReader(messages...)
+		publisher := NewMockPublisher(logger)
+
+		replayed, err := replayDLQ(ctx, reader, "arcanus-events-dlq", publisher, 0, logger)
+		require.NoError(t, err)
+		assert.Equal(t, 2, replayed, "malformed dead letters are skipped")
+		assert.Equal(t, []string{"arcanus-events-dlq"}, reader.subscribed)
+
+		published := publisher.GetPublishedEvents()
+		require.Len(t, published, 2)
+		assert.Equal(t, first.ID, published[0].ID)
+		assert.Equal(t, second.ID, published[1].ID)
+		assert.NotContains(t, published[0].Metadata, DeadLetterReasonKey, "the failure reason is not republished")
+		assert.Len(t, reader.committedMessages(), 3, "replayed and malformed dead letters are committed")
+	})
+
+	t.Run("Stops at the first event that fails again", func(t *testing.T) {
+		publisher := NewMockPublisher(logger)
+		publisher.SetShouldError(true)
+
+		replayed, err := replayDLQ(ctx, newFakeMessageReader(messages...), "arcanus-events-dlq", publisher, 0, logger)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), first.ID)
+		assert.Zero(t, replayed)
+	})
+
+	t.Run("Reports read failures", func(t *testing.T) {
+		reader := &erroringMessageReader{err: kafka.NewError(kafka.ErrAllBrokersDown, "all brokers down", true)}
+
+		_, err := replayDLQ(ctx, reader, "arcanus-events-dlq", NewMockPublisher(logger), 0, logger)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "all brokers down")
+	})
+}
+
+// erroringMessageReader fails every read with err
+type erroringMessageReader struct {
+	fakeMessageReader
+	err error
+}
+
+func (r *erroringMessageReader) ReadMessage(time.Duration) (*kafka.Message, error) {
+	return nil, r.err
+}
+
+func TestReplayDLQ_RequiresTopic(t *testing.T) {
+	_, err := ReplayDLQ(context.Background(), KafkaConfig{Brokers: "localhost:9092"}, "replay", NewMockPublisher(logrus.New()), logrus.New())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no dead-letter topic")
+}
+
+func TestReplayDLQFile(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	ctx := context.Background()
+
+	first := NewUserQuotaUpdatedEvent(123, 0, 100)
+	second := NewUserDeletedEvent(456, "active", 0)
+	writeDeadLetters := func(t *testing.T) string {
+		path := filepath.Join(t.TempDir(), "dlq.jsonl")
+		file := &deadLetterFile{path: path}
+		markDeadLettered(first, errors.New("all brokers down"))
+		require.NoError(t, file.append(first))
+		require.NoError(t, os.WriteFile(path, append(readFile(t, path), []byte("not json\n")...), 0o600))
+		require.NoError(t, file.append(second))
+		return path
+	}
+
+	t.Run("Republishes dead letters and removes the file", func(t *testing.T) {
+		path := writeDeadLetters(t)
+		publisher := NewMockPublisher(logger)
+
+		replayed, err := ReplayDLQFile(ctx, path, publisher, logger)
+		require.NoError(t, err)
+		assert.Equal(t, 2, replayed, "malformed dead letters are skipped")
+
+		published := publisher.GetPublishedEvents()
+		require.Len(t, published, 2)
+		assert.Equal(t, first.ID, published[0].ID)
+		assert.Equal(t, second.ID, published[1].ID)
+		assert.NotContains(t, published[0].Metadata, DeadLetterReasonKey, "the failure reason is not republished")
+		assert.NoFileExists(t, path)
+		assert.NoFileExists(t, path+".replaying")
+	})
+
+	t.Run("Keeps the events not replayed", func(t *testing.T) {
+		path := writeDeadLetters(t)
+		publisher := NewMockPublisher(logger)
+		publisher.SetShouldError(true)
+
+		replayed, err := ReplayDLQFile(ctx, path, publisher, logger)
+		require.Error(t, err)
+		assert.Zero(t, replayed)
+
+		assert.Equal(t, 3, strings.Count(string(readFile(t, path)), "\n"))
+		assert.NoFileExists(t, path+".replaying")
+	})
+
+	t.Run("Does nothing without a file", func(t *testing.T) {
+		replayed, err := ReplayDLQFile(ctx, filepath.Join(t.TempDir(), "dlq.jsonl"), NewMockPublisher(logger), logger)
+		require.NoError(t, err)
+		assert.Zero(t, replayed)
+	})
+}
+
+// readFile returns the contents of the file at path
+func readFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return data
+}
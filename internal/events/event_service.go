@@ -3,14 +3,25 @@ package events
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/utils"
 )
 
+// LatencyRecorder records how long publishing an event of the given type took
+type LatencyRecorder func(eventType string, duration time.Duration)
+
 // Service handles event publishing with business logic
 type Service struct {
 	publisher Publisher
 	logger    *logrus.Logger
+	keyCasing KeyCasing
+	disabled  bool
+	latency   LatencyRecorder
+	ids       utils.IDGenerator
+	batcher   *eventBatcher
 }
 
 // NewEventService creates a new event service
@@ -18,14 +29,82 @@ func NewEventService(publisher Publisher, logger *logrus.Logger) *Service {
 	return &Service{
 		publisher: publisher,
 		logger:    logger,
+		keyCasing: KeyCasingSnake,
+	}
+}
+
+// NewDisabledEventService creates an event service whose methods are no-ops.
+// Unlike the mock publisher it builds no events and logs nothing
+func NewDisabledEventService() *Service {
+	return &Service{disabled: true}
+}
+
+// SetKeyCasing configures the casing of keys in published event data
+func (s *Service) SetKeyCasing(casing KeyCasing) {
+	s.keyCasing = casing
+}
+
+// SetLatencyRecorder configures where the publish latency of each event is recorded
+func (s *Service) SetLatencyRecorder(recorder LatencyRecorder) {
+	s.latency = recorder
+}
+
+// SetBatching makes the service buffer low-priority events, such as received
+// messages and callbacks, and publish them in batches of up to size events at least
+// every interval. Other events are still published right away. A size below 2
+// publishes every event right away
+func (s *Service) SetBatching(size int, interval time.Duration) {
+	if s.disabled || size < 2 {
+		return
 	}
+	s.batcher = newEventBatcher(s.publisher, s.logger, size, interval)
+}
+
+// SetIDGenerator configures how the IDs of published events are minted. Without
+// one events keep the random UUID they were created with
+func (s *Service) SetIDGenerator(ids utils.IDGenerator) {
+	s.ids = ids
+}
+
+// publish applies the configured data key casing, rejects events whose data keys
+// do not follow it, tags the event with the context's correlation ID and update ID
+// and hands the event to the publisher, or to the batcher for low-priority events. Its
+// latency is recorded whether or not publishing succeeds
+func (s *Service) publish(ctx context.Context, event *Event) error {
+	if s.latency != nil {
+		start := time.Now()
+		defer func() { s.latency(string(event.Type), time.Since(start)) }()
+	}
+
+	if s.ids != nil {
+		event.ID = s.ids.NewID()
+	}
+	if correlationID, ok := CorrelationIDFromContext(ctx); ok && event.CorrelationID == nil {
+		event.SetCorrelationID(correlationID)
+	}
+	if updateID, ok := UpdateIDFromContext(ctx); ok {
+		event.AddMetadata("update_id", strconv.Itoa(updateID))
+	}
+	event.Data = ConvertDataKeys(event.Data, s.keyCasing)
+	if err := ValidateDataKeys(event.Data, s.keyCasing); err != nil {
+		return fmt.Errorf("invalid event data: %w", err)
+	}
+	if s.batcher != nil && batchedEventTypes[event.Type] {
+		s.batcher.add(event)
+		return nil
+	}
+	return s.publisher.Publish(ctx, event)
 }
 
 // PublishUserRegistered publishes a user registration event
 func (s *Service) PublishUserRegistered(ctx context.Context, userID int64, username, firstName, lastName string, quotaLimit int64) error {
+	if s.disabled {
+		return nil
+	}
+
 	event := NewUserRegisteredEvent(userID, username, firstName, lastName, quotaLimit)
 	
-	if err := s.publisher.Publish(ctx, event); err != nil {
+	if err := s.publish(ctx, event); err != nil {
 		s.logger.WithError(err).WithFields(logrus.Fields{
 			"event_type": event.Type,
 			"user_id":    userID,
@@ -45,9 +124,13 @@ func (s *Service) PublishUserRegistered(ctx context.Context, userID int64, usern
 
 // PublishUserTrialActivated publishes a trial activation event
 func (s *Service) PublishUserTrialActivated(ctx context.Context, userID int64, previousStatus, newStatus string) error {
+	if s.disabled {
+		return nil
+	}
+
 	event := NewUserTrialActivatedEvent(userID, previousStatus, newStatus)
 	
-	if err := s.publisher.Publish(ctx, event); err != nil {
+	if err := s.publish(ctx, event); err != nil {
 		s.logger.WithError(err).WithFields(logrus.Fields{
 			"event_type": event.Type,
 			"user_id":    userID,
@@ -68,9 +151,13 @@ func (s *Service) PublishUserTrialActivated(ctx context.Context, userID int64, p
 
 // PublishUserQuotaUpdated publishes a quota update event
 func (s *Service) PublishUserQuotaUpdated(ctx context.Context, userID int64, previousQuota, newQuota int64) error {
+	if s.disabled {
+		return nil
+	}
+
 	event := NewUserQuotaUpdatedEvent(userID, previousQuota, newQuota)
 	
-	if err := s.publisher.Publish(ctx, event); err != nil {
+	if err := s.publish(ctx, event); err != nil {
 		s.logger.WithError(err).WithFields(logrus.Fields{
 			"event_type": event.Type,
 			"user_id":    userID,
@@ -90,11 +177,195 @@ func (s *Service) PublishUserQuotaUpdated(ctx context.Context, userID int64, pre
 	return nil
 }
 
+// PublishUserDeleted publishes a user deletion event
+func (s *Service) PublishUserDeleted(ctx context.Context, userID int64, status string, quotaUsed int64) error {
+	if s.disabled {
+		return nil
+	}
+
+	event := NewUserDeletedEvent(userID, status, quotaUsed)
+	
+	if err := s.publish(ctx, event); err != nil {
+		s.logger.WithError(err).WithFields(logrus.Fields{
+			"event_type": event.Type,
+			"user_id":    userID,
+		}).Error("Failed to publish user deleted event")
+		return fmt.Errorf("failed to publish user deleted event: %w", err)
+	}
+	
+	s.logger.WithFields(logrus.Fields{
+		"event_id":   event.ID,
+		"event_type": event.Type,
+		"user_id":    userID,
+	}).Info("User deleted event published")
+	
+	return nil
+}
+
+// PublishUserStatusChanged publishes a user status transition event
+func (s *Service) PublishUserStatusChanged(ctx context.Context, userID int64, from, to string) error {
+	if s.disabled {
+		return nil
+	}
+
+	event := NewUserStatusChangedEvent(userID, from, to)
+
+	if err := s.publish(ctx, event); err != nil {
+		s.logger.WithError(err).WithFields(logrus.Fields{
+			"event_type": event.Type,
+			"user_id":    userID,
+		}).Error("Failed to publish user status changed event")
+		return fmt.Errorf("failed to publish user status changed event: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"event_id":        event.ID,
+		"event_type":      event.Type,
+		"user_id":         userID,
+		"previous_status": from,
+		"new_status":      to,
+	}).Info("User status changed event published")
+
+	return nil
+}
+
+// PublishUserPlanExpired publishes a plan expiry event
+func (s *Service) PublishUserPlanExpired(ctx context.Context, userID int64, planName string, quotaLimit int64, expiredAt time.Time) error {
+	if s.disabled {
+		return nil
+	}
+
+	event := NewUserPlanExpiredEvent(userID, planName, quotaLimit, expiredAt)
+
+	if err := s.publish(ctx, event); err != nil {
+		s.logger.WithError(err).WithFields(logrus.Fields{
+			"event_type": event.Type,
+			"user_id":    userID,
+		}).Error("Failed to publish user plan expired event")
+		return fmt.Errorf("failed to publish user plan expired event: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"event_id":   event.ID,
+		"event_type": event.Type,
+		"user_id":    userID,
+		"plan_name":  planName,
+	}).Info("User plan expired event published")
+
+	return nil
+}
+
+// PublishUserAnonymized publishes a retention anonymization event
+func (s *Service) PublishUserAnonymized(ctx context.Context, userID int64, inactiveSince time.Time) error {
+	if s.disabled {
+		return nil
+	}
+
+	event := NewUserAnonymizedEvent(userID, inactiveSince)
+
+	if err := s.publish(ctx, event); err != nil {
+		s.logger.WithError(err).WithFields(logrus.Fields{
+			"event_type": event.Type,
+			"user_id":    userID,
+		}).Error("Failed to publish user anonymized event")
+		return fmt.Errorf("failed to publish user anonymized event: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"event_id":   event.ID,
+		"event_type": event.Type,
+		"user_id":    userID,
+	}).Info("User anonymized event published")
+
+	return nil
+}
+
+// PublishUserReferred publishes a referral event
+func (s *Service) PublishUserReferred(ctx context.Context, userID, referrerID, bonusBytes int64) error {
+	if s.disabled {
+		return nil
+	}
+
+	event := NewUserReferredEvent(userID, referrerID, bonusBytes)
+
+	if err := s.publish(ctx, event); err != nil {
+		s.logger.WithError(err).WithFields(logrus.Fields{
+			"event_type": event.Type,
+			"user_id":    userID,
+		}).Error("Failed to publish user referred event")
+		return fmt.Errorf("failed to publish user referred event: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"event_id":    event.ID,
+		"event_type":  event.Type,
+		"user_id":     userID,
+		"referrer_id": referrerID,
+	}).Info("User referred event published")
+
+	return nil
+}
+
+// PublishUserQuotaThresholdReached publishes a quota usage alert threshold event
+func (s *Service) PublishUserQuotaThresholdReached(ctx context.Context, userID int64, thresholdPct int, quotaUsed, quotaLimit int64) error {
+	if s.disabled {
+		return nil
+	}
+
+	event := NewUserQuotaThresholdReachedEvent(userID, thresholdPct, quotaUsed, quotaLimit)
+
+	if err := s.publish(ctx, event); err != nil {
+		s.logger.WithError(err).WithFields(logrus.Fields{
+			"event_type": event.Type,
+			"user_id":    userID,
+		}).Error("Failed to publish user quota threshold reached event")
+		return fmt.Errorf("failed to publish user quota threshold reached event: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"event_id":      event.ID,
+		"event_type":    event.Type,
+		"user_id":       userID,
+		"threshold_pct": thresholdPct,
+	}).Info("User quota threshold reached event published")
+
+	return nil
+}
+
+// PublishUserConfigRevoked publishes a revoked VPN config event
+func (s *Service) PublishUserConfigRevoked(ctx context.Context, userID int64, publicKey string) error {
+	if s.disabled {
+		return nil
+	}
+
+	event := NewUserConfigRevokedEvent(userID, publicKey)
+
+	if err := s.publish(ctx, event); err != nil {
+		s.logger.WithError(err).WithFields(logrus.Fields{
+			"event_type": event.Type,
+			"user_id":    userID,
+		}).Error("Failed to publish user config revoked event")
+		return fmt.Errorf("failed to publish user config revoked event: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"event_id":   event.ID,
+		"event_type": event.Type,
+		"user_id":    userID,
+	}).Info("User config revoked event published")
+
+	return nil
+}
+
 // PublishBotMessageReceived publishes a bot message received event
 func (s *Service) PublishBotMessageReceived(ctx context.Context, userID int64, username string, chatID int64, messageID int, text, command string) error {
+	if s.disabled {
+		return nil
+	}
+
 	event := NewBotMessageReceivedEvent(userID, username, chatID, messageID, text, command)
 	
-	if err := s.publisher.Publish(ctx, event); err != nil {
+	if err := s.publish(ctx, event); err != nil {
 		s.logger.WithError(err).WithFields(logrus.Fields{
 			"event_type": event.Type,
 			"user_id":    userID,
@@ -115,9 +386,13 @@ func (s *Service) PublishBotMessageReceived(ctx context.Context, userID int64, u
 
 // PublishBotCallbackReceived publishes a bot callback received event  
 func (s *Service) PublishBotCallbackReceived(ctx context.Context, userID int64, username string, chatID int64, messageID int, callbackData string) error {
+	if s.disabled {
+		return nil
+	}
+
 	event := NewBotCallbackReceivedEvent(userID, username, chatID, messageID, callbackData)
 	
-	if err := s.publisher.Publish(ctx, event); err != nil {
+	if err := s.publish(ctx, event); err != nil {
 		s.logger.WithError(err).WithFields(logrus.Fields{
 			"event_type": event.Type,
 			"user_id":    userID,
@@ -136,8 +411,65 @@ func (s *Service) PublishBotCallbackReceived(ctx context.Context, userID int64,
 	return nil
 }
 
+// PublishBotCommandExecuted publishes an event for a handled command with how long it
+// took and whether its handler failed
+func (s *Service) PublishBotCommandExecuted(ctx context.Context, userID, chatID int64, command string, duration time.Duration, commandErr error) error {
+	if s.disabled {
+		return nil
+	}
+
+	event := NewBotCommandExecutedEvent(userID, chatID, command, duration, commandErr)
+
+	if err := s.publish(ctx, event); err != nil {
+		s.logger.WithError(err).WithFields(logrus.Fields{
+			"event_type": event.Type,
+			"user_id":    userID,
+		}).Error("Failed to publish bot command executed event")
+		return fmt.Errorf("failed to publish bot command executed event: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"event_id":   event.ID,
+		"event_type": event.Type,
+		"user_id":    userID,
+		"command":    command,
+	}).Debug("Bot command executed event published")
+
+	return nil
+}
+
+// PublishRateLimited publishes an event for a request blocked by the rate limiter
+func (s *Service) PublishRateLimited(ctx context.Context, userID int64, action string) error {
+	if s.disabled {
+		return nil
+	}
+
+	event := NewRateLimitedEvent(userID, action)
+
+	if err := s.publish(ctx, event); err != nil {
+		s.logger.WithError(err).WithFields(logrus.Fields{
+			"event_type": event.Type,
+			"user_id":    userID,
+		}).Error("Failed to publish rate limited event")
+		return fmt.Errorf("failed to publish rate limited event: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"event_id":   event.ID,
+		"event_type": event.Type,
+		"user_id":    userID,
+		"action":     action,
+	}).Debug("Rate limited event published")
+
+	return nil
+}
+
 // PublishSystemError publishes a system error event
 func (s *Service) PublishSystemError(ctx context.Context, errorType, errorMessage string, metadata map[string]string) error {
+	if s.disabled {
+		return nil
+	}
+
 	data := map[string]interface{}{
 		"error_type":    errorType,
 		"error_message": errorMessage,
@@ -148,7 +480,7 @@ func (s *Service) PublishSystemError(ctx context.Context, errorType, errorMessag
 		event.AddMetadata(k, v)
 	}
 	
-	if err := s.publisher.Publish(ctx, event); err != nil {
+	if err := s.publish(ctx, event); err != nil {
 		s.logger.WithError(err).WithField("event_type", event.Type).Error("Failed to publish system error event")
 		return fmt.Errorf("failed to publish system error event: %w", err)
 	}
@@ -165,6 +497,10 @@ func (s *Service) PublishSystemError(ctx context.Context, errorType, errorMessag
 
 // PublishSystemStartup publishes a system startup event
 func (s *Service) PublishSystemStartup(ctx context.Context, version string, metadata map[string]string) error {
+	if s.disabled {
+		return nil
+	}
+
 	data := map[string]interface{}{
 		"version": version,
 	}
@@ -174,7 +510,7 @@ func (s *Service) PublishSystemStartup(ctx context.Context, version string, meta
 		event.AddMetadata(k, v)
 	}
 	
-	if err := s.publisher.Publish(ctx, event); err != nil {
+	if err := s.publish(ctx, event); err != nil {
 		s.logger.WithError(err).WithField("event_type", event.Type).Error("Failed to publish system startup event")
 		return fmt.Errorf("failed to publish system startup event: %w", err)
 	}
@@ -190,6 +526,10 @@ func (s *Service) PublishSystemStartup(ctx context.Context, version string, meta
 
 // PublishSystemShutdown publishes a system shutdown event
 func (s *Service) PublishSystemShutdown(ctx context.Context, reason string, metadata map[string]string) error {
+	if s.disabled {
+		return nil
+	}
+
 	data := map[string]interface{}{
 		"reason": reason,
 	}
@@ -199,7 +539,7 @@ func (s *Service) PublishSystemShutdown(ctx context.Context, reason string, meta
 		event.AddMetadata(k, v)
 	}
 	
-	if err := s.publisher.Publish(ctx, event); err != nil {
+	if err := s.publish(ctx, event); err != nil {
 		s.logger.WithError(err).WithField("event_type", event.Type).Error("Failed to publish system shutdown event")
 		return fmt.Errorf("failed to publish system shutdown event: %w", err)
 	}
@@ -213,7 +553,13 @@ func (s *Service) PublishSystemShutdown(ctx context.Context, reason string, meta
 	return nil
 }
 
-// Close closes the underlying publisher
+// Close publishes the events still buffered and closes the underlying publisher
 func (s *Service) Close() error {
+	if s.disabled {
+		return nil
+	}
+	if s.batcher != nil {
+		s.batcher.close()
+	}
 	return s.publisher.Close()
 }
\ No newline at end of file
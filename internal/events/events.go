@@ -2,7 +2,10 @@ package events
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/utils"
 )
 
 // EventType represents the type of event that occurred
@@ -14,6 +17,12 @@ const (
 	EventUserTrialActivated EventType = "user.trial_activated"
 	EventUserQuotaUpdated   EventType = "user.quota_updated"
 	EventUserStatusChanged  EventType = "user.status_changed"
+	EventUserDeleted        EventType = "user.deleted"
+	EventUserPlanExpired    EventType = "user.plan_expired"
+	EventUserAnonymized     EventType = "user.anonymized"
+	EventUserReferred       EventType = "user.referred"
+	EventUserQuotaThresholdReached EventType = "user.quota_threshold_reached"
+	EventUserConfigRevoked  EventType = "user.config_revoked"
 	
 	// Bot Events
 	EventBotMessageReceived EventType = "bot.message_received"
@@ -24,6 +33,8 @@ const (
 	EventSystemError        EventType = "system.error"
 	EventSystemStartup      EventType = "system.startup"
 	EventSystemShutdown     EventType = "system.shutdown"
+	EventSystemRateLimited  EventType = "system.rate_limited"
+	EventSystemSelfTest     EventType = "system.self_test"
 )
 
 // Event represents a domain event in the system
@@ -49,7 +60,7 @@ func NewEvent(eventType EventType, userID *int64, data map[string]interface{}) *
 	return &Event{
 		ID:        generateEventID(),
 		Type:      eventType,
-		Version:   "1.0",
+		Version:   SchemaVersion,
 		Timestamp: time.Now().UTC(),
 		UserID:    userID,
 		Data:      data,
@@ -62,11 +73,30 @@ func (e *Event) ToJSON() ([]byte, error) {
 	return json.Marshal(e)
 }
 
-// FromJSON deserializes an event from JSON
+// FromJSON deserializes an event from JSON. Events of an older version are upgraded
+// to the current shape, and events without a version are taken to be current. Events
+// of versions that cannot be upgraded, such as newer ones, return ErrUnsupportedVersion
 func FromJSON(data []byte) (*Event, error) {
+	// Older payloads may not fit Event, so the version is read on its own first
+	var envelope struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	if envelope.Version != "" && envelope.Version != SchemaVersion {
+		upgraded, err := upgradeEvent(data, envelope.Version)
+		if err != nil {
+			return nil, err
+		}
+		data = upgraded
+	}
+
 	var event Event
-	err := json.Unmarshal(data, &event)
-	return &event, err
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
 }
 
 // SetCorrelationID sets the correlation ID for request tracing
@@ -91,15 +121,15 @@ func (e *Event) AddMetadata(key, value string) {
 // Uses UserID for user-specific events, falls back to event type
 func (e *Event) GetPartitionKey() string {
 	if e.UserID != nil {
-		return string(rune(*e.UserID)) // Convert user ID to string for partitioning
+		return fmt.Sprintf("user_%d", *e.UserID)
 	}
 	return string(e.Type) // System events partitioned by type
 }
 
-// generateEventID generates a unique event ID
-// In production, you might want to use UUID or snowflake IDs
+// generateEventID generates a unique event ID as a random (version 4) UUID.
+// Consumers deduplicate on it, so it must not collide across processes
 func generateEventID() string {
-	return time.Now().Format("20060102150405.000000")
+	return utils.UUIDGenerator{}.NewID()
 }
 
 // UserRegisteredEventData represents data for user registration event
@@ -119,6 +149,14 @@ type UserTrialActivatedEventData struct {
 	ActivatedAt    time.Time `json:"activated_at"`
 }
 
+// UserStatusChangedEventData represents data for a status transition event
+type UserStatusChangedEventData struct {
+	TelegramID     int64     `json:"telegram_id"`
+	PreviousStatus string    `json:"previous_status"`
+	NewStatus      string    `json:"new_status"`
+	ChangedAt      time.Time `json:"changed_at"`
+}
+
 // UserQuotaUpdatedEventData represents data for quota update event
 type UserQuotaUpdatedEventData struct {
 	TelegramID      int64 `json:"telegram_id"`
@@ -127,6 +165,50 @@ type UserQuotaUpdatedEventData struct {
 	QuotaDelta      int64 `json:"quota_delta"`
 }
 
+// UserDeletedEventData represents data for user deletion event
+type UserDeletedEventData struct {
+	TelegramID int64     `json:"telegram_id"`
+	Status     string    `json:"status"`
+	QuotaUsed  int64     `json:"quota_used"`
+	DeletedAt  time.Time `json:"deleted_at"`
+}
+
+// UserPlanExpiredEventData represents data for a plan expiry event
+type UserPlanExpiredEventData struct {
+	TelegramID int64     `json:"telegram_id"`
+	PlanName   string    `json:"plan_name"`
+	QuotaLimit int64     `json:"quota_limit"`
+	ExpiredAt  time.Time `json:"expired_at"`
+}
+
+// UserAnonymizedEventData represents data for a retention anonymization event
+type UserAnonymizedEventData struct {
+	TelegramID    int64     `json:"telegram_id"`
+	InactiveSince time.Time `json:"inactive_since"`
+	AnonymizedAt  time.Time `json:"anonymized_at"`
+}
+
+// UserReferredEventData represents data for a referral event
+type UserReferredEventData struct {
+	TelegramID int64 `json:"telegram_id"`
+	ReferrerID int64 `json:"referrer_id"`
+	BonusBytes int64 `json:"bonus_bytes"`
+}
+
+// UserQuotaThresholdReachedEventData represents data for a quota usage alert threshold event
+type UserQuotaThresholdReachedEventData struct {
+	TelegramID   int64 `json:"telegram_id"`
+	ThresholdPct int   `json:"threshold_pct"`
+	QuotaUsed    int64 `json:"quota_used"`
+	QuotaLimit   int64 `json:"quota_limit"`
+}
+
+// UserConfigRevokedEventData represents data for a revoked VPN config event
+type UserConfigRevokedEventData struct {
+	TelegramID int64  `json:"telegram_id"`
+	PublicKey  string `json:"public_key"`
+}
+
 // BotMessageReceivedEventData represents data for bot message event
 type BotMessageReceivedEventData struct {
 	TelegramID int64  `json:"telegram_id"`
@@ -146,6 +228,22 @@ type BotCallbackReceivedEventData struct {
 	CallbackData string `json:"callback_data"`
 }
 
+// BotCommandExecutedEventData represents data for a handled command event
+type BotCommandExecutedEventData struct {
+	TelegramID int64  `json:"telegram_id"`
+	ChatID     int64  `json:"chat_id"`
+	Command    string `json:"command"`
+	DurationMs int64  `json:"duration_ms"`
+	Success    bool   `json:"success"`
+	Error      string `json:"error,omitempty"`
+}
+
+// RateLimitedEventData represents data for a rate-limited request event
+type RateLimitedEventData struct {
+	TelegramID int64  `json:"telegram_id"`
+	Action     string `json:"action"`
+}
+
 // Helper functions to create specific events
 
 // NewUserRegisteredEvent creates a user registration event
@@ -171,6 +269,17 @@ func NewUserTrialActivatedEvent(userID int64, previousStatus, newStatus string)
 	return NewEvent(EventUserTrialActivated, &userID, data)
 }
 
+// NewUserStatusChangedEvent creates an event for any user status transition
+func NewUserStatusChangedEvent(userID int64, previousStatus, newStatus string) *Event {
+	data := map[string]interface{}{
+		"telegram_id":     userID,
+		"previous_status": previousStatus,
+		"new_status":      newStatus,
+		"changed_at":      time.Now().UTC(),
+	}
+	return NewEvent(EventUserStatusChanged, &userID, data)
+}
+
 // NewUserQuotaUpdatedEvent creates a quota update event
 func NewUserQuotaUpdatedEvent(userID int64, previousQuota, newQuota int64) *Event {
 	data := map[string]interface{}{
@@ -182,6 +291,133 @@ func NewUserQuotaUpdatedEvent(userID int64, previousQuota, newQuota int64) *Even
 	return NewEvent(EventUserQuotaUpdated, &userID, data)
 }
 
+// ParseUserQuotaUpdated reads the data of a quota update event, whichever key casing it
+// was published with. The Telegram ID falls back to the event's user ID
+func ParseUserQuotaUpdated(event *Event) (UserQuotaUpdatedEventData, error) {
+	var data UserQuotaUpdatedEventData
+	if event.Type != EventUserQuotaUpdated {
+		return data, fmt.Errorf("unexpected event type %s", event.Type)
+	}
+
+	telegramID, ok := dataInt64(event.Data, "telegram_id")
+	if !ok && event.UserID != nil {
+		telegramID, ok = *event.UserID, true
+	}
+	if !ok {
+		return data, fmt.Errorf("quota update event %s has no telegram_id", event.ID)
+	}
+	newQuota, ok := dataInt64(event.Data, "new_quota")
+	if !ok {
+		return data, fmt.Errorf("quota update event %s has no new_quota", event.ID)
+	}
+	previousQuota, _ := dataInt64(event.Data, "previous_quota")
+
+	data = UserQuotaUpdatedEventData{
+		TelegramID:    telegramID,
+		PreviousQuota: previousQuota,
+		NewQuota:      newQuota,
+		QuotaDelta:    newQuota - previousQuota,
+	}
+	return data, nil
+}
+
+// dataInt64 returns the whole number stored under the snake_case key, or its camelCase
+// form. Numbers decoded from JSON are float64
+func dataInt64(data map[string]interface{}, key string) (int64, bool) {
+	value, ok := data[key]
+	if !ok {
+		value, ok = data[snakeToCamel(key)]
+	}
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case float64:
+		if v != float64(int64(v)) {
+			return 0, false
+		}
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// NewUserDeletedEvent creates a user deletion event. Personal data such as
+// names and usernames is deliberately left out since the user asked to be forgotten
+func NewUserDeletedEvent(userID int64, status string, quotaUsed int64) *Event {
+	data := map[string]interface{}{
+		"telegram_id": userID,
+		"status":      status,
+		"quota_used":  quotaUsed,
+		"deleted_at":  time.Now().UTC(),
+	}
+	return NewEvent(EventUserDeleted, &userID, data)
+}
+
+// NewUserPlanExpiredEvent creates an event for a user downgraded after their paid period lapsed
+func NewUserPlanExpiredEvent(userID int64, planName string, quotaLimit int64, expiredAt time.Time) *Event {
+	data := map[string]interface{}{
+		"telegram_id": userID,
+		"plan_name":   planName,
+		"quota_limit": quotaLimit,
+		"expired_at":  expiredAt.UTC(),
+	}
+	return NewEvent(EventUserPlanExpired, &userID, data)
+}
+
+// NewUserAnonymizedEvent creates an event for a user whose personal data was cleared
+// after being inactive since the retention cutoff
+func NewUserAnonymizedEvent(userID int64, inactiveSince time.Time) *Event {
+	data := map[string]interface{}{
+		"telegram_id":    userID,
+		"inactive_since": inactiveSince.UTC(),
+		"anonymized_at":  time.Now().UTC(),
+	}
+	return NewEvent(EventUserAnonymized, &userID, data)
+}
+
+// NewUserReferredEvent creates an event for a user who registered with another user's
+// referral code. Both were credited bonusBytes of quota
+func NewUserReferredEvent(userID, referrerID, bonusBytes int64) *Event {
+	data := map[string]interface{}{
+		"telegram_id": userID,
+		"referrer_id": referrerID,
+		"bonus_bytes": bonusBytes,
+	}
+	return NewEvent(EventUserReferred, &userID, data)
+}
+
+// NewUserQuotaThresholdReachedEvent creates an event for a user whose quota usage
+// crossed an alert threshold
+func NewUserQuotaThresholdReachedEvent(userID int64, thresholdPct int, quotaUsed, quotaLimit int64) *Event {
+	data := map[string]interface{}{
+		"telegram_id":   userID,
+		"threshold_pct": thresholdPct,
+		"quota_used":    quotaUsed,
+		"quota_limit":   quotaLimit,
+	}
+	return NewEvent(EventUserQuotaThresholdReached, &userID, data)
+}
+
+// NewUserConfigRevokedEvent creates an event for a VPN config whose public key was revoked
+func NewUserConfigRevokedEvent(userID int64, publicKey string) *Event {
+	data := map[string]interface{}{
+		"telegram_id": userID,
+		"public_key":  publicKey,
+	}
+	return NewEvent(EventUserConfigRevoked, &userID, data)
+}
+
+// NewRateLimitedEvent creates an event for a request blocked by the rate limiter
+func NewRateLimitedEvent(userID int64, action string) *Event {
+	data := map[string]interface{}{
+		"telegram_id": userID,
+		"action":      action,
+	}
+	return NewEvent(EventSystemRateLimited, &userID, data)
+}
+
 // NewBotMessageReceivedEvent creates a bot message received event
 func NewBotMessageReceivedEvent(userID int64, username string, chatID int64, messageID int, text, command string) *Event {
 	data := map[string]interface{}{
@@ -205,4 +441,20 @@ func NewBotCallbackReceivedEvent(userID int64, username string, chatID int64, me
 		"callback_data": callbackData,
 	}
 	return NewEvent(EventBotCallbackReceived, &userID, data)
+}
+
+// NewBotCommandExecutedEvent creates an event for a handled command; err is the
+// error its handler returned, if any
+func NewBotCommandExecutedEvent(userID, chatID int64, command string, duration time.Duration, err error) *Event {
+	data := map[string]interface{}{
+		"telegram_id": userID,
+		"chat_id":     chatID,
+		"command":     command,
+		"duration_ms": duration.Milliseconds(),
+		"success":     err == nil,
+	}
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	return NewEvent(EventBotCommandExecuted, &userID, data)
 }
\ No newline at end of file
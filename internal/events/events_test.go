@@ -2,10 +2,13 @@ package events
 
 import (
 	"context"
+	"regexp"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -27,6 +30,46 @@ func TestNewEvent(t *testing.T) {
 	assert.WithinDuration(t, time.Now(), event.Timestamp, time.Second)
 }
 
+func TestGenerateEventIDIsUniqueUUID(t *testing.T) {
+	const workers = 10
+	const perWorker = 1000
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	ids := make(chan string, workers*perWorker)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perWorker; j++ {
+				ids <- generateEventID()
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[string]bool, workers*perWorker)
+	for id := range ids {
+		require.Regexp(t, uuidPattern, id)
+		require.False(t, seen[id], "duplicate event ID %s", id)
+		seen[id] = true
+	}
+	assert.Len(t, seen, workers*perWorker)
+}
+
+func TestGetPartitionKey(t *testing.T) {
+	userID := int64(6543219876)
+	event := NewEvent(EventUserRegistered, &userID, nil)
+
+	assert.Equal(t, "user_6543219876", event.GetPartitionKey())
+	assert.Equal(t, event.GetPartitionKey(), NewEvent(EventUserDeleted, &userID, nil).GetPartitionKey())
+	assert.Equal(t, (&KafkaPublisher{}).getPartitionKey(event), event.GetPartitionKey())
+
+	// System events are partitioned by type
+	assert.Equal(t, "system.startup", NewEvent(EventSystemStartup, nil, nil).GetPartitionKey())
+}
+
 func TestEventSerialization(t *testing.T) {
 	userID := int64(12345)
 	data := map[string]interface{}{
@@ -76,6 +119,27 @@ func TestEventHelperFunctions(t *testing.T) {
 	assert.Equal(t, "inactive", trialEvent.Data["previous_status"])
 	assert.Equal(t, "active", trialEvent.Data["new_status"])
 
+	// Test status changed event
+	statusEvent := NewUserStatusChangedEvent(userID, "trial", "banned")
+	assert.Equal(t, EventUserStatusChanged, statusEvent.Type)
+	assert.Equal(t, userID, *statusEvent.UserID)
+	assert.Equal(t, "trial", statusEvent.Data["previous_status"])
+	assert.Equal(t, "banned", statusEvent.Data["new_status"])
+
+	// Test referred event
+	referredEvent := NewUserReferredEvent(userID, 987654321, 1024)
+	assert.Equal(t, EventUserReferred, referredEvent.Type)
+	assert.Equal(t, userID, *referredEvent.UserID)
+	assert.Equal(t, int64(987654321), referredEvent.Data["referrer_id"])
+	assert.Equal(t, int64(1024), referredEvent.Data["bonus_bytes"])
+
+	// Test anonymized event
+	inactiveSince := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	anonymizedEvent := NewUserAnonymizedEvent(userID, inactiveSince)
+	assert.Equal(t, EventUserAnonymized, anonymizedEvent.Type)
+	assert.Equal(t, userID, *anonymizedEvent.UserID)
+	assert.Equal(t, inactiveSince, anonymizedEvent.Data["inactive_since"])
+
 	// Test quota updated event
 	quotaEvent := NewUserQuotaUpdatedEvent(userID, 1024, 2048)
 	assert.Equal(t, EventUserQuotaUpdated, quotaEvent.Type)
@@ -84,6 +148,27 @@ func TestEventHelperFunctions(t *testing.T) {
 	assert.Equal(t, int64(2048), quotaEvent.Data["new_quota"])
 	assert.Equal(t, int64(1024), quotaEvent.Data["quota_delta"])
 
+	// Test quota threshold reached event
+	thresholdEvent := NewUserQuotaThresholdReachedEvent(userID, 80, 800, 1000)
+	assert.Equal(t, EventUserQuotaThresholdReached, thresholdEvent.Type)
+	assert.Equal(t, userID, *thresholdEvent.UserID)
+	assert.Equal(t, 80, thresholdEvent.Data["threshold_pct"])
+	assert.Equal(t, int64(1000), thresholdEvent.Data["quota_limit"])
+
+	// Test config revoked event
+	revokedEvent := NewUserConfigRevokedEvent(userID, "client-public-key")
+	assert.Equal(t, EventUserConfigRevoked, revokedEvent.Type)
+	assert.Equal(t, userID, *revokedEvent.UserID)
+	assert.Equal(t, "client-public-key", revokedEvent.Data["public_key"])
+
+	// Test user deleted event
+	deletedEvent := NewUserDeletedEvent(userID, "trial", 2048)
+	assert.Equal(t, EventUserDeleted, deletedEvent.Type)
+	assert.Equal(t, userID, *deletedEvent.UserID)
+	assert.Equal(t, "trial", deletedEvent.Data["status"])
+	assert.Equal(t, int64(2048), deletedEvent.Data["quota_used"])
+	assert.NotContains(t, deletedEvent.Data, "username")
+
 	// Test bot message received event
 	msgEvent := NewBotMessageReceivedEvent(userID, "testuser", 67890, 1, "/start", "start")
 	assert.Equal(t, EventBotMessageReceived, msgEvent.Type)
@@ -96,6 +181,13 @@ func TestEventHelperFunctions(t *testing.T) {
 	assert.Equal(t, EventBotCallbackReceived, callbackEvent.Type)
 	assert.Equal(t, userID, *callbackEvent.UserID)
 	assert.Equal(t, "trial", callbackEvent.Data["callback_data"])
+
+	// Test rate limited event
+	rateLimitedEvent := NewRateLimitedEvent(userID, "command:/start")
+	assert.Equal(t, EventSystemRateLimited, rateLimitedEvent.Type)
+	assert.Equal(t, userID, *rateLimitedEvent.UserID)
+	assert.Equal(t, userID, rateLimitedEvent.Data["telegram_id"])
+	assert.Equal(t, "command:/start", rateLimitedEvent.Data["action"])
 }
 
 func TestMockPublisher(t *testing.T) {
@@ -173,6 +265,10 @@ func TestEventService(t *testing.T) {
 	err = service.PublishBotCallbackReceived(ctx, 12345, "testuser", 67890, 1, "trial")
 	require.NoError(t, err)
 	
+	// Test rate limited event
+	err = service.PublishRateLimited(ctx, 12345, "command:/start")
+	require.NoError(t, err)
+	
 	// Test system error event
 	metadata := map[string]string{"component": "test"}
 	err = service.PublishSystemError(ctx, "test_error", "Test error message", metadata)
@@ -188,7 +284,7 @@ func TestEventService(t *testing.T) {
 	
 	// Verify all events were published
 	publishedEvents := publisher.GetPublishedEvents()
-	assert.Len(t, publishedEvents, 8)
+	assert.Len(t, publishedEvents, 9)
 	
 	// Verify event types
 	eventTypes := make(map[EventType]int)
@@ -201,6 +297,7 @@ func TestEventService(t *testing.T) {
 	assert.Equal(t, 1, eventTypes[EventUserQuotaUpdated])
 	assert.Equal(t, 1, eventTypes[EventBotMessageReceived])
 	assert.Equal(t, 1, eventTypes[EventBotCallbackReceived])
+	assert.Equal(t, 1, eventTypes[EventSystemRateLimited])
 	assert.Equal(t, 1, eventTypes[EventSystemError])
 	assert.Equal(t, 1, eventTypes[EventSystemStartup])
 	assert.Equal(t, 1, eventTypes[EventSystemShutdown])
@@ -227,4 +324,151 @@ func TestEventServiceErrorHandling(t *testing.T) {
 	err = service.PublishUserQuotaUpdated(ctx, 12345, 512, 1024)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to publish user quota updated event")
-}
\ No newline at end of file
+}
+func TestDisabledEventService(t *testing.T) {
+	service := NewDisabledEventService()
+	ctx := context.Background()
+
+	require.NoError(t, service.PublishUserRegistered(ctx, 12345, "testuser", "Test", "User", 1024))
+	require.NoError(t, service.PublishBotMessageReceived(ctx, 12345, "testuser", 67890, 1, "/start", "start"))
+	require.NoError(t, service.PublishSystemShutdown(ctx, "graceful shutdown", nil))
+	require.NoError(t, service.Close())
+
+	// Disabled methods must not build events
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = service.PublishUserQuotaUpdated(ctx, 12345, 512, 1024)
+		_ = service.PublishRateLimited(ctx, 12345, "command:/start")
+	})
+	assert.Zero(t, allocs)
+}
+
+func TestEventServiceCorrelationID(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	publisher := NewMockPublisher(logger)
+	service := NewEventService(publisher, logger)
+
+	ctx := WithCorrelationID(context.Background(), "abc123")
+	require.NoError(t, service.PublishBotMessageReceived(ctx, 12345, "testuser", 67890, 1, "/start", "start"))
+	require.NoError(t, service.PublishUserRegistered(ctx, 12345, "testuser", "Test", "User", 1024))
+	require.NoError(t, service.PublishUserRegistered(context.Background(), 12345, "testuser", "Test", "User", 1024))
+
+	published := publisher.GetPublishedEvents()
+	require.Len(t, published, 3)
+	for _, event := range published[:2] {
+		require.NotNil(t, event.CorrelationID)
+		assert.Equal(t, "abc123", *event.CorrelationID)
+	}
+	assert.Nil(t, published[2].CorrelationID)
+}
+
+func TestEventServiceUpdateID(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	publisher := NewMockPublisher(logger)
+	service := NewEventService(publisher, logger)
+
+	ctx := WithUpdateID(context.Background(), 1001)
+	require.NoError(t, service.PublishBotMessageReceived(ctx, 12345, "testuser", 67890, 1, "/start", "start"))
+	require.NoError(t, service.PublishUserRegistered(context.Background(), 12345, "testuser", "Test", "User", 1024))
+
+	published := publisher.GetPublishedEvents()
+	require.Len(t, published, 2)
+	assert.Equal(t, "1001", published[0].Metadata["update_id"])
+	assert.NotContains(t, published[1].Metadata, "update_id")
+}
+
+func TestEventService_IDGenerator(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	publisher := NewMockPublisher(logger)
+	service := NewEventService(publisher, logger)
+	service.SetIDGenerator(utils.NewSequentialIDGenerator("event"))
+
+	ctx := context.Background()
+	require.NoError(t, service.PublishUserRegistered(ctx, 12345, "testuser", "Test", "User", 1024))
+	require.NoError(t, service.PublishUserTrialActivated(ctx, 12345, "inactive", "trial"))
+
+	published := publisher.GetPublishedEvents()
+	require.Len(t, published, 2)
+	assert.Equal(t, "event-1", published[0].ID)
+	assert.Equal(t, "event-2", published[1].ID)
+}
+
+func TestEventService_RecordsPublishLatency(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	publisher := NewMockPublisher(logger)
+	service := NewEventService(publisher, logger)
+
+	var observed []string
+	service.SetLatencyRecorder(func(eventType string, duration time.Duration) {
+		assert.GreaterOrEqual(t, duration, time.Duration(0))
+		observed = append(observed, eventType)
+	})
+	ctx := context.Background()
+
+	require.NoError(t, service.PublishUserRegistered(ctx, 12345, "testuser", "Test", "User", 1024))
+	require.NoError(t, service.PublishRateLimited(ctx, 12345, "command:/start"))
+
+	// Failed publishes are recorded too, so slow failures show up in the histogram
+	publisher.SetShouldError(true)
+	require.Error(t, service.PublishUserDeleted(ctx, 12345, "active", 0))
+
+	assert.Equal(t, []string{
+		string(EventUserRegistered),
+		string(EventSystemRateLimited),
+		string(EventUserDeleted),
+	}, observed)
+}
+
+func TestFromJSON_SchemaVersions(t *testing.T) {
+	t.Run("Older version is upgraded", func(t *testing.T) {
+		payload := []byte(`{
+			"id": "legacy-1",
+			"type": "user.quota_updated",
+			"version": "0.9",
+			"occurred_at": "2024-03-01T12:00:00Z",
+			"user_id": 9007199254740993,
+			"data": {"telegram_id": 123, "new_quota": 500}
+		}`)
+
+		event, err := FromJSON(payload)
+
+		require.NoError(t, err)
+		assert.Equal(t, SchemaVersion, event.Version)
+		assert.Equal(t, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), event.Timestamp, "occurred_at becomes timestamp")
+		assert.Equal(t, EventUserQuotaUpdated, event.Type)
+		require.NotNil(t, event.UserID)
+		assert.Equal(t, int64(9007199254740993), *event.UserID, "IDs are not rounded by the upgrade")
+		assert.Equal(t, float64(500), event.Data["new_quota"])
+	})
+
+	t.Run("Current and missing versions are decoded as is", func(t *testing.T) {
+		for _, version := range []string{`"version": "1.0",`, ""} {
+			event, err := FromJSON([]byte(`{"id": "e-1", "type": "user.deleted", ` + version + ` "timestamp": "2024-03-01T12:00:00Z"}`))
+
+			require.NoError(t, err)
+			assert.Equal(t, "e-1", event.ID)
+			assert.Equal(t, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), event.Timestamp)
+		}
+	})
+
+	t.Run("Unknown version is rejected", func(t *testing.T) {
+		for _, version := range []string{"2.0", "0.1"} {
+			_, err := FromJSON([]byte(`{"id": "e-1", "type": "user.deleted", "version": "` + version + `"}`))
+
+			assert.ErrorIs(t, err, ErrUnsupportedVersion)
+			assert.ErrorContains(t, err, version)
+		}
+	})
+
+	t.Run("Malformed JSON", func(t *testing.T) {
+		_, err := FromJSON([]byte(`{"id":`))
+		assert.Error(t, err)
+	})
+}
@@ -2,14 +2,20 @@ package events
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/sirupsen/logrus"
 )
 
+// kafkaClientID identifies the bot to the brokers. Published events carry it in their
+// source header, so the bot's own consumer can tell them apart
+const kafkaClientID = "arcanus-vpn-bot"
+
 // Publisher defines the interface for event publishing
 type Publisher interface {
 	Publish(ctx context.Context, event *Event) error
@@ -17,11 +23,31 @@ type Publisher interface {
 	Close() error
 }
 
+// messageProducer is the part of the Kafka producer KafkaPublisher relies on
+type messageProducer interface {
+	Produce(msg *kafka.Message, deliveryChan chan kafka.Event) error
+	Events() chan kafka.Event
+	Flush(timeoutMs int) int
+	Close()
+	GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error)
+}
+
 // KafkaPublisher implements event publishing to Kafka
 type KafkaPublisher struct {
-	producer *kafka.Producer
-	topic    string
-	logger   *logrus.Logger
+	producer     messageProducer
+	topic        string
+	dlqTopic     string
+	dlqFile      *deadLetterFile
+	syncDelivery bool
+	logger       *logrus.Logger
+	latency      LatencyRecorder
+}
+
+// asyncDelivery travels with a message produced without waiting for its delivery, so
+// the delivery report handler can account for the event
+type asyncDelivery struct {
+	event *Event
+	start time.Time
 }
 
 // KafkaConfig holds Kafka configuration
@@ -36,13 +62,22 @@ type KafkaConfig struct {
 	Acks              string
 	RetryBackoffMs    int
 	RequestTimeoutMs  int
+	DLQTopic          string // where events that failed delivery are written, empty drops them
+	// DLQFile is a local file dead letters are appended to when the dead-letter topic
+	// cannot be written either, e.g. because the brokers are unreachable
+	DLQFile string
+	// SyncDelivery makes publishing wait for the brokers to acknowledge each event.
+	// Without it events are only queued, so a failed delivery is logged and
+	// dead-lettered but not reported to the caller, and events still queued when the
+	// process dies are lost
+	SyncDelivery bool
 }
 
 // NewKafkaPublisher creates a new Kafka event publisher
 func NewKafkaPublisher(config KafkaConfig, logger *logrus.Logger) (*KafkaPublisher, error) {
 	kafkaConfig := &kafka.ConfigMap{
 		"bootstrap.servers": config.Brokers,
-		"client.id":        "arcanus-vpn-bot",
+		"client.id":        kafkaClientID,
 		"acks":             config.Acks,
 		"retries":          3,
 		"retry.backoff.ms": config.RetryBackoffMs,
@@ -68,20 +103,113 @@ func NewKafkaPublisher(config KafkaConfig, logger *logrus.Logger) (*KafkaPublish
 		return nil, fmt.Errorf("failed to create Kafka producer: %w", err)
 	}
 
+	return newKafkaPublisher(producer, config, logger), nil
+}
+
+// newKafkaPublisher creates a publisher producing through producer
+func newKafkaPublisher(producer messageProducer, config KafkaConfig, logger *logrus.Logger) *KafkaPublisher {
 	publisher := &KafkaPublisher{
-		producer: producer,
-		topic:    config.Topic,
-		logger:   logger,
+		producer:     producer,
+		topic:        config.Topic,
+		dlqTopic:     config.DLQTopic,
+		syncDelivery: config.SyncDelivery,
+		logger:       logger,
+	}
+	if config.DLQFile != "" {
+		publisher.dlqFile = &deadLetterFile{path: config.DLQFile}
 	}
 
 	// Start delivery report handler
 	go publisher.handleDeliveryReports()
 
-	return publisher, nil
+	return publisher
+}
+
+// SetLatencyRecorder configures where the time from producing an event to its
+// delivery report is recorded
+func (p *KafkaPublisher) SetLatencyRecorder(recorder LatencyRecorder) {
+	p.latency = recorder
 }
 
-// Publish publishes a single event to Kafka
+// Publish publishes a single event to Kafka. Events that fail delivery are written to
+// the dead-letter topic or file, if one is configured, so they can be replayed
 func (p *KafkaPublisher) Publish(ctx context.Context, event *Event) error {
+	err := p.publish(ctx, p.topic, event, p.syncDelivery)
+	if err == nil || !p.deadLettering() {
+		return err
+	}
+	return p.deadLetter(ctx, event, err)
+}
+
+// deadLettering reports whether failed events are saved rather than dropped
+func (p *KafkaPublisher) deadLettering() bool {
+	return p.dlqTopic != "" || p.dlqFile != nil
+}
+
+// deadLetter saves an event that failed delivery with err. The original error is
+// returned either way, since the event did not reach the topic
+func (p *KafkaPublisher) deadLetter(ctx context.Context, event *Event, err error) error {
+	markDeadLettered(event, err)
+	destination, dlqErr := p.writeDeadLetter(ctx, event)
+	if dlqErr != nil {
+		p.logger.WithError(dlqErr).WithField("event_id", event.ID).Error("Failed to dead-letter event")
+		return fmt.Errorf("%w; dead-lettering failed too: %v", err, dlqErr)
+	}
+
+	p.logger.WithError(err).WithFields(logrus.Fields{
+		"event_id":    event.ID,
+		"event_type":  event.Type,
+		"dead_letter": destination,
+	}).Warn("Event dead-lettered")
+	return fmt.Errorf("%w (dead-lettered to %s)", err, destination)
+}
+
+// writeDeadLetter writes a dead letter to the dead-letter topic, or appends it to the
+// dead-letter file when the topic cannot be written. It returns where the event went
+func (p *KafkaPublisher) writeDeadLetter(ctx context.Context, event *Event) (string, error) {
+	var topicErr error
+	if p.dlqTopic != "" {
+		// A cancelled request must not also stop the event from being saved
+		topicErr = p.publish(context.WithoutCancel(ctx), p.dlqTopic, event, p.syncDelivery)
+		if topicErr == nil {
+			return p.dlqTopic, nil
+		}
+	}
+	if p.dlqFile == nil {
+		return "", topicErr
+	}
+
+	if err := p.dlqFile.append(event); err != nil {
+		if topicErr != nil {
+			return "", fmt.Errorf("%v; %w", topicErr, err)
+		}
+		return "", err
+	}
+	return p.dlqFile.path, nil
+}
+
+// DeadLetter saves an event that could not be processed, e.g. one the consumer kept
+// failing to handle, recording reason on it
+func (p *KafkaPublisher) DeadLetter(ctx context.Context, event *Event, reason error) error {
+	if !p.deadLettering() {
+		return fmt.Errorf("no dead-letter topic or file configured")
+	}
+	markDeadLettered(event, reason)
+	_, err := p.writeDeadLetter(ctx, event)
+	return err
+}
+
+// PublishTo publishes a single event to the given topic instead of the events topic,
+// e.g. to check the brokers accept writes without adding to the event stream. It
+// always waits for the delivery, whatever SyncDelivery says
+func (p *KafkaPublisher) PublishTo(ctx context.Context, topic string, event *Event) error {
+	return p.publish(ctx, topic, event, true)
+}
+
+// publish produces an event to topic. With wait it returns once the brokers
+// acknowledged the event, otherwise once it is queued and the delivery report handler
+// takes care of the outcome
+func (p *KafkaPublisher) publish(ctx context.Context, topic string, event *Event, wait bool) error {
 	// Serialize event to JSON
 	eventData, err := event.ToJSON()
 	if err != nil {
@@ -91,7 +219,7 @@ func (p *KafkaPublisher) Publish(ctx context.Context, event *Event) error {
 	// Create Kafka message with user-based partitioning
 	message := &kafka.Message{
 		TopicPartition: kafka.TopicPartition{
-			Topic:     &p.topic,
+			Topic:     &topic,
 			Partition: kafka.PartitionAny,
 		},
 		Key:   []byte(p.getPartitionKey(event)),
@@ -101,6 +229,7 @@ func (p *KafkaPublisher) Publish(ctx context.Context, event *Event) error {
 			{Key: "event_type", Value: []byte(event.Type)},
 			{Key: "version", Value: []byte(event.Version)},
 			{Key: "timestamp", Value: []byte(event.Timestamp.Format(time.RFC3339))},
+			{Key: "source", Value: []byte(kafkaClientID)},
 		},
 	}
 
@@ -121,7 +250,20 @@ func (p *KafkaPublisher) Publish(ctx context.Context, event *Event) error {
 	}
 
 	// Produce message
-	deliveryChan := make(chan kafka.Event)
+	if !wait {
+		message.Opaque = &asyncDelivery{event: event, start: time.Now()}
+		if err := p.producer.Produce(message, nil); err != nil {
+			return fmt.Errorf("failed to produce message: %w", err)
+		}
+		return nil
+	}
+	if p.latency != nil {
+		start := time.Now()
+		defer func() { p.latency(string(event.Type), time.Since(start)) }()
+	}
+	// Buffered so the delivery report does not block the producer once we stopped
+	// waiting for it after a timeout
+	deliveryChan := make(chan kafka.Event, 1)
 	err = p.producer.Produce(message, deliveryChan)
 	if err != nil {
 		return fmt.Errorf("failed to produce message: %w", err)
@@ -152,19 +294,23 @@ func (p *KafkaPublisher) Publish(ctx context.Context, event *Event) error {
 	return nil
 }
 
-// PublishBatch publishes multiple events in batch
+// PublishBatch publishes multiple events in batch. Without SyncDelivery it returns
+// once the events are queued. Events that fail are dead-lettered like in Publish, and
+// the batch reports them together
 func (p *KafkaPublisher) PublishBatch(ctx context.Context, events []*Event) error {
 	if len(events) == 0 {
 		return nil
 	}
 
 	deliveryChans := make([]chan kafka.Event, len(events))
-	
+	failures := make([]error, len(events))
+
 	// Produce all messages
 	for i, event := range events {
 		eventData, err := event.ToJSON()
 		if err != nil {
-			return fmt.Errorf("failed to serialize event %s: %w", event.ID, err)
+			failures[i] = fmt.Errorf("failed to serialize event: %w", err)
+			continue
 		}
 
 		message := &kafka.Message{
@@ -178,34 +324,64 @@ func (p *KafkaPublisher) PublishBatch(ctx context.Context, events []*Event) erro
 				{Key: "event_id", Value: []byte(event.ID)},
 				{Key: "event_type", Value: []byte(event.Type)},
 				{Key: "version", Value: []byte(event.Version)},
+				{Key: "source", Value: []byte(kafkaClientID)},
 			},
 		}
 
-		deliveryChan := make(chan kafka.Event)
-		deliveryChans[i] = deliveryChan
+		var deliveryChan chan kafka.Event
+		if p.syncDelivery {
+			// Buffered, so a report arriving after we gave up waiting does not block
+			deliveryChan = make(chan kafka.Event, 1)
+		} else {
+			message.Opaque = &asyncDelivery{event: event, start: time.Now()}
+		}
 		
-		err = p.producer.Produce(message, deliveryChan)
-		if err != nil {
-			return fmt.Errorf("failed to produce message for event %s: %w", event.ID, err)
+		if err := p.producer.Produce(message, deliveryChan); err != nil {
+			failures[i] = fmt.Errorf("failed to produce message: %w", err)
+			continue
 		}
+		deliveryChans[i] = deliveryChan
 	}
 
 	// Wait for all deliveries
-	for i, deliveryChan := range deliveryChans {
-		select {
-		case e := <-deliveryChan:
-			m := e.(*kafka.Message)
-			if m.TopicPartition.Error != nil {
-				return fmt.Errorf("delivery failed for event %s: %v", events[i].ID, m.TopicPartition.Error)
+	if p.syncDelivery {
+		for i, deliveryChan := range deliveryChans {
+			if deliveryChan == nil {
+				continue
+			}
+			select {
+			case e := <-deliveryChan:
+				m := e.(*kafka.Message)
+				if m.TopicPartition.Error != nil {
+					failures[i] = fmt.Errorf("delivery failed: %v", m.TopicPartition.Error)
+				}
+			case <-ctx.Done():
+				failures[i] = fmt.Errorf("context cancelled while waiting for batch delivery")
+			case <-time.After(30 * time.Second):
+				failures[i] = fmt.Errorf("timeout waiting for batch delivery")
 			}
-		case <-ctx.Done():
-			return fmt.Errorf("context cancelled while waiting for batch delivery")
-		case <-time.After(30 * time.Second):
-			return fmt.Errorf("timeout waiting for batch delivery")
 		}
 	}
 
-	p.logger.WithField("batch_size", len(events)).Debug("Event batch published successfully")
+	var errs []error
+	for i, err := range failures {
+		if err == nil {
+			continue
+		}
+		if p.deadLettering() {
+			err = p.deadLetter(ctx, events[i], err)
+		}
+		errs = append(errs, fmt.Errorf("event %s: %w", events[i].ID, err))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to publish %d of %d events in batch: %w", len(errs), len(events), errors.Join(errs...))
+	}
+
+	if p.syncDelivery {
+		p.logger.WithField("batch_size", len(events)).Debug("Event batch published successfully")
+	} else {
+		p.logger.WithField("batch_size", len(events)).Debug("Event batch queued")
+	}
 	return nil
 }
 
@@ -221,22 +397,54 @@ func (p *KafkaPublisher) Close() error {
 	return nil
 }
 
+// defaultPingTimeout bounds Ping when the context has no deadline
+const defaultPingTimeout = 5 * time.Second
+
+// Ping checks that the brokers are reachable by fetching the topic metadata
+func (p *KafkaPublisher) Ping(ctx context.Context) error {
+	timeout := defaultPingTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	if timeout <= 0 {
+		return ctx.Err()
+	}
+
+	if _, err := p.producer.GetMetadata(&p.topic, false, int(timeout.Milliseconds())); err != nil {
+		return fmt.Errorf("failed to reach Kafka brokers: %w", err)
+	}
+	return nil
+}
+
 // getPartitionKey returns the partition key for an event
 // This ensures events for the same user go to the same partition for ordering
 func (p *KafkaPublisher) getPartitionKey(event *Event) string {
-	if event.UserID != nil {
-		return fmt.Sprintf("user_%d", *event.UserID)
-	}
-	return string(event.Type)
+	return event.GetPartitionKey()
 }
 
-// handleDeliveryReports handles delivery reports in the background
+// handleDeliveryReports handles delivery reports in the background. For events
+// published without SyncDelivery it is the only place their outcome is known, so it
+// records their latency and dead-letters the failed ones
 func (p *KafkaPublisher) handleDeliveryReports() {
 	for e := range p.producer.Events() {
 		switch ev := e.(type) {
 		case *kafka.Message:
+			delivery, _ := ev.Opaque.(*asyncDelivery)
+			if delivery != nil && p.latency != nil {
+				p.latency(string(delivery.event.Type), time.Since(delivery.start))
+			}
 			if ev.TopicPartition.Error != nil {
 				p.logger.WithError(ev.TopicPartition.Error).Error("Message delivery failed")
+				if delivery == nil {
+					break
+				}
+				err := fmt.Errorf("delivery failed: %v", ev.TopicPartition.Error)
+				if ev.TopicPartition.Topic != nil && *ev.TopicPartition.Topic == p.dlqTopic {
+					// The dead letter itself did not make it, the file is the last resort
+					p.deadLetterToFile(delivery.event, err)
+				} else if p.deadLettering() {
+					_ = p.deadLetter(context.Background(), delivery.event, err)
+				}
 			}
 		case kafka.Error:
 			p.logger.WithError(ev).Error("Kafka error")
@@ -246,10 +454,32 @@ func (p *KafkaPublisher) handleDeliveryReports() {
 	}
 }
 
-// MockPublisher implements Publisher interface for testing
+// deadLetterToFile appends a dead letter that failed delivery to the dead-letter topic
+// with err to the dead-letter file, or logs it as lost without one
+func (p *KafkaPublisher) deadLetterToFile(event *Event, err error) {
+	entry := p.logger.WithFields(logrus.Fields{
+		"event_id":   event.ID,
+		"event_type": event.Type,
+	})
+	if p.dlqFile == nil {
+		entry.WithError(err).Error("Failed to dead-letter event")
+		return
+	}
+	if fileErr := p.dlqFile.append(event); fileErr != nil {
+		entry.WithError(fileErr).Error("Failed to dead-letter event")
+		return
+	}
+	entry.WithError(err).WithField("dead_letter", p.dlqFile.path).Warn("Event dead-lettered")
+}
+
+// MockPublisher implements Publisher interface for testing. It is safe for concurrent
+// use, since batched events are published from a background goroutine
 type MockPublisher struct {
+	mu          sync.Mutex
 	events      []*Event
+	deadLetters []*Event
 	shouldError bool
+	useDLQ      bool
 	logger      *logrus.Logger
 }
 
@@ -263,8 +493,15 @@ func NewMockPublisher(logger *logrus.Logger) *MockPublisher {
 
 // Publish stores the event in memory for testing
 func (m *MockPublisher) Publish(ctx context.Context, event *Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if m.shouldError {
-		return fmt.Errorf("mock error")
+		err := fmt.Errorf("mock error")
+		if m.useDLQ {
+			markDeadLettered(event, err)
+			m.deadLetters = append(m.deadLetters, event)
+		}
+		return err
 	}
 	
 	m.events = append(m.events, event)
@@ -279,6 +516,8 @@ func (m *MockPublisher) Publish(ctx context.Context, event *Event) error {
 
 // PublishBatch stores multiple events in memory for testing
 func (m *MockPublisher) PublishBatch(ctx context.Context, events []*Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if m.shouldError {
 		return fmt.Errorf("mock batch error")
 	}
@@ -296,15 +535,36 @@ func (m *MockPublisher) Close() error {
 
 // GetPublishedEvents returns all published events (for testing)
 func (m *MockPublisher) GetPublishedEvents() []*Event {
-	return m.events
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*Event(nil), m.events...)
 }
 
 // SetShouldError makes the mock publisher return errors (for testing)
 func (m *MockPublisher) SetShouldError(shouldError bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.shouldError = shouldError
 }
 
+// SetDeadLetterQueue makes failed publishes route the event to the dead letters, like
+// KafkaPublisher with a dead-letter topic (for testing)
+func (m *MockPublisher) SetDeadLetterQueue(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.useDLQ = enabled
+}
+
+// GetDeadLetteredEvents returns the events routed to the dead letters (for testing)
+func (m *MockPublisher) GetDeadLetteredEvents() []*Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*Event(nil), m.deadLetters...)
+}
+
 // ClearEvents clears all stored events (for testing)
 func (m *MockPublisher) ClearEvents() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.events = make([]*Event, 0)
 }
\ No newline at end of file
@@ -0,0 +1,277 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProducer acknowledges every message after ackDelay, like a broker round trip,
+// failing the ones produced to failTopic, or to any topic when it is "*", and the
+// first delivery of the event with ID failEvent
+type fakeProducer struct {
+	ackDelay  time.Duration
+	failTopic string
+	failEvent string
+	events    chan kafka.Event
+
+	mu         sync.Mutex
+	produced   []*kafka.Message
+	failedOnce bool
+	inFlight   sync.WaitGroup
+}
+
+func newFakeProducer(ackDelay time.Duration) *fakeProducer {
+	return &fakeProducer{ackDelay: ackDelay, events: make(chan kafka.Event, 1024)}
+}
+
+func (p *fakeProducer) Produce(msg *kafka.Message, deliveryChan chan kafka.Event) error {
+	p.mu.Lock()
+	p.produced = append(p.produced, msg)
+	fail := p.failTopic == "*" || *msg.TopicPartition.Topic == p.failTopic
+	if !p.failedOnce && p.failEvent != "" && string(msg.Headers[0].Value) == p.failEvent {
+		p.failedOnce = true
+		fail = true
+	}
+	p.mu.Unlock()
+
+	p.inFlight.Add(1)
+	go func() {
+		defer p.inFlight.Done()
+		time.Sleep(p.ackDelay)
+		if fail {
+			msg.TopicPartition.Error = kafka.NewError(kafka.ErrMsgTimedOut, "message timed out", false)
+		}
+		if deliveryChan == nil {
+			deliveryChan = p.events
+		}
+		deliveryChan <- msg
+	}()
+	return nil
+}
+
+func (p *fakeProducer) Events() chan kafka.Event { return p.events }
+
+func (p *fakeProducer) Flush(int) int {
+	p.inFlight.Wait()
+	return 0
+}
+
+func (p *fakeProducer) Close() {
+	p.inFlight.Wait()
+	close(p.events)
+}
+
+func (p *fakeProducer) GetMetadata(*string, bool, int) (*kafka.Metadata, error) {
+	return &kafka.Metadata{}, nil
+}
+
+func (p *fakeProducer) topics() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	topics := make([]string, len(p.produced))
+	for i, msg := range p.produced {
+		topics[i] = *msg.TopicPartition.Topic
+	}
+	return topics
+}
+
+func quietLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func TestKafkaPublisher_SyncDelivery(t *testing.T) {
+	producer := newFakeProducer(0)
+	producer.failTopic = "arcanus-events"
+	publisher := newKafkaPublisher(producer, KafkaConfig{Topic: "arcanus-events", DLQTopic: "arcanus-events-dlq", SyncDelivery: true}, quietLogger())
+	defer publisher.Close()
+
+	err := publisher.Publish(context.Background(), NewUserRegisteredEvent(1, "user", "Test", "User", 1024))
+
+	assert.ErrorContains(t, err, "dead-lettered to arcanus-events-dlq", "the failure reaches the caller")
+	assert.Equal(t, []string{"arcanus-events", "arcanus-events-dlq"}, producer.topics())
+}
+
+func TestKafkaPublisher_DeadLetter(t *testing.T) {
+	producer := newFakeProducer(0)
+	publisher := newKafkaPublisher(producer, KafkaConfig{Topic: "arcanus-events", DLQTopic: "arcanus-events-dlq", SyncDelivery: true}, quietLogger())
+	defer publisher.Close()
+
+	event := NewUserQuotaUpdatedEvent(123, 0, 100)
+	require.NoError(t, publisher.DeadLetter(context.Background(), event, errors.New("database unavailable")))
+	assert.Equal(t, []string{"arcanus-events-dlq"}, producer.topics())
+	assert.Equal(t, "database unavailable", event.Metadata[DeadLetterReasonKey])
+
+	withoutDLQ := newKafkaPublisher(newFakeProducer(0), KafkaConfig{Topic: "arcanus-events"}, quietLogger())
+	defer withoutDLQ.Close()
+	assert.Error(t, withoutDLQ.DeadLetter(context.Background(), event, errors.New("database unavailable")))
+}
+
+func TestKafkaPublisher_DeadLetterFile(t *testing.T) {
+	t.Run("Falls back to the file when the dead-letter topic fails", func(t *testing.T) {
+		producer := newFakeProducer(0)
+		producer.failTopic = "arcanus-events-dlq"
+		path := filepath.Join(t.TempDir(), "dlq.jsonl")
+		publisher := newKafkaPublisher(producer, KafkaConfig{Topic: "arcanus-events", DLQTopic: "arcanus-events-dlq", DLQFile: path, SyncDelivery: true}, quietLogger())
+		defer publisher.Close()
+
+		event := NewUserQuotaUpdatedEvent(123, 0, 100)
+		require.NoError(t, publisher.DeadLetter(context.Background(), event, errors.New("database unavailable")))
+
+		saved := readDeadLetterFile(t, path)
+		require.Len(t, saved, 1)
+		assert.Equal(t, event.ID, saved[0].ID)
+		assert.Equal(t, "database unavailable", saved[0].Metadata[DeadLetterReasonKey])
+	})
+
+	t.Run("Async dead letters that fail delivery are saved to the file", func(t *testing.T) {
+		producer := newFakeProducer(0)
+		producer.failTopic = "*"
+		path := filepath.Join(t.TempDir(), "dlq.jsonl")
+		publisher := newKafkaPublisher(producer, KafkaConfig{Topic: "arcanus-events", DLQTopic: "arcanus-events-dlq", DLQFile: path}, quietLogger())
+
+		event := NewUserRegisteredEvent(1, "user", "Test", "User", 1024)
+		require.NoError(t, publisher.Publish(context.Background(), event))
+		require.Eventually(t, func() bool {
+			_, err := os.Stat(path)
+			return err == nil
+		}, time.Second, 10*time.Millisecond)
+		require.NoError(t, publisher.Close())
+
+		assert.Equal(t, []string{"arcanus-events", "arcanus-events-dlq"}, producer.topics())
+		saved := readDeadLetterFile(t, path)
+		require.Len(t, saved, 1)
+		assert.Equal(t, event.ID, saved[0].ID)
+	})
+}
+
+func TestKafkaPublisher_PublishBatch_DeadLettersFailures(t *testing.T) {
+	producer := newFakeProducer(0)
+	producer.failEvent = "failing"
+	publisher := newKafkaPublisher(producer, KafkaConfig{Topic: "arcanus-events", DLQTopic: "arcanus-events-dlq", SyncDelivery: true}, quietLogger())
+	defer publisher.Close()
+
+	delivered := NewUserRegisteredEvent(1, "user", "Test", "User", 1024)
+	failing := NewUserRegisteredEvent(2, "other", "Test", "User", 1024)
+	failing.ID = "failing"
+
+	err := publisher.PublishBatch(context.Background(), []*Event{delivered, failing})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to publish 1 of 2 events")
+	assert.Contains(t, err.Error(), "dead-lettered to arcanus-events-dlq")
+	assert.Equal(t, []string{"arcanus-events", "arcanus-events", "arcanus-events-dlq"}, producer.topics())
+	assert.Contains(t, failing.Metadata[DeadLetterReasonKey], "message timed out")
+	assert.NotContains(t, delivered.Metadata, DeadLetterReasonKey)
+}
+
+// readDeadLetterFile decodes the events of a dead-letter file
+func readDeadLetterFile(t *testing.T, path string) []*Event {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var saved []*Event
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		event, err := FromJSON([]byte(line))
+		require.NoError(t, err)
+		saved = append(saved, event)
+	}
+	return saved
+}
+
+func TestKafkaPublisher_AsyncDelivery(t *testing.T) {
+	t.Run("Publish returns before delivery", func(t *testing.T) {
+		producer := newFakeProducer(time.Hour)
+		publisher := newKafkaPublisher(producer, KafkaConfig{Topic: "arcanus-events"}, quietLogger())
+
+		done := make(chan error, 1)
+		go func() {
+			done <- publisher.Publish(context.Background(), NewUserRegisteredEvent(1, "user", "Test", "User", 1024))
+		}()
+
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("Publish waited for the delivery")
+		}
+		assert.Equal(t, []string{"arcanus-events"}, producer.topics())
+	})
+
+	t.Run("Failed delivery is dead-lettered and its latency recorded", func(t *testing.T) {
+		producer := newFakeProducer(0)
+		producer.failTopic = "arcanus-events"
+		publisher := newKafkaPublisher(producer, KafkaConfig{Topic: "arcanus-events", DLQTopic: "arcanus-events-dlq"}, quietLogger())
+		recorded := make(chan string, 2)
+		publisher.SetLatencyRecorder(func(eventType string, _ time.Duration) { recorded <- eventType })
+
+		event := NewUserRegisteredEvent(1, "user", "Test", "User", 1024)
+		require.NoError(t, publisher.Publish(context.Background(), event))
+
+		for i := 0; i < 2; i++ {
+			select {
+			case eventType := <-recorded:
+				assert.Equal(t, string(EventUserRegistered), eventType)
+			case <-time.After(time.Second):
+				t.Fatal("delivery report was not handled")
+			}
+		}
+		assert.Equal(t, []string{"arcanus-events", "arcanus-events-dlq"}, producer.topics())
+		assert.Contains(t, event.Metadata[DeadLetterReasonKey], "message timed out")
+		require.NoError(t, publisher.Close())
+	})
+
+	t.Run("Batch is queued without waiting", func(t *testing.T) {
+		producer := newFakeProducer(time.Hour)
+		publisher := newKafkaPublisher(producer, KafkaConfig{Topic: "arcanus-events"}, quietLogger())
+
+		batch := []*Event{
+			NewUserRegisteredEvent(1, "user", "Test", "User", 1024),
+			NewUserRegisteredEvent(2, "other", "Test", "User", 1024),
+		}
+		assert.NoError(t, publisher.PublishBatch(context.Background(), batch))
+		assert.Len(t, producer.topics(), 2)
+	})
+}
+
+// BenchmarkKafkaPublisher_Publish compares publishing through a producer whose broker
+// takes a millisecond to acknowledge, waiting for each event or only queueing it
+func BenchmarkKafkaPublisher_Publish(b *testing.B) {
+	for _, mode := range []struct {
+		name string
+		sync bool
+	}{
+		{"sync", true},
+		{"async", false},
+	} {
+		b.Run(mode.name, func(b *testing.B) {
+			producer := newFakeProducer(time.Millisecond)
+			publisher := newKafkaPublisher(producer, KafkaConfig{Topic: "arcanus-events", SyncDelivery: mode.sync}, quietLogger())
+			event := NewUserRegisteredEvent(1, "user", "Test", "User", 1024)
+			ctx := context.Background()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := publisher.Publish(ctx, event); err != nil {
+					b.Fatal(err)
+				}
+			}
+			// Queued events only count once delivered
+			publisher.Close()
+		})
+	}
+}
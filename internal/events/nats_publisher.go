@@ -0,0 +1,170 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
+)
+
+// natsConnection is the part of the NATS connection NatsPublisher relies on
+type natsConnection interface {
+	PublishMsg(msg *nats.Msg) error
+	FlushWithContext(ctx context.Context) error
+	Drain() error
+}
+
+// NatsPublisher implements event publishing to NATS, for deployments without Kafka
+type NatsPublisher struct {
+	conn    natsConnection
+	subject string
+	logger  *logrus.Logger
+}
+
+// NatsConfig holds NATS configuration
+type NatsConfig struct {
+	URL string
+	// Subject prefixes the subject of every event, which ends with the event's
+	// partition key, e.g. "arcanus.events.user_123". Subscribing to "arcanus.events.>"
+	// receives all events
+	Subject string
+}
+
+// NewNatsPublisher connects to NATS and creates an event publisher
+func NewNatsPublisher(config NatsConfig, logger *logrus.Logger) (*NatsPublisher, error) {
+	conn, err := nats.Connect(config.URL,
+		nats.Name(kafkaClientID),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				logger.WithError(err).Warn("Disconnected from NATS")
+			}
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			logger.WithField("url", conn.ConnectedUrlRedacted()).Info("Reconnected to NATS")
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	return newNatsPublisher(conn, config, logger), nil
+}
+
+// newNatsPublisher creates a publisher publishing through conn
+func newNatsPublisher(conn natsConnection, config NatsConfig, logger *logrus.Logger) *NatsPublisher {
+	return &NatsPublisher{
+		conn:    conn,
+		subject: config.Subject,
+		logger:  logger,
+	}
+}
+
+// Publish publishes a single event and waits for the server to receive it
+func (p *NatsPublisher) Publish(ctx context.Context, event *Event) error {
+	if err := p.publish(event); err != nil {
+		return err
+	}
+	if err := p.flush(ctx); err != nil {
+		return err
+	}
+
+	p.logger.WithFields(logrus.Fields{
+		"event_id":   event.ID,
+		"event_type": event.Type,
+		"user_id":    event.UserID,
+	}).Debug("Event published successfully")
+	return nil
+}
+
+// PublishBatch publishes multiple events and waits once for the server to receive
+// all of them
+func (p *NatsPublisher) PublishBatch(ctx context.Context, events []*Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	for _, event := range events {
+		if err := p.publish(event); err != nil {
+			return fmt.Errorf("failed to publish event %s: %w", event.ID, err)
+		}
+	}
+	if err := p.flush(ctx); err != nil {
+		return err
+	}
+
+	p.logger.WithField("batch_size", len(events)).Debug("Event batch published successfully")
+	return nil
+}
+
+// publish writes an event to the connection's outgoing buffer
+func (p *NatsPublisher) publish(event *Event) error {
+	eventData, err := event.ToJSON()
+	if err != nil {
+		return fmt.Errorf("failed to serialize event: %w", err)
+	}
+
+	msg := nats.NewMsg(p.subjectFor(event))
+	msg.Data = eventData
+	msg.Header.Set("event_id", event.ID)
+	msg.Header.Set("event_type", string(event.Type))
+	msg.Header.Set("version", event.Version)
+	msg.Header.Set("timestamp", event.Timestamp.Format(time.RFC3339))
+	// The same source as events published to Kafka, so consumers treat them alike
+	msg.Header.Set("source", kafkaClientID)
+	if event.UserID != nil {
+		msg.Header.Set("user_id", strconv.FormatInt(*event.UserID, 10))
+	}
+	if event.CorrelationID != nil {
+		msg.Header.Set("correlation_id", *event.CorrelationID)
+	}
+
+	if err := p.conn.PublishMsg(msg); err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	return nil
+}
+
+// flush waits for the server to receive everything published so far
+func (p *NatsPublisher) flush(ctx context.Context) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+	}
+	if err := p.conn.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("failed to flush NATS connection: %w", err)
+	}
+	return nil
+}
+
+// subjectFor returns the subject an event is published to. Like the Kafka partition
+// key it keeps every event of a user on the same subject, so subscribers can follow
+// one user and receive their events in order
+func (p *NatsPublisher) subjectFor(event *Event) string {
+	return p.subject + "." + event.GetPartitionKey()
+}
+
+// Close publishes anything still buffered and closes the connection
+func (p *NatsPublisher) Close() error {
+	if err := p.conn.Drain(); err != nil {
+		return fmt.Errorf("failed to drain NATS connection: %w", err)
+	}
+	return nil
+}
+
+// Ping checks that the server is reachable with a round trip
+func (p *NatsPublisher) Ping(ctx context.Context) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultPingTimeout)
+		defer cancel()
+	}
+	if err := p.conn.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("failed to reach NATS server: %w", err)
+	}
+	return nil
+}
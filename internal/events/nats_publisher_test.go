@@ -0,0 +1,108 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNatsConnection records published messages; a flush hands them to the server
+type fakeNatsConnection struct {
+	flushErr error
+
+	mu        sync.Mutex
+	buffered  []*nats.Msg
+	delivered []*nats.Msg
+	flushes   int
+	drained   bool
+}
+
+func (c *fakeNatsConnection) PublishMsg(msg *nats.Msg) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buffered = append(c.buffered, msg)
+	return nil
+}
+
+func (c *fakeNatsConnection) FlushWithContext(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flushes++
+	if c.flushErr != nil {
+		return c.flushErr
+	}
+	c.delivered = append(c.delivered, c.buffered...)
+	c.buffered = nil
+	return nil
+}
+
+func (c *fakeNatsConnection) Drain() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.drained = true
+	return nil
+}
+
+func TestNatsPublisher_Publish(t *testing.T) {
+	conn := &fakeNatsConnection{}
+	publisher := newNatsPublisher(conn, NatsConfig{Subject: "arcanus.events"}, quietLogger())
+
+	event := NewUserRegisteredEvent(123, "user", "Test", "User", 1024)
+	event.SetCorrelationID("correlation-1")
+	require.NoError(t, publisher.Publish(context.Background(), event))
+
+	require.Len(t, conn.delivered, 1)
+	msg := conn.delivered[0]
+	assert.Equal(t, "arcanus.events.user_123", msg.Subject, "events of a user share a subject")
+	assert.Equal(t, event.ID, msg.Header.Get("event_id"))
+	assert.Equal(t, string(EventUserRegistered), msg.Header.Get("event_type"))
+	assert.Equal(t, "123", msg.Header.Get("user_id"))
+	assert.Equal(t, "correlation-1", msg.Header.Get("correlation_id"))
+	assert.Equal(t, "arcanus-vpn-bot", msg.Header.Get("source"))
+
+	decoded, err := FromJSON(msg.Data)
+	require.NoError(t, err)
+	assert.Equal(t, event.ID, decoded.ID)
+
+	require.NoError(t, publisher.Close())
+	assert.True(t, conn.drained)
+}
+
+func TestNatsPublisher_SystemEventSubject(t *testing.T) {
+	conn := &fakeNatsConnection{}
+	publisher := newNatsPublisher(conn, NatsConfig{Subject: "arcanus.events"}, quietLogger())
+
+	require.NoError(t, publisher.Publish(context.Background(), NewEvent(EventSystemStartup, nil, map[string]interface{}{})))
+
+	require.Len(t, conn.delivered, 1)
+	assert.Equal(t, "arcanus.events."+string(EventSystemStartup), conn.delivered[0].Subject)
+}
+
+func TestNatsPublisher_PublishBatch(t *testing.T) {
+	conn := &fakeNatsConnection{}
+	publisher := newNatsPublisher(conn, NatsConfig{Subject: "arcanus.events"}, quietLogger())
+
+	batch := []*Event{
+		NewUserRegisteredEvent(1, "user", "Test", "User", 1024),
+		NewUserRegisteredEvent(2, "other", "Test", "User", 1024),
+	}
+	require.NoError(t, publisher.PublishBatch(context.Background(), batch))
+
+	assert.Len(t, conn.delivered, 2)
+	assert.Equal(t, 1, conn.flushes, "a batch waits for the server once")
+}
+
+func TestNatsPublisher_FlushError(t *testing.T) {
+	conn := &fakeNatsConnection{flushErr: errors.New("nats: connection closed")}
+	publisher := newNatsPublisher(conn, NatsConfig{Subject: "arcanus.events"}, quietLogger())
+
+	err := publisher.Publish(context.Background(), NewUserRegisteredEvent(1, "user", "Test", "User", 1024))
+
+	assert.ErrorContains(t, err, "connection closed")
+	assert.ErrorContains(t, publisher.Ping(context.Background()), "failed to reach NATS server")
+}
@@ -0,0 +1,66 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// SchemaVersion is the version of the event shape this build publishes
+const SchemaVersion = "1.0"
+
+// ErrUnsupportedVersion is returned when decoding an event of a version this build
+// cannot upgrade, typically one published by a newer build
+var ErrUnsupportedVersion = errors.New("unsupported event version")
+
+// schemaMigration upgrades a decoded event payload to the version after from
+type schemaMigration struct {
+	to      string
+	migrate func(raw map[string]interface{})
+}
+
+// schemaMigrations are keyed by the version they upgrade from. Upgrading an old
+// payload applies them in turn until it reaches SchemaVersion
+var schemaMigrations = map[string]schemaMigration{
+	// 0.9 named the time the event occurred occurred_at
+	"0.9": {to: "1.0", migrate: func(raw map[string]interface{}) {
+		renameKey(raw, "occurred_at", "timestamp")
+	}},
+}
+
+// upgradeEvent decodes an event payload of an older version, upgrades it to
+// SchemaVersion and re-encodes it
+func upgradeEvent(data []byte, version string) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// Keep numbers as written so IDs survive the round trip unchanged
+	decoder.UseNumber()
+	var raw map[string]interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	for version != SchemaVersion {
+		migration, ok := schemaMigrations[version]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedVersion, version)
+		}
+		migration.migrate(raw)
+		version = migration.to
+	}
+	raw["version"] = SchemaVersion
+
+	return json.Marshal(raw)
+}
+
+// renameKey moves the value of from to to, unless to is already set
+func renameKey(raw map[string]interface{}, from, to string) {
+	value, ok := raw[from]
+	if !ok {
+		return
+	}
+	delete(raw, from)
+	if _, exists := raw[to]; !exists {
+		raw[to] = value
+	}
+}
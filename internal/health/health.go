@@ -0,0 +1,117 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// StatusUp means the application or component is healthy
+	StatusUp = "up"
+	// StatusDown means the application or component is unhealthy
+	StatusDown = "down"
+)
+
+// DefaultCheckTimeout bounds each readiness check
+const DefaultCheckTimeout = 5 * time.Second
+
+// Check verifies a single dependency
+type Check func(ctx context.Context) error
+
+// ComponentStatus is the result of a single readiness check
+type ComponentStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Response is the JSON body returned by the probe endpoints
+type Response struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components,omitempty"`
+}
+
+// namedCheck is a registered readiness check
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker serves liveness and readiness probes
+type Checker struct {
+	timeout time.Duration
+	checks  []namedCheck
+}
+
+// NewChecker creates a new checker with the given per-check timeout
+func NewChecker(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+	return &Checker{timeout: timeout}
+}
+
+// AddCheck registers a readiness check for a component
+func (c *Checker) AddCheck(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Ready runs all readiness checks concurrently and reports each component
+func (c *Checker) Ready(ctx context.Context) Response {
+	response := Response{Status: StatusUp, Components: make(map[string]ComponentStatus, len(c.checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, nc := range c.checks {
+		wg.Add(1)
+		go func(nc namedCheck) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			status := ComponentStatus{Status: StatusUp}
+			if err := nc.check(checkCtx); err != nil {
+				status = ComponentStatus{Status: StatusDown, Error: err.Error()}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			response.Components[nc.name] = status
+			if status.Status == StatusDown {
+				response.Status = StatusDown
+			}
+		}(nc)
+	}
+	wg.Wait()
+
+	return response
+}
+
+// LivenessHandler reports that the process is up
+func (c *Checker) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeResponse(w, http.StatusOK, Response{Status: StatusUp})
+	})
+}
+
+// ReadinessHandler reports whether all dependencies are reachable, with 503 when any is down
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := c.Ready(r.Context())
+		code := http.StatusOK
+		if response.Status != StatusUp {
+			code = http.StatusServiceUnavailable
+		}
+		writeResponse(w, code, response)
+	})
+}
+
+// writeResponse writes a JSON probe response
+func writeResponse(w http.ResponseWriter, code int, response Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,77 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(t *testing.T, handler http.Handler) (int, Response) {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	var response Response
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	return recorder.Code, response
+}
+
+func TestChecker_Liveness(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.AddCheck("database", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+
+	code, response := serve(t, checker.LivenessHandler())
+
+	assert.Equal(t, http.StatusOK, code, "liveness does not depend on dependencies")
+	assert.Equal(t, StatusUp, response.Status)
+}
+
+func TestChecker_ReadinessAllUp(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.AddCheck("database", func(ctx context.Context) error { return nil })
+	checker.AddCheck("kafka", func(ctx context.Context) error { return nil })
+
+	code, response := serve(t, checker.ReadinessHandler())
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusUp, response.Status)
+	assert.Equal(t, map[string]ComponentStatus{
+		"database": {Status: StatusUp},
+		"kafka":    {Status: StatusUp},
+	}, response.Components)
+}
+
+func TestChecker_ReadinessComponentDown(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.AddCheck("database", func(ctx context.Context) error { return errors.New("connection refused") })
+	checker.AddCheck("kafka", func(ctx context.Context) error { return nil })
+
+	code, response := serve(t, checker.ReadinessHandler())
+
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusDown, response.Status)
+	assert.Equal(t, ComponentStatus{Status: StatusDown, Error: "connection refused"}, response.Components["database"])
+	assert.Equal(t, StatusUp, response.Components["kafka"].Status)
+}
+
+func TestChecker_ReadinessTimeout(t *testing.T) {
+	checker := NewChecker(10 * time.Millisecond)
+	checker.AddCheck("database", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	response := checker.Ready(context.Background())
+
+	assert.Equal(t, StatusDown, response.Status)
+	assert.Contains(t, response.Components["database"].Error, "deadline exceeded")
+}
@@ -0,0 +1,122 @@
+// Package i18n provides the translated message catalogs used by the bot
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// DefaultLanguage is used for languages without a catalog and messages missing from one
+const DefaultLanguage = "en"
+
+// Catalog maps message IDs to their translation. Translations may contain fmt verbs
+type Catalog map[string]string
+
+// Translator looks up messages by language, falling back to the default language
+type Translator struct {
+	catalogs map[string]Catalog
+	fallback string
+}
+
+// NewTranslator creates a translator over catalogs keyed by language code. The
+// fallback language must have a catalog
+func NewTranslator(catalogs map[string]Catalog, fallback string) (*Translator, error) {
+	normalized := make(map[string]Catalog, len(catalogs))
+	for lang, catalog := range catalogs {
+		normalized[Normalize(lang)] = catalog
+	}
+
+	fallback = Normalize(fallback)
+	if _, ok := normalized[fallback]; !ok {
+		return nil, fmt.Errorf("no catalog for fallback language %q", fallback)
+	}
+
+	return &Translator{catalogs: normalized, fallback: fallback}, nil
+}
+
+// LoadCatalogs reads every <lang>.json file in dir of fsys as a catalog
+func LoadCatalogs(fsys fs.FS, dir string) (map[string]Catalog, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list catalogs: %w", err)
+	}
+
+	catalogs := make(map[string]Catalog, len(files))
+	for _, file := range files {
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read catalog %s: %w", file, err)
+		}
+
+		var catalog Catalog
+		if err := json.Unmarshal(content, &catalog); err != nil {
+			return nil, fmt.Errorf("failed to parse catalog %s: %w", file, err)
+		}
+		catalogs[strings.TrimSuffix(path.Base(file), ".json")] = catalog
+	}
+	return catalogs, nil
+}
+
+// Default creates a translator over the built-in catalogs
+func Default() *Translator {
+	catalogs, err := LoadCatalogs(locales, "locales")
+	if err != nil {
+		// The catalogs are embedded in the binary, so this is a programming error
+		panic(err)
+	}
+
+	translator, err := NewTranslator(catalogs, DefaultLanguage)
+	if err != nil {
+		panic(err)
+	}
+	return translator
+}
+
+// Normalize reduces a Telegram language code such as "pt-BR" to its language, "pt"
+func Normalize(code string) string {
+	language, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(code)), "-")
+	language, _, _ = strings.Cut(language, "_")
+	return language
+}
+
+// Get returns the message id in lang formatted with args. Unknown languages and
+// messages missing from a catalog use the fallback language; a message missing
+// there too is returned as its id so the gap is visible
+func (t *Translator) Get(lang, id string, args ...any) string {
+	message, ok := t.catalogs[Normalize(lang)][id]
+	if !ok {
+		message, ok = t.catalogs[t.fallback][id]
+	}
+	if !ok {
+		return id
+	}
+
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// Supports reports whether lang has a catalog of its own
+func (t *Translator) Supports(lang string) bool {
+	_, ok := t.catalogs[Normalize(lang)]
+	return ok
+}
+
+// Languages returns the languages with a catalog, sorted
+func (t *Translator) Languages() []string {
+	languages := make([]string, 0, len(t.catalogs))
+	for lang := range t.catalogs {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	return languages
+}
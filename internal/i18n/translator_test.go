@@ -0,0 +1,82 @@
+package i18n
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTranslator(t *testing.T) *Translator {
+	translator, err := NewTranslator(map[string]Catalog{
+		"en": {"greeting": "Hello, %s!", "bye": "Goodbye"},
+		"ru": {"greeting": "Привет, %s!"},
+	}, "en")
+	require.NoError(t, err)
+	return translator
+}
+
+func TestTranslator_Get(t *testing.T) {
+	translator := newTestTranslator(t)
+
+	assert.Equal(t, "Hello, Ann!", translator.Get("en", "greeting", "Ann"))
+	assert.Equal(t, "Привет, Ann!", translator.Get("ru", "greeting", "Ann"))
+	assert.Equal(t, "Привет, Ann!", translator.Get("ru-RU", "greeting", "Ann"), "regional variants use the base language")
+	assert.Equal(t, "Goodbye", translator.Get("en", "bye"))
+}
+
+func TestTranslator_Fallback(t *testing.T) {
+	translator := newTestTranslator(t)
+
+	assert.Equal(t, "Hello, Ann!", translator.Get("de", "greeting", "Ann"), "unknown language")
+	assert.Equal(t, "Hello, Ann!", translator.Get("", "greeting", "Ann"), "no language")
+	assert.Equal(t, "Goodbye", translator.Get("ru", "bye"), "message missing from the catalog")
+	assert.Equal(t, "missing", translator.Get("ru", "missing"), "message missing everywhere")
+}
+
+func TestNewTranslator_RequiresFallbackCatalog(t *testing.T) {
+	_, err := NewTranslator(map[string]Catalog{"ru": {}}, "en")
+	assert.Error(t, err)
+}
+
+func TestTranslator_Languages(t *testing.T) {
+	translator := newTestTranslator(t)
+
+	assert.Equal(t, []string{"en", "ru"}, translator.Languages())
+	assert.True(t, translator.Supports("RU"))
+	assert.False(t, translator.Supports("es"))
+}
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, "pt", Normalize("pt-BR"))
+	assert.Equal(t, "pt", Normalize("pt_br"))
+	assert.Equal(t, "en", Normalize(" EN "))
+	assert.Equal(t, "", Normalize(""))
+}
+
+func TestLoadCatalogs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"locales/en.json":   {Data: []byte(`{"greeting": "Hello"}`)},
+		"locales/notes.txt": {Data: []byte("ignored")},
+	}
+	catalogs, err := LoadCatalogs(fsys, "locales")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Catalog{"en": {"greeting": "Hello"}}, catalogs)
+
+	fsys["locales/ru.json"] = &fstest.MapFile{Data: []byte("{")}
+	_, err = LoadCatalogs(fsys, "locales")
+	assert.Error(t, err)
+}
+
+func TestDefault_CatalogsAreComplete(t *testing.T) {
+	translator := Default()
+
+	assert.Equal(t, []string{"en", "es", "ru"}, translator.Languages())
+	for _, lang := range translator.Languages() {
+		assert.Len(t, translator.catalogs[lang], len(translator.catalogs[DefaultLanguage]), lang)
+		for id := range translator.catalogs[DefaultLanguage] {
+			assert.Contains(t, translator.catalogs[lang], id, lang)
+		}
+	}
+}
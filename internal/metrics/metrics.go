@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+)
+
+// Request types recorded by the metrics middleware
+const (
+	RequestTypeMessage  = "message"
+	RequestTypeCallback = "callback"
+)
+
+// DefaultDurationBuckets are the handler duration histogram buckets in seconds
+var DefaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// eventTypeLabel labels the event publish latency histograms
+const eventTypeLabel = "event_type"
+
+// statusLabel labels the user count gauges
+const statusLabel = "status"
+
+// commandLabel labels the per-command metrics
+const commandLabel = "command"
+
+// updateTypeLabel labels the unsupported update counter
+const updateTypeLabel = "update_type"
+
+// Metrics holds the bot's Prometheus metrics
+type Metrics struct {
+	registry *Registry
+
+	MessagesProcessed  *Counter
+	CallbacksProcessed *Counter
+	Errors             *Counter
+	HandlerDuration    *Histogram
+	ActiveUsers        *Gauge
+	// UsersByStatus is the number of users with each account status
+	UsersByStatus *GaugeVec
+
+	// EventPublishDuration is the time the event service spent publishing an event
+	EventPublishDuration *HistogramVec
+	// KafkaDeliveryDuration is the time from producing an event to its Kafka delivery report
+	KafkaDeliveryDuration *HistogramVec
+
+	// CommandsExecuted, CommandErrors and CommandDuration break command handling down
+	// by command name
+	CommandsExecuted *CounterVec
+	CommandErrors    *CounterVec
+	CommandDuration  *HistogramVec
+
+	// UnsupportedUpdates counts updates the bot has no handler for, such as edited
+	// messages and channel posts, by update type
+	UnsupportedUpdates *CounterVec
+}
+
+// New creates the bot metrics on a fresh registry
+func New() *Metrics {
+	registry := NewRegistry()
+	return &Metrics{
+		registry:           registry,
+		MessagesProcessed:  registry.NewCounter("arcanus_messages_processed_total", "Total number of messages processed."),
+		CallbacksProcessed: registry.NewCounter("arcanus_callbacks_processed_total", "Total number of callback queries processed."),
+		Errors:             registry.NewCounter("arcanus_handler_errors_total", "Total number of updates whose handler returned an error."),
+		HandlerDuration:    registry.NewHistogram("arcanus_handler_duration_seconds", "Time spent handling an update.", DefaultDurationBuckets),
+		ActiveUsers:        registry.NewGauge("arcanus_active_users", "Number of users with an active or trial account."),
+		UsersByStatus:      registry.NewGaugeVec("arcanus_users", "Number of users, by account status.", statusLabel),
+		EventPublishDuration: registry.NewHistogramVec("arcanus_event_publish_duration_seconds",
+			"Time spent publishing an event, by event type.", eventTypeLabel, DefaultDurationBuckets),
+		KafkaDeliveryDuration: registry.NewHistogramVec("arcanus_kafka_delivery_duration_seconds",
+			"Time from producing an event to its Kafka delivery report, by event type.", eventTypeLabel, DefaultDurationBuckets),
+		CommandsExecuted: registry.NewCounterVec("arcanus_commands_executed_total",
+			"Total number of commands handled, by command.", commandLabel),
+		CommandErrors: registry.NewCounterVec("arcanus_command_errors_total",
+			"Total number of commands whose handler returned an error, by command.", commandLabel),
+		CommandDuration: registry.NewHistogramVec("arcanus_command_duration_seconds",
+			"Time spent handling a command, by command.", commandLabel, DefaultDurationBuckets),
+		UnsupportedUpdates: registry.NewCounterVec("arcanus_unsupported_updates_total",
+			"Total number of updates the bot has no handler for, by update type.", updateTypeLabel),
+	}
+}
+
+// RecordRequest records a handled request of the given type
+func (m *Metrics) RecordRequest(requestType string, duration time.Duration, err error) {
+	switch requestType {
+	case RequestTypeMessage:
+		m.MessagesProcessed.Inc()
+	case RequestTypeCallback:
+		m.CallbacksProcessed.Inc()
+	}
+	if err != nil {
+		m.Errors.Inc()
+	}
+	m.HandlerDuration.Observe(duration.Seconds())
+}
+
+// RecordCommand records a handled command and whether its handler failed
+func (m *Metrics) RecordCommand(command string, duration time.Duration, err error) {
+	m.CommandsExecuted.WithLabelValue(command).Inc()
+	if err != nil {
+		m.CommandErrors.WithLabelValue(command).Inc()
+	}
+	m.CommandDuration.WithLabelValue(command).Observe(duration.Seconds())
+}
+
+// FloodControlState is the state of the flood controller exported as metrics
+type FloodControlState struct {
+	InCooldown bool  // non-critical sends are paused
+	RecentHits int   // flood waits within the controller's window
+	Queued     int   // sends deferred until the cool down ends
+	Dropped    int64 // sends dropped because the queue was full, since startup
+}
+
+// ObserveFloodControl exports the flood controller state, read through state on every
+// scrape. It must be called at most once per Metrics
+func (m *Metrics) ObserveFloodControl(state func() FloodControlState) {
+	m.registry.NewGaugeFunc("arcanus_flood_cooldown", "Whether non-critical sends are paused after repeated flood waits (1) or not (0).", func() float64 {
+		if state().InCooldown {
+			return 1
+		}
+		return 0
+	})
+	m.registry.NewGaugeFunc("arcanus_flood_recent_hits", "Number of Telegram flood waits within the flood control window.", func() float64 {
+		return float64(state().RecentHits)
+	})
+	m.registry.NewGaugeFunc("arcanus_flood_queued_messages", "Number of non-critical sends deferred until the cool down ends.", func() float64 {
+		return float64(state().Queued)
+	})
+	m.registry.NewCounterFunc("arcanus_flood_dropped_messages_total", "Total number of non-critical sends dropped because the flood control queue was full.", func() float64 {
+		return float64(state().Dropped)
+	})
+}
+
+// RecordUnsupportedUpdate records an update the bot has no handler for
+func (m *Metrics) RecordUnsupportedUpdate(updateType string) {
+	m.UnsupportedUpdates.WithLabelValue(updateType).Inc()
+}
+
+// RecordEventPublish records how long the event service took to publish an event
+func (m *Metrics) RecordEventPublish(eventType string, duration time.Duration) {
+	m.EventPublishDuration.WithLabelValue(eventType).Observe(duration.Seconds())
+}
+
+// RecordKafkaDelivery records how long Kafka took to confirm delivery of an event
+func (m *Metrics) RecordKafkaDelivery(eventType string, duration time.Duration) {
+	m.KafkaDeliveryDuration.WithLabelValue(eventType).Observe(duration.Seconds())
+}
+
+// Handler returns the HTTP handler serving /metrics
+func (m *Metrics) Handler() http.Handler {
+	return m.registry.Handler()
+}
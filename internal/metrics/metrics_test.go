@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics_RecordRequest(t *testing.T) {
+	m := New()
+
+	m.RecordRequest(RequestTypeMessage, 20*time.Millisecond, nil)
+	m.RecordRequest(RequestTypeMessage, 2*time.Second, errors.New("boom"))
+	m.RecordRequest(RequestTypeCallback, 5*time.Millisecond, nil)
+
+	assert.Equal(t, float64(2), m.MessagesProcessed.Value())
+	assert.Equal(t, float64(1), m.CallbacksProcessed.Value())
+	assert.Equal(t, float64(1), m.Errors.Value())
+	assert.Equal(t, uint64(3), m.HandlerDuration.Count())
+}
+
+func TestMetrics_Handler(t *testing.T) {
+	m := New()
+	m.RecordRequest(RequestTypeMessage, 20*time.Millisecond, nil)
+	m.ActiveUsers.Set(42)
+
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, contentType, recorder.Header().Get("Content-Type"))
+
+	body := recorder.Body.String()
+	assert.Contains(t, body, "# TYPE arcanus_messages_processed_total counter\narcanus_messages_processed_total 1\n")
+	assert.Contains(t, body, "# TYPE arcanus_active_users gauge\narcanus_active_users 42\n")
+	assert.Contains(t, body, "# TYPE arcanus_handler_duration_seconds histogram\n")
+	assert.Contains(t, body, `arcanus_handler_duration_seconds_bucket{le="0.01"} 0`)
+	assert.Contains(t, body, `arcanus_handler_duration_seconds_bucket{le="0.025"} 1`)
+	assert.Contains(t, body, `arcanus_handler_duration_seconds_bucket{le="+Inf"} 1`)
+	assert.Contains(t, body, "arcanus_handler_duration_seconds_count 1\n")
+	assert.Less(t, strings.Index(body, "arcanus_active_users"), strings.Index(body, "arcanus_messages_processed_total"), "metrics are sorted by name")
+}
+
+func TestRegistry_DuplicateMetricPanics(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("requests_total", "Requests.")
+
+	assert.Panics(t, func() {
+		registry.NewGauge("requests_total", "Requests.")
+	})
+}
+
+func TestCounter_IgnoresNegativeValues(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounter("requests_total", "Requests.")
+
+	counter.Add(2)
+	counter.Add(-1)
+
+	assert.Equal(t, float64(2), counter.Value())
+}
+
+func TestMetrics_EventPublishLatency(t *testing.T) {
+	m := New()
+	m.RecordEventPublish("user.registered", 20*time.Millisecond)
+	m.RecordEventPublish("user.registered", 3*time.Second)
+	m.RecordKafkaDelivery("system.startup", 5*time.Millisecond)
+
+	assert.Equal(t, uint64(2), m.EventPublishDuration.WithLabelValue("user.registered").Count())
+	assert.Equal(t, uint64(0), m.EventPublishDuration.WithLabelValue("user.deleted").Count())
+
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := recorder.Body.String()
+	assert.Contains(t, body, "# TYPE arcanus_event_publish_duration_seconds histogram\n")
+	assert.Contains(t, body, `arcanus_event_publish_duration_seconds_bucket{event_type="user.registered",le="0.025"} 1`)
+	assert.Contains(t, body, `arcanus_event_publish_duration_seconds_bucket{event_type="user.registered",le="+Inf"} 2`)
+	assert.Contains(t, body, "arcanus_event_publish_duration_seconds_count{event_type=\"user.registered\"} 2\n")
+	assert.Contains(t, body, "arcanus_kafka_delivery_duration_seconds_count{event_type=\"system.startup\"} 1\n")
+}
+
+func TestMetrics_RecordCommand(t *testing.T) {
+	m := New()
+	m.RecordCommand("account", 30*time.Millisecond, errors.New("database unavailable"))
+	m.RecordCommand("account", 10*time.Millisecond, nil)
+	m.RecordCommand("help", time.Millisecond, nil)
+
+	assert.Equal(t, float64(2), m.CommandsExecuted.WithLabelValue("account").Value())
+	assert.Equal(t, float64(1), m.CommandErrors.WithLabelValue("account").Value())
+	assert.Equal(t, float64(0), m.CommandErrors.WithLabelValue("help").Value())
+
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := recorder.Body.String()
+	assert.Contains(t, body, "# TYPE arcanus_commands_executed_total counter\narcanus_commands_executed_total{command=\"account\"} 2\narcanus_commands_executed_total{command=\"help\"} 1\n")
+	assert.Contains(t, body, "arcanus_command_errors_total{command=\"account\"} 1\n")
+	assert.Contains(t, body, "arcanus_command_duration_seconds_count{command=\"account\"} 2\n")
+}
+
+func TestMetrics_RecordUnsupportedUpdate(t *testing.T) {
+	m := New()
+	m.RecordUnsupportedUpdate("edited_message")
+	m.RecordUnsupportedUpdate("edited_message")
+	m.RecordUnsupportedUpdate("channel_post")
+
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Contains(t, recorder.Body.String(), "arcanus_unsupported_updates_total{update_type=\"channel_post\"} 1\narcanus_unsupported_updates_total{update_type=\"edited_message\"} 2\n")
+}
+
+func TestMetrics_ObserveFloodControl(t *testing.T) {
+	m := New()
+	state := FloodControlState{InCooldown: true, RecentHits: 3, Queued: 2, Dropped: 1}
+	m.ObserveFloodControl(func() FloodControlState { return state })
+
+	scrape := func() string {
+		recorder := httptest.NewRecorder()
+		m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return recorder.Body.String()
+	}
+
+	body := scrape()
+	assert.Contains(t, body, "# TYPE arcanus_flood_cooldown gauge\narcanus_flood_cooldown 1\n")
+	assert.Contains(t, body, "arcanus_flood_recent_hits 3\n")
+	assert.Contains(t, body, "arcanus_flood_queued_messages 2\n")
+	assert.Contains(t, body, "# TYPE arcanus_flood_dropped_messages_total counter\narcanus_flood_dropped_messages_total 1\n")
+
+	// The state is read on every scrape
+	state = FloodControlState{Dropped: 4}
+	body = scrape()
+	assert.Contains(t, body, "arcanus_flood_cooldown 0\n")
+	assert.Contains(t, body, "arcanus_flood_queued_messages 0\n")
+	assert.Contains(t, body, "arcanus_flood_dropped_messages_total 4\n")
+}
+
+func TestHistogramVec_EscapesLabelValues(t *testing.T) {
+	registry := NewRegistry()
+	vec := registry.NewHistogramVec("latency_seconds", "Latency.", "kind", []float64{1})
+	vec.WithLabelValue("a\"b\\c").Observe(0.5)
+
+	var sb strings.Builder
+	registry.Write(&sb)
+	assert.Contains(t, sb.String(), `latency_seconds_count{kind="a\"b\\c"} 1`)
+}
+
+func TestMetrics_UsersByStatus(t *testing.T) {
+	m := New()
+	m.UsersByStatus.WithLabelValue("trial").Set(2)
+	m.UsersByStatus.WithLabelValue("active").Set(5)
+
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := recorder.Body.String()
+	assert.Contains(t, body, "# TYPE arcanus_users gauge\narcanus_users{status=\"active\"} 5\narcanus_users{status=\"trial\"} 2\n")
+}
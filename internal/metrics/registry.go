@@ -0,0 +1,399 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// contentType is the Prometheus text exposition format content type
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// collector is a metric that can write itself in the Prometheus text format
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds metrics and serves them in the Prometheus text exposition format
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}
+
+// NewRegistry creates an empty metrics registry
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+// register adds a collector, panicking on duplicate names like prometheus.MustRegister
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.collectors[c.name()]; exists {
+		panic(fmt.Sprintf("metrics: duplicate metric %q", c.name()))
+	}
+	r.collectors[c.name()] = c
+}
+
+// NewCounter creates and registers a counter
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{metricName: name, help: help}
+	r.register(c)
+	return c
+}
+
+// NewCounterVec creates and registers a counter partitioned by the given label
+func (r *Registry) NewCounterVec(name, help, label string) *CounterVec {
+	c := &CounterVec{metricName: name, help: help, label: label, children: make(map[string]*Counter)}
+	r.register(c)
+	return c
+}
+
+// NewGauge creates and registers a gauge
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{metricName: name, help: help}
+	r.register(g)
+	return g
+}
+
+// NewGaugeVec creates and registers a gauge partitioned by the given label
+func (r *Registry) NewGaugeVec(name, help, label string) *GaugeVec {
+	g := &GaugeVec{metricName: name, help: help, label: label, children: make(map[string]*Gauge)}
+	r.register(g)
+	return g
+}
+
+// NewHistogram creates and registers a histogram with the given upper bounds
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	bounds := append([]float64(nil), buckets...)
+	sort.Float64s(bounds)
+	h := &Histogram{metricName: name, help: help, bounds: bounds, counts: make([]uint64, len(bounds))}
+	r.register(h)
+	return h
+}
+
+// NewHistogramVec creates and registers a histogram partitioned by the given label
+func (r *Registry) NewHistogramVec(name, help, label string, buckets []float64) *HistogramVec {
+	bounds := append([]float64(nil), buckets...)
+	sort.Float64s(bounds)
+	h := &HistogramVec{metricName: name, help: help, label: label, bounds: bounds, children: make(map[string]*Histogram)}
+	r.register(h)
+	return h
+}
+
+// NewGaugeFunc creates and registers a gauge whose value is read from fn on every scrape
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&valueFunc{metricName: name, help: help, metricType: "gauge", fn: fn})
+}
+
+// NewCounterFunc creates and registers a counter whose value is read from fn on every
+// scrape. fn must never return less than before
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(&valueFunc{metricName: name, help: help, metricType: "counter", fn: fn})
+}
+
+// Write writes all metrics sorted by name
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	collectors := make([]collector, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		collectors = append(collectors, c)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler returns an HTTP handler serving the metrics
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		r.Write(w)
+	})
+}
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	metricName string
+	help       string
+	mu         sync.Mutex
+	value      float64
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add increases the counter; negative values are ignored
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+	c.mu.Lock()
+	c.value += delta
+	c.mu.Unlock()
+}
+
+// Value returns the current value
+func (c *Counter) Value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+func (c *Counter) name() string { return c.metricName }
+
+func (c *Counter) write(w io.Writer) {
+	writeHeader(w, c.metricName, c.help, "counter")
+	fmt.Fprintf(w, "%s %s\n", c.metricName, formatFloat(c.Value()))
+}
+
+// CounterVec is a counter partitioned by the value of a single label
+type CounterVec struct {
+	metricName string
+	help       string
+	label      string
+	mu         sync.Mutex
+	children   map[string]*Counter
+}
+
+// WithLabelValue returns the counter for a label value, creating it on first use
+func (v *CounterVec) WithLabelValue(value string) *Counter {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.children[value]
+	if !ok {
+		c = &Counter{metricName: v.metricName}
+		v.children[value] = c
+	}
+	return c
+}
+
+func (v *CounterVec) name() string { return v.metricName }
+
+func (v *CounterVec) write(w io.Writer) {
+	v.mu.Lock()
+	values := make([]string, 0, len(v.children))
+	for value := range v.children {
+		values = append(values, value)
+	}
+	v.mu.Unlock()
+	sort.Strings(values)
+
+	writeHeader(w, v.metricName, v.help, "counter")
+	for _, value := range values {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %s\n", v.metricName, v.label, escapeLabelValue(value), formatFloat(v.WithLabelValue(value).Value()))
+	}
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	metricName string
+	help       string
+	mu         sync.Mutex
+	value      float64
+}
+
+// Set sets the gauge value
+func (g *Gauge) Set(value float64) {
+	g.mu.Lock()
+	g.value = value
+	g.mu.Unlock()
+}
+
+// Value returns the current value
+func (g *Gauge) Value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.value
+}
+
+func (g *Gauge) name() string { return g.metricName }
+
+func (g *Gauge) write(w io.Writer) {
+	writeHeader(w, g.metricName, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.metricName, formatFloat(g.Value()))
+}
+
+// valueFunc is a metric whose value is kept elsewhere and read when it is written
+type valueFunc struct {
+	metricName string
+	help       string
+	metricType string
+	fn         func() float64
+}
+
+func (f *valueFunc) name() string { return f.metricName }
+
+func (f *valueFunc) write(w io.Writer) {
+	writeHeader(w, f.metricName, f.help, f.metricType)
+	fmt.Fprintf(w, "%s %s\n", f.metricName, formatFloat(f.fn()))
+}
+
+// GaugeVec is a gauge partitioned by the value of a single label
+type GaugeVec struct {
+	metricName string
+	help       string
+	label      string
+	mu         sync.Mutex
+	children   map[string]*Gauge
+}
+
+// WithLabelValue returns the gauge for a label value, creating it on first use
+func (v *GaugeVec) WithLabelValue(value string) *Gauge {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	g, ok := v.children[value]
+	if !ok {
+		g = &Gauge{metricName: v.metricName}
+		v.children[value] = g
+	}
+	return g
+}
+
+func (v *GaugeVec) name() string { return v.metricName }
+
+func (v *GaugeVec) write(w io.Writer) {
+	v.mu.Lock()
+	values := make([]string, 0, len(v.children))
+	for value := range v.children {
+		values = append(values, value)
+	}
+	v.mu.Unlock()
+	sort.Strings(values)
+
+	writeHeader(w, v.metricName, v.help, "gauge")
+	for _, value := range values {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %s\n", v.metricName, v.label, escapeLabelValue(value), formatFloat(v.WithLabelValue(value).Value()))
+	}
+}
+
+// Histogram counts observations in cumulative buckets
+type Histogram struct {
+	metricName string
+	help       string
+	bounds     []float64
+	mu         sync.Mutex
+	counts     []uint64
+	count      uint64
+	sum        float64
+}
+
+// Observe records a single observation
+func (h *Histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.bounds {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// Count returns the number of observations
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+func (h *Histogram) name() string { return h.metricName }
+
+func (h *Histogram) write(w io.Writer) {
+	writeHeader(w, h.metricName, h.help, "histogram")
+	h.writeSamples(w, "")
+}
+
+// writeSamples writes the bucket, sum and count samples. labels are extra
+// label pairs, such as `event_type="x",`, written before the le label
+func (h *Histogram) writeSamples(w io.Writer, labels string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.bounds {
+		fmt.Fprintf(w, "%s_bucket{%sle=\"%s\"} %d\n", h.metricName, labels, formatFloat(bound), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", h.metricName, labels, h.count)
+	suffix := ""
+	if labels != "" {
+		suffix = "{" + strings.TrimSuffix(labels, ",") + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, suffix, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, suffix, h.count)
+}
+
+// HistogramVec is a histogram partitioned by the value of a single label
+type HistogramVec struct {
+	metricName string
+	help       string
+	label      string
+	bounds     []float64
+	mu         sync.Mutex
+	children   map[string]*Histogram
+}
+
+// WithLabelValue returns the histogram for a label value, creating it on first use
+func (v *HistogramVec) WithLabelValue(value string) *Histogram {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	h, ok := v.children[value]
+	if !ok {
+		h = &Histogram{metricName: v.metricName, bounds: v.bounds, counts: make([]uint64, len(v.bounds))}
+		v.children[value] = h
+	}
+	return h
+}
+
+func (v *HistogramVec) name() string { return v.metricName }
+
+func (v *HistogramVec) write(w io.Writer) {
+	v.mu.Lock()
+	values := make([]string, 0, len(v.children))
+	for value := range v.children {
+		values = append(values, value)
+	}
+	v.mu.Unlock()
+	sort.Strings(values)
+
+	writeHeader(w, v.metricName, v.help, "histogram")
+	for _, value := range values {
+		labels := fmt.Sprintf("%s=\"%s\",", v.label, escapeLabelValue(value))
+		v.WithLabelValue(value).writeSamples(w, labels)
+	}
+}
+
+// escapeLabelValue escapes a label value for the Prometheus text format
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric
+func writeHeader(w io.Writer, name, help, metricType string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// formatFloat formats a value the way Prometheus expects
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultDedupCacheSize is the number of recent updates remembered by Dedup
+const DefaultDedupCacheSize = 10000
+
+// Dedup creates a middleware that drops updates already seen within the window.
+// Telegram can redeliver updates on reconnect; duplicates return nil without
+// reaching the handler
+func Dedup(window time.Duration) Middleware {
+	seen := newDedupCache(DefaultDedupCacheSize, window)
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, data interface{}) error {
+			requestData, ok := data.(*RequestData)
+			if !ok {
+				return next(ctx, data)
+			}
+
+			key, ok := dedupKey(requestData)
+			if ok && seen.Seen(key, time.Now()) {
+				return nil
+			}
+			return next(ctx, data)
+		}
+	}
+}
+
+// dedupKey identifies an update per user. Updates received through the update loop
+// carry an update ID; callbacks and messages handled directly fall back to their own IDs
+func dedupKey(requestData *RequestData) (string, bool) {
+	switch {
+	case requestData.UpdateID != 0:
+		return fmt.Sprintf("%d:update:%d", requestData.UserID, requestData.UpdateID), true
+	case requestData.Callback != nil && requestData.Callback.ID != "":
+		return fmt.Sprintf("%d:callback:%s", requestData.UserID, requestData.Callback.ID), true
+	case requestData.Message != nil && requestData.Message.MessageID != 0:
+		return fmt.Sprintf("%d:message:%d:%d", requestData.UserID, requestData.ChatID, requestData.Message.MessageID), true
+	default:
+		return "", false
+	}
+}
+
+// dedupCache is an LRU of keys that expire after a TTL
+type dedupCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List // front is the most recently seen key
+	entries  map[string]*list.Element
+}
+
+type dedupEntry struct {
+	key    string
+	seenAt time.Time
+}
+
+func newDedupCache(capacity int, ttl time.Duration) *dedupCache {
+	return &dedupCache{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Seen reports whether the key was recorded within the TTL and records it otherwise
+func (c *dedupCache) Seen(key string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*dedupEntry)
+		if now.Sub(entry.seenAt) < c.ttl {
+			return true
+		}
+		entry.seenAt = now
+		c.order.MoveToFront(element)
+		return false
+	}
+
+	c.entries[key] = c.order.PushFront(&dedupEntry{key: key, seenAt: now})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*dedupEntry).key)
+	}
+	return false
+}
@@ -2,10 +2,14 @@ package middleware
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/session"
 )
 
 // HandlerFunc represents a middleware-aware handler function
@@ -32,13 +36,30 @@ type RequestData struct {
 	UserID   int64
 	ChatID   int64
 	Username string
+	// UpdateID is Telegram's ID of the update; zero for updates handled outside the
+	// update loop
+	UpdateID int
+
+	// CorrelationID identifies the update across logs and the events it emits
+	CorrelationID string
+	// SessionID groups the updates a user sends without a long pause; empty when the
+	// update has no sender
+	SessionID string
+	// Session is the user's conversational state, loaded by the SessionState
+	// middleware; nil without it. Handlers reach it with session.FromContext
+	Session *session.Session
 }
 
-// NewRequestDataFromUpdate creates RequestData from a Telegram update
+// NewRequestDataFromUpdate creates RequestData from a Telegram update. It returns nil
+// for a message without a sender or chat, or a callback without its message, since
+// such updates cannot be attributed to a user and are skipped
 func NewRequestDataFromUpdate(update *tgbotapi.Update) *RequestData {
-	data := &RequestData{Update: update}
+	data := &RequestData{Update: update, UpdateID: update.UpdateID, CorrelationID: NewCorrelationID()}
 	
 	if update.Message != nil {
+		if update.Message.From == nil || update.Message.Chat == nil {
+			return nil
+		}
 		data.Message = update.Message
 		data.UserID = update.Message.From.ID
 		data.ChatID = update.Message.Chat.ID
@@ -46,15 +67,32 @@ func NewRequestDataFromUpdate(update *tgbotapi.Update) *RequestData {
 	}
 	
 	if update.CallbackQuery != nil {
+		callback := update.CallbackQuery
+		if callback.From == nil || callback.Message == nil || callback.Message.Chat == nil {
+			return nil
+		}
 		data.Callback = update.CallbackQuery
 		data.UserID = update.CallbackQuery.From.ID
 		data.ChatID = update.CallbackQuery.Message.Chat.ID
 		data.Username = update.CallbackQuery.From.UserName
 	}
+
+	if data.UserID != 0 {
+		data.SessionID = sessions.SessionID(data.UserID, time.Now())
+	}
 	
 	return data
 }
 
+// NewCorrelationID generates a random correlation ID for a request
+func NewCorrelationID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().UTC().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
 // Logger creates a logging middleware
 func Logger(logger *logrus.Logger) Middleware {
 	return func(next HandlerFunc) HandlerFunc {
@@ -69,9 +107,11 @@ func Logger(logger *logrus.Logger) Middleware {
 			
 			// Log request
 			fields := logrus.Fields{
-				"user_id":  requestData.UserID,
-				"chat_id":  requestData.ChatID,
-				"username": requestData.Username,
+				"update_id":      requestData.UpdateID,
+				"user_id":        requestData.UserID,
+				"chat_id":        requestData.ChatID,
+				"username":       requestData.Username,
+				"correlation_id": requestData.CorrelationID,
 			}
 			
 			if requestData.Message != nil {
@@ -104,6 +144,33 @@ func Logger(logger *logrus.Logger) Middleware {
 	}
 }
 
+// Metrics creates a middleware that records the outcome and duration of each request
+func Metrics(recorder MetricsRecorder) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, data interface{}) error {
+			start := time.Now()
+			err := next(ctx, data)
+
+			requestType := "unknown"
+			if requestData, ok := data.(*RequestData); ok {
+				if requestData.Message != nil {
+					requestType = "message"
+				} else if requestData.Callback != nil {
+					requestType = "callback"
+				}
+			}
+			recorder.RecordRequest(requestType, time.Since(start), err)
+
+			return err
+		}
+	}
+}
+
+// MetricsRecorder interface for recording request metrics
+type MetricsRecorder interface {
+	RecordRequest(requestType string, duration time.Duration, err error)
+}
+
 // Recovery creates a panic recovery middleware
 func Recovery(logger *logrus.Logger) Middleware {
 	return func(next HandlerFunc) HandlerFunc {
@@ -161,6 +228,12 @@ func Timeout(duration time.Duration) Middleware {
 
 // RateLimit creates a rate limiting middleware
 func RateLimit(rateLimiter RateLimiter) Middleware {
+	return RateLimitWithEvents(rateLimiter, nil)
+}
+
+// RateLimitWithEvents creates a rate limiting middleware that publishes an event
+// for every blocked request so abuse patterns can be analyzed
+func RateLimitWithEvents(rateLimiter RateLimiter, publisher RateLimitEventPublisher) Middleware {
 	return func(next HandlerFunc) HandlerFunc {
 		return func(ctx context.Context, data interface{}) error {
 			requestData, ok := data.(*RequestData)
@@ -168,7 +241,12 @@ func RateLimit(rateLimiter RateLimiter) Middleware {
 				return ErrInvalidRequestData
 			}
 			
-			if !rateLimiter.Allow(requestData.UserID) {
+			action := rateLimitAction(requestData)
+			if !allowRequest(rateLimiter, requestData.UserID, action) {
+				if publisher != nil {
+					// Publishing failures are logged by the publisher and must not change the outcome
+					_ = publisher.PublishRateLimited(ctx, requestData.UserID, action)
+				}
 				return ErrRateLimitExceeded
 			}
 			
@@ -182,6 +260,64 @@ type RateLimiter interface {
 	Allow(userID int64) bool
 }
 
+// ActionRateLimiter is implemented by rate limiters with separate limits per action
+type ActionRateLimiter interface {
+	AllowAction(userID int64, action string) bool
+}
+
+// allowRequest checks the request against per-action limits when the limiter supports them
+func allowRequest(rateLimiter RateLimiter, userID int64, action string) bool {
+	if actionLimiter, ok := rateLimiter.(ActionRateLimiter); ok {
+		return actionLimiter.AllowAction(userID, action)
+	}
+	return rateLimiter.Allow(userID)
+}
+
+// RateLimitEventPublisher publishes events for rate-limited requests
+type RateLimitEventPublisher interface {
+	PublishRateLimited(ctx context.Context, userID int64, action string) error
+}
+
+// rateLimitAction describes a request without including free-form message text. It is
+// used both as the per-action rate limit key and in rate-limited events. Commands are
+// keyed by name, so /start@Bot counts as /start
+func rateLimitAction(requestData *RequestData) string {
+	switch {
+	case requestData.Message != nil && requestData.Message.IsCommand():
+		return "command:/" + strings.ToLower(requestData.Message.Command())
+	case requestData.Message != nil:
+		return "message"
+	case requestData.Callback != nil:
+		return "callback:" + requestData.Callback.Data
+	}
+	return "unknown"
+}
+
+// Maintenance creates a middleware that answers requests with reply instead of
+// handling them while the bot is in maintenance mode. Requests from exempt users,
+// such as admins, are handled as usual
+func Maintenance(checker MaintenanceChecker, exempt func(userID int64) bool, reply HandlerFunc) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, data interface{}) error {
+			requestData, ok := data.(*RequestData)
+			if !ok {
+				return ErrInvalidRequestData
+			}
+			
+			if checker.MaintenanceMode() && !exempt(requestData.UserID) {
+				return reply(ctx, data)
+			}
+			
+			return next(ctx, data)
+		}
+	}
+}
+
+// MaintenanceChecker reports whether the bot is in maintenance mode
+type MaintenanceChecker interface {
+	MaintenanceMode() bool
+}
+
 // Audit creates an audit logging middleware
 func Audit(auditLogger AuditLogger) Middleware {
 	return func(next HandlerFunc) HandlerFunc {
@@ -199,7 +335,7 @@ func Audit(auditLogger AuditLogger) Middleware {
 				action = "callback:" + requestData.Callback.Data
 			}
 			
-			auditLogger.LogAction(requestData.UserID, action, time.Now())
+			auditLogger.LogAction(requestData.UserID, requestData.Username, requestData.SessionID, action, time.Now())
 			
 			return next(ctx, data)
 		}
@@ -208,5 +344,5 @@ func Audit(auditLogger AuditLogger) Middleware {
 
 // AuditLogger interface for audit logging
 type AuditLogger interface {
-	LogAction(userID int64, action string, timestamp time.Time)
+	LogAction(userID int64, username, sessionID, action string, timestamp time.Time)
 }
\ No newline at end of file
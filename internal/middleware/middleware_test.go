@@ -3,12 +3,18 @@ package middleware
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/session"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/utils"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestChain(t *testing.T) {
@@ -90,6 +96,8 @@ func TestNewRequestDataFromUpdate(t *testing.T) {
 		assert.Equal(t, int64(123), data.UserID)
 		assert.Equal(t, int64(456), data.ChatID)
 		assert.Equal(t, "testuser", data.Username)
+		assert.NotEmpty(t, data.SessionID)
+		assert.Equal(t, data.SessionID, NewRequestDataFromUpdate(update).SessionID, "updates in quick succession share a session")
 	})
 	
 	t.Run("Callback update", func(t *testing.T) {
@@ -118,6 +126,27 @@ func TestNewRequestDataFromUpdate(t *testing.T) {
 		assert.Equal(t, int64(456), data.ChatID)
 		assert.Equal(t, "testuser", data.Username)
 	})
+
+	t.Run("Update without a sender or chat", func(t *testing.T) {
+		assert.Nil(t, NewRequestDataFromUpdate(&tgbotapi.Update{Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 456}}}))
+		assert.Nil(t, NewRequestDataFromUpdate(&tgbotapi.Update{Message: &tgbotapi.Message{From: &tgbotapi.User{ID: 123}}}))
+		assert.Nil(t, NewRequestDataFromUpdate(&tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{From: &tgbotapi.User{ID: 123}}}))
+	})
+
+	t.Run("Correlation ID", func(t *testing.T) {
+		update := &tgbotapi.Update{
+			Message: &tgbotapi.Message{
+				From: &tgbotapi.User{ID: 123},
+				Chat: &tgbotapi.Chat{ID: 456},
+			},
+		}
+
+		first := NewRequestDataFromUpdate(update)
+		second := NewRequestDataFromUpdate(update)
+
+		assert.Len(t, first.CorrelationID, 32)
+		assert.NotEqual(t, first.CorrelationID, second.CorrelationID)
+	})
 }
 
 func TestLogger(t *testing.T) {
@@ -191,6 +220,34 @@ func TestLogger(t *testing.T) {
 		assert.Error(t, err)
 		assert.Equal(t, testError, err)
 	})
+
+	t.Run("Logs correlation and update IDs", func(t *testing.T) {
+		hookLogger, hook := logrustest.NewNullLogger()
+		middleware := Logger(hookLogger)
+
+		handler := func(ctx context.Context, data interface{}) error {
+			return nil
+		}
+
+		requestData := NewRequestDataFromUpdate(&tgbotapi.Update{
+			UpdateID: 1001,
+			Message: &tgbotapi.Message{
+				Text: "/start",
+				From: &tgbotapi.User{ID: 456},
+				Chat: &tgbotapi.Chat{ID: 789},
+			},
+		})
+		requestData.CorrelationID = "abc123"
+
+		err := middleware(handler)(context.Background(), requestData)
+
+		require.NoError(t, err)
+		require.NotEmpty(t, hook.AllEntries())
+		for _, entry := range hook.AllEntries() {
+			assert.Equal(t, "abc123", entry.Data["correlation_id"])
+			assert.Equal(t, 1001, entry.Data["update_id"])
+		}
+	})
 }
 
 func TestRecovery(t *testing.T) {
@@ -280,6 +337,18 @@ func (m *MockRateLimiter) Allow(userID int64) bool {
 	return m.allowResponse
 }
 
+// MockActionRateLimiter records the actions it is asked about
+type MockActionRateLimiter struct {
+	MockRateLimiter
+	blocked map[string]bool
+	actions []string
+}
+
+func (m *MockActionRateLimiter) AllowAction(userID int64, action string) bool {
+	m.actions = append(m.actions, action)
+	return !m.blocked[action]
+}
+
 func TestRateLimit(t *testing.T) {
 	t.Run("Allows when rate limiter allows", func(t *testing.T) {
 		rateLimiter := &MockRateLimiter{allowResponse: true}
@@ -328,15 +397,166 @@ func TestRateLimit(t *testing.T) {
 		assert.Error(t, err)
 		assert.Equal(t, ErrInvalidRequestData, err)
 	})
+
+	t.Run("Passes the action to per-action rate limiters", func(t *testing.T) {
+		rateLimiter := &MockActionRateLimiter{
+			MockRateLimiter: MockRateLimiter{allowResponse: true},
+			blocked:         map[string]bool{"command:/start": true},
+		}
+		wrappedHandler := RateLimit(rateLimiter)(func(ctx context.Context, data interface{}) error {
+			return nil
+		})
+
+		err := wrappedHandler(context.Background(), &RequestData{UserID: 123, Message: commandMessage("/start")})
+		assert.Equal(t, ErrRateLimitExceeded, err)
+
+		err = wrappedHandler(context.Background(), &RequestData{UserID: 123, Message: commandMessage("/account")})
+		assert.NoError(t, err)
+
+		// A command addressed to the bot by name counts as the command itself
+		err = wrappedHandler(context.Background(), &RequestData{UserID: 123, Message: commandMessage("/Start@arcanus_bot promo")})
+		assert.Equal(t, ErrRateLimitExceeded, err)
+
+		// Text that only looks like a command is a message
+		err = wrappedHandler(context.Background(), &RequestData{UserID: 123, Message: &tgbotapi.Message{Text: "/start"}})
+		assert.NoError(t, err)
+
+		assert.Equal(t, []string{"command:/start", "command:/account", "command:/start", "message"}, rateLimiter.actions)
+	})
+}
+
+// commandMessage returns a message with the command that text starts with, marked
+// like Telegram does
+func commandMessage(text string) *tgbotapi.Message {
+	command, _, _ := strings.Cut(text, " ")
+	return &tgbotapi.Message{
+		Text:     text,
+		Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Length: len(command)}},
+	}
+}
+
+// maintenanceSwitch is a MaintenanceChecker for testing
+type maintenanceSwitch bool
+
+func (m maintenanceSwitch) MaintenanceMode() bool {
+	return bool(m)
+}
+
+func TestMaintenance(t *testing.T) {
+	isAdmin := func(userID int64) bool { return userID == 1 }
+	run := func(on bool, userID int64) (handled, replied bool) {
+		wrappedHandler := Maintenance(maintenanceSwitch(on), isAdmin, func(ctx context.Context, data interface{}) error {
+			replied = true
+			return nil
+		})(func(ctx context.Context, data interface{}) error {
+			handled = true
+			return nil
+		})
+		require.NoError(t, wrappedHandler(context.Background(), &RequestData{UserID: userID}))
+		return handled, replied
+	}
+
+	t.Run("Handles requests outside maintenance", func(t *testing.T) {
+		handled, replied := run(false, 123)
+		assert.True(t, handled)
+		assert.False(t, replied)
+	})
+
+	t.Run("Replies instead of handling during maintenance", func(t *testing.T) {
+		handled, replied := run(true, 123)
+		assert.False(t, handled)
+		assert.True(t, replied)
+	})
+
+	t.Run("Handles requests from exempt users during maintenance", func(t *testing.T) {
+		handled, replied := run(true, 1)
+		assert.True(t, handled)
+		assert.False(t, replied)
+	})
+
+	t.Run("Returns error for invalid request data", func(t *testing.T) {
+		wrappedHandler := Maintenance(maintenanceSwitch(true), isAdmin, nil)(nil)
+		assert.Equal(t, ErrInvalidRequestData, wrappedHandler(context.Background(), "invalid data"))
+	})
+}
+
+// MockRateLimitEventPublisher for testing
+type MockRateLimitEventPublisher struct {
+	mock.Mock
+}
+
+func (m *MockRateLimitEventPublisher) PublishRateLimited(ctx context.Context, userID int64, action string) error {
+	args := m.Called(ctx, userID, action)
+	return args.Error(0)
+}
+
+func TestRateLimitWithEvents(t *testing.T) {
+	handler := func(ctx context.Context, data interface{}) error {
+		return nil
+	}
+
+	t.Run("Publishes event when blocked", func(t *testing.T) {
+		publisher := new(MockRateLimitEventPublisher)
+		publisher.On("PublishRateLimited", mock.Anything, int64(123), "command:/start").Return(nil)
+
+		wrappedHandler := RateLimitWithEvents(&MockRateLimiter{allowResponse: false}, publisher)(handler)
+		err := wrappedHandler(context.Background(), &RequestData{
+			UserID:  123,
+			Message: commandMessage("/start promo"),
+		})
+
+		assert.Equal(t, ErrRateLimitExceeded, err)
+		publisher.AssertExpectations(t)
+	})
+
+	t.Run("Describes callbacks and plain messages", func(t *testing.T) {
+		publisher := new(MockRateLimitEventPublisher)
+		publisher.On("PublishRateLimited", mock.Anything, int64(123), "callback:trial").Return(nil)
+		publisher.On("PublishRateLimited", mock.Anything, int64(123), "message").Return(nil)
+
+		wrappedHandler := RateLimitWithEvents(&MockRateLimiter{allowResponse: false}, publisher)(handler)
+		_ = wrappedHandler(context.Background(), &RequestData{
+			UserID:   123,
+			Callback: &tgbotapi.CallbackQuery{Data: "trial"},
+		})
+		_ = wrappedHandler(context.Background(), &RequestData{
+			UserID:  123,
+			Message: &tgbotapi.Message{Text: "my secret text"},
+		})
+
+		publisher.AssertExpectations(t)
+	})
+
+	t.Run("Publish failure does not change the outcome", func(t *testing.T) {
+		publisher := new(MockRateLimitEventPublisher)
+		publisher.On("PublishRateLimited", mock.Anything, int64(123), mock.Anything).Return(errors.New("kafka down"))
+
+		wrappedHandler := RateLimitWithEvents(&MockRateLimiter{allowResponse: false}, publisher)(handler)
+		err := wrappedHandler(context.Background(), &RequestData{UserID: 123})
+
+		assert.Equal(t, ErrRateLimitExceeded, err)
+	})
+
+	t.Run("Does not publish when allowed", func(t *testing.T) {
+		publisher := new(MockRateLimitEventPublisher)
+
+		wrappedHandler := RateLimitWithEvents(&MockRateLimiter{allowResponse: true}, publisher)(handler)
+		err := wrappedHandler(context.Background(), &RequestData{UserID: 123})
+
+		assert.NoError(t, err)
+		publisher.AssertNotCalled(t, "PublishRateLimited", mock.Anything, mock.Anything, mock.Anything)
+	})
 }
 
 // MockAuditLogger for testing
 type MockAuditLogger struct {
-	actions []string
+	actions    []string
+	sessionIDs []string
 }
 
-func (m *MockAuditLogger) LogAction(userID int64, action string, timestamp time.Time) {
+func (m *MockAuditLogger) LogAction(userID int64, username, sessionID, action string, timestamp time.Time) {
 	m.actions = append(m.actions, action)
+	m.sessionIDs = append(m.sessionIDs, sessionID)
 }
 
 func TestAudit(t *testing.T) {
@@ -349,8 +569,9 @@ func TestAudit(t *testing.T) {
 		}
 		
 		requestData := &RequestData{
-			Message: &tgbotapi.Message{Text: "/start"},
-			UserID:  123,
+			Message:   &tgbotapi.Message{Text: "/start"},
+			UserID:    123,
+			SessionID: "session-1",
 		}
 		
 		wrappedHandler := middleware(handler)
@@ -359,6 +580,7 @@ func TestAudit(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Len(t, auditLogger.actions, 1)
 		assert.Equal(t, "message:/start", auditLogger.actions[0])
+		assert.Equal(t, []string{"session-1"}, auditLogger.sessionIDs)
 	})
 	
 	t.Run("Logs callback action", func(t *testing.T) {
@@ -381,4 +603,224 @@ func TestAudit(t *testing.T) {
 		assert.Len(t, auditLogger.actions, 1)
 		assert.Equal(t, "callback:test_data", auditLogger.actions[0])
 	})
-}
\ No newline at end of file
+}
+// MockMetricsRecorder records request metrics for testing
+type MockMetricsRecorder struct {
+	requestTypes []string
+	errors       []error
+}
+
+func (m *MockMetricsRecorder) RecordRequest(requestType string, duration time.Duration, err error) {
+	m.requestTypes = append(m.requestTypes, requestType)
+	m.errors = append(m.errors, err)
+}
+
+func TestMetrics(t *testing.T) {
+	recorder := &MockMetricsRecorder{}
+	handlerErr := errors.New("handler failed")
+
+	wrappedHandler := Metrics(recorder)(func(ctx context.Context, data interface{}) error {
+		if data.(*RequestData).Callback != nil {
+			return handlerErr
+		}
+		return nil
+	})
+
+	err := wrappedHandler(context.Background(), &RequestData{UserID: 123, Message: &tgbotapi.Message{Text: "/start"}})
+	assert.NoError(t, err)
+
+	err = wrappedHandler(context.Background(), &RequestData{UserID: 123, Callback: &tgbotapi.CallbackQuery{Data: "trial"}})
+	assert.Equal(t, handlerErr, err)
+
+	assert.Equal(t, []string{"message", "callback"}, recorder.requestTypes)
+	assert.Equal(t, []error{nil, handlerErr}, recorder.errors)
+}
+
+func TestDedup(t *testing.T) {
+	t.Run("Drops redelivered updates", func(t *testing.T) {
+		calls := 0
+		handler := Dedup(time.Minute)(func(ctx context.Context, data interface{}) error {
+			calls++
+			return nil
+		})
+
+		update := &tgbotapi.Update{
+			UpdateID: 1001,
+			Message: &tgbotapi.Message{
+				MessageID: 7,
+				From:      &tgbotapi.User{ID: 123},
+				Chat:      &tgbotapi.Chat{ID: 456},
+				Text:      "/start",
+			},
+		}
+
+		require.NoError(t, handler(context.Background(), NewRequestDataFromUpdate(update)))
+		require.NoError(t, handler(context.Background(), NewRequestDataFromUpdate(update)))
+		assert.Equal(t, 1, calls)
+
+		next := *update
+		next.UpdateID = 1002
+		require.NoError(t, handler(context.Background(), NewRequestDataFromUpdate(&next)))
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("Falls back to callback IDs", func(t *testing.T) {
+		calls := 0
+		handler := Dedup(time.Minute)(func(ctx context.Context, data interface{}) error {
+			calls++
+			return nil
+		})
+
+		update := &tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+			ID:      "cb1",
+			From:    &tgbotapi.User{ID: 123},
+			Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 456}},
+			Data:    "help",
+		}}
+
+		require.NoError(t, handler(context.Background(), NewRequestDataFromUpdate(update)))
+		require.NoError(t, handler(context.Background(), NewRequestDataFromUpdate(update)))
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("Passes through requests without IDs", func(t *testing.T) {
+		calls := 0
+		handler := Dedup(time.Minute)(func(ctx context.Context, data interface{}) error {
+			calls++
+			return nil
+		})
+
+		require.NoError(t, handler(context.Background(), &RequestData{UserID: 123}))
+		require.NoError(t, handler(context.Background(), &RequestData{UserID: 123}))
+		assert.Equal(t, 2, calls)
+	})
+}
+
+func TestDedupCache(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Expires keys after the TTL", func(t *testing.T) {
+		cache := newDedupCache(10, time.Minute)
+
+		assert.False(t, cache.Seen("a", now))
+		assert.True(t, cache.Seen("a", now.Add(30*time.Second)))
+		assert.False(t, cache.Seen("a", now.Add(time.Minute)))
+	})
+
+	t.Run("Evicts the least recently seen key", func(t *testing.T) {
+		cache := newDedupCache(2, time.Hour)
+
+		assert.False(t, cache.Seen("a", now))
+		assert.False(t, cache.Seen("b", now))
+		assert.False(t, cache.Seen("c", now))
+
+		assert.False(t, cache.Seen("a", now), "oldest key should have been evicted")
+		assert.True(t, cache.Seen("c", now))
+	})
+}
+
+func TestSessionTracker(t *testing.T) {
+	tracker := NewSessionTracker(time.Minute)
+	start := time.Now()
+
+	first := tracker.SessionID(123, start)
+	assert.NotEmpty(t, first)
+	assert.Equal(t, first, tracker.SessionID(123, start.Add(50*time.Second)), "activity within the idle timeout keeps the session")
+	assert.Equal(t, first, tracker.SessionID(123, start.Add(100*time.Second)), "the idle timeout counts from the last update")
+	assert.NotEqual(t, first, tracker.SessionID(456, start), "users get their own sessions")
+
+	renewed := tracker.SessionID(123, start.Add(200*time.Second))
+	assert.NotEqual(t, first, renewed, "an idle user starts a new session")
+	assert.Len(t, tracker.sessions, 1, "expired sessions are forgotten")
+}
+
+func TestSessionTracker_IDGenerator(t *testing.T) {
+	tracker := NewSessionTracker(time.Minute)
+	tracker.SetIDGenerator(utils.NewSequentialIDGenerator("session"))
+	start := time.Now()
+
+	assert.Equal(t, "session-1", tracker.SessionID(123, start))
+	assert.Equal(t, "session-2", tracker.SessionID(456, start))
+	assert.Equal(t, "session-1", tracker.SessionID(123, start.Add(time.Second)))
+	assert.Equal(t, "session-3", tracker.SessionID(123, start.Add(2*time.Minute)), "an idle user starts a new session")
+}
+
+// failingSessionStore is a session store whose backend is down
+type failingSessionStore struct{}
+
+func (failingSessionStore) Get(context.Context, int64) (*session.Session, error) {
+	return nil, errors.New("connection refused")
+}
+
+func (failingSessionStore) Set(context.Context, int64, *session.Session) error {
+	return errors.New("connection refused")
+}
+
+func (failingSessionStore) Clear(context.Context, int64) error {
+	return errors.New("connection refused")
+}
+
+func TestSessionState(t *testing.T) {
+	logger, hook := logrustest.NewNullLogger()
+	ctx := context.Background()
+
+	t.Run("Saves the step taken by the handler", func(t *testing.T) {
+		store := session.NewMemoryStore(time.Minute)
+		handler := SessionState(store, logger)(func(ctx context.Context, data interface{}) error {
+			requestData := data.(*RequestData)
+			require.NotNil(t, requestData.Session)
+			assert.True(t, requestData.Session.IsIdle())
+			requestData.Session.Transition("awaiting_payment_code")
+			return nil
+		})
+
+		require.NoError(t, handler(ctx, &RequestData{UserID: 123}))
+		stored, err := store.Get(ctx, 123)
+		require.NoError(t, err)
+		assert.Equal(t, session.State("awaiting_payment_code"), stored.State)
+	})
+
+	t.Run("Continues the flow and clears it when finished", func(t *testing.T) {
+		store := session.NewMemoryStore(time.Minute)
+		started := session.New()
+		started.Transition("awaiting_payment_code")
+		require.NoError(t, store.Set(ctx, 123, started))
+
+		handlerErr := errors.New("invalid code")
+		handler := SessionState(store, logger)(func(ctx context.Context, data interface{}) error {
+			requestData := data.(*RequestData)
+			assert.Equal(t, session.State("awaiting_payment_code"), requestData.Session.State)
+			requestData.Session.Reset()
+			return handlerErr
+		})
+
+		assert.ErrorIs(t, handler(ctx, &RequestData{UserID: 123}), handlerErr)
+		stored, err := store.Get(ctx, 123)
+		require.NoError(t, err)
+		assert.True(t, stored.IsIdle(), "the session is saved even when the handler fails")
+	})
+
+	t.Run("Store failures do not fail the request", func(t *testing.T) {
+		hook.Reset()
+		called := false
+		handler := SessionState(failingSessionStore{}, logger)(func(ctx context.Context, data interface{}) error {
+			called = true
+			assert.True(t, data.(*RequestData).Session.IsIdle())
+			return nil
+		})
+
+		require.NoError(t, handler(ctx, &RequestData{UserID: 123}))
+		assert.True(t, called)
+		require.NotNil(t, hook.LastEntry())
+		assert.Equal(t, "Failed to load session", hook.LastEntry().Message)
+	})
+
+	t.Run("Skips requests without a user", func(t *testing.T) {
+		handler := SessionState(failingSessionStore{}, logger)(func(ctx context.Context, data interface{}) error {
+			assert.Nil(t, data.(*RequestData).Session)
+			return nil
+		})
+
+		require.NoError(t, handler(ctx, &RequestData{}))
+	})
+}
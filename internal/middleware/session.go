@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/utils"
+)
+
+// DefaultSessionIdleTimeout is how long a user may be idle before their next update
+// starts a new session
+const DefaultSessionIdleTimeout = 30 * time.Minute
+
+// trackedSession is the current session of a user
+type trackedSession struct {
+	id       string
+	lastSeen time.Time
+}
+
+// SessionTracker assigns each user a session ID that is kept while they keep sending
+// updates and replaced once they were idle for longer than the idle timeout
+type SessionTracker struct {
+	idleTimeout time.Duration
+	ids         utils.IDGenerator
+
+	mu        sync.Mutex
+	sessions  map[int64]*trackedSession
+	lastSweep time.Time
+}
+
+// NewSessionTracker creates a new session tracker
+func NewSessionTracker(idleTimeout time.Duration) *SessionTracker {
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultSessionIdleTimeout
+	}
+	return &SessionTracker{
+		idleTimeout: idleTimeout,
+		ids:         utils.UUIDGenerator{},
+		sessions:    make(map[int64]*trackedSession),
+	}
+}
+
+// SetIDGenerator configures how new session IDs are minted
+func (t *SessionTracker) SetIDGenerator(ids utils.IDGenerator) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ids = ids
+}
+
+// SessionID returns the session of the user at now, starting a new one when the user
+// has none or was idle for too long
+func (t *SessionTracker) SessionID(userID int64, now time.Time) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sweep(now)
+	current, ok := t.sessions[userID]
+	if !ok || now.Sub(current.lastSeen) > t.idleTimeout {
+		current = &trackedSession{id: t.ids.NewID()}
+		t.sessions[userID] = current
+	}
+	current.lastSeen = now
+	return current.id
+}
+
+// sweep forgets expired sessions, at most once per idle timeout
+func (t *SessionTracker) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.idleTimeout {
+		return
+	}
+	for userID, s := range t.sessions {
+		if now.Sub(s.lastSeen) > t.idleTimeout {
+			delete(t.sessions, userID)
+		}
+	}
+	t.lastSweep = now
+}
+
+// sessions tracks the sessions assigned by NewRequestDataFromUpdate
+var sessions = NewSessionTracker(DefaultSessionIdleTimeout)
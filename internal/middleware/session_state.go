@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/session"
+)
+
+// SessionState creates a middleware that loads the user's conversational session into
+// RequestData.Session and saves it once the handler returns, so multi-step flows can
+// continue with the user's next update. A session the handler left idle is cleared.
+// Store failures are logged and do not fail the request: if loading fails the handler
+// sees an idle session, which is then not saved so the stored flow is kept
+func SessionState(store session.SessionStore, logger *logrus.Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, data interface{}) error {
+			requestData, ok := data.(*RequestData)
+			if !ok || requestData.UserID == 0 {
+				return next(ctx, data)
+			}
+
+			current, err := store.Get(ctx, requestData.UserID)
+			if err != nil {
+				logger.WithError(err).WithField("user_id", requestData.UserID).Warn("Failed to load session")
+				requestData.Session = session.New()
+				return next(ctx, data)
+			}
+			wasIdle := current.IsIdle()
+			requestData.Session = current
+
+			handlerErr := next(ctx, data)
+
+			// The handler's context may have timed out, which must not lose the step it took
+			saveCtx := context.WithoutCancel(ctx)
+			switch {
+			case !requestData.Session.IsIdle():
+				err = store.Set(saveCtx, requestData.UserID, requestData.Session)
+			case !wasIdle:
+				err = store.Clear(saveCtx, requestData.UserID)
+			}
+			if err != nil {
+				logger.WithError(err).WithField("user_id", requestData.UserID).Warn("Failed to save session")
+			}
+
+			return handlerErr
+		}
+	}
+}
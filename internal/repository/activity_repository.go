@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+)
+
+const (
+	// DefaultCommandHistorySize is the number of commands kept per user
+	DefaultCommandHistorySize = 20
+	// DefaultCommandHistoryUsers is the number of users whose history is kept
+	DefaultCommandHistoryUsers = 10000
+)
+
+// commandRing is a fixed-size ring buffer of command records
+type commandRing struct {
+	records  []domain.CommandRecord
+	next     int
+	full     bool
+	lastSeen time.Time
+}
+
+// MemoryActivityRepository implements domain.UserActivityRepository in memory.
+// Memory is bounded both per user and by the number of tracked users; when the
+// user limit is reached the least recently active user's history is evicted.
+// History does not survive restarts.
+type MemoryActivityRepository struct {
+	mu       sync.Mutex
+	size     int
+	maxUsers int
+	rings    map[int64]*commandRing
+}
+
+// NewMemoryActivityRepository creates a new in-memory activity repository
+func NewMemoryActivityRepository(size, maxUsers int) domain.UserActivityRepository {
+	if size < 1 {
+		size = DefaultCommandHistorySize
+	}
+	if maxUsers < 1 {
+		maxUsers = DefaultCommandHistoryUsers
+	}
+	return &MemoryActivityRepository{
+		size:     size,
+		maxUsers: maxUsers,
+		rings:    make(map[int64]*commandRing),
+	}
+}
+
+// AppendCommand records a command for a user, overwriting the oldest entry when full
+func (r *MemoryActivityRepository) AppendCommand(ctx context.Context, telegramID int64, command string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	ring, exists := r.rings[telegramID]
+	if !exists {
+		if len(r.rings) >= r.maxUsers {
+			r.evictOldest()
+		}
+		ring = &commandRing{records: make([]domain.CommandRecord, r.size)}
+		r.rings[telegramID] = ring
+	}
+
+	ring.records[ring.next] = domain.CommandRecord{Command: command, IssuedAt: now}
+	ring.next = (ring.next + 1) % r.size
+	if ring.next == 0 {
+		ring.full = true
+	}
+	ring.lastSeen = now
+	return nil
+}
+
+// ListRecent returns up to limit recent commands for a user, newest first
+func (r *MemoryActivityRepository) ListRecent(ctx context.Context, telegramID int64, limit int) ([]domain.CommandRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ring, exists := r.rings[telegramID]
+	if !exists {
+		return []domain.CommandRecord{}, nil
+	}
+
+	count := ring.next
+	if ring.full {
+		count = r.size
+	}
+	if limit > 0 && limit < count {
+		count = limit
+	}
+
+	result := make([]domain.CommandRecord, 0, count)
+	for i := 1; i <= count; i++ {
+		idx := (ring.next - i + r.size) % r.size
+		result = append(result, ring.records[idx])
+	}
+	return result, nil
+}
+
+// evictOldest removes the history of the least recently active user
+func (r *MemoryActivityRepository) evictOldest() {
+	var oldestID int64
+	var oldest time.Time
+	first := true
+	for id, ring := range r.rings {
+		if first || ring.lastSeen.Before(oldest) {
+			oldestID = id
+			oldest = ring.lastSeen
+			first = false
+		}
+	}
+	delete(r.rings, oldestID)
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryActivityRepository_ListRecent_Order(t *testing.T) {
+	repo := NewMemoryActivityRepository(5, 10)
+	ctx := context.Background()
+
+	for _, cmd := range []string{"/start", "/account", "/help"} {
+		require.NoError(t, repo.AppendCommand(ctx, 123, cmd))
+	}
+
+	records, err := repo.ListRecent(ctx, 123, 0)
+
+	assert.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, "/help", records[0].Command)
+	assert.Equal(t, "/account", records[1].Command)
+	assert.Equal(t, "/start", records[2].Command)
+}
+
+func TestMemoryActivityRepository_RingBufferBound(t *testing.T) {
+	repo := NewMemoryActivityRepository(3, 10)
+	ctx := context.Background()
+
+	for i := 1; i <= 7; i++ {
+		require.NoError(t, repo.AppendCommand(ctx, 123, fmt.Sprintf("/cmd%d", i)))
+	}
+
+	records, err := repo.ListRecent(ctx, 123, 0)
+
+	assert.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, "/cmd7", records[0].Command)
+	assert.Equal(t, "/cmd6", records[1].Command)
+	assert.Equal(t, "/cmd5", records[2].Command)
+}
+
+func TestMemoryActivityRepository_ListRecent_Limit(t *testing.T) {
+	repo := NewMemoryActivityRepository(5, 10)
+	ctx := context.Background()
+
+	for i := 1; i <= 4; i++ {
+		require.NoError(t, repo.AppendCommand(ctx, 123, fmt.Sprintf("/cmd%d", i)))
+	}
+
+	records, err := repo.ListRecent(ctx, 123, 2)
+
+	assert.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "/cmd4", records[0].Command)
+	assert.Equal(t, "/cmd3", records[1].Command)
+}
+
+func TestMemoryActivityRepository_UnknownUser(t *testing.T) {
+	repo := NewMemoryActivityRepository(5, 10)
+
+	records, err := repo.ListRecent(context.Background(), 999, 10)
+
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestMemoryActivityRepository_EvictsLeastRecentUser(t *testing.T) {
+	repo := NewMemoryActivityRepository(5, 2)
+	ctx := context.Background()
+
+	require.NoError(t, repo.AppendCommand(ctx, 1, "/start"))
+	require.NoError(t, repo.AppendCommand(ctx, 2, "/start"))
+	require.NoError(t, repo.AppendCommand(ctx, 1, "/account"))
+	require.NoError(t, repo.AppendCommand(ctx, 3, "/start"))
+
+	records, err := repo.ListRecent(ctx, 2, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, records, "least recently active user should be evicted")
+
+	records, err = repo.ListRecent(ctx, 1, 0)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"gorm.io/gorm"
+)
+
+// AuditLogRepository implements domain.AuditLogRepository by storing audit events in
+// the audit_logs table
+type AuditLogRepository struct {
+	db *gorm.DB
+}
+
+// NewAuditLogRepository creates a new AuditLogRepository instance
+func NewAuditLogRepository(db *gorm.DB) domain.AuditLogRepository {
+	return &AuditLogRepository{db: db}
+}
+
+// WriteAudit stores an audit event
+func (r *AuditLogRepository) WriteAudit(ctx context.Context, audit *domain.AuditLog) error {
+	if err := r.db.WithContext(ctx).Create(audit).Error; err != nil {
+		return classifyDBError(r.db, err, "create audit log", nil, nil)
+	}
+	return nil
+}
+
+// ListAuditByUser returns up to limit of the user's most recent audit events, newest first
+func (r *AuditLogRepository) ListAuditByUser(ctx context.Context, userID int64, limit int) ([]*domain.AuditLog, error) {
+	var audits []*domain.AuditLog
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("timestamp DESC, id DESC").
+		Limit(limit).
+		Find(&audits).Error
+	if err != nil {
+		return nil, classifyDBError(r.db, err, "list audit logs", nil, nil)
+	}
+	return audits, nil
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLogRepository_WriteAudit(t *testing.T) {
+	db := newSQLiteDB(t, &domain.AuditLog{})
+	assert.True(t, db.Migrator().HasTable("audit_logs"))
+
+	repo := NewAuditLogRepository(db)
+	audit := &domain.AuditLog{
+		UserID:    123456789,
+		Username:  "testuser",
+		Action:    "command_execution",
+		Timestamp: time.Now(),
+		Success:   false,
+		Error:     "quota exceeded",
+		Details:   `{"command":"getconfig"}`,
+	}
+	require.NoError(t, repo.WriteAudit(context.Background(), audit))
+	assert.NotZero(t, audit.ID)
+
+	var stored domain.AuditLog
+	require.NoError(t, db.Where("user_id = ?", int64(123456789)).First(&stored).Error)
+	assert.Equal(t, "command_execution", stored.Action)
+	assert.False(t, stored.Success)
+	assert.Equal(t, "quota exceeded", stored.Error)
+	assert.Equal(t, `{"command":"getconfig"}`, stored.Details)
+}
+
+func TestAuditLogRepository_ListAuditByUser(t *testing.T) {
+	db := newSQLiteDB(t, &domain.AuditLog{})
+
+	repo := NewAuditLogRepository(db)
+	ctx := context.Background()
+	start := time.Now().Add(-time.Hour)
+	for i, action := range []string{"user_registration", "command_execution", "callback_query"} {
+		require.NoError(t, repo.WriteAudit(ctx, &domain.AuditLog{UserID: 123, Action: action, Timestamp: start.Add(time.Duration(i) * time.Minute)}))
+	}
+	require.NoError(t, repo.WriteAudit(ctx, &domain.AuditLog{UserID: 456, Action: "command_execution", Timestamp: time.Now()}))
+
+	audits, err := repo.ListAuditByUser(ctx, 123, 2)
+
+	require.NoError(t, err)
+	require.Len(t, audits, 2)
+	assert.Equal(t, "callback_query", audits[0].Action)
+	assert.Equal(t, "command_execution", audits[1].Action)
+
+	audits, err = repo.ListAuditByUser(ctx, 789, 10)
+	require.NoError(t, err)
+	assert.Empty(t, audits)
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"gorm.io/gorm"
+)
+
+// BugReportRepository implements domain.BugReportRepository using GORM
+type BugReportRepository struct {
+	db *gorm.DB
+}
+
+// NewBugReportRepository creates a new BugReportRepository instance
+func NewBugReportRepository(db *gorm.DB) domain.BugReportRepository {
+	return &BugReportRepository{db: db}
+}
+
+// Create stores a new bug report
+func (r *BugReportRepository) Create(ctx context.Context, report *domain.BugReport) error {
+	if err := r.db.WithContext(ctx).Create(report).Error; err != nil {
+		return classifyDBError(r.db, err, "create bug report", nil, nil)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBugReportRepository_Create(t *testing.T) {
+	db := newSQLiteDB(t, &domain.BugReport{})
+
+	repo := NewBugReportRepository(db)
+	report := &domain.BugReport{
+		TelegramID:  123456789,
+		Username:    "testuser",
+		Description: "Account page shows the wrong quota",
+		LastCommand: "/account",
+		AppVersion:  "1.2.3",
+	}
+	require.NoError(t, repo.Create(context.Background(), report))
+	assert.NotZero(t, report.ID)
+
+	var stored domain.BugReport
+	require.NoError(t, db.First(&stored, report.ID).Error)
+	assert.Equal(t, int64(123456789), stored.TelegramID)
+	assert.Equal(t, "/account", stored.LastCommand)
+	assert.Equal(t, "1.2.3", stored.AppVersion)
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"fmt"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// NewDialector returns the GORM dialector for a database driver: postgres (the
+// default), mysql or sqlite. MySQL connections always parse DATETIME columns into
+// time.Time, which the models rely on
+func NewDialector(driver, dsn string) (gorm.Dialector, error) {
+	switch driver {
+	case "", "postgres":
+		return postgres.Open(dsn), nil
+	case "mysql":
+		dsnConfig, err := mysqldriver.ParseDSN(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mysql connection string: %w", err)
+		}
+		dsnConfig.ParseTime = true
+		return mysql.New(mysql.Config{DSNConfig: dsnConfig}), nil
+	case "sqlite":
+		return sqlite.Open(dsn), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"gorm.io/gorm"
+)
+
+// PostgreSQL error codes of lost lock conflicts
+const (
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+)
+
+// sqlStateError is implemented by PostgreSQL driver errors carrying an SQLSTATE code
+type sqlStateError interface {
+	SQLState() string
+}
+
+// classifyDBError maps err, returned by the database during operation, to a domain
+// error. A missing record maps to notFound and a unique constraint violation to
+// duplicate, when given. Anything else becomes a domain.DatabaseError, wrapping
+// domain.ErrDeadlock or domain.ErrDatabaseUnavailable when the failure is worth retrying
+func classifyDBError(db *gorm.DB, err error, operation string, notFound, duplicate error) error {
+	if err == nil {
+		return nil
+	}
+	if notFound != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		return notFound
+	}
+	if duplicate != nil && isDuplicateKey(db, err) {
+		return duplicate
+	}
+
+	switch {
+	case isDeadlock(err):
+		err = fmt.Errorf("%w: %w", domain.ErrDeadlock, err)
+	case isConnectionError(err):
+		err = fmt.Errorf("%w: %w", domain.ErrDatabaseUnavailable, err)
+	}
+	return domain.DatabaseError{Operation: operation, Err: err}
+}
+
+// isDuplicateKey reports whether err is a unique constraint violation, using the
+// dialect's error translation
+func isDuplicateKey(db *gorm.DB, err error) bool {
+	if translator, ok := db.Dialector.(gorm.ErrorTranslator); ok {
+		err = translator.Translate(err)
+	}
+	return errors.Is(err, gorm.ErrDuplicatedKey)
+}
+
+// isDeadlock reports whether err is a lost lock conflict: a PostgreSQL deadlock or
+// serialization failure, or a locked SQLite database
+func isDeadlock(err error) bool {
+	var stateErr sqlStateError
+	if errors.As(err, &stateErr) {
+		code := stateErr.SQLState()
+		return code == pgDeadlockDetected || code == pgSerializationFailure
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+// isConnectionError reports whether err means the database could not be reached or
+// the connection was lost
+func isConnectionError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+	var stateErr sqlStateError
+	if errors.As(err, &stateErr) {
+		// Class 08 is connection exceptions; 57P01-57P03 are server shutdowns
+		code := stateErr.SQLState()
+		return strings.HasPrefix(code, "08") || strings.HasPrefix(code, "57P0")
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	// database/sql does not export the error of a closed pool
+	return strings.Contains(err.Error(), "sql: database is closed")
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// pgError mimics a PostgreSQL driver error carrying an SQLSTATE code
+type pgError struct {
+	code string
+}
+
+func (e *pgError) Error() string    { return "pg error " + e.code }
+func (e *pgError) SQLState() string { return e.code }
+
+func TestClassifyDBError(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	notFound := domain.UserNotFoundError{TelegramID: 123}
+	duplicate := domain.UserAlreadyExistsError{TelegramID: 123}
+
+	t.Run("Nil stays nil", func(t *testing.T) {
+		assert.NoError(t, classifyDBError(db, nil, "get user", notFound, duplicate))
+	})
+
+	t.Run("Missing record", func(t *testing.T) {
+		assert.Equal(t, notFound, classifyDBError(db, gorm.ErrRecordNotFound, "get user", notFound, nil))
+
+		err := classifyDBError(db, gorm.ErrRecordNotFound, "list users", nil, nil)
+		assert.ErrorIs(t, err, domain.ErrDatabaseError, "without a not-found error it is a database error")
+	})
+
+	tests := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{"PostgreSQL deadlock", &pgError{code: "40P01"}, domain.ErrDeadlock},
+		{"PostgreSQL serialization failure", &pgError{code: "40001"}, domain.ErrDeadlock},
+		{"PostgreSQL connection failure", &pgError{code: "08006"}, domain.ErrDatabaseUnavailable},
+		{"PostgreSQL shutdown", &pgError{code: "57P01"}, domain.ErrDatabaseUnavailable},
+		{"Bad connection", driver.ErrBadConn, domain.ErrDatabaseUnavailable},
+		{"Network failure", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, domain.ErrDatabaseUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyDBError(db, tt.err, "update quota", notFound, duplicate)
+
+			assert.ErrorIs(t, err, tt.expected)
+			assert.ErrorIs(t, err, domain.ErrDatabaseError)
+			assert.ErrorIs(t, err, tt.err, "the driver error is kept")
+			var dbErr domain.DatabaseError
+			require.ErrorAs(t, err, &dbErr)
+			assert.Equal(t, "update quota", dbErr.Operation)
+		})
+	}
+
+	t.Run("Other errors", func(t *testing.T) {
+		err := classifyDBError(db, &pgError{code: "42P01"}, "list users", nil, nil)
+
+		assert.ErrorIs(t, err, domain.ErrDatabaseError)
+		assert.NotErrorIs(t, err, domain.ErrDeadlock)
+		assert.NotErrorIs(t, err, domain.ErrDatabaseUnavailable)
+	})
+}
+
+func TestRepositories_ClassifyErrors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Not found", func(t *testing.T) {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		require.NoError(t, db.AutoMigrate(&domain.Setting{}, &domain.UserSighting{}))
+
+		_, err := NewUserRepository(db).GetByTelegramID(ctx, 999)
+		assert.Equal(t, domain.UserNotFoundError{TelegramID: 999}, err)
+
+		_, err = NewSettingsRepository(db).Get(ctx, "missing")
+		assert.Equal(t, domain.SettingNotFoundError{Key: "missing"}, err)
+
+		_, err = NewUserSightingRepository(db).GetFirstSeen(ctx, 999)
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+
+	t.Run("Unique violation", func(t *testing.T) {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+		require.NoError(t, db.AutoMigrate(&domain.Payment{}))
+
+		payments := NewPaymentRepository(db)
+		require.NoError(t, payments.Create(ctx, &domain.Payment{TelegramID: 123, ProviderChargeID: "charge-1"}))
+		err := payments.Create(ctx, &domain.Payment{TelegramID: 123, ProviderChargeID: "charge-1"})
+		assert.ErrorIs(t, err, domain.ErrPaymentAlreadyProcessed)
+	})
+
+	t.Run("Locked database", func(t *testing.T) {
+		// Two connections to one file, the first holding the write lock
+		dsn := "file:" + filepath.Join(t.TempDir(), "locked.db") + "?_busy_timeout=0"
+		holder, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+		require.NoError(t, err)
+		require.NoError(t, holder.AutoMigrate(&domain.User{}))
+		require.NoError(t, NewUserRepository(holder).Create(ctx, domain.NewUser(123, "testuser", "Test", "User")))
+		sqlDB, err := holder.DB()
+		require.NoError(t, err)
+		sqlDB.SetMaxOpenConns(1)
+		defer sqlDB.Close()
+		require.NoError(t, holder.Exec("BEGIN IMMEDIATE").Error)
+		defer holder.Exec("ROLLBACK")
+
+		other, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+		require.NoError(t, err)
+		otherDB, err := other.DB()
+		require.NoError(t, err)
+		defer otherDB.Close()
+
+		err = NewUserRepository(other).UpdateQuota(ctx, 123, 100)
+		assert.ErrorIs(t, err, domain.ErrDeadlock)
+		var dbErr domain.DatabaseError
+		require.ErrorAs(t, err, &dbErr)
+		assert.Equal(t, "update quota", dbErr.Operation)
+	})
+
+	t.Run("Closed connection", func(t *testing.T) {
+		db, cleanup := setupTestDB(t)
+		cleanup()
+
+		_, err := NewUserRepository(db).CountUsers(ctx)
+		assert.ErrorIs(t, err, domain.ErrDatabaseUnavailable)
+
+		_, err = NewAuditLogRepository(db).ListAuditByUser(ctx, 123, 10)
+		assert.ErrorIs(t, err, domain.ErrDatabaseUnavailable)
+	})
+}
+
+// classifyingHangingRepository blocks like a hung database and returns classified errors
+type classifyingHangingRepository struct {
+	domain.UserRepository
+	driverErr func(ctx context.Context) error
+}
+
+func (r *classifyingHangingRepository) GetByTelegramID(ctx context.Context, telegramID int64) (*domain.User, error) {
+	<-ctx.Done()
+	return nil, domain.DatabaseError{Operation: "get user", Err: r.driverErr(ctx)}
+}
+
+func TestTimeoutUserRepository_KeepsClassifiedErrors(t *testing.T) {
+	for name, driverErr := range map[string]func(ctx context.Context) error{
+		"wrapping the context error": func(ctx context.Context) error { return ctx.Err() },
+		"hiding the context error":   func(context.Context) error { return driver.ErrBadConn },
+	} {
+		t.Run(name, func(t *testing.T) {
+			repo := NewTimeoutUserRepository(&classifyingHangingRepository{driverErr: driverErr}, 10*time.Millisecond)
+
+			_, err := repo.GetByTelegramID(context.Background(), 123)
+
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+			assert.ErrorIs(t, err, domain.ErrDatabaseError)
+			assert.Equal(t, 1, strings.Count(err.Error(), "database error during get user"), "not wrapped twice: %v", err)
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"gorm.io/gorm"
+)
+
+// referralCodeIndex is the index on referral codes, which was not unique at first
+const referralCodeIndex = "idx_users_referral_code"
+
+// AutoMigrate creates or updates the tables of every model the repositories persist
+func AutoMigrate(ctx context.Context, db *gorm.DB) error {
+	if err := backfillReferralCodes(ctx, db); err != nil {
+		return err
+	}
+	if err := dropNonUniqueIndex(ctx, db, &domain.User{}, referralCodeIndex); err != nil {
+		return err
+	}
+	return db.WithContext(ctx).AutoMigrate(
+		&domain.User{},
+		&domain.Setting{},
+		&domain.BugReport{},
+		&domain.UserSighting{},
+		&domain.Payment{},
+		&domain.AuditLog{},
+	)
+}
+
+// backfillReferralCodes gives every existing user a referral code of their own before
+// the unique index on referral codes is created. Users registered before referral
+// codes existed have none, and codes could repeat while the index was not unique; the
+// oldest user keeps a repeated code
+func backfillReferralCodes(ctx context.Context, db *gorm.DB) error {
+	db = db.WithContext(ctx)
+	if !db.Migrator().HasTable(&domain.User{}) || !db.Migrator().HasColumn(&domain.User{}, "ReferralCode") {
+		return nil
+	}
+
+	var users []*domain.User
+	err := db.Unscoped().Select("id", "referral_code").Order("created_at, id").Find(&users).Error
+	if err != nil {
+		return fmt.Errorf("failed to load referral codes: %w", err)
+	}
+
+	seen := make(map[string]bool, len(users))
+	for _, user := range users {
+		if user.ReferralCode != "" && !seen[user.ReferralCode] {
+			seen[user.ReferralCode] = true
+			continue
+		}
+
+		code, err := domain.GenerateReferralCode()
+		if err != nil {
+			return err
+		}
+		for seen[code] {
+			if code, err = domain.GenerateReferralCode(); err != nil {
+				return err
+			}
+		}
+		seen[code] = true
+
+		err = db.Unscoped().Model(&domain.User{}).Where("id = ?", user.ID).UpdateColumn("referral_code", code).Error
+		if err != nil {
+			return fmt.Errorf("failed to backfill referral code: %w", err)
+		}
+	}
+	return nil
+}
+
+// dropNonUniqueIndex drops the named index when it exists and is not unique, so
+// AutoMigrate, which leaves existing indexes alone, creates it again as unique
+func dropNonUniqueIndex(ctx context.Context, db *gorm.DB, model interface{}, name string) error {
+	migrator := db.WithContext(ctx).Migrator()
+	if !migrator.HasTable(model) {
+		return nil
+	}
+
+	indexes, err := migrator.GetIndexes(model)
+	if err != nil {
+		return fmt.Errorf("failed to list indexes: %w", err)
+	}
+	for _, index := range indexes {
+		if index.Name() != name {
+			continue
+		}
+		if unique, ok := index.Unique(); ok && unique {
+			return nil
+		}
+		if err := migrator.DropIndex(model, name); err != nil {
+			return fmt.Errorf("failed to drop index %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestAutoMigrate_MakesReferralCodesUnique(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// A database from before referral codes were unique, with users sharing a code
+	// and users registered before codes existed
+	require.NoError(t, db.Exec(`CREATE TABLE users (id integer PRIMARY KEY AUTOINCREMENT, telegram_id integer NOT NULL, first_name text, referral_code varchar(16), created_at datetime)`).Error)
+	require.NoError(t, db.Exec(`CREATE INDEX idx_users_referral_code ON users (referral_code)`).Error)
+	require.NoError(t, db.Exec(`INSERT INTO users (telegram_id, first_name, referral_code, created_at) VALUES
+		(1, 'Oldest', 'ABCD2345', '2024-01-01'),
+		(2, 'Repeat', 'ABCD2345', '2024-01-02'),
+		(3, 'Legacy', '', '2024-01-03'),
+		(4, 'Legacy', NULL, '2024-01-04')`).Error)
+
+	require.NoError(t, AutoMigrate(ctx, db))
+
+	var codes []string
+	require.NoError(t, db.Table("users").Order("id").Pluck("referral_code", &codes).Error)
+	require.Len(t, codes, 4)
+	assert.Equal(t, "ABCD2345", codes[0], "the oldest user keeps a repeated code")
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		assert.NotEmpty(t, code)
+		assert.False(t, seen[code], "code %s is repeated", code)
+		seen[code] = true
+	}
+
+	indexes, err := db.Migrator().GetIndexes(&domain.User{})
+	require.NoError(t, err)
+	var unique bool
+	for _, index := range indexes {
+		if index.Name() == referralCodeIndex {
+			unique, _ = index.Unique()
+		}
+	}
+	assert.True(t, unique)
+
+	// Migrating again leaves the unique index alone
+	require.NoError(t, AutoMigrate(ctx, db))
+}
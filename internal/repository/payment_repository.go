@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"gorm.io/gorm"
+)
+
+// PaymentRepository implements domain.PaymentRepository using GORM
+type PaymentRepository struct {
+	db *gorm.DB
+}
+
+// NewPaymentRepository creates a new PaymentRepository instance
+func NewPaymentRepository(db *gorm.DB) domain.PaymentRepository {
+	return &PaymentRepository{db: db}
+}
+
+// Create stores a processed payment. A payment whose charge was already stored returns
+// domain.ErrPaymentAlreadyProcessed
+func (r *PaymentRepository) Create(ctx context.Context, payment *domain.Payment) error {
+	if err := r.db.WithContext(ctx).Create(payment).Error; err != nil {
+		return classifyDBError(r.db, err, "create payment", nil, domain.ErrPaymentAlreadyProcessed)
+	}
+	return nil
+}
+
+// Exists reports whether a payment with the provider charge ID was already stored
+func (r *PaymentRepository) Exists(ctx context.Context, providerChargeID string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&domain.Payment{}).
+		Where("provider_charge_id = ?", providerChargeID).
+		Count(&count).Error
+	if err != nil {
+		return false, classifyDBError(r.db, err, "check payment", nil, nil)
+	}
+	return count > 0, nil
+}
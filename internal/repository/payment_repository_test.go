@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupPaymentRepository(t *testing.T) domain.PaymentRepository {
+	return NewPaymentRepository(newSQLiteDB(t, &domain.Payment{}))
+}
+
+func TestPaymentRepository_Exists(t *testing.T) {
+	repo := setupPaymentRepository(t)
+	ctx := context.Background()
+
+	exists, err := repo.Exists(ctx, "charge_1")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	require.NoError(t, repo.Create(ctx, &domain.Payment{
+		TelegramID:       123,
+		PlanName:         "Basic",
+		TotalAmount:      499,
+		Currency:         "USD",
+		ProviderChargeID: "charge_1",
+	}))
+
+	exists, err = repo.Exists(ctx, "charge_1")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = repo.Exists(ctx, "charge_2")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestPaymentRepository_CreateRejectsDuplicateCharge(t *testing.T) {
+	repo := setupPaymentRepository(t)
+	ctx := context.Background()
+
+	payment := domain.Payment{TelegramID: 123, PlanName: "Basic", ProviderChargeID: "charge_1"}
+	first, second := payment, payment
+	require.NoError(t, repo.Create(ctx, &first))
+	assert.ErrorIs(t, repo.Create(ctx, &second), domain.ErrPaymentAlreadyProcessed)
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SettingsRepository implements domain.SettingsRepository using GORM
+type SettingsRepository struct {
+	db *gorm.DB
+}
+
+// NewSettingsRepository creates a new SettingsRepository instance
+func NewSettingsRepository(db *gorm.DB) domain.SettingsRepository {
+	return &SettingsRepository{db: db}
+}
+
+// Get retrieves the raw value of a setting
+func (r *SettingsRepository) Get(ctx context.Context, key string) (string, error) {
+	var setting domain.Setting
+	result := r.db.WithContext(ctx).Where("key = ?", key).First(&setting)
+	if result.Error != nil {
+		return "", classifyDBError(r.db, result.Error, "get setting", domain.SettingNotFoundError{Key: key}, nil)
+	}
+	return setting.Value, nil
+}
+
+// Set inserts or updates the raw value of a setting
+func (r *SettingsRepository) Set(ctx context.Context, key, value string) error {
+	setting := domain.Setting{Key: key, Value: value}
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&setting)
+	if result.Error != nil {
+		return classifyDBError(r.db, result.Error, "set setting", nil, nil)
+	}
+	return nil
+}
+
+// GetBool retrieves a setting as a boolean
+func (r *SettingsRepository) GetBool(ctx context.Context, key string) (bool, error) {
+	value, err := r.Get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse setting %s as bool: %w", key, err)
+	}
+	return parsed, nil
+}
+
+// SetBool stores a boolean setting
+func (r *SettingsRepository) SetBool(ctx context.Context, key string, value bool) error {
+	return r.Set(ctx, key, strconv.FormatBool(value))
+}
+
+// GetInt64 retrieves a setting as an integer
+func (r *SettingsRepository) GetInt64(ctx context.Context, key string) (int64, error) {
+	value, err := r.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse setting %s as integer: %w", key, err)
+	}
+	return parsed, nil
+}
+
+// SetInt64 stores an integer setting
+func (r *SettingsRepository) SetInt64(ctx context.Context, key string, value int64) error {
+	return r.Set(ctx, key, strconv.FormatInt(value, 10))
+}
+
+// List returns all stored settings keyed by name
+func (r *SettingsRepository) List(ctx context.Context) (map[string]string, error) {
+	var settings []domain.Setting
+	result := r.db.WithContext(ctx).Find(&settings)
+	if result.Error != nil {
+		return nil, classifyDBError(r.db, result.Error, "list settings", nil, nil)
+	}
+
+	values := make(map[string]string, len(settings))
+	for _, setting := range settings {
+		values[setting.Key] = setting.Value
+	}
+	return values, nil
+}
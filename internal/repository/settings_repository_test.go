@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupSettingsRepository(t *testing.T) domain.SettingsRepository {
+	return NewSettingsRepository(newSQLiteDB(t, &domain.Setting{}))
+}
+
+func TestSettingsRepository_RoundTrip(t *testing.T) {
+	repo := setupSettingsRepository(t)
+	ctx := context.Background()
+
+	require.NoError(t, repo.Set(ctx, "greeting", "hello"))
+	require.NoError(t, repo.SetBool(ctx, "maintenance_mode", true))
+	require.NoError(t, repo.SetInt64(ctx, "trial_quota_bytes", 104857600))
+
+	value, err := repo.Get(ctx, "greeting")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", value)
+
+	enabled, err := repo.GetBool(ctx, "maintenance_mode")
+	require.NoError(t, err)
+	assert.True(t, enabled)
+
+	quota, err := repo.GetInt64(ctx, "trial_quota_bytes")
+	require.NoError(t, err)
+	assert.Equal(t, int64(104857600), quota)
+
+	all, err := repo.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"greeting":          "hello",
+		"maintenance_mode":  "true",
+		"trial_quota_bytes": "104857600",
+	}, all)
+}
+
+func TestSettingsRepository_SetOverwrites(t *testing.T) {
+	repo := setupSettingsRepository(t)
+	ctx := context.Background()
+
+	require.NoError(t, repo.SetBool(ctx, "maintenance_mode", true))
+	require.NoError(t, repo.SetBool(ctx, "maintenance_mode", false))
+
+	enabled, err := repo.GetBool(ctx, "maintenance_mode")
+	require.NoError(t, err)
+	assert.False(t, enabled)
+
+	all, err := repo.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, 1)
+}
+
+func TestSettingsRepository_NotFoundAndInvalid(t *testing.T) {
+	repo := setupSettingsRepository(t)
+	ctx := context.Background()
+
+	_, err := repo.Get(ctx, "missing")
+	assert.True(t, errors.Is(err, domain.ErrSettingNotFound))
+
+	require.NoError(t, repo.Set(ctx, "trial_quota_bytes", "lots"))
+	_, err = repo.GetInt64(ctx, "trial_quota_bytes")
+	assert.Error(t, err)
+	_, err = repo.GetBool(ctx, "trial_quota_bytes")
+	assert.Error(t, err)
+}
@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+)
+
+// TimeoutUserRepository decorates a domain.UserRepository so every query runs with
+// a deadline, keeping a hung database from blocking the update loop
+type TimeoutUserRepository struct {
+	next    domain.UserRepository
+	timeout time.Duration
+}
+
+// NewTimeoutUserRepository wraps repo so each call is bounded by timeout. A timeout
+// of zero or less returns repo unchanged
+func NewTimeoutUserRepository(repo domain.UserRepository, timeout time.Duration) domain.UserRepository {
+	if timeout <= 0 {
+		return repo
+	}
+	return &TimeoutUserRepository{next: repo, timeout: timeout}
+}
+
+// call runs fn with a deadline and reports timeouts as a domain.DatabaseError
+// wrapping context.DeadlineExceeded
+func (r *TimeoutUserRepository) call(ctx context.Context, operation string, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	err := fn(ctx)
+	if err == nil {
+		return nil
+	}
+	// The repository may have classified the error already
+	var dbErr domain.DatabaseError
+	classified := errors.As(err, &dbErr)
+	if errors.Is(err, context.DeadlineExceeded) {
+		if classified {
+			return err
+		}
+		return domain.DatabaseError{Operation: operation, Err: err}
+	}
+	// Drivers do not always wrap the context error, so check the deadline as well
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		if classified {
+			err = dbErr.Err
+		}
+		return domain.DatabaseError{Operation: operation, Err: fmt.Errorf("%w: %v", context.DeadlineExceeded, err)}
+	}
+	return err
+}
+
+// Create inserts a new user
+func (r *TimeoutUserRepository) Create(ctx context.Context, user *domain.User) error {
+	return r.call(ctx, "create user", func(ctx context.Context) error {
+		return r.next.Create(ctx, user)
+	})
+}
+
+// GetByTelegramID retrieves a user by Telegram ID
+func (r *TimeoutUserRepository) GetByTelegramID(ctx context.Context, telegramID int64) (*domain.User, error) {
+	var user *domain.User
+	err := r.call(ctx, "get user", func(ctx context.Context) error {
+		var err error
+		user, err = r.next.GetByTelegramID(ctx, telegramID)
+		return err
+	})
+	return user, err
+}
+
+// GetByTelegramIDIncludingDeleted retrieves a user by Telegram ID, including soft-deleted users
+func (r *TimeoutUserRepository) GetByTelegramIDIncludingDeleted(ctx context.Context, telegramID int64) (*domain.User, error) {
+	var user *domain.User
+	err := r.call(ctx, "get user including deleted", func(ctx context.Context) error {
+		var err error
+		user, err = r.next.GetByTelegramIDIncludingDeleted(ctx, telegramID)
+		return err
+	})
+	return user, err
+}
+
+// GetByUsername retrieves a user by username
+func (r *TimeoutUserRepository) GetByUsername(ctx context.Context, username string) (*domain.User, error) {
+	var user *domain.User
+	err := r.call(ctx, "get user by username", func(ctx context.Context) error {
+		var err error
+		user, err = r.next.GetByUsername(ctx, username)
+		return err
+	})
+	return user, err
+}
+
+// GetByReferralCode finds the user owning a referral code
+func (r *TimeoutUserRepository) GetByReferralCode(ctx context.Context, code string) (*domain.User, error) {
+	var user *domain.User
+	err := r.call(ctx, "get user by referral code", func(ctx context.Context) error {
+		var err error
+		user, err = r.next.GetByReferralCode(ctx, code)
+		return err
+	})
+	return user, err
+}
+
+// Update saves the user
+func (r *TimeoutUserRepository) Update(ctx context.Context, user *domain.User) error {
+	return r.call(ctx, "update user", func(ctx context.Context) error {
+		return r.next.Update(ctx, user)
+	})
+}
+
+// UpdateQuota sets the user's used quota
+func (r *TimeoutUserRepository) UpdateQuota(ctx context.Context, telegramID int64, quotaUsed int64) error {
+	return r.call(ctx, "update quota", func(ctx context.Context) error {
+		return r.next.UpdateQuota(ctx, telegramID, quotaUsed)
+	})
+}
+
+// AddQuotaLimit raises the user's quota limit by bytes
+func (r *TimeoutUserRepository) AddQuotaLimit(ctx context.Context, telegramID int64, bytes int64) error {
+	return r.call(ctx, "add quota limit", func(ctx context.Context) error {
+		return r.next.AddQuotaLimit(ctx, telegramID, bytes)
+	})
+}
+
+// UpdateQuotaAlertedPct records the highest usage alert threshold the user was alerted at
+func (r *TimeoutUserRepository) UpdateQuotaAlertedPct(ctx context.Context, telegramID int64, pct int) error {
+	return r.call(ctx, "update quota alerted percentage", func(ctx context.Context) error {
+		return r.next.UpdateQuotaAlertedPct(ctx, telegramID, pct)
+	})
+}
+
+// UpdateUnreachableAt records when the user's private chat was found missing
+func (r *TimeoutUserRepository) UpdateUnreachableAt(ctx context.Context, telegramID int64, at *time.Time) error {
+	return r.call(ctx, "update unreachable time", func(ctx context.Context) error {
+		return r.next.UpdateUnreachableAt(ctx, telegramID, at)
+	})
+}
+
+// UpdateBlocked records whether the user blocked the bot
+func (r *TimeoutUserRepository) UpdateBlocked(ctx context.Context, telegramID int64, blocked bool) error {
+	return r.call(ctx, "update blocked flag", func(ctx context.Context) error {
+		return r.next.UpdateBlocked(ctx, telegramID, blocked)
+	})
+}
+
+// UpdateLastActiveAt records when the user last sent the bot an update
+func (r *TimeoutUserRepository) UpdateLastActiveAt(ctx context.Context, telegramID int64, at time.Time) error {
+	return r.call(ctx, "update last activity", func(ctx context.Context) error {
+		return r.next.UpdateLastActiveAt(ctx, telegramID, at)
+	})
+}
+
+// Delete soft-deletes the user
+func (r *TimeoutUserRepository) Delete(ctx context.Context, telegramID int64) error {
+	return r.call(ctx, "delete user", func(ctx context.Context) error {
+		return r.next.Delete(ctx, telegramID)
+	})
+}
+
+// Restore restores a soft-deleted user
+func (r *TimeoutUserRepository) Restore(ctx context.Context, telegramID int64) error {
+	return r.call(ctx, "restore user", func(ctx context.Context) error {
+		return r.next.Restore(ctx, telegramID)
+	})
+}
+
+// CountByStatus counts users per status
+func (r *TimeoutUserRepository) CountByStatus(ctx context.Context) (map[string]int64, error) {
+	var counts map[string]int64
+	err := r.call(ctx, "count users by status", func(ctx context.Context) error {
+		var err error
+		counts, err = r.next.CountByStatus(ctx)
+		return err
+	})
+	return counts, err
+}
+
+// TotalQuotaUsed sums the quota used by all users
+func (r *TimeoutUserRepository) TotalQuotaUsed(ctx context.Context) (int64, error) {
+	var total int64
+	err := r.call(ctx, "sum quota used", func(ctx context.Context) error {
+		var err error
+		total, err = r.next.TotalQuotaUsed(ctx)
+		return err
+	})
+	return total, err
+}
+
+// ListUsers returns a page of users ordered by ID
+func (r *TimeoutUserRepository) ListUsers(ctx context.Context, offset, limit int) ([]*domain.User, error) {
+	var users []*domain.User
+	err := r.call(ctx, "list users", func(ctx context.Context) error {
+		var err error
+		users, err = r.next.ListUsers(ctx, offset, limit)
+		return err
+	})
+	return users, err
+}
+
+// CountUsers returns the number of users
+func (r *TimeoutUserRepository) CountUsers(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.call(ctx, "count users", func(ctx context.Context) error {
+		var err error
+		count, err = r.next.CountUsers(ctx)
+		return err
+	})
+	return count, err
+}
+
+// TopByUsage returns the users with the highest quota usage
+func (r *TimeoutUserRepository) TopByUsage(ctx context.Context, n int) ([]*domain.User, error) {
+	var users []*domain.User
+	err := r.call(ctx, "list top users by usage", func(ctx context.Context) error {
+		var err error
+		users, err = r.next.TopByUsage(ctx, n)
+		return err
+	})
+	return users, err
+}
+
+// ListPlanExpired returns active users whose paid period ended at or before the given time
+func (r *TimeoutUserRepository) ListPlanExpired(ctx context.Context, before time.Time) ([]*domain.User, error) {
+	var users []*domain.User
+	err := r.call(ctx, "list expired plans", func(ctx context.Context) error {
+		var err error
+		users, err = r.next.ListPlanExpired(ctx, before)
+		return err
+	})
+	return users, err
+}
+
+// CountAnonymizable returns how many users AnonymizeInactive would anonymize
+func (r *TimeoutUserRepository) CountAnonymizable(ctx context.Context, cutoff time.Time) (int64, error) {
+	var count int64
+	err := r.call(ctx, "count anonymizable users", func(ctx context.Context) error {
+		var err error
+		count, err = r.next.CountAnonymizable(ctx, cutoff)
+		return err
+	})
+	return count, err
+}
+
+// DailySignups returns the number of users who registered on each day of the window
+func (r *TimeoutUserRepository) DailySignups(ctx context.Context, from, to time.Time) ([]domain.DailyCount, error) {
+	var days []domain.DailyCount
+	err := r.call(ctx, "count daily signups", func(ctx context.Context) error {
+		var err error
+		days, err = r.next.DailySignups(ctx, from, to)
+		return err
+	})
+	return days, err
+}
+
+// AnonymizeInactive clears the personal data of users inactive since before cutoff
+func (r *TimeoutUserRepository) AnonymizeInactive(ctx context.Context, cutoff time.Time) ([]int64, error) {
+	var telegramIDs []int64
+	err := r.call(ctx, "anonymize inactive users", func(ctx context.Context) error {
+		var err error
+		telegramIDs, err = r.next.AnonymizeInactive(ctx, cutoff)
+		return err
+	})
+	return telegramIDs, err
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hangingUserRepository blocks every lookup until the context is done, like a hung database
+type hangingUserRepository struct {
+	domain.UserRepository
+	wrapContextErr bool
+}
+
+func (r *hangingUserRepository) GetByTelegramID(ctx context.Context, telegramID int64) (*domain.User, error) {
+	<-ctx.Done()
+	if r.wrapContextErr {
+		return nil, ctx.Err()
+	}
+	return nil, errors.New("driver: bad connection")
+}
+
+func TestTimeoutUserRepository_PassesThrough(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewTimeoutUserRepository(NewUserRepository(db), time.Second)
+	require.NoError(t, repo.Create(context.Background(), domain.NewUser(123, "testuser", "Test", "User")))
+
+	user, err := repo.GetByTelegramID(context.Background(), 123)
+	require.NoError(t, err)
+	assert.Equal(t, "testuser", user.Username)
+
+	_, err = repo.GetByTelegramID(context.Background(), 999)
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, domain.ErrDatabaseError))
+}
+
+func TestTimeoutUserRepository_ReturnsDatabaseErrorOnTimeout(t *testing.T) {
+	for _, wrapContextErr := range []bool{true, false} {
+		repo := NewTimeoutUserRepository(&hangingUserRepository{wrapContextErr: wrapContextErr}, 10*time.Millisecond)
+
+		_, err := repo.GetByTelegramID(context.Background(), 123)
+
+		require.Error(t, err)
+		assert.ErrorIs(t, err, domain.ErrDatabaseError)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		var dbErr domain.DatabaseError
+		require.ErrorAs(t, err, &dbErr)
+		assert.Equal(t, "get user", dbErr.Operation)
+	}
+}
+
+func TestNewTimeoutUserRepository_Disabled(t *testing.T) {
+	inner := &hangingUserRepository{}
+	assert.Same(t, inner, NewTimeoutUserRepository(inner, 0))
+}
@@ -2,10 +2,13 @@ package repository
 
 import (
 	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -164,4 +167,110 @@ func TestTransaction_CommitAndRollback(t *testing.T) {
 		assert.Error(t, result.Error)
 		assert.Equal(t, gorm.ErrRecordNotFound, result.Error)
 	})
-}
\ No newline at end of file
+}
+func TestTransactionManager_WithTransaction_RetriesDeadlocks(t *testing.T) {
+	db := setupTransactionTestDB(t)
+	tm := &TransactionManager{db: db, backoff: time.Millisecond}
+
+	t.Run("Deadlock is retried and the retry commits", func(t *testing.T) {
+		user := domain.NewUser(11111, "retried", "Test", "User")
+		attempts := 0
+
+		err := tm.WithTransaction(context.Background(), func(ctx context.Context, tx domain.Transaction) error {
+			attempts++
+			txRepo := NewUserRepositoryWithTx(tx.(*Transaction).tx)
+			if err := txRepo.Create(ctx, user); err != nil {
+				return err
+			}
+			if attempts == 1 {
+				return &pgError{code: "40P01"}
+			}
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, attempts)
+		count, err := NewUserRepository(db).CountUsers(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), count, "the aborted attempt must have been rolled back")
+	})
+
+	t.Run("Retries are bounded", func(t *testing.T) {
+		attempts := 0
+		err := tm.WithTransaction(context.Background(), func(ctx context.Context, tx domain.Transaction) error {
+			attempts++
+			return domain.DatabaseError{Operation: "update user", Err: fmt.Errorf("%w: %w", domain.ErrDeadlock, &pgError{code: "40001"})}
+		})
+
+		assert.ErrorIs(t, err, domain.ErrDeadlock)
+		assert.Equal(t, maxTransactionAttempts, attempts)
+	})
+
+	t.Run("Other errors are not retried", func(t *testing.T) {
+		attempts := 0
+		err := tm.WithTransaction(context.Background(), func(ctx context.Context, tx domain.Transaction) error {
+			attempts++
+			return domain.ErrInternalError
+		})
+
+		assert.Equal(t, domain.ErrInternalError, err)
+		assert.Equal(t, 1, attempts)
+	})
+}
+
+func TestTransaction_Repositories(t *testing.T) {
+	db := setupTransactionTestDB(t)
+	require.NoError(t, db.AutoMigrate(&domain.Payment{}))
+	tm := NewTransactionManager(db)
+	ctx := context.Background()
+	require.NoError(t, NewUserRepository(db).Create(ctx, domain.NewUser(123, "payer", "Test", "User")))
+
+	// A failure after the payment was stored rolls it back with the user update
+	err := tm.WithTransaction(ctx, func(ctx context.Context, tx domain.Transaction) error {
+		if err := tx.Payments().Create(ctx, &domain.Payment{TelegramID: 123, PlanName: "Basic", ProviderChargeID: "charge_1"}); err != nil {
+			return err
+		}
+		return tx.Users().UpdateQuota(ctx, 456, 1)
+	})
+	assert.Error(t, err)
+	exists, err := NewPaymentRepository(db).Exists(ctx, "charge_1")
+	require.NoError(t, err)
+	assert.False(t, exists, "the payment must have been rolled back")
+
+	// Both writes commit together
+	err = tm.WithTransaction(ctx, func(ctx context.Context, tx domain.Transaction) error {
+		if err := tx.Payments().Create(ctx, &domain.Payment{TelegramID: 123, PlanName: "Basic", ProviderChargeID: "charge_1"}); err != nil {
+			return err
+		}
+		return tx.Users().UpdateQuota(ctx, 123, 1)
+	})
+	require.NoError(t, err)
+	exists, err = NewPaymentRepository(db).Exists(ctx, "charge_1")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	user, err := NewUserRepository(db).GetByTelegramID(ctx, 123)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), user.QuotaUsed)
+}
+
+func TestTransaction_UsersQueryTimeout(t *testing.T) {
+	db := setupTransactionTestDB(t)
+	ctx := context.Background()
+	require.NoError(t, NewUserRepository(db).Create(ctx, domain.NewUser(123, "testuser", "Test", "User")))
+
+	var deadlines []bool
+	require.NoError(t, db.Callback().Query().Before("gorm:query").Register("test:deadline", func(db *gorm.DB) {
+		_, ok := db.Statement.Context.Deadline()
+		deadlines = append(deadlines, ok)
+	}))
+
+	for _, tm := range []domain.TransactionManager{NewTransactionManager(db), NewTransactionManagerWithTimeout(db, time.Second)} {
+		err := tm.WithTransaction(ctx, func(ctx context.Context, tx domain.Transaction) error {
+			_, err := tx.Users().GetByTelegramID(ctx, 123)
+			return err
+		})
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []bool{false, true}, deadlines, "only the manager with a timeout bounds transactional queries")
+}
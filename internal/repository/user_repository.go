@@ -2,7 +2,10 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
 	"gorm.io/gorm"
@@ -15,7 +18,8 @@ type UserRepository struct {
 
 // Transaction wraps a GORM database transaction
 type Transaction struct {
-	tx *gorm.DB
+	tx           *gorm.DB
+	queryTimeout time.Duration
 }
 
 // Commit commits the transaction
@@ -28,33 +32,83 @@ func (t *Transaction) Rollback() error {
 	return t.tx.Rollback().Error
 }
 
+// Users returns a user repository working inside the transaction, its queries bounded
+// by the manager's query timeout like those outside one
+func (t *Transaction) Users() domain.UserRepository {
+	return NewTimeoutUserRepository(&UserRepository{db: t.tx}, t.queryTimeout)
+}
+
+// Payments returns a payment repository working inside the transaction
+func (t *Transaction) Payments() domain.PaymentRepository {
+	return &PaymentRepository{db: t.tx}
+}
+
+// A transaction aborted by a deadlock or serialization failure is attempted at most
+// maxTransactionAttempts times, waiting transactionRetryBackoff, doubled after every
+// attempt, in between
+const (
+	maxTransactionAttempts  = 3
+	transactionRetryBackoff = 50 * time.Millisecond
+)
+
 // TransactionManager implements domain.TransactionManager
 type TransactionManager struct {
-	db *gorm.DB
+	db           *gorm.DB
+	backoff      time.Duration
+	queryTimeout time.Duration
 }
 
 // NewTransactionManager creates a new transaction manager
 func NewTransactionManager(db *gorm.DB) domain.TransactionManager {
-	return &TransactionManager{db: db}
+	return NewTransactionManagerWithTimeout(db, 0)
+}
+
+// NewTransactionManagerWithTimeout creates a transaction manager whose transactional
+// user repositories bound each query by queryTimeout. Zero or less disables it
+func NewTransactionManagerWithTimeout(db *gorm.DB, queryTimeout time.Duration) domain.TransactionManager {
+	return &TransactionManager{db: db, backoff: transactionRetryBackoff, queryTimeout: queryTimeout}
 }
 
-// WithTransaction executes a function within a database transaction
+// WithTransaction executes a function within a database transaction. The transaction
+// is rolled back and run again when it loses a deadlock or serialization conflict, so
+// fn must be safe to repeat; any other error is returned right away. fn must not
+// publish events or send messages, as a rolled back attempt would still have done so:
+// callers publish once WithTransaction returned
 func (tm *TransactionManager) WithTransaction(ctx context.Context, fn func(ctx context.Context, tx domain.Transaction) error) error {
-	return tm.db.Transaction(func(tx *gorm.DB) error {
-		transaction := &Transaction{tx: tx}
-		return fn(ctx, transaction)
-	})
+	backoff := tm.backoff
+	for attempt := 1; ; attempt++ {
+		err := tm.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			transaction := &Transaction{tx: tx, queryTimeout: tm.queryTimeout}
+			return fn(ctx, transaction)
+		})
+		if err == nil || attempt == maxTransactionAttempts || !isRetryableTxError(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// isRetryableTxError reports whether err means the transaction was aborted by a
+// conflict with a concurrent one and may succeed when run again
+func isRetryableTxError(err error) bool {
+	return errors.Is(err, domain.ErrDeadlock) || isDeadlock(err)
 }
 
 // BeginTx starts a new transaction and returns a transactional repository
 func (tm *TransactionManager) BeginTx(ctx context.Context) (domain.UserRepository, domain.Transaction, error) {
 	tx := tm.db.Begin()
 	if tx.Error != nil {
-		return nil, nil, fmt.Errorf("failed to begin transaction: %w", tx.Error)
+		return nil, nil, classifyDBError(tm.db, tx.Error, "begin transaction", nil, nil)
 	}
 	
-	txRepo := &UserRepository{db: tx}
-	transaction := &Transaction{tx: tx}
+	transaction := &Transaction{tx: tx, queryTimeout: tm.queryTimeout}
+	txRepo := transaction.Users()
 	
 	return txRepo, transaction, nil
 }
@@ -69,33 +123,97 @@ func NewUserRepositoryWithTx(tx *gorm.DB) domain.UserRepository {
 	return &UserRepository{db: tx}
 }
 
-// Create inserts a new user into the database
+// createUserSavepoint names the savepoint Create sets inside a transaction
+const createUserSavepoint = "create_user"
+
+// Create inserts a new user into the database. A user with the same Telegram ID
+// returns domain.UserAlreadyExistsError; inside a transaction the insert runs under
+// a savepoint, so the failed insert does not abort the rest of the transaction
 func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
-	result := r.db.WithContext(ctx).Create(user)
+	db := r.db.WithContext(ctx)
+	inTx := r.inTransaction()
+	if inTx {
+		if err := db.SavePoint(createUserSavepoint).Error; err != nil {
+			return classifyDBError(r.db, err, "create user savepoint", nil, nil)
+		}
+	}
+
+	result := db.Create(user)
 	if result.Error != nil {
-		return fmt.Errorf("failed to create user: %w", result.Error)
+		if inTx {
+			if err := db.RollbackTo(createUserSavepoint).Error; err != nil {
+				return classifyDBError(r.db, err, "roll back to user savepoint", nil, nil)
+			}
+		}
+		return classifyDBError(r.db, result.Error, "create user", nil, domain.UserAlreadyExistsError{TelegramID: user.TelegramID})
 	}
 	return nil
 }
 
-// GetByTelegramID retrieves a user by their Telegram ID
+// inTransaction reports whether the repository runs inside a database transaction
+func (r *UserRepository) inTransaction() bool {
+	committer, ok := r.db.Statement.ConnPool.(gorm.TxCommitter)
+	return ok && committer != nil
+}
+
+// GetByTelegramID retrieves a user by their Telegram ID, skipping soft-deleted users
 func (r *UserRepository) GetByTelegramID(ctx context.Context, telegramID int64) (*domain.User, error) {
 	var user domain.User
 	result := r.db.WithContext(ctx).Where("telegram_id = ?", telegramID).First(&user)
 	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			return nil, domain.UserNotFoundError{TelegramID: telegramID}
-		}
-		return nil, fmt.Errorf("failed to get user: %w", result.Error)
+		return nil, classifyDBError(r.db, result.Error, "get user", domain.UserNotFoundError{TelegramID: telegramID}, nil)
 	}
 	return &user, nil
 }
 
+// GetByReferralCode finds the user owning a referral code
+func (r *UserRepository) GetByReferralCode(ctx context.Context, code string) (*domain.User, error) {
+	var user domain.User
+	result := r.db.WithContext(ctx).Where("referral_code = ?", code).Order("created_at").First(&user)
+	if result.Error != nil {
+		return nil, classifyDBError(r.db, result.Error, "get user by referral code", domain.UserNotFoundError{ReferralCode: code}, nil)
+	}
+	return &user, nil
+}
+
+// GetByTelegramIDIncludingDeleted retrieves a user by their Telegram ID, including soft-deleted users
+func (r *UserRepository) GetByTelegramIDIncludingDeleted(ctx context.Context, telegramID int64) (*domain.User, error) {
+	var user domain.User
+	result := r.db.WithContext(ctx).Unscoped().Where("telegram_id = ?", telegramID).First(&user)
+	if result.Error != nil {
+		return nil, classifyDBError(r.db, result.Error, "get user including deleted", domain.UserNotFoundError{TelegramID: telegramID}, nil)
+	}
+	return &user, nil
+}
+
+// GetByUsername retrieves a user by username, ignoring case and skipping soft-deleted
+// users. More than one match returns domain.ErrAmbiguousUsername
+func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*domain.User, error) {
+	var users []*domain.User
+	result := r.db.WithContext(ctx).
+		Where("LOWER(username) = ?", strings.ToLower(username)).
+		Order("created_at").
+		Limit(2).
+		Find(&users)
+	if result.Error != nil {
+		return nil, classifyDBError(r.db, result.Error, "get user by username", nil, nil)
+	}
+
+	switch len(users) {
+	case 0:
+		return nil, domain.UserNotFoundError{Username: username}
+	case 1:
+		return users[0], nil
+	default:
+		return nil, fmt.Errorf("%w: %s", domain.ErrAmbiguousUsername, username)
+	}
+}
+
 // Update updates an existing user in the database
 func (r *UserRepository) Update(ctx context.Context, user *domain.User) error {
 	result := r.db.WithContext(ctx).Save(user)
 	if result.Error != nil {
-		return fmt.Errorf("failed to update user: %w", result.Error)
+		return classifyDBError(r.db, result.Error, "update user", nil, nil)
 	}
 	if result.RowsAffected == 0 {
 		return domain.UserNotFoundError{TelegramID: user.TelegramID}
@@ -112,10 +230,260 @@ func (r *UserRepository) UpdateQuota(ctx context.Context, telegramID int64, quot
 		})
 
 	if result.Error != nil {
-		return fmt.Errorf("failed to update quota: %w", result.Error)
+		return classifyDBError(r.db, result.Error, "update quota", nil, nil)
 	}
 	if result.RowsAffected == 0 {
 		return domain.UserNotFoundError{TelegramID: telegramID}
 	}
 	return nil
 }
+
+// AddQuotaLimit raises the quota_limit field for a user by bytes in place
+func (r *UserRepository) AddQuotaLimit(ctx context.Context, telegramID int64, bytes int64) error {
+	result := r.db.WithContext(ctx).Model(&domain.User{}).
+		Where("telegram_id = ?", telegramID).
+		Updates(map[string]interface{}{
+			"quota_limit": gorm.Expr("quota_limit + ?", bytes),
+			"updated_at":  time.Now(),
+		})
+
+	if result.Error != nil {
+		return classifyDBError(r.db, result.Error, "add quota limit", nil, nil)
+	}
+	if result.RowsAffected == 0 {
+		return domain.UserNotFoundError{TelegramID: telegramID}
+	}
+	return nil
+}
+
+// UpdateQuotaAlertedPct updates only the quota_alerted_pct field for a user
+func (r *UserRepository) UpdateQuotaAlertedPct(ctx context.Context, telegramID int64, pct int) error {
+	result := r.db.WithContext(ctx).Model(&domain.User{}).
+		Where("telegram_id = ?", telegramID).
+		Update("quota_alerted_pct", pct)
+
+	if result.Error != nil {
+		return classifyDBError(r.db, result.Error, "update quota alerted percentage", nil, nil)
+	}
+	if result.RowsAffected == 0 {
+		return domain.UserNotFoundError{TelegramID: telegramID}
+	}
+	return nil
+}
+
+// UpdateUnreachableAt updates only the unreachable_at field for a user
+func (r *UserRepository) UpdateUnreachableAt(ctx context.Context, telegramID int64, at *time.Time) error {
+	result := r.db.WithContext(ctx).Model(&domain.User{}).
+		Where("telegram_id = ?", telegramID).
+		Update("unreachable_at", at)
+
+	if result.Error != nil {
+		return classifyDBError(r.db, result.Error, "update unreachable time", nil, nil)
+	}
+	if result.RowsAffected == 0 {
+		return domain.UserNotFoundError{TelegramID: telegramID}
+	}
+	return nil
+}
+
+// UpdateBlocked updates only the blocked field for a user
+func (r *UserRepository) UpdateBlocked(ctx context.Context, telegramID int64, blocked bool) error {
+	result := r.db.WithContext(ctx).Model(&domain.User{}).
+		Where("telegram_id = ?", telegramID).
+		Update("blocked", blocked)
+
+	if result.Error != nil {
+		return classifyDBError(r.db, result.Error, "update blocked flag", nil, nil)
+	}
+	if result.RowsAffected == 0 {
+		return domain.UserNotFoundError{TelegramID: telegramID}
+	}
+	return nil
+}
+
+// UpdateLastActiveAt records when the user last sent the bot an update. It leaves
+// updated_at alone, which tracks changes to the account rather than activity
+func (r *UserRepository) UpdateLastActiveAt(ctx context.Context, telegramID int64, at time.Time) error {
+	result := r.db.WithContext(ctx).Model(&domain.User{}).
+		Where("telegram_id = ?", telegramID).
+		UpdateColumn("last_active_at", at)
+
+	if result.Error != nil {
+		return classifyDBError(r.db, result.Error, "update last activity", nil, nil)
+	}
+	if result.RowsAffected == 0 {
+		return domain.UserNotFoundError{TelegramID: telegramID}
+	}
+	return nil
+}
+
+// Delete soft-deletes a user by setting deleted_at
+func (r *UserRepository) Delete(ctx context.Context, telegramID int64) error {
+	result := r.db.WithContext(ctx).Where("telegram_id = ?", telegramID).Delete(&domain.User{})
+	if result.Error != nil {
+		return classifyDBError(r.db, result.Error, "delete user", nil, nil)
+	}
+	if result.RowsAffected == 0 {
+		return domain.UserNotFoundError{TelegramID: telegramID}
+	}
+	return nil
+}
+
+// Restore clears the soft-delete marker of a deleted user
+func (r *UserRepository) Restore(ctx context.Context, telegramID int64) error {
+	result := r.db.WithContext(ctx).Unscoped().Model(&domain.User{}).
+		Where("telegram_id = ? AND deleted_at IS NOT NULL", telegramID).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return classifyDBError(r.db, result.Error, "restore user", nil, nil)
+	}
+	if result.RowsAffected == 0 {
+		return domain.UserNotFoundError{TelegramID: telegramID}
+	}
+	return nil
+}
+
+// CountByStatus returns the number of users grouped by status
+func (r *UserRepository) CountByStatus(ctx context.Context) (map[string]int64, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	result := r.db.WithContext(ctx).Model(&domain.User{}).
+		Select("status, COUNT(*) AS count").
+		Group("status").
+		Scan(&rows)
+	if result.Error != nil {
+		return nil, classifyDBError(r.db, result.Error, "count users by status", nil, nil)
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// TotalQuotaUsed returns the sum of quota used across all users
+func (r *UserRepository) TotalQuotaUsed(ctx context.Context) (int64, error) {
+	var total int64
+	result := r.db.WithContext(ctx).Model(&domain.User{}).
+		Select("COALESCE(SUM(quota_used), 0)").
+		Scan(&total)
+	if result.Error != nil {
+		return 0, classifyDBError(r.db, result.Error, "sum quota used", nil, nil)
+	}
+	return total, nil
+}
+
+// DailySignups returns the number of users who registered on each UTC day from the
+// day of from through the day of to, including deleted users and days without signups
+func (r *UserRepository) DailySignups(ctx context.Context, from, to time.Time) ([]domain.DailyCount, error) {
+	first := from.UTC().Truncate(24 * time.Hour)
+	last := to.UTC().Truncate(24 * time.Hour)
+
+	// Days are bucketed here rather than in SQL, whose date functions differ between databases
+	var createdAt []time.Time
+	result := r.db.WithContext(ctx).Unscoped().Model(&domain.User{}).
+		Where("created_at >= ? AND created_at < ?", first, last.AddDate(0, 0, 1)).
+		Pluck("created_at", &createdAt)
+	if result.Error != nil {
+		return nil, classifyDBError(r.db, result.Error, "count daily signups", nil, nil)
+	}
+
+	var days []domain.DailyCount
+	index := make(map[time.Time]int)
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		index[day] = len(days)
+		days = append(days, domain.DailyCount{Day: day})
+	}
+	for _, t := range createdAt {
+		if i, ok := index[t.UTC().Truncate(24*time.Hour)]; ok {
+			days[i].Count++
+		}
+	}
+	return days, nil
+}
+
+// ListUsers returns up to limit users ordered by ID, skipping the first offset
+func (r *UserRepository) ListUsers(ctx context.Context, offset, limit int) ([]*domain.User, error) {
+	var users []*domain.User
+	result := r.db.WithContext(ctx).Order("id").Offset(offset).Limit(limit).Find(&users)
+	if result.Error != nil {
+		return nil, classifyDBError(r.db, result.Error, "list users", nil, nil)
+	}
+	return users, nil
+}
+
+// CountUsers returns the number of users
+func (r *UserRepository) CountUsers(ctx context.Context) (int64, error) {
+	var count int64
+	result := r.db.WithContext(ctx).Model(&domain.User{}).Count(&count)
+	if result.Error != nil {
+		return 0, classifyDBError(r.db, result.Error, "count users", nil, nil)
+	}
+	return count, nil
+}
+
+// TopByUsage returns up to n users with the highest quota usage, heaviest first
+func (r *UserRepository) TopByUsage(ctx context.Context, n int) ([]*domain.User, error) {
+	var users []*domain.User
+	result := r.db.WithContext(ctx).Order("quota_used DESC").Order("id").Limit(n).Find(&users)
+	if result.Error != nil {
+		return nil, classifyDBError(r.db, result.Error, "list top users by usage", nil, nil)
+	}
+	return users, nil
+}
+
+// ListPlanExpired returns active users whose paid period ended at or before the given time
+func (r *UserRepository) ListPlanExpired(ctx context.Context, before time.Time) ([]*domain.User, error) {
+	var users []*domain.User
+	result := r.db.WithContext(ctx).
+		Where("status = ? AND plan_expires_at IS NOT NULL AND plan_expires_at <= ?", domain.UserStatusActive, before).
+		Order("plan_expires_at").
+		Find(&users)
+	if result.Error != nil {
+		return nil, classifyDBError(r.db, result.Error, "list expired plans", nil, nil)
+	}
+	return users, nil
+}
+
+// anonymizableUsers selects users of any status, deleted ones included, last active
+// before cutoff that still hold personal data. Users not active since last_active_at
+// was introduced fall back to when their account last changed
+func anonymizableUsers(db *gorm.DB, cutoff time.Time) *gorm.DB {
+	return db.Unscoped().Model(&domain.User{}).
+		Where("COALESCE(last_active_at, updated_at) < ?", cutoff).
+		Where("username <> '' OR first_name <> '' OR last_name <> ''")
+}
+
+// CountAnonymizable returns how many users AnonymizeInactive would anonymize
+func (r *UserRepository) CountAnonymizable(ctx context.Context, cutoff time.Time) (int64, error) {
+	var count int64
+	if err := anonymizableUsers(r.db.WithContext(ctx), cutoff).Count(&count).Error; err != nil {
+		return 0, classifyDBError(r.db, err, "count anonymizable users", nil, nil)
+	}
+	return count, nil
+}
+
+// AnonymizeInactive clears the username and names of users, whatever their status, last
+// active before cutoff and returns their Telegram IDs. Rows are kept for aggregates
+func (r *UserRepository) AnonymizeInactive(ctx context.Context, cutoff time.Time) ([]int64, error) {
+	var telegramIDs []int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := anonymizableUsers(tx, cutoff).Order("telegram_id").Pluck("telegram_id", &telegramIDs).Error; err != nil {
+			return err
+		}
+		if len(telegramIDs) == 0 {
+			return nil
+		}
+		// UpdateColumns leaves updated_at alone so anonymizing is not mistaken for a change by the user
+		return anonymizableUsers(tx, cutoff).
+			Where("telegram_id IN ?", telegramIDs).
+			UpdateColumns(map[string]interface{}{"username": "", "first_name": "", "last_name": ""}).Error
+	})
+	if err != nil {
+		return nil, classifyDBError(r.db, err, "anonymize inactive users", nil, nil)
+	}
+	return telegramIDs, nil
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
 	"github.com/stretchr/testify/assert"
@@ -27,6 +28,21 @@ func setupTestDB(t *testing.T) (*gorm.DB, func()) {
 	}
 }
 
+// newSQLiteDB opens an in-memory SQLite database with the tables of models, closed
+// when the test ends
+func newSQLiteDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(models...))
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+	return db
+}
+
 func TestUserRepository_Create(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -52,8 +68,29 @@ func TestUserRepository_Create_DuplicateTelegramID(t *testing.T) {
 	assert.NoError(t, err)
 
 	err = repo.Create(context.Background(), user2)
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to create user")
+	assert.ErrorIs(t, err, domain.ErrUserAlreadyExists)
+}
+
+func TestUserRepository_Create_DuplicateInTransaction(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	require.NoError(t, NewUserRepository(db).Create(ctx, domain.NewUser(123, "existing", "Test", "User")))
+
+	txRepo, tx, err := NewTransactionManager(db).BeginTx(ctx)
+	require.NoError(t, err)
+
+	err = txRepo.Create(ctx, domain.NewUser(123, "duplicate", "Test", "User"))
+	assert.ErrorIs(t, err, domain.ErrUserAlreadyExists)
+
+	// The transaction is still usable after the failed insert
+	require.NoError(t, txRepo.Create(ctx, domain.NewUser(456, "other", "Test", "User")))
+	require.NoError(t, tx.Commit())
+
+	user, err := NewUserRepository(db).GetByTelegramID(ctx, 456)
+	require.NoError(t, err)
+	assert.Equal(t, "other", user.Username)
 }
 
 func TestUserRepository_GetByTelegramID(t *testing.T) {
@@ -139,6 +176,67 @@ func TestUserRepository_UpdateQuota(t *testing.T) {
 	assert.Equal(t, newQuotaUsed, updatedUser.QuotaUsed)
 }
 
+func TestUserRepository_UpdateQuotaAlertedPct(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	require.NoError(t, repo.Create(context.Background(), domain.NewUser(123, "testuser", "Test", "User")))
+
+	require.NoError(t, repo.UpdateQuotaAlertedPct(context.Background(), 123, 80))
+
+	updatedUser, err := repo.GetByTelegramID(context.Background(), 123)
+	require.NoError(t, err)
+	assert.Equal(t, 80, updatedUser.QuotaAlertedPct)
+
+	assert.ErrorIs(t, repo.UpdateQuotaAlertedPct(context.Background(), 999, 80), domain.ErrUserNotFound)
+}
+
+func TestUserRepository_UpdateUnreachableAt(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+	require.NoError(t, repo.Create(ctx, domain.NewUser(123, "testuser", "Test", "User")))
+
+	at := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, repo.UpdateUnreachableAt(ctx, 123, &at))
+
+	updatedUser, err := repo.GetByTelegramID(ctx, 123)
+	require.NoError(t, err)
+	assert.True(t, updatedUser.IsUnreachable())
+	assert.True(t, at.Equal(*updatedUser.UnreachableAt))
+
+	require.NoError(t, repo.UpdateUnreachableAt(ctx, 123, nil))
+	updatedUser, err = repo.GetByTelegramID(ctx, 123)
+	require.NoError(t, err)
+	assert.False(t, updatedUser.IsUnreachable())
+
+	assert.ErrorIs(t, repo.UpdateUnreachableAt(ctx, 999, &at), domain.ErrUserNotFound)
+}
+
+func TestUserRepository_UpdateBlocked(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+	require.NoError(t, repo.Create(ctx, domain.NewUser(123, "testuser", "Test", "User")))
+
+	require.NoError(t, repo.UpdateBlocked(ctx, 123, true))
+	updatedUser, err := repo.GetByTelegramID(ctx, 123)
+	require.NoError(t, err)
+	assert.True(t, updatedUser.Blocked)
+
+	require.NoError(t, repo.UpdateBlocked(ctx, 123, false))
+	updatedUser, err = repo.GetByTelegramID(ctx, 123)
+	require.NoError(t, err)
+	assert.False(t, updatedUser.Blocked)
+
+	assert.ErrorIs(t, repo.UpdateBlocked(ctx, 999, true), domain.ErrUserNotFound)
+}
+
 func TestUserRepository_UpdateQuota_NotFound(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -150,3 +248,455 @@ func TestUserRepository_UpdateQuota_NotFound(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "user not found")
 }
+
+func TestUserRepository_CountByStatus(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+
+	statuses := []string{
+		domain.UserStatusInactive,
+		domain.UserStatusTrial,
+		domain.UserStatusTrial,
+		domain.UserStatusActive,
+	}
+	for i, status := range statuses {
+		user := domain.NewUser(int64(100+i), "user", "Test", "User")
+		user.Status = status
+		require.NoError(t, repo.Create(ctx, user))
+	}
+
+	counts, err := repo.CountByStatus(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), counts[domain.UserStatusInactive])
+	assert.Equal(t, int64(2), counts[domain.UserStatusTrial])
+	assert.Equal(t, int64(1), counts[domain.UserStatusActive])
+}
+
+func TestUserRepository_ListPlanExpired(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+	now := time.Now()
+	plan := domain.Plan{Name: "Basic", QuotaLimit: 1024, Price: 4.99, Currency: "USD", BillingPeriodDays: 30}
+
+	planExpiries := map[int64]time.Time{
+		300: now.Add(-time.Hour),     // lapsed
+		301: now.Add(24 * time.Hour), // still paid
+	}
+	for telegramID, planExpiresAt := range planExpiries {
+		user := domain.NewUser(telegramID, "user", "Test", "User")
+		user.ApplyPlan(plan)
+		user.PlanExpiresAt = &planExpiresAt
+		require.NoError(t, repo.Create(ctx, user))
+	}
+	// Users without a paid plan are never listed
+	require.NoError(t, repo.Create(ctx, domain.NewUser(302, "user", "Test", "User")))
+
+	users, err := repo.ListPlanExpired(ctx, now)
+
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, int64(300), users[0].TelegramID)
+}
+
+func TestUserRepository_GetByReferralCode(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+
+	user := domain.NewUser(500, "referrer", "Test", "User")
+	user.ReferralCode = "ABCD2345"
+	require.NoError(t, repo.Create(ctx, user))
+
+	found, err := repo.GetByReferralCode(ctx, "ABCD2345")
+	require.NoError(t, err)
+	assert.Equal(t, int64(500), found.TelegramID)
+
+	_, err = repo.GetByReferralCode(ctx, "ZZZZ2345")
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	assert.Contains(t, err.Error(), "referral code ZZZZ2345")
+}
+
+func TestUserRepository_ReferralCodeUnique(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+
+	// Users created without a code get one of their own
+	first := domain.NewUser(500, "first", "Test", "User")
+	second := domain.NewUser(501, "second", "Test", "User")
+	require.NoError(t, repo.Create(ctx, first))
+	require.NoError(t, repo.Create(ctx, second))
+	assert.NotEmpty(t, first.ReferralCode)
+	assert.NotEqual(t, first.ReferralCode, second.ReferralCode)
+
+	duplicate := domain.NewUser(502, "duplicate", "Test", "User")
+	duplicate.ReferralCode = first.ReferralCode
+	assert.Error(t, repo.Create(ctx, duplicate))
+}
+
+func TestUserRepository_AddQuotaLimit(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+	require.NoError(t, repo.Create(ctx, domain.NewUser(500, "referrer", "Test", "User")))
+
+	// A stale copy saved in between does not undo the credit of the other
+	stale, err := repo.GetByTelegramID(ctx, 500)
+	require.NoError(t, err)
+	require.NoError(t, repo.AddQuotaLimit(ctx, 500, 1024))
+	require.NoError(t, repo.AddQuotaLimit(ctx, 500, 2048))
+
+	user, err := repo.GetByTelegramID(ctx, 500)
+	require.NoError(t, err)
+	assert.Equal(t, stale.QuotaLimit+3072, user.QuotaLimit)
+
+	assert.ErrorIs(t, repo.AddQuotaLimit(ctx, 999, 1024), domain.ErrUserNotFound)
+}
+
+func TestUserRepository_AnonymizeInactive(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+	now := time.Now()
+	cutoff := now.Add(-30 * 24 * time.Hour)
+	longAgo := cutoff.Add(-24 * time.Hour)
+
+	users := []struct {
+		telegramID   int64
+		status       string
+		lastActiveAt *time.Time
+		updatedAt    time.Time
+	}{
+		{400, domain.UserStatusInactive, &longAgo, now},  // eligible: a recent account change is not activity
+		{401, domain.UserStatusInactive, &now, longAgo},  // recently active
+		{402, domain.UserStatusTrial, &longAgo, longAgo}, // eligible
+		{403, domain.UserStatusActive, &longAgo, now},    // eligible whatever the status
+		{404, domain.UserStatusBanned, nil, longAgo},     // eligible: not active since, and not changed since
+		{406, domain.UserStatusActive, nil, now},         // not active since, but changed recently
+	}
+	for _, u := range users {
+		user := domain.NewUser(u.telegramID, "user", "Test", "User")
+		user.Status = u.status
+		user.LastActiveAt = u.lastActiveAt
+		user.UpdatedAt = u.updatedAt
+		require.NoError(t, repo.Create(ctx, user))
+	}
+	// Deleted accounts are anonymized too
+	deleted := domain.NewUser(405, "gone", "Gone", "User")
+	deleted.Status = domain.UserStatusTrial
+	deleted.LastActiveAt = &longAgo
+	require.NoError(t, repo.Create(ctx, deleted))
+	require.NoError(t, repo.Delete(ctx, 405))
+
+	// Counting is a dry run: it reports the affected users but changes nothing
+	count, err := repo.CountAnonymizable(ctx, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), count)
+	user, err := repo.GetByTelegramID(ctx, 400)
+	require.NoError(t, err)
+	assert.Equal(t, "user", user.Username)
+
+	anonymized, err := repo.AnonymizeInactive(ctx, cutoff)
+
+	require.NoError(t, err)
+	assert.Equal(t, []int64{400, 402, 403, 404, 405}, anonymized)
+
+	user, err = repo.GetByTelegramID(ctx, 403)
+	require.NoError(t, err)
+	assert.Empty(t, user.Username)
+	assert.Empty(t, user.FirstName)
+	assert.Empty(t, user.LastName)
+	assert.Equal(t, domain.UserStatusActive, user.Status)
+
+	for _, telegramID := range []int64{401, 406} {
+		user, err := repo.GetByTelegramID(ctx, telegramID)
+		require.NoError(t, err)
+		assert.Equal(t, "user", user.Username, "user %d should keep their data", telegramID)
+	}
+
+	// Anonymized rows still count towards aggregates
+	count, err = repo.CountUsers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), count)
+
+	// A second run finds nothing left to anonymize
+	anonymized, err = repo.AnonymizeInactive(ctx, cutoff)
+	require.NoError(t, err)
+	assert.Empty(t, anonymized)
+}
+
+func TestUserRepository_UpdateLastActiveAt(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+	user := domain.NewUser(123, "user", "Test", "User")
+	require.NoError(t, repo.Create(ctx, user))
+	updatedAt := user.UpdatedAt
+
+	at := time.Now().Add(time.Hour).Truncate(time.Second)
+	require.NoError(t, repo.UpdateLastActiveAt(ctx, 123, at))
+
+	stored, err := repo.GetByTelegramID(ctx, 123)
+	require.NoError(t, err)
+	require.NotNil(t, stored.LastActiveAt)
+	assert.True(t, at.Equal(*stored.LastActiveAt))
+	assert.True(t, updatedAt.Equal(stored.UpdatedAt), "activity is not an account change")
+
+	assert.ErrorIs(t, repo.UpdateLastActiveAt(ctx, 999, at), domain.ErrUserNotFound)
+}
+
+func TestUserRepository_TotalQuotaUsed(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+
+	total, err := repo.TotalQuotaUsed(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), total)
+
+	for i, used := range []int64{1024, 2048} {
+		user := domain.NewUser(int64(200+i), "user", "Test", "User")
+		user.QuotaUsed = used
+		require.NoError(t, repo.Create(ctx, user))
+	}
+
+	total, err = repo.TotalQuotaUsed(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3072), total)
+}
+
+func TestUserRepository_DailySignups(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+
+	day := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	signups := []time.Time{
+		day.Add(-time.Minute), // before the window
+		day.Add(time.Hour),
+		day.Add(23 * time.Hour),
+		day.AddDate(0, 0, 2).Add(12 * time.Hour),
+		day.AddDate(0, 0, 3).Add(time.Hour), // after the window
+	}
+	for i, createdAt := range signups {
+		user := domain.NewUser(int64(300+i), "user", "Test", "User")
+		user.CreatedAt = createdAt
+		require.NoError(t, repo.Create(ctx, user))
+	}
+	// Users who deleted their account still count as signups
+	require.NoError(t, repo.Delete(ctx, 302))
+
+	days, err := repo.DailySignups(ctx, day.Add(6*time.Hour), day.AddDate(0, 0, 2).Add(6*time.Hour))
+
+	require.NoError(t, err)
+	assert.Equal(t, []domain.DailyCount{
+		{Day: day, Count: 2},
+		{Day: day.AddDate(0, 0, 1), Count: 0},
+		{Day: day.AddDate(0, 0, 2), Count: 1},
+	}, days)
+}
+
+func TestUserRepository_Delete(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	require.NoError(t, repo.Create(ctx, user))
+
+	err := repo.Delete(ctx, 123)
+	assert.NoError(t, err)
+
+	_, err = repo.GetByTelegramID(ctx, 123)
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+}
+
+func TestUserRepository_Delete_NotFound(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+
+	err := repo.Delete(context.Background(), 999)
+
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+}
+
+func TestUserRepository_Delete_IsSoft(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+
+	require.NoError(t, repo.Create(ctx, domain.NewUser(123, "testuser", "Test", "User")))
+	require.NoError(t, repo.Delete(ctx, 123))
+
+	user, err := repo.GetByTelegramIDIncludingDeleted(ctx, 123)
+	require.NoError(t, err)
+	assert.True(t, user.IsDeleted())
+
+	// Soft-deleted users are excluded from aggregates
+	counts, err := repo.CountByStatus(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, counts)
+
+	// Deleting again reports the user as missing
+	err = repo.Delete(ctx, 123)
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+}
+
+func TestUserRepository_Restore(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+
+	require.NoError(t, repo.Create(ctx, domain.NewUser(123, "testuser", "Test", "User")))
+	require.NoError(t, repo.Delete(ctx, 123))
+
+	err := repo.Restore(ctx, 123)
+	assert.NoError(t, err)
+
+	user, err := repo.GetByTelegramID(ctx, 123)
+	require.NoError(t, err)
+	assert.False(t, user.IsDeleted())
+}
+
+func TestUserRepository_Restore_NotDeleted(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+
+	require.NoError(t, repo.Create(ctx, domain.NewUser(123, "testuser", "Test", "User")))
+
+	err := repo.Restore(ctx, 123)
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+
+	err = repo.Restore(ctx, 999)
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+}
+
+func TestUserRepository_GetByTelegramIDIncludingDeleted_NotFound(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+
+	user, err := repo.GetByTelegramIDIncludingDeleted(context.Background(), 999)
+
+	assert.Nil(t, user)
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+}
+
+func TestUserRepository_ListUsers(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, repo.Create(ctx, domain.NewUser(int64(100+i), "user", "Test", "User")))
+	}
+	require.NoError(t, repo.Delete(ctx, 104))
+
+	count, err := repo.CountUsers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), count)
+
+	page, err := repo.ListUsers(ctx, 1, 2)
+	require.NoError(t, err)
+	require.Len(t, page, 2)
+	assert.Equal(t, int64(101), page[0].TelegramID)
+	assert.Equal(t, int64(102), page[1].TelegramID)
+
+	last, err := repo.ListUsers(ctx, 3, 2)
+	require.NoError(t, err)
+	require.Len(t, last, 1)
+	assert.Equal(t, int64(103), last[0].TelegramID)
+}
+
+func TestUserRepository_GetByUsername(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+
+	require.NoError(t, repo.Create(ctx, domain.NewUser(100, "Alice", "Alice", "A")))
+	require.NoError(t, repo.Create(ctx, domain.NewUser(101, "bob", "Bob", "B")))
+	require.NoError(t, repo.Create(ctx, domain.NewUser(102, "BOB", "Bob", "C")))
+	require.NoError(t, repo.Create(ctx, domain.NewUser(103, "carol", "Carol", "C")))
+	require.NoError(t, repo.Delete(ctx, 103))
+
+	t.Run("Matches case-insensitively", func(t *testing.T) {
+		user, err := repo.GetByUsername(ctx, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, int64(100), user.TelegramID)
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		_, err := repo.GetByUsername(ctx, "dave")
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+
+		_, err = repo.GetByUsername(ctx, "carol")
+		assert.ErrorIs(t, err, domain.ErrUserNotFound, "soft-deleted users are skipped")
+	})
+
+	t.Run("Ambiguous", func(t *testing.T) {
+		user, err := repo.GetByUsername(ctx, "Bob")
+		assert.Nil(t, user)
+		assert.ErrorIs(t, err, domain.ErrAmbiguousUsername)
+	})
+}
+
+func TestUserRepository_TopByUsage(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewUserRepository(db)
+	ctx := context.Background()
+
+	for i, used := range []int64{300, 100, 500, 200, 400} {
+		user := domain.NewUser(int64(100+i), "user", "Test", "User")
+		user.QuotaUsed = used
+		require.NoError(t, repo.Create(ctx, user))
+	}
+
+	top, err := repo.TopByUsage(ctx, 3)
+	require.NoError(t, err)
+	require.Len(t, top, 3)
+	assert.Equal(t, []int64{500, 400, 300}, []int64{top[0].QuotaUsed, top[1].QuotaUsed, top[2].QuotaUsed})
+
+	all, err := repo.TopByUsage(ctx, 10)
+	require.NoError(t, err)
+	assert.Len(t, all, 5)
+	assert.Equal(t, int64(100), all[4].QuotaUsed)
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UserSightingRepository implements domain.UserSightingRepository using GORM
+type UserSightingRepository struct {
+	db *gorm.DB
+}
+
+// NewUserSightingRepository creates a new UserSightingRepository instance
+func NewUserSightingRepository(db *gorm.DB) domain.UserSightingRepository {
+	return &UserSightingRepository{db: db}
+}
+
+// RecordFirstSeen inserts the sighting and leaves an existing one untouched
+func (r *UserSightingRepository) RecordFirstSeen(ctx context.Context, telegramID int64, seenAt time.Time) error {
+	sighting := domain.UserSighting{TelegramID: telegramID, FirstSeenAt: seenAt}
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&sighting)
+	if result.Error != nil {
+		return classifyDBError(r.db, result.Error, "record first seen", nil, nil)
+	}
+	return nil
+}
+
+// GetFirstSeen returns when the user was first seen
+func (r *UserSightingRepository) GetFirstSeen(ctx context.Context, telegramID int64) (time.Time, error) {
+	var sighting domain.UserSighting
+	result := r.db.WithContext(ctx).Where("telegram_id = ?", telegramID).First(&sighting)
+	if result.Error != nil {
+		return time.Time{}, classifyDBError(r.db, result.Error, "get first seen", domain.ErrUserNotFound, nil)
+	}
+	return sighting.FirstSeenAt, nil
+}
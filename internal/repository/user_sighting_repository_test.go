@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupUserSightingRepository(t *testing.T) domain.UserSightingRepository {
+	return NewUserSightingRepository(newSQLiteDB(t, &domain.UserSighting{}))
+}
+
+func TestUserSightingRepository_RecordFirstSeen(t *testing.T) {
+	repo := setupUserSightingRepository(t)
+	ctx := context.Background()
+	first := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	require.NoError(t, repo.RecordFirstSeen(ctx, 123, first))
+
+	seenAt, err := repo.GetFirstSeen(ctx, 123)
+	require.NoError(t, err)
+	assert.True(t, first.Equal(seenAt))
+
+	// Later interactions must not move the first sighting
+	require.NoError(t, repo.RecordFirstSeen(ctx, 123, first.Add(48*time.Hour)))
+
+	seenAt, err = repo.GetFirstSeen(ctx, 123)
+	require.NoError(t, err)
+	assert.True(t, first.Equal(seenAt))
+}
+
+func TestUserSightingRepository_GetFirstSeen_NotFound(t *testing.T) {
+	repo := setupUserSightingRepository(t)
+
+	_, err := repo.GetFirstSeen(context.Background(), 999)
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+}
@@ -0,0 +1,170 @@
+package selftest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/events"
+	"gorm.io/gorm"
+)
+
+// DefaultCheckTimeout bounds each self-test check
+const DefaultCheckTimeout = 10 * time.Second
+
+// Check verifies a single dependency
+type Check func(ctx context.Context) error
+
+// Result is the outcome of a single check
+type Result struct {
+	Name     string
+	Critical bool
+	Duration time.Duration
+	Err      error
+}
+
+// namedCheck is a registered check
+type namedCheck struct {
+	name     string
+	critical bool
+	check    Check
+}
+
+// Runner runs the startup self-test
+type Runner struct {
+	logger  *logrus.Logger
+	timeout time.Duration
+	checks  []namedCheck
+}
+
+// NewRunner creates a new runner with the given per-check timeout
+func NewRunner(logger *logrus.Logger, timeout time.Duration) *Runner {
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+	return &Runner{logger: logger, timeout: timeout}
+}
+
+// AddCheck registers a check. A failing critical check fails the self-test, other
+// failures are only reported
+func (r *Runner) AddCheck(name string, critical bool, check Check) {
+	r.checks = append(r.checks, namedCheck{name: name, critical: critical, check: check})
+}
+
+// Run runs every check in order, logs a summary and returns an error naming the
+// critical checks that failed
+func (r *Runner) Run(ctx context.Context) ([]Result, error) {
+	results := make([]Result, 0, len(r.checks))
+	var failed []string
+	for _, nc := range r.checks {
+		checkCtx, cancel := context.WithTimeout(ctx, r.timeout)
+		start := time.Now()
+		err := nc.check(checkCtx)
+		cancel()
+
+		result := Result{Name: nc.name, Critical: nc.critical, Duration: time.Since(start), Err: err}
+		results = append(results, result)
+		r.logResult(result)
+		if err != nil && nc.critical {
+			failed = append(failed, nc.name)
+		}
+	}
+
+	if len(failed) > 0 {
+		r.logger.WithField("failed", failed).Error("🔴 Startup self-test failed")
+		return results, fmt.Errorf("startup self-test failed: %s", strings.Join(failed, ", "))
+	}
+	r.logger.WithField("checks", len(results)).Info("🟢 Startup self-test passed")
+	return results, nil
+}
+
+// logResult logs the outcome of a single check
+func (r *Runner) logResult(result Result) {
+	entry := r.logger.WithFields(logrus.Fields{
+		"check":       result.Name,
+		"critical":    result.Critical,
+		"duration_ms": result.Duration.Milliseconds(),
+	})
+	switch {
+	case result.Err == nil:
+		entry.Info("🟢 Self-test check passed")
+	case result.Critical:
+		entry.WithError(result.Err).Error("🔴 Self-test check failed")
+	default:
+		entry.WithError(result.Err).Warn("🔴 Self-test check failed")
+	}
+}
+
+// selfTestSettingKey is the key of the sentinel setting written by the database check
+const selfTestSettingKey = "selftest.sentinel"
+
+// DatabaseCheck writes, reads back and deletes a sentinel setting, so it needs the
+// schema to be migrated
+func DatabaseCheck(db *gorm.DB) Check {
+	return func(ctx context.Context) error {
+		db := db.WithContext(ctx)
+		value := fmt.Sprint(time.Now().UnixNano())
+		sentinel := &domain.Setting{Key: selfTestSettingKey, Value: value}
+		if err := db.Save(sentinel).Error; err != nil {
+			return fmt.Errorf("failed to write sentinel: %w", err)
+		}
+
+		var stored domain.Setting
+		readErr := db.Where("key = ?", selfTestSettingKey).First(&stored).Error
+		// Delete the sentinel even when reading it failed
+		deleteErr := db.Delete(&domain.Setting{}, "key = ?", selfTestSettingKey).Error
+
+		switch {
+		case readErr != nil:
+			return fmt.Errorf("failed to read sentinel: %w", readErr)
+		case stored.Value != value:
+			return fmt.Errorf("read sentinel %q, wrote %q", stored.Value, value)
+		case deleteErr != nil:
+			return fmt.Errorf("failed to delete sentinel: %w", deleteErr)
+		}
+		return nil
+	}
+}
+
+// topicPublisher is implemented by publishers that can write to a topic other than
+// the events topic
+type topicPublisher interface {
+	PublishTo(ctx context.Context, topic string, event *events.Event) error
+}
+
+// EventsCheck publishes a system.self_test event. Publishers that support it write
+// to topic so consumers of the event stream never see the event
+func EventsCheck(publisher events.Publisher, topic string) Check {
+	return func(ctx context.Context) error {
+		event := events.NewEvent(events.EventSystemSelfTest, nil, map[string]interface{}{"check": "startup"})
+		var err error
+		if tp, ok := publisher.(topicPublisher); ok {
+			err = tp.PublishTo(ctx, topic, event)
+		} else {
+			err = publisher.Publish(ctx, event)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to publish self-test event: %w", err)
+		}
+		return nil
+	}
+}
+
+// botIdentity is the part of the Telegram client the self-test needs
+type botIdentity interface {
+	GetMe() (tgbotapi.User, error)
+}
+
+// TelegramCheck calls getMe, which fails for an invalid bot token
+func TelegramCheck(botAPI botIdentity) Check {
+	return func(ctx context.Context) error {
+		if _, err := botAPI.GetMe(); err != nil {
+			return fmt.Errorf("failed to get bot info: %w", err)
+		}
+		return nil
+	}
+}
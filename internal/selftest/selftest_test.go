@@ -0,0 +1,115 @@
+package selftest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fakeBot answers getMe with a fixed bot or error
+type fakeBot struct {
+	err error
+}
+
+func (f *fakeBot) GetMe() (tgbotapi.User, error) {
+	return tgbotapi.User{ID: 1, UserName: "arcanus_test_bot", IsBot: true}, f.err
+}
+
+// topicRecorder records the topic events were published to
+type topicRecorder struct {
+	*events.MockPublisher
+	topics []string
+}
+
+func (p *topicRecorder) PublishTo(ctx context.Context, topic string, event *events.Event) error {
+	p.topics = append(p.topics, topic)
+	return p.Publish(ctx, event)
+}
+
+func newTestLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&domain.Setting{}))
+	return db
+}
+
+func TestRunner_Run(t *testing.T) {
+	logger := newTestLogger()
+	db := newTestDB(t)
+	publisher := &topicRecorder{MockPublisher: events.NewMockPublisher(logger)}
+
+	runner := NewRunner(logger, 0)
+	runner.AddCheck("database", true, DatabaseCheck(db))
+	runner.AddCheck("events", false, EventsCheck(publisher, "arcanus-selftest"))
+	runner.AddCheck("telegram", true, TelegramCheck(&fakeBot{}))
+
+	results, err := runner.Run(context.Background())
+
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	for _, result := range results {
+		assert.NoError(t, result.Err, result.Name)
+	}
+	assert.Equal(t, []string{"arcanus-selftest"}, publisher.topics)
+	published := publisher.GetPublishedEvents()
+	require.Len(t, published, 1)
+	assert.Equal(t, events.EventSystemSelfTest, published[0].Type)
+
+	// The sentinel is removed again
+	var count int64
+	require.NoError(t, db.Model(&domain.Setting{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func TestRunner_Run_CriticalFailure(t *testing.T) {
+	logger := newTestLogger()
+	publisher := events.NewMockPublisher(logger)
+	publisher.SetShouldError(true)
+
+	// The settings table is missing, as when migrations did not run
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	runner := NewRunner(logger, 0)
+	runner.AddCheck("database", true, DatabaseCheck(db))
+	runner.AddCheck("events", false, EventsCheck(publisher, "arcanus-selftest"))
+	runner.AddCheck("telegram", true, TelegramCheck(&fakeBot{err: fmt.Errorf("Unauthorized")}))
+
+	results, err := runner.Run(context.Background())
+
+	require.Error(t, err)
+	assert.Equal(t, "startup self-test failed: database, telegram", err.Error())
+	require.Len(t, results, 3)
+	assert.Error(t, results[1].Err, "non-critical failures are still reported")
+}
+
+func TestRunner_Run_NonCriticalFailure(t *testing.T) {
+	logger := newTestLogger()
+	publisher := events.NewMockPublisher(logger)
+	publisher.SetShouldError(true)
+
+	runner := NewRunner(logger, 0)
+	runner.AddCheck("events", false, EventsCheck(publisher, "arcanus-selftest"))
+
+	results, err := runner.Run(context.Background())
+
+	assert.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Error(t, results[0].Err)
+}
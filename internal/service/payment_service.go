@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/events"
+)
+
+// PaymentService implements domain.PaymentService
+type PaymentService struct {
+	txManager    domain.TransactionManager
+	plans        *domain.PlanCatalog
+	eventService *events.Service
+}
+
+// NewPaymentService creates a new PaymentService instance
+func NewPaymentService(txManager domain.TransactionManager, plans *domain.PlanCatalog) *PaymentService {
+	return &PaymentService{
+		txManager: txManager,
+		plans:     plans,
+	}
+}
+
+// SetEventService configures where user.status_changed events are published when a
+// payment activates a user
+func (s *PaymentService) SetEventService(eventService *events.Service) {
+	s.eventService = eventService
+}
+
+// ProcessPayment records the charge and applies the paid plan to the user in one
+// transaction. The charge is recorded first, so a redelivered or concurrent copy of the
+// payment fails on its unique charge ID and ErrPaymentAlreadyProcessed is returned
+// without applying the plan twice. Payments that do not match the plan's price and
+// currency return ErrPaymentMismatch
+func (s *PaymentService) ProcessPayment(ctx context.Context, payment *domain.Payment) (*domain.User, error) {
+	if payment == nil || payment.TelegramID <= 0 || payment.ProviderChargeID == "" {
+		return nil, domain.ErrInvalidInput
+	}
+
+	plan, ok := s.plans.Get(payment.PlanName)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", domain.ErrPlanNotFound, payment.PlanName)
+	}
+	if !strings.EqualFold(payment.Currency, plan.Currency) || payment.TotalAmount != plan.InvoiceAmount() {
+		return nil, fmt.Errorf("%w: paid %d %s for plan %s priced %d %s", domain.ErrPaymentMismatch,
+			payment.TotalAmount, payment.Currency, plan.Name, plan.InvoiceAmount(), plan.Currency)
+	}
+	payment.PlanName = plan.Name
+
+	var user *domain.User
+	var previousStatus string
+	err := s.txManager.WithTransaction(ctx, func(ctx context.Context, tx domain.Transaction) error {
+		// A retried transaction inserts afresh rather than reusing an ID from the rolled back one
+		record := *payment
+		if err := tx.Payments().Create(ctx, &record); err != nil {
+			return err
+		}
+
+		u, err := tx.Users().GetByTelegramID(ctx, payment.TelegramID)
+		if err != nil {
+			return fmt.Errorf("failed to get user for payment: %w", err)
+		}
+		previousStatus = u.Status
+		u.ApplyPlan(plan)
+		if err := tx.Users().Update(ctx, u); err != nil {
+			return fmt.Errorf("failed to update user for payment: %w", err)
+		}
+
+		payment.ID = record.ID
+		user = u
+		return nil
+	})
+	if errors.Is(err, domain.ErrPaymentAlreadyProcessed) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to process payment: %w", err)
+	}
+
+	if s.eventService != nil && previousStatus != user.Status {
+		if err := s.eventService.PublishUserStatusChanged(ctx, user.TelegramID, previousStatus, user.Status); err != nil {
+			// Log error but don't fail the operation
+			fmt.Printf("Failed to publish user status changed event: %v\n", err)
+		}
+	}
+
+	return user, nil
+}
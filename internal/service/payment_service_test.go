@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockPaymentRepository is a mock implementation of domain.PaymentRepository
+type MockPaymentRepository struct {
+	mock.Mock
+}
+
+func (m *MockPaymentRepository) Create(ctx context.Context, payment *domain.Payment) error {
+	args := m.Called(ctx, payment)
+	return args.Error(0)
+}
+
+func (m *MockPaymentRepository) Exists(ctx context.Context, providerChargeID string) (bool, error) {
+	args := m.Called(ctx, providerChargeID)
+	return args.Bool(0), args.Error(1)
+}
+
+func setupPaymentService(t *testing.T) (*MockPaymentRepository, *MockUserRepository, *PaymentService) {
+	catalog, err := domain.NewPlanCatalog([]domain.Plan{
+		{Name: "Basic", QuotaLimit: 10 * 1024 * 1024 * 1024, Price: 4.99, Currency: "USD", BillingPeriodDays: 30},
+	})
+	require.NoError(t, err)
+
+	paymentRepo := new(MockPaymentRepository)
+	userRepo := new(MockUserRepository)
+	return paymentRepo, userRepo, NewPaymentService(newFakeTransactionManager(userRepo, paymentRepo), catalog)
+}
+
+// basicPayment returns a payment of the Basic plan's price for user 123
+func basicPayment(chargeID string) *domain.Payment {
+	return &domain.Payment{TelegramID: 123, PlanName: "basic", TotalAmount: 499, Currency: "USD", ProviderChargeID: chargeID}
+}
+
+func TestPaymentService_ProcessPayment(t *testing.T) {
+	paymentRepo, userRepo, service := setupPaymentService(t)
+	ctx := context.Background()
+
+	user := domain.NewUser(123, "test", "Test", "User")
+	user.ActivateTrial()
+	userRepo.On("GetByTelegramID", ctx, int64(123)).Return(user, nil)
+	userRepo.On("Update", ctx, mock.AnythingOfType("*domain.User")).Return(nil)
+	paymentRepo.On("Create", ctx, mock.AnythingOfType("*domain.Payment")).Return(nil)
+
+	upgraded, err := service.ProcessPayment(ctx, basicPayment("charge_1"))
+
+	require.NoError(t, err)
+	assert.Equal(t, domain.UserStatusActive, upgraded.Status)
+	assert.Equal(t, int64(10*1024*1024*1024), upgraded.QuotaLimit)
+	require.NotNil(t, upgraded.PlanExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(30*24*time.Hour), *upgraded.PlanExpiresAt, time.Minute)
+	paymentRepo.AssertCalled(t, "Create", ctx, mock.MatchedBy(func(p *domain.Payment) bool {
+		return p.PlanName == "Basic" && p.ProviderChargeID == "charge_1"
+	}))
+	paymentRepo.AssertNotCalled(t, "Exists", mock.Anything, mock.Anything)
+}
+
+func TestPaymentService_ProcessPaymentPublishesStatusChange(t *testing.T) {
+	paymentRepo, userRepo, service := setupPaymentService(t)
+	ctx := context.Background()
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	publisher := events.NewMockPublisher(logger)
+	service.SetEventService(events.NewEventService(publisher, logger))
+
+	user := domain.NewUser(123, "test", "Test", "User")
+	user.ActivateTrial()
+	userRepo.On("GetByTelegramID", ctx, int64(123)).Return(user, nil)
+	userRepo.On("Update", ctx, mock.AnythingOfType("*domain.User")).Return(nil)
+	paymentRepo.On("Create", ctx, mock.AnythingOfType("*domain.Payment")).Return(nil)
+
+	_, err := service.ProcessPayment(ctx, basicPayment("charge_1"))
+	require.NoError(t, err)
+	// Renewing keeps the user active, which is no transition
+	_, err = service.ProcessPayment(ctx, basicPayment("charge_2"))
+	require.NoError(t, err)
+
+	published := publisher.GetPublishedEvents()
+	require.Len(t, published, 1)
+	assert.Equal(t, events.EventUserStatusChanged, published[0].Type)
+	assert.Equal(t, domain.UserStatusTrial, published[0].Data["previous_status"])
+	assert.Equal(t, domain.UserStatusActive, published[0].Data["new_status"])
+}
+
+func TestPaymentService_ProcessPaymentTwiceUpgradesOnce(t *testing.T) {
+	paymentRepo, userRepo, service := setupPaymentService(t)
+	ctx := context.Background()
+
+	user := domain.NewUser(123, "test", "Test", "User")
+	userRepo.On("GetByTelegramID", ctx, int64(123)).Return(user, nil)
+	userRepo.On("Update", ctx, mock.AnythingOfType("*domain.User")).Return(nil)
+	paymentRepo.On("Create", ctx, mock.AnythingOfType("*domain.Payment")).Return(nil).Once()
+	paymentRepo.On("Create", ctx, mock.AnythingOfType("*domain.Payment")).Return(domain.ErrPaymentAlreadyProcessed)
+
+	_, err := service.ProcessPayment(ctx, basicPayment("charge_1"))
+	require.NoError(t, err)
+	planExpiresAt := *user.PlanExpiresAt
+
+	// The redelivered payment fails on its charge ID before the plan is applied again
+	_, err = service.ProcessPayment(ctx, basicPayment("charge_1"))
+	assert.ErrorIs(t, err, domain.ErrPaymentAlreadyProcessed)
+
+	userRepo.AssertNumberOfCalls(t, "GetByTelegramID", 1)
+	userRepo.AssertNumberOfCalls(t, "Update", 1)
+	assert.Equal(t, planExpiresAt, *user.PlanExpiresAt)
+}
+
+func TestPaymentService_ProcessPaymentErrors(t *testing.T) {
+	paymentRepo, userRepo, service := setupPaymentService(t)
+	ctx := context.Background()
+
+	_, err := service.ProcessPayment(ctx, &domain.Payment{TelegramID: 123})
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+
+	gold := basicPayment("charge_1")
+	gold.PlanName = "Gold"
+	_, err = service.ProcessPayment(ctx, gold)
+	assert.ErrorIs(t, err, domain.ErrPlanNotFound)
+
+	underpaid := basicPayment("charge_1")
+	underpaid.TotalAmount = 1
+	_, err = service.ProcessPayment(ctx, underpaid)
+	assert.ErrorIs(t, err, domain.ErrPaymentMismatch)
+
+	otherCurrency := basicPayment("charge_1")
+	otherCurrency.Currency = "EUR"
+	_, err = service.ProcessPayment(ctx, otherCurrency)
+	assert.ErrorIs(t, err, domain.ErrPaymentMismatch)
+	paymentRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+
+	// A failure after the charge was recorded fails the transaction, rolling the charge back
+	paymentRepo.On("Create", ctx, mock.AnythingOfType("*domain.Payment")).Return(nil)
+	userRepo.On("GetByTelegramID", ctx, int64(456)).Return(nil, domain.ErrUserNotFound)
+	unknownUser := basicPayment("charge_1")
+	unknownUser.TelegramID = 456
+	_, err = service.ProcessPayment(ctx, unknownUser)
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	userRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/events"
+)
+
+// DefaultPlanExpiryInterval is how often lapsed paid plans are checked by default
+const DefaultPlanExpiryInterval = 10 * time.Minute
+
+// graceReminderInterval is how often users in the grace period are reminded to renew
+const graceReminderInterval = 24 * time.Hour
+
+// PlanExpiryNotifier tells users that their paid plan lapsed
+type PlanExpiryNotifier interface {
+	// NotifyPlanGracePeriod reminds a user whose paid period lapsed to renew before graceEndsAt
+	NotifyPlanGracePeriod(ctx context.Context, user *domain.User, planName string, graceEndsAt time.Time) error
+	NotifyPlanExpired(ctx context.Context, user *domain.User, planName string) error
+}
+
+// PlanExpirySweeper periodically downgrades users whose paid period lapsed back to an
+// inactive account with the trial quota. With a grace period, lapsed users keep their
+// plan and are reminded to renew until the grace period elapses
+type PlanExpirySweeper struct {
+	userRepo     domain.UserRepository
+	quotaLimit   func() int64
+	interval     time.Duration
+	gracePeriod  time.Duration
+	eventService *events.Service
+	notifier     PlanExpiryNotifier
+	now          func() time.Time
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewPlanExpirySweeper creates a sweeper. quotaLimit provides the quota given to
+// downgraded users; a non-positive interval uses DefaultPlanExpiryInterval
+func NewPlanExpirySweeper(userRepo domain.UserRepository, quotaLimit func() int64, interval time.Duration) *PlanExpirySweeper {
+	if interval <= 0 {
+		interval = DefaultPlanExpiryInterval
+	}
+	return &PlanExpirySweeper{
+		userRepo:   userRepo,
+		quotaLimit: quotaLimit,
+		interval:   interval,
+		now:        time.Now,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// SetGracePeriod configures how long lapsed users keep their plan before being
+// downgraded. Zero downgrades them as soon as the paid period ends
+func (s *PlanExpirySweeper) SetGracePeriod(gracePeriod time.Duration) {
+	s.gracePeriod = gracePeriod
+}
+
+// SetEventService configures where user.plan_expired and user.status_changed events
+// are published
+func (s *PlanExpirySweeper) SetEventService(eventService *events.Service) {
+	s.eventService = eventService
+}
+
+// SetNotifier configures how downgraded users are notified
+func (s *PlanExpirySweeper) SetNotifier(notifier PlanExpiryNotifier) {
+	s.notifier = notifier
+}
+
+// Sweep handles every user whose paid period has lapsed: users within the grace period
+// are reminded and the rest are downgraded. It returns how many users were downgraded.
+// Failures for one user do not stop the others and are returned together
+func (s *PlanExpirySweeper) Sweep(ctx context.Context) (int, error) {
+	now := s.now()
+	users, err := s.userRepo.ListPlanExpired(ctx, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list expired plans: %w", err)
+	}
+
+	var errs []error
+	downgraded := 0
+	for _, user := range users {
+		if s.gracePeriod > 0 {
+			inGrace, err := s.handleGracePeriod(ctx, user, now)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if inGrace {
+				continue
+			}
+		}
+
+		planName := user.PlanName
+		expiredAt := *user.PlanExpiresAt
+		previousStatus := user.Status
+
+		user.ExpirePlan(s.quotaLimit())
+		if err := s.userRepo.Update(ctx, user); err != nil {
+			errs = append(errs, fmt.Errorf("failed to downgrade user %d: %w", user.TelegramID, err))
+			continue
+		}
+		downgraded++
+
+		if s.eventService != nil {
+			if err := s.eventService.PublishUserPlanExpired(ctx, user.TelegramID, planName, user.QuotaLimit, expiredAt); err != nil {
+				// Log error but don't fail the operation
+				fmt.Printf("Failed to publish user plan expired event: %v\n", err)
+			}
+			if previousStatus != user.Status {
+				if err := s.eventService.PublishUserStatusChanged(ctx, user.TelegramID, previousStatus, user.Status); err != nil {
+					fmt.Printf("Failed to publish user status changed event: %v\n", err)
+				}
+			}
+		}
+
+		if s.notifier != nil {
+			if err := s.notifier.NotifyPlanExpired(ctx, user, planName); err != nil {
+				markUnreachableOn(ctx, s.userRepo, user, err)
+				errs = append(errs, fmt.Errorf("failed to notify user %d about plan expiry: %w", user.TelegramID, err))
+			}
+		}
+	}
+
+	return downgraded, errors.Join(errs...)
+}
+
+// handleGracePeriod starts or continues the grace period of a lapsed user and reports
+// whether the user is still within it
+func (s *PlanExpirySweeper) handleGracePeriod(ctx context.Context, user *domain.User, now time.Time) (bool, error) {
+	if user.GraceStartedAt == nil {
+		user.GraceStartedAt = &now
+		if err := s.userRepo.Update(ctx, user); err != nil {
+			return true, fmt.Errorf("failed to start grace period for user %d: %w", user.TelegramID, err)
+		}
+		return true, s.remindGracePeriod(ctx, user)
+	}
+
+	elapsed := now.Sub(*user.GraceStartedAt)
+	if elapsed >= s.gracePeriod {
+		return false, nil
+	}
+
+	// Sweeps run every interval, so a reminder is due when a reminder boundary passed since the last one
+	if elapsed >= graceReminderInterval && elapsed%graceReminderInterval < s.interval {
+		return true, s.remindGracePeriod(ctx, user)
+	}
+	return true, nil
+}
+
+// remindGracePeriod asks a user within the grace period to renew
+func (s *PlanExpirySweeper) remindGracePeriod(ctx context.Context, user *domain.User) error {
+	if s.notifier == nil {
+		return nil
+	}
+	graceEndsAt := user.GraceStartedAt.Add(s.gracePeriod)
+	if err := s.notifier.NotifyPlanGracePeriod(ctx, user, user.PlanName, graceEndsAt); err != nil {
+		markUnreachableOn(ctx, s.userRepo, user, err)
+		return fmt.Errorf("failed to remind user %d about the grace period: %w", user.TelegramID, err)
+	}
+	return nil
+}
+
+// Start sweeps in the background every interval until Stop is called. Sweep
+// failures are passed to onError
+func (s *PlanExpirySweeper) Start(onError func(error)) {
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := s.Sweep(context.Background()); err != nil && onError != nil {
+					onError(err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the background sweeps started by Start
+func (s *PlanExpirySweeper) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockPlanExpiryNotifier is a mock implementation of PlanExpiryNotifier
+type MockPlanExpiryNotifier struct {
+	mock.Mock
+}
+
+func (m *MockPlanExpiryNotifier) NotifyPlanGracePeriod(ctx context.Context, user *domain.User, planName string, graceEndsAt time.Time) error {
+	args := m.Called(ctx, user, planName, graceEndsAt)
+	return args.Error(0)
+}
+
+func (m *MockPlanExpiryNotifier) NotifyPlanExpired(ctx context.Context, user *domain.User, planName string) error {
+	args := m.Called(ctx, user, planName)
+	return args.Error(0)
+}
+
+// paidUser returns an active user on the Basic plan whose paid period ends at planExpiresAt
+func paidUser(telegramID int64, planExpiresAt time.Time) *domain.User {
+	user := domain.NewUser(telegramID, "test", "Test", "User")
+	user.ApplyPlan(domain.Plan{Name: "Basic", QuotaLimit: 10 * 1024 * 1024 * 1024, Price: 4.99, Currency: "USD", BillingPeriodDays: 30})
+	user.PlanExpiresAt = &planExpiresAt
+	return user
+}
+
+func TestPlanExpirySweeper_DowngradesExpiredPlan(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	expired := paidUser(123, now.Add(-time.Hour))
+
+	userRepo := new(MockUserRepository)
+	userRepo.On("ListPlanExpired", mock.Anything, now).Return([]*domain.User{expired}, nil)
+	userRepo.On("Update", mock.Anything, expired).Return(nil)
+	notifier := new(MockPlanExpiryNotifier)
+	notifier.On("NotifyPlanExpired", mock.Anything, expired, "Basic").Return(nil)
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	publisher := events.NewMockPublisher(logger)
+
+	sweeper := NewPlanExpirySweeper(userRepo, func() int64 { return domain.DefaultQuotaLimit }, time.Minute)
+	sweeper.now = func() time.Time { return now }
+	sweeper.SetNotifier(notifier)
+	sweeper.SetEventService(events.NewEventService(publisher, logger))
+
+	downgraded, err := sweeper.Sweep(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, downgraded)
+	assert.Equal(t, domain.UserStatusInactive, expired.Status)
+	assert.Equal(t, int64(domain.DefaultQuotaLimit), expired.QuotaLimit)
+	assert.Empty(t, expired.PlanName)
+	assert.Nil(t, expired.PlanExpiresAt)
+	notifier.AssertExpectations(t)
+
+	published := publisher.GetPublishedEvents()
+	require.Len(t, published, 2)
+	assert.Equal(t, events.EventUserPlanExpired, published[0].Type)
+	assert.Equal(t, "Basic", published[0].Data["plan_name"])
+	assert.Equal(t, events.EventUserStatusChanged, published[1].Type)
+	assert.Equal(t, domain.UserStatusActive, published[1].Data["previous_status"])
+	assert.Equal(t, domain.UserStatusInactive, published[1].Data["new_status"])
+}
+
+func TestPlanExpirySweeper_MarksUnreachableUser(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	expired := paidUser(123, now.Add(-time.Hour))
+
+	userRepo := new(MockUserRepository)
+	userRepo.On("ListPlanExpired", mock.Anything, now).Return([]*domain.User{expired}, nil)
+	userRepo.On("Update", mock.Anything, expired).Return(nil)
+	userRepo.On("UpdateUnreachableAt", mock.Anything, int64(123), mock.AnythingOfType("*time.Time")).Return(nil).Once()
+	notifier := new(MockPlanExpiryNotifier)
+	notifier.On("NotifyPlanExpired", mock.Anything, expired, "Basic").Return(domain.ErrUserUnreachable)
+
+	sweeper := NewPlanExpirySweeper(userRepo, func() int64 { return domain.DefaultQuotaLimit }, time.Minute)
+	sweeper.now = func() time.Time { return now }
+	sweeper.SetNotifier(notifier)
+
+	downgraded, err := sweeper.Sweep(context.Background())
+
+	assert.ErrorIs(t, err, domain.ErrUserUnreachable)
+	assert.Equal(t, 1, downgraded)
+	assert.True(t, expired.IsUnreachable())
+	userRepo.AssertExpectations(t)
+}
+
+func TestPlanExpirySweeper_LeavesCurrentPlanUntouched(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	current := paidUser(456, now.Add(24*time.Hour))
+
+	// The repository only returns lapsed plans, so a current one is never listed
+	userRepo := new(MockUserRepository)
+	userRepo.On("ListPlanExpired", mock.Anything, now).Return([]*domain.User{}, nil)
+
+	sweeper := NewPlanExpirySweeper(userRepo, func() int64 { return domain.DefaultQuotaLimit }, time.Minute)
+	sweeper.now = func() time.Time { return now }
+
+	downgraded, err := sweeper.Sweep(context.Background())
+
+	require.NoError(t, err)
+	assert.Zero(t, downgraded)
+	assert.Equal(t, domain.UserStatusActive, current.Status)
+	assert.Equal(t, "Basic", current.PlanName)
+	userRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+}
+
+func TestPlanExpirySweeper_ContinuesAfterFailure(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	failing := paidUser(123, now.Add(-time.Hour))
+	expired := paidUser(456, now.Add(-time.Minute))
+
+	userRepo := new(MockUserRepository)
+	userRepo.On("ListPlanExpired", mock.Anything, now).Return([]*domain.User{failing, expired}, nil)
+	userRepo.On("Update", mock.Anything, failing).Return(errors.New("database is down"))
+	userRepo.On("Update", mock.Anything, expired).Return(nil)
+
+	sweeper := NewPlanExpirySweeper(userRepo, func() int64 { return domain.DefaultQuotaLimit }, time.Minute)
+	sweeper.now = func() time.Time { return now }
+
+	downgraded, err := sweeper.Sweep(context.Background())
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to downgrade user 123")
+	assert.Equal(t, 1, downgraded)
+	assert.Equal(t, domain.UserStatusInactive, expired.Status)
+}
+
+func TestPlanExpirySweeper_StartsGracePeriod(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	lapsed := paidUser(123, now.Add(-time.Hour))
+
+	userRepo := new(MockUserRepository)
+	userRepo.On("ListPlanExpired", mock.Anything, now).Return([]*domain.User{lapsed}, nil)
+	userRepo.On("Update", mock.Anything, lapsed).Return(nil)
+	notifier := new(MockPlanExpiryNotifier)
+	notifier.On("NotifyPlanGracePeriod", mock.Anything, lapsed, "Basic", now.Add(72*time.Hour)).Return(nil)
+
+	sweeper := NewPlanExpirySweeper(userRepo, func() int64 { return domain.DefaultQuotaLimit }, 10*time.Minute)
+	sweeper.now = func() time.Time { return now }
+	sweeper.SetGracePeriod(72 * time.Hour)
+	sweeper.SetNotifier(notifier)
+
+	downgraded, err := sweeper.Sweep(context.Background())
+
+	require.NoError(t, err)
+	assert.Zero(t, downgraded)
+	require.NotNil(t, lapsed.GraceStartedAt)
+	assert.Equal(t, now, *lapsed.GraceStartedAt)
+	assert.Equal(t, domain.UserStatusActive, lapsed.Status)
+	assert.Equal(t, "Basic", lapsed.PlanName)
+	notifier.AssertExpectations(t)
+	notifier.AssertNotCalled(t, "NotifyPlanExpired", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestPlanExpirySweeper_RemindsDuringGracePeriod(t *testing.T) {
+	graceStartedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		elapsed  time.Duration
+		reminded bool
+	}{
+		{"shortly after the grace period started", time.Hour, false},
+		{"first sweep after a day", 24*time.Hour + 5*time.Minute, true},
+		{"later sweep on the same day", 24*time.Hour + 20*time.Minute, false},
+		{"first sweep after two days", 48 * time.Hour, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := graceStartedAt.Add(tt.elapsed)
+			lapsed := paidUser(123, graceStartedAt.Add(-time.Minute))
+			lapsed.GraceStartedAt = &graceStartedAt
+
+			userRepo := new(MockUserRepository)
+			userRepo.On("ListPlanExpired", mock.Anything, now).Return([]*domain.User{lapsed}, nil)
+			notifier := new(MockPlanExpiryNotifier)
+			notifier.On("NotifyPlanGracePeriod", mock.Anything, lapsed, "Basic", graceStartedAt.Add(72*time.Hour)).Return(nil)
+
+			sweeper := NewPlanExpirySweeper(userRepo, func() int64 { return domain.DefaultQuotaLimit }, 10*time.Minute)
+			sweeper.now = func() time.Time { return now }
+			sweeper.SetGracePeriod(72 * time.Hour)
+			sweeper.SetNotifier(notifier)
+
+			downgraded, err := sweeper.Sweep(context.Background())
+
+			require.NoError(t, err)
+			assert.Zero(t, downgraded)
+			assert.Equal(t, domain.UserStatusActive, lapsed.Status)
+			userRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+			if tt.reminded {
+				notifier.AssertNumberOfCalls(t, "NotifyPlanGracePeriod", 1)
+			} else {
+				notifier.AssertNotCalled(t, "NotifyPlanGracePeriod", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestPlanExpirySweeper_DowngradesAfterGracePeriod(t *testing.T) {
+	graceStartedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	now := graceStartedAt.Add(72 * time.Hour)
+	lapsed := paidUser(123, graceStartedAt.Add(-time.Minute))
+	lapsed.GraceStartedAt = &graceStartedAt
+
+	userRepo := new(MockUserRepository)
+	userRepo.On("ListPlanExpired", mock.Anything, now).Return([]*domain.User{lapsed}, nil)
+	userRepo.On("Update", mock.Anything, lapsed).Return(nil)
+	notifier := new(MockPlanExpiryNotifier)
+	notifier.On("NotifyPlanExpired", mock.Anything, lapsed, "Basic").Return(nil)
+
+	sweeper := NewPlanExpirySweeper(userRepo, func() int64 { return domain.DefaultQuotaLimit }, 10*time.Minute)
+	sweeper.now = func() time.Time { return now }
+	sweeper.SetGracePeriod(72 * time.Hour)
+	sweeper.SetNotifier(notifier)
+
+	downgraded, err := sweeper.Sweep(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, downgraded)
+	assert.Equal(t, domain.UserStatusInactive, lapsed.Status)
+	assert.Nil(t, lapsed.GraceStartedAt)
+	notifier.AssertExpectations(t)
+	notifier.AssertNotCalled(t, "NotifyPlanGracePeriod", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
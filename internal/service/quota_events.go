@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/events"
+)
+
+// NewQuotaUpdatedHandler returns the handler applying user.quota_updated events
+// published by external systems, such as traffic accounting, to the user's quota usage.
+// Invalid events and updates for unknown or inactive users are reported as
+// unprocessable, since retrying them cannot succeed. A report over the limit is applied
+// like any other, so it is not retried either
+func NewQuotaUpdatedHandler(userService domain.UserService) events.EventHandler {
+	return func(ctx context.Context, event *events.Event) error {
+		update, err := events.ParseUserQuotaUpdated(event)
+		if err != nil {
+			return fmt.Errorf("%w: invalid quota update: %v", events.ErrUnprocessableEvent, err)
+		}
+		err = userService.UpdateQuota(ctx, update.TelegramID, update.NewQuota)
+		switch {
+		case errors.Is(err, domain.ErrQuotaExceeded):
+			// The usage was stored and the config revoked before the error was returned
+			return nil
+		case errors.Is(err, domain.ErrInvalidInput), errors.Is(err, domain.ErrUserNotFound), errors.Is(err, domain.ErrUserNotActive):
+			return fmt.Errorf("%w: failed to apply quota update: %v", events.ErrUnprocessableEvent, err)
+		case err != nil:
+			return fmt.Errorf("failed to apply quota update: %w", err)
+		}
+		return nil
+	}
+}
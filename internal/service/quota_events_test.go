@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaUpdatedHandler(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	handler := NewQuotaUpdatedHandler(NewUserService(mockRepo))
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.Status = domain.UserStatusTrial
+	user.QuotaLimit = 1000
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("UpdateQuota", mock.Anything, int64(123), int64(500)).Return(nil)
+
+	// Traffic accounting publishes camelCase JSON
+	event, err := events.FromJSON([]byte(`{"id":"ext-1","type":"user.quota_updated","data":{"telegramId":123,"newQuota":500}}`))
+	require.NoError(t, err)
+
+	require.NoError(t, handler(context.Background(), event))
+	mockRepo.AssertExpectations(t)
+}
+
+func TestQuotaUpdatedHandler_OverLimit(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	handler := NewQuotaUpdatedHandler(NewUserService(mockRepo))
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.Status = domain.UserStatusTrial
+	user.QuotaLimit = 1000
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("UpdateQuota", mock.Anything, int64(123), int64(1500)).Return(nil).Once()
+	mockRepo.On("UpdateQuotaAlertedPct", mock.Anything, int64(123), mock.Anything).Return(nil).Maybe()
+
+	// The usage is stored once, so the report must not be retried
+	require.NoError(t, handler(context.Background(), events.NewUserQuotaUpdatedEvent(123, 0, 1500)))
+	mockRepo.AssertExpectations(t)
+}
+
+func TestQuotaUpdatedHandler_InvalidEvent(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	handler := NewQuotaUpdatedHandler(NewUserService(mockRepo))
+
+	event := events.NewEvent(events.EventUserQuotaUpdated, nil, map[string]interface{}{"telegram_id": 123})
+
+	err := handler(context.Background(), event)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "new_quota")
+	assert.ErrorIs(t, err, events.ErrUnprocessableEvent, "invalid events are not retried")
+	mockRepo.AssertNotCalled(t, "UpdateQuota", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestQuotaUpdatedHandler_Failures(t *testing.T) {
+	event := events.NewUserQuotaUpdatedEvent(123, 0, 500)
+
+	t.Run("Unknown users are unprocessable", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(nil, domain.UserNotFoundError{TelegramID: 123})
+
+		err := NewQuotaUpdatedHandler(NewUserService(mockRepo))(context.Background(), event)
+		assert.ErrorIs(t, err, events.ErrUnprocessableEvent)
+	})
+
+	t.Run("Database failures are retried", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(nil, domain.ErrDatabaseUnavailable)
+
+		err := NewQuotaUpdatedHandler(NewUserService(mockRepo))(context.Background(), event)
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, events.ErrUnprocessableEvent)
+	})
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/events"
+)
+
+// DefaultRetentionInterval is how often the retention policy is enforced by default
+const DefaultRetentionInterval = 24 * time.Hour
+
+// RetentionEnforcer periodically anonymizes the personal data of users who have been
+// inactive for longer than the retention period. Their rows are kept so aggregate
+// counts stay correct
+type RetentionEnforcer struct {
+	userRepo     domain.UserRepository
+	retention    time.Duration
+	interval     time.Duration
+	eventService *events.Service
+	now          func() time.Time
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewRetentionEnforcer creates an enforcer anonymizing users inactive for longer than
+// retention. A non-positive interval uses DefaultRetentionInterval
+func NewRetentionEnforcer(userRepo domain.UserRepository, retention, interval time.Duration) *RetentionEnforcer {
+	if interval <= 0 {
+		interval = DefaultRetentionInterval
+	}
+	return &RetentionEnforcer{
+		userRepo:  userRepo,
+		retention: retention,
+		interval:  interval,
+		now:       time.Now,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// SetEventService configures where user.anonymized events are published
+func (e *RetentionEnforcer) SetEventService(eventService *events.Service) {
+	e.eventService = eventService
+}
+
+// Enabled reports whether a retention period is configured
+func (e *RetentionEnforcer) Enabled() bool {
+	return e.retention > 0
+}
+
+// Preview returns how many users Enforce would anonymize now, without changing them
+func (e *RetentionEnforcer) Preview(ctx context.Context) (int, error) {
+	if !e.Enabled() {
+		return 0, nil
+	}
+
+	count, err := e.userRepo.CountAnonymizable(ctx, e.now().Add(-e.retention))
+	if err != nil {
+		return 0, fmt.Errorf("failed to preview data retention: %w", err)
+	}
+	return int(count), nil
+}
+
+// Enforce anonymizes every user inactive since before the retention cutoff and
+// returns how many were anonymized. It does nothing when retention is disabled
+func (e *RetentionEnforcer) Enforce(ctx context.Context) (int, error) {
+	if !e.Enabled() {
+		return 0, nil
+	}
+
+	cutoff := e.now().Add(-e.retention)
+	telegramIDs, err := e.userRepo.AnonymizeInactive(ctx, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to enforce data retention: %w", err)
+	}
+
+	if e.eventService != nil {
+		for _, telegramID := range telegramIDs {
+			if err := e.eventService.PublishUserAnonymized(ctx, telegramID, cutoff); err != nil {
+				// Log error but don't fail the operation
+				fmt.Printf("Failed to publish user anonymized event: %v\n", err)
+			}
+		}
+	}
+
+	return len(telegramIDs), nil
+}
+
+// Start enforces the retention policy in the background every interval until Stop is
+// called. Failures are passed to onError
+func (e *RetentionEnforcer) Start(onError func(error)) {
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := e.Enforce(context.Background()); err != nil && onError != nil {
+					onError(err)
+				}
+			case <-e.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the background enforcement started by Start
+func (e *RetentionEnforcer) Stop() {
+	e.stopOnce.Do(func() {
+		close(e.stop)
+	})
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionEnforcer_AnonymizesInactiveUsers(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	cutoff := now.Add(-90 * 24 * time.Hour)
+
+	userRepo := new(MockUserRepository)
+	userRepo.On("AnonymizeInactive", mock.Anything, cutoff).Return([]int64{123, 456}, nil)
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	publisher := events.NewMockPublisher(logger)
+
+	enforcer := NewRetentionEnforcer(userRepo, 90*24*time.Hour, time.Hour)
+	enforcer.now = func() time.Time { return now }
+	enforcer.SetEventService(events.NewEventService(publisher, logger))
+
+	anonymized, err := enforcer.Enforce(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, anonymized)
+	userRepo.AssertExpectations(t)
+
+	published := publisher.GetPublishedEvents()
+	require.Len(t, published, 2)
+	for i, telegramID := range []int64{123, 456} {
+		assert.Equal(t, events.EventUserAnonymized, published[i].Type)
+		assert.Equal(t, telegramID, *published[i].UserID)
+	}
+}
+
+func TestRetentionEnforcer_Preview(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	cutoff := now.Add(-90 * 24 * time.Hour)
+
+	userRepo := new(MockUserRepository)
+	userRepo.On("CountAnonymizable", mock.Anything, cutoff).Return(int64(3), nil)
+
+	enforcer := NewRetentionEnforcer(userRepo, 90*24*time.Hour, time.Hour)
+	enforcer.now = func() time.Time { return now }
+
+	count, err := enforcer.Preview(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	userRepo.AssertNotCalled(t, "AnonymizeInactive", mock.Anything, mock.Anything)
+}
+
+func TestRetentionEnforcer_Disabled(t *testing.T) {
+	userRepo := new(MockUserRepository)
+	enforcer := NewRetentionEnforcer(userRepo, 0, 0)
+
+	anonymized, err := enforcer.Enforce(context.Background())
+
+	require.NoError(t, err)
+	assert.Zero(t, anonymized)
+	assert.False(t, enforcer.Enabled())
+	assert.Equal(t, DefaultRetentionInterval, enforcer.interval)
+	userRepo.AssertNotCalled(t, "AnonymizeInactive", mock.Anything, mock.Anything)
+
+	count, err := enforcer.Preview(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestRetentionEnforcer_RepositoryError(t *testing.T) {
+	userRepo := new(MockUserRepository)
+	userRepo.On("AnonymizeInactive", mock.Anything, mock.Anything).Return(nil, errors.New("connection lost"))
+
+	enforcer := NewRetentionEnforcer(userRepo, 24*time.Hour, time.Hour)
+
+	anonymized, err := enforcer.Enforce(context.Background())
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to enforce data retention")
+	assert.Zero(t, anonymized)
+}
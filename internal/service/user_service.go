@@ -7,6 +7,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
 	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/events"
@@ -17,34 +19,137 @@ type UserService struct {
 	userRepo     domain.UserRepository
 	txManager    domain.TransactionManager
 	eventService *events.Service
+	trialQuotas  map[string]int64
+	trialQuota   int64
+	// trialQuotaSource, when set, provides the default trial quota at registration time
+	trialQuotaSource func() int64
+	// trialDuration is how long activated trials last; zero means they never expire
+	trialDuration time.Duration
+	// referralBonus is the quota in bytes credited to both users of a referral
+	referralBonus int64
+	// quotaPolicy decides whether quota usage is allowed
+	quotaPolicy domain.QuotaPolicy
+	// quotaAlertNotifier, when set, warns users whose usage crosses an alert threshold
+	quotaAlertNotifier QuotaAlertNotifier
+	// configRevoker, when set, revokes the VPN config of users who lose access
+	configRevoker ConfigRevoker
+}
+
+// QuotaAlertNotifier warns users that their data usage crossed an alert threshold
+type QuotaAlertNotifier interface {
+	NotifyQuotaAlert(ctx context.Context, user *domain.User, thresholdPct int) error
+}
+
+// ConfigRevoker revokes the VPN config issued to a user
+type ConfigRevoker interface {
+	RevokeConfig(ctx context.Context, telegramID int64) error
 }
 
 // NewUserService creates a new UserService instance
 func NewUserService(userRepo domain.UserRepository) domain.UserService {
 	return &UserService{
-		userRepo: userRepo,
+		userRepo:      userRepo,
+		trialDuration: domain.DefaultTrialDuration,
+		referralBonus: domain.DefaultReferralBonus,
+		quotaPolicy:   domain.DefaultQuotaPolicy{},
 	}
 }
 
 // NewUserServiceWithEvents creates a new UserService instance with event publishing
-func NewUserServiceWithEvents(userRepo domain.UserRepository, txManager domain.TransactionManager, eventService *events.Service) domain.UserService {
+func NewUserServiceWithEvents(userRepo domain.UserRepository, txManager domain.TransactionManager, eventService *events.Service) *UserService {
 	return &UserService{
-		userRepo:     userRepo,
-		txManager:    txManager,
-		eventService: eventService,
+		userRepo:      userRepo,
+		txManager:     txManager,
+		eventService:  eventService,
+		trialDuration: domain.DefaultTrialDuration,
+		referralBonus: domain.DefaultReferralBonus,
+		quotaPolicy:   domain.DefaultQuotaPolicy{},
 	}
 }
 
 // NewUserServiceWithTx creates a new UserService instance with transaction support
 func NewUserServiceWithTx(userRepo domain.UserRepository, txManager domain.TransactionManager) domain.UserService {
 	return &UserService{
-		userRepo:  userRepo,
-		txManager: txManager,
+		userRepo:      userRepo,
+		txManager:     txManager,
+		trialDuration: domain.DefaultTrialDuration,
+		referralBonus: domain.DefaultReferralBonus,
+		quotaPolicy:   domain.DefaultQuotaPolicy{},
 	}
 }
 
+// SetTrialQuotaLimit configures the default trial quota in bytes for new users
+func (s *UserService) SetTrialQuotaLimit(limit int64) {
+	s.trialQuota = limit
+}
+
+// SetTrialDuration configures how long activated trials last. Zero disables trial expiry
+func (s *UserService) SetTrialDuration(duration time.Duration) {
+	s.trialDuration = duration
+}
+
+// SetReferralBonus configures the quota in bytes credited to both users of a referral
+func (s *UserService) SetReferralBonus(bonus int64) {
+	s.referralBonus = bonus
+}
+
+// SetQuotaPolicy configures the rules deciding whether quota usage is allowed
+func (s *UserService) SetQuotaPolicy(policy domain.QuotaPolicy) {
+	s.quotaPolicy = policy
+}
+
+// SetQuotaAlertNotifier configures how users are warned about their data usage
+func (s *UserService) SetQuotaAlertNotifier(notifier QuotaAlertNotifier) {
+	s.quotaAlertNotifier = notifier
+}
+
+// SetConfigRevoker configures revocation of VPN configs when users exceed their quota or are banned
+func (s *UserService) SetConfigRevoker(revoker ConfigRevoker) {
+	s.configRevoker = revoker
+}
+
+// SetTrialQuotaSource configures a function consulted for the default trial quota
+// on every registration, allowing the quota to change at runtime
+func (s *UserService) SetTrialQuotaSource(source func() int64) {
+	s.trialQuotaSource = source
+}
+
+// SetTrialQuotas configures trial quota overrides keyed by region (language code)
+func (s *UserService) SetTrialQuotas(quotas map[string]int64) {
+	s.trialQuotas = make(map[string]int64, len(quotas))
+	for region, quota := range quotas {
+		s.trialQuotas[strings.ToLower(region)] = quota
+	}
+}
+
+// trialQuotaFor returns the trial quota for a region, falling back from a
+// regional tag like "pt-br" to its base language and then to the global default
+func (s *UserService) trialQuotaFor(languageCode string) int64 {
+	defaultQuota := s.trialQuota
+	if s.trialQuotaSource != nil {
+		defaultQuota = s.trialQuotaSource()
+	}
+	if defaultQuota <= 0 {
+		defaultQuota = domain.DefaultQuotaLimit
+	}
+
+	region := strings.ToLower(strings.TrimSpace(languageCode))
+	if region == "" {
+		return defaultQuota
+	}
+	if quota, ok := s.trialQuotas[region]; ok {
+		return quota
+	}
+	if base, _, found := strings.Cut(region, "-"); found {
+		if quota, ok := s.trialQuotas[base]; ok {
+			return quota
+		}
+	}
+	return defaultQuota
+}
+
 // RegisterUser registers a new user or returns existing user
-func (s *UserService) RegisterUser(ctx context.Context, telegramID int64, username, firstName, lastName string) (*domain.User, error) {
+func (s *UserService) RegisterUser(ctx context.Context, telegramID int64, username, firstName, lastName, languageCode string) (*domain.User, error) {
 	// Validate input
 	if telegramID <= 0 {
 		return nil, domain.ErrInvalidInput
@@ -56,7 +161,30 @@ func (s *UserService) RegisterUser(ctx context.Context, telegramID int64, userna
 	// Check if user already exists
 	existingUser, err := s.userRepo.GetByTelegramID(ctx, telegramID)
 	if err == nil {
-		// User exists, return it
+		// Starting the bot opens the private chat again
+		if existingUser.IsUnreachable() {
+			if err := s.userRepo.UpdateUnreachableAt(ctx, telegramID, nil); err != nil {
+				fmt.Printf("Failed to mark user %d reachable: %v\n", telegramID, err)
+			} else {
+				existingUser.UnreachableAt = nil
+			}
+		}
+		if existingUser.Blocked {
+			if err := s.userRepo.UpdateBlocked(ctx, telegramID, false); err != nil {
+				fmt.Printf("Failed to mark user %d unblocked: %v\n", telegramID, err)
+			} else {
+				existingUser.Blocked = false
+			}
+		}
+		// A user anonymized while inactive gets their profile back on returning
+		if existingUser.IsAnonymized() {
+			existingUser.Username = username
+			existingUser.FirstName = firstName
+			existingUser.LastName = lastName
+			if err := s.userRepo.Update(ctx, existingUser); err != nil {
+				fmt.Printf("Failed to restore profile of user %d: %v\n", telegramID, err)
+			}
+		}
 		return existingUser, nil
 	}
 
@@ -65,26 +193,171 @@ func (s *UserService) RegisterUser(ctx context.Context, telegramID int64, userna
 		return nil, fmt.Errorf("failed to check existing user: %w", err)
 	}
 
-	// Create new user
-	user := domain.NewUser(telegramID, username, firstName, lastName)
+	// A previously deleted user is restored rather than re-created, so the
+	// trial cannot be claimed again by deleting and re-registering
+	deletedUser, err := s.userRepo.GetByTelegramIDIncludingDeleted(ctx, telegramID)
+	if err == nil {
+		return s.restoreUser(ctx, deletedUser, username, firstName, lastName)
+	}
+	if !errors.Is(err, domain.ErrUserNotFound) {
+		return nil, fmt.Errorf("failed to check deleted user: %w", err)
+	}
 
-	// Validate the created user
-	if err := user.Validate(); err != nil {
-		return nil, fmt.Errorf("invalid user data: %w", err)
+	// Create new user
+	user, err := s.newUser(telegramID, username, firstName, lastName, languageCode)
+	if err != nil {
+		return nil, err
 	}
 
 	err = s.userRepo.Create(ctx, user)
+	if errors.Is(err, domain.ErrUserAlreadyExists) {
+		// A concurrent registration created the user first
+		existingUser, err := s.userRepo.GetByTelegramID(ctx, telegramID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get concurrently registered user: %w", err)
+		}
+		return existingUser, nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
-	// Publish user registration event
+	s.publishUserRegistered(ctx, user)
+	return user, nil
+}
+
+// newUser builds a new user on the trial quota for their language, with a referral code of their own
+func (s *UserService) newUser(telegramID int64, username, firstName, lastName, languageCode string) (*domain.User, error) {
+	user := domain.NewUserWithQuota(telegramID, username, firstName, lastName, s.trialQuotaFor(languageCode))
+	user.LanguageCode = languageCode
+	code, err := domain.GenerateReferralCode()
+	if err != nil {
+		return nil, err
+	}
+	user.ReferralCode = code
+
+	// Validate the created user
+	if err := user.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid user data: %w", err)
+	}
+	return user, nil
+}
+
+// publishUserRegistered publishes the registration of a new user
+func (s *UserService) publishUserRegistered(ctx context.Context, user *domain.User) {
 	if s.eventService != nil {
 		if err := s.eventService.PublishUserRegistered(ctx, user.TelegramID, user.Username, user.FirstName, user.LastName, user.QuotaLimit); err != nil {
 			// Log error but don't fail the operation
 			fmt.Printf("Failed to publish user registered event: %v\n", err)
 		}
 	}
+}
+
+// RegisterWithReferral registers a user through a referral code, crediting the referral
+// bonus to both the new user and the referrer. Empty or unknown codes and users who
+// registered before fall back to a plain registration without a bonus
+func (s *UserService) RegisterWithReferral(ctx context.Context, telegramID int64, username, firstName, lastName, languageCode, referralCode string) (*domain.User, error) {
+	referralCode = domain.NormalizeReferralCode(referralCode)
+	if referralCode == "" {
+		return s.RegisterUser(ctx, telegramID, username, firstName, lastName, languageCode)
+	}
+
+	referrer, err := s.userRepo.GetByReferralCode(ctx, referralCode)
+	if err != nil {
+		if !errors.Is(err, domain.ErrUserNotFound) {
+			return nil, fmt.Errorf("failed to look up referral code: %w", err)
+		}
+		return s.RegisterUser(ctx, telegramID, username, firstName, lastName, languageCode)
+	}
+
+	// Only brand new users earn a referral, including ones who deleted their account
+	_, err = s.userRepo.GetByTelegramIDIncludingDeleted(ctx, telegramID)
+	if err == nil {
+		return s.RegisterUser(ctx, telegramID, username, firstName, lastName, languageCode)
+	}
+	if !errors.Is(err, domain.ErrUserNotFound) {
+		return nil, fmt.Errorf("failed to check existing user: %w", err)
+	}
+
+	// The referred user and the referrer's bonus are stored together, and the bonus is
+	// added in place so concurrent referrals by the same referrer all count
+	referrerID := referrer.TelegramID
+	var user *domain.User
+	err = s.withTransaction(ctx, func(ctx context.Context, users domain.UserRepository) error {
+		// Built afresh on every attempt, as a failed attempt may have assigned an ID
+		referred, err := s.newUser(telegramID, username, firstName, lastName, languageCode)
+		if err != nil {
+			return err
+		}
+		referred.ReferredBy = &referrerID
+		referred.AddQuota(s.referralBonus)
+		if err := users.Create(ctx, referred); err != nil {
+			return err
+		}
+		user = referred
+		if err := users.AddQuotaLimit(ctx, referrerID, s.referralBonus); err != nil {
+			return fmt.Errorf("failed to credit referrer: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, domain.ErrUserAlreadyExists) {
+		// A concurrent registration created the user first, without the bonus
+		return s.RegisterUser(ctx, telegramID, username, firstName, lastName, languageCode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to register referred user: %w", err)
+	}
+
+	s.publishUserRegistered(ctx, user)
+	if s.eventService != nil {
+		if err := s.eventService.PublishUserReferred(ctx, user.TelegramID, referrerID, s.referralBonus); err != nil {
+			// Log error but don't fail the operation
+			fmt.Printf("Failed to publish user referred event: %v\n", err)
+		}
+	}
+
+	return user, nil
+}
+
+// withTransaction runs fn with a user repository working inside a transaction, or
+// with the service's repository when it has no transaction manager. fn may run again
+// after a deadlock, so events are published once withTransaction returned
+func (s *UserService) withTransaction(ctx context.Context, fn func(ctx context.Context, users domain.UserRepository) error) error {
+	if s.txManager == nil {
+		return fn(ctx, s.userRepo)
+	}
+	return s.txManager.WithTransaction(ctx, func(ctx context.Context, tx domain.Transaction) error {
+		return fn(ctx, tx.Users())
+	})
+}
+
+// restoreUser restores a soft-deleted user and refreshes their profile. Both are
+// stored together, so a user is never left restored with a stale profile
+func (s *UserService) restoreUser(ctx context.Context, user *domain.User, username, firstName, lastName string) (*domain.User, error) {
+	user.MarkRestored()
+	if user.ReferralCode == "" {
+		code, err := domain.GenerateReferralCode()
+		if err != nil {
+			return nil, err
+		}
+		user.ReferralCode = code
+	}
+	user.Username = username
+	user.FirstName = firstName
+	user.LastName = lastName
+
+	err := s.withTransaction(ctx, func(ctx context.Context, users domain.UserRepository) error {
+		if err := users.Restore(ctx, user.TelegramID); err != nil {
+			return fmt.Errorf("failed to restore user: %w", err)
+		}
+		if err := users.Update(ctx, user); err != nil {
+			return fmt.Errorf("failed to update restored user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	return user, nil
 }
@@ -103,6 +376,29 @@ func (s *UserService) GetUser(ctx context.Context, telegramID int64) (*domain.Us
 	return user, nil
 }
 
+// GetUserSnapshot returns a read model of the user for display
+func (s *UserService) GetUserSnapshot(ctx context.Context, telegramID int64) (*domain.UserSnapshot, error) {
+	user, err := s.GetUser(ctx, telegramID)
+	if err != nil {
+		return nil, err
+	}
+	return domain.NewUserSnapshot(user), nil
+}
+
+// FindByUsername finds a user by username for admin lookups. A leading @ is ignored
+func (s *UserService) FindByUsername(ctx context.Context, username string) (*domain.User, error) {
+	username = strings.TrimPrefix(strings.TrimSpace(username), "@")
+	if username == "" {
+		return nil, domain.ErrInvalidInput
+	}
+
+	user, err := s.userRepo.GetByUsername(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user by username: %w", err)
+	}
+	return user, nil
+}
+
 // ActivateTrial activates the trial for a user
 func (s *UserService) ActivateTrial(ctx context.Context, telegramID int64) error {
 	// Validate input
@@ -115,6 +411,10 @@ func (s *UserService) ActivateTrial(ctx context.Context, telegramID int64) error
 		return fmt.Errorf("failed to get user for trial activation: %w", err)
 	}
 
+	if user.IsBanned() {
+		return domain.ErrUserBanned
+	}
+
 	// Check if user can activate trial
 	if !user.CanActivateTrial() {
 		return domain.ErrUserAlreadyActive
@@ -124,7 +424,7 @@ func (s *UserService) ActivateTrial(ctx context.Context, telegramID int64) error
 	previousStatus := user.Status
 	
 	// Activate trial
-	user.ActivateTrial()
+	user.ActivateTrialFor(s.trialDuration)
 
 	err = s.userRepo.Update(ctx, user)
 	if err != nil {
@@ -138,11 +438,57 @@ func (s *UserService) ActivateTrial(ctx context.Context, telegramID int64) error
 			fmt.Printf("Failed to publish user trial activated event: %v\n", err)
 		}
 	}
+	s.publishStatusChanged(ctx, user.TelegramID, previousStatus, user.Status)
 
 	return nil
 }
 
-// UpdateQuota updates the quota usage for a user
+// UpgradeUser moves a user to an active account with a larger quota limit. The
+// quota updated event carries the previous and new limit
+func (s *UserService) UpgradeUser(ctx context.Context, telegramID int64, newQuotaLimit int64) error {
+	// Validate input
+	if telegramID <= 0 || newQuotaLimit <= 0 {
+		return domain.ErrInvalidInput
+	}
+
+	user, err := s.userRepo.GetByTelegramID(ctx, telegramID)
+	if err != nil {
+		return fmt.Errorf("failed to get user for upgrade: %w", err)
+	}
+
+	if user.IsBanned() {
+		return domain.ErrUserBanned
+	}
+	if user.Status == domain.UserStatusActive {
+		return domain.ErrUserAlreadyActive
+	}
+	if newQuotaLimit <= user.QuotaLimit {
+		return domain.ValidationError{Field: "quota_limit", Message: "must be larger than the current quota limit"}
+	}
+
+	previousStatus := user.Status
+	previousQuotaLimit := user.QuotaLimit
+	user.Upgrade(newQuotaLimit)
+
+	err = s.userRepo.Update(ctx, user)
+	if err != nil {
+		return fmt.Errorf("failed to update user for upgrade: %w", err)
+	}
+
+	s.publishStatusChanged(ctx, user.TelegramID, previousStatus, user.Status)
+	if s.eventService != nil {
+		if err := s.eventService.PublishUserQuotaUpdated(ctx, user.TelegramID, previousQuotaLimit, newQuotaLimit); err != nil {
+			// Log error but don't fail the operation
+			fmt.Printf("Failed to publish user quota updated event: %v\n", err)
+		}
+	}
+
+	return nil
+}
+
+// UpdateQuota stores the total usage reported for a user. Usage beyond the limit is
+// stored as well, after which the user's VPN config is revoked and a
+// QuotaExceededError returned
 func (s *UserService) UpdateQuota(ctx context.Context, telegramID int64, quotaUsed int64) error {
 	// Validate input
 	if telegramID <= 0 {
@@ -157,19 +503,21 @@ func (s *UserService) UpdateQuota(ctx context.Context, telegramID int64, quotaUs
 		return fmt.Errorf("failed to get user for quota update: %w", err)
 	}
 
-	// Check if user is active
-	if !user.IsActive() {
+	// The policy checks an amount on top of the stored usage, which a report replaces
+	reported := *user
+	reported.QuotaUsed = 0
+	allowed, reason := s.quotaPolicy.CanUse(&reported, quotaUsed)
+	switch reason {
+	case domain.QuotaDeniedBanned, domain.QuotaDeniedExpired, domain.QuotaDeniedInactive:
 		return domain.ErrUserNotActive
 	}
-
-	// Check if user has sufficient quota
-	if !user.CanUseQuota(quotaUsed) {
-		return domain.QuotaExceededError{Used: quotaUsed, Limit: user.QuotaLimit}
-	}
+	exceeded := !allowed && reason == domain.QuotaDeniedExceeded
 
 	// Store previous quota for event
 	previousQuota := user.QuotaUsed
 
+	// Usage beyond the limit is stored as reported: the data was used, and the stored
+	// usage is what keeps the user from getting a new config once this one is revoked
 	err = s.userRepo.UpdateQuota(ctx, telegramID, quotaUsed)
 	if err != nil {
 		return fmt.Errorf("failed to update quota: %w", err)
@@ -183,5 +531,408 @@ func (s *UserService) UpdateQuota(ctx context.Context, telegramID int64, quotaUs
 		}
 	}
 
+	if threshold := user.CrossedQuotaAlertThreshold(previousQuota, quotaUsed); threshold > 0 {
+		user.QuotaUsed = quotaUsed
+		s.alertQuotaThreshold(ctx, user, threshold)
+	}
+
+	if exceeded {
+		s.revokeConfig(ctx, telegramID)
+		return domain.QuotaExceededError{Used: quotaUsed, Limit: s.quotaPolicy.EffectiveLimit(user)}
+	}
+
+	return nil
+}
+
+// alertQuotaThreshold records that the user's usage crossed thresholdPct, publishes the
+// event and notifies the user. Failures are logged since the quota update already succeeded
+func (s *UserService) alertQuotaThreshold(ctx context.Context, user *domain.User, thresholdPct int) {
+	// Record the threshold first so a concurrent update cannot alert it a second time
+	if err := s.userRepo.UpdateQuotaAlertedPct(ctx, user.TelegramID, thresholdPct); err != nil {
+		fmt.Printf("Failed to record quota alert threshold: %v\n", err)
+		return
+	}
+	user.QuotaAlertedPct = thresholdPct
+
+	if s.eventService != nil {
+		if err := s.eventService.PublishUserQuotaThresholdReached(ctx, user.TelegramID, thresholdPct, user.QuotaUsed, user.QuotaLimit); err != nil {
+			fmt.Printf("Failed to publish user quota threshold reached event: %v\n", err)
+		}
+	}
+
+	if s.quotaAlertNotifier != nil {
+		if err := s.quotaAlertNotifier.NotifyQuotaAlert(ctx, user, thresholdPct); err != nil {
+			fmt.Printf("Failed to send quota alert: %v\n", err)
+			markUnreachableOn(ctx, s.userRepo, user, err)
+		}
+	}
+}
+
+// markUnreachableOn records that the user cannot be messaged when err says their
+// private chat does not exist or they blocked the bot
+func markUnreachableOn(ctx context.Context, userRepo domain.UserRepository, user *domain.User, err error) {
+	if errors.Is(err, domain.ErrUserBlockedBot) && !user.Blocked {
+		if err := userRepo.UpdateBlocked(ctx, user.TelegramID, true); err != nil {
+			fmt.Printf("Failed to mark user %d blocked: %v\n", user.TelegramID, err)
+			return
+		}
+		user.Blocked = true
+		return
+	}
+	if !errors.Is(err, domain.ErrUserUnreachable) || user.IsUnreachable() {
+		return
+	}
+	now := time.Now()
+	if err := userRepo.UpdateUnreachableAt(ctx, user.TelegramID, &now); err != nil {
+		fmt.Printf("Failed to mark user %d unreachable: %v\n", user.TelegramID, err)
+		return
+	}
+	user.UnreachableAt = &now
+}
+
+// ResetQuota sets a user's used quota back to zero. Resetting a quota that is
+// already zero is a no-op and publishes no event
+func (s *UserService) ResetQuota(ctx context.Context, telegramID int64) error {
+	// Validate input
+	if telegramID <= 0 {
+		return domain.ErrInvalidInput
+	}
+
+	user, err := s.userRepo.GetByTelegramID(ctx, telegramID)
+	if err != nil {
+		return fmt.Errorf("failed to get user for quota reset: %w", err)
+	}
+
+	if user.QuotaUsed == 0 {
+		return nil
+	}
+
+	previousQuota := user.QuotaUsed
+
+	err = s.withTransaction(ctx, func(ctx context.Context, users domain.UserRepository) error {
+		if err := users.UpdateQuota(ctx, telegramID, 0); err != nil {
+			return fmt.Errorf("failed to reset quota: %w", err)
+		}
+
+		// A reset starts a new quota cycle in which every alert threshold fires again
+		if user.QuotaAlertedPct != 0 {
+			if err := users.UpdateQuotaAlertedPct(ctx, telegramID, 0); err != nil {
+				return fmt.Errorf("failed to reset quota alerts: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Publish quota update event
+	if s.eventService != nil {
+		if err := s.eventService.PublishUserQuotaUpdated(ctx, user.TelegramID, previousQuota, 0); err != nil {
+			// Log error but don't fail the operation
+			fmt.Printf("Failed to publish user quota updated event: %v\n", err)
+		}
+	}
+
+	return nil
+}
+
+// BanUser bans a user so they can no longer use the service
+func (s *UserService) BanUser(ctx context.Context, telegramID int64) error {
+	// Validate input
+	if telegramID <= 0 {
+		return domain.ErrInvalidInput
+	}
+
+	user, err := s.userRepo.GetByTelegramID(ctx, telegramID)
+	if err != nil {
+		return fmt.Errorf("failed to get user for ban: %w", err)
+	}
+
+	if user.IsBanned() {
+		return nil
+	}
+
+	previousStatus := user.Status
+	user.Ban()
+
+	err = s.userRepo.Update(ctx, user)
+	if err != nil {
+		return fmt.Errorf("failed to ban user: %w", err)
+	}
+
+	s.publishStatusChanged(ctx, user.TelegramID, previousStatus, user.Status)
+	s.revokeConfig(ctx, user.TelegramID)
+	return nil
+}
+
+// UnbanUser lifts a user's ban so they can use the service again
+func (s *UserService) UnbanUser(ctx context.Context, telegramID int64) error {
+	// Validate input
+	if telegramID <= 0 {
+		return domain.ErrInvalidInput
+	}
+
+	user, err := s.userRepo.GetByTelegramID(ctx, telegramID)
+	if err != nil {
+		return fmt.Errorf("failed to get user for unban: %w", err)
+	}
+
+	if !user.IsBanned() {
+		return nil
+	}
+
+	previousStatus := user.Status
+	user.Unban()
+
+	err = s.userRepo.Update(ctx, user)
+	if err != nil {
+		return fmt.Errorf("failed to unban user: %w", err)
+	}
+
+	s.publishStatusChanged(ctx, user.TelegramID, previousStatus, user.Status)
+	return nil
+}
+
+// MarkBlocked records that the user blocked the bot
+func (s *UserService) MarkBlocked(ctx context.Context, telegramID int64) error {
+	if telegramID <= 0 {
+		return domain.ErrInvalidInput
+	}
+
+	if err := s.userRepo.UpdateBlocked(ctx, telegramID, true); err != nil {
+		return fmt.Errorf("failed to mark user blocked: %w", err)
+	}
+	return nil
+}
+
+// revokeConfig revokes the user's VPN config after they lost access. Failures are
+// logged since the operation that removed access already succeeded
+func (s *UserService) revokeConfig(ctx context.Context, telegramID int64) {
+	if s.configRevoker == nil {
+		return
+	}
+	if err := s.configRevoker.RevokeConfig(ctx, telegramID); err != nil {
+		fmt.Printf("Failed to revoke VPN config: %v\n", err)
+	}
+}
+
+// publishStatusChanged publishes a status transition event when the status actually changed
+func (s *UserService) publishStatusChanged(ctx context.Context, telegramID int64, from, to string) {
+	if s.eventService == nil || from == to {
+		return
+	}
+	if err := s.eventService.PublishUserStatusChanged(ctx, telegramID, from, to); err != nil {
+		// Log error but don't fail the operation
+		fmt.Printf("Failed to publish user status changed event: %v\n", err)
+	}
+}
+
+// DeleteUser soft-deletes a user so they no longer appear in queries
+func (s *UserService) DeleteUser(ctx context.Context, telegramID int64) error {
+	// Validate input
+	if telegramID <= 0 {
+		return domain.ErrInvalidInput
+	}
+
+	// Load the user first so the event carries its final state
+	user, err := s.userRepo.GetByTelegramID(ctx, telegramID)
+	if err != nil {
+		return fmt.Errorf("failed to get user for deletion: %w", err)
+	}
+
+	err = s.userRepo.Delete(ctx, telegramID)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	// Publish user deletion event
+	if s.eventService != nil {
+		if err := s.eventService.PublishUserDeleted(ctx, user.TelegramID, user.Status, user.QuotaUsed); err != nil {
+			// Log error but don't fail the operation
+			fmt.Printf("Failed to publish user deleted event: %v\n", err)
+		}
+	}
+
 	return nil
 }
+
+// SetLanguage stores the language the user chose for bot replies. Callers check that
+// the language is supported; the code is stored lower-cased
+func (s *UserService) SetLanguage(ctx context.Context, telegramID int64, code string) error {
+	// Validate input
+	code = strings.ToLower(strings.TrimSpace(code))
+	if telegramID <= 0 || code == "" {
+		return domain.ErrInvalidInput
+	}
+
+	user, err := s.userRepo.GetByTelegramID(ctx, telegramID)
+	if err != nil {
+		return fmt.Errorf("failed to get user for language change: %w", err)
+	}
+
+	if user.LanguageCode == code {
+		return nil
+	}
+
+	user.LanguageCode = code
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return fmt.Errorf("failed to update user language: %w", err)
+	}
+
+	return nil
+}
+
+// SetAlertThreshold sets the usage percentage the user is alerted at. Zero clears
+// the user's threshold so the default thresholds apply again
+func (s *UserService) SetAlertThreshold(ctx context.Context, telegramID int64, pct int) error {
+	// Validate input
+	if telegramID <= 0 {
+		return domain.ErrInvalidInput
+	}
+	if pct != 0 && (pct < domain.MinAlertThresholdPct || pct > domain.MaxAlertThresholdPct) {
+		return domain.ValidationError{Field: "alert_threshold_pct", Message: fmt.Sprintf("must be between %d and %d", domain.MinAlertThresholdPct, domain.MaxAlertThresholdPct)}
+	}
+
+	user, err := s.userRepo.GetByTelegramID(ctx, telegramID)
+	if err != nil {
+		return fmt.Errorf("failed to get user for alert threshold change: %w", err)
+	}
+
+	if user.AlertThresholdPct == pct {
+		return nil
+	}
+
+	user.AlertThresholdPct = pct
+	// Thresholds alerted at so far no longer apply
+	user.QuotaAlertedPct = 0
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return fmt.Errorf("failed to update user alert threshold: %w", err)
+	}
+
+	return nil
+}
+
+// SetTimezone stores the IANA timezone the user's quiet hours are kept in. An empty
+// name clears it so the configured quiet hours timezone applies again
+func (s *UserService) SetTimezone(ctx context.Context, telegramID int64, name string) error {
+	// Validate input
+	name = strings.TrimSpace(name)
+	if telegramID <= 0 {
+		return domain.ErrInvalidInput
+	}
+	if name != "" && domain.LoadTimezone(name) == nil {
+		return domain.ValidationError{Field: "timezone", Message: fmt.Sprintf("unknown timezone: %s", name)}
+	}
+
+	user, err := s.userRepo.GetByTelegramID(ctx, telegramID)
+	if err != nil {
+		return fmt.Errorf("failed to get user for timezone change: %w", err)
+	}
+
+	if user.Timezone == name {
+		return nil
+	}
+
+	user.Timezone = name
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return fmt.Errorf("failed to update user timezone: %w", err)
+	}
+
+	return nil
+}
+
+// maxListUsersLimit caps the number of users returned by ListUsers and TopByUsage
+const maxListUsersLimit = 100
+
+// ListUsers returns a page of users ordered by ID
+func (s *UserService) ListUsers(ctx context.Context, offset, limit int) ([]*domain.UserSnapshot, error) {
+	if offset < 0 || limit < 1 || limit > maxListUsersLimit {
+		return nil, domain.ErrInvalidInput
+	}
+
+	users, err := s.userRepo.ListUsers(ctx, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	return snapshotsOf(users), nil
+}
+
+// CountUsers returns the number of registered users
+func (s *UserService) CountUsers(ctx context.Context) (int64, error) {
+	count, err := s.userRepo.CountUsers(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+	return count, nil
+}
+
+// TopByUsage returns the users with the highest quota usage, heaviest first
+func (s *UserService) TopByUsage(ctx context.Context, n int) ([]*domain.UserSnapshot, error) {
+	if n < 1 || n > maxListUsersLimit {
+		return nil, domain.ErrInvalidInput
+	}
+
+	users, err := s.userRepo.TopByUsage(ctx, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list top users by usage: %w", err)
+	}
+	return snapshotsOf(users), nil
+}
+
+// snapshotsOf maps users to their read models, keeping the order
+func snapshotsOf(users []*domain.User) []*domain.UserSnapshot {
+	snapshots := make([]*domain.UserSnapshot, len(users))
+	for i, user := range users {
+		snapshots[i] = domain.NewUserSnapshot(user)
+	}
+	return snapshots
+}
+
+// maxSignupWindow caps the window DailySignups counts over
+const maxSignupWindow = 366 * 24 * time.Hour
+
+// DailySignups returns the number of registrations per UTC day from the day of from
+// through the day of to
+func (s *UserService) DailySignups(ctx context.Context, from, to time.Time) ([]domain.DailyCount, error) {
+	if to.Before(from) || to.Sub(from) > maxSignupWindow {
+		return nil, domain.ErrInvalidInput
+	}
+
+	days, err := s.userRepo.DailySignups(ctx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count daily signups: %w", err)
+	}
+	return days, nil
+}
+
+// CountByStatus returns the number of users with each status
+func (s *UserService) CountByStatus(ctx context.Context) (map[string]int64, error) {
+	counts, err := s.userRepo.CountByStatus(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user counts: %w", err)
+	}
+	return counts, nil
+}
+
+// GetAggregateStats returns aggregate user counts and quota consumption
+func (s *UserService) GetAggregateStats(ctx context.Context) (*domain.UserStats, error) {
+	counts, err := s.userRepo.CountByStatus(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user counts: %w", err)
+	}
+
+	totalQuotaUsed, err := s.userRepo.TotalQuotaUsed(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get total quota used: %w", err)
+	}
+
+	stats := &domain.UserStats{
+		UsersByStatus:  counts,
+		TotalQuotaUsed: totalQuotaUsed,
+	}
+	for _, count := range counts {
+		stats.TotalUsers += count
+	}
+	return stats, nil
+}
@@ -2,11 +2,17 @@ package service
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/events"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 // MockUserRepository is a mock implementation of domain.UserRepository
@@ -27,6 +33,14 @@ func (m *MockUserRepository) GetByTelegramID(ctx context.Context, telegramID int
 	return args.Get(0).(*domain.User), args.Error(1)
 }
 
+func (m *MockUserRepository) GetByTelegramIDIncludingDeleted(ctx context.Context, telegramID int64) (*domain.User, error) {
+	args := m.Called(ctx, telegramID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.User), args.Error(1)
+}
+
 func (m *MockUserRepository) Update(ctx context.Context, user *domain.User) error {
 	args := m.Called(ctx, user)
 	return args.Error(0)
@@ -37,6 +51,158 @@ func (m *MockUserRepository) UpdateQuota(ctx context.Context, telegramID int64,
 	return args.Error(0)
 }
 
+func (m *MockUserRepository) AddQuotaLimit(ctx context.Context, telegramID int64, bytes int64) error {
+	args := m.Called(ctx, telegramID, bytes)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdateQuotaAlertedPct(ctx context.Context, telegramID int64, pct int) error {
+	args := m.Called(ctx, telegramID, pct)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) Delete(ctx context.Context, telegramID int64) error {
+	args := m.Called(ctx, telegramID)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) Restore(ctx context.Context, telegramID int64) error {
+	args := m.Called(ctx, telegramID)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) CountByStatus(ctx context.Context) (map[string]int64, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]int64), args.Error(1)
+}
+
+func (m *MockUserRepository) ListPlanExpired(ctx context.Context, before time.Time) ([]*domain.User, error) {
+	args := m.Called(ctx, before)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.User), args.Error(1)
+}
+
+func (m *MockUserRepository) AnonymizeInactive(ctx context.Context, cutoff time.Time) ([]int64, error) {
+	args := m.Called(ctx, cutoff)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+func (m *MockUserRepository) CountAnonymizable(ctx context.Context, cutoff time.Time) (int64, error) {
+	args := m.Called(ctx, cutoff)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) GetByUsername(ctx context.Context, username string) (*domain.User, error) {
+	args := m.Called(ctx, username)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.User), args.Error(1)
+}
+
+func (m *MockUserRepository) GetByReferralCode(ctx context.Context, code string) (*domain.User, error) {
+	args := m.Called(ctx, code)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.User), args.Error(1)
+}
+
+func (m *MockUserRepository) ListUsers(ctx context.Context, offset, limit int) ([]*domain.User, error) {
+	args := m.Called(ctx, offset, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.User), args.Error(1)
+}
+
+func (m *MockUserRepository) CountUsers(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) TopByUsage(ctx context.Context, n int) ([]*domain.User, error) {
+	args := m.Called(ctx, n)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*domain.User), args.Error(1)
+}
+
+func (m *MockUserRepository) TotalQuotaUsed(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateUnreachableAt(ctx context.Context, telegramID int64, at *time.Time) error {
+	args := m.Called(ctx, telegramID, at)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdateBlocked(ctx context.Context, telegramID int64, blocked bool) error {
+	args := m.Called(ctx, telegramID, blocked)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) UpdateLastActiveAt(ctx context.Context, telegramID int64, at time.Time) error {
+	args := m.Called(ctx, telegramID, at)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) DailySignups(ctx context.Context, from, to time.Time) ([]domain.DailyCount, error) {
+	args := m.Called(ctx, from, to)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]domain.DailyCount), args.Error(1)
+}
+
+// fakeTransaction runs transactional work against the given repositories
+type fakeTransaction struct {
+	users    domain.UserRepository
+	payments domain.PaymentRepository
+}
+
+func (t *fakeTransaction) Commit() error                      { return nil }
+func (t *fakeTransaction) Rollback() error                    { return nil }
+func (t *fakeTransaction) Users() domain.UserRepository       { return t.users }
+func (t *fakeTransaction) Payments() domain.PaymentRepository { return t.payments }
+
+// fakeTransactionManager runs WithTransaction against its repositories, running fn
+// again after a deadlock like the real manager, and counts how often it was used
+type fakeTransactionManager struct {
+	tx       fakeTransaction
+	calls    int
+	attempts int
+}
+
+func newFakeTransactionManager(users domain.UserRepository, payments domain.PaymentRepository) *fakeTransactionManager {
+	return &fakeTransactionManager{tx: fakeTransaction{users: users, payments: payments}}
+}
+
+func (m *fakeTransactionManager) WithTransaction(ctx context.Context, fn func(ctx context.Context, tx domain.Transaction) error) error {
+	m.calls++
+	for {
+		m.attempts++
+		err := fn(ctx, &m.tx)
+		if !errors.Is(err, domain.ErrDeadlock) {
+			return err
+		}
+	}
+}
+
+func (m *fakeTransactionManager) BeginTx(ctx context.Context) (domain.UserRepository, domain.Transaction, error) {
+	return m.tx.users, &m.tx, nil
+}
+
 func TestUserService_RegisterUser_NewUser(t *testing.T) {
 	mockRepo := new(MockUserRepository)
 	service := NewUserService(mockRepo)
@@ -49,12 +215,14 @@ func TestUserService_RegisterUser_NewUser(t *testing.T) {
 	// Mock GetByTelegramID to return "not found"
 	mockRepo.On("GetByTelegramID", mock.Anything, telegramID).
 		Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: telegramID})
+	mockRepo.On("GetByTelegramIDIncludingDeleted", mock.Anything, telegramID).
+		Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: telegramID})
 
 	// Mock Create to succeed
 	mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.User")).
 		Return(nil)
 
-	user, err := service.RegisterUser(context.Background(), telegramID, username, firstName, lastName)
+	user, err := service.RegisterUser(context.Background(), telegramID, username, firstName, lastName, "en")
 
 	assert.NoError(t, err)
 	assert.NotNil(t, user)
@@ -63,8 +231,283 @@ func TestUserService_RegisterUser_NewUser(t *testing.T) {
 	assert.Equal(t, firstName, user.FirstName)
 	assert.Equal(t, lastName, user.LastName)
 	assert.Equal(t, domain.UserStatusInactive, user.Status)
+	assert.Len(t, user.ReferralCode, 8)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_RegisterUser_ConcurrentRegistration(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	telegramID := int64(123)
+	existingUser := domain.NewUser(telegramID, "winner", "Test", "User")
+
+	// The user does not exist yet when checked, but is created concurrently before the insert
+	mockRepo.On("GetByTelegramID", mock.Anything, telegramID).
+		Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: telegramID}).Once()
+	mockRepo.On("GetByTelegramIDIncludingDeleted", mock.Anything, telegramID).
+		Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: telegramID})
+	mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.User")).
+		Return(domain.UserAlreadyExistsError{TelegramID: telegramID})
+	mockRepo.On("GetByTelegramID", mock.Anything, telegramID).Return(existingUser, nil).Once()
+
+	user, err := service.RegisterUser(context.Background(), telegramID, "loser", "Test", "User", "en")
+
+	assert.NoError(t, err)
+	assert.Equal(t, existingUser, user)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_RegisterUser_RegionTrialQuota(t *testing.T) {
+	tests := []struct {
+		name          string
+		languageCode  string
+		expectedQuota int64
+	}{
+		{"Configured region", "ru", 104857600},
+		{"Regional tag falls back to base language", "ru-RU", 104857600},
+		{"Exact regional tag", "pt-br", 20971520},
+		{"Unconfigured region uses default", "de", domain.DefaultQuotaLimit},
+		{"Missing language code uses default", "", domain.DefaultQuotaLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			service := NewUserServiceWithEvents(mockRepo, nil, nil)
+			service.SetTrialQuotas(map[string]int64{"ru": 104857600, "pt-BR": 20971520})
+
+			mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).
+				Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: 123})
+			mockRepo.On("GetByTelegramIDIncludingDeleted", mock.Anything, int64(123)).
+				Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: 123})
+			mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.User")).
+				Return(nil)
+
+			user, err := service.RegisterUser(context.Background(), 123, "testuser", "Test", "User", tt.languageCode)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedQuota, user.QuotaLimit)
+			assert.Equal(t, tt.languageCode, user.LanguageCode)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserService_RegisterUser_ConfiguredTrialQuota(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserServiceWithEvents(mockRepo, nil, nil)
+	service.SetTrialQuotaLimit(104857600)
+	service.SetTrialQuotas(map[string]int64{"ru": 20971520})
+
+	mockRepo.On("GetByTelegramID", mock.Anything, mock.AnythingOfType("int64")).
+		Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: 123})
+	mockRepo.On("GetByTelegramIDIncludingDeleted", mock.Anything, mock.AnythingOfType("int64")).
+		Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: 123})
+	mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.User")).
+		Return(nil)
+
+	user, err := service.RegisterUser(context.Background(), 123, "testuser", "Test", "User", "en")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(104857600), user.QuotaLimit)
+
+	// Region overrides still take precedence over the configured default
+	user, err = service.RegisterUser(context.Background(), 124, "testuser", "Test", "User", "ru")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20971520), user.QuotaLimit)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_RegisterUser_TrialQuotaSource(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserServiceWithEvents(mockRepo, nil, nil)
+	service.SetTrialQuotaLimit(104857600)
+
+	quota := int64(209715200)
+	service.SetTrialQuotaSource(func() int64 { return quota })
+
+	mockRepo.On("GetByTelegramID", mock.Anything, mock.AnythingOfType("int64")).
+		Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: 123})
+	mockRepo.On("GetByTelegramIDIncludingDeleted", mock.Anything, mock.AnythingOfType("int64")).
+		Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: 123})
+	mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.User")).
+		Return(nil)
+
+	user, err := service.RegisterUser(context.Background(), 123, "testuser", "Test", "User", "en")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(209715200), user.QuotaLimit)
+
+	// The source is consulted on every registration
+	quota = 10485760
+	user, err = service.RegisterUser(context.Background(), 124, "testuser", "Test", "User", "en")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10485760), user.QuotaLimit)
+}
+
+func TestUserService_RegisterUser_RestoresDeletedUser(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	txRepo := new(MockUserRepository)
+	txManager := newFakeTransactionManager(txRepo, nil)
+	service := NewUserServiceWithEvents(mockRepo, txManager, nil)
+
+	deletedUser := domain.NewUser(123, "olduser", "Test", "User")
+	deletedUser.Status = domain.UserStatusTrial
+	deletedUser.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).
+		Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: 123})
+	mockRepo.On("GetByTelegramIDIncludingDeleted", mock.Anything, int64(123)).
+		Return(deletedUser, nil)
+	txRepo.On("Restore", mock.Anything, int64(123)).Return(nil)
+	txRepo.On("Update", mock.Anything, mock.AnythingOfType("*domain.User")).Return(nil)
 
+	user, err := service.RegisterUser(context.Background(), 123, "newuser", "Test", "User", "en")
+
+	assert.NoError(t, err)
+	assert.False(t, user.IsDeleted())
+	assert.Equal(t, "newuser", user.Username)
+	assert.Equal(t, domain.UserStatusTrial, user.Status)
+	assert.Equal(t, 1, txManager.calls)
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "Restore", mock.Anything, mock.Anything)
 	mockRepo.AssertExpectations(t)
+	txRepo.AssertExpectations(t)
+}
+
+func TestUserService_RegisterWithReferral(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	mockRepo := new(MockUserRepository)
+	txRepo := new(MockUserRepository)
+	txManager := newFakeTransactionManager(txRepo, nil)
+	publisher := events.NewMockPublisher(logger)
+	service := NewUserServiceWithEvents(mockRepo, txManager, events.NewEventService(publisher, logger))
+	service.SetReferralBonus(1024)
+
+	referrer := domain.NewUser(999, "referrer", "Ref", "User")
+	referrer.ReferralCode = "ABCD2345"
+	mockRepo.On("GetByReferralCode", mock.Anything, "ABCD2345").Return(referrer, nil)
+	mockRepo.On("GetByTelegramIDIncludingDeleted", mock.Anything, int64(123)).
+		Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: 123})
+	txRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.User")).Return(nil)
+	txRepo.On("AddQuotaLimit", mock.Anything, int64(999), int64(1024)).Return(nil)
+
+	// Codes from deep links are matched regardless of case and surrounding space
+	user, err := service.RegisterWithReferral(context.Background(), 123, "newuser", "New", "User", "en", " abcd2345 ")
+
+	require.NoError(t, err)
+	require.NotNil(t, user.ReferredBy)
+	assert.Equal(t, int64(999), *user.ReferredBy)
+	assert.Equal(t, int64(domain.DefaultQuotaLimit+1024), user.QuotaLimit)
+	assert.NotEmpty(t, user.ReferralCode)
+
+	// Both writes happen in one transaction, and the referrer is credited in place
+	assert.Equal(t, 1, txManager.calls)
+	txRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+
+	published := publisher.GetPublishedEvents()
+	require.Len(t, published, 2)
+	assert.Equal(t, events.EventUserRegistered, published[0].Type)
+	assert.Equal(t, events.EventUserReferred, published[1].Type)
+	assert.Equal(t, int64(999), published[1].Data["referrer_id"])
+}
+
+func TestUserService_RegisterWithReferral_FallsBack(t *testing.T) {
+	t.Run("Unknown code", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		service := NewUserService(mockRepo)
+
+		mockRepo.On("GetByReferralCode", mock.Anything, "NOPE").
+			Return((*domain.User)(nil), domain.UserNotFoundError{ReferralCode: "NOPE"})
+		mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).
+			Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: 123})
+		mockRepo.On("GetByTelegramIDIncludingDeleted", mock.Anything, int64(123)).
+			Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: 123})
+		mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.User")).Return(nil)
+
+		user, err := service.RegisterWithReferral(context.Background(), 123, "newuser", "New", "User", "en", "nope")
+
+		require.NoError(t, err)
+		assert.Nil(t, user.ReferredBy)
+		assert.Equal(t, int64(domain.DefaultQuotaLimit), user.QuotaLimit)
+		mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Already registered", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		service := NewUserService(mockRepo)
+
+		referrer := domain.NewUser(999, "referrer", "Ref", "User")
+		existing := domain.NewUser(123, "olduser", "Old", "User")
+		mockRepo.On("GetByReferralCode", mock.Anything, "ABCD2345").Return(referrer, nil)
+		mockRepo.On("GetByTelegramIDIncludingDeleted", mock.Anything, int64(123)).Return(existing, nil)
+		mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(existing, nil)
+
+		user, err := service.RegisterWithReferral(context.Background(), 123, "olduser", "Old", "User", "en", "ABCD2345")
+
+		require.NoError(t, err)
+		assert.Same(t, existing, user)
+		assert.Equal(t, int64(domain.DefaultQuotaLimit), referrer.QuotaLimit)
+		mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Registered concurrently", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		txManager := newFakeTransactionManager(mockRepo, nil)
+		service := NewUserServiceWithEvents(mockRepo, txManager, nil)
+
+		referrer := domain.NewUser(999, "referrer", "Ref", "User")
+		existing := domain.NewUser(123, "newuser", "New", "User")
+		mockRepo.On("GetByReferralCode", mock.Anything, "ABCD2345").Return(referrer, nil)
+		mockRepo.On("GetByTelegramIDIncludingDeleted", mock.Anything, int64(123)).
+			Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: 123})
+		mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.User")).
+			Return(domain.UserAlreadyExistsError{TelegramID: 123})
+		mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(existing, nil)
+
+		user, err := service.RegisterWithReferral(context.Background(), 123, "newuser", "New", "User", "en", "ABCD2345")
+
+		require.NoError(t, err)
+		assert.Same(t, existing, user)
+		mockRepo.AssertNotCalled(t, "AddQuotaLimit", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Referrer credit fails", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		service := NewUserServiceWithEvents(mockRepo, newFakeTransactionManager(mockRepo, nil), nil)
+
+		referrer := domain.NewUser(999, "referrer", "Ref", "User")
+		mockRepo.On("GetByReferralCode", mock.Anything, "ABCD2345").Return(referrer, nil)
+		mockRepo.On("GetByTelegramIDIncludingDeleted", mock.Anything, int64(123)).
+			Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: 123})
+		mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.User")).Return(nil)
+		mockRepo.On("AddQuotaLimit", mock.Anything, int64(999), mock.Anything).
+			Return(domain.UserNotFoundError{TelegramID: 999})
+
+		user, err := service.RegisterWithReferral(context.Background(), 123, "newuser", "New", "User", "en", "ABCD2345")
+
+		assert.Nil(t, user)
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+		assert.ErrorContains(t, err, "failed to credit referrer")
+	})
+
+	t.Run("Empty code", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		service := NewUserService(mockRepo)
+
+		existing := domain.NewUser(123, "olduser", "Old", "User")
+		mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(existing, nil)
+
+		_, err := service.RegisterWithReferral(context.Background(), 123, "olduser", "Old", "User", "en", "  ")
+
+		require.NoError(t, err)
+		mockRepo.AssertNotCalled(t, "GetByReferralCode", mock.Anything, mock.Anything)
+	})
 }
 
 func TestUserService_RegisterUser_ExistingUser(t *testing.T) {
@@ -83,7 +526,7 @@ func TestUserService_RegisterUser_ExistingUser(t *testing.T) {
 	mockRepo.On("GetByTelegramID", mock.Anything, telegramID).
 		Return(existingUser, nil)
 
-	user, err := service.RegisterUser(context.Background(), telegramID, username, firstName, lastName)
+	user, err := service.RegisterUser(context.Background(), telegramID, username, firstName, lastName, "en")
 
 	assert.NoError(t, err)
 	assert.NotNil(t, user)
@@ -111,6 +554,99 @@ func TestUserService_GetUser(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
+func TestUserService_GetUserSnapshot(t *testing.T) {
+	expiresAt := time.Now().Add(24 * time.Hour)
+	expiredAt := time.Now().Add(-time.Hour)
+	unreachableAt := time.Now()
+
+	tests := []struct {
+		name     string
+		user     func() *domain.User
+		expected func(t *testing.T, snapshot *domain.UserSnapshot)
+	}{
+		{
+			name: "Active trial with quota left",
+			user: func() *domain.User {
+				user := domain.NewUserWithQuota(123, "testuser", "Test", "User", 1000)
+				user.Status = domain.UserStatusTrial
+				user.ExpiresAt = &expiresAt
+				user.QuotaUsed = 250
+				user.LanguageCode = "es"
+				user.ReferralCode = "ABCD2345"
+				return user
+			},
+			expected: func(t *testing.T, snapshot *domain.UserSnapshot) {
+				assert.Equal(t, int64(123), snapshot.TelegramID)
+				assert.Equal(t, "testuser", snapshot.Username)
+				assert.Equal(t, "es", snapshot.LanguageCode)
+				assert.Equal(t, "ABCD2345", snapshot.ReferralCode)
+				assert.Equal(t, domain.UserStatusTrial, snapshot.Status)
+				assert.Equal(t, int64(750), snapshot.QuotaRemaining)
+				assert.Equal(t, 25.0, snapshot.QuotaUsedPct)
+				assert.True(t, snapshot.Active)
+				assert.False(t, snapshot.Expired)
+				assert.Equal(t, &expiresAt, snapshot.ExpiresAt)
+			},
+		},
+		{
+			name: "Expired user over quota",
+			user: func() *domain.User {
+				user := domain.NewUserWithQuota(123, "testuser", "Test", "User", 1000)
+				user.Status = domain.UserStatusActive
+				user.ExpiresAt = &expiredAt
+				user.QuotaUsed = 1500
+				return user
+			},
+			expected: func(t *testing.T, snapshot *domain.UserSnapshot) {
+				assert.Equal(t, int64(0), snapshot.QuotaRemaining, "remaining quota is never negative")
+				assert.Equal(t, 150.0, snapshot.QuotaUsedPct)
+				assert.False(t, snapshot.Active)
+				assert.True(t, snapshot.Expired)
+			},
+		},
+		{
+			name: "Unreachable user who blocked the bot",
+			user: func() *domain.User {
+				user := domain.NewUserWithQuota(123, "", "Test", "User", 0)
+				user.UnreachableAt = &unreachableAt
+				user.Blocked = true
+				return user
+			},
+			expected: func(t *testing.T, snapshot *domain.UserSnapshot) {
+				assert.Equal(t, 0.0, snapshot.QuotaUsedPct, "no quota means no usage percentage")
+				assert.False(t, snapshot.Active)
+				assert.True(t, snapshot.Unreachable)
+				assert.True(t, snapshot.Blocked)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			service := NewUserService(mockRepo)
+			mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(tt.user(), nil)
+
+			snapshot, err := service.GetUserSnapshot(context.Background(), 123)
+
+			require.NoError(t, err)
+			tt.expected(t, snapshot)
+		})
+	}
+
+	t.Run("Not found", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		service := NewUserService(mockRepo)
+		mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).
+			Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: 123})
+
+		snapshot, err := service.GetUserSnapshot(context.Background(), 123)
+
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+		assert.Nil(t, snapshot)
+	})
+}
+
 func TestUserService_GetUser_NotFound(t *testing.T) {
 	mockRepo := new(MockUserRepository)
 	service := NewUserService(mockRepo)
@@ -149,6 +685,39 @@ func TestUserService_ActivateTrial(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
+func TestUserService_ActivateTrial_SetsExpiry(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration time.Duration
+	}{
+		{name: "configured duration", duration: 72 * time.Hour},
+		{name: "no expiry", duration: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			service := NewUserServiceWithEvents(mockRepo, nil, nil)
+			service.SetTrialDuration(tt.duration)
+
+			user := domain.NewUser(123, "testuser", "Test", "User")
+			mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+			mockRepo.On("Update", mock.Anything, user).Return(nil)
+
+			err := service.ActivateTrial(context.Background(), 123)
+
+			require.NoError(t, err)
+			if tt.duration == 0 {
+				assert.Nil(t, user.ExpiresAt)
+			} else {
+				require.NotNil(t, user.ExpiresAt)
+				assert.WithinDuration(t, time.Now().Add(tt.duration), *user.ExpiresAt, time.Minute)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
 func TestUserService_ActivateTrial_AlreadyActive(t *testing.T) {
 	mockRepo := new(MockUserRepository)
 	service := NewUserService(mockRepo)
@@ -207,61 +776,409 @@ func TestUserService_UpdateQuota(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
-func TestUserService_UpdateQuota_UserNotActive(t *testing.T) {
+// MockQuotaAlertNotifier is a mock implementation of QuotaAlertNotifier
+type MockQuotaAlertNotifier struct {
+	mock.Mock
+}
+
+func (m *MockQuotaAlertNotifier) NotifyQuotaAlert(ctx context.Context, user *domain.User, thresholdPct int) error {
+	args := m.Called(ctx, user, thresholdPct)
+	return args.Error(0)
+}
+
+func TestUserService_UpdateQuota_AlertsAtCustomThreshold(t *testing.T) {
 	mockRepo := new(MockUserRepository)
-	service := NewUserService(mockRepo)
+	notifier := new(MockQuotaAlertNotifier)
+	service := NewUserServiceWithEvents(mockRepo, nil, nil)
+	service.SetQuotaAlertNotifier(notifier)
 
-	telegramID := int64(123)
-	user := domain.NewUser(telegramID, "testuser", "Test", "User")
-	user.Status = domain.UserStatusInactive
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.Status = domain.UserStatusTrial
+	user.QuotaLimit = 1000
+	user.QuotaUsed = 100
+	user.AlertThresholdPct = 50
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("UpdateQuota", mock.Anything, int64(123), mock.AnythingOfType("int64")).Return(nil)
+	mockRepo.On("UpdateQuotaAlertedPct", mock.Anything, int64(123), 50).Return(nil).Once()
+	notifier.On("NotifyQuotaAlert", mock.Anything, mock.MatchedBy(func(u *domain.User) bool {
+		return u.QuotaUsed == 550
+	}), 50).Return(nil).Once()
+
+	// Usage below the custom threshold does not alert
+	require.NoError(t, service.UpdateQuota(context.Background(), 123, 300))
+	require.NoError(t, service.UpdateQuota(context.Background(), 123, 550))
+
+	notifier.AssertExpectations(t)
+}
 
-	mockRepo.On("GetByTelegramID", mock.Anything, telegramID).
-		Return(user, nil)
+func TestUserService_UpdateQuota_AlertFailureDoesNotFail(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	notifier := new(MockQuotaAlertNotifier)
+	service := NewUserServiceWithEvents(mockRepo, nil, nil)
+	service.SetQuotaAlertNotifier(notifier)
 
-	err := service.UpdateQuota(context.Background(), telegramID, 500)
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.Status = domain.UserStatusTrial
+	user.QuotaLimit = 1000
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("UpdateQuota", mock.Anything, int64(123), int64(800)).Return(nil)
+	mockRepo.On("UpdateQuotaAlertedPct", mock.Anything, int64(123), 80).Return(nil)
+	notifier.On("NotifyQuotaAlert", mock.Anything, mock.Anything, 80).Return(assert.AnError)
 
-	assert.Error(t, err)
-	assert.ErrorIs(t, err, domain.ErrUserNotActive)
+	assert.NoError(t, service.UpdateQuota(context.Background(), 123, 800))
+	notifier.AssertExpectations(t)
+}
+
+func TestUserService_UpdateQuota_AlertToMissingChatMarksUnreachable(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	notifier := new(MockQuotaAlertNotifier)
+	service := NewUserServiceWithEvents(mockRepo, nil, nil)
+	service.SetQuotaAlertNotifier(notifier)
 
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.Status = domain.UserStatusTrial
+	user.QuotaLimit = 1000
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("UpdateQuota", mock.Anything, int64(123), int64(800)).Return(nil)
+	mockRepo.On("UpdateQuotaAlertedPct", mock.Anything, int64(123), 80).Return(nil)
+	mockRepo.On("UpdateUnreachableAt", mock.Anything, int64(123), mock.AnythingOfType("*time.Time")).Return(nil).Once()
+	notifier.On("NotifyQuotaAlert", mock.Anything, mock.Anything, 80).Return(domain.ErrUserUnreachable)
+
+	assert.NoError(t, service.UpdateQuota(context.Background(), 123, 800))
+	assert.True(t, user.IsUnreachable())
 	mockRepo.AssertExpectations(t)
 }
 
-func TestUserService_UpdateQuota_ExceedsLimit(t *testing.T) {
+func TestUserService_RegisterUser_ExistingUnreachableUserIsReachableAgain(t *testing.T) {
 	mockRepo := new(MockUserRepository)
 	service := NewUserService(mockRepo)
 
-	telegramID := int64(123)
-	user := domain.NewUser(telegramID, "testuser", "Test", "User")
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	unreachableAt := time.Now().Add(-time.Hour)
+	user.UnreachableAt = &unreachableAt
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("UpdateUnreachableAt", mock.Anything, int64(123), (*time.Time)(nil)).Return(nil).Once()
+
+	registered, err := service.RegisterUser(context.Background(), 123, "testuser", "Test", "User", "en")
+
+	require.NoError(t, err)
+	assert.False(t, registered.IsUnreachable())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_UpdateQuota_AlertToBlockedBotMarksBlocked(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	notifier := new(MockQuotaAlertNotifier)
+	service := NewUserServiceWithEvents(mockRepo, nil, nil)
+	service.SetQuotaAlertNotifier(notifier)
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
 	user.Status = domain.UserStatusTrial
 	user.QuotaLimit = 1000
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("UpdateQuota", mock.Anything, int64(123), int64(800)).Return(nil)
+	mockRepo.On("UpdateQuotaAlertedPct", mock.Anything, int64(123), 80).Return(nil)
+	mockRepo.On("UpdateBlocked", mock.Anything, int64(123), true).Return(nil).Once()
+	notifier.On("NotifyQuotaAlert", mock.Anything, mock.Anything, 80).Return(domain.ErrUserBlockedBot)
+
+	assert.NoError(t, service.UpdateQuota(context.Background(), 123, 800))
+	assert.True(t, user.Blocked)
+	assert.False(t, user.IsUnreachable())
+	mockRepo.AssertExpectations(t)
+}
 
-	mockRepo.On("GetByTelegramID", mock.Anything, telegramID).
-		Return(user, nil)
+func TestUserService_MarkBlocked(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
 
-	err := service.UpdateQuota(context.Background(), telegramID, 1500)
+	mockRepo.On("UpdateBlocked", mock.Anything, int64(123), true).Return(nil).Once()
+	mockRepo.On("UpdateBlocked", mock.Anything, int64(999), true).Return(domain.UserNotFoundError{TelegramID: 999}).Once()
 
-	assert.Error(t, err)
-	assert.ErrorIs(t, err, domain.ErrQuotaExceeded)
+	assert.NoError(t, service.MarkBlocked(context.Background(), 123))
+	assert.ErrorIs(t, service.MarkBlocked(context.Background(), 999), domain.ErrUserNotFound)
+	assert.ErrorIs(t, service.MarkBlocked(context.Background(), 0), domain.ErrInvalidInput)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_RegisterUser_ExistingBlockedUserIsUnblocked(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.Blocked = true
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("UpdateBlocked", mock.Anything, int64(123), false).Return(nil).Once()
 
+	registered, err := service.RegisterUser(context.Background(), 123, "testuser", "Test", "User", "en")
+
+	require.NoError(t, err)
+	assert.False(t, registered.Blocked)
 	mockRepo.AssertExpectations(t)
 }
 
-func TestUserService_RegisterUser_InvalidInput(t *testing.T) {
+func TestUserService_RegisterUser_ExistingAnonymizedUserGetsProfileBack(t *testing.T) {
 	mockRepo := new(MockUserRepository)
 	service := NewUserService(mockRepo)
 
-	tests := []struct {
-		name       string
-		telegramID int64
-		username   string
-		firstName  string
-		lastName   string
-		wantErr    bool
-	}{
-		{
-			name:       "Invalid telegram ID",
-			telegramID: 0,
-			username:   "testuser",
+	user := domain.NewUser(123, "", "", "")
+	user.Status = domain.UserStatusTrial
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("Update", mock.Anything, mock.MatchedBy(func(u *domain.User) bool {
+		return u.TelegramID == 123 && u.Username == "testuser" && u.FirstName == "Test" && u.LastName == "User"
+	})).Return(nil).Once()
+
+	registered, err := service.RegisterUser(context.Background(), 123, "testuser", "Test", "User", "en")
+
+	require.NoError(t, err)
+	assert.Equal(t, "testuser", registered.Username)
+	assert.Equal(t, "Test", registered.FirstName)
+	assert.Equal(t, "User", registered.LastName)
+	assert.Equal(t, domain.UserStatusTrial, registered.Status)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_UpdateQuota_PublishesThresholdReached(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	mockRepo := new(MockUserRepository)
+	publisher := events.NewMockPublisher(logger)
+	service := NewUserServiceWithEvents(mockRepo, nil, events.NewEventService(publisher, logger))
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.Status = domain.UserStatusTrial
+	user.QuotaLimit = 1000
+	user.QuotaUsed = 100
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("UpdateQuota", mock.Anything, int64(123), int64(900)).Return(nil)
+	mockRepo.On("UpdateQuotaAlertedPct", mock.Anything, int64(123), 80).Return(nil)
+
+	require.NoError(t, service.UpdateQuota(context.Background(), 123, 900))
+
+	published := publisher.GetPublishedEvents()
+	require.Len(t, published, 2)
+	assert.Equal(t, events.EventUserQuotaUpdated, published[0].Type)
+	assert.Equal(t, events.EventUserQuotaThresholdReached, published[1].Type)
+	assert.Equal(t, 80, published[1].Data["threshold_pct"])
+	assert.Equal(t, int64(900), published[1].Data["quota_used"])
+	assert.Equal(t, 80, user.QuotaAlertedPct)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_UpdateQuota_ThresholdFiresOncePerCycle(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	notifier := new(MockQuotaAlertNotifier)
+	service := NewUserServiceWithEvents(mockRepo, nil, nil)
+	service.SetQuotaAlertNotifier(notifier)
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.Status = domain.UserStatusTrial
+	user.QuotaLimit = 1000
+	user.QuotaAlertedPct = 80
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("UpdateQuota", mock.Anything, int64(123), mock.AnythingOfType("int64")).Return(nil)
+	mockRepo.On("UpdateQuotaAlertedPct", mock.Anything, int64(123), 100).Return(nil).Once()
+	notifier.On("NotifyQuotaAlert", mock.Anything, mock.Anything, 100).Return(nil).Once()
+
+	// 80% was already alerted in this cycle
+	require.NoError(t, service.UpdateQuota(context.Background(), 123, 850))
+	require.NoError(t, service.UpdateQuota(context.Background(), 123, 1000))
+
+	mockRepo.AssertNotCalled(t, "UpdateQuotaAlertedPct", mock.Anything, int64(123), 80)
+	notifier.AssertExpectations(t)
+}
+
+func TestUserService_UpdateQuota_UserNotActive(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	telegramID := int64(123)
+	user := domain.NewUser(telegramID, "testuser", "Test", "User")
+	user.Status = domain.UserStatusInactive
+
+	mockRepo.On("GetByTelegramID", mock.Anything, telegramID).
+		Return(user, nil)
+
+	err := service.UpdateQuota(context.Background(), telegramID, 500)
+
+	assert.Error(t, err)
+	assert.ErrorIs(t, err, domain.ErrUserNotActive)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_UpdateQuota_UserExpired(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	telegramID := int64(123)
+	user := domain.NewUser(telegramID, "testuser", "Test", "User")
+	user.Status = domain.UserStatusTrial
+	expiredAt := time.Now().Add(-time.Hour)
+	user.ExpiresAt = &expiredAt
+
+	mockRepo.On("GetByTelegramID", mock.Anything, telegramID).
+		Return(user, nil)
+
+	err := service.UpdateQuota(context.Background(), telegramID, 500)
+
+	assert.ErrorIs(t, err, domain.ErrUserNotActive)
+	mockRepo.AssertNotCalled(t, "UpdateQuota", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUserService_UpdateQuota_ExceedsLimit(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	telegramID := int64(123)
+	user := domain.NewUser(telegramID, "testuser", "Test", "User")
+	user.Status = domain.UserStatusTrial
+	user.QuotaLimit = 1000
+
+	mockRepo.On("GetByTelegramID", mock.Anything, telegramID).
+		Return(user, nil)
+	mockRepo.On("UpdateQuota", mock.Anything, telegramID, int64(1500)).
+		Return(nil)
+	mockRepo.On("UpdateQuotaAlertedPct", mock.Anything, telegramID, 100).
+		Return(nil)
+
+	err := service.UpdateQuota(context.Background(), telegramID, 1500)
+
+	assert.Error(t, err)
+	assert.ErrorIs(t, err, domain.ErrQuotaExceeded)
+
+	// The usage beyond the limit is stored as reported and the exhausted alert recorded
+	mockRepo.AssertExpectations(t)
+}
+
+type MockConfigRevoker struct {
+	mock.Mock
+}
+
+func (m *MockConfigRevoker) RevokeConfig(ctx context.Context, telegramID int64) error {
+	args := m.Called(ctx, telegramID)
+	return args.Error(0)
+}
+
+func TestUserService_UpdateQuota_ExceedsLimitRevokesConfig(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	revoker := new(MockConfigRevoker)
+	service := NewUserServiceWithEvents(mockRepo, nil, nil)
+	service.SetConfigRevoker(revoker)
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.Status = domain.UserStatusTrial
+	user.QuotaLimit = 1000
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	var stored bool
+	mockRepo.On("UpdateQuota", mock.Anything, int64(123), int64(1500)).
+		Run(func(mock.Arguments) { stored = true }).
+		Return(nil)
+	mockRepo.On("UpdateQuotaAlertedPct", mock.Anything, int64(123), 100).Return(nil)
+	revoker.On("RevokeConfig", mock.Anything, int64(123)).
+		Run(func(mock.Arguments) { assert.True(t, stored, "usage must be stored before the config is revoked") }).
+		Return(assert.AnError)
+
+	// A failed revocation is logged and the quota error still returned
+	err := service.UpdateQuota(context.Background(), 123, 1500)
+
+	assert.ErrorIs(t, err, domain.ErrQuotaExceeded)
+	revoker.AssertExpectations(t)
+}
+
+func TestUserService_UpdateQuota_WithinLimitKeepsConfig(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	revoker := new(MockConfigRevoker)
+	service := NewUserServiceWithEvents(mockRepo, nil, nil)
+	service.SetConfigRevoker(revoker)
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.Status = domain.UserStatusTrial
+	user.QuotaLimit = 1000
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("UpdateQuota", mock.Anything, int64(123), int64(100)).Return(nil)
+
+	require.NoError(t, service.UpdateQuota(context.Background(), 123, 100))
+	revoker.AssertNotCalled(t, "RevokeConfig", mock.Anything, mock.Anything)
+}
+
+// stubQuotaPolicy allows usage up to a fixed limit, or refuses everything with reason
+type stubQuotaPolicy struct {
+	limit  int64
+	reason domain.QuotaDenialReason
+}
+
+func (p stubQuotaPolicy) CanUse(user *domain.User, amount int64) (bool, domain.QuotaDenialReason) {
+	if p.reason != "" {
+		return false, p.reason
+	}
+	if amount > p.limit {
+		return false, domain.QuotaDeniedExceeded
+	}
+	return true, ""
+}
+
+func (p stubQuotaPolicy) EffectiveLimit(user *domain.User) int64 {
+	return p.limit
+}
+
+func TestUserService_UpdateQuota_UsesQuotaPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      stubQuotaPolicy
+		expectedErr error
+	}{
+		{name: "allowed beyond stored limit", policy: stubQuotaPolicy{limit: 2000}},
+		{name: "exceeded", policy: stubQuotaPolicy{limit: 1000}, expectedErr: domain.ErrQuotaExceeded},
+		{name: "expired", policy: stubQuotaPolicy{reason: domain.QuotaDeniedExpired}, expectedErr: domain.ErrUserNotActive},
+		{name: "banned", policy: stubQuotaPolicy{reason: domain.QuotaDeniedBanned}, expectedErr: domain.ErrUserNotActive},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			service := NewUserServiceWithEvents(mockRepo, nil, nil)
+			service.SetQuotaPolicy(tt.policy)
+
+			user := domain.NewUser(123, "testuser", "Test", "User")
+			user.Status = domain.UserStatusActive
+			mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+			mockRepo.On("UpdateQuota", mock.Anything, int64(123), int64(1500)).Return(nil).Maybe()
+			mockRepo.On("UpdateQuotaAlertedPct", mock.Anything, int64(123), mock.Anything).Return(nil).Maybe()
+
+			err := service.UpdateQuota(context.Background(), 123, 1500)
+
+			if tt.expectedErr == nil {
+				require.NoError(t, err)
+				mockRepo.AssertCalled(t, "UpdateQuota", mock.Anything, int64(123), int64(1500))
+				return
+			}
+			assert.ErrorIs(t, err, tt.expectedErr)
+			if errors.Is(tt.expectedErr, domain.ErrQuotaExceeded) {
+				mockRepo.AssertCalled(t, "UpdateQuota", mock.Anything, int64(123), int64(1500))
+				return
+			}
+			mockRepo.AssertNotCalled(t, "UpdateQuota", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestUserService_RegisterUser_InvalidInput(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	tests := []struct {
+		name       string
+		telegramID int64
+		username   string
+		firstName  string
+		lastName   string
+		wantErr    bool
+	}{
+		{
+			name:       "Invalid telegram ID",
+			telegramID: 0,
+			username:   "testuser",
 			firstName:  "Test",
 			lastName:   "User",
 			wantErr:    true,
@@ -290,11 +1207,13 @@ func TestUserService_RegisterUser_InvalidInput(t *testing.T) {
 			if !tt.wantErr || (tt.telegramID > 0 && tt.firstName != "") {
 				mockRepo.On("GetByTelegramID", mock.Anything, tt.telegramID).
 					Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: tt.telegramID})
+				mockRepo.On("GetByTelegramIDIncludingDeleted", mock.Anything, tt.telegramID).
+					Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: tt.telegramID})
 				mockRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.User")).
 					Return(nil)
 			}
 
-			user, err := service.RegisterUser(context.Background(), tt.telegramID, tt.username, tt.firstName, tt.lastName)
+			user, err := service.RegisterUser(context.Background(), tt.telegramID, tt.username, tt.firstName, tt.lastName, "en")
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -424,3 +1343,565 @@ func TestUserService_UpdateQuota_RepositoryError(t *testing.T) {
 
 	mockRepo.AssertExpectations(t)
 }
+
+func TestUserService_GetAggregateStats(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	counts := map[string]int64{
+		domain.UserStatusInactive: 3,
+		domain.UserStatusTrial:    2,
+		domain.UserStatusActive:   1,
+	}
+	mockRepo.On("CountByStatus", mock.Anything).Return(counts, nil)
+	mockRepo.On("TotalQuotaUsed", mock.Anything).Return(int64(4096), nil)
+
+	stats, err := service.GetAggregateStats(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), stats.TotalUsers)
+	assert.Equal(t, counts, stats.UsersByStatus)
+	assert.Equal(t, int64(4096), stats.TotalQuotaUsed)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_CountByStatus(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	counts := map[string]int64{domain.UserStatusTrial: 2, domain.UserStatusBanned: 1}
+	mockRepo.On("CountByStatus", mock.Anything).Return(counts, nil).Once()
+	mockRepo.On("CountByStatus", mock.Anything).Return(nil, domain.ErrDatabaseError).Once()
+
+	got, err := service.CountByStatus(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, counts, got)
+
+	_, err = service.CountByStatus(context.Background())
+	assert.ErrorIs(t, err, domain.ErrDatabaseError)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_GetAggregateStats_RepositoryError(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	mockRepo.On("CountByStatus", mock.Anything).Return(nil, domain.ErrDatabaseError)
+
+	stats, err := service.GetAggregateStats(context.Background())
+
+	assert.Error(t, err)
+	assert.Nil(t, stats)
+	assert.Contains(t, err.Error(), "failed to get user counts")
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_DailySignups(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+	ctx := context.Background()
+
+	to := time.Date(2024, 3, 12, 15, 0, 0, 0, time.UTC)
+	from := to.AddDate(0, 0, -2)
+	days := []domain.DailyCount{{Day: from.Truncate(24 * time.Hour), Count: 4}}
+	mockRepo.On("DailySignups", ctx, from, to).Return(days, nil)
+
+	result, err := service.DailySignups(ctx, from, to)
+
+	assert.NoError(t, err)
+	assert.Equal(t, days, result)
+
+	// Reversed and overly long windows are rejected before reaching the repository
+	_, err = service.DailySignups(ctx, to, from)
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+	_, err = service.DailySignups(ctx, to.AddDate(-2, 0, 0), to)
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_ResetQuota(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.QuotaUsed = 1048576
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("UpdateQuota", mock.Anything, int64(123), int64(0)).Return(nil)
+
+	err := service.ResetQuota(context.Background(), 123)
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_ResetQuota_AlreadyZero(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+
+	err := service.ResetQuota(context.Background(), 123)
+
+	assert.NoError(t, err)
+	mockRepo.AssertNotCalled(t, "UpdateQuota", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUserService_ResetQuota_InvalidInput(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	err := service.ResetQuota(context.Background(), -1)
+
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+	mockRepo.AssertNotCalled(t, "GetByTelegramID", mock.Anything, mock.Anything)
+}
+
+func TestUserService_SetLanguage(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.LanguageCode = "en"
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("Update", mock.Anything, mock.MatchedBy(func(u *domain.User) bool {
+		return u.LanguageCode == "ru"
+	})).Return(nil)
+
+	err := service.SetLanguage(context.Background(), 123, " RU ")
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_SetLanguage_Unchanged(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.LanguageCode = "es"
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+
+	err := service.SetLanguage(context.Background(), 123, "es")
+
+	assert.NoError(t, err)
+	mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+}
+
+func TestUserService_SetLanguage_InvalidInput(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	assert.ErrorIs(t, service.SetLanguage(context.Background(), -1, "en"), domain.ErrInvalidInput)
+	assert.ErrorIs(t, service.SetLanguage(context.Background(), 123, " "), domain.ErrInvalidInput)
+	mockRepo.AssertNotCalled(t, "GetByTelegramID", mock.Anything, mock.Anything)
+}
+
+func TestUserService_SetLanguage_UserNotFound(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).
+		Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: 123})
+
+	err := service.SetLanguage(context.Background(), 123, "ru")
+
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+}
+
+func TestUserService_SetAlertThreshold(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("Update", mock.Anything, mock.MatchedBy(func(u *domain.User) bool {
+		return u.AlertThresholdPct == 60
+	})).Return(nil).Once()
+
+	require.NoError(t, service.SetAlertThreshold(context.Background(), 123, 60))
+	// Setting the same threshold again is a no-op
+	require.NoError(t, service.SetAlertThreshold(context.Background(), 123, 60))
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_SetTimezone(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("Update", mock.Anything, mock.MatchedBy(func(u *domain.User) bool {
+		return u.Timezone == "Europe/Moscow"
+	})).Return(nil).Once()
+
+	require.NoError(t, service.SetTimezone(context.Background(), 123, " Europe/Moscow "))
+	// Setting the same timezone again is a no-op
+	require.NoError(t, service.SetTimezone(context.Background(), 123, "Europe/Moscow"))
+	assert.Equal(t, "Europe/Moscow", user.Location().String())
+	mockRepo.AssertExpectations(t)
+
+	err := service.SetTimezone(context.Background(), 123, "Mars/Olympus")
+	var validationErr domain.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, "timezone", validationErr.Field)
+	assert.ErrorIs(t, service.SetTimezone(context.Background(), -1, ""), domain.ErrInvalidInput)
+}
+
+func TestUserService_SetAlertThreshold_InvalidInput(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	for _, pct := range []int{-1, 100, 150} {
+		err := service.SetAlertThreshold(context.Background(), 123, pct)
+		var validationErr domain.ValidationError
+		require.ErrorAs(t, err, &validationErr, "pct %d", pct)
+		assert.Equal(t, "alert_threshold_pct", validationErr.Field)
+		assert.ErrorIs(t, err, domain.ErrInvalidInput)
+	}
+	assert.ErrorIs(t, service.SetAlertThreshold(context.Background(), -1, 50), domain.ErrInvalidInput)
+	mockRepo.AssertNotCalled(t, "GetByTelegramID", mock.Anything, mock.Anything)
+}
+
+func TestUserService_ResetQuota_StartsNewAlertCycle(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.QuotaUsed = 900
+	user.QuotaAlertedPct = 80
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("UpdateQuota", mock.Anything, int64(123), int64(0)).Return(nil)
+	mockRepo.On("UpdateQuotaAlertedPct", mock.Anything, int64(123), 0).Return(nil)
+
+	require.NoError(t, service.ResetQuota(context.Background(), 123))
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_ResetQuota_RetriesInTransaction(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	mockRepo := new(MockUserRepository)
+	txRepo := new(MockUserRepository)
+	txManager := newFakeTransactionManager(txRepo, nil)
+	publisher := events.NewMockPublisher(logger)
+	service := NewUserServiceWithEvents(mockRepo, txManager, events.NewEventService(publisher, logger))
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.QuotaUsed = 900
+	user.QuotaAlertedPct = 80
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	txRepo.On("UpdateQuota", mock.Anything, int64(123), int64(0)).Return(nil)
+	txRepo.On("UpdateQuotaAlertedPct", mock.Anything, int64(123), 0).
+		Return(domain.DatabaseError{Operation: "update quota alerted percentage", Err: domain.ErrDeadlock}).Once()
+	txRepo.On("UpdateQuotaAlertedPct", mock.Anything, int64(123), 0).Return(nil)
+
+	require.NoError(t, service.ResetQuota(context.Background(), 123))
+
+	// Both writes were repeated after the deadlock, but the event is published once
+	assert.Equal(t, 2, txManager.attempts)
+	txRepo.AssertNumberOfCalls(t, "UpdateQuota", 2)
+	mockRepo.AssertNotCalled(t, "UpdateQuota", mock.Anything, mock.Anything, mock.Anything)
+	assert.Len(t, publisher.GetPublishedEvents(), 1)
+}
+
+func TestUserService_ResetQuota_UserNotFound(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).
+		Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: 123})
+
+	err := service.ResetQuota(context.Background(), 123)
+
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	mockRepo.AssertNotCalled(t, "UpdateQuota", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUserService_UpgradeUser(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	mockRepo := new(MockUserRepository)
+	publisher := events.NewMockPublisher(logger)
+	service := NewUserServiceWithEvents(mockRepo, nil, events.NewEventService(publisher, logger))
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.ActivateTrial()
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("Update", mock.Anything, user).Return(nil)
+
+	err := service.UpgradeUser(context.Background(), 123, 10*1024*1024*1024)
+
+	require.NoError(t, err)
+	assert.Equal(t, domain.UserStatusActive, user.Status)
+	assert.Equal(t, int64(10*1024*1024*1024), user.QuotaLimit)
+	assert.Nil(t, user.ExpiresAt)
+
+	published := publisher.GetPublishedEvents()
+	require.Len(t, published, 2)
+	assert.Equal(t, events.EventUserStatusChanged, published[0].Type)
+	assert.Equal(t, domain.UserStatusTrial, published[0].Data["previous_status"])
+	assert.Equal(t, domain.UserStatusActive, published[0].Data["new_status"])
+	assert.Equal(t, events.EventUserQuotaUpdated, published[1].Type)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_UpgradeUser_Rejected(t *testing.T) {
+	tests := []struct {
+		name        string
+		telegramID  int64
+		quotaLimit  int64
+		user        *domain.User
+		getErr      error
+		expectedErr error
+	}{
+		{name: "invalid telegram id", telegramID: -1, quotaLimit: 1, expectedErr: domain.ErrInvalidInput},
+		{name: "invalid quota", telegramID: 123, quotaLimit: 0, expectedErr: domain.ErrInvalidInput},
+		{name: "user not found", telegramID: 123, quotaLimit: 1 << 30, getErr: domain.UserNotFoundError{TelegramID: 123}, expectedErr: domain.ErrUserNotFound},
+		{name: "already active", telegramID: 123, quotaLimit: 1 << 30, user: &domain.User{TelegramID: 123, Status: domain.UserStatusActive}, expectedErr: domain.ErrUserAlreadyActive},
+		{name: "banned", telegramID: 123, quotaLimit: 1 << 30, user: &domain.User{TelegramID: 123, Status: domain.UserStatusBanned}, expectedErr: domain.ErrUserBanned},
+		{name: "quota not larger", telegramID: 123, quotaLimit: 1024, user: &domain.User{TelegramID: 123, Status: domain.UserStatusTrial, QuotaLimit: 2048}, expectedErr: domain.ErrInvalidInput},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			service := NewUserService(mockRepo)
+
+			if tt.user != nil || tt.getErr != nil {
+				mockRepo.On("GetByTelegramID", mock.Anything, tt.telegramID).Return(tt.user, tt.getErr)
+			}
+
+			err := service.UpgradeUser(context.Background(), tt.telegramID, tt.quotaLimit)
+
+			assert.ErrorIs(t, err, tt.expectedErr)
+			mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserService_BanUser(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.Status = domain.UserStatusTrial
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("Update", mock.Anything, user).Return(nil)
+
+	err := service.BanUser(context.Background(), 123)
+
+	assert.NoError(t, err)
+	assert.Equal(t, domain.UserStatusBanned, user.Status)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_BanUser_RevokesConfig(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	revoker := new(MockConfigRevoker)
+	service := NewUserServiceWithEvents(mockRepo, nil, nil)
+	service.SetConfigRevoker(revoker)
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.Status = domain.UserStatusActive
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("Update", mock.Anything, user).Return(nil)
+	revoker.On("RevokeConfig", mock.Anything, int64(123)).Return(nil)
+
+	require.NoError(t, service.BanUser(context.Background(), 123))
+	revoker.AssertExpectations(t)
+}
+
+func TestUserService_BanUser_AlreadyBanned(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.Ban()
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+
+	err := service.BanUser(context.Background(), 123)
+
+	assert.NoError(t, err)
+	mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+}
+
+func TestUserService_UnbanUser(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.Ban()
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("Update", mock.Anything, user).Return(nil)
+
+	err := service.UnbanUser(context.Background(), 123)
+
+	assert.NoError(t, err)
+	assert.Equal(t, domain.UserStatusInactive, user.Status)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_UnbanUser_NotBanned(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.Status = domain.UserStatusActive
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+
+	err := service.UnbanUser(context.Background(), 123)
+
+	assert.NoError(t, err)
+	assert.Equal(t, domain.UserStatusActive, user.Status)
+	mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+}
+
+func TestUserService_ActivateTrial_BannedUser(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.Ban()
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+
+	err := service.ActivateTrial(context.Background(), 123)
+
+	assert.ErrorIs(t, err, domain.ErrUserBanned)
+	mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+}
+
+func TestUserService_DeleteUser(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("Delete", mock.Anything, int64(123)).Return(nil)
+
+	err := service.DeleteUser(context.Background(), 123)
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_DeleteUser_InvalidInput(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	err := service.DeleteUser(context.Background(), 0)
+
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+	mockRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+}
+
+func TestUserService_DeleteUser_UserNotFound(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).
+		Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: 123})
+
+	err := service.DeleteUser(context.Background(), 123)
+
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	mockRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+}
+
+func TestUserService_ListUsers(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	users := []*domain.User{domain.NewUser(123, "testuser", "Test", "User")}
+	mockRepo.On("ListUsers", mock.Anything, 10, 10).Return(users, nil)
+
+	result, err := service.ListUsers(context.Background(), 10, 10)
+
+	assert.NoError(t, err)
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, int64(123), result[0].TelegramID)
+		assert.Equal(t, "testuser", result[0].Username)
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUserService_ListUsers_InvalidInput(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	for _, tc := range []struct{ offset, limit int }{{-1, 10}, {0, 0}, {0, 101}} {
+		_, err := service.ListUsers(context.Background(), tc.offset, tc.limit)
+		assert.ErrorIs(t, err, domain.ErrInvalidInput)
+	}
+	mockRepo.AssertNotCalled(t, "ListUsers", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUserService_FindByUsername(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewUserService(mockRepo)
+
+	user := domain.NewUser(123, "alice", "Alice", "A")
+	mockRepo.On("GetByUsername", mock.Anything, "alice").Return(user, nil)
+	mockRepo.On("GetByUsername", mock.Anything, "bob").Return(nil, domain.ErrAmbiguousUsername)
+
+	result, err := service.FindByUsername(context.Background(), " @alice ")
+	assert.NoError(t, err)
+	assert.Equal(t, user, result)
+
+	_, err = service.FindByUsername(context.Background(), "bob")
+	assert.ErrorIs(t, err, domain.ErrAmbiguousUsername)
+
+	_, err = service.FindByUsername(context.Background(), "@")
+	assert.ErrorIs(t, err, domain.ErrInvalidInput)
+}
+
+func TestUserService_PublishesStatusChanged(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	t.Run("Trial activation", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		publisher := events.NewMockPublisher(logger)
+		service := NewUserServiceWithEvents(mockRepo, nil, events.NewEventService(publisher, logger))
+
+		user := domain.NewUser(123, "testuser", "Test", "User")
+		mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+		mockRepo.On("Update", mock.Anything, user).Return(nil)
+
+		require.NoError(t, service.ActivateTrial(context.Background(), 123))
+
+		published := publisher.GetPublishedEvents()
+		require.Len(t, published, 2)
+		assert.Equal(t, events.EventUserTrialActivated, published[0].Type)
+		assert.Equal(t, events.EventUserStatusChanged, published[1].Type)
+		assert.Equal(t, domain.UserStatusInactive, published[1].Data["previous_status"])
+		assert.Equal(t, domain.UserStatusTrial, published[1].Data["new_status"])
+	})
+
+	t.Run("Ban", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		publisher := events.NewMockPublisher(logger)
+		service := NewUserServiceWithEvents(mockRepo, nil, events.NewEventService(publisher, logger))
+
+		user := domain.NewUser(123, "testuser", "Test", "User")
+		user.Status = domain.UserStatusActive
+		mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+		mockRepo.On("Update", mock.Anything, user).Return(nil)
+
+		require.NoError(t, service.BanUser(context.Background(), 123))
+
+		published := publisher.GetPublishedEvents()
+		require.Len(t, published, 1)
+		assert.Equal(t, events.EventUserStatusChanged, published[0].Type)
+		assert.Equal(t, domain.UserStatusActive, published[0].Data["previous_status"])
+		assert.Equal(t, domain.UserStatusBanned, published[0].Data["new_status"])
+	})
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+
+	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/events"
+)
+
+// VPNServer describes the WireGuard server issued configs connect to
+type VPNServer struct {
+	Endpoint  string // host:port clients connect to
+	PublicKey string // base64 WireGuard public key of the server
+	DNS       string
+	// ClientSubnet is the IPv4 subnet client addresses are assigned from. Its first
+	// host address belongs to the server
+	ClientSubnet netip.Prefix
+}
+
+// VPNService implements domain.VPNService
+type VPNService struct {
+	userRepo     domain.UserRepository
+	server       VPNServer
+	quotaPolicy  domain.QuotaPolicy
+	eventService *events.Service
+	logger       *logrus.Logger
+}
+
+// NewVPNService creates a new VPNService instance
+func NewVPNService(userRepo domain.UserRepository, server VPNServer) *VPNService {
+	return &VPNService{
+		userRepo:    userRepo,
+		server:      server,
+		quotaPolicy: domain.DefaultQuotaPolicy{},
+		logger:      logrus.StandardLogger(),
+	}
+}
+
+// SetLogger configures where revocations and failures to publish events are logged
+func (s *VPNService) SetLogger(logger *logrus.Logger) {
+	s.logger = logger
+}
+
+// SetQuotaPolicy configures the rules deciding whether a user may get a config
+func (s *VPNService) SetQuotaPolicy(policy domain.QuotaPolicy) {
+	s.quotaPolicy = policy
+}
+
+// SetEventService configures where user.config_revoked events are published
+func (s *VPNService) SetEventService(eventService *events.Service) {
+	s.eventService = eventService
+}
+
+// GenerateConfig issues a new WireGuard config with a fresh keypair. Only the public
+// key is stored on the user, replacing the key of any earlier config
+func (s *VPNService) GenerateConfig(ctx context.Context, telegramID int64) (*domain.VPNConfig, error) {
+	if telegramID <= 0 {
+		return nil, domain.ErrInvalidInput
+	}
+
+	user, err := s.userRepo.GetByTelegramID(ctx, telegramID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user for VPN config: %w", err)
+	}
+
+	// Any quota left at all is enough to connect
+	if allowed, reason := s.quotaPolicy.CanUse(user, 1); !allowed {
+		if reason == domain.QuotaDeniedExceeded {
+			return nil, domain.QuotaExceededError{Used: user.QuotaUsed, Limit: s.quotaPolicy.EffectiveLimit(user)}
+		}
+		return nil, domain.ErrUserNotActive
+	}
+
+	address, err := clientAddress(s.server.ClientSubnet, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, publicKey, err := generateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	user.VPNPublicKey = publicKey
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to store VPN public key: %w", err)
+	}
+
+	return &domain.VPNConfig{
+		PrivateKey:      privateKey,
+		PublicKey:       publicKey,
+		Address:         address.String(),
+		DNS:             s.server.DNS,
+		ServerPublicKey: s.server.PublicKey,
+		Endpoint:        s.server.Endpoint,
+		AllowedIPs:      domain.DefaultVPNAllowedIPs,
+	}, nil
+}
+
+// RevokeConfig clears the public key of the config issued to the user so the server
+// drops it. Users without an issued config are left unchanged
+func (s *VPNService) RevokeConfig(ctx context.Context, telegramID int64) error {
+	if telegramID <= 0 {
+		return domain.ErrInvalidInput
+	}
+
+	user, err := s.userRepo.GetByTelegramID(ctx, telegramID)
+	if err != nil {
+		return fmt.Errorf("failed to get user for VPN config revocation: %w", err)
+	}
+
+	if user.VPNPublicKey == "" {
+		s.logger.WithField("user_id", telegramID).Debug("No VPN config to revoke")
+		return nil
+	}
+
+	publicKey := user.VPNPublicKey
+	user.VPNPublicKey = ""
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return fmt.Errorf("failed to revoke VPN config: %w", err)
+	}
+
+	if s.eventService != nil {
+		if err := s.eventService.PublishUserConfigRevoked(ctx, user.TelegramID, publicKey); err != nil {
+			// Log error but don't fail the operation
+			s.logger.WithError(err).WithField("user_id", user.TelegramID).Warn("Failed to publish user config revoked event")
+		}
+	}
+
+	return nil
+}
+
+// generateKeyPair creates a base64 encoded WireGuard (X25519) keypair
+func generateKeyPair() (string, string, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate VPN keypair: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(key.Bytes()),
+		base64.StdEncoding.EncodeToString(key.PublicKey().Bytes()), nil
+}
+
+// clientAddress derives a stable address for the user with the given database ID. The
+// network address and the server's first host address are skipped, as is broadcast
+func clientAddress(subnet netip.Prefix, userID int64) (netip.Prefix, error) {
+	subnet = subnet.Masked()
+	if !subnet.Addr().Is4() {
+		return netip.Prefix{}, fmt.Errorf("VPN client subnet %s is not IPv4", subnet)
+	}
+
+	size := uint64(1) << (32 - subnet.Bits())
+	offset := uint64(userID) + 1
+	if userID <= 0 || offset >= size-1 {
+		return netip.Prefix{}, fmt.Errorf("VPN client subnet %s has no address for user %d", subnet, userID)
+	}
+
+	base := subnet.Addr().As4()
+	var addr [4]byte
+	binary.BigEndian.PutUint32(addr[:], binary.BigEndian.Uint32(base[:])+uint32(offset))
+	return netip.PrefixFrom(netip.AddrFrom4(addr), 32), nil
+}
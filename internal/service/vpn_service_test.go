@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdh"
+	"encoding/base64"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var testVPNServer = VPNServer{
+	Endpoint:     "vpn.example.com:51820",
+	PublicKey:    "c2VydmVyLXB1YmxpYy1rZXktMzItYnl0ZXMtbG9uZyE=",
+	DNS:          "1.1.1.1",
+	ClientSubnet: netip.MustParsePrefix("10.8.0.0/24"),
+}
+
+func TestVPNService_GenerateConfig(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewVPNService(mockRepo, testVPNServer)
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.ID = 7
+	user.ActivateTrial()
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("Update", mock.Anything, user).Return(nil)
+
+	config, err := service.GenerateConfig(context.Background(), 123)
+
+	require.NoError(t, err)
+	assert.Equal(t, "10.8.0.8/32", config.Address)
+	assert.Equal(t, testVPNServer.Endpoint, config.Endpoint)
+	assert.Equal(t, testVPNServer.PublicKey, config.ServerPublicKey)
+	assert.Equal(t, "1.1.1.1", config.DNS)
+	assert.Equal(t, domain.DefaultVPNAllowedIPs, config.AllowedIPs)
+
+	// The stored public key belongs to the issued private key
+	privateKey, err := base64.StdEncoding.DecodeString(config.PrivateKey)
+	require.NoError(t, err)
+	key, err := ecdh.X25519().NewPrivateKey(privateKey)
+	require.NoError(t, err)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(key.PublicKey().Bytes()), config.PublicKey)
+	assert.Equal(t, config.PublicKey, user.VPNPublicKey)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestVPNService_GenerateConfig_Rejected(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name        string
+		setup       func(user *domain.User)
+		expectedErr error
+	}{
+		{name: "inactive", setup: func(user *domain.User) {}, expectedErr: domain.ErrUserNotActive},
+		{name: "expired", setup: func(user *domain.User) {
+			user.ActivateTrial()
+			user.ExpiresAt = &past
+		}, expectedErr: domain.ErrUserNotActive},
+		{name: "banned", setup: func(user *domain.User) { user.Ban() }, expectedErr: domain.ErrUserNotActive},
+		{name: "over quota", setup: func(user *domain.User) {
+			user.ActivateTrial()
+			user.QuotaUsed = user.QuotaLimit
+		}, expectedErr: domain.ErrQuotaExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			service := NewVPNService(mockRepo, testVPNServer)
+
+			user := domain.NewUser(123, "testuser", "Test", "User")
+			user.ID = 7
+			tt.setup(user)
+			mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+
+			_, err := service.GenerateConfig(context.Background(), 123)
+
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Empty(t, user.VPNPublicKey)
+			mockRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestVPNService_GenerateConfig_UserNotFound(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewVPNService(mockRepo, testVPNServer)
+
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).
+		Return((*domain.User)(nil), domain.UserNotFoundError{TelegramID: 123})
+
+	_, err := service.GenerateConfig(context.Background(), 123)
+
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+}
+
+func TestVPNService_RevokeConfig(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	mockRepo := new(MockUserRepository)
+	publisher := events.NewMockPublisher(logger)
+	service := NewVPNService(mockRepo, testVPNServer)
+	service.SetEventService(events.NewEventService(publisher, logger))
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.VPNPublicKey = "client-public-key"
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("Update", mock.Anything, user).Return(nil).Once()
+
+	require.NoError(t, service.RevokeConfig(context.Background(), 123))
+	assert.Empty(t, user.VPNPublicKey)
+
+	published := publisher.GetPublishedEvents()
+	require.Len(t, published, 1)
+	assert.Equal(t, events.EventUserConfigRevoked, published[0].Type)
+	assert.Equal(t, "client-public-key", published[0].Data["public_key"])
+
+	// Revoking again finds nothing to revoke
+	require.NoError(t, service.RevokeConfig(context.Background(), 123))
+	assert.Len(t, publisher.GetPublishedEvents(), 1)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestVPNService_RevokeConfig_UpdateFails(t *testing.T) {
+	mockRepo := new(MockUserRepository)
+	service := NewVPNService(mockRepo, testVPNServer)
+
+	user := domain.NewUser(123, "testuser", "Test", "User")
+	user.VPNPublicKey = "client-public-key"
+	mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+	mockRepo.On("Update", mock.Anything, user).Return(assert.AnError)
+
+	err := service.RevokeConfig(context.Background(), 123)
+
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestClientAddress(t *testing.T) {
+	subnet := netip.MustParsePrefix("10.8.0.0/24")
+
+	address, err := clientAddress(subnet, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "10.8.0.2/32", address.String(), "the first host address is the server's")
+
+	address, err = clientAddress(netip.MustParsePrefix("10.8.0.0/16"), 300)
+	require.NoError(t, err)
+	assert.Equal(t, "10.8.1.45/32", address.String())
+
+	address, err = clientAddress(subnet, 253)
+	require.NoError(t, err)
+	assert.Equal(t, "10.8.0.254/32", address.String())
+
+	_, err = clientAddress(subnet, 254)
+	assert.Error(t, err, "the broadcast address is never assigned")
+	_, err = clientAddress(subnet, 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+)
+
+// wgDumpPeerFields is the number of tab-separated fields of a peer line in
+// `wg show <interface> dump`: public key, preshared key, endpoint, allowed IPs,
+// latest handshake, bytes received, bytes sent and persistent keepalive
+const wgDumpPeerFields = 8
+
+// commandRunner runs a command and returns its standard output
+type commandRunner func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+// runCommand runs a command with os/exec
+func runCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).Output()
+}
+
+// WireGuardGateway implements domain.Gateway by reading the peers of a local
+// WireGuard interface with the wg tool, so the bot must run on the VPN server with
+// the privileges wg needs. Users are matched to peers by their stored VPN public key
+type WireGuardGateway struct {
+	userRepo domain.UserRepository
+	device   string
+	run      commandRunner
+}
+
+// NewWireGuardGateway creates a gateway reading the peers of the device interface
+func NewWireGuardGateway(userRepo domain.UserRepository, device string) *WireGuardGateway {
+	return &WireGuardGateway{
+		userRepo: userRepo,
+		device:   device,
+		run:      runCommand,
+	}
+}
+
+// PeerStatus returns the status of the user's peer, or ErrPeerNotFound when the user
+// has no issued config or its peer is not on the interface
+func (g *WireGuardGateway) PeerStatus(ctx context.Context, telegramID int64) (*domain.PeerStatus, error) {
+	user, err := g.userRepo.GetByTelegramID(ctx, telegramID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user for peer status: %w", err)
+	}
+	if user.VPNPublicKey == "" {
+		return nil, domain.ErrPeerNotFound
+	}
+
+	output, err := g.run(ctx, "wg", "show", g.device, "dump")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WireGuard peers: %w", err)
+	}
+	return findPeer(output, user.VPNPublicKey)
+}
+
+// findPeer parses `wg show <interface> dump` output and returns the status of the
+// peer with publicKey. The first line describes the interface itself
+func findPeer(dump []byte, publicKey string) (*domain.PeerStatus, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(dump))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != wgDumpPeerFields || fields[0] != publicKey {
+			continue
+		}
+
+		handshake, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse latest handshake %q: %w", fields[4], err)
+		}
+		received, err := strconv.ParseInt(fields[5], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse bytes received %q: %w", fields[5], err)
+		}
+		sent, err := strconv.ParseInt(fields[6], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse bytes sent %q: %w", fields[6], err)
+		}
+
+		status := &domain.PeerStatus{BytesReceived: received, BytesSent: sent}
+		// wg reports 0 for peers that never completed a handshake
+		if handshake > 0 {
+			lastHandshake := time.Unix(handshake, 0)
+			status.LastHandshake = &lastHandshake
+		}
+		return status, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read WireGuard peers: %w", err)
+	}
+	return nil, domain.ErrPeerNotFound
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testWGDump = "cHJpdmF0ZQ==\tc2VydmVy\t51820\toff\n" +
+	"Y29ubmVjdGVk\t(none)\t203.0.113.7:41234\t10.8.0.8/32\t1709294400\t2048\t4096\toff\n" +
+	"aWRsZQ==\t(none)\t(none)\t10.8.0.9/32\t0\t0\t0\toff\n"
+
+// newTestWireGuardGateway creates a gateway whose wg tool prints output, or fails with err
+func newTestWireGuardGateway(repo domain.UserRepository, output string, err error) (*WireGuardGateway, *[]string) {
+	gateway := NewWireGuardGateway(repo, "wg0")
+	var command []string
+	gateway.run = func(_ context.Context, name string, args ...string) ([]byte, error) {
+		command = append([]string{name}, args...)
+		return []byte(output), err
+	}
+	return gateway, &command
+}
+
+func TestWireGuardGateway_PeerStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		publicKey     string
+		wantHandshake *time.Time
+		wantReceived  int64
+		wantSent      int64
+	}{
+		{
+			name:          "connected peer",
+			publicKey:     "Y29ubmVjdGVk",
+			wantHandshake: func() *time.Time { at := time.Unix(1709294400, 0); return &at }(),
+			wantReceived:  2048,
+			wantSent:      4096,
+		},
+		{
+			name:      "peer without a handshake",
+			publicKey: "aWRsZQ==",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockUserRepository)
+			user := domain.NewUser(123, "testuser", "Test", "User")
+			user.VPNPublicKey = tt.publicKey
+			mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+			gateway, command := newTestWireGuardGateway(mockRepo, testWGDump, nil)
+
+			status, err := gateway.PeerStatus(context.Background(), 123)
+
+			require.NoError(t, err)
+			assert.Equal(t, []string{"wg", "show", "wg0", "dump"}, *command)
+			assert.Equal(t, tt.wantHandshake, status.LastHandshake)
+			assert.Equal(t, tt.wantHandshake != nil, status.HasHandshaked())
+			assert.Equal(t, tt.wantReceived, status.BytesReceived)
+			assert.Equal(t, tt.wantSent, status.BytesSent)
+		})
+	}
+}
+
+func TestWireGuardGateway_PeerNotFound(t *testing.T) {
+	t.Run("no issued config", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(domain.NewUser(123, "testuser", "Test", "User"), nil)
+		gateway, command := newTestWireGuardGateway(mockRepo, testWGDump, nil)
+
+		_, err := gateway.PeerStatus(context.Background(), 123)
+
+		assert.ErrorIs(t, err, domain.ErrPeerNotFound)
+		assert.Empty(t, *command, "wg is not run for users without a config")
+	})
+
+	t.Run("peer not on the interface", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		user := domain.NewUser(123, "testuser", "Test", "User")
+		user.VPNPublicKey = "cmV2b2tlZA=="
+		mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+		gateway, _ := newTestWireGuardGateway(mockRepo, testWGDump, nil)
+
+		_, err := gateway.PeerStatus(context.Background(), 123)
+
+		assert.ErrorIs(t, err, domain.ErrPeerNotFound)
+	})
+}
+
+func TestWireGuardGateway_Errors(t *testing.T) {
+	t.Run("unknown user", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(nil, domain.UserNotFoundError{TelegramID: 123})
+		gateway, _ := newTestWireGuardGateway(mockRepo, "", nil)
+
+		_, err := gateway.PeerStatus(context.Background(), 123)
+
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+
+	t.Run("wg fails", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		user := domain.NewUser(123, "testuser", "Test", "User")
+		user.VPNPublicKey = "Y29ubmVjdGVk"
+		mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+		gateway, _ := newTestWireGuardGateway(mockRepo, "", errors.New("Unable to access interface: Operation not permitted"))
+
+		_, err := gateway.PeerStatus(context.Background(), 123)
+
+		assert.ErrorContains(t, err, "failed to read WireGuard peers")
+		assert.NotErrorIs(t, err, domain.ErrPeerNotFound)
+	})
+
+	t.Run("malformed dump", func(t *testing.T) {
+		mockRepo := new(MockUserRepository)
+		user := domain.NewUser(123, "testuser", "Test", "User")
+		user.VPNPublicKey = "Y29ubmVjdGVk"
+		mockRepo.On("GetByTelegramID", mock.Anything, int64(123)).Return(user, nil)
+		gateway, _ := newTestWireGuardGateway(mockRepo, "Y29ubmVjdGVk\t(none)\t(none)\t10.8.0.8/32\tsoon\t0\t0\toff\n", nil)
+
+		_, err := gateway.PeerStatus(context.Background(), 123)
+
+		assert.ErrorContains(t, err, "failed to parse latest handshake")
+	})
+}
@@ -0,0 +1,18 @@
+package session
+
+import "context"
+
+// contextKey is the context key holding the session of the user being handled
+type contextKey struct{}
+
+// WithContext returns a context carrying the user's session. Handlers change the
+// session in place; whoever loaded it saves it once they return
+func WithContext(ctx context.Context, session *Session) context.Context {
+	return context.WithValue(ctx, contextKey{}, session)
+}
+
+// FromContext returns the session carried by the context, if any
+func FromContext(ctx context.Context) (*Session, bool) {
+	session, ok := ctx.Value(contextKey{}).(*Session)
+	return session, ok && session != nil
+}
@@ -0,0 +1,81 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryEntry is a stored session and when it expires
+type memoryEntry struct {
+	session   *Session
+	expiresAt time.Time
+}
+
+// MemoryStore keeps sessions in memory. Sessions are lost on restart and not shared
+// between instances; use RedisStore for that
+type MemoryStore struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	entries   map[int64]memoryEntry
+	lastSweep time.Time
+}
+
+// NewMemoryStore creates an in-memory session store. A non-positive ttl uses DefaultTTL
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &MemoryStore{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[int64]memoryEntry),
+	}
+}
+
+// Get returns the user's session, or an idle session when there is none
+func (s *MemoryStore) Get(_ context.Context, userID int64) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[userID]
+	if !ok || !s.now().Before(entry.expiresAt) {
+		return New(), nil
+	}
+	return entry.session.clone(), nil
+}
+
+// Set saves the user's session and restarts its TTL
+func (s *MemoryStore) Set(_ context.Context, userID int64, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+	s.entries[userID] = memoryEntry{session: session.clone(), expiresAt: now.Add(s.ttl)}
+	return nil
+}
+
+// Clear removes the user's session
+func (s *MemoryStore) Clear(_ context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, userID)
+	return nil
+}
+
+// sweep forgets expired sessions, at most once per TTL
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.ttl {
+		return
+	}
+	for userID, entry := range s.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(s.entries, userID)
+		}
+	}
+	s.lastSweep = now
+}
@@ -0,0 +1,87 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKeyPrefix prefixes the keys sessions are stored under
+const redisKeyPrefix = "arcanus:session:"
+
+// RedisStore keeps sessions in Redis as JSON, so a flow started on one instance of
+// the bot can continue on another and survives restarts. Redis expires sessions
+// after the TTL
+type RedisStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisStore creates a session store backed by Redis. A non-positive ttl uses
+// DefaultTTL
+func NewRedisStore(client *redis.Client, ttl time.Duration) *RedisStore {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &RedisStore{client: client, ttl: ttl}
+}
+
+// Get returns the user's session, or an idle session when there is none
+func (s *RedisStore) Get(ctx context.Context, userID int64) (*Session, error) {
+	data, err := s.client.Get(ctx, redisKey(userID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return New(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+
+	session := New()
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, fmt.Errorf("failed to decode session: %w", err)
+	}
+	return session, nil
+}
+
+// Set saves the user's session and restarts its TTL
+func (s *RedisStore) Set(ctx context.Context, userID int64, session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+	if err := s.client.Set(ctx, redisKey(userID), data, s.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+// Clear removes the user's session
+func (s *RedisStore) Clear(ctx context.Context, userID int64) error {
+	if err := s.client.Del(ctx, redisKey(userID)).Err(); err != nil {
+		return fmt.Errorf("failed to clear session: %w", err)
+	}
+	return nil
+}
+
+// Ping checks that Redis is reachable
+func (s *RedisStore) Ping(ctx context.Context) error {
+	if err := s.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("failed to reach Redis: %w", err)
+	}
+	return nil
+}
+
+// Close closes the Redis client
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+// redisKey returns the key a user's session is stored under
+func redisKey(userID int64) string {
+	return redisKeyPrefix + strconv.FormatInt(userID, 10)
+}
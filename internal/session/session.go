@@ -0,0 +1,83 @@
+// Package session stores the state of users in multi-step conversational flows,
+// such as entering a payment code after choosing a plan
+package session
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultTTL is how long a session is kept after it was last saved. A user who
+// abandons a flow for longer starts over
+const DefaultTTL = 30 * time.Minute
+
+// State is the step of a conversational flow a user is at
+type State string
+
+// StateIdle is the state of a user outside any flow
+const StateIdle State = ""
+
+// Session is the state of a user's conversation with the bot
+type Session struct {
+	State State `json:"state"`
+	// Data holds the values collected by earlier steps of the flow
+	Data map[string]string `json:"data,omitempty"`
+}
+
+// New returns an idle session
+func New() *Session {
+	return &Session{}
+}
+
+// IsIdle reports whether the user is outside any flow
+func (s *Session) IsIdle() bool {
+	return s.State == StateIdle
+}
+
+// Transition moves the session to the next step, keeping the collected values
+func (s *Session) Transition(state State) {
+	s.State = state
+}
+
+// Value returns a value collected by an earlier step
+func (s *Session) Value(key string) (string, bool) {
+	value, ok := s.Data[key]
+	return value, ok
+}
+
+// SetValue stores a value collected by the current step
+func (s *Session) SetValue(key, value string) {
+	if s.Data == nil {
+		s.Data = make(map[string]string)
+	}
+	s.Data[key] = value
+}
+
+// Reset ends the flow, discarding the collected values
+func (s *Session) Reset() {
+	s.State = StateIdle
+	s.Data = nil
+}
+
+// clone returns a copy that shares no data with s
+func (s *Session) clone() *Session {
+	c := &Session{State: s.State}
+	if s.Data != nil {
+		c.Data = make(map[string]string, len(s.Data))
+		for key, value := range s.Data {
+			c.Data[key] = value
+		}
+	}
+	return c
+}
+
+// SessionStore stores sessions keyed by Telegram user ID. Sessions expire once they
+// were not saved for the store's TTL
+type SessionStore interface {
+	// Get returns the user's session, or an idle session when there is none
+	Get(ctx context.Context, userID int64) (*Session, error)
+	// Set saves the user's session and restarts its TTL
+	Set(ctx context.Context, userID int64, session *Session) error
+	// Clear removes the user's session
+	Clear(ctx context.Context, userID int64) error
+}
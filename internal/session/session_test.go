@@ -0,0 +1,162 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStoreContract checks the behavior every SessionStore shares
+func testStoreContract(t *testing.T, store SessionStore) {
+	ctx := context.Background()
+
+	t.Run("Get without session returns an idle session", func(t *testing.T) {
+		s, err := store.Get(ctx, 1)
+		require.NoError(t, err)
+		assert.True(t, s.IsIdle())
+	})
+
+	t.Run("Set and Get round trip", func(t *testing.T) {
+		s := New()
+		s.Transition("awaiting_payment_code")
+		s.SetValue("plan", "monthly")
+		require.NoError(t, store.Set(ctx, 2, s))
+
+		got, err := store.Get(ctx, 2)
+		require.NoError(t, err)
+		assert.Equal(t, State("awaiting_payment_code"), got.State)
+		plan, ok := got.Value("plan")
+		assert.True(t, ok)
+		assert.Equal(t, "monthly", plan)
+
+		other, err := store.Get(ctx, 3)
+		require.NoError(t, err)
+		assert.True(t, other.IsIdle(), "sessions are kept per user")
+	})
+
+	t.Run("Changes are only stored by Set", func(t *testing.T) {
+		s := New()
+		s.Transition("awaiting_payment_code")
+		require.NoError(t, store.Set(ctx, 4, s))
+
+		s.SetValue("code", "unsaved")
+		got, err := store.Get(ctx, 4)
+		require.NoError(t, err)
+		_, ok := got.Value("code")
+		assert.False(t, ok)
+	})
+
+	t.Run("Clear removes the session", func(t *testing.T) {
+		s := New()
+		s.Transition("awaiting_payment_code")
+		require.NoError(t, store.Set(ctx, 5, s))
+		require.NoError(t, store.Clear(ctx, 5))
+
+		got, err := store.Get(ctx, 5)
+		require.NoError(t, err)
+		assert.True(t, got.IsIdle())
+		assert.NoError(t, store.Clear(ctx, 5), "clearing a missing session is not an error")
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStoreContract(t, NewMemoryStore(time.Minute))
+}
+
+func TestMemoryStore_TTL(t *testing.T) {
+	store := NewMemoryStore(time.Minute)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	s := New()
+	s.Transition("awaiting_payment_code")
+	require.NoError(t, store.Set(ctx, 1, s))
+
+	now = now.Add(59 * time.Second)
+	got, err := store.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.False(t, got.IsIdle())
+
+	// Saving restarts the TTL
+	require.NoError(t, store.Set(ctx, 1, got))
+	now = now.Add(59 * time.Second)
+	got, err = store.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.False(t, got.IsIdle())
+
+	now = now.Add(time.Second)
+	got, err = store.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.True(t, got.IsIdle(), "the session expired")
+
+	// Expired sessions are dropped on a later Set
+	require.NoError(t, store.Set(ctx, 2, s))
+	assert.Len(t, store.entries, 1)
+}
+
+// newTestRedisStore creates a store backed by a fresh miniredis server
+func newTestRedisStore(t *testing.T, ttl time.Duration) (*RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}), ttl)
+	t.Cleanup(func() { _ = store.Close() })
+	return store, mr
+}
+
+func TestRedisStore(t *testing.T) {
+	store, _ := newTestRedisStore(t, time.Minute)
+	testStoreContract(t, store)
+}
+
+func TestRedisStore_TTL(t *testing.T) {
+	store, mr := newTestRedisStore(t, time.Minute)
+	ctx := context.Background()
+
+	s := New()
+	s.Transition("awaiting_payment_code")
+	require.NoError(t, store.Set(ctx, 1, s))
+	assert.Equal(t, time.Minute, mr.TTL("arcanus:session:1"))
+
+	mr.FastForward(time.Minute)
+	got, err := store.Get(ctx, 1)
+	require.NoError(t, err)
+	assert.True(t, got.IsIdle(), "the session expired")
+}
+
+func TestRedisStore_Unreachable(t *testing.T) {
+	store, mr := newTestRedisStore(t, time.Minute)
+	mr.Close()
+
+	_, err := store.Get(context.Background(), 1)
+	assert.ErrorContains(t, err, "failed to load session")
+	assert.Error(t, store.Ping(context.Background()))
+}
+
+func TestSession_Reset(t *testing.T) {
+	s := New()
+	s.Transition("awaiting_payment_code")
+	s.SetValue("plan", "monthly")
+
+	s.Reset()
+	assert.True(t, s.IsIdle())
+	_, ok := s.Value("plan")
+	assert.False(t, ok)
+}
+
+func TestContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+
+	s := New()
+	ctx := WithContext(context.Background(), s)
+	got, ok := FromContext(ctx)
+	require.True(t, ok)
+	got.Transition("awaiting_payment_code")
+	assert.Equal(t, State("awaiting_payment_code"), s.State, "handlers change the loaded session in place")
+}
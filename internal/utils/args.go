@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// argToken is a word of a command's arguments. literal is set when the word starts
+// with a quote, so a quoted "--word" stays positional
+type argToken struct {
+	text    string
+	literal bool
+}
+
+// ParseArgs splits raw command arguments into positional arguments and --flags.
+// Words are separated by whitespace; single or double quotes group words and a
+// backslash escapes the next character outside single quotes. --key=value sets a
+// flag to value and a bare --flag is set to "true". A lone -- ends flag parsing, so
+// every later word is positional. An unterminated quote runs to the end of the input
+func ParseArgs(raw string) (positional []string, flags map[string]string) {
+	positional = []string{}
+	flags = make(map[string]string)
+
+	flagsEnded := false
+	for _, token := range tokenizeArgs(raw) {
+		if flagsEnded || token.literal || !strings.HasPrefix(token.text, "--") {
+			positional = append(positional, token.text)
+			continue
+		}
+		if token.text == "--" {
+			flagsEnded = true
+			continue
+		}
+
+		key, value, hasValue := strings.Cut(strings.TrimPrefix(token.text, "--"), "=")
+		if !hasValue {
+			value = "true"
+		}
+		flags[key] = value
+	}
+	return positional, flags
+}
+
+// tokenizeArgs splits raw into words, honouring quotes and backslash escapes
+func tokenizeArgs(raw string) []argToken {
+	var tokens []argToken
+	var current strings.Builder
+	inToken := false
+	literal := false
+	var quote rune
+	escaped := false
+
+	for _, r := range raw {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inToken = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			if !inToken {
+				inToken = true
+				literal = true
+			}
+		case unicode.IsSpace(r):
+			if inToken {
+				tokens = append(tokens, argToken{text: current.String(), literal: literal})
+				current.Reset()
+				inToken = false
+				literal = false
+			}
+		default:
+			current.WriteRune(r)
+			inToken = true
+		}
+	}
+	if inToken {
+		tokens = append(tokens, argToken{text: current.String(), literal: literal})
+	}
+	return tokens
+}
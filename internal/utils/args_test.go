@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name               string
+		raw                string
+		expectedPositional []string
+		expectedFlags      map[string]string
+	}{
+		{
+			name:               "Empty",
+			raw:                "   ",
+			expectedPositional: []string{},
+			expectedFlags:      map[string]string{},
+		},
+		{
+			name:               "Positional only",
+			raw:                "123  10GB",
+			expectedPositional: []string{"123", "10GB"},
+			expectedFlags:      map[string]string{},
+		},
+		{
+			name:               "Double quotes",
+			raw:                `"hello world" again`,
+			expectedPositional: []string{"hello world", "again"},
+			expectedFlags:      map[string]string{},
+		},
+		{
+			name:               "Single quotes keep backslashes",
+			raw:                `'C:\vpn' next`,
+			expectedPositional: []string{`C:\vpn`, "next"},
+			expectedFlags:      map[string]string{},
+		},
+		{
+			name:               "Escaped quote",
+			raw:                `"say \"hi\"" it\'s`,
+			expectedPositional: []string{`say "hi"`, "it's"},
+			expectedFlags:      map[string]string{},
+		},
+		{
+			name:               "Empty quoted argument",
+			raw:                `"" x`,
+			expectedPositional: []string{"", "x"},
+			expectedFlags:      map[string]string{},
+		},
+		{
+			name:               "Unterminated quote",
+			raw:                `"hello world`,
+			expectedPositional: []string{"hello world"},
+			expectedFlags:      map[string]string{},
+		},
+		{
+			name:               "Boolean flag",
+			raw:                "--dry-run",
+			expectedPositional: []string{},
+			expectedFlags:      map[string]string{"dry-run": "true"},
+		},
+		{
+			name:               "Key value flags",
+			raw:                `--status=trial --message="Hello there" --empty=`,
+			expectedPositional: []string{},
+			expectedFlags:      map[string]string{"status": "trial", "message": "Hello there", "empty": ""},
+		},
+		{
+			name:               "Mixed positional and flags",
+			raw:                `123 --dry-run "10 GB" --reason=abuse`,
+			expectedPositional: []string{"123", "10 GB"},
+			expectedFlags:      map[string]string{"dry-run": "true", "reason": "abuse"},
+		},
+		{
+			name:               "Quoted flag is positional",
+			raw:                `"--dry-run" --force`,
+			expectedPositional: []string{"--dry-run"},
+			expectedFlags:      map[string]string{"force": "true"},
+		},
+		{
+			name:               "Double dash ends flags",
+			raw:                "--force -- --not-a-flag -5",
+			expectedPositional: []string{"--not-a-flag", "-5"},
+			expectedFlags:      map[string]string{"force": "true"},
+		},
+		{
+			name:               "Repeated flag keeps the last value",
+			raw:                "--status=trial --status=active",
+			expectedPositional: []string{},
+			expectedFlags:      map[string]string{"status": "active"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			positional, flags := ParseArgs(tt.raw)
+			assert.Equal(t, tt.expectedPositional, positional)
+			assert.Equal(t, tt.expectedFlags, flags)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"strings"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// EntityBuilder builds message text together with Telegram message entities.
+// Dynamic content is appended as plain text and never interpreted as markup,
+// so it is safe to insert user-controlled values.
+type EntityBuilder struct {
+	text     strings.Builder
+	entities []tgbotapi.MessageEntity
+	offset   int // current length in UTF-16 code units
+}
+
+// NewEntityBuilder creates a new entity builder
+func NewEntityBuilder() *EntityBuilder {
+	return &EntityBuilder{
+		entities: make([]tgbotapi.MessageEntity, 0),
+	}
+}
+
+// Text appends plain text without any formatting
+func (eb *EntityBuilder) Text(s string) *EntityBuilder {
+	eb.text.WriteString(s)
+	eb.offset += UTF16Len(s)
+	return eb
+}
+
+// Bold appends text rendered in bold
+func (eb *EntityBuilder) Bold(s string) *EntityBuilder {
+	return eb.entity("bold", s)
+}
+
+// Italic appends text rendered in italics
+func (eb *EntityBuilder) Italic(s string) *EntityBuilder {
+	return eb.entity("italic", s)
+}
+
+// Code appends text rendered as inline code
+func (eb *EntityBuilder) Code(s string) *EntityBuilder {
+	return eb.entity("code", s)
+}
+
+// Pre appends text rendered as a preformatted block
+func (eb *EntityBuilder) Pre(s string) *EntityBuilder {
+	return eb.entity("pre", s)
+}
+
+// Line appends plain text followed by a newline
+func (eb *EntityBuilder) Line(s string) *EntityBuilder {
+	return eb.Text(s + "\n")
+}
+
+// String returns the accumulated message text
+func (eb *EntityBuilder) String() string {
+	return eb.text.String()
+}
+
+// Entities returns the entities describing the accumulated text
+func (eb *EntityBuilder) Entities() []tgbotapi.MessageEntity {
+	return eb.entities
+}
+
+// entity appends text and records an entity of the given type covering it
+func (eb *EntityBuilder) entity(entityType, s string) *EntityBuilder {
+	length := UTF16Len(s)
+	if length > 0 {
+		eb.entities = append(eb.entities, tgbotapi.MessageEntity{
+			Type:   entityType,
+			Offset: eb.offset,
+			Length: length,
+		})
+	}
+	eb.text.WriteString(s)
+	eb.offset += length
+	return eb
+}
+
+// UTF16Len returns the length of s in UTF-16 code units, which is the unit
+// Telegram uses for entity offsets and lengths
+func UTF16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityBuilder_PlainText(t *testing.T) {
+	eb := NewEntityBuilder().Text("Hello ").Line("World")
+
+	assert.Equal(t, "Hello World\n", eb.String())
+	assert.Empty(t, eb.Entities())
+}
+
+func TestEntityBuilder_Offsets(t *testing.T) {
+	eb := NewEntityBuilder().
+		Text("Name: ").
+		Bold("Alice").
+		Text(" id ").
+		Code("42")
+
+	require.Len(t, eb.Entities(), 2)
+	assert.Equal(t, "Name: Alice id 42", eb.String())
+
+	assert.Equal(t, "bold", eb.Entities()[0].Type)
+	assert.Equal(t, 6, eb.Entities()[0].Offset)
+	assert.Equal(t, 5, eb.Entities()[0].Length)
+
+	assert.Equal(t, "code", eb.Entities()[1].Type)
+	assert.Equal(t, 15, eb.Entities()[1].Offset)
+	assert.Equal(t, 2, eb.Entities()[1].Length)
+}
+
+func TestEntityBuilder_Pre(t *testing.T) {
+	eb := NewEntityBuilder().Line("Config").Pre("A=1\nB=2\n")
+
+	require.Len(t, eb.Entities(), 1)
+	assert.Equal(t, "Config\nA=1\nB=2\n", eb.String())
+	assert.Equal(t, "pre", eb.Entities()[0].Type)
+	assert.Equal(t, 7, eb.Entities()[0].Offset)
+	assert.Equal(t, 8, eb.Entities()[0].Length)
+}
+
+func TestEntityBuilder_MultibyteContent(t *testing.T) {
+	tests := []struct {
+		name           string
+		prefix         string
+		bold           string
+		expectedOffset int
+		expectedLength int
+	}{
+		{
+			name:           "Emoji prefix counts as surrogate pair",
+			prefix:         "📊 ",
+			bold:           "Account",
+			expectedOffset: 3,
+			expectedLength: 7,
+		},
+		{
+			name:           "Emoji inside entity",
+			prefix:         "Hi ",
+			bold:           "🎉 Party",
+			expectedOffset: 3,
+			expectedLength: 8,
+		},
+		{
+			name:           "Cyrillic is one unit per letter",
+			prefix:         "Имя: ",
+			bold:           "Иван",
+			expectedOffset: 5,
+			expectedLength: 4,
+		},
+		{
+			name:           "Combined emoji sequence",
+			prefix:         "👨‍👩‍👧 ",
+			bold:           "Family",
+			expectedOffset: 9,
+			expectedLength: 6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eb := NewEntityBuilder().Text(tt.prefix).Bold(tt.bold)
+
+			require.Len(t, eb.Entities(), 1)
+			entity := eb.Entities()[0]
+			assert.Equal(t, tt.expectedOffset, entity.Offset)
+			assert.Equal(t, tt.expectedLength, entity.Length)
+
+			// The entity must cover exactly the bold text when the message
+			// is viewed the way Telegram does, as UTF-16
+			encoded := utf16.Encode([]rune(eb.String()))
+			covered := string(utf16.Decode(encoded[entity.Offset : entity.Offset+entity.Length]))
+			assert.Equal(t, tt.bold, covered)
+		})
+	}
+}
+
+func TestEntityBuilder_MarkupIsNotInterpreted(t *testing.T) {
+	eb := NewEntityBuilder().Text("*not bold* _x_ [link](http://x)")
+
+	assert.Equal(t, "*not bold* _x_ [link](http://x)", eb.String())
+	assert.Empty(t, eb.Entities())
+}
+
+func TestEntityBuilder_EmptyEntitySkipped(t *testing.T) {
+	eb := NewEntityBuilder().Bold("").Text("plain")
+
+	assert.Equal(t, "plain", eb.String())
+	assert.Empty(t, eb.Entities())
+}
+
+func TestUTF16Len(t *testing.T) {
+	assert.Equal(t, 0, UTF16Len(""))
+	assert.Equal(t, 5, UTF16Len("hello"))
+	assert.Equal(t, 2, UTF16Len("🔐"))
+	assert.Equal(t, 6, UTF16Len("привет"))
+}
@@ -4,6 +4,7 @@ package utils
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -92,15 +93,31 @@ func FormatRelativeTime(t time.Time) string {
 	return t.Format("Jan 2, 2006")
 }
 
-// TruncateString truncates a string to the specified length and adds ellipsis
+// TruncateString truncates a string to the specified length and adds ellipsis.
+// Length is measured in runes so multibyte characters are never split
 func TruncateString(s string, maxLength int) string {
-	if len(s) <= maxLength {
+	runes := []rune(s)
+	if len(runes) <= maxLength {
 		return s
 	}
 	if maxLength <= 3 {
 		return "..."
 	}
-	return s[:maxLength-3] + "..."
+	return string(runes[:maxLength-3]) + "..."
+}
+
+// markdownEscaper backslash-escapes every character that is special in Telegram's
+// MarkdownV2, including the backslash itself
+var markdownEscaper = strings.NewReplacer(
+	"\\", "\\\\", "_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)",
+	"~", "\\~", "`", "\\`", ">", "\\>", "#", "\\#", "+", "\\+", "-", "\\-", "=", "\\=",
+	"|", "\\|", "{", "\\{", "}", "\\}", ".", "\\.", "!", "\\!",
+)
+
+// EscapeMarkdown escapes s so it is shown literally in a MarkdownV2 message. Unlike
+// tgbotapi.EscapeText it also escapes backslashes, so input cannot escape a marker
+func EscapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
 }
 
 // SanitizeString removes potentially dangerous characters from a string
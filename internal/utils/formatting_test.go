@@ -3,6 +3,7 @@ package utils
 import (
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -232,12 +233,37 @@ func TestTruncateString(t *testing.T) {
 			maxLength: 3,
 			expected:  "...",
 		},
+		{
+			name:      "Cyrillic within limit",
+			input:     "Привет",
+			maxLength: 6,
+			expected:  "Привет",
+		},
+		{
+			name:      "Cyrillic truncated",
+			input:     "Привет мир",
+			maxLength: 7,
+			expected:  "Прив...",
+		},
+		{
+			name:      "Emoji within limit",
+			input:     "🔐 VPN",
+			maxLength: 5,
+			expected:  "🔐 VPN",
+		},
+		{
+			name:      "Emoji at truncation boundary",
+			input:     "Hi 🎉🎉🎉 party",
+			maxLength: 7,
+			expected:  "Hi 🎉...",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			result := TruncateString(tt.input, tt.maxLength)
 			assert.Equal(t, tt.expected, result)
+			assert.True(t, utf8.ValidString(result))
 		})
 	}
 }
@@ -282,3 +308,53 @@ func TestSanitizeString(t *testing.T) {
 		})
 	}
 }
+
+func TestEscapeMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Plain text",
+			input:    "Hello World",
+			expected: "Hello World",
+		},
+		{
+			name:     "Bold markers",
+			input:    "*bold*",
+			expected: `\*bold\*`,
+		},
+		{
+			name:     "Underscores",
+			input:    "a_b_c",
+			expected: `a\_b\_c`,
+		},
+		{
+			name:     "Link and code",
+			input:    "[click](http://evil.example) `x`",
+			expected: "\\[click\\]\\(http://evil\\.example\\) \\`x\\`",
+		},
+		{
+			name:     "Backslash",
+			input:    `a\*`,
+			expected: `a\\\*`,
+		},
+		{
+			name:     "Every special character",
+			input:    "_*[]()~`>#+-=|{}.!",
+			expected: "\\_\\*\\[\\]\\(\\)\\~\\`\\>\\#\\+\\-\\=\\|\\{\\}\\.\\!",
+		},
+		{
+			name:     "Unicode",
+			input:    "Иван 😀",
+			expected: "Иван 😀",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, EscapeMarkdown(tt.input))
+		})
+	}
+}
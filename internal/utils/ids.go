@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync/atomic"
+)
+
+// IDGenerator mints unique IDs for events, sessions and correlation
+type IDGenerator interface {
+	NewID() string
+}
+
+// UUIDGenerator mints random (version 4) UUIDs. It is the default generator
+type UUIDGenerator struct{}
+
+// NewID returns a new random UUID. IDs must not collide across processes, so it
+// panics rather than fall back to a weaker source when randomness is unavailable
+func (UUIDGenerator) NewID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("failed to generate ID: %v", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// SequentialIDGenerator mints predictable IDs "<prefix>-1", "<prefix>-2", ... for tests
+type SequentialIDGenerator struct {
+	prefix string
+	next   atomic.Uint64
+}
+
+// NewSequentialIDGenerator creates a sequential generator whose IDs start with prefix
+func NewSequentialIDGenerator(prefix string) *SequentialIDGenerator {
+	return &SequentialIDGenerator{prefix: prefix}
+}
+
+// NewID returns the next ID in the sequence
+func (g *SequentialIDGenerator) NewID() string {
+	return fmt.Sprintf("%s-%d", g.prefix, g.next.Add(1))
+}
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUUIDGenerator(t *testing.T) {
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	var generator IDGenerator = UUIDGenerator{}
+
+	first := generator.NewID()
+	assert.Regexp(t, uuidPattern, first)
+	assert.NotEqual(t, first, generator.NewID())
+}
+
+func TestSequentialIDGenerator(t *testing.T) {
+	var generator IDGenerator = NewSequentialIDGenerator("event")
+
+	assert.Equal(t, "event-1", generator.NewID())
+	assert.Equal(t, "event-2", generator.NewID())
+	assert.Equal(t, "session-1", NewSequentialIDGenerator("session").NewID(), "generators count independently")
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxMessageLength is the longest text Telegram accepts in a single message, in
+// UTF-16 code units
+const MaxMessageLength = 4096
+
+// SplitMessage splits text into chunks of at most limit UTF-16 code units, or
+// MaxMessageLength when limit is not positive. It prefers to split after a line
+// that leaves no Markdown entity open, then at a space that does, and only then
+// anywhere that fits. Newlines at a split are dropped
+func SplitMessage(text string, limit int) []string {
+	if limit <= 0 {
+		limit = MaxMessageLength
+	}
+
+	var chunks []string
+	for UTF16Len(text) > limit {
+		cut := splitPoint(text, limit)
+		if chunk := strings.TrimRight(text[:cut], "\n"); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		text = strings.TrimLeft(text[cut:], "\n")
+	}
+	if text != "" || len(chunks) == 0 {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
+
+// splitPoint returns the byte offset to split text at so the part before it fits
+// within limit UTF-16 code units
+func splitPoint(text string, limit int) int {
+	var md markdownState
+	units := 0
+	hard, line, space, balancedLine, balancedSpace := 0, 0, 0, 0, 0
+
+	for i := 0; i < len(text); {
+		size, n := md.next(text[i:])
+		if units+n > limit {
+			break
+		}
+		units += n
+		i += size
+		hard = i
+
+		switch text[i-size] {
+		case '\n':
+			line = i
+			if md.balanced() {
+				balancedLine = i
+			}
+		case ' ':
+			space = i
+			if md.balanced() {
+				balancedSpace = i
+			}
+		}
+	}
+
+	for _, cut := range []int{balancedLine, balancedSpace, line, space, hard} {
+		if cut > 0 {
+			return cut
+		}
+	}
+	// The limit is smaller than the first character, which is split off on its own
+	_, size := utf8.DecodeRuneInString(text)
+	return size
+}
+
+// markdownState tracks which Telegram Markdown entities are open while scanning text
+type markdownState struct {
+	pre, code, bold, italic bool
+}
+
+// next consumes the token at the start of s, updating the open entities, and returns
+// its size in bytes and UTF-16 code units. Escaped characters and code block fences
+// are single tokens so a split never separates them
+func (md *markdownState) next(s string) (int, int) {
+	switch {
+	case strings.HasPrefix(s, "```"):
+		md.pre = !md.pre
+		return 3, 3
+	case md.pre:
+	case s[0] == '`':
+		md.code = !md.code
+		return 1, 1
+	case md.code:
+	case s[0] == '\\' && len(s) > 1:
+		_, size := utf8.DecodeRuneInString(s[1:])
+		return 1 + size, 1 + UTF16Len(s[1:1+size])
+	case s[0] == '*':
+		md.bold = !md.bold
+	case s[0] == '_':
+		md.italic = !md.italic
+	}
+	_, size := utf8.DecodeRuneInString(s)
+	return size, UTF16Len(s[:size])
+}
+
+// balanced reports whether no entity is open
+func (md *markdownState) balanced() bool {
+	return !md.pre && !md.code && !md.bold && !md.italic
+}
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		limit    int
+		expected []string
+	}{
+		{
+			name:     "Short text",
+			text:     "hello",
+			limit:    10,
+			expected: []string{"hello"},
+		},
+		{
+			name:     "Empty text",
+			text:     "",
+			limit:    10,
+			expected: []string{""},
+		},
+		{
+			name:     "Exactly at the limit",
+			text:     "0123456789",
+			limit:    10,
+			expected: []string{"0123456789"},
+		},
+		{
+			name:     "One over the limit",
+			text:     "0123456789a",
+			limit:    10,
+			expected: []string{"0123456789", "a"},
+		},
+		{
+			name:     "Line boundaries",
+			text:     "line one\nline two\nline three",
+			limit:    18,
+			expected: []string{"line one\nline two", "line three"},
+		},
+		{
+			name:     "Line ending exactly at the limit",
+			text:     "aaaa\nbbbb\ncccc",
+			limit:    5,
+			expected: []string{"aaaa", "bbbb", "cccc"},
+		},
+		{
+			name:     "Multiple chunks",
+			text:     "one\ntwo\nthree\nfour\nfive",
+			limit:    9,
+			expected: []string{"one\ntwo", "three", "four\nfive"},
+		},
+		{
+			name:     "Long line split at a space",
+			text:     "the quick brown fox",
+			limit:    10,
+			expected: []string{"the quick ", "brown fox"},
+		},
+		{
+			name:     "Keeps bold text together",
+			text:     "intro\n*bold\ntext* end",
+			limit:    16,
+			expected: []string{"intro", "*bold\ntext* end"},
+		},
+		{
+			name:     "Keeps code blocks together",
+			text:     "a\n```\nx\ny\n```",
+			limit:    11,
+			expected: []string{"a", "```\nx\ny\n```"},
+		},
+		{
+			name:     "Escaped markers do not open entities",
+			text:     "a \\* b\nc",
+			limit:    7,
+			expected: []string{"a \\* b", "c"},
+		},
+		{
+			name:     "Counts UTF-16 code units",
+			text:     "😀😀😀",
+			limit:    4,
+			expected: []string{"😀😀", "😀"},
+		},
+		{
+			name:     "Limit smaller than a character",
+			text:     "😀😀",
+			limit:    1,
+			expected: []string{"😀", "😀"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, SplitMessage(tt.text, tt.limit))
+		})
+	}
+}
+
+func TestSplitMessage_DefaultLimit(t *testing.T) {
+	line := strings.Repeat("x", 99) + "\n"
+	text := strings.Repeat(line, 100)
+
+	chunks := SplitMessage(text, 0)
+
+	assert.Len(t, chunks, 3)
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, UTF16Len(chunk), MaxMessageLength)
+	}
+	assert.Equal(t, text, strings.Join(chunks, "\n"), "only the newlines at splits are dropped")
+}
@@ -0,0 +1,131 @@
+//go:build integration
+
+package test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/repository"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	tckafka "github.com/testcontainers/testcontainers-go/modules/kafka"
+	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Images of the backends started for the integration tests
+const (
+	postgresImage = "postgres:16-alpine"
+	kafkaImage    = "confluentinc/confluent-local:7.5.0"
+)
+
+// containerStartTimeout bounds how long starting a backend container may take,
+// including pulling its image
+const containerStartTimeout = 5 * time.Minute
+
+// backends holds the containers started for the test binary. Each is started the
+// first time a test needs it and shared by every later test, since starting Kafka
+// takes far longer than any single test
+type backends struct {
+	postgresOnce sync.Once
+	postgres     *tcpostgres.PostgresContainer
+	postgresURL  string
+	postgresErr  error
+
+	kafkaOnce    sync.Once
+	kafka        *tckafka.KafkaContainer
+	kafkaBrokers string
+	kafkaErr     error
+}
+
+var harness backends
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	harness.terminate()
+	os.Exit(code)
+}
+
+// terminate stops the containers started by the tests
+func (b *backends) terminate() {
+	if b.postgres != nil {
+		_ = testcontainers.TerminateContainer(b.postgres)
+	}
+	if b.kafka != nil {
+		_ = testcontainers.TerminateContainer(b.kafka)
+	}
+}
+
+// postgresURL returns the connection string of the PostgreSQL database the tests run
+// against. DATABASE_URL selects an existing database, as in the Docker Compose setup;
+// otherwise a container is started, and the test is skipped when Docker is unavailable
+func postgresURL(t *testing.T) string {
+	t.Helper()
+	if url := os.Getenv("DATABASE_URL"); url != "" {
+		return url
+	}
+
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	harness.postgresOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), containerStartTimeout)
+		defer cancel()
+
+		harness.postgres, harness.postgresErr = tcpostgres.Run(ctx, postgresImage,
+			tcpostgres.WithDatabase("arcanus_vpn_test"),
+			tcpostgres.WithUsername("testuser"),
+			tcpostgres.WithPassword("testpass"),
+			tcpostgres.BasicWaitStrategies(),
+		)
+		if harness.postgresErr == nil {
+			harness.postgresURL, harness.postgresErr = harness.postgres.ConnectionString(ctx, "sslmode=disable")
+		}
+	})
+	require.NoError(t, harness.postgresErr, "Failed to start PostgreSQL container")
+	return harness.postgresURL
+}
+
+// kafkaBrokers returns the bootstrap servers of the Kafka cluster the tests publish
+// to. KAFKA_BROKERS selects an existing cluster; otherwise a container is started,
+// and the test is skipped when Docker is unavailable
+func kafkaBrokers(t *testing.T) string {
+	t.Helper()
+	if brokers := os.Getenv("KAFKA_BROKERS"); brokers != "" {
+		return brokers
+	}
+
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	harness.kafkaOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), containerStartTimeout)
+		defer cancel()
+
+		harness.kafka, harness.kafkaErr = tckafka.Run(ctx, kafkaImage, tckafka.WithClusterID("arcanus-test"))
+		if harness.kafkaErr == nil {
+			var brokers []string
+			brokers, harness.kafkaErr = harness.kafka.Brokers(ctx)
+			harness.kafkaBrokers = strings.Join(brokers, ",")
+		}
+	})
+	require.NoError(t, harness.kafkaErr, "Failed to start Kafka container")
+	return harness.kafkaBrokers
+}
+
+// openPostgres connects to the test database and applies the bot's migrations
+func openPostgres(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.Open(postgresURL(t)), &gorm.Config{})
+	require.NoError(t, err, "Failed to connect to database")
+	require.NoError(t, repository.AutoMigrate(context.Background(), db), "Failed to migrate database")
+
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+	return db
+}
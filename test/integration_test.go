@@ -6,8 +6,8 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"os"
 	"testing"
+	"time"
 
 	_ "github.com/lib/pq" // PostgreSQL driver
 	"github.com/sirupsen/logrus"
@@ -16,58 +16,12 @@ import (
 	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/service"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"gorm.io/driver/postgres"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
+// setupTestDatabase connects to the PostgreSQL test database, see postgresURL
 func setupTestDatabase(t *testing.T) (*gorm.DB, func()) {
-	// Get database URL from environment
-	databaseURL := os.Getenv("DATABASE_URL")
-
-	// Use SQLite for local testing if no DATABASE_URL is provided
-	if databaseURL == "" {
-		// Use in-memory SQLite for local testing
-		db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-		require.NoError(t, err, "Failed to connect to database")
-
-		// Auto migrate the schema
-		err = db.AutoMigrate(&domain.User{})
-		require.NoError(t, err, "Failed to migrate database")
-
-		// Return cleanup function
-		cleanup := func() {
-			// Clean up test data
-			_ = db.Exec("DELETE FROM users")
-		}
-
-		return db, cleanup
-	}
-
-	// Use PostgreSQL if DATABASE_URL is provided (for Docker testing)
-	db, err := gorm.Open(postgres.Open(databaseURL), &gorm.Config{})
-	require.NoError(t, err, "Failed to connect to database")
-
-	// Auto migrate the schema
-	err = db.AutoMigrate(&domain.User{})
-	if err != nil {
-		t.Logf("Migration error: %v", err)
-		// Try to create table manually if AutoMigrate fails
-		err = db.Exec(`CREATE TABLE IF NOT EXISTS users (
-			id BIGSERIAL PRIMARY KEY,
-			telegram_id BIGINT UNIQUE NOT NULL,
-			username VARCHAR(255),
-			first_name VARCHAR(255),
-			last_name VARCHAR(255),
-			status VARCHAR(50) DEFAULT 'inactive',
-			quota_limit BIGINT DEFAULT 52428800,
-			quota_used BIGINT DEFAULT 0,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			deleted_at TIMESTAMP NULL
-		)`).Error
-	}
-	require.NoError(t, err, "Failed to migrate database")
+	db := openPostgres(t)
 
 	// Return cleanup function
 	cleanup := func() {
@@ -92,7 +46,7 @@ func TestIntegration_UserRegistration(t *testing.T) {
 
 	t.Run("Register new user", func(t *testing.T) {
 		// Register a new user
-		user, err := userService.RegisterUser(ctx, 12345, "testuser", "Test", "User")
+		user, err := userService.RegisterUser(ctx, 12345, "testuser", "Test", "User", "en")
 		require.NoError(t, err)
 		assert.NotNil(t, user)
 		assert.Equal(t, int64(12345), user.TelegramID)
@@ -106,7 +60,7 @@ func TestIntegration_UserRegistration(t *testing.T) {
 
 	t.Run("Register existing user", func(t *testing.T) {
 		// Try to register the same user again
-		user, err := userService.RegisterUser(ctx, 12345, "testuser", "Test", "User")
+		user, err := userService.RegisterUser(ctx, 12345, "testuser", "Test", "User", "en")
 		require.NoError(t, err)
 		assert.NotNil(t, user)
 		assert.Equal(t, int64(12345), user.TelegramID)
@@ -128,6 +82,43 @@ func TestIntegration_UserRegistration(t *testing.T) {
 	})
 }
 
+func TestIntegration_SoftDelete(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+
+	userRepo := repository.NewUserRepository(db)
+	userService := service.NewUserService(userRepo)
+	ctx := context.Background()
+
+	_, err := userService.RegisterUser(ctx, 44444, "deleteuser", "Delete", "User", "en")
+	require.NoError(t, err)
+	require.NoError(t, userService.ActivateTrial(ctx, 44444))
+
+	t.Run("Deleted user is hidden", func(t *testing.T) {
+		require.NoError(t, userService.DeleteUser(ctx, 44444))
+
+		_, err := userService.GetUser(ctx, 44444)
+		assert.ErrorIs(t, err, domain.ErrUserNotFound)
+
+		user, err := userRepo.GetByTelegramIDIncludingDeleted(ctx, 44444)
+		require.NoError(t, err)
+		assert.True(t, user.IsDeleted())
+	})
+
+	t.Run("Re-registering restores the user", func(t *testing.T) {
+		user, err := userService.RegisterUser(ctx, 44444, "returning", "Delete", "User", "en")
+		require.NoError(t, err)
+		assert.False(t, user.IsDeleted())
+		assert.Equal(t, "returning", user.Username)
+		// The trial is not granted again
+		assert.Equal(t, domain.UserStatusTrial, user.Status)
+
+		user, err = userService.GetUser(ctx, 44444)
+		require.NoError(t, err)
+		assert.Equal(t, "returning", user.Username)
+	})
+}
+
 func TestIntegration_TrialActivation(t *testing.T) {
 	db, cleanup := setupTestDatabase(t)
 	defer cleanup()
@@ -138,7 +129,7 @@ func TestIntegration_TrialActivation(t *testing.T) {
 
 	t.Run("Activate trial for new user", func(t *testing.T) {
 		// Register user first
-		user, err := userService.RegisterUser(ctx, 54321, "trialuser", "Trial", "User")
+		user, err := userService.RegisterUser(ctx, 54321, "trialuser", "Trial", "User", "en")
 		require.NoError(t, err)
 		assert.Equal(t, domain.UserStatusInactive, user.Status)
 
@@ -177,7 +168,7 @@ func TestIntegration_QuotaManagement(t *testing.T) {
 
 	t.Run("Update quota for active user", func(t *testing.T) {
 		// Register and activate user
-		_, err := userService.RegisterUser(ctx, 11111, "quotauser", "Quota", "User")
+		_, err := userService.RegisterUser(ctx, 11111, "quotauser", "Quota", "User", "en")
 		require.NoError(t, err)
 		err = userService.ActivateTrial(ctx, 11111)
 		require.NoError(t, err)
@@ -195,7 +186,7 @@ func TestIntegration_QuotaManagement(t *testing.T) {
 
 	t.Run("Update quota for inactive user", func(t *testing.T) {
 		// Register user without activating
-		_, err := userService.RegisterUser(ctx, 22222, "inactiveuser", "Inactive", "User")
+		_, err := userService.RegisterUser(ctx, 22222, "inactiveuser", "Inactive", "User", "en")
 		require.NoError(t, err)
 
 		// Try to update quota
@@ -206,7 +197,7 @@ func TestIntegration_QuotaManagement(t *testing.T) {
 
 	t.Run("Update quota exceeding limit", func(t *testing.T) {
 		// Register and activate user
-		_, err := userService.RegisterUser(ctx, 33333, "exceeduser", "Exceed", "User")
+		_, err := userService.RegisterUser(ctx, 33333, "exceeduser", "Exceed", "User", "en")
 		require.NoError(t, err)
 		err = userService.ActivateTrial(ctx, 33333)
 		require.NoError(t, err)
@@ -283,7 +274,7 @@ func TestIntegration_ConcurrentOperations(t *testing.T) {
 		// Register users sequentially (avoiding SQLite concurrency issues)
 		for i := 0; i < numUsers; i++ {
 			_, err := userService.RegisterUser(ctx, int64(70000+i),
-				fmt.Sprintf("user%d", i), "Sequential", "User")
+				fmt.Sprintf("user%d", i), "Sequential", "User", "en")
 			assert.NoError(t, err)
 		}
 
@@ -296,40 +287,65 @@ func TestIntegration_ConcurrentOperations(t *testing.T) {
 	})
 }
 
-func TestIntegration_DatabaseConnection(t *testing.T) {
-	t.Run("Database connectivity", func(t *testing.T) {
-		databaseURL := os.Getenv("DATABASE_URL")
+func TestIntegration_ConcurrentRegistrationInTransaction(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
 
-		if databaseURL == "" {
-			// Test SQLite connection for local testing
-			db, err := sql.Open("sqlite3", ":memory:")
-			require.NoError(t, err)
-			defer db.Close()
+	ctx := context.Background()
+	txManager := repository.NewTransactionManager(db)
+	const telegramID = int64(80000)
+
+	// Another registration inserts the user but has not committed yet
+	otherRepo, otherTx, err := txManager.BeginTx(ctx)
+	require.NoError(t, err)
+	require.NoError(t, otherRepo.Create(ctx, domain.NewUser(telegramID, "winner", "Concurrent", "User")))
+
+	txRepo, tx, err := txManager.BeginTx(ctx)
+	require.NoError(t, err)
+	userService := service.NewUserService(txRepo)
+
+	// The insert blocks on the other transaction's row and fails once it commits
+	type registration struct {
+		user *domain.User
+		err  error
+	}
+	done := make(chan registration, 1)
+	go func() {
+		user, err := userService.RegisterUser(ctx, telegramID, "loser", "Concurrent", "User", "en")
+		done <- registration{user: user, err: err}
+	}()
+	time.Sleep(200 * time.Millisecond)
+	require.NoError(t, otherTx.Commit())
+
+	result := <-done
+	require.NoError(t, result.err)
+	assert.Equal(t, "winner", result.user.Username)
+
+	// The savepoint kept the transaction usable after the unique violation
+	_, err = userService.RegisterUser(ctx, telegramID+1, "other", "Concurrent", "User", "en")
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
 
-			// Test connection
-			err = db.Ping()
-			require.NoError(t, err, "Database connection failed")
+	userRepo := repository.NewUserRepository(db)
+	user, err := userRepo.GetByTelegramID(ctx, telegramID+1)
+	require.NoError(t, err)
+	assert.Equal(t, "other", user.Username)
+}
 
-			// Test query
-			var result int
-			err = db.QueryRow("SELECT 1").Scan(&result)
-			require.NoError(t, err)
-			assert.Equal(t, 1, result)
-		} else {
-			// Test PostgreSQL connection for Docker testing
-			db, err := sql.Open("postgres", databaseURL)
-			require.NoError(t, err)
-			defer db.Close()
+func TestIntegration_DatabaseConnection(t *testing.T) {
+	t.Run("Database connectivity", func(t *testing.T) {
+		db, err := sql.Open("postgres", postgresURL(t))
+		require.NoError(t, err)
+		defer db.Close()
 
-			// Test connection
-			err = db.Ping()
-			require.NoError(t, err, "Database connection failed")
+		// Test connection
+		err = db.Ping()
+		require.NoError(t, err, "Database connection failed")
 
-			// Test query
-			var result int
-			err = db.QueryRow("SELECT 1").Scan(&result)
-			require.NoError(t, err)
-			assert.Equal(t, 1, result)
-		}
+		// Test query
+		var result int
+		err = db.QueryRow("SELECT 1").Scan(&result)
+		require.NoError(t, err)
+		assert.Equal(t, 1, result)
 	})
 }
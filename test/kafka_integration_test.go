@@ -0,0 +1,138 @@
+//go:build integration
+
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/sirupsen/logrus"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/domain"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/events"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/repository"
+	"github.com/smirnoffmg/arcanus-vpn-telegram-bot/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createTopic creates a topic named after the test, so tests sharing a cluster do
+// not read each other's events
+func createTopic(t *testing.T, brokers string) string {
+	t.Helper()
+	topic := fmt.Sprintf("arcanus-events-it-%d", time.Now().UnixNano())
+
+	admin, err := kafka.NewAdminClient(&kafka.ConfigMap{"bootstrap.servers": brokers})
+	require.NoError(t, err)
+	defer admin.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	results, err := admin.CreateTopics(ctx, []kafka.TopicSpecification{{Topic: topic, NumPartitions: 3, ReplicationFactor: 1}})
+	require.NoError(t, err)
+	for _, result := range results {
+		require.Equal(t, kafka.ErrNoError, result.Error.Code(), "Failed to create topic: %v", result.Error)
+	}
+	return topic
+}
+
+// consumeEvent reads topic from the beginning until an event matching match arrives
+func consumeEvent(t *testing.T, brokers, topic string, match func(*events.Event) bool) (*events.Event, *kafka.Message) {
+	t.Helper()
+	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
+		"bootstrap.servers": brokers,
+		"group.id":          topic + "-reader",
+		"auto.offset.reset": "earliest",
+	})
+	require.NoError(t, err)
+	defer consumer.Close()
+	require.NoError(t, consumer.Subscribe(topic, nil))
+
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		msg, err := consumer.ReadMessage(time.Second)
+		if err != nil {
+			if kafkaErr, ok := err.(kafka.Error); ok && kafkaErr.IsTimeout() {
+				continue
+			}
+			require.NoError(t, err)
+		}
+
+		event, err := events.FromJSON(msg.Value)
+		require.NoError(t, err)
+		if match(event) {
+			return event, msg
+		}
+	}
+	t.Fatalf("no matching event on topic %s", topic)
+	return nil, nil
+}
+
+func TestIntegration_RegistrationPublishesToKafka(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+	brokers := kafkaBrokers(t)
+	topic := createTopic(t, brokers)
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+	publisher, err := events.NewKafkaPublisher(events.KafkaConfig{
+		Brokers:           brokers,
+		Topic:             topic,
+		EnableIdempotence: true,
+		Acks:              "all",
+		RetryBackoffMs:    100,
+		RequestTimeoutMs:  30000,
+		SyncDelivery:      true,
+	}, logger)
+	require.NoError(t, err)
+	eventService := events.NewEventService(publisher, logger)
+	defer eventService.Close()
+
+	userRepo := repository.NewUserRepository(db)
+	userService := service.NewUserServiceWithEvents(userRepo, repository.NewTransactionManager(db), eventService)
+	ctx := context.Background()
+	const telegramID = int64(90001)
+
+	_, err = userService.RegisterUser(ctx, telegramID, "kafkauser", "Kafka", "User", "en")
+	require.NoError(t, err)
+
+	event, msg := consumeEvent(t, brokers, topic, func(event *events.Event) bool {
+		return event.Type == events.EventUserRegistered && event.UserID != nil && *event.UserID == telegramID
+	})
+	assert.Equal(t, "kafkauser", event.Data["username"])
+	assert.Equal(t, "user_90001", string(msg.Key), "events of a user share a partition key")
+
+	// The event matches what was stored
+	user, err := userRepo.GetByTelegramID(ctx, telegramID)
+	require.NoError(t, err)
+	assert.EqualValues(t, user.QuotaLimit, event.Data["quota_limit"])
+}
+
+func TestIntegration_PostgresUniqueViolation(t *testing.T) {
+	db, cleanup := setupTestDatabase(t)
+	defer cleanup()
+
+	userRepo := repository.NewUserRepository(db)
+	ctx := context.Background()
+
+	require.NoError(t, userRepo.Create(ctx, domain.NewUser(90002, "first", "Unique", "User")))
+
+	// PostgreSQL reports the duplicate with its own error code, which must still map
+	// to the domain error
+	err := userRepo.Create(ctx, domain.NewUser(90002, "second", "Unique", "User"))
+	assert.ErrorIs(t, err, domain.ErrUserAlreadyExists)
+
+	// Inside a transaction the failed insert must not abort the transaction
+	txRepo, tx, err := repository.NewTransactionManager(db).BeginTx(ctx)
+	require.NoError(t, err)
+	assert.ErrorIs(t, txRepo.Create(ctx, domain.NewUser(90002, "third", "Unique", "User")), domain.ErrUserAlreadyExists)
+	require.NoError(t, txRepo.Create(ctx, domain.NewUser(90003, "fourth", "Unique", "User")))
+	require.NoError(t, tx.Commit())
+
+	user, err := userRepo.GetByTelegramID(ctx, 90003)
+	require.NoError(t, err)
+	assert.Equal(t, "fourth", user.Username)
+}